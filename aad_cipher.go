@@ -0,0 +1,41 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[aad_cipher.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+// aadBoundCipher wraps an AADCipher so that it can be used as a plain
+// SymmetricCipher: Encrypt and Decrypt always bind the same AAD.
+type aadBoundCipher struct {
+	AADCipher
+	aad []byte
+} //                                                              aadBoundCipher
+
+// bindAAD returns 'cphr' with additional authenticated data 'aad' bound
+// to all encryption and decryption. If 'aad' is empty, returns 'cphr'.
+//
+// Returns an error if 'cphr' doesn't implement AADCipher.
+//
+func bindAAD(cphr SymmetricCipher, aad []byte) (SymmetricCipher, error) {
+	if len(aad) == 0 {
+		return cphr, nil
+	}
+	ac, ok := cphr.(AADCipher)
+	if !ok {
+		return nil, makeError(0xE2F7F6, "cipher doesn't support AAD")
+	}
+	return &aadBoundCipher{AADCipher: ac, aad: aad}, nil
+} //                                                                     bindAAD
+
+// Encrypt encrypts plaintext, binding the AAD to the ciphertext.
+func (bc *aadBoundCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	return bc.EncryptAAD(plaintext, bc.aad)
+} //                                                                     Encrypt
+
+// Decrypt decrypts ciphertext, which must have been bound to the AAD.
+func (bc *aadBoundCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	return bc.DecryptAAD(ciphertext, bc.aad)
+} //                                                                     Decrypt
+
+// end
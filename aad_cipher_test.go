@@ -0,0 +1,50 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /[aad_cipher_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"testing"
+)
+
+// bindAAD(cphr SymmetricCipher, aad []byte) (SymmetricCipher, error)
+//
+// go test -run Test_bindAAD_
+//
+func Test_bindAAD_(t *testing.T) {
+	ac := newTestAESCipher(t)
+	//
+	// without AAD, must return the cipher itself
+	cphr, err := bindAAD(ac, nil)
+	if cphr != SymmetricCipher(ac) || err != nil {
+		t.Error("0xEB23DF", err)
+	}
+	// must fail with a cipher that doesn't implement AADCipher
+	_, err = bindAAD(&plainCipher{}, []byte("tenant-a"))
+	if !matchError(err, "cipher doesn't support AAD") {
+		t.Error("0xEC0AA3", "wrong error:", err)
+	}
+	// ciphertext must only decrypt with the same AAD
+	a, _ := bindAAD(ac, []byte("tenant-a"))
+	b, _ := bindAAD(ac, []byte("tenant-b"))
+	ciphertext, err := a.Encrypt([]byte("abc"))
+	if err != nil {
+		t.Error("0xECD7D8", err)
+	}
+	plaintext, err := a.Decrypt(ciphertext)
+	if string(plaintext) != "abc" || err != nil {
+		t.Error("0xE0AB20", err)
+	}
+	_, err = b.Decrypt(ciphertext)
+	if !matchError(err, "message authentication failed") {
+		t.Error("0xE0D7B0", "wrong error:", err)
+	}
+	_, err = ac.Decrypt(ciphertext)
+	if !matchError(err, "message authentication failed") {
+		t.Error("0xE04599", "wrong error:", err)
+	}
+}
+
+// end
@@ -0,0 +1,171 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[active_transfers.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// TransferInfo describes a data item being transferred, as listed by
+// Sender.ActiveTransfers() and Receiver.ActiveTransfers().
+type TransferInfo struct {
+
+	// Key is the key of the data item.
+	Key string
+
+	// Address is the address of the Receiver to which the Sender is
+	// sending the item, or of the Sender from which the Receiver is
+	// receiving it. It is blank if the Receiver doesn't know it yet.
+	Address string
+
+	// Started is when the Sender began sending the item,
+	// or when the Receiver received its first fragment.
+	Started time.Time
+} //                                                                TransferInfo
+
+// activeTransfer is a transfer of a Sender that CancelAll() can cancel.
+type activeTransfer struct {
+	info   *TransferInfo // nil for the items SendMany() hasn't started
+	cancel context.CancelCauseFunc
+} //                                                              activeTransfer
+
+// ActiveTransfers returns the data items that the Sender is sending,
+// including those being sent by SendMany(), ordered by when they began.
+// It is safe to call from any goroutine.
+func (sd *Sender) ActiveTransfers() []TransferInfo {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	var ret []TransferInfo
+	for at := range sd.active {
+		if at.info != nil {
+			ret = append(ret, *at.info)
+		}
+	}
+	sortTransfers(ret)
+	return ret
+} //                                                             ActiveTransfers
+
+// CancelAll cancels all the data items that the Sender is sending,
+// including those SendMany() hasn't started yet, for example to free
+// bandwidth at once. Their Send calls stop sending packets and return
+// an error that wraps ErrTransferCancelled and includes 'reason'.
+// Returns the number of transfers cancelled.
+func (sd *Sender) CancelAll(reason string) int {
+	err := transferCancelled(0xE0C4D1, reason)
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	n := 0
+	for at := range sd.active {
+		at.cancel(err)
+		if at.info != nil {
+			n++
+		}
+	}
+	return n
+} //                                                                   CancelAll
+
+// addActive lists the transfer described by 'info', which 'cancel'
+// cancels, in ActiveTransfers() of this Sender, or of the Sender that
+// created it. Returns the function that removes it from the list.
+func (sd *Sender) addActive(info *TransferInfo, cancel context.CancelCauseFunc,
+) (remove func()) {
+	owner := sd.owner()
+	at := &activeTransfer{info: info, cancel: cancel}
+	owner.mu.Lock()
+	if owner.active == nil {
+		owner.active = make(map[*activeTransfer]struct{})
+	}
+	owner.active[at] = struct{}{}
+	owner.mu.Unlock()
+	return func() {
+		owner.mu.Lock()
+		delete(owner.active, at)
+		owner.mu.Unlock()
+	}
+} //                                                                   addActive
+
+// owner returns the Sender that lists the transfers of this Sender in
+// its ActiveTransfers(): the Sender that created it, or itself.
+func (sd *Sender) owner() *Sender {
+	if sd.parent != nil {
+		return sd.parent
+	}
+	return sd
+} //                                                                       owner
+
+// ActiveTransfers returns the data items that the Receiver is receiving
+// and hasn't delivered yet, ordered by when their first fragment arrived.
+// It is safe to call while the Receiver is running.
+func (rc *Receiver) ActiveTransfers() []TransferInfo {
+	if rc.receivingMu != nil {
+		rc.receivingMu.Lock()
+		defer rc.receivingMu.Unlock()
+	}
+	var ret []TransferInfo
+	for _, it := range rc.receiving {
+		if it.done {
+			continue
+		}
+		info := TransferInfo{Key: it.nack.key, Started: it.started}
+		if it.nack.addr != nil {
+			info.Address = it.nack.addr.String()
+		}
+		ret = append(ret, info)
+	}
+	sortTransfers(ret)
+	return ret
+} //                                                             ActiveTransfers
+
+// CancelAll cancels all the data items that the Receiver is receiving,
+// for example to free bandwidth at once. Their pieces are discarded,
+// and their further fragments are no longer confirmed, so that their
+// Senders give up. The writers returned by ReceiveStream are closed
+// with an error that wraps ErrTransferCancelled and includes 'reason'.
+// Returns the number of transfers cancelled.
+func (rc *Receiver) CancelAll(reason string) int {
+	err := transferCancelled(0xEDF4FC, reason)
+	if rc.receivingMu != nil {
+		rc.receivingMu.Lock()
+		defer rc.receivingMu.Unlock()
+	}
+	n := 0
+	for _, it := range rc.receiving {
+		if it.done {
+			continue
+		}
+		if it.stream != nil {
+			it.stream.abort(err)
+		}
+		rc.flushPieces(it)
+		it.dataItem.Reset()
+		it.subPieces = nil
+		it.done = true
+		it.cancelled = err
+		n++
+	}
+	return n
+} //                                                                   CancelAll
+
+// transferCancelled returns the error with which
+// CancelAll(reason) cancels transfers.
+func transferCancelled(id uint32, reason string) error {
+	return makeError(id, ErrTransferCancelled, "by CancelAll:", reason)
+} //                                                           transferCancelled
+
+// sortTransfers sorts 'transfers' by their start time, then key.
+func sortTransfers(transfers []TransferInfo) {
+	sort.Slice(transfers, func(i, j int) bool {
+		a, b := &transfers[i], &transfers[j]
+		if !a.Started.Equal(b.Started) {
+			return a.Started.Before(b.Started)
+		}
+		return a.Key < b.Key
+	})
+} //                                                               sortTransfers
+
+// end
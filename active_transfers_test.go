@@ -0,0 +1,101 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                          /[active_transfers_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// (sd *Sender) CancelAll(reason string) int
+//
+// go test -run Test_Sender_CancelAll_
+
+// must list a Send that is waiting for confirmations, and make it
+// return ErrTransferCancelled at once when it is cancelled
+func Test_Sender_CancelAll_(t *testing.T) {
+	// a 'Receiver' that never confirms anything
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("0xE391D4", err)
+	}
+	defer conn.Close()
+	sd := makeTestSender()
+	sd.Address = conn.LocalAddr().String()
+	sd.Config.ReplyTimeout = 10 * time.Second
+	sd.Config.SendWaitInterval = time.Millisecond
+	done := make(chan error, 1)
+	go func() { done <- sd.Send("key", []byte("value")) }()
+	var active []TransferInfo
+	for i := 0; i < 100 && len(active) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		active = sd.ActiveTransfers()
+	}
+	if len(active) != 1 || active[0].Key != "key" ||
+		active[0].Address != sd.Address {
+		t.Fatal("0xEB650A", active)
+	}
+	if n := sd.CancelAll("test"); n != 1 {
+		t.Error("0xE27BB4", n)
+	}
+	select {
+	case err = <-done:
+		if !errors.Is(err, ErrTransferCancelled) {
+			t.Error("0xEDF749", "wrong error:", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("0xEA9A49", "Send wasn't cancelled")
+	}
+	if active := sd.ActiveTransfers(); len(active) != 0 {
+		t.Error("0xE4CA81", active)
+	}
+}
+
+// (rc *Receiver) CancelAll(reason string) int
+//
+// go test -run Test_Receiver_CancelAll_
+
+// must list an item being received, abort its writer when it is
+// cancelled, and no longer confirm its fragments
+func Test_Receiver_CancelAll_(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = 100
+	sd.dataHash = getHash(v)
+	sd.comp = comp
+	_ = sd.makePackets("key", sd.comp)
+	var buf streamBuffer
+	rc := newRunnableReceiver()
+	rc.ReceiveStream = func(k string) (io.WriteCloser, error) {
+		return &buf, nil
+	}
+	_, err := rc.receiveFragment(sd.packets[0].data)
+	if err != nil {
+		t.Fatal("0xEBEABE", err)
+	}
+	active := rc.ActiveTransfers()
+	if len(active) != 1 || active[0].Key != "key" || active[0].Started.IsZero() {
+		t.Error("0xEBF940", active)
+	}
+	if n := rc.CancelAll("test"); n != 1 {
+		t.Error("0xE3B34D", n)
+	}
+	if !buf.closed || !errors.Is(buf.closeErr, ErrTransferCancelled) {
+		t.Error("0xE73E4B", buf.closed, buf.closeErr)
+	}
+	reply, err := rc.receiveFragment(sd.packets[1].data)
+	if reply != nil || !errors.Is(err, ErrTransferCancelled) {
+		t.Error("0xE25304", "wrong error:", err)
+	}
+	if active := rc.ActiveTransfers(); len(active) != 0 {
+		t.Error("0xE00792", active)
+	}
+}
+
+// end
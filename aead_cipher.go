@@ -0,0 +1,195 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[aead_cipher.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"sync"
+)
+
+// aeadCipher implements the SymmetricCipher interface that encrypts and
+// decrypts plaintext using any AEAD algorithm with a 32-byte key, such
+// as ChaCha20-Poly1305 (see NewAEADCipher).
+//
+// Like aesCipher, it can be used by several Senders and Receivers at
+// the same time, so the fields after 'mu' are protected by it.
+//
+type aeadCipher struct {
+	name      string                                // of the algorithm
+	newAEAD   func(key []byte) (cipher.AEAD, error) // see NewAEADCipher
+	mu        sync.RWMutex
+	cryptoKey []byte
+	aead      cipher.AEAD
+	strict    bool      // see Configuration.StrictCrypto
+	random    io.Reader // see Configuration.Random; nil for crypto/rand
+} //                                                                  aeadCipher
+
+// NewAEADCipher returns a SymmetricCipher that encrypts each packet with
+// the AEAD algorithm called 'name', which 'newAEAD' creates from a
+// 32-byte key, using a random nonce. It is meant for modules that add
+// ciphers to udpt, such as github.com/balacode/udpt/chacha, which uses
+// it for ChaCha20-Poly1305. Unlike other implementations of
+// SymmetricCipher, the cipher it returns supports AAD, PreviousKeys,
+// Configuration.StrictCrypto, Random and KeyExchange, like the
+// built-in AES-256 cipher.
+func NewAEADCipher(name string,
+	newAEAD func(key []byte) (cipher.AEAD, error),
+) SymmetricCipher {
+	return &aeadCipher{name: name, newAEAD: newAEAD}
+} //                                                               NewAEADCipher
+
+// ValidateKey checks if an encryption key is suitable for use with the cipher.
+//
+// The encryption key must be exactly 32 bytes long.
+//
+func (ac *aeadCipher) ValidateKey(cryptoKey []byte) error {
+	if len(cryptoKey) != 32 {
+		return makeError(0xE6F9EE, ac.name+" key must be 32 bytes long")
+	}
+	return nil
+} //                                                                 ValidateKey
+
+// SetKey initializes the cipher with the specified encryption key.
+//
+// If the cipher is already initialized with the given key, does nothing.
+// The same key is used for encryption and decryption.
+//
+// The cipher keeps its own copy of the key, so the caller
+// can reuse or zero 'cryptoKey' after SetKey returns.
+//
+func (ac *aeadCipher) SetKey(cryptoKey []byte) error {
+	err := ac.ValidateKey(cryptoKey)
+	if err != nil {
+		return makeError(0xE97440, err)
+	}
+	ac.mu.RLock()
+	same := bytes.Equal(ac.cryptoKey, cryptoKey)
+	ac.mu.RUnlock()
+	if same {
+		return nil
+	}
+	if ac.newAEAD == nil {
+		return makeError(0xE2D8B5, "nil AEAD constructor for", ac.name)
+	}
+	aead, err := ac.newAEAD(cryptoKey)
+	if err != nil {
+		return makeError(0xE5C1A7, err)
+	}
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.strict {
+		err = checkAEADParams(aead)
+		if err != nil {
+			return err
+		}
+	}
+	ac.aead = aead
+	ac.cryptoKey = append([]byte(nil), cryptoKey...)
+	return nil
+} //                                                                      SetKey
+
+// Encrypt encrypts plaintext using the encryption key given to SetKey and
+// returns the encrypted ciphertext, using the AEAD algorithm.
+//
+// You need to call SetKey at least once before you call Encrypt.
+//
+func (ac *aeadCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	return ac.encryptDI(plaintext, nil, io.ReadFull)
+} //                                                                     Encrypt
+
+// EncryptAAD encrypts plaintext like Encrypt, and binds the additional
+// authenticated data 'aad' to the ciphertext. Implements AADCipher.
+func (ac *aeadCipher) EncryptAAD(plaintext, aad []byte) ([]byte, error) {
+	return ac.encryptDI(plaintext, aad, io.ReadFull)
+} //                                                                  EncryptAAD
+
+// encryptDI is only used by Encrypt() and EncryptAAD() and provides
+// parameters for dependency injection, to enable mocking during testing.
+func (ac *aeadCipher) encryptDI(
+	plaintext []byte,
+	aad []byte,
+	ioReadFull func(io.Reader, []byte) (int, error),
+) (ciphertext []byte, err error) {
+	//
+	ac.mu.RLock()
+	cryptoKey, aead, random := ac.cryptoKey, ac.aead, ac.random
+	ac.mu.RUnlock()
+	err = ac.ValidateKey(cryptoKey)
+	if err != nil {
+		return nil, makeError(0xEA5B43, err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if random == nil {
+		random = rand.Reader
+	}
+	_, err = ioReadFull(random, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+} //                                                                   encryptDI
+
+// Decrypt decrypts ciphertext using the encryption key given to SetKey and
+// returns the decrypted plaintext, using the AEAD algorithm.
+//
+// You need to call SetKey at least once before you call Decrypt.
+//
+func (ac *aeadCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	return ac.decrypt(nil, ciphertext, nil)
+} //                                                                     Decrypt
+
+// DecryptAAD decrypts ciphertext like Decrypt, and fails unless the
+// ciphertext was bound to 'aad' when encrypted. Implements AADCipher.
+func (ac *aeadCipher) DecryptAAD(ciphertext, aad []byte) ([]byte, error) {
+	return ac.decrypt(nil, ciphertext, aad)
+} //                                                                  DecryptAAD
+
+// decrypt decrypts ciphertext, checking additional authenticated data
+// 'aad'. The plaintext is written to the memory of 'dst', if large enough.
+func (ac *aeadCipher) decrypt(dst, ciphertext, aad []byte,
+) (plaintext []byte, err error) {
+	ac.mu.RLock()
+	cryptoKey, aead := ac.cryptoKey, ac.aead
+	ac.mu.RUnlock()
+	err = ac.ValidateKey(cryptoKey)
+	if err != nil {
+		return nil, makeError(0xE5A476, err)
+	}
+	n := aead.NonceSize()
+	if len(ciphertext) < n+aead.Overhead() {
+		return nil, makeError(0xEC59EF, "invalid ciphertext")
+	}
+	return aead.Open(dst[:0], ciphertext[:n], ciphertext[n:], aad)
+} //                                                                     decrypt
+
+// setStrict turns strict mode on or off and implements strictCipher.
+// Senders call it on every Send, so it only writes when the mode changes.
+func (ac *aeadCipher) setStrict(strict bool) error {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.strict != strict {
+		ac.strict = strict
+	}
+	if strict && ac.aead != nil {
+		return checkAEADParams(ac.aead)
+	}
+	return nil
+} //                                                                   setStrict
+
+// setRandom sets the source of nonces and implements randomCipher.
+// Senders call it on every Send, so it only writes when 'r' changes.
+func (ac *aeadCipher) setRandom(r io.Reader) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if !sameRandom(ac.random, r) {
+		ac.random = r
+	}
+} //                                                                   setRandom
+
+// end
@@ -0,0 +1,85 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[aead_cipher_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+// newTestAEADCipher returns an aeadCipher that uses AES-256-GCM,
+// standing in for the algorithms added by other modules.
+func newTestAEADCipher() SymmetricCipher {
+	return NewAEADCipher("AES-256-GCM", func(key []byte) (cipher.AEAD, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	})
+}
+
+// (ac *aeadCipher) Encrypt(plaintext []byte) ([]byte, error)
+// (ac *aeadCipher) Decrypt(ciphertext []byte) ([]byte, error)
+//
+// go test -run Test_aeadCipher_
+//
+func Test_aeadCipher_(t *testing.T) {
+	cphr := newTestAEADCipher()
+	if err := cphr.SetKey([]byte("short")); !matchError(err,
+		"AES-256-GCM key must be 32 bytes long") {
+		t.Error("0xEDB292", "wrong error:", err)
+	}
+	if _, err := cphr.Encrypt([]byte("abc")); err == nil {
+		t.Error("0xEE2F33", "must fail before SetKey")
+	}
+	if err := cphr.SetKey([]byte(testAESKey)); err != nil {
+		t.Fatal("0xE4E60C", err)
+	}
+	if err := cipherSelfTest(cphr); err != nil {
+		t.Error("0xE4EE4F", err)
+	}
+	ac := cphr.(AADCipher)
+	ciphertext, _ := ac.EncryptAAD([]byte("abc"), []byte("aad"))
+	if _, err := ac.DecryptAAD(ciphertext, []byte("other")); err == nil {
+		t.Error("0xE1558B", "must reject other AAD")
+	}
+	plaintext, err := ac.DecryptAAD(ciphertext, []byte("aad"))
+	if err != nil || string(plaintext) != "abc" {
+		t.Error("0xEC97BA", err, string(plaintext))
+	}
+}
+
+// (ac *aeadCipher) setRandom(r io.Reader)
+//
+// go test -run Test_aeadCipher_setRandom_
+//
+func Test_aeadCipher_setRandom_(t *testing.T) {
+	cf := NewDefaultConfig()
+	cf.Cipher = newTestAEADCipher()
+	cf.Random = bytes.NewReader(make([]byte, 24))
+	_ = cf.Cipher.SetKey([]byte(testAESKey))
+	if err := applyRandomSource(cf); err != nil {
+		t.Error("0xE4E4B5", err)
+	}
+	ciphertext, err := cf.Cipher.Encrypt([]byte("abc"))
+	if err != nil || !bytes.HasPrefix(ciphertext, make([]byte, 12)) {
+		t.Error("0xE3D6C5", err, ciphertext)
+	}
+	// the self-tests must not draw from Random
+	cf.StrictCrypto = true
+	if err := checkStrictCrypto(cf, &cryptoSelfTest{}); err != nil {
+		t.Error("0xEC7AFD", err)
+	}
+	ciphertext, err = cf.Cipher.Encrypt([]byte("abc"))
+	if err != nil || !bytes.HasPrefix(ciphertext, make([]byte, 12)) {
+		t.Error("0xE9F4C7", err, ciphertext)
+	}
+}
+
+// end
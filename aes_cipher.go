@@ -11,13 +11,21 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"io"
+	"sync"
 )
 
 // aesCipher implements the SymmetricCipher interface that encrypts and
 // decrypts plaintext using the AES-256 symmetric cipher algorithm.
+//
+// Senders and Receivers that share a Configuration use its cipher at the
+// same time, so the fields are protected by 'mu'.
+//
 type aesCipher struct {
+	mu        sync.RWMutex
 	cryptoKey []byte
 	gcm       cipher.AEAD
+	strict    bool      // see Configuration.StrictCrypto
+	random    io.Reader // see Configuration.Random; nil for crypto/rand
 } //                                                                   aesCipher
 
 // ValidateKey checks if an encryption key is suitable for use with the cipher.
@@ -37,6 +45,9 @@ func (ac *aesCipher) ValidateKey(cryptoKey []byte) error {
 // If the cipher is already initialized with the given key, does nothing.
 // The same key is used for encryption and decryption.
 //
+// The cipher keeps its own copy of the key, so the caller
+// can reuse or zero 'cryptoKey' after SetKey returns.
+//
 func (ac *aesCipher) SetKey(cryptoKey []byte) error {
 	return ac.setKeyDI(cryptoKey, aes.NewCipher, cipher.NewGCM)
 } //                                                                      SetKey
@@ -52,7 +63,10 @@ func (ac *aesCipher) setKeyDI(
 	if err != nil {
 		return makeError(0xE32BD3, err)
 	}
-	if bytes.Equal(ac.cryptoKey, cryptoKey) {
+	ac.mu.RLock()
+	same := bytes.Equal(ac.cryptoKey, cryptoKey)
+	ac.mu.RUnlock()
+	if same {
 		return nil
 	}
 	cphr, err := aesNewCipher(cryptoKey)
@@ -63,8 +77,16 @@ func (ac *aesCipher) setKeyDI(
 	if err != nil {
 		return err
 	}
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.strict {
+		err = checkAEADParams(gcm)
+		if err != nil {
+			return err
+		}
+	}
 	ac.gcm = gcm
-	ac.cryptoKey = cryptoKey
+	ac.cryptoKey = append([]byte(nil), cryptoKey...)
 	return nil
 } //                                                                    setKeyDI
 
@@ -74,32 +96,45 @@ func (ac *aesCipher) setKeyDI(
 // You need to call SetKey at least once before you call Encrypt.
 //
 func (ac *aesCipher) Encrypt(plaintext []byte) (ciphertext []byte, err error) {
-	return ac.encryptDI(plaintext, io.ReadFull)
+	return ac.encryptDI(plaintext, nil, io.ReadFull)
 } //                                                                     Encrypt
 
-// encryptDI is only used by Encrypt() and provides parameters
-// for dependency injection, to enable mocking during testing.
+// EncryptAAD encrypts plaintext like Encrypt, and binds the additional
+// authenticated data 'aad' to the ciphertext. Implements AADCipher.
+func (ac *aesCipher) EncryptAAD(plaintext, aad []byte) ([]byte, error) {
+	return ac.encryptDI(plaintext, aad, io.ReadFull)
+} //                                                                  EncryptAAD
+
+// encryptDI is only used by Encrypt() and EncryptAAD() and provides
+// parameters for dependency injection, to enable mocking during testing.
 func (ac *aesCipher) encryptDI(
 	plaintext []byte,
+	aad []byte,
 	ioReadFull func(io.Reader, []byte) (int, error),
 ) (ciphertext []byte, err error) {
 	//
-	err = ac.ValidateKey(ac.cryptoKey)
+	ac.mu.RLock()
+	cryptoKey, gcm, random := ac.cryptoKey, ac.gcm, ac.random
+	ac.mu.RUnlock()
+	err = ac.ValidateKey(cryptoKey)
 	if err != nil {
 		return nil, makeError(0xE64A2E, err)
 	}
 	// nonce is a byte array filled with cryptographically secure random bytes
-	n := ac.gcm.NonceSize() // = gcmStandardNonceSize = 12 bytes
+	n := gcm.NonceSize() // = gcmStandardNonceSize = 12 bytes
 	nonce := make([]byte, n)
-	_, err = ioReadFull(rand.Reader, nonce)
+	if random == nil {
+		random = rand.Reader
+	}
+	_, err = ioReadFull(random, nonce)
 	if err != nil {
 		return nil, err
 	}
-	ciphertext = ac.gcm.Seal(
+	ciphertext = gcm.Seal(
 		nonce,     // dst
 		nonce,     // nonce
 		plaintext, // plaintext
-		nil,       // additionalData
+		aad,       // additionalData
 	)
 	return ciphertext, nil
 } //                                                                   encryptDI
@@ -110,26 +145,69 @@ func (ac *aesCipher) encryptDI(
 // You need to call SetKey at least once before you call Decrypt.
 //
 func (ac *aesCipher) Decrypt(ciphertext []byte) (plaintext []byte, err error) {
-	err = ac.ValidateKey(ac.cryptoKey)
+	return ac.decrypt(nil, ciphertext, nil)
+} //                                                                     Decrypt
+
+// DecryptAAD decrypts ciphertext like Decrypt, and fails unless the
+// ciphertext was bound to 'aad' when encrypted. Implements AADCipher.
+func (ac *aesCipher) DecryptAAD(ciphertext, aad []byte) ([]byte, error) {
+	return ac.decrypt(nil, ciphertext, aad)
+} //                                                                  DecryptAAD
+
+// decrypt decrypts ciphertext, checking additional authenticated data
+// 'aad'. The plaintext is written to the memory of 'dst', if large enough.
+func (ac *aesCipher) decrypt(dst, ciphertext, aad []byte,
+) (plaintext []byte, err error) {
+	ac.mu.RLock()
+	cryptoKey, gcm, strict := ac.cryptoKey, ac.gcm, ac.strict
+	ac.mu.RUnlock()
+	err = ac.ValidateKey(cryptoKey)
 	if err != nil {
 		return nil, makeError(0xE35A87, err)
 	}
-	n := ac.gcm.NonceSize()
+	n := gcm.NonceSize()
 	if len(ciphertext) < n {
 		return nil, makeError(0xE5F7E2, "invalid ciphertext")
 	}
+	if strict && len(ciphertext) < n+gcm.Overhead() {
+		return nil, makeError(0xEF73F8, "truncated ciphertext")
+	}
 	nonce := ciphertext[:n]
 	ciphertext = ciphertext[n:]
-	plaintext, err = ac.gcm.Open(
-		nil,        // dst
+	plaintext, err = gcm.Open(
+		dst[:0],    // dst
 		nonce,      // nonce
 		ciphertext, // ciphertext
-		nil,        // additionalData
+		aad,        // additionalData
 	)
 	if err != nil {
 		return nil, err
 	}
 	return plaintext, nil
-} //                                                                     Decrypt
+} //                                                                     decrypt
+
+// setStrict turns strict mode on or off and implements strictCipher.
+// Senders call it on every Send, so it only writes when the mode changes.
+func (ac *aesCipher) setStrict(strict bool) error {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.strict != strict {
+		ac.strict = strict
+	}
+	if strict && ac.gcm != nil {
+		return checkAEADParams(ac.gcm)
+	}
+	return nil
+} //                                                                   setStrict
+
+// setRandom sets the source of nonces and implements randomCipher.
+// Senders call it on every Send, so it only writes when 'r' changes.
+func (ac *aesCipher) setRandom(r io.Reader) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if !sameRandom(ac.random, r) {
+		ac.random = r
+	}
+} //                                                                   setRandom
 
 // end
@@ -6,9 +6,11 @@
 package udpt
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"io"
+	"sync"
 	"testing"
 )
 
@@ -103,6 +105,57 @@ func Test_aesCipher_SetKey_(t *testing.T) {
 	}
 }
 
+// SetKey must keep its own copy of the key, so that the
+// cipher keeps working when the caller zeroes its buffer
+//
+// go test -run Test_aesCipher_SetKey_copy_
+//
+func Test_aesCipher_SetKey_copy_(t *testing.T) {
+	var cphr aesCipher
+	key := []byte("BE30FB257682466ABA9071755E780344")
+	err := cphr.SetKey(key)
+	if err != nil {
+		t.Error("0xE9674E", err)
+	}
+	ciphertext, _ := cphr.Encrypt([]byte("abc"))
+	for i := range key {
+		key[i] = 0
+	}
+	if string(cphr.cryptoKey) != "BE30FB257682466ABA9071755E780344" {
+		t.Error("0xE694DD")
+	}
+	plaintext, err := cphr.Decrypt(ciphertext)
+	if string(plaintext) != "abc" || err != nil {
+		t.Error("0xE8C45A", err)
+	}
+}
+
+// SetKey must be safe while others that share the cipher set the same
+// key and encrypt with it, e.g. the Senders of SendMany, which share
+// their Configuration (run with -race to check)
+//
+// go test -run Test_aesCipher_SetKey_concurrent_
+//
+func Test_aesCipher_SetKey_concurrent_(t *testing.T) {
+	var cphr aesCipher
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := cphr.SetKey([]byte(testAESKey)); err != nil {
+					t.Error("0xE8D2C7", err)
+				}
+				if _, err := cphr.Encrypt([]byte("abc")); err != nil {
+					t.Error("0xE3F6B1", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 // (ac *aesCipher) Encrypt(plaintext []byte) (ciphertext []byte, err error)
 //
@@ -146,7 +199,7 @@ func Test_aesCipher_Encrypt_3(t *testing.T) {
 	ioReadFull := func(io.Reader, []byte) (int, error) {
 		return 0, makeError(0xED5D20, "failed ioReadFull")
 	}
-	ciphertext, err := cphr.encryptDI([]byte("abc"), ioReadFull)
+	ciphertext, err := cphr.encryptDI([]byte("abc"), nil, ioReadFull)
 	if ciphertext != nil {
 		t.Error("0xE8D36B")
 	}
@@ -225,6 +278,35 @@ func Test_aesCipher_Decrypt_5(t *testing.T) {
 	}
 }
 
+// (ac *aesCipher) setRandom(r io.Reader)
+//
+// go test -run Test_aesCipher_setRandom_
+//
+func Test_aesCipher_setRandom_(t *testing.T) {
+	var ciphertexts [2][]byte
+	for i := range ciphertexts {
+		cphr := newTestAESCipher(t)
+		cphr.setRandom(bytes.NewReader(make([]byte, 12)))
+		ciphertext, err := cphr.Encrypt([]byte("abc"))
+		if err != nil {
+			t.Error("0xEB7768", err)
+		}
+		ciphertexts[i] = ciphertext
+	}
+	// must use the given source, so that the ciphertext is reproducible
+	want := make([]byte, 12) // the nonce
+	if !bytes.HasPrefix(ciphertexts[0], want) ||
+		!bytes.Equal(ciphertexts[0], ciphertexts[1]) {
+		t.Error("0xE807D0", ciphertexts)
+	}
+	// must fail when the source runs out
+	cphr := newTestAESCipher(t)
+	cphr.setRandom(bytes.NewReader(nil))
+	if _, err := cphr.Encrypt([]byte("abc")); err == nil {
+		t.Error("0xE758C6")
+	}
+}
+
 // -----------------------------------------------------------------------------
 
 // newTestAESCipher creates an AES cipher for testing (uses testAESKey)
@@ -0,0 +1,49 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                        /[archive.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+)
+
+// UnpackArchived uncompresses 'comp', the value of a data item passed
+// to Receiver.Archive, with 'compressor', which must be the Compressor
+// of the Sender's Configuration, or the default one if nil. It then
+// checks that the value matches 'hash', i.e. ItemInfo.Hash, which
+// Receiver.Archive couldn't check without uncompressing it. The hash
+// must be a SHA-256 hash: use UnpackArchivedWith() for other Hashers.
+func UnpackArchived(comp, hash []byte, compressor Compression,
+) ([]byte, error) {
+	return UnpackArchivedWith(comp, hash, compressor, nil)
+} //                                                              UnpackArchived
+
+// UnpackArchivedWith is like UnpackArchived(), but checks 'hash' with
+// 'hasher', which must be the Hasher of the Sender's Configuration,
+// or SHA-256 if nil.
+func UnpackArchivedWith(comp, hash []byte, compressor Compression,
+	hasher Hasher,
+) ([]byte, error) {
+	if compressor == nil {
+		compressor = &zlibCompressor{}
+	}
+	ret, err := compressor.Uncompress(comp)
+	if err != nil {
+		return nil, makeError(0xE2E9C5, err)
+	}
+	if !bytes.Equal(hashWith(hasher, ret), hash) {
+		return nil, makeError(0xE7B0A3, "hash mismatch")
+	}
+	return ret, nil
+} //                                                          UnpackArchivedWith
+
+// streaming returns true if the Receiver writes data items to the
+// writers returned by ReceiveStream, which it doesn't if Archive
+// is specified.
+func (rc *Receiver) streaming() bool {
+	return rc.ReceiveStream != nil && rc.Archive == nil
+} //                                                                   streaming
+
+// end
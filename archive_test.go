@@ -0,0 +1,93 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[archive_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_archive_*
+
+// -----------------------------------------------------------------------------
+
+// go test -run Test_archive_Receiver_
+//
+// must pass the compressed value to Receiver.Archive instead of
+// calling Receive, so that UnpackArchived() restores the value
+func Test_archive_Receiver_(t *testing.T) {
+	v := []byte(strings.Repeat("archived value ", 200))
+	sd := makeTestSender()
+	sd.Config.HashCompressed = true
+	comp, err := sd.Config.Compressor.Compress(v)
+	if err != nil {
+		t.Fatal("0xE1D7A3", err)
+	}
+	sd.key, sd.comp, sd.dataHash = "key", comp, getHash(v)
+	if err := sd.splitPackets(sd.key, sd.comp, 100); err != nil {
+		t.Fatal("0xE8E4B0", err)
+	}
+	var got []byte
+	var info *ItemInfo
+	rc := newRunnableReceiver()
+	rc.Receive = func(k string, v []byte) error {
+		return errors.New("Receive called")
+	}
+	rc.Archive = func(i *ItemInfo, comp []byte) error {
+		info, got = i, comp
+		return nil
+	}
+	for i := len(sd.packets) - 1; i >= 0; i-- {
+		if _, err := rc.receiveFragment(sd.packets[i].data); err != nil {
+			t.Fatal("0xE5A9C6", i, err)
+		}
+	}
+	if !bytes.Equal(got, comp) || info == nil || info.Key != "key" ||
+		info.Pieces != len(sd.packets) ||
+		info.CompressedSize != int64(len(comp)) {
+		t.Fatal("0xE3C2F1", len(got), info)
+	}
+	value, err := UnpackArchived(got, info.Hash, nil)
+	if err != nil || !bytes.Equal(value, v) {
+		t.Error("0xE9F6D4", err)
+	}
+	_, err = UnpackArchived(got, getHash([]byte("other")), nil)
+	if !matchError(err, "hash mismatch") {
+		t.Error("0xE0B8E2", "wrong error:", err)
+	}
+}
+
+// go test -run Test_archive_receiveLocal_
+//
+// must compress items delivered in the same process for Archive,
+// which takes the place of Receive and ReceiveStream
+func Test_archive_receiveLocal_(t *testing.T) {
+	var got []byte
+	var info *ItemInfo
+	sd := makeTestSender()
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Archive: func(i *ItemInfo, comp []byte) error {
+			info, got = i, comp
+			return nil
+		},
+	}
+	if err := sd.Send("key", []byte("value")); err != nil {
+		t.Fatal("0xE6A3B7", err)
+	}
+	if info == nil {
+		t.Fatal("0xE2C8D0", "Archive not called")
+	}
+	value, err := UnpackArchived(got, info.Hash, nil)
+	if err != nil || string(value) != "value" {
+		t.Error("0xE4D5A9", string(value), err)
+	}
+}
+
+// end
@@ -0,0 +1,178 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                           /[auth.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// senderIDField and authField begin each fragment header, right after
+// tagFragment, when the Sender has an AuthToken: "sid:ID auth:MAC ".
+// The MAC is an HMAC-SHA256, keyed with the token, of the Sender's ID
+// and the rest of the header, truncated to authMACSize bytes.
+const (
+	senderIDField = "sid:"
+	authField     = "auth:"
+)
+
+// authMACSize is the number of bytes of the HMAC kept in a header.
+const authMACSize = 16
+
+// maxSenderIDLength is the maximum length of Sender.SenderID.
+const maxSenderIDLength = 64
+
+// validateSenderID returns an error if 'id' isn't a valid Sender.SenderID:
+// 1 to maxSenderIDLength letters, digits, or any of "-._@".
+func validateSenderID(id string) error {
+	if id == "" || len(id) > maxSenderIDLength {
+		return makeError(0xE6B4C1, "sender ID must have 1 to",
+			maxSenderIDLength, "characters")
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9', r == '-', r == '.', r == '_', r == '@':
+		default:
+			return makeError(0xE3D8A7, "invalid character in sender ID:",
+				fmt.Sprintf("%q", r))
+		}
+	}
+	return nil
+} //                                                            validateSenderID
+
+// authMAC returns the MAC of fragment header 'header' (after tagFragment
+// and the sender ID and MAC fields) sent by the Sender with ID 'id'.
+func authMAC(token []byte, id string, header []byte) []byte {
+	mac := hmac.New(sha256.New, token)
+	mac.Write([]byte(id))
+	mac.Write([]byte{'\n'})
+	mac.Write(header)
+	return mac.Sum(nil)[:authMACSize]
+} //                                                                     authMAC
+
+// authFieldsSize returns the number of bytes the sender ID
+// and MAC fields add to each fragment header.
+func (sd *Sender) authFieldsSize() int {
+	if len(sd.AuthToken) == 0 {
+		return 0
+	}
+	return len(senderIDField+" "+authField+" ") + len(sd.SenderID) +
+		2*authMACSize
+} //                                                              authFieldsSize
+
+// validateAuth returns an error if only one of SenderID and
+// AuthToken is specified, or if SenderID is invalid.
+func (sd *Sender) validateAuth() error {
+	if sd.SenderID == "" && len(sd.AuthToken) == 0 {
+		return nil
+	}
+	if len(sd.AuthToken) == 0 {
+		return makeError(0xE9A0D3, "Sender.SenderID without AuthToken")
+	}
+	err := validateSenderID(sd.SenderID)
+	if err != nil {
+		return makeError(0xE2F7B8, "invalid Sender.SenderID:", err)
+	}
+	return nil
+} //                                                                validateAuth
+
+// signFragment returns fragment packet 'data' with the sender ID and MAC
+// fields at the start of its header, replacing any that it already has
+// (e.g. when a piece is split into sub-pieces). Returns 'data' as it is
+// if the Sender has no AuthToken.
+func (sd *Sender) signFragment(data []byte) []byte {
+	if len(sd.AuthToken) == 0 {
+		return data
+	}
+	_, _, rest := splitAuthFields(data)
+	end := bytes.IndexByte(rest, '\n')
+	if end == -1 {
+		return data // makePacket() only gets fragments with headers
+	}
+	mac := authMAC(sd.AuthToken, sd.SenderID, rest[:end+1])
+	ret := make([]byte, 0, len(data)+sd.authFieldsSize())
+	ret = append(ret, tagFragment+senderIDField+sd.SenderID+" "+authField...)
+	ret = append(ret, hex.EncodeToString(mac)+" "...)
+	return append(ret, rest...)
+} //                                                                signFragment
+
+// splitAuthFields splits fragment packet 'recv' into the sender ID and
+// hexadecimal MAC at the start of its header, if any, and the rest of
+// the packet after them.
+func splitAuthFields(recv []byte) (id, mac string, rest []byte) {
+	rest = bytes.TrimPrefix(recv, []byte(tagFragment))
+	if !bytes.HasPrefix(rest, []byte(senderIDField)) {
+		return "", "", rest
+	}
+	fields := bytes.SplitN(rest, []byte(" "), 3)
+	if len(fields) != 3 || !bytes.HasPrefix(fields[1], []byte(authField)) {
+		return "", "", rest
+	}
+	id = string(fields[0][len(senderIDField):])
+	mac = string(fields[1][len(authField):])
+	return id, mac, fields[2]
+} //                                                             splitAuthFields
+
+// authorize checks that fragment packet 'recv' was sent by a Sender
+// listed in Receiver.AuthTokens, and returns the Sender's ID. It
+// returns a blank ID and no error if AuthTokens is empty.
+func (rc *Receiver) authorize(recv []byte) (string, error) {
+	if len(rc.AuthTokens) == 0 {
+		return "", nil
+	}
+	id, mac, rest := splitAuthFields(recv)
+	if id == "" {
+		return "", makeError(0xE5C9E0, "fragment without sender ID")
+	}
+	token, ok := rc.AuthTokens[id]
+	if !ok {
+		return "", makeError(0xE8E1F5, "unknown sender ID:", id)
+	}
+	end := bytes.IndexByte(rest, '\n')
+	got, err := hex.DecodeString(mac)
+	if end == -1 || err != nil ||
+		!hmac.Equal(got, authMAC(token, id, rest[:end+1])) {
+		return "", makeError(0xE1B2D4, "bad authentication of sender", id)
+	}
+	return id, nil
+} //                                                                   authorize
+
+// authorizeLocal checks that a Sender in this process with ID 'id' and
+// token 'token' is listed in Receiver.AuthTokens, like authorize().
+func (rc *Receiver) authorizeLocal(id string, token []byte) error {
+	if len(rc.AuthTokens) == 0 {
+		return nil
+	}
+	want, ok := rc.AuthTokens[id]
+	if !ok || id == "" {
+		return makeError(0xE7F5A2, "unknown sender ID:", id)
+	}
+	if !hmac.Equal(want, token) {
+		return makeError(0xE4A6C8, "bad authentication of sender", id)
+	}
+	return nil
+} //                                                              authorizeLocal
+
+// validateAuthTokens returns an error if Receiver.AuthTokens
+// has an invalid sender ID or an empty token.
+func (rc *Receiver) validateAuthTokens() error {
+	for id, token := range rc.AuthTokens {
+		err := validateSenderID(id)
+		if err != nil {
+			return err
+		}
+		if len(token) == 0 {
+			return makeError(0xE0D3B6, "empty token for sender", id)
+		}
+	}
+	return nil
+} //                                                          validateAuthTokens
+
+// end
@@ -0,0 +1,184 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[auth_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_auth_*
+
+// -----------------------------------------------------------------------------
+
+// (rc *Receiver) authorize(recv []byte) (string, error)
+//
+// go test -run Test_auth_authorize_
+//
+// must accept fragments signed with the Sender's token, also when
+// they are resent in sub-pieces, and reject all others
+func Test_auth_authorize_(t *testing.T) {
+	sd := makeTestSender()
+	sd.SenderID, sd.AuthToken = "alpha", []byte("alpha-token")
+	sd.key, sd.comp = "key", []byte(strings.Repeat("x", 1000))
+	sd.dataHash = getHash([]byte("value"))
+	if err := sd.splitPackets(sd.key, sd.comp, 400); err != nil {
+		t.Fatal("0xE2B6D0", err)
+	}
+	rc := newRunnableReceiver()
+	rc.AuthTokens = map[string][]byte{"alpha": []byte("alpha-token")}
+	pk := &sd.packets[0]
+	if id, err := rc.authorize(pk.data); err != nil || id != "alpha" {
+		t.Error("0xE7C3A1", id, err)
+	}
+	if _, err := rc.readFragmentHeader(pk.data); err != nil {
+		t.Error("0xE4F8B5", err)
+	}
+	sd.Config.SubPieceSize = 150
+	if err := sd.splitSubPackets(pk); err != nil || len(pk.subPackets) != 3 {
+		t.Fatal("0xE9D1C6", err)
+	}
+	for i, sub := range pk.subPackets {
+		if bytes.Count(sub.data, []byte(senderIDField)) != 1 {
+			t.Error("0xE1A5E8", i, "sender ID not replaced")
+		}
+		if id, err := rc.authorize(sub.data); err != nil || id != "alpha" {
+			t.Error("0xE6B0D2", i, id, err)
+		}
+	}
+	test := func(recv []byte, errSubstr string) {
+		t.Helper()
+		if _, err := rc.authorize(recv); !matchError(err, errSubstr) {
+			t.Error("0xE3E7F4", "wrong error:", err)
+		}
+	}
+	// an altered header, a wrong token, an unknown or missing sender
+	test(bytes.Replace(pk.data, []byte("sn:1 "), []byte("sn:2 "), 1),
+		"bad authentication of sender alpha")
+	sd.AuthToken = []byte("guessed")
+	test(sd.signFragment(pk.data), "bad authentication of sender alpha")
+	sd.SenderID = "beta"
+	test(sd.signFragment(pk.data), "unknown sender ID: beta")
+	sd.AuthToken = nil
+	_, _, rest := splitAuthFields(pk.data)
+	test(append([]byte(tagFragment), rest...), "fragment without sender ID")
+	//
+	// Receivers without AuthTokens accept any Sender, but don't report it
+	rc.AuthTokens = nil
+	if id, err := rc.authorize(pk.data); err != nil || id != "" {
+		t.Error("0xE8A4C9", id, err)
+	}
+}
+
+// go test -run Test_auth_Receiver_
+//
+// must report the Sender of each item, and reject a Sender
+// that knows the encryption key but has no token
+func Test_auth_Receiver_(t *testing.T) {
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	senders := make(chan string, 2)
+	unauthorized := make(chan struct{}, 100)
+	rc := Receiver{
+		Port: 9899, CryptoKey: []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0"),
+		AuthTokens: map[string][]byte{"alpha": []byte("alpha-token")},
+		Config:     cf,
+		Handler: HandlerFunc(func(info *ItemInfo, v []byte) error {
+			senders <- info.SenderID
+			return nil
+		}),
+		OnEvent: func(ev *Event) {
+			if ev.Kind == Unauthorized {
+				unauthorized <- struct{}{}
+			}
+		},
+	}
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	newSender := func(id string, token []byte) *Sender {
+		scf := NewDefaultConfig()
+		scf.LogWriter = nil
+		scf.ReplyTimeout = 300 * time.Millisecond
+		scf.SendRetries = 1
+		return &Sender{Address: "127.0.0.1:9899", CryptoKey: rc.CryptoKey,
+			SenderID: id, AuthToken: token, Config: scf}
+	}
+	err := newSender("alpha", []byte("alpha-token")).Send("k", []byte("v"))
+	if err != nil {
+		t.Fatal("0xE5D2A7", err)
+	}
+	select {
+	case id := <-senders:
+		if id != "alpha" {
+			t.Error("0xE0C8B3", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("0xE2E6F1", "not received")
+	}
+	err = newSender("", nil).Send("k2", []byte("v2"))
+	if err == nil {
+		t.Error("0xE7B4D5", "unauthorized Sender delivered an item")
+	}
+	select {
+	case <-unauthorized:
+	default:
+		t.Error("0xE4A0C2", "no Unauthorized event")
+	}
+	if err := newSender("", []byte("t")).Send("k", nil); !matchError(err,
+		"invalid Sender.SenderID") {
+		t.Error("0xE9F3E6", "wrong error:", err)
+	}
+}
+
+// go test -run Test_auth_sendLocal_
+//
+// must check the Sender's token when delivering within the process
+func Test_auth_sendLocal_(t *testing.T) {
+	var got string
+	sd := makeTestSender()
+	sd.LocalReceiver = &Receiver{
+		CryptoKey:  sd.CryptoKey,
+		AuthTokens: map[string][]byte{"alpha": []byte("alpha-token")},
+		Handler: HandlerFunc(func(info *ItemInfo, v []byte) error {
+			got = info.SenderID
+			return nil
+		}),
+	}
+	if err := sd.Send("k", []byte("v")); !matchError(err,
+		"unknown sender ID") {
+		t.Error("0xE6C1A4", "wrong error:", err)
+	}
+	sd.SenderID, sd.AuthToken = "alpha", []byte("alpha-token")
+	if err := sd.Send("k", []byte("v")); err != nil || got != "alpha" {
+		t.Error("0xE3D9B8", got, err)
+	}
+}
+
+// validateSenderID(id string) error
+//
+// go test -run Test_auth_validateSenderID_
+//
+func Test_auth_validateSenderID_(t *testing.T) {
+	for _, id := range []string{"a", "node-1.eu_west@prod",
+		strings.Repeat("x", 64)} {
+		if err := validateSenderID(id); err != nil {
+			t.Error("0xE1F7C0", id, err)
+		}
+	}
+	for _, id := range []string{"", "a b", "key:x", "a\n",
+		strings.Repeat("x", 65)} {
+		if err := validateSenderID(id); err == nil {
+			t.Error("0xE8B2A9", "no error for:", id)
+		}
+	}
+}
+
+// end
@@ -0,0 +1,79 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                           /[bind.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// PortRange is a range of UDP port numbers, from First to Last
+// inclusive. The zero value is an empty range.
+type PortRange struct {
+	First int
+	Last  int
+} //                                                                   PortRange
+
+// isEmpty returns true if the range contains no ports.
+func (pr PortRange) isEmpty() bool {
+	return pr.First < 1 || pr.Last < pr.First
+} //                                                                     isEmpty
+
+// validate returns an error if the range is
+// not empty and has invalid port numbers.
+func (pr PortRange) validate() error {
+	if pr == (PortRange{}) {
+		return nil
+	}
+	if pr.First < 1 || pr.Last > 65535 || pr.Last < pr.First {
+		return makeError(0xE4A7C3, "invalid port range:", pr.First, "-", pr.Last)
+	}
+	return nil
+} //                                                                    validate
+
+// isAddrInUse returns true if 'err' was caused by
+// binding a port that another socket is using.
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+} //                                                                 isAddrInUse
+
+// bindPort calls 'bind' to bind local port 'port'. While the port is in
+// use, e.g. by a process that is still shutting down, it retries up to
+// Config.BindRetries times, doubling Config.BindRetryInterval between
+// tries, then tries each port in Config.AltPorts. Returns the port
+// bound, or an error that isn't about a port in use, or, when all the
+// ports are in use, an error wrapping that of 'port'.
+func bindPort(cf *Configuration, port int, bind func(port int) error,
+) (int, error) {
+	err := bind(port)
+	delay := cf.BindRetryInterval
+	for i := 0; i < cf.BindRetries && isAddrInUse(err); i++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = bind(port)
+	}
+	if !isAddrInUse(err) {
+		return port, err
+	}
+	if !cf.AltPorts.isEmpty() {
+		for alt := cf.AltPorts.First; alt <= cf.AltPorts.Last; alt++ {
+			if alt == port {
+				continue
+			}
+			altErr := bind(alt)
+			if !isAddrInUse(altErr) {
+				return alt, altErr
+			}
+		}
+		return port, makeError(0xE9B2D6, "port", port, "and alternate ports",
+			cf.AltPorts.First, "-", cf.AltPorts.Last, "are in use:", err)
+	}
+	return port, makeError(0xE1E8A4, "port", port, "is in use after",
+		cf.BindRetries, "retries:", err)
+} //                                                                    bindPort
+
+// end
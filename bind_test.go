@@ -0,0 +1,104 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[bind_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_bind_*
+
+// -----------------------------------------------------------------------------
+
+// bindPort(cf *Configuration, port int, bind func(port int) error,
+// ) (int, error)
+//
+// go test -run Test_bind_bindPort_
+//
+// must retry a port in use, then try the alternate ports,
+// and return other errors at once
+func Test_bind_bindPort_(t *testing.T) {
+	busy := map[int]int{} // port: number of binds that fail
+	var tried []int
+	bind := func(port int) error {
+		tried = append(tried, port)
+		if busy[port] > 0 {
+			busy[port]--
+			return &net.OpError{Op: "listen", Net: "udp",
+				Err: syscall.EADDRINUSE}
+		}
+		if port == 13 {
+			return errors.New("permission denied")
+		}
+		return nil
+	}
+	cf := NewDefaultConfig()
+	cf.BindRetries = 2
+	cf.BindRetryInterval = 0
+	//
+	// the port becomes free on the last retry
+	busy[10] = 2
+	port, err := bindPort(cf, 10, bind)
+	if port != 10 || err != nil || len(tried) != 3 {
+		t.Error("0xE2B9C6", port, err, tried)
+	}
+	// the port stays in use, without alternate ports
+	tried, busy[10] = nil, 9
+	_, err = bindPort(cf, 10, bind)
+	if !isAddrInUse(err) || !matchError(err, "port 10 is in use after 2") {
+		t.Error("0xE8D1F4", "wrong error:", err)
+	}
+	// the first free alternate port is used
+	cf.AltPorts = PortRange{First: 10, Last: 12}
+	tried, busy[10], busy[11] = nil, 9, 1
+	port, err = bindPort(cf, 10, bind)
+	if port != 12 || err != nil || len(tried) != 5 {
+		t.Error("0xE5A6E1", port, err, tried)
+	}
+	// all the alternate ports are in use
+	tried, busy[10], busy[11], busy[12] = nil, 9, 1, 1
+	_, err = bindPort(cf, 10, bind)
+	if !isAddrInUse(err) || !matchError(err, "alternate ports 10 - 12") {
+		t.Error("0xE0F3B7", "wrong error:", err)
+	}
+	// other errors aren't retried
+	tried = nil
+	cf.AltPorts = PortRange{}
+	_, err = bindPort(cf, 13, bind)
+	if !matchError(err, "permission denied") || len(tried) != 1 {
+		t.Error("0xE6C8A2", err, tried)
+	}
+}
+
+// must make a Receiver listen on an alternate port
+// when its port is used by another socket
+func Test_bind_Receiver_(t *testing.T) {
+	other, err := net.ListenUDP("udp", &net.UDPAddr{Port: 9874})
+	if err != nil {
+		t.Skip("port 9874 unavailable:", err)
+	}
+	defer func() { _ = other.Close() }()
+	rc := newRunnableReceiver()
+	rc.Port = 9874
+	rc.Config.LogWriter = nil
+	rc.Config.BindRetries = 1
+	rc.Config.BindRetryInterval = 0
+	rc.Config.AltPorts = PortRange{First: 9873, Last: 9874}
+	err = rc.initRunDI(net.ResolveUDPAddr, net.ListenUDP)
+	if err != nil {
+		t.Fatal("0xE3E7D9", err)
+	}
+	defer func() { _ = rc.conn.Close() }()
+	if rc.Port != 9873 {
+		t.Error("0xE9B0C5", "port:", rc.Port)
+	}
+}
+
+// end
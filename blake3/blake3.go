@@ -0,0 +1,36 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /blake3/[blake3.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// Package blake3 provides a udpt Hasher that makes BLAKE3 hashes,
+// which are much faster to compute than SHA-256 hashes for large
+// values, especially on machines with AVX2 or AVX-512.
+//
+// Assign it to Configuration.Hasher on both the Sender and the
+// Receiver:
+//
+//	cf := udpt.NewDefaultConfig()
+//	cf.Hasher = blake3.Hasher{}
+//
+package blake3
+
+import (
+	"hash"
+
+	"github.com/balacode/udpt"
+	"github.com/zeebo/blake3"
+)
+
+// Hasher implements udpt.Hasher using BLAKE3 with 32-byte hashes.
+// It is safe for concurrent use.
+type Hasher struct{}
+
+var _ udpt.Hasher = Hasher{}
+
+// New implements udpt.Hasher.New() and returns a new BLAKE3 hash.Hash.
+func (Hasher) New() hash.Hash {
+	return blake3.New()
+} //                                                                         New
+
+// end
@@ -0,0 +1,41 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /blake3/[blake3_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package blake3
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/balacode/udpt"
+)
+
+// (Hasher) New() hash.Hash
+//
+// go test -run Test_Hasher_
+//
+func Test_Hasher_(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		want string
+	}{
+		{"", "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+		{"abc", "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+	} {
+		hs := Hasher{}.New()
+		_, _ = hs.Write([]byte(tc.data))
+		if got := fmt.Sprintf("%x", hs.Sum(nil)); got != tc.want {
+			t.Error("0xE4C9B2", tc.data, got)
+		}
+	}
+	// must be accepted as a Configuration.Hasher
+	cf := udpt.NewDefaultConfig()
+	cf.Hasher = Hasher{}
+	if err := cf.Validate(); err != nil {
+		t.Error("0xE8E5D1", err)
+	}
+}
+
+// end
@@ -0,0 +1,21 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /blake3/[go.mod]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// The BLAKE3 hasher is a separate module, so that udpt itself
+// keeps using only the standard library.
+module github.com/balacode/udpt/blake3
+
+go 1.21
+
+require (
+	github.com/balacode/udpt v0.0.0
+	github.com/zeebo/blake3 v0.2.4
+)
+
+require github.com/klauspost/cpuid/v2 v2.0.12 // indirect
+
+replace github.com/balacode/udpt => ../
+
+// end
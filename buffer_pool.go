@@ -0,0 +1,124 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[buffer_pool.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"sync"
+)
+
+// bufferPool recycles the buffers into which a Receiver's read loop
+// decrypts packets. The pieces of data items are stored in those buffers
+// without being copied (see storeFragment), and the buffers go back to
+// the pool when the item has been delivered or has expired, so a busy
+// Receiver doesn't allocate, and garbage-collect, a buffer per packet.
+type bufferPool struct {
+	size int // capacity of each buffer
+	pool sync.Pool
+} //                                                                  bufferPool
+
+// newBufferPool returns a bufferPool of buffers with capacity 'size'.
+func newBufferPool(size int) *bufferPool {
+	bp := &bufferPool{size: size}
+	bp.pool.New = func() interface{} {
+		buf := make([]byte, 0, size)
+		return &buf
+	}
+	return bp
+} //                                                               newBufferPool
+
+// get returns an empty buffer from the pool, or nil if 'bp' is nil.
+func (bp *bufferPool) get() *[]byte {
+	if bp == nil {
+		return nil
+	}
+	return bp.pool.Get().(*[]byte)
+} //                                                                         get
+
+// put returns buffer 'buf' to the pool. Nothing may use its memory after.
+func (bp *bufferPool) put(buf *[]byte) {
+	if bp == nil || buf == nil || cap(*buf) < bp.size {
+		return
+	}
+	*buf = (*buf)[:0]
+	bp.pool.Put(buf)
+} //                                                                         put
+
+// decryptTo decrypts 'ciphertext' with 'cphr' like cphr.Decrypt(), but
+// into the memory of 'dst', to avoid allocating it, if 'dst' is large
+// enough and 'cphr' is a built-in cipher, even one bound to an AAD or
+// in a keyRing. Other ciphers return plaintext in memory of their own.
+func decryptTo(cphr SymmetricCipher, dst, ciphertext []byte,
+) ([]byte, error) {
+	switch c := cphr.(type) {
+	case *aesCipher:
+		return c.decrypt(dst, ciphertext, nil)
+	case *aeadCipher:
+		return c.decrypt(dst, ciphertext, nil)
+	case *aadBoundCipher:
+		switch ac := c.AADCipher.(type) {
+		case *aesCipher:
+			return ac.decrypt(dst, ciphertext, c.aad)
+		case *aeadCipher:
+			return ac.decrypt(dst, ciphertext, c.aad)
+		}
+	case *keyRing:
+		var first error
+		for _, kc := range c.ciphers {
+			plaintext, err := decryptTo(kc, dst, ciphertext)
+			if err == nil {
+				c.last = kc
+				return plaintext, nil
+			}
+			if first == nil {
+				first = err
+			}
+		}
+		return nil, first
+	}
+	return cphr.Decrypt(ciphertext)
+} //                                                                   decryptTo
+
+// claimPacketBuffer makes data item 'it' the owner of the buffer of the
+// packet being handled by the read loop, if 'piece' is stored in that
+// buffer, so that the buffer is recycled only once the item is done
+// with it. Otherwise, the buffer is left to the garbage collector.
+func (rc *Receiver) claimPacketBuffer(it *receivingItem, piece []byte) {
+	buf := rc.packetBuf
+	if buf == nil {
+		return
+	}
+	rc.packetBuf = nil
+	mem := (*buf)[:cap(*buf)]
+	if len(piece) == 0 || cap(piece) > len(mem) ||
+		&piece[0] != &mem[len(mem)-cap(piece)] {
+		return
+	}
+	it.buffers = append(it.buffers, buf)
+} //                                                           claimPacketBuffer
+
+// recyclePacketBuffer returns the buffer of the packet being handled by
+// the read loop to the pool, once the packet's piece has been discarded.
+func (rc *Receiver) recyclePacketBuffer() {
+	rc.buffers.put(rc.packetBuf)
+	rc.packetBuf = nil
+} //                                                         recyclePacketBuffer
+
+// releasePacketBuffers returns the buffers that hold the
+// pieces of data item 'it' to the pool, and forgets the pieces.
+func (rc *Receiver) releasePacketBuffers(it *receivingItem) {
+	if len(it.buffers) == 0 {
+		return
+	}
+	it.CompressedPieces = nil
+	it.layouts = nil
+	it.kept, it.keptBytes = nil, 0
+	for _, buf := range it.buffers {
+		rc.buffers.put(buf)
+	}
+	it.buffers = nil
+} //                                                        releasePacketBuffers
+
+// end
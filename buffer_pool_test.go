@@ -0,0 +1,172 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[buffer_pool_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_bufferPool_*
+
+// -----------------------------------------------------------------------------
+
+// decryptTo(cphr SymmetricCipher, dst, ciphertext []byte) ([]byte, error)
+//
+// go test -run Test_bufferPool_decryptTo_
+//
+// must decrypt into 'dst' with the built-in ciphers,
+// also when bound to an AAD or in a keyRing
+func Test_bufferPool_decryptTo_(t *testing.T) {
+	key := []byte("0123456789abcdefghijklmnopqrst12")
+	aes := &aesCipher{}
+	_ = aes.SetKey(key)
+	aead := newTestAEADCipher()
+	_ = aead.SetKey(key)
+	bound, _ := bindAAD(aes, []byte("aad"))
+	other := &aesCipher{}
+	_ = other.SetKey([]byte("another-key-0123456789abcdefghij"))
+	ring := &keyRing{ciphers: []SymmetricCipher{other, aes}}
+	for i, cphr := range []SymmetricCipher{aes, aead, bound, ring} {
+		ciphertext, _ := cphr.Encrypt([]byte("plaintext"))
+		dst := make([]byte, 0, 64)
+		got, err := decryptTo(cphr, dst, ciphertext)
+		if err != nil || string(got) != "plaintext" {
+			t.Error("0xE3D6A1", i, err, string(got))
+			continue
+		}
+		if &got[0] != &dst[:1][0] {
+			t.Error("0xE8B2C4", i, "not decrypted into 'dst'")
+		}
+	}
+	// a keyRing must remember which cipher decrypted the packet
+	ciphertext, _ := aes.Encrypt([]byte("plaintext"))
+	_, err := decryptTo(ring, nil, ciphertext)
+	if err != nil || ring.last != aes {
+		t.Error("0xE5F9D7", "wrong keyRing.last", err)
+	}
+	// a 'dst' too small is not an error
+	got, err := decryptTo(aes, make([]byte, 0, 4), ciphertext)
+	if err != nil || string(got) != "plaintext" {
+		t.Error("0xE0C4E8", err)
+	}
+	if _, err := decryptTo(bound, nil, ciphertext); err == nil {
+		t.Error("0xE6A7B3", "decrypted without the AAD")
+	}
+}
+
+// (rc *Receiver) claimPacketBuffer(it *receivingItem, piece []byte)
+// (rc *Receiver) releasePacketBuffers(it *receivingItem)
+//
+// go test -run Test_bufferPool_Receiver_
+//
+// must keep the pieces in the packet buffers until the
+// item is delivered, then return them to the pool
+func Test_bufferPool_Receiver_(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = 100
+	sd.dataHash = getHash(v)
+	sd.comp = comp
+	_ = sd.makePackets("key", sd.comp)
+	var got []byte
+	rc := newRunnableReceiver()
+	rc.Receive = func(k string, v []byte) error {
+		got = v
+		return nil
+	}
+	rc.buffers = newBufferPool(rc.Config.PacketSizeLimit)
+	receive := func(i int) *[]byte {
+		t.Helper()
+		buf := rc.buffers.get()
+		*buf = append(*buf, sd.packets[i].data...)
+		rc.packetBuf = buf
+		_, err := rc.receiveFragment(*buf)
+		if err != nil {
+			t.Fatal("0xE2E0F5", err)
+		}
+		return buf
+	}
+	n := len(sd.packets)
+	for i := 0; i < n-1; i++ {
+		receive(i)
+		if rc.packetBuf != nil {
+			t.Fatal("0xE9C3A6", "buffer not claimed")
+		}
+	}
+	it := rc.receiving[receivingItemID("key", sd.dataHash)]
+	if it == nil || len(it.buffers) != n-1 {
+		t.Fatal("0xE4A8D0", "buffers not kept")
+	}
+	// a piece received twice doesn't keep its buffer
+	dup := receive(0)
+	if rc.packetBuf != nil || len(it.buffers) != n-1 || len(*dup) != 0 {
+		t.Error("0xE1F2B7", "duplicate buffer not recycled")
+	}
+	receive(n - 1)
+	if !bytes.Equal(got, v) {
+		t.Error("0xE7D5C9", "wrong value")
+	}
+	if it.buffers != nil || it.CompressedPieces != nil {
+		t.Error("0xE3B1E4", "buffers not released")
+	}
+}
+
+// -----------------------------------------------------------------------------
+// # Benchmarks
+
+// go test -run NONE -bench Benchmark_bufferPool_ -benchmem
+//
+// compares the allocations of the read loop's handling of the packets
+// of a data item, with and without pooled packet buffers
+func Benchmark_bufferPool_(b *testing.B) {
+	v := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(v[:len(v)/2])
+	comp, _ := (&zlibCompressor{}).Compress(v)
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.dataHash = getHash(v)
+	sd.comp = comp
+	_ = sd.makePackets("key", sd.comp)
+	cphr := &aesCipher{}
+	_ = cphr.SetKey([]byte("0123456789abcdefghijklmnopqrst12"))
+	packets := make([][]byte, len(sd.packets))
+	for i, pk := range sd.packets {
+		packets[i], _ = cphr.Encrypt(pk.data)
+	}
+	run := func(b *testing.B, pooled bool) {
+		rc := newRunnableReceiver()
+		rc.Config.LogWriter = nil
+		rc.Receive = func(k string, v []byte) error { return nil }
+		if pooled {
+			rc.buffers = newBufferPool(rc.Config.PacketSizeLimit)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			rc.receiving = nil
+			for _, data := range packets {
+				buf := rc.buffers.get()
+				var dst []byte
+				if buf != nil {
+					dst = *buf
+				}
+				recv, _, err := rc.decryptPacket(nil, data, dst, cphr)
+				if err != nil {
+					b.Fatal("0xE8F4A2", err)
+				}
+				rc.packetBuf = buf
+				_, _ = rc.receiveFragment(recv)
+				rc.packetBuf = nil
+			}
+		}
+	}
+	b.Run("pooled", func(b *testing.B) { run(b, true) })
+	b.Run("unpooled", func(b *testing.B) { run(b, false) })
+}
+
+// end
@@ -0,0 +1,188 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[capabilities.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Capabilities is a bitmask of the optional protocol features supported
+// by a Sender or Receiver. A Sender advertises its capabilities in the
+// header of each fragment it sends, and a Receiver that understands them
+// advertises its own in its confirmations, so that each end only uses
+// the features that both ends support. Peers that advertise nothing,
+// such as older versions of this package, are assumed to support none
+// of them, which eases rolling upgrades across a mixed-version fleet.
+//
+// Bits that aren't defined by this version are ignored.
+type Capabilities uint32
+
+const (
+	// CapSubPieces means that the Receiver can reassemble pieces that are
+	// resent in sub-pieces (see Configuration.SubPieceSize).
+	CapSubPieces Capabilities = 1 << iota
+
+	// CapNackRuns means that the Sender can read NACKs whose bitmap
+	// of missing pieces is run-length encoded (see Config.NackDelay).
+	CapNackRuns
+
+	// CapJumboPackets means that the Receiver accepts packets larger
+	// than the default Configuration.PacketSizeLimit, for networks
+	// with jumbo frames.
+	CapJumboPackets
+
+	// CapParallelChunks means that the Receiver can uncompress values
+	// that the Sender has compressed in chunks, in parallel (see
+	// Configuration.CompressionWorkers). Receivers that deliver data
+	// items with Archive or ReceiveStream don't advertise it.
+	CapParallelChunks
+
+	// CapReplies means that the Sender can read replies to data items in
+	// confirmations (see ItemInfo.Reply). Receivers that deliver data
+	// items with Archive or ReceiveStream don't advertise it.
+	CapReplies
+)
+
+// capNames holds the names of the defined Capabilities, by bit.
+var capNames = []string{"sub-pieces", "nack-runs", "jumbo-packets",
+	"parallel-chunks", "replies"}
+
+// capabilitiesField is the fragment header field, and the confirmation
+// field, in which peers advertise their Capabilities in hexadecimal.
+const capabilitiesField = "caps:"
+
+// Has returns true if all the capabilities in 'caps' are set.
+func (c Capabilities) Has(caps Capabilities) bool {
+	return c&caps == caps
+} //                                                                         Has
+
+// String returns the names of the capabilities that are set, separated
+// by "|", e.g. "sub-pieces|nack-runs", or "none" if none are set.
+// Undefined bits are written in hexadecimal.
+func (c Capabilities) String() string {
+	var names []string
+	for bit := 0; bit < 32; bit++ {
+		if c&(1<<bit) == 0 {
+			continue
+		}
+		if bit < len(capNames) {
+			names = append(names, capNames[bit])
+			continue
+		}
+		names = append(names, "0x"+strconv.FormatUint(1<<bit, 16))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+} //                                                                      String
+
+// capabilities returns the Capabilities advertised by a Sender
+// or Receiver that uses this Configuration.
+func (cf *Configuration) capabilities() Capabilities {
+	ret := CapSubPieces | CapNackRuns | CapParallelChunks | CapReplies
+	if cf.PacketSizeLimit > defaultPacketSizeLimit {
+		ret |= CapJumboPackets
+	}
+	return ret
+} //                                                                capabilities
+
+// capabilities returns the Capabilities advertised by the Receiver.
+func (rc *Receiver) capabilities() Capabilities {
+	ret := rc.Config.capabilities()
+	if rc.Archive != nil || rc.streaming() {
+		ret &^= CapParallelChunks // they need the value as it was sent
+		ret &^= CapReplies        // and have no Handler to make a reply
+	}
+	return ret
+} //                                                                capabilities
+
+// parseCapabilities parses Capabilities written in hexadecimal.
+func parseCapabilities(s string) (Capabilities, error) {
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, makeError(0xE8B2D6, "bad 'caps'")
+	}
+	return Capabilities(n), nil
+} //                                                           parseCapabilities
+
+// markConfirmationCaps adds the Receiver's capabilities 'caps'
+// to confirmation 'reply', after any rate field.
+func markConfirmationCaps(reply []byte, caps Capabilities) []byte {
+	reply = append(reply, capabilitiesField...)
+	return strconv.AppendUint(reply, uint64(caps), 16)
+} //                                                        markConfirmationCaps
+
+// confirmationCaps returns the capabilities advertised in confirmation
+// packet 'recv', and false if the Receiver advertised none.
+func confirmationCaps(recv []byte) (Capabilities, bool) {
+	if !bytes.HasPrefix(recv, []byte(tagConfirmation)) ||
+		len(recv) < len(tagConfirmation)+32 {
+		return 0, false
+	}
+	recv, _ = splitConfirmationReply(recv)
+	if confirmsDone(recv) {
+		recv = recv[:len(recv)-len(confirmationDoneField)]
+	}
+	fields := recv[len(tagConfirmation)+32:]
+	i := bytes.Index(fields, []byte(capabilitiesField))
+	if i == -1 {
+		return 0, false
+	}
+	caps, err := parseCapabilities(string(fields[i+len(capabilitiesField):]))
+	if err != nil {
+		return 0, false
+	}
+	return caps, true
+} //                                                            confirmationCaps
+
+// peerCapabilities are the capabilities advertised by the Receiver at
+// an address, as last seen by a Sender.
+type peerCapabilities struct {
+	addr string
+	caps Capabilities
+} //                                                            peerCapabilities
+
+// PeerCapabilities returns the capabilities advertised by the Receiver
+// at Sender.Address in its confirmations, and false if it hasn't
+// advertised any yet, e.g. before the first data item is sent, or if
+// the Receiver is of an older version that doesn't advertise them.
+func (sd *Sender) PeerCapabilities() (Capabilities, bool) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.peerCaps == nil || sd.peerCaps.addr != sd.Address {
+		return 0, false
+	}
+	return sd.peerCaps.caps, true
+} //                                                            PeerCapabilities
+
+// setPeerCapabilities records the capabilities 'caps' advertised by the
+// Receiver at Sender.Address, also in the Sender whose SendMany()
+// created this Sender, so that they are known to its later items.
+func (sd *Sender) setPeerCapabilities(caps Capabilities) {
+	for s := sd; s != nil; s = s.parent {
+		s.mu.Lock()
+		if s.peerCaps == nil || s.peerCaps.addr != sd.Address ||
+			s.peerCaps.caps != caps {
+			s.peerCaps = &peerCapabilities{addr: sd.Address, caps: caps}
+		}
+		s.mu.Unlock()
+	}
+} //                                                         setPeerCapabilities
+
+// peerSupports returns true if the Receiver at Sender.Address has
+// advertised all the capabilities in 'caps'.
+func (sd *Sender) peerSupports(caps Capabilities) bool {
+	got, ok := sd.PeerCapabilities()
+	if !ok && sd.parent != nil {
+		got, ok = sd.parent.PeerCapabilities()
+	}
+	return ok && got.Has(caps)
+} //                                                                peerSupports
+
+// end
@@ -0,0 +1,165 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[capabilities_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_capabilities_*
+
+// -----------------------------------------------------------------------------
+
+// (c Capabilities) String() string
+//
+// go test -run Test_capabilities_String_
+//
+func Test_capabilities_String_(t *testing.T) {
+	test := func(c Capabilities, want string) {
+		t.Helper()
+		if got := c.String(); got != want {
+			t.Error("0xE3A9D7", "want:", want, "got:", got)
+		}
+	}
+	test(0, "none")
+	test(CapSubPieces, "sub-pieces")
+	test(CapSubPieces|CapNackRuns|CapJumboPackets,
+		"sub-pieces|nack-runs|jumbo-packets")
+	test(CapNackRuns|1<<8, "nack-runs|0x100")
+	test(CapParallelChunks, "parallel-chunks")
+}
+
+// confirmationCaps(recv []byte) (Capabilities, bool)
+//
+// go test -run Test_capabilities_confirmationCaps_
+//
+// must read the capabilities after any rate field and before the
+// 'done' marker, without readConfirmation() failing on them
+func Test_capabilities_confirmationCaps_(t *testing.T) {
+	hash := getHash([]byte("abc"))
+	want := CapSubPieces | CapJumboPackets
+	for _, rate := range []int64{0, 5000} {
+		for _, done := range []bool{false, true} {
+			reply := markConfirmationCaps(makeConfirmation(hash, rate), want)
+			if done {
+				reply = markConfirmationDone(reply)
+			}
+			caps, ok := confirmationCaps(reply)
+			if !ok || caps != want {
+				t.Error("0xE7C1B4", rate, done, caps, ok)
+			}
+			got, gotRate, err := readConfirmation(reply)
+			if err != nil || !bytes.Equal(got, hash) || gotRate != rate {
+				t.Error("0xE2D8F5", rate, done, gotRate, err)
+			}
+			if confirmsDone(reply) != done {
+				t.Error("0xE9F4A3", rate, done)
+			}
+		}
+	}
+	// older Receivers advertise nothing
+	if _, ok := confirmationCaps(makeConfirmation(hash, 5000)); ok {
+		t.Error("0xE4B6E0")
+	}
+	bad := append(makeConfirmation(hash, 0), capabilitiesField+"xyz"...)
+	if _, ok := confirmationCaps(bad); ok {
+		t.Error("0xE1E3C8")
+	}
+}
+
+// go test -run Test_capabilities_receiveFragment_
+//
+// must advertise the Receiver's capabilities only to Senders that
+// advertised theirs, and record them in the Sender
+func Test_capabilities_receiveFragment_(t *testing.T) {
+	sd := makeTestSender()
+	comp, err := sd.Config.Compressor.Compress([]byte("value"))
+	if err != nil {
+		t.Fatal("0xE9D0B5", err)
+	}
+	sd.key, sd.comp = "key", comp
+	sd.dataHash = getHash([]byte("value"))
+	if err := sd.splitPackets(sd.key, sd.comp, 100); err != nil {
+		t.Fatal("0xE6A1F3", err)
+	}
+	rc := newRunnableReceiver()
+	rc.Config.PacketSizeLimit = 9000
+	rc.Receive = func(k string, v []byte) error { return nil }
+	reply, err := rc.receiveFragment(sd.packets[0].data)
+	if err != nil {
+		t.Fatal("0xE5B7C2", err)
+	}
+	caps, ok := confirmationCaps(reply)
+	if !ok || !caps.Has(CapSubPieces|CapNackRuns|CapJumboPackets) {
+		t.Error("0xE8D3A6", caps, ok)
+	}
+	if _, ok := sd.PeerCapabilities(); ok {
+		t.Error("0xE0F9B1", "capabilities known before any reply")
+	}
+	sd.setPeerCapabilities(caps)
+	if got, ok := sd.PeerCapabilities(); !ok || got != caps ||
+		!sd.peerSupports(CapSubPieces) {
+		t.Error("0xE3C5E9", got, ok)
+	}
+	// a fragment from an older Sender, without the capabilities field
+	field := fmt.Sprintf("%s%X ", capabilitiesField,
+		uint32(sd.Config.capabilities()))
+	old := bytes.Replace(sd.packets[0].data, []byte(field), nil, 1)
+	if bytes.Equal(old, sd.packets[0].data) {
+		t.Fatal("0xE7E2B0", "capabilities field not found")
+	}
+	rc = newRunnableReceiver()
+	rc.Receive = func(k string, v []byte) error { return nil }
+	reply, err = rc.receiveFragment(old)
+	if err != nil {
+		t.Fatal("0xE2A4D8", err)
+	}
+	if _, ok := confirmationCaps(reply); ok {
+		t.Error("0xE6B8F4", "advertised to an older Sender")
+	}
+	// Receivers that need values as they were sent
+	rc.Archive = func(info *ItemInfo, comp []byte) error { return nil }
+	if rc.capabilities().Has(CapParallelChunks) {
+		t.Error("0xE5C0A3", "Archive Receiver can't take chunks")
+	}
+}
+
+// (sd *Sender) payloadSize() int
+//
+// go test -run Test_capabilities_payloadSize_
+//
+// must keep packets within the default size limit for Receivers
+// that don't advertise CapJumboPackets
+func Test_capabilities_payloadSize_(t *testing.T) {
+	sd := makeTestSender()
+	sd.Address = "10.0.0.1:9876"
+	sd.Config.PacketSizeLimit = 9000
+	sd.Config.PacketPayloadSize = 8000
+	if got := sd.payloadSize(); got != 8000 {
+		t.Error("0xE9A2C7", got)
+	}
+	sd.setPeerCapabilities(CapSubPieces | CapNackRuns)
+	want := defaultPacketSizeLimit - sd.Config.headerReserve() -
+		sequenceHeaderSize
+	if got := sd.payloadSize(); got != want {
+		t.Error("0xE4D1B3", got, want)
+	}
+	sd.setPeerCapabilities(CapJumboPackets)
+	if got := sd.payloadSize(); got != 8000 {
+		t.Error("0xE0C6F8", got)
+	}
+	// capabilities of the Receiver at another address don't apply
+	sd.setPeerCapabilities(0)
+	sd.Address = "10.0.0.2:9876"
+	if got := sd.payloadSize(); got != 8000 {
+		t.Error("0xE5F3A0", got)
+	}
+}
+
+// end
@@ -0,0 +1,31 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /chacha/[chacha.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// Package chacha provides a udpt cipher that uses ChaCha20-Poly1305 with
+// a 32-byte key, which is faster than AES-256-GCM on platforms without
+// AES hardware acceleration, e.g. many ARM and MIPS devices.
+//
+// Assign it to Configuration.Cipher on both the Sender and the
+// Receiver:
+//
+//	cf := udpt.NewDefaultConfig()
+//	cf.Cipher = chacha.NewCipher()
+//
+package chacha
+
+import (
+	"github.com/balacode/udpt"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// NewCipher returns a udpt.SymmetricCipher that uses ChaCha20-Poly1305
+// from golang.org/x/crypto, with a 32-byte key. Like the built-in
+// AES-256 cipher, it supports AAD, PreviousKeys, StrictCrypto, Random
+// and KeyExchange (see udpt.NewAEADCipher).
+func NewCipher() udpt.SymmetricCipher {
+	return udpt.NewAEADCipher("ChaCha20-Poly1305", chacha20poly1305.New)
+} //                                                                   NewCipher
+
+// end
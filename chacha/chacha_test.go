@@ -0,0 +1,69 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /chacha/[chacha_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package chacha
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/balacode/udpt"
+)
+
+// NewCipher() udpt.SymmetricCipher
+//
+// go test -run Test_NewCipher_
+//
+// must decrypt the test vector in section 2.8.2 of RFC 8439,
+// round-trip data, and be accepted as a Configuration.Cipher
+func Test_NewCipher_(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(0x80 + i)
+	}
+	ac, ok := NewCipher().(udpt.AADCipher)
+	if !ok {
+		t.Fatal("0xE4A7C9", "must implement udpt.AADCipher")
+	}
+	if err := ac.SetKey(key); err != nil {
+		t.Fatal("0xE8C3D6", err)
+	}
+	// the cipher's ciphertext is the nonce, then the sealed data and tag
+	ciphertext, _ := hex.DecodeString("070000004041424344454647" +
+		"d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d6" +
+		"3dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b36" +
+		"92ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc" +
+		"3ff4def08e4b7a9de576d26586cec64b6116" +
+		"1ae10b594f09e26a7e902ecbd0600691")
+	aad, _ := hex.DecodeString("50515253c0c1c2c3c4c5c6c7")
+	want := "Ladies and Gentlemen of the class of '99: If I could offer " +
+		"you only one tip for the future, sunscreen would be it."
+	got, err := ac.DecryptAAD(ciphertext, aad)
+	if err != nil || string(got) != want {
+		t.Error("0xE7D1C6", err, string(got))
+	}
+	// must reject a tampered tag
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := ac.DecryptAAD(ciphertext, aad); err == nil {
+		t.Error("0xE5F2A8", "accepted a tampered tag")
+	}
+	sealed, err := ac.Encrypt([]byte(want))
+	if err != nil {
+		t.Fatal("0xE9A6C3", err)
+	}
+	opened, err := ac.Decrypt(sealed)
+	if err != nil || !bytes.Equal(opened, []byte(want)) {
+		t.Error("0xE6D1F8", err)
+	}
+	// must be accepted as a Configuration.Cipher
+	cf := udpt.NewDefaultConfig()
+	cf.Cipher = NewCipher()
+	if err := cf.Validate(); err != nil {
+		t.Error("0xE1C8B7", err)
+	}
+}
+
+// end
@@ -0,0 +1,21 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /chacha/[go.mod]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// The ChaCha20-Poly1305 cipher is a separate module, so that udpt itself
+// keeps using only the standard library.
+module github.com/balacode/udpt/chacha
+
+go 1.21
+
+require (
+	github.com/balacode/udpt v0.0.0
+	golang.org/x/crypto v0.32.0
+)
+
+require golang.org/x/sys v0.29.0 // indirect
+
+replace github.com/balacode/udpt => ../
+
+// end
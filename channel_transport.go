@@ -0,0 +1,180 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[channel_transport.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// channelQueueSize is the number of messages a ChannelTransport's
+// connection can hold until the Sender reads them.
+const channelQueueSize = 1024
+
+// DatagramChannel is a message channel to a single Receiver that isn't a
+// UDP socket, e.g. a WebRTC data channel opened by a browser, or the
+// datagram API of a WASI host, through which a Sender can send data
+// items where it can't open UDP sockets (see ChannelTransport).
+//
+// Like UDP, the channel should be unordered and unreliable (for WebRTC,
+// ordered: false and maxRetransmits: 0), since the Sender resends lost
+// packets itself. Each message must be delivered whole, or not at all.
+//
+type DatagramChannel interface {
+
+	// Send sends message 'b'. It must not keep 'b' after it returns.
+	Send(b []byte) error
+
+	// Close closes the channel. The Sender calls it after each data item.
+	Close() error
+} //                                                             DatagramChannel
+
+// ChannelTransport is a Transport that carries the packets of Senders
+// over DatagramChannels, so that Senders compiled for GOOS=js or wasip1,
+// e.g. in browser-based or edge tools, can send data items to Receivers
+// through a gateway that forwards the messages to their UDP port, e.g.:
+//
+//	cf.Transport = &udpt.ChannelTransport{
+//		Open: func(raddr *net.UDPAddr, deliver func([]byte),
+//		) (udpt.DatagramChannel, error) {
+//			dc := openDataChannel(raddr) // e.g. with syscall/js
+//			dc.OnMessage(deliver)
+//			return dc, nil
+//		},
+//	}
+//
+// Sender.Address must then be an IP address and port, since these
+// platforms can't resolve host names. It is passed to Open, which may
+// use it to choose the Receiver. Receivers can't use a ChannelTransport.
+//
+type ChannelTransport struct {
+
+	// Open opens a channel to the Receiver at 'raddr'. It is called for
+	// each data item sent, so it may return a long-lived channel whose
+	// Close does nothing. It must pass each message that arrives on the
+	// channel to 'deliver', e.g. from the channel's message callback,
+	// until the channel is closed. 'deliver' copies the message.
+	Open func(raddr *net.UDPAddr, deliver func(msg []byte),
+	) (DatagramChannel, error)
+} //                                                            ChannelTransport
+
+// Dial implements Transport.Dial() by opening a channel to 'raddr'.
+func (ct *ChannelTransport) Dial(network string, laddr, raddr *net.UDPAddr,
+) (net.Conn, error) {
+	if ct.Open == nil {
+		return nil, makeError(0xE6B1D9, "nil ChannelTransport.Open")
+	}
+	cc := &channelConn{
+		datagramQueue: newDatagramQueue(channelQueueSize),
+		laddr:         laddr,
+		raddr:         raddr,
+	}
+	if cc.laddr == nil {
+		cc.laddr = &net.UDPAddr{}
+	}
+	ch, err := ct.Open(raddr, func(msg []byte) {
+		cc.push(append([]byte(nil), msg...), raddr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil {
+		return nil, makeError(0xE2C7F4, "ChannelTransport.Open: nil channel")
+	}
+	cc.ch = ch
+	return cc, nil
+} //                                                                        Dial
+
+// Listen implements Transport.Listen(), but always fails,
+// since only Senders can use a ChannelTransport.
+func (ct *ChannelTransport) Listen(network string, laddr *net.UDPAddr,
+) (net.PacketConn, error) {
+	return nil, makeError(0xE9E3A8, "Receivers can't use a ChannelTransport")
+} //                                                                      Listen
+
+// -----------------------------------------------------------------------------
+
+// channelConn is the net.Conn of a ChannelTransport: it reads the
+// messages delivered by the channel, and writes to the channel.
+type channelConn struct {
+	*datagramQueue
+	ch    DatagramChannel
+	laddr net.Addr
+	raddr *net.UDPAddr
+	wmu   sync.Mutex // protects 'wdl'
+	wdl   time.Time  // the write deadline
+} //                                                                 channelConn
+
+// Read implements net.Conn.Read(): it reads the next message, waiting
+// until one is delivered or the read deadline passes.
+func (cc *channelConn) Read(b []byte) (int, error) {
+	n, _, err := cc.read(b)
+	return n, err
+} //                                                                        Read
+
+// Write implements net.Conn.Write() by sending 'b' as one message.
+func (cc *channelConn) Write(b []byte) (int, error) {
+	if cc.isClosed() {
+		return 0, net.ErrClosed
+	}
+	cc.wmu.Lock()
+	wdl := cc.wdl
+	cc.wmu.Unlock()
+	if !wdl.IsZero() && !time.Now().Before(wdl) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	err := cc.ch.Send(b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+} //                                                                       Write
+
+// Close implements net.Conn.Close() by closing the channel.
+func (cc *channelConn) Close() error {
+	if cc.isClosed() {
+		return nil
+	}
+	cc.close()
+	return cc.ch.Close()
+} //                                                                       Close
+
+// LocalAddr implements net.Conn.LocalAddr(). The channel has no local
+// UDP address, so it is the address passed to Dial, or a blank one.
+func (cc *channelConn) LocalAddr() net.Addr {
+	return cc.laddr
+} //                                                                   LocalAddr
+
+// RemoteAddr implements net.Conn.RemoteAddr().
+func (cc *channelConn) RemoteAddr() net.Addr {
+	return cc.raddr
+} //                                                                  RemoteAddr
+
+// SetDeadline implements net.Conn.SetDeadline().
+func (cc *channelConn) SetDeadline(t time.Time) error {
+	_ = cc.SetReadDeadline(t)
+	return cc.SetWriteDeadline(t)
+} //                                                                 SetDeadline
+
+// SetReadDeadline implements net.Conn.SetReadDeadline().
+func (cc *channelConn) SetReadDeadline(t time.Time) error {
+	cc.setReadDeadline(t)
+	return nil
+} //                                                             SetReadDeadline
+
+// SetWriteDeadline implements net.Conn.SetWriteDeadline(). Messages
+// are sent without waiting, so it only makes later writes fail once
+// the deadline has passed.
+func (cc *channelConn) SetWriteDeadline(t time.Time) error {
+	cc.wmu.Lock()
+	cc.wdl = t
+	cc.wmu.Unlock()
+	return nil
+} //                                                            SetWriteDeadline
+
+// end
@@ -0,0 +1,148 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                         /[channel_transport_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_ChannelTransport_*
+
+// -----------------------------------------------------------------------------
+
+// channelGateway connects the channels of a ChannelTransport to a
+// Receiver in memory, like a gateway that forwards their messages to
+// the Receiver's UDP port, so the test also runs without sockets.
+type channelGateway struct {
+	*datagramQueue // messages for the Receiver
+	mu             sync.Mutex
+	deliver        func([]byte) // to the Sender's current channel
+	opened, closed int
+}
+
+// gatewayChannel is a DatagramChannel opened on a channelGateway.
+type gatewayChannel struct {
+	gw *channelGateway
+}
+
+func (gc gatewayChannel) Send(b []byte) error {
+	gc.gw.push(append([]byte(nil), b...), &net.UDPAddr{Port: 1})
+	return nil
+}
+
+func (gc gatewayChannel) Close() error {
+	gc.gw.mu.Lock()
+	gc.gw.closed++
+	gc.gw.mu.Unlock()
+	return nil
+}
+
+func (gw *channelGateway) open(raddr *net.UDPAddr, deliver func([]byte),
+) (DatagramChannel, error) {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	gw.deliver = deliver
+	gw.opened++
+	return gatewayChannel{gw}, nil
+}
+
+func (gw *channelGateway) ReadFrom(b []byte) (int, net.Addr, error) {
+	return gw.read(b)
+}
+
+func (gw *channelGateway) WriteTo(b []byte, addr net.Addr) (int, error) {
+	gw.mu.Lock()
+	deliver := gw.deliver
+	gw.mu.Unlock()
+	deliver(b)
+	return len(b), nil
+}
+
+func (gw *channelGateway) Close() error {
+	gw.close()
+	return nil
+}
+
+func (gw *channelGateway) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(10, 1, 2, 3), Port: 9876}
+}
+
+func (gw *channelGateway) SetDeadline(t time.Time) error {
+	return gw.SetReadDeadline(t)
+}
+
+func (gw *channelGateway) SetReadDeadline(t time.Time) error {
+	gw.setReadDeadline(t)
+	return nil
+}
+
+func (gw *channelGateway) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+// (ct *ChannelTransport) Dial(network string, laddr, raddr *net.UDPAddr,
+// ) (net.Conn, error)
+//
+// go test -run Test_ChannelTransport_Dial_
+//
+// must send data items over the channels it opens, reading the
+// confirmations delivered by them, and close each channel
+func Test_ChannelTransport_Dial_(t *testing.T) {
+	key := []byte("channel-key-0123456789abcdefghij")
+	gw := &channelGateway{datagramQueue: newDatagramQueue(channelQueueSize)}
+	got := make(chan []byte, 1)
+	rc := Receiver{PacketConn: gw, CryptoKey: key, Config: NewDefaultConfig(),
+		Receive: func(k string, v []byte) error {
+			got <- v
+			return nil
+		},
+	}
+	rc.Config.LogWriter = nil
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	//
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	cf.Transport = &ChannelTransport{Open: gw.open}
+	sd := Sender{Address: "10.1.2.3:9876", CryptoKey: key, Config: cf}
+	for _, size := range []int{10, 50000} {
+		v := bytes.Repeat([]byte("c"), size)
+		if err := sd.Send("k", v); err != nil {
+			t.Fatal("0xE5D8B1", size, err)
+		}
+		if !bytes.Equal(<-got, v) {
+			t.Error("0xE3F6A9", size, "wrong value")
+		}
+	}
+	gw.mu.Lock()
+	opened, closed := gw.opened, gw.closed
+	gw.mu.Unlock()
+	if opened != 2 || closed != 2 {
+		t.Error("0xE7A3C2", "opened:", opened, "closed:", closed)
+	}
+}
+
+// must refuse to listen, or to dial without Open
+func Test_ChannelTransport_Dial_2(t *testing.T) {
+	var ct ChannelTransport
+	_, err := ct.Dial("udp", nil, &net.UDPAddr{Port: 9876})
+	if !matchError(err, "nil ChannelTransport.Open") {
+		t.Error("0xE1B9E4", "wrong error:", err)
+	}
+	_, err = ct.Listen("udp", nil)
+	if !matchError(err, "Receivers can't use a ChannelTransport") {
+		t.Error("0xE8D4F7", "wrong error:", err)
+	}
+}
+
+// end
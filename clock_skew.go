@@ -0,0 +1,86 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[clock_skew.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// probeTimeField marks a probe (tagProbe) that asks the receiver for the
+// time on its clock. The receiver then appends the field to its reply,
+// followed by the time in nanoseconds since the Unix epoch. Probes
+// without it get the plain reply that older Senders expect.
+const probeTimeField = " time:"
+
+// checkClockSkew returns an error wrapping ErrClockSkew if 'offset', the
+// difference between the peer's clock and this machine's clock, is
+// larger than 'max' in either direction. Zero 'max' disables the check.
+func checkClockSkew(offset, max time.Duration) error {
+	if max <= 0 || (offset <= max && offset >= -max) {
+		return nil
+	}
+	return makeError(0xE5D8A3, ErrClockSkew, describeClockOffset(offset),
+		"exceeding Configuration.MaxClockSkew of", max)
+} //                                                              checkClockSkew
+
+// describeClockOffset describes the difference 'offset'
+// between the peer's clock and this machine's clock.
+func describeClockOffset(offset time.Duration) string {
+	switch {
+	case offset > 0:
+		return fmt.Sprintf("the peer's clock is %v ahead of this machine's",
+			offset)
+	case offset < 0:
+		return fmt.Sprintf("the peer's clock is %v behind this machine's",
+			-offset)
+	}
+	return "the peer's clock matches this machine's"
+} //                                                         describeClockOffset
+
+// makeProbeReply returns the reply (tagProbeReply) to probe 'recv', made
+// by the Receiver at time 'now'. It carries the probe's hash, followed
+// by the Receiver's time if the probe asked for it (probeTimeField).
+func makeProbeReply(recv []byte, now time.Time) []byte {
+	reply := append([]byte(tagProbeReply), getHash(recv)...)
+	header := recv
+	if i := bytes.IndexByte(header, '\n'); i != -1 {
+		header = header[:i]
+	}
+	if bytes.HasSuffix(header, []byte(probeTimeField)) {
+		reply = append(reply, probeTimeField...)
+		reply = strconv.AppendInt(reply, now.UnixNano(), 10)
+	}
+	return reply
+} //                                                              makeProbeReply
+
+// readProbeReply reads a reply made by makeProbeReply() and returns the
+// hash of the probe it replies to, and the Receiver's time, or the zero
+// time if the reply doesn't carry it.
+func readProbeReply(recv []byte) (hash string, remote time.Time, err error) {
+	const hashSize = 32
+	if !bytes.HasPrefix(recv, []byte(tagProbeReply)) ||
+		len(recv) < len(tagProbeReply)+hashSize {
+		return "", time.Time{}, makeError(0xE8B5D6, "bad probe reply")
+	}
+	recv = recv[len(tagProbeReply):]
+	hash = string(recv[:hashSize])
+	if rest := recv[hashSize:]; len(rest) > 0 {
+		if !bytes.HasPrefix(rest, []byte(probeTimeField)) {
+			return "", time.Time{}, makeError(0xE0C7F4, "bad probe reply")
+		}
+		ns, err := strconv.ParseInt(string(rest[len(probeTimeField):]), 10, 64)
+		if err != nil {
+			return "", time.Time{}, makeError(0xE4F1D9, "bad probe time")
+		}
+		remote = time.Unix(0, ns)
+	}
+	return hash, remote, nil
+} //                                                              readProbeReply
+
+// end
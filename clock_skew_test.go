@@ -0,0 +1,80 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /[clock_skew_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_clockSkew_*
+
+// -----------------------------------------------------------------------------
+
+// checkClockSkew(offset, max time.Duration) error
+//
+// go test -run Test_clockSkew_checkClockSkew_
+//
+func Test_clockSkew_checkClockSkew_(t *testing.T) {
+	test := func(offset, max time.Duration, wantErr bool) {
+		err := checkClockSkew(offset, max)
+		if errors.Is(err, ErrClockSkew) != wantErr {
+			t.Error("0xE3D7B2", offset, max, "wrong error:", err)
+		}
+	}
+	test(0, time.Second, false)
+	test(time.Second, time.Second, false)
+	test(-time.Second, time.Second, false)
+	test(time.Second+1, time.Second, true)
+	test(-time.Second-1, time.Second, true)
+	test(time.Hour, 0, false) // disabled
+	//
+	err := checkClockSkew(-time.Minute, time.Second)
+	if !matchError(err, "the peer's clock is 1m0s behind this machine's") {
+		t.Error("0xE8F2C6", "wrong error:", err)
+	}
+}
+
+// makeProbeReply(recv []byte, now time.Time) []byte
+// readProbeReply(recv []byte) (hash string, remote time.Time, err error)
+//
+// go test -run Test_clockSkew_probeReply_
+//
+func Test_clockSkew_probeReply_(t *testing.T) {
+	now := time.Unix(1700000000, 123456789)
+	//
+	// a probe that doesn't ask for the time gets the plain reply
+	probe := []byte(tagProbe + "1\n" + "padding time:")
+	reply := makeProbeReply(probe, now)
+	if !bytes.Equal(reply, append([]byte(tagProbeReply), getHash(probe)...)) {
+		t.Error("0xE6A1E9", string(reply))
+	}
+	hash, remote, err := readProbeReply(reply)
+	if err != nil || hash != string(getHash(probe)) || !remote.IsZero() {
+		t.Error("0xE0B4D5", err, remote)
+	}
+	// a probe that asks for the time gets it in the reply
+	probe = []byte(tagProbe + "2" + probeTimeField + "\n")
+	hash, remote, err = readProbeReply(makeProbeReply(probe, now))
+	if err != nil || hash != string(getHash(probe)) || !remote.Equal(now) {
+		t.Error("0xE9C3A7", err, remote)
+	}
+	for _, bad := range []string{
+		"",
+		tagProbeReply + "short",
+		tagProbeReply + string(getHash(probe)) + "x",
+		tagProbeReply + string(getHash(probe)) + probeTimeField + "x",
+	} {
+		if _, _, err := readProbeReply([]byte(bad)); err == nil {
+			t.Error("0xE4E8B1", "accepted:", bad)
+		}
+	}
+}
+
+// end
@@ -0,0 +1,438 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /cmd/udpt/[main.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// Command udpt sends and receives files with the udpt package, so that
+// it can be used from scripts without writing Go code.
+//
+// Usage:
+//
+//	udpt send -addr HOST:PORT -keyfile FILE [flags] PATH...
+//	udpt receive -keyfile FILE [-port PORT] [-dir DIR] [flags]
+//	udpt probe -addr HOST:PORT -keyfile FILE [-timeout DURATION]
+//	udpt doctor -addr HOST:PORT -keyfile FILE [-timeout DURATION]
+//
+// 'send' sends each file, and every file in each directory tree, with
+// its metadata (see udpt.SendFile). A PATH of "-" sends standard input
+// as the data item named by -name. 'receive' writes the files it
+// receives to -dir, restoring their metadata (see
+// udpt.WriteToDirectory), or with -stdout writes their contents to
+// standard output. 'probe' checks that a receiving udpt is available,
+// for monitoring systems, and prints the round-trip time (see
+// udpt.Probe). It exits with status 1 if there is no reply. 'doctor'
+// diagnoses the connection to a receiving udpt and prints the report
+// (see udpt.Diagnose): the key fingerprint, round-trip time, largest
+// packet size, packet loss and clock offset. It exits with status 1
+// if it finds any problems.
+//
+// The key file holds the shared encryption key: 32 bytes, or 64
+// hexadecimal digits. Leading and trailing white space is ignored.
+//
+// Run "udpt send -h", "udpt receive -h", "udpt probe -h" or
+// "udpt doctor -h" for all flags.
+//
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/balacode/udpt"
+)
+
+// main runs the subcommand given in the arguments and exits
+// with the status it returns.
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+} //                                                                        main
+
+// usage is printed when no valid subcommand is given.
+const usage = `usage:
+  udpt send -addr HOST:PORT -keyfile FILE [flags] PATH...
+  udpt receive -keyfile FILE [-port PORT] [-dir DIR] [flags]
+  udpt probe -addr HOST:PORT -keyfile FILE [-timeout DURATION]
+  udpt doctor -addr HOST:PORT -keyfile FILE [-timeout DURATION]
+  udpt version
+`
+
+// run runs the subcommand in 'args' and returns the exit status:
+// 0 on success, 1 if the command failed and 2 for invalid usage.
+func run(ctx context.Context, args []string, stdin io.Reader,
+	stdout, stderr io.Writer,
+) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "send":
+		err = runSend(ctx, args[1:], stdin, stdout, stderr)
+	case "receive":
+		err = runReceive(ctx, args[1:], stdout, stderr)
+	case "probe":
+		err = runProbe(args[1:], stdout, stderr)
+	case "doctor":
+		err = runDoctor(args[1:], stdout, stderr)
+	case "version":
+		fmt.Fprintln(stdout, "udpt", udpt.Version())
+	default:
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	}
+	fmt.Fprintln(stderr, "udpt:", err)
+	return 1
+} //                                                                         run
+
+// errUsage is returned by the subcommands when their
+// flags are invalid, after the problem has been printed.
+var errUsage = errors.New("invalid usage")
+
+// commonFlags holds the flags shared by the subcommands.
+type commonFlags struct {
+	keyFile  string
+	compress string
+	profile  string
+	verbose  bool
+} //                                                                 commonFlags
+
+// define defines the common flags in flag set 'fs'.
+func (cf *commonFlags) define(fs *flag.FlagSet) {
+	fs.StringVar(&cf.keyFile, "keyfile", "",
+		"file holding the encryption key (required)")
+	fs.StringVar(&cf.compress, "compress", "zlib",
+		"compression: zlib or none (must match the other end)")
+	fs.StringVar(&cf.profile, "profile", "", "settings for the network: "+
+		strings.Join(udpt.ProfileNames(), ", ")+" (default: none)")
+	fs.BoolVar(&cf.verbose, "v", false, "log details of the transfer")
+} //                                                                      define
+
+// config returns the key and the Configuration
+// specified by the common flags.
+func (cf *commonFlags) config(stderr io.Writer,
+) ([]byte, *udpt.Configuration, error) {
+	if cf.keyFile == "" {
+		return nil, nil, errors.New("missing -keyfile")
+	}
+	key, err := readKeyFile(cf.keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	config := udpt.NewDefaultConfig()
+	if cf.profile != "" {
+		config, err = udpt.NewProfileConfig(cf.profile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid -profile: %q", cf.profile)
+		}
+	}
+	config.LogWriter = stderr
+	config.KeyAudit = udpt.KeyAuditWarn
+	config.VerboseSender = cf.verbose
+	config.VerboseReceiver = cf.verbose
+	switch cf.compress {
+	case "zlib":
+	case "none":
+		config.Compressor = noCompression{}
+	default:
+		return nil, nil, fmt.Errorf("invalid -compress: %q", cf.compress)
+	}
+	return key, config, nil
+} //                                                                      config
+
+// runSend runs the 'send' subcommand.
+func runSend(ctx context.Context, args []string, stdin io.Reader,
+	stdout, stderr io.Writer,
+) error {
+	fs := flag.NewFlagSet("udpt send", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.define(fs)
+	addr := fs.String("addr", "", "address of the Receiver, e.g. host:9876")
+	name := fs.String("name", "",
+		"key of the data item, for a single file or standard input")
+	prefix := fs.String("prefix", "",
+		"prepended to the keys of the files in directories")
+	quiet := fs.Bool("q", false, "don't print the files sent")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	paths := fs.Args()
+	switch {
+	case *addr == "":
+		return usageError(fs, "missing -addr")
+	case len(paths) == 0:
+		return usageError(fs, "nothing to send")
+	case *name != "" && len(paths) > 1:
+		return usageError(fs, "-name needs a single PATH")
+	}
+	key, config, err := common.config(stderr)
+	if err != nil {
+		return usageError(fs, err.Error())
+	}
+	sd := udpt.Sender{Address: *addr, CryptoKey: key, Config: config}
+	var errs []error
+	for _, path := range paths {
+		err := sendPath(ctx, &sd, path, *name, *prefix, stdin)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !*quiet {
+			fmt.Fprintln(stdout, "sent", path)
+		}
+	}
+	return errors.Join(errs...)
+} //                                                                     runSend
+
+// sendPath sends the file or directory tree at 'path', or standard input
+// if 'path' is "-", using Sender 'sd'. 'name' is the key of the data
+// item for a file or standard input, and 'prefix' is prepended to the
+// keys of the files in a directory tree.
+func sendPath(ctx context.Context, sd *udpt.Sender, path, name,
+	prefix string, stdin io.Reader,
+) error {
+	if path == "-" {
+		if name == "" {
+			return errors.New("-name is required to send standard input")
+		}
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		return sd.SendContext(ctx, name, data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		sd.CancelAll("interrupted")
+	})
+	defer stop()
+	if !info.IsDir() {
+		return sd.SendFile(path, name)
+	}
+	_, err = sd.SendDirectory(path, &udpt.DirectoryOptions{Prefix: prefix})
+	return err
+} //                                                                    sendPath
+
+// runReceive runs the 'receive' subcommand.
+func runReceive(ctx context.Context, args []string,
+	stdout, stderr io.Writer,
+) error {
+	fs := flag.NewFlagSet("udpt receive", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.define(fs)
+	port := fs.Int("port", 9876, "UDP port to listen on")
+	dir := fs.String("dir", ".", "directory to write the files to")
+	toStdout := fs.Bool("stdout", false,
+		"write the contents of the items to standard output")
+	count := fs.Int("count", 0,
+		"exit after receiving this many items (0 means never)")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "unexpected arguments:",
+			strings.Join(fs.Args(), " "))
+	}
+	if *count < 0 {
+		return usageError(fs, "invalid -count:", fmt.Sprint(*count))
+	}
+	key, config, err := common.config(stderr)
+	if err != nil {
+		return usageError(fs, err.Error())
+	}
+	write := udpt.WriteToDirectory(*dir)
+	var mu sync.Mutex
+	received := 0
+	enough := make(chan struct{})
+	rc := udpt.Receiver{Port: *port, CryptoKey: key, Config: config}
+	rc.Receive = func(k string, v []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if *toStdout {
+			if _, content, ok := udpt.ParseFileItem(v); ok {
+				v = content
+			}
+			_, err := stdout.Write(v)
+			if err != nil {
+				return err
+			}
+		} else {
+			err := write(k, v)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(stderr, "received", k)
+		}
+		received++
+		if received == *count {
+			close(enough)
+		}
+		return nil
+	}
+	go func() {
+		select {
+		case <-enough:
+			_ = rc.Close() // after confirming the last item
+		case <-ctx.Done():
+		}
+	}()
+	err = rc.RunContext(ctx)
+	if err != nil && errors.Is(err, ctx.Err()) {
+		return nil // interrupted
+	}
+	return err
+} //                                                                  runReceive
+
+// runProbe runs the 'probe' subcommand.
+func runProbe(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("udpt probe", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.define(fs)
+	addr := fs.String("addr", "", "address of the Receiver, e.g. host:9876")
+	timeout := fs.Duration("timeout", 5*time.Second,
+		"how long to wait for the reply")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	switch {
+	case *addr == "":
+		return usageError(fs, "missing -addr")
+	case fs.NArg() > 0:
+		return usageError(fs, "unexpected arguments:",
+			strings.Join(fs.Args(), " "))
+	case *timeout <= 0:
+		return usageError(fs, "invalid -timeout:", timeout.String())
+	}
+	key, config, err := common.config(stderr)
+	if err != nil {
+		return usageError(fs, err.Error())
+	}
+	config.ReplyTimeout = *timeout
+	rtt, err := udpt.Probe(*addr, key, config)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "reply from", *addr, "in", rtt)
+	return nil
+} //                                                                    runProbe
+
+// runDoctor runs the 'doctor' subcommand with 'args': it diagnoses the
+// connection to the receiving udpt at -addr and prints the report.
+// Returns an error if the diagnosis finds problems.
+func runDoctor(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("udpt doctor", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var common commonFlags
+	common.define(fs)
+	addr := fs.String("addr", "", "address of the Receiver, e.g. host:9876")
+	timeout := fs.Duration("timeout", 2*time.Second,
+		"how long to wait for the reply to each probe")
+	if err := fs.Parse(args); err != nil {
+		return flagError(err)
+	}
+	switch {
+	case *addr == "":
+		return usageError(fs, "missing -addr")
+	case fs.NArg() > 0:
+		return usageError(fs, "unexpected arguments:",
+			strings.Join(fs.Args(), " "))
+	case *timeout <= 0:
+		return usageError(fs, "invalid -timeout:", timeout.String())
+	}
+	key, config, err := common.config(stderr)
+	if err != nil {
+		return usageError(fs, err.Error())
+	}
+	config.ReplyTimeout = *timeout
+	dg, err := udpt.Diagnose(*addr, key, config)
+	if dg != nil {
+		fmt.Fprint(stdout, dg.String())
+	}
+	if err != nil {
+		return err
+	}
+	if n := len(dg.Problems); n > 0 {
+		return fmt.Errorf("found %d problem(s)", n)
+	}
+	return nil
+} //                                                                   runDoctor
+
+// flagError returns the error to return when flag.FlagSet.Parse()
+// fails with 'err', which the flag set has printed already.
+func flagError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return flag.ErrHelp
+	}
+	return errUsage
+} //                                                                   flagError
+
+// usageError prints 'msg' and the usage of flag set 'fs',
+// and returns errUsage.
+func usageError(fs *flag.FlagSet, msg ...string) error {
+	fmt.Fprintln(fs.Output(), strings.Join(msg, " "))
+	fs.Usage()
+	return errUsage
+} //                                                                  usageError
+
+// readKeyFile reads the encryption key from the file at 'path'. The key
+// is the file's contents with surrounding white space removed, decoded
+// from hexadecimal if it consists of 64 hexadecimal digits.
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) == 64 {
+		if decoded, err := hex.DecodeString(string(key)); err == nil {
+			key = decoded
+		}
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("empty key file: %s", path)
+	}
+	return key, nil
+} //                                                                 readKeyFile
+
+// noCompression is a udpt.Compression that sends data items
+// uncompressed, for data that is already compressed.
+type noCompression struct{}
+
+// Compress returns 'data' unchanged.
+func (noCompression) Compress(data []byte) ([]byte, error) {
+	return data, nil
+} //                                                                    Compress
+
+// Uncompress returns 'comp' unchanged.
+func (noCompression) Uncompress(comp []byte) ([]byte, error) {
+	return comp, nil
+} //                                                                  Uncompress
+
+// end
@@ -0,0 +1,190 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /cmd/udpt/[main_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_main_*
+
+// -----------------------------------------------------------------------------
+
+// run(ctx context.Context, args []string, stdin io.Reader,
+//     stdout, stderr io.Writer,
+// ) int
+//
+// go test -run Test_main_run_
+//
+// must return 2 and print the problem when the arguments are invalid
+func Test_main_run_(t *testing.T) {
+	keyFile := writeTestKey(t)
+	test := func(want int, wantOutput string, args ...string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		got := run(context.Background(), args, nil, &stdout, &stderr)
+		if got != want || !strings.Contains(stderr.String(), wantOutput) {
+			t.Error("0xE7B3D1", args, got, stderr.String())
+		}
+	}
+	test(2, "usage:")
+	test(2, "usage:", "copy")
+	test(2, "missing -addr", "send", "-keyfile", keyFile, "a.txt")
+	test(2, "nothing to send", "send", "-addr", "localhost:1", "-keyfile",
+		keyFile)
+	test(2, "missing -keyfile", "send", "-addr", "localhost:1", "a.txt")
+	test(2, "invalid -compress", "send", "-addr", "localhost:1",
+		"-keyfile", keyFile, "-compress", "lzma", "a.txt")
+	test(2, "invalid -profile", "receive", "-keyfile", keyFile,
+		"-profile", "dialup")
+	test(2, "needs a single PATH", "send", "-addr", "localhost:1",
+		"-keyfile", keyFile, "-name", "x", "a.txt", "b.txt")
+	test(2, "unexpected arguments", "receive", "-keyfile", keyFile, "x")
+	test(2, "flag provided but not defined", "receive", "-bad")
+	test(0, "-keyfile", "receive", "-h")
+	test(1, "no such file", "send", "-addr", "localhost:1",
+		"-keyfile", keyFile, filepath.Join(t.TempDir(), "missing.txt"))
+	test(2, "missing -addr", "probe", "-keyfile", keyFile)
+	test(2, "invalid -timeout", "probe", "-addr", "localhost:1",
+		"-keyfile", keyFile, "-timeout", "0s")
+	test(2, "missing -addr", "doctor", "-keyfile", keyFile)
+	test(2, "invalid -timeout", "doctor", "-addr", "localhost:1",
+		"-keyfile", keyFile, "-timeout", "-1s")
+	//
+	var stdout bytes.Buffer
+	if run(context.Background(), []string{"version"}, nil, &stdout,
+		&stdout) != 0 || !strings.HasPrefix(stdout.String(), "udpt ") {
+		t.Error("0xE2A8C6", stdout.String())
+	}
+}
+
+// go test -run Test_main_sendReceive_
+//
+// must probe a receiving udpt, then send it a file, a directory tree and
+// standard input, after which it exits, given the number of items
+func Test_main_sendReceive_(t *testing.T) {
+	keyFile := writeTestKey(t)
+	src, dst := t.TempDir(), t.TempDir()
+	for name, data := range map[string]string{
+		"one.txt": "1", "tree/two.txt": "22", "tree/sub/three.txt": "333",
+	} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal("0xE5D0F2", err)
+		}
+	}
+	for _, compress := range []string{"zlib", "none"} {
+		var received bytes.Buffer
+		done := make(chan int)
+		go func() {
+			done <- run(context.Background(), []string{"receive",
+				"-port", "9895", "-keyfile", keyFile, "-dir", dst,
+				"-compress", compress, "-count", "4",
+			}, nil, &received, &received)
+		}()
+		time.Sleep(200 * time.Millisecond)
+		var stdout, stderr bytes.Buffer
+		code := run(context.Background(), []string{"probe",
+			"-addr", "127.0.0.1:9895", "-keyfile", keyFile,
+		}, nil, &stdout, &stderr)
+		if code != 0 || !strings.HasPrefix(stdout.String(), "reply from") {
+			t.Error("0xE4F0C7", compress, code, stderr.String())
+		}
+		if compress == "zlib" {
+			stdout.Reset()
+			code = run(context.Background(), []string{"doctor",
+				"-addr", "127.0.0.1:9895", "-keyfile", keyFile,
+			}, nil, &stdout, &stderr)
+			if code != 0 || !strings.Contains(stdout.String(),
+				"reachable:       yes") {
+				t.Error("0xE5C7A3", code, stdout.String(), stderr.String())
+			}
+		}
+		code = run(context.Background(), []string{"send",
+			"-addr", "127.0.0.1:9895", "-keyfile", keyFile,
+			"-compress", compress, "-prefix", "in/",
+			filepath.Join(src, "one.txt"), filepath.Join(src, "tree"),
+		}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Error("0xE9C4A7", compress, code, stderr.String())
+		}
+		code = run(context.Background(), []string{"send",
+			"-addr", "127.0.0.1:9895", "-keyfile", keyFile,
+			"-compress", compress, "-name", "stdin.txt", "-",
+		}, strings.NewReader("from stdin"), &stdout, &stderr)
+		if code != 0 {
+			t.Error("0xE1F5B8", compress, code, stderr.String())
+		}
+		select {
+		case code := <-done:
+			if code != 0 {
+				t.Error("0xE6E2D3", compress, code, received.String())
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("0xE3B7E0", compress, "receive didn't exit")
+		}
+		for name, want := range map[string]string{
+			"one.txt": "1", "in/two.txt": "22", "in/sub/three.txt": "333",
+			"stdin.txt": "from stdin",
+		} {
+			data, err := os.ReadFile(filepath.Join(dst,
+				filepath.FromSlash(name)))
+			if err != nil || string(data) != want {
+				t.Error("0xE0A9C4", compress, name, string(data), err)
+			}
+		}
+	}
+}
+
+// readKeyFile(path string) ([]byte, error)
+//
+// go test -run Test_main_readKeyFile_
+//
+func Test_main_readKeyFile_(t *testing.T) {
+	dir := t.TempDir()
+	test := func(content, want string) {
+		t.Helper()
+		path := filepath.Join(dir, "key")
+		_ = os.WriteFile(path, []byte(content), 0600)
+		key, err := readKeyFile(path)
+		if want == "" {
+			if err == nil {
+				t.Error("0xE8D6B5", "no error for:", content)
+			}
+			return
+		}
+		if err != nil || string(key) != want {
+			t.Error("0xE4C1F9", content, string(key), err)
+		}
+	}
+	raw := "aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0"
+	test(raw, raw)
+	test(" "+raw+"\n", raw)
+	test(strings.Repeat("41", 32)+"\n", strings.Repeat("A", 32))
+	test(" \n", "")
+}
+
+// writeTestKey writes an encryption key to a temporary file,
+// and returns the file's path.
+func writeTestKey(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "udpt.key")
+	err := os.WriteFile(path, []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0\n"),
+		0600)
+	if err != nil {
+		t.Fatal("0xE7F8A2", err)
+	}
+	return path
+}
+
+// end
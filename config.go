@@ -7,6 +7,7 @@ package udpt
 
 import (
 	"io"
+	"net/netip"
 	"os"
 	"time"
 )
@@ -26,9 +27,152 @@ type Configuration struct {
 	//
 	Cipher SymmetricCipher
 
+	// Transport, if specified, carries the packets of Senders and
+	// Receivers instead of plain UDP sockets, e.g. in DTLS (see the
+	// github.com/balacode/udpt/dtls module). Both ends must use the
+	// same Transport. Packets are still encrypted with Cipher, and
+	// LoopbackShortcut deliveries don't use the Transport.
+	Transport Transport
+
 	// Compressor handles compression and uncompression.
 	Compressor Compression
 
+	// Hasher makes the hashes with which the values of data items are
+	// checked after they have been received, uncompressed or opened
+	// (see Receiver.EndToEndKey). Senders and Receivers must use the
+	// same Hasher. Packets are always confirmed with SHA-256 hashes.
+	// If you don't specify Hasher, SHA256Hasher is used.
+	Hasher Hasher
+
+	// StrictCrypto makes the Sender and Receiver pin the exact AEAD
+	// parameters of the cipher (a 12-byte nonce and full 16-byte tag),
+	// refuse packets that deviate from them, and run self-tests of the
+	// crypto path with known test vectors, once, when the Receiver
+	// starts and when the Sender first sends. It requires one of the
+	// built-in ciphers.
+	StrictCrypto bool
+
+	// KeyAudit makes the Sender and Receiver check their keys when they
+	// start, and warn about or refuse weak keys: all zeros, sequences,
+	// low entropy, or the example key from the documentation, which
+	// is often copied into production by mistake. Off by default.
+	KeyAudit KeyAudit
+
+	// Random, if specified, is the source of the random bytes used for
+	// encryption nonces and for the jitter of ItemRetry delays, instead
+	// of crypto/rand and math/rand. Set it to a deterministic reader in
+	// tests to make ciphertexts and retry schedules reproducible. Reads
+	// from it are serialized, so it needn't be safe for concurrent use,
+	// but since packets are encrypted by several workers (see MaxWorkers),
+	// the nonces may go to the packets in a different order on each run.
+	//
+	// Never set it in production: repeating nonces breaks the encryption.
+	// It requires one of the built-in ciphers.
+	//
+	Random io.Reader
+
+	// KeyExchange makes the Sender negotiate a session key with the
+	// Receiver before it sends each data item, using an X25519
+	// handshake, which gives each item a fresh key. Both ends must
+	// enable it. It requires one of the built-in ciphers.
+	//
+	// If the Receiver has a CryptoKey, the handshake is authenticated
+	// with it: the Receiver only accepts Senders with the same key (or
+	// one of its PreviousKeys), the Sender only accepts replies from a
+	// Receiver with its key, and the key is mixed into the session key.
+	// Each authenticated handshake carries a random nonce and the time
+	// it was made, and each reply is bound to the handshake it answers,
+	// so that captured handshakes and replies can't be replayed.
+	//
+	// Otherwise, the CryptoKeys of both ends are left blank, and the
+	// handshake isn't authenticated at all: it protects the data from
+	// passive eavesdroppers, but anyone can send data items to the
+	// Receiver, and an attacker who can intercept or inject packets can
+	// pose as either end, or disrupt transfers with spoofed handshakes.
+	//
+	KeyExchange bool
+
+	// DeadLetter, if specified, receives every data item that the Sender
+	// failed to deliver, so the application can store and replay it.
+	DeadLetter DeadLetter
+
+	// RateController, if specified, paces the packets sent by the
+	// Sender, e.g. a TokenBucket to limit the sending rate on a
+	// constrained link. Packets are also spaced by SendPacketInterval.
+	RateController RateController
+
+	// HashCompressed makes the Sender include a hash of the compressed
+	// data in each packet, in addition to the hash of the uncompressed
+	// data, and makes the Receiver refuse data items without it.
+	//
+	// The Receiver checks the compressed data before uncompressing it,
+	// so a corrupted data item fails with an error that tells whether
+	// it was corrupted before or during decompression, e.g. by a custom
+	// Compression implementation. Receivers always check the hash when
+	// a Sender includes it.
+	//
+	HashCompressed bool
+
+	// VerifiedBlockSize, if greater than zero, makes the Sender hash the
+	// compressed data in blocks of this many bytes, chained so that each
+	// block can be verified as soon as it has arrived. A Receiver with
+	// ReceiveStream then passes each block on to be uncompressed and
+	// written only once it is verified, so a large data item such as a
+	// media file can be played or processed progressively, without
+	// waiting for it to complete, and without consuming unverified bytes.
+	//
+	// Packets are never larger than a block. The hashes add to each packet
+	// header, so together with HashCompressed, this may require a smaller
+	// PacketPayloadSize.
+	//
+	VerifiedBlockSize int
+
+	// LoopbackShortcut makes a Sender deliver data items directly to a
+	// Receiver running in the same process, without using the network,
+	// when Sender.Address resolves to this machine and the Receiver
+	// listens on its port with the same CryptoKey. This makes local
+	// pipelines and single-binary tests fast and loss-free. It is off by
+	// default, since the items then skip the network code paths.
+	LoopbackShortcut bool
+
+	// Network is the network used by the Sender and Receiver: "udp4"
+	// for IPv4 only, "udp6" for IPv6 only, or "udp" (the default) for
+	// both. With "udp", a Receiver listens on both IPv4 and IPv6 where
+	// the platform allows dual-stack sockets, and a Sender connects
+	// to whichever address Sender.Address resolves to.
+	//
+	// IPv6 addresses must be enclosed in brackets, like "[::1]:9876".
+	// Link-local addresses need a zone identifier naming the network
+	// interface, like "[fe80::1%eth0]:9876".
+	//
+	Network string
+
+	// LocalAddress, if specified, is the local IP address from which a
+	// Sender sends, on multi-homed hosts where the default route is not
+	// the path to the Receiver. Interface, if specified instead, is
+	// the name of the network interface, like "eth1", from whose
+	// addresses the Sender sends: the first one in the same family
+	// (IPv4 or IPv6) as Sender.Address, preferring those that are not
+	// link-local. Only one of them may be specified.
+	LocalAddress netip.Addr
+	Interface    string
+
+	// ResumeTransfers makes a Sender remember which pieces of a data item
+	// the Receiver confirmed when it fails to deliver the item, so that
+	// when the same key and value are sent again, it only sends the
+	// missing pieces instead of starting from the first piece. The
+	// Receiver reports any of the skipped pieces it no longer has,
+	// which are then sent too. Both ends must run this version.
+	ResumeTransfers bool
+
+	// ResumeDir, if specified, is a directory in which a Receiver keeps
+	// the pieces of data items it is receiving, until they are complete,
+	// so that Senders can resume them (see ResumeTransfers) even after
+	// the Receiver has restarted, or has expired the items (see
+	// ItemExpiry). Files not resumed for a day are deleted when the
+	// Receiver starts. It isn't used with Receiver.ReceiveStream.
+	ResumeDir string
+
 	// -------------------------------------------------------------------------
 	// Limits:
 
@@ -46,6 +190,9 @@ type Configuration struct {
 	// of which are overhead, giving a usable size of 1500.
 	// (To be on the safe side, we further reduce this by 50 bytes)
 	//
+	// Receivers drop longer datagrams and count
+	// them in ReceiverStats.PacketsOversized.
+	//
 	PacketSizeLimit int
 
 	// PacketPayloadSize is the size of a single packet's payload, in bytes.
@@ -53,6 +200,28 @@ type Configuration struct {
 	// PacketPayloadSize must always be smaller that PacketSizeLimit.
 	PacketPayloadSize int
 
+	// SubPieceSize allows lost pieces larger than this many bytes to be
+	// resent as sub-pieces of at most SubPieceSize bytes, which the
+	// Receiver confirms separately. On lossy paths with large payloads
+	// (such as jumbo frames), losing part of a piece then only requires
+	// resending that sub-piece, instead of the whole piece each time.
+	// Zero disables sub-pieces.
+	SubPieceSize int
+
+	// MaxReceiveBytesPerSecond is the rate at which the Receiver can take
+	// data, for example because of its disk or CPU. The Receiver advertises
+	// it in its confirmations, and Senders don't send faster than that,
+	// so that packets aren't dropped by the Receiver, which would look
+	// like network loss. Zero means no limit.
+	MaxReceiveBytesPerSecond int64
+
+	// MaxSendBytesPerSecond caps the rate at which a Sender sends packets,
+	// including resent ones, so that transfers leave room for other
+	// traffic on a shared link instead of saturating it. The data items
+	// sent by Sender.SendMany() share the cap. Bursts of up to 10 ms at
+	// this rate are allowed. Zero means no limit.
+	MaxSendBytesPerSecond int64
+
 	// SendBufferSize is size of the write buffer used by Send(), in bytes.
 	SendBufferSize int
 
@@ -60,20 +229,167 @@ type Configuration struct {
 	// Send() to retry sending lost packets.
 	SendRetries int
 
+	// ItemRetry specifies if and how Send() retries delivering a whole
+	// data item after it has failed with ErrReceiverUnreachable,
+	// ErrUndeliveredPackets, ErrNoFirstReply or ErrTransferStalled.
+	// By default, failed items are not retried.
+	ItemRetry ItemRetry
+
+	// Staleness specifies when the retransmissions of a data item give
+	// way to fresher items, e.g. when a newer item with the same key
+	// is being sent. By default, items never become stale.
+	Staleness StalenessPolicy
+
+	// MTUCacheLossLimit is the number of consecutive data items in which
+	// large packets may be lost before the Sender discards the path MTU it
+	// has cached for the destination. Zero disables this invalidation.
+	MTUCacheLossLimit int
+
+	// StreamChunkSize is the size, in bytes, of the chunks into which
+	// Sender.SendFromReader() and SendFromReaderAt() split a stream. It
+	// limits the memory used for each chunk by the Sender and Receiver.
+	// Zero means 1 MiB.
+	StreamChunkSize int
+
+	// ResumeFlushBytes is the number of bytes of pieces a Receiver keeps
+	// in memory for each data item, before writing them to its file in
+	// ResumeDir in one sequential write, with contiguous pieces together.
+	// This avoids many small writes, which are slow on hard disks and SD
+	// cards. Pieces not written yet are written when the item expires or
+	// the Receiver stops, but are lost if the Receiver's process crashes.
+	// Zero means 256 KiB, and 1 writes each piece as soon as it arrives.
+	ResumeFlushBytes int
+
+	// StreamReorder limits the memory in which a Receiver that delivers
+	// data items with ReceiveStream keeps the pieces that arrive out of
+	// order, and specifies what it does when a gap exceeds it. By
+	// default, there is no limit.
+	StreamReorder ReorderPolicy
+
+	// ReplayWindow makes a Receiver detect packets that arrive again
+	// because an attacker has captured and replayed them, and drop them.
+	// Senders number each data packet they send or resend, inside its
+	// encrypted part, and Receivers remember which of the last 1024
+	// numbers of each Sender they have received, dropping older ones.
+	// A numbered packet sent at a time further than MaxClockSkew from
+	// the Receiver's clock is dropped too, so packets of Senders that
+	// the Receiver no longer remembers can't be replayed either.
+	//
+	// Packets without numbers (keepalives, probes, and the packets of
+	// Senders of earlier versions) are remembered by their hashes:
+	// ReplayWindow is the number of them remembered, the most recent
+	// ones, so a replay of one older than that isn't detected. Each
+	// takes about 50 bytes of memory. Zero disables replay detection.
+	//
+	ReplayWindow int
+
+	// AllowedSenders, if specified, are the networks from which a
+	// Receiver accepts datagrams. Datagrams from other addresses are
+	// dropped before they are decrypted, so a Receiver exposed on the
+	// internet spends little time on packets from unknown networks.
+	// Use a single-address prefix like 10.0.0.2/32 to allow one host.
+	// They are counted in ReceiverStats.PacketsDenied.
+	AllowedSenders []netip.Prefix
+
+	// DeniedSenders are networks from which a Receiver drops datagrams
+	// before they are decrypted, even if AllowedSenders includes them.
+	// They are counted in ReceiverStats.PacketsDenied.
+	DeniedSenders []netip.Prefix
+
+	// BindRetries is the number of times a Receiver, or a Sender with a
+	// LocalPort, tries again to bind its port when the port is in use,
+	// e.g. by a process being restarted that hasn't closed it yet. The
+	// tries are BindRetryInterval apart, doubling each time. Then the
+	// ports in AltPorts, if any, are tried in turn before giving up.
+	BindRetries int
+
+	// AltPorts is a range of ports to use instead of Receiver.Port or
+	// Sender.LocalPort when that port is still in use after BindRetries.
+	// Receiver.Port is then changed to the port bound, and Senders must
+	// be told about it, e.g. with service discovery. By default, there
+	// are no alternate ports.
+	AltPorts PortRange
+
+	// MaxWorkers is the maximum number of goroutines each Sender uses
+	// to send packets, and to process the confirmations it receives.
+	// The goroutines are reused for further packets, so queuing many
+	// data items doesn't start a goroutine per packet. Zero means 16.
+	MaxWorkers int
+
+	// CompressionWorkers is the number of goroutines with which a Sender
+	// compresses a value of 2 MiB or more, in chunks of 1 MiB, and with
+	// which a Receiver uncompresses it. This cuts the time to compress
+	// large values on multi-core machines. Values are only compressed in
+	// chunks for Receivers that have advertised CapParallelChunks, which
+	// a Sender learns from the confirmations of its first data item, and
+	// the Compressor must be safe for concurrent use. Zero means
+	// GOMAXPROCS, and 1 compresses values as a whole.
+	CompressionWorkers int
+
+	// MaxItemsInFlight is the maximum number of data items
+	// that Sender.SendMany() sends at once. Zero means 4.
+	MaxItemsInFlight int
+
+	// PinReceiveLoop (Linux only) binds the Receiver's read loop to CPU
+	// ReceiveLoopCPU: the loop's goroutine is locked to an OS thread
+	// that only runs on that CPU, and the socket's SO_INCOMING_CPU
+	// option asks the kernel to handle its packets on the same CPU.
+	// This keeps caches warm at very high packet rates, but slows the
+	// Receiver down if that CPU is busy with other work, so it is off
+	// by default. Failures to pin are logged, and the Receiver runs
+	// unpinned. It is ignored on other platforms.
+	PinReceiveLoop bool
+	ReceiveLoopCPU int
+
 	// -------------------------------------------------------------------------
 	// Timeouts and Intervals:
 
 	// ReplyTimeout is the maximum time to wait for reply
-	// datagram(s) to arrive in a UDP connection.
+	// datagram(s) to arrive in a UDP connection, before
+	// resending the packets that haven't been confirmed.
 	ReplyTimeout time.Duration
 
+	// FirstReplyTimeout is the maximum time Send() waits for the
+	// first packet of a data item to be confirmed, after which it
+	// fails with ErrNoFirstReply. Zero means no limit.
+	FirstReplyTimeout time.Duration
+
+	// StallTimeout is the maximum time Send() waits for another packet
+	// to be confirmed once a transfer has begun, after which it fails
+	// with ErrTransferStalled. Zero means no limit.
+	//
+	// When StallTimeout is set, rounds of resending in which new packets
+	// are confirmed don't count towards SendRetries, so a slow transfer
+	// continues for as long as it is making progress.
+	//
+	StallTimeout time.Duration
+
+	// ItemTimeout is the maximum time Send() may spend delivering a data
+	// item, including item retries, after which it fails with
+	// ErrItemTimeout. Zero means no limit.
+	ItemTimeout time.Duration
+
 	// SendPacketInterval is the time to wait between sending packets.
 	SendPacketInterval time.Duration
 
-	// SendRetryInterval is the time for Sender.Send() to
-	// wait before retrying to send undelivered packets.
+	// SendRetryInterval is the time for Sender.Send() to wait before
+	// it first resends undelivered packets, until it has measured the
+	// round-trip time to the Receiver. Further delays back off from
+	// the RTT, unless RetryPolicy is specified. See BackoffRetry.
 	SendRetryInterval time.Duration
 
+	// RetryPolicy, if specified, decides how long Sender.Send() waits
+	// before each round of resending undelivered packets, instead of
+	// the default BackoffRetry based on SendRetryInterval. Use
+	// FixedRetry for deterministic delays, e.g. in tests.
+	RetryPolicy RetryPolicy
+
+	// SendScheduler, if specified, decides when Sender.Send() starts
+	// sending each data item after it has been compressed, e.g. only
+	// off-peak (see OffPeakSchedule), or together with other items
+	// (see CoalescingSchedule). By default, items start at once.
+	SendScheduler SendScheduler
+
 	// SendWaitInterval is the amount of time Sender() should sleep
 	// in the loop, before checking if a confirmation has arrived.
 	SendWaitInterval time.Duration
@@ -82,6 +398,76 @@ type Configuration struct {
 	// wait for writing to a UDP connection.
 	WriteTimeout time.Duration
 
+	// BindRetryInterval is the time to wait before
+	// the first of BindRetries. Zero retries at once.
+	BindRetryInterval time.Duration
+
+	// NackDelay is the time after which a Receiver, when fragments of a
+	// data item stop arriving before it is complete, sends the Sender a
+	// NACK packet listing the missing pieces. The Sender then resends
+	// only those pieces at once, instead of waiting for ReplyTimeout,
+	// and doesn't resend pieces whose confirmations were lost.
+	// Zero disables NACKs.
+	NackDelay time.Duration
+
+	// ItemExpiry is how long a Receiver keeps a data item after its
+	// fragments stop arriving. Incomplete items are then discarded.
+	// Delivered items are kept until then to confirm packets that the
+	// Sender sends again without delivering them twice.
+	// Zero means 1 minute.
+	ItemExpiry time.Duration
+
+	// HandlerTimeout is how long a Receiver waits for its Receive,
+	// Handler or Archive callback to return for a data item before it
+	// emits a SlowHandler event (see Receiver.OnEvent) and logs it, so
+	// that a hung downstream service, such as a database, doesn't stop
+	// deliveries unnoticed. The Receiver then keeps waiting, unless
+	// DetachSlowHandlers is set. Zero disables the timeout.
+	HandlerTimeout time.Duration
+
+	// DetachSlowHandlers makes a Receiver stop waiting for a callback
+	// that exceeds HandlerTimeout. The callback keeps running in the
+	// background, the data item is confirmed as delivered, and further
+	// items are passed to the callback while it still runs, so it must
+	// be safe for concurrent use. If it fails later, the error is only
+	// logged and counted in ReceiverStats.ReceiveErrors.
+	DetachSlowHandlers bool
+
+	// MTUCacheExpiry is how long the Sender remembers the
+	// path MTU discovered for each destination address.
+	MTUCacheExpiry time.Duration
+
+	// ProbePathMTU makes the Sender probe for the largest packet that
+	// gets through to an address, before sending the first data item
+	// to it, and whenever MTUCacheExpiry has passed. The probes are sent
+	// with the Don't Fragment bit set where the platform allows it.
+	// The path MTU found is cached, and PacketPayloadSize is reduced to
+	// fit it, so that packets are not fragmented (or dropped) along
+	// paths with a smaller MTU, e.g. through VPNs and tunnels.
+	// It has no effect if MTUCacheExpiry is zero or KeyExchange is on.
+	ProbePathMTU bool
+
+	// MaxClockSkew is the largest difference between the clocks of the
+	// Sender and the Receiver that is tolerated where times are exchanged
+	// between them. Sender.Diagnose() measures the Receiver's clock and
+	// reports ErrClockSkew if it is further off, since a peer with a
+	// wildly wrong clock would otherwise make timestamps from it look
+	// expired or from the future. Receivers drop data packets sent at
+	// a time further off than this (see ReplayWindow), and refuse
+	// authenticated key exchange handshakes made at such a time, while
+	// Senders fail with ErrClockSkew if the reply to theirs is (see
+	// KeyExchange). Zero disables these checks.
+	MaxClockSkew time.Duration
+
+	// KeepaliveInterval, if specified, makes the Sender send a small
+	// encrypted keepalive packet whenever it has sent nothing else for
+	// this long during a transfer, e.g. while it waits for confirmations
+	// or for the next chunk of a stream, so that the mapping of a NAT
+	// or stateful firewall on the way doesn't expire. Receivers ignore
+	// keepalives. Many NATs drop idle UDP mappings after 30 seconds,
+	// so 15 to 25 seconds is typical. Zero disables keepalives.
+	KeepaliveInterval time.Duration
+
 	// -------------------------------------------------------------------------
 	// Logging:
 
@@ -89,13 +475,60 @@ type Configuration struct {
 	// If you leave it nil, no logging will be done.
 	LogWriter io.Writer
 
+	// Logger, if specified, receives the log messages as structured
+	// records instead of LogWriter: errors at the Error level, messages
+	// like "received: key" at the Info level, and the messages enabled
+	// by VerboseReceiver and VerboseSender at the Debug level.
+	// See NewSlogLogger() to log with log/slog. If neither Logger nor
+	// LogWriter is specified, messages go to the Logger set by
+	// SetDefaultLogger(), if any.
+	Logger Logger
+
 	// VerboseReceiver specifies if Receiver should
-	// write informational log messages to LogWriter.
+	// write informational log messages to LogWriter or Logger.
 	VerboseReceiver bool
 
 	// VerboseSender specifies if Sender should write
-	// informational log messages to LogWriter.
+	// informational log messages to LogWriter or Logger.
 	VerboseSender bool
+
+	// TraceWriter, if specified, receives a timeline of every data item
+	// the Sender sends over the network: when each packet was sent,
+	// resent and confirmed, or went unconfirmed. It is written in the
+	// Chrome trace event format, to be opened in chrome://tracing or
+	// https://ui.perfetto.dev to see stalls and bursts of loss. Call
+	// Sender.Close() after the last item to complete the trace. Give
+	// each Sender its own writer, since each writes a separate trace.
+	TraceWriter io.Writer
+
+	// TraceMaxEvents is the maximum number of events traced for each
+	// data item. Further events are dropped. Zero means no limit.
+	TraceMaxEvents int
+
+	// HistorySize is the number of recent data items whose outcomes a
+	// Sender keeps for each destination address (see Sender.History).
+	// Zero disables the history.
+	HistorySize int
+
+	// ProfileLabels makes the Sender and Receiver attach pprof labels
+	// to the goroutines that compress, encrypt, send and receive each
+	// data item, so CPU profiles attribute their cost to transfers.
+	// The labels are "udpt.op" ("send" or "receive"), "udpt.key",
+	// and "udpt.addr" (Sender.Address) or "udpt.port" (Receiver.Port).
+	ProfileLabels bool
+
+	// OnProgress, if specified, is called as the data item with key
+	// 'name' is transferred: by the Sender when packets are confirmed,
+	// and by the Receiver when pieces are collected. The bytes counted
+	// are those of the compressed value, as sent over the network.
+	// On the Receiver, 'totalBytes' is an estimate until the last
+	// piece of the item arrives.
+	//
+	// It is called from the goroutines that process confirmations
+	// and from the Receiver's read loop, so it must be safe for
+	// concurrent use and should return quickly.
+	//
+	OnProgress func(name string, sentBytes, totalBytes int64)
 } //                                                               Configuration
 
 // NewDebugConfig returns configuration settings for debugging.
@@ -122,21 +555,36 @@ func NewDefaultConfig() *Configuration {
 		// Components:
 		Cipher:     &aesCipher{},
 		Compressor: &zlibCompressor{},
+		Hasher:     SHA256Hasher{},
+		//
+		LoopbackShortcut: false,
+		Network:          "udp",
 		//
 		// Limits:
-		PacketSizeLimit:   1450,
+		PacketSizeLimit:   defaultPacketSizeLimit,
 		PacketPayloadSize: 1024,
 		SendBufferSize:    16 * 1024 * 2014, // 16 MiB
 		SendRetries:       10,
+		MTUCacheLossLimit: 3,
+		ReplayWindow:      defaultReplayWindow,
+		BindRetries:       3,
 		//
 		// Timeouts and Intervals:
 		ReplyTimeout:       10 * time.Second,
+		FirstReplyTimeout:  30 * time.Second,
+		StallTimeout:       30 * time.Second,
 		SendPacketInterval: 1 * time.Millisecond,
 		SendRetryInterval:  250 * time.Millisecond,
 		SendWaitInterval:   25 * time.Millisecond,
 		WriteTimeout:       10 * time.Second,
+		BindRetryInterval:  100 * time.Millisecond,
+		NackDelay:          1 * time.Second,
+		MTUCacheExpiry:     10 * time.Minute,
+		MaxClockSkew:       30 * time.Second,
 		//
-		// Logging: (default nil/zero values)
+		// Logging: (default nil/zero values, except)
+		TraceMaxEvents: 10000,
+		HistorySize:    32,
 	}
 } //                                                            NewDefaultConfig
 
@@ -151,9 +599,25 @@ func (cf *Configuration) Validate() error {
 	if cf.Cipher == nil {
 		return makeError(0xE16FB9, "nil Configuration.Cipher")
 	}
+	if cf.KeyExchange {
+		if _, err := cloneCipher(cf.Cipher); err != nil {
+			return makeError(0xE486F7,
+				"Configuration.KeyExchange requires a built-in cipher")
+		}
+	}
 	if cf.Compressor == nil {
 		return makeError(0xE5B3C1, "nil Configuration.Compressor")
 	}
+	if cf.Hasher != nil && cf.Hasher.New().Size() != 32 {
+		return makeError(0xE9C1A7,
+			"Configuration.Hasher must make 32-byte hashes")
+	}
+	switch cf.Network {
+	case "", "udp", "udp4", "udp6":
+	default:
+		return makeError(0xE3A7D2,
+			"invalid Configuration.Network:", cf.Network)
+	}
 	// Limits:
 	n := cf.PacketSizeLimit
 	if n < 8 || n > (65535-8) {
@@ -161,10 +625,25 @@ func (cf *Configuration) Validate() error {
 			"invalid Configuration.PacketSizeLimit:", n)
 	}
 	n = cf.PacketPayloadSize
-	if n < 1 || n > (cf.PacketSizeLimit-200) {
+	if n < 1 || n > (cf.PacketSizeLimit-cf.headerReserve()) {
 		return makeError(0xE54BF4,
 			"invalid Configuration.PacketPayloadSize:", n)
 	}
+	n = cf.VerifiedBlockSize
+	if n < 0 {
+		return makeError(0xE2F6B9,
+			"invalid Configuration.VerifiedBlockSize:", n)
+	}
+	if cf.MaxReceiveBytesPerSecond < 0 {
+		return makeError(0xEB4385,
+			"invalid Configuration.MaxReceiveBytesPerSecond:",
+			cf.MaxReceiveBytesPerSecond)
+	}
+	if cf.MaxSendBytesPerSecond < 0 {
+		return makeError(0xE9C2E6,
+			"invalid Configuration.MaxSendBytesPerSecond:",
+			cf.MaxSendBytesPerSecond)
+	}
 	n = cf.SendBufferSize
 	if n < 0 {
 		return makeError(0xE27C2B,
@@ -175,7 +654,163 @@ func (cf *Configuration) Validate() error {
 		return makeError(0xE47C83,
 			"invalid Configuration.SendRetries:", n)
 	}
+	err := cf.ItemRetry.validate()
+	if err != nil {
+		return err
+	}
+	err = cf.Staleness.validate()
+	if err != nil {
+		return err
+	}
+	err = cf.StreamReorder.validate()
+	if err != nil {
+		return err
+	}
+	n = cf.MTUCacheLossLimit
+	if n < 0 {
+		return makeError(0xE94E1F,
+			"invalid Configuration.MTUCacheLossLimit:", n)
+	}
+	n = cf.StreamChunkSize
+	if n < 0 {
+		return makeError(0xE78DDB,
+			"invalid Configuration.StreamChunkSize:", n)
+	}
+	n = cf.ResumeFlushBytes
+	if n < 0 {
+		return makeError(0xE5D7A0,
+			"invalid Configuration.ResumeFlushBytes:", n)
+	}
+	n = cf.SubPieceSize
+	if n < 0 {
+		return makeError(0xE0C2C1,
+			"invalid Configuration.SubPieceSize:", n)
+	}
+	n = cf.ReplayWindow
+	if n < 0 {
+		return makeError(0xE2D6B1,
+			"invalid Configuration.ReplayWindow:", n)
+	}
+	err = validatePrefixes(cf.AllowedSenders)
+	if err != nil {
+		return makeError(0xE4A8D3, "invalid Configuration.AllowedSenders:",
+			err)
+	}
+	err = validatePrefixes(cf.DeniedSenders)
+	if err != nil {
+		return makeError(0xE9D5B2, "invalid Configuration.DeniedSenders:",
+			err)
+	}
+	if cf.LocalAddress.IsValid() && cf.Interface != "" {
+		return makeError(0xE4D7A3, "Configuration.LocalAddress and",
+			"Configuration.Interface are both specified")
+	}
+	n = cf.BindRetries
+	if n < 0 {
+		return makeError(0xE5F0B8,
+			"invalid Configuration.BindRetries:", n)
+	}
+	if err := cf.AltPorts.validate(); err != nil {
+		return makeError(0xE7D4A1, "invalid Configuration.AltPorts:", err)
+	}
+	n = cf.CompressionWorkers
+	if n < 0 {
+		return makeError(0xE3E9B5,
+			"invalid Configuration.CompressionWorkers:", n)
+	}
+	n = cf.MaxWorkers
+	if n < 0 {
+		return makeError(0xEA2659,
+			"invalid Configuration.MaxWorkers:", n)
+	}
+	n = cf.MaxItemsInFlight
+	if n < 0 {
+		return makeError(0xE4ADFD,
+			"invalid Configuration.MaxItemsInFlight:", n)
+	}
+	n = cf.ReceiveLoopCPU
+	if n < 0 {
+		return makeError(0xEA8988,
+			"invalid Configuration.ReceiveLoopCPU:", n)
+	}
+	// Timeouts and Intervals:
+	if cf.FirstReplyTimeout < 0 {
+		return makeError(0xE172CD,
+			"invalid Configuration.FirstReplyTimeout:", cf.FirstReplyTimeout)
+	}
+	if cf.StallTimeout < 0 {
+		return makeError(0xE6364D,
+			"invalid Configuration.StallTimeout:", cf.StallTimeout)
+	}
+	if cf.NackDelay < 0 {
+		return makeError(0xEEECA9,
+			"invalid Configuration.NackDelay:", cf.NackDelay)
+	}
+	if cf.ItemTimeout < 0 {
+		return makeError(0xEF3AD0,
+			"invalid Configuration.ItemTimeout:", cf.ItemTimeout)
+	}
+	if cf.ItemExpiry < 0 {
+		return makeError(0xE97A2F,
+			"invalid Configuration.ItemExpiry:", cf.ItemExpiry)
+	}
+	if cf.BindRetryInterval < 0 {
+		return makeError(0xE0C6F3,
+			"invalid Configuration.BindRetryInterval:", cf.BindRetryInterval)
+	}
+	if cf.HandlerTimeout < 0 {
+		return makeError(0xE3B8D5,
+			"invalid Configuration.HandlerTimeout:", cf.HandlerTimeout)
+	}
+	if cf.MTUCacheExpiry < 0 {
+		return makeError(0xEB6E72,
+			"invalid Configuration.MTUCacheExpiry:", cf.MTUCacheExpiry)
+	}
+	if cf.MaxClockSkew < 0 {
+		return makeError(0xE6B0A4,
+			"invalid Configuration.MaxClockSkew:", cf.MaxClockSkew)
+	}
+	if cf.KeepaliveInterval < 0 {
+		return makeError(0xE7F2C4,
+			"invalid Configuration.KeepaliveInterval:", cf.KeepaliveInterval)
+	}
+	if cf.KeyAudit < KeyAuditOff || cf.KeyAudit > KeyAuditRefuse {
+		return makeError(0xE9C6B3,
+			"invalid Configuration.KeyAudit:", cf.KeyAudit)
+	}
+	// Logging:
+	n = cf.TraceMaxEvents
+	if n < 0 {
+		return makeError(0xE1E709,
+			"invalid Configuration.TraceMaxEvents:", n)
+	}
+	n = cf.HistorySize
+	if n < 0 {
+		return makeError(0xE7A4C9,
+			"invalid Configuration.HistorySize:", n)
+	}
 	return nil
 } //                                                                    Validate
 
+// network returns Network, or "udp" if it is blank.
+func (cf *Configuration) network() string {
+	if cf.Network == "" {
+		return "udp"
+	}
+	return cf.Network
+} //                                                                     network
+
+// headerReserve returns the number of bytes in each packet
+// reserved for everything apart from the data payload.
+func (cf *Configuration) headerReserve() int {
+	ret := packetHeaderReserve
+	if cf.HashCompressed {
+		ret += compHashFieldSize
+	}
+	if cf.VerifiedBlockSize > 0 {
+		ret += verifiedFieldsSize
+	}
+	return ret
+} //                                                               headerReserve
+
 // end
@@ -94,6 +94,32 @@ func Test_config_Configuration_Validate_(t *testing.T) {
 			t.Error("0xE2CF8C", "wrong error:", err)
 		}
 	}
+	{
+		var cf = makeValidConfig()
+		cf.Hasher = sha512Hasher{}
+		err := cf.Validate()
+		if !matchError(err, "must make 32-byte hashes") {
+			t.Error("0xE4F7C2", "wrong error:", err)
+		}
+		cf.Hasher = sha512_256Hasher{}
+		if err := cf.Validate(); err != nil {
+			t.Error("0xE8A3D5", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.Network = "tcp"
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.Network") {
+			t.Error("0xE7B0C4", "wrong error:", err)
+		}
+		for _, network := range []string{"", "udp", "udp4", "udp6"} {
+			cf.Network = network
+			if err := cf.Validate(); err != nil {
+				t.Error("0xE2D81F", network, err)
+			}
+		}
+	}
 	{
 		var cf = makeValidConfig()
 		cf.PacketSizeLimit = 8 - 1
@@ -127,6 +153,48 @@ func Test_config_Configuration_Validate_(t *testing.T) {
 			t.Error("0xEC92E8", "wrong error:", err)
 		}
 	}
+	{
+		// the compressed data hash takes up more room in the header
+		var cf = makeValidConfig()
+		cf.PacketSizeLimit = 1000
+		cf.PacketPayloadSize = 1000 - 200
+		if err := cf.Validate(); err != nil {
+			t.Error("0xE76420", err)
+		}
+		cf.HashCompressed = true
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.PacketPayloadSize") {
+			t.Error("0xEC195C", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.KeyExchange = true
+		cf.Cipher = &plainCipher{}
+		err := cf.Validate()
+		if !matchError(err,
+			"Configuration.KeyExchange requires a built-in cipher") {
+			t.Error("0xEFED17", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.MaxSendBytesPerSecond = -1
+		err := cf.Validate()
+		if !matchError(err,
+			"invalid Configuration.MaxSendBytesPerSecond") {
+			t.Error("0xE1B8F3", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.MaxReceiveBytesPerSecond = -1
+		err := cf.Validate()
+		if !matchError(err,
+			"invalid Configuration.MaxReceiveBytesPerSecond") {
+			t.Error("0xEE5C02", "wrong error:", err)
+		}
+	}
 	{
 		var cf = makeValidConfig()
 		cf.SendBufferSize = -1
@@ -143,6 +211,191 @@ func Test_config_Configuration_Validate_(t *testing.T) {
 			t.Error("0xE0DE62", "wrong error:", err)
 		}
 	}
+	{
+		var cf = makeValidConfig()
+		cf.MTUCacheLossLimit = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.MTUCacheLossLimit") {
+			t.Error("0xE7A558", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.StreamChunkSize = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.StreamChunkSize") {
+			t.Error("0xE016B1", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.ResumeFlushBytes = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.ResumeFlushBytes") {
+			t.Error("0xE8B4C7", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.StreamReorder.MaxBytes = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.StreamReorder.MaxBytes") {
+			t.Error("0xE3C0D8", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.FirstReplyTimeout = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.FirstReplyTimeout") {
+			t.Error("0xE950F9", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.StallTimeout = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.StallTimeout") {
+			t.Error("0xEDBF39", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.Staleness.NearDeadline = -1
+		err := cf.Validate()
+		if !matchError(err,
+			"invalid Configuration.Staleness.NearDeadline") {
+			t.Error("0xE3C3E6", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.ItemTimeout = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.ItemTimeout") {
+			t.Error("0xE3BEDB", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.SubPieceSize = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.SubPieceSize") {
+			t.Error("0xECAAEC", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.CompressionWorkers = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.CompressionWorkers") {
+			t.Error("0xE8E5A0", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.BindRetries = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.BindRetries") {
+			t.Error("0xE1C4F9", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.AltPorts = PortRange{First: 9000, Last: 8999}
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.AltPorts") {
+			t.Error("0xE7A5D0", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.BindRetryInterval = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.BindRetryInterval") {
+			t.Error("0xE4F6B2", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.ReplayWindow = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.ReplayWindow") {
+			t.Error("0xE6F1C8", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.MaxWorkers = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.MaxWorkers") {
+			t.Error("0xE233DA", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.MaxItemsInFlight = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.MaxItemsInFlight") {
+			t.Error("0xEDFFF2", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.ReceiveLoopCPU = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.ReceiveLoopCPU") {
+			t.Error("0xE5CA8E", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.NackDelay = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.NackDelay") {
+			t.Error("0xE9CA2E", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.ItemExpiry = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.ItemExpiry") {
+			t.Error("0xE24D35", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.HandlerTimeout = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.HandlerTimeout") {
+			t.Error("0xE6A1C9", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.MTUCacheExpiry = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.MTUCacheExpiry") {
+			t.Error("0xEC753D", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.MaxClockSkew = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.MaxClockSkew") {
+			t.Error("0xE1B8D3", "wrong error:", err)
+		}
+	}
+	{
+		var cf = makeValidConfig()
+		cf.TraceMaxEvents = -1
+		err := cf.Validate()
+		if !matchError(err, "invalid Configuration.TraceMaxEvents") {
+			t.Error("0xE7CD40", "wrong error:", err)
+		}
+	}
 }
 
 // end
@@ -0,0 +1,82 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[confirmation.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// confirmationRateField is the field of a confirmation packet in which the
+// Receiver advertises Configuration.MaxReceiveBytesPerSecond to the Sender.
+const confirmationRateField = "rate:"
+
+// confirmationDoneField ends a confirmation packet when the Receiver has
+// the complete data item to which the confirmed packet belongs. It is
+// only sent to Senders that resume data items (Config.ResumeTransfers).
+const confirmationDoneField = "done"
+
+// makeConfirmation returns a confirmation packet for the packet whose hash
+// is 'hash'. If 'rate' is more than zero, the packet also advertises it as
+// the number of bytes per second the Receiver can take.
+func makeConfirmation(hash []byte, rate int64) []byte {
+	ret := append([]byte(tagConfirmation), hash...)
+	if rate > 0 {
+		ret = append(ret, confirmationRateField...)
+		ret = strconv.AppendInt(ret, rate, 10)
+	}
+	return ret
+} //                                                            makeConfirmation
+
+// markConfirmationDone adds confirmationDoneField to confirmation 'reply'.
+func markConfirmationDone(reply []byte) []byte {
+	return append(reply, confirmationDoneField...)
+} //                                                        markConfirmationDone
+
+// confirmsDone returns true if confirmation packet 'recv' reports that
+// the Receiver has the complete data item (see markConfirmationDone).
+func confirmsDone(recv []byte) bool {
+	recv, _ = splitConfirmationReply(recv)
+	return len(recv) > len(tagConfirmation)+32 &&
+		bytes.HasSuffix(recv, []byte(confirmationDoneField))
+} //                                                                confirmsDone
+
+// readConfirmation reads a confirmation packet made by makeConfirmation().
+// Returns the hash of the confirmed packet and the rate advertised by the
+// Receiver, which is zero if the Receiver has no limit. Any capabilities
+// the Receiver advertised are skipped (see confirmationCaps), and so is
+// any reply (see splitConfirmationReply).
+func readConfirmation(recv []byte) (hash []byte, rate int64, err error) {
+	if !bytes.HasPrefix(recv, []byte(tagConfirmation)) {
+		return nil, 0, makeError(0xE8F7C4, "bad reply header")
+	}
+	recv, _ = splitConfirmationReply(recv)
+	if confirmsDone(recv) {
+		recv = recv[:len(recv)-len(confirmationDoneField)]
+	}
+	recv = recv[len(tagConfirmation):]
+	if len(recv) < 32 {
+		return nil, 0, makeError(0xEBA75E, "bad confirmed hash")
+	}
+	hash, recv = recv[:32], recv[32:]
+	if i := bytes.Index(recv, []byte(capabilitiesField)); i != -1 {
+		recv = recv[:i] // see confirmationCaps()
+	}
+	if len(recv) == 0 {
+		return hash, 0, nil
+	}
+	if !bytes.HasPrefix(recv, []byte(confirmationRateField)) {
+		return nil, 0, makeError(0xEAE2C9, "unknown confirmation field")
+	}
+	rate, err = strconv.ParseInt(string(recv[len(confirmationRateField):]),
+		10, 64)
+	if err != nil || rate < 1 {
+		return nil, 0, makeError(0xEF5F62, "bad 'rate'")
+	}
+	return hash, rate, nil
+} //                                                            readConfirmation
+
+// end
@@ -0,0 +1,46 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[confirmation_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"testing"
+)
+
+// readConfirmation(recv []byte) (hash []byte, rate int64, err error)
+//
+// go test -run Test_readConfirmation_
+//
+func Test_readConfirmation_(t *testing.T) {
+	hash := getHash([]byte("abc"))
+	for _, want := range []int64{0, 1, 5000000} {
+		got, rate, err := readConfirmation(makeConfirmation(hash, want))
+		if err != nil || !bytes.Equal(got, hash) || rate != want {
+			t.Error("0xE7D67D", want, rate, err)
+		}
+	}
+	// a negative rate isn't advertised
+	if got := makeConfirmation(hash, -1); len(got) != len(tagConfirmation)+32 {
+		t.Error("0xEE5242", string(got))
+	}
+	test := func(recv, errSubstr string) {
+		_, _, err := readConfirmation([]byte(recv))
+		if !matchError(err, errSubstr) {
+			t.Error("0xE3C7D8", recv, "wrong error:", err)
+		}
+	}
+	sum := string(hash)
+	test("", "bad reply header")
+	test(tagNack+sum, "bad reply header")
+	test(tagConfirmation+sum[:31], "bad confirmed hash")
+	test(tagConfirmation+sum+"size:5", "unknown confirmation field")
+	test(tagConfirmation+sum+"rate:", "bad 'rate'")
+	test(tagConfirmation+sum+"rate:0", "bad 'rate'")
+	test(tagConfirmation+sum+"rate:-5", "bad 'rate'")
+	test(tagConfirmation+sum+"rate:5x", "bad 'rate'")
+}
+
+// end
@@ -13,4 +13,65 @@ const tagFragment = "FRAG:"
 // receiver confirming a tagFragment packet sent by the sender.
 const tagConfirmation = "CONF:"
 
+// tagNack prefixes a UDP packet sent by the receiver to the sender
+// when fragments of a data item have stopped arriving, listing the
+// pieces that are missing, so only those are sent again.
+const tagNack = "NACK:"
+
+// tagProbe prefixes a UDP packet sent by Diagnose() to check if the
+// receiver is reachable, and to measure round-trip time, MTU and loss.
+const tagProbe = "PING:"
+
+// tagProbeReply prefixes a UDP packet sent back by the
+// receiver to confirm that it received a tagProbe packet.
+const tagProbeReply = "PONG:"
+
+// tagHandshake prefixes the unencrypted UDP packets that a Sender and a
+// Receiver exchange to negotiate a session key, followed by the public
+// key of the end that sends it and, if they share a CryptoKey, a MAC made
+// with it. See Configuration.KeyExchange.
+const tagHandshake = "HELO:"
+
+// tagKeepalive prefixes a UDP packet that a Sender sends during a lull
+// in a transfer to keep NAT mappings open (see KeepaliveInterval), and
+// that Rendezvous() sends to punch a hole through the peer's NAT.
+// It needs no reply.
+const tagKeepalive = "KEEP:"
+
+// tagSequence prefixes the plaintext of each data packet that a Sender
+// encrypts, followed by the ID of the Sender's packet stream, the time
+// the packet is sent and its number in the stream, so that Receivers
+// can drop replayed packets. See Configuration.ReplayWindow.
+const tagSequence = "SEQN:"
+
+// tagMeet prefixes the unencrypted UDP packet that Rendezvous() sends
+// to a Coordinator, followed by the name of the session to join.
+const tagMeet = "MEET:"
+
+// tagPeer prefixes the unencrypted UDP packet with which a Coordinator
+// replies to tagMeet, followed by the public address of the other peer.
+const tagPeer = "PEER:"
+
+// packetHeaderReserve is the number of bytes in each packet reserved for
+// the fragment header, encryption nonce and authentication tag, i.e.
+// for everything apart from the data payload.
+const packetHeaderReserve = 200
+
+// compHashFieldSize is the number of bytes the hash of the compressed
+// data adds to each fragment header, when Config.HashCompressed is set.
+const compHashFieldSize = len("comp: ") + 64
+
+// ipUDPHeaderSize is the number of bytes taken up by the IP and UDP
+// headers of each datagram. It is big enough for IPv6 (40 + 8 bytes).
+const ipUDPHeaderSize = 48
+
+// defaultPacketSizeLimit is the default Configuration.PacketSizeLimit.
+// Receivers that accept larger packets advertise CapJumboPackets.
+const defaultPacketSizeLimit = 1450
+
+// minSafeDatagramSize is the largest UDP payload every IPv4 host must
+// accept without fragmentation (576 - 60 - 8 bytes). Packets bigger than
+// this count as "large" packets when tracking packet losses.
+const minSafeDatagramSize = 508
+
 // end
@@ -0,0 +1,87 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[cpu_pin_linux.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build linux
+
+package udpt
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// soIncomingCPU is the value of the SO_INCOMING_CPU socket
+// option, which the syscall package doesn't define.
+const soIncomingCPU = 49
+
+// cpuMask is a CPU affinity mask for sched_setaffinity(2),
+// with room for 1024 CPUs.
+type cpuMask [16]uint64
+
+// pinThread locks the calling goroutine to its OS thread and binds the
+// thread to CPU 'cpu'. Call the returned function, from the same
+// goroutine, to restore the thread's CPU affinity and unlock it.
+func pinThread(cpu int) (unpin func(), err error) {
+	var old, mask cpuMask
+	if cpu < 0 || cpu >= len(mask)*64 {
+		return nil, makeError(0xEB1253, "invalid CPU:", cpu)
+	}
+	mask[cpu/64] = 1 << (cpu % 64)
+	runtime.LockOSThread()
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY,
+		0, unsafe.Sizeof(old), uintptr(unsafe.Pointer(&old)))
+	if errno != 0 {
+		runtime.UnlockOSThread()
+		return nil, makeError(0xEB16FA, errno)
+	}
+	_, _, errno = syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY,
+		0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		runtime.UnlockOSThread()
+		return nil, makeError(0xE4095E, errno)
+	}
+	unpin = func() {
+		_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY,
+			0, unsafe.Sizeof(old), uintptr(unsafe.Pointer(&old)))
+		if errno != 0 {
+			// leave the thread locked, so that it exits with the
+			// goroutine instead of running others on one CPU
+			return
+		}
+		runtime.UnlockOSThread()
+	}
+	return unpin, nil
+} //                                                                   pinThread
+
+// setIncomingCPU sets the SO_INCOMING_CPU socket option of 'conn',
+// so that the kernel prefers to handle its packets on CPU 'cpu'.
+//
+// Does nothing if 'conn' is not backed by a socket (e.g. a mock).
+//
+func setIncomingCPU(conn netUDPConn, cpu int) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return makeError(0xE01440, err)
+	}
+	var errOpt error
+	err = raw.Control(func(fd uintptr) {
+		errOpt = syscall.SetsockoptInt(int(fd),
+			syscall.SOL_SOCKET, soIncomingCPU, cpu)
+	})
+	if err != nil {
+		return makeError(0xE5DDB3, err)
+	}
+	if errOpt != nil {
+		return makeError(0xE52B85, errOpt)
+	}
+	return nil
+} //                                                              setIncomingCPU
+
+// end
@@ -0,0 +1,77 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /[cpu_pin_linux_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build linux
+
+package udpt
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// getAffinity returns the CPU affinity mask of the calling thread.
+func getAffinity(t *testing.T) cpuMask {
+	var mask cpuMask
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY,
+		0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		t.Fatal("0xED3010", errno)
+	}
+	return mask
+}
+
+// pinThread(cpu int) (unpin func(), err error)
+//
+// go test -run Test_pinThread_
+//
+func Test_pinThread_(t *testing.T) {
+	before := getAffinity(t)
+	cpu := 0
+	for before[cpu/64]&(1<<(cpu%64)) == 0 {
+		cpu++ // the first CPU this process may run on
+	}
+	unpin, err := pinThread(cpu)
+	if err != nil {
+		t.Fatal("0xE9B019", err)
+	}
+	var want cpuMask
+	want[cpu/64] = 1 << (cpu % 64)
+	if got := getAffinity(t); got != want {
+		t.Error("0xEF78F9", got[0])
+	}
+	unpin()
+	if _, err := pinThread(-1); !matchError(err, "invalid CPU") {
+		t.Error("0xE9BCD7", "wrong error:", err)
+	}
+}
+
+// setIncomingCPU(conn netUDPConn, cpu int) error
+//
+// go test -run Test_setIncomingCPU_
+//
+func Test_setIncomingCPU_(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("0xEC6268", err)
+	}
+	defer conn.Close()
+	if err := setIncomingCPU(conn, 0); err != nil {
+		t.Error("0xEDDFE4", err)
+	}
+	raw, _ := conn.SyscallConn()
+	got := -1
+	_ = raw.Control(func(fd uintptr) {
+		got, _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET,
+			soIncomingCPU)
+	})
+	if got != 0 {
+		t.Error("0xE0487B", got)
+	}
+}
+
+// end
@@ -0,0 +1,22 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[cpu_pin_other.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build !linux
+
+package udpt
+
+// pinThread does nothing on this platform, since
+// threads can't be bound to a CPU portably.
+func pinThread(cpu int) (unpin func(), err error) {
+	return func() {}, nil
+} //                                                                   pinThread
+
+// setIncomingCPU does nothing on this platform,
+// which has no SO_INCOMING_CPU socket option.
+func setIncomingCPU(conn netUDPConn, cpu int) error {
+	return nil
+} //                                                              setIncomingCPU
+
+// end
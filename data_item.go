@@ -18,12 +18,28 @@ import (
 // Since we're using UDP, which has a limited packet size, the resource
 // is split into several smaller pieces that are sent as UDP packets.
 //
+// The pieces can arrive in any order and any number of times. Each piece
+// is stored in its slot by sequence number, so the assembled item doesn't
+// depend on the order of arrival, and duplicates are ignored.
+//
 type dataItem struct {
 	Key                  string
 	Hash                 []byte
+	CompHash             []byte // hash of the compressed data, if sent
+	Chunked              bool   // compressed in chunks, see compressChunks()
 	CompressedPieces     [][]byte
 	CompressedSizeInfo   int
 	UncompressedSizeInfo int
+
+	// layouts holds the pieces collected for other packet counts of the
+	// same item. A Sender splits an item into more, smaller pieces when
+	// the path MTU shrinks during a transfer, so retransmitted pieces can
+	// overlap pieces of the old layout that are still arriving.
+	layouts map[int][][]byte
+
+	// hasher makes the hashes that Hash and CompHash are checked
+	// against, or is nil for SHA-256 (see Configuration.Hasher)
+	hasher Hasher
 } //                                                                    dataItem
 
 // -----------------------------------------------------------------------------
@@ -61,51 +77,130 @@ func (di *dataItem) LogStats(tag string, w io.Writer) {
 	log(tag, "size:", di.UncompressedSizeInfo, "bytes")
 } //                                                                    LogStats
 
+// progress returns the number of compressed bytes collected so far, and
+// the length of the compressed value. Until the last piece has arrived,
+// the length is estimated from the size of the other pieces.
+func (di *dataItem) progress() (received, total int64) {
+	n := len(di.CompressedPieces)
+	if n == 0 {
+		return 0, 0
+	}
+	size := 0
+	for i, piece := range di.CompressedPieces {
+		received += int64(len(piece))
+		if i < n-1 && len(piece) > 0 {
+			size = len(piece)
+		}
+	}
+	if last := len(di.CompressedPieces[n-1]); last > 0 {
+		total = int64(n-1)*int64(size) + int64(last)
+	} else {
+		total = int64(n) * int64(size)
+	}
+	if total < received {
+		total = received
+	}
+	return received, total
+} //                                                                    progress
+
 // Reset discards the contents of the data item and clears its key and hash.
 func (di *dataItem) Reset() {
 	di.Key = ""
 	di.Hash = nil
+	di.CompHash = nil
+	di.Chunked = false
 	di.CompressedPieces = nil
 	di.CompressedSizeInfo = 0
 	di.UncompressedSizeInfo = 0
+	di.layouts = nil
 } //                                                                       Reset
 
 // Retain changes the Key, Hash, and empties CompressedPieces when the passed
 // key, hash and packetCount don't match their current values in the object.
+//
+// When only packetCount differs, the item is the same but has been split
+// differently, so the current pieces are put aside in 'layouts' and the
+// pieces already collected for 'packetCount' (if any) are restored.
+//
 func (di *dataItem) Retain(k string, hash []byte, packetCount int) {
-	if di.Key == k &&
-		bytes.Equal(di.Hash, hash) &&
-		len(di.CompressedPieces) == packetCount {
+	sameItem := di.Key == k && bytes.Equal(di.Hash, hash)
+	if sameItem && len(di.CompressedPieces) == packetCount {
+		return
+	}
+	if sameItem {
+		if di.layouts == nil {
+			di.layouts = make(map[int][][]byte)
+		}
+		di.layouts[len(di.CompressedPieces)] = di.CompressedPieces
+		pieces := di.layouts[packetCount]
+		delete(di.layouts, packetCount)
+		if pieces == nil {
+			pieces = make([][]byte, packetCount)
+		}
+		di.CompressedPieces = pieces
 		return
 	}
 	di.Key = k
 	di.Hash = hash
+	di.CompHash = nil
+	di.Chunked = false
 	di.CompressedPieces = make([][]byte, packetCount)
 	di.CompressedSizeInfo = 0
 	di.UncompressedSizeInfo = 0
+	di.layouts = nil
 } //                                                                      Retain
 
-// UnpackBytes joins CompressedPieces and uncompresses
-// the resulting bytes to get the original data item.
-func (di *dataItem) UnpackBytes(compressor Compression) ([]byte, error) {
-	//
-	// join pieces (provided all have been collected) to get compressed data
+// joinPieces returns the compressed value of the data item, joined from
+// its pieces. It checks the hash of the compressed value, if the Sender
+// sent it (see Configuration.HashCompressed).
+func (di *dataItem) joinPieces() ([]byte, error) {
 	if !di.IsLoaded() {
 		return nil, makeError(0xE76AF5, "data item is incomplete")
 	}
 	comp := bytes.Join(di.CompressedPieces, nil)
 	di.CompressedSizeInfo = len(comp)
 	//
+	// if the sender hashed the compressed data, check it before
+	// uncompressing, to tell where any corruption happened
+	if di.CompHash != nil &&
+		!bytes.Equal(hashWith(di.hasher, comp), di.CompHash) {
+		return nil, makeError(0xE0B3C9,
+			"compressed data hash mismatch (corrupted before uncompressing)")
+	}
+	return comp, nil
+} //                                                                  joinPieces
+
+// UnpackBytes joins CompressedPieces and uncompresses
+// the resulting bytes to get the original data item.
+// If the item is Chunked, up to 'workers' goroutines
+// uncompress its chunks in parallel.
+func (di *dataItem) UnpackBytes(compressor Compression, workers int,
+) ([]byte, error) {
+	//
+	// join pieces (provided all have been collected) to get compressed data
+	comp, err := di.joinPieces()
+	if err != nil {
+		return nil, err
+	}
 	// uncompress data
-	ret, err := compressor.Uncompress(comp)
+	var ret []byte
+	if di.Chunked {
+		ret, err = uncompressChunks(compressor, comp, workers)
+	} else {
+		ret, err = compressor.Uncompress(comp)
+	}
 	if err != nil {
 		return nil, makeError(0xE95DFB, err)
 	}
 	di.UncompressedSizeInfo = len(ret)
 	//
 	// hash of uncompressed data should match original hash
-	hash := getHash(ret)
+	hash := hashWith(di.hasher, ret)
 	if !bytes.Equal(hash, di.Hash) {
+		if di.CompHash != nil {
+			return nil, makeError(0xE1C25A,
+				"hash mismatch after uncompressing intact compressed data")
+		}
 		return nil, makeError(0xE87D89, "hash mismatch")
 	}
 	return ret, nil
@@ -72,6 +72,34 @@ func Test_dataItem_LogStats_(t *testing.T) {
 	}
 }
 
+// (di *dataItem) progress() (received, total int64)
+//
+// go test -run Test_dataItem_progress_
+//
+func Test_dataItem_progress_(t *testing.T) {
+	di := dataItem{CompressedPieces: make([][]byte, 4)}
+	for _, tc := range []struct {
+		index           int
+		piece           string
+		received, total int64
+	}{
+		{3, "x", 1, 1}, // the size of the other pieces isn't known yet
+		{1, "abc", 4, 10},
+		{0, "abc", 7, 10},
+		{2, "abc", 10, 10},
+	} {
+		di.CompressedPieces[tc.index] = []byte(tc.piece)
+		received, total := di.progress()
+		if received != tc.received || total != tc.total {
+			t.Error("0xEAFB8C", tc.index, received, total)
+		}
+	}
+	di.CompressedPieces[3] = nil
+	if received, total := di.progress(); received != 9 || total != 12 {
+		t.Error("0xEE9375", received, total)
+	}
+}
+
 // (di *dataItem) Reset()
 //
 // go test -run Test_dataItem_Reset_
@@ -154,13 +182,14 @@ func Test_dataItem_Retain_(t *testing.T) {
 	}
 	test("ItemName", []byte{6, 7, 8}, 2, want)
 	//
-	// 'packetCount' parameter changed
+	// 'packetCount' parameter changed: the pieces are put aside
 	want = dataItem{
 		Key:                  "ItemName",
 		Hash:                 []byte{1, 2, 3},
 		CompressedPieces:     [][]byte{nil},
-		CompressedSizeInfo:   0,
-		UncompressedSizeInfo: 0,
+		CompressedSizeInfo:   20,
+		UncompressedSizeInfo: 50,
+		layouts:              map[int][][]byte{2: {{6}, {7, 8}}},
 	}
 	test("ItemName", []byte{1, 2, 3}, 1, want)
 	//
@@ -173,10 +202,21 @@ func Test_dataItem_Retain_(t *testing.T) {
 		UncompressedSizeInfo: 0,
 	}
 	test("OtherName", []byte{4, 5, 6}, 3, want)
+	//
+	// switching back to the first packet count restores its pieces
+	di := initDataItem()
+	di.Retain("ItemName", []byte{1, 2, 3}, 1)
+	di.CompressedPieces[0] = []byte{9}
+	di.Retain("ItemName", []byte{1, 2, 3}, 2)
+	if !reflect.DeepEqual(di.CompressedPieces, [][]byte{{6}, {7, 8}}) ||
+		!reflect.DeepEqual(di.layouts, map[int][][]byte{1: {{9}}}) {
+		t.Error("0xE3D6F1", di.CompressedPieces, di.layouts)
+	}
 }
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
-// (di *dataItem) UnpackBytes(compressor Compression) ([]byte, error)
+// (di *dataItem) UnpackBytes(compressor Compression, workers int,
+// ) ([]byte, error)
 //
 // go test -run Test_dataItem_UnpackBytes_*
 
@@ -205,7 +245,7 @@ func Test_dataItem_UnpackBytes_1(t *testing.T) {
 	}
 	var di = dataItem{Hash: hash, CompressedPieces: compPieces}
 	// ------------------------------
-	uncomp, err := di.UnpackBytes(zc)
+	uncomp, err := di.UnpackBytes(zc, 1)
 	// ------------------------------
 	if err != nil {
 		t.Error("0xEF6D12", err)
@@ -228,7 +268,7 @@ func Test_dataItem_UnpackBytes_1(t *testing.T) {
 func Test_dataItem_UnpackBytes_2(t *testing.T) {
 	zc := &zlibCompressor{}
 	var di0 dataItem
-	data, err := di0.UnpackBytes(zc)
+	data, err := di0.UnpackBytes(zc, 1)
 	if data != nil {
 		t.Error("0xED52E6")
 	}
@@ -263,7 +303,7 @@ func Test_dataItem_UnpackBytes_3(t *testing.T) {
 	zc = &zlibCompressor{}
 	// ------------------------------
 	di.Hash = []byte{0} // <- this must cause it to fail
-	uncomp, err := di.UnpackBytes(zc)
+	uncomp, err := di.UnpackBytes(zc, 1)
 	// ------------------------------
 	if uncomp != nil {
 		t.Error("0xED14FA")
@@ -283,7 +323,7 @@ func Test_dataItem_UnpackBytes_4(t *testing.T) {
 		}},
 	}
 	zc := &zlibCompressor{}
-	uncomp, err := di.UnpackBytes(zc)
+	uncomp, err := di.UnpackBytes(zc, 1)
 	if uncomp != nil {
 		t.Error("0xE59B01")
 	}
@@ -292,4 +332,50 @@ func Test_dataItem_UnpackBytes_4(t *testing.T) {
 	}
 }
 
+// must tell apart corruption of the compressed data from
+// corruption by the compressor, when CompHash is specified
+func Test_dataItem_UnpackBytes_5(t *testing.T) {
+	source := []byte("The quick brown fox jumps over the lazy dog.")
+	zc := &zlibCompressor{}
+	comp, _ := zc.Compress(source)
+	newItem := func() *dataItem {
+		return &dataItem{
+			Hash:             getHash(source),
+			CompHash:         getHash(comp),
+			CompressedPieces: [][]byte{append([]byte(nil), comp...)},
+		}
+	}
+	di := newItem()
+	if data, err := di.UnpackBytes(zc, 1); err != nil ||
+		!bytes.Equal(data, source) {
+		t.Error("0xE92647", err)
+	}
+	di = newItem()
+	di.CompressedPieces[0][5]++
+	_, err := di.UnpackBytes(zc, 1)
+	if !matchError(err, "corrupted before uncompressing") {
+		t.Error("0xE381C7", "wrong error:", err)
+	}
+	di = newItem()
+	_, err = di.UnpackBytes(&corruptingCompressor{}, 1)
+	if !matchError(err, "after uncompressing intact compressed data") {
+		t.Error("0xECAA48", "wrong error:", err)
+	}
+}
+
+// corruptingCompressor is a Compression that
+// alters the data it uncompresses.
+type corruptingCompressor struct {
+	zlibCompressor
+}
+
+// Uncompress implements Compression.Uncompress().
+func (cc *corruptingCompressor) Uncompress(comp []byte) ([]byte, error) {
+	ret, err := cc.zlibCompressor.Uncompress(comp)
+	if len(ret) > 0 {
+		ret[0]++
+	}
+	return ret, err
+}
+
 // end
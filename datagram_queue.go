@@ -0,0 +1,131 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[datagram_queue.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// datagramQueue holds datagrams that arrive other than by reading a
+// socket, e.g. those dispatched to one side of a Peer, or the messages
+// of a ChannelTransport, until a connection reads them with a deadline.
+type datagramQueue struct {
+	queue  chan queuedDatagram // datagrams not read yet
+	wake   chan struct{}       // signalled when the read deadline changes
+	closed chan struct{}       // closed by close()
+	once   sync.Once           // closes 'closed'
+	mu     sync.Mutex          // protects 'dl'
+	dl     time.Time           // the read deadline
+} //                                                               datagramQueue
+
+// queuedDatagram is a datagram held in a datagramQueue.
+type queuedDatagram struct {
+	data []byte
+	addr net.Addr
+} //                                                              queuedDatagram
+
+// newDatagramQueue returns a datagramQueue that holds up to 'size'
+// datagrams. Further datagrams are dropped, like those that overflow
+// the receive buffer of a socket.
+func newDatagramQueue(size int) *datagramQueue {
+	return &datagramQueue{
+		queue:  make(chan queuedDatagram, size),
+		wake:   make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+} //                                                            newDatagramQueue
+
+// push queues a datagram, or drops it if the queue is full.
+func (dq *datagramQueue) push(data []byte, addr net.Addr) {
+	select {
+	case dq.queue <- queuedDatagram{data: data, addr: addr}:
+	default:
+	}
+} //                                                                        push
+
+// drain discards the queued datagrams.
+func (dq *datagramQueue) drain() {
+	for {
+		select {
+		case <-dq.queue:
+		default:
+			return
+		}
+	}
+} //                                                                       drain
+
+// close makes reads fail with net.ErrClosed.
+func (dq *datagramQueue) close() {
+	dq.once.Do(func() { close(dq.closed) })
+} //                                                                       close
+
+// isClosed returns true if close() has been called.
+func (dq *datagramQueue) isClosed() bool {
+	select {
+	case <-dq.closed:
+		return true
+	default:
+		return false
+	}
+} //                                                                    isClosed
+
+// read reads the next queued datagram into 'b', waiting until
+// one is queued or the read deadline passes.
+func (dq *datagramQueue) read(b []byte) (int, net.Addr, error) {
+	for {
+		dq.mu.Lock()
+		dl := dq.dl
+		dq.mu.Unlock()
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !dl.IsZero() {
+			wait := time.Until(dl)
+			if wait <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		var dg queuedDatagram
+		var err error
+		select {
+		case dg = <-dq.queue:
+		case <-dq.closed:
+			err = net.ErrClosed
+		case <-timeout:
+			err = os.ErrDeadlineExceeded
+		case <-dq.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+			continue
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		return copy(b, dg.data), dg.addr, nil
+	}
+} //                                                                        read
+
+// setReadDeadline sets the read deadline,
+// waking up a read in progress to apply it.
+func (dq *datagramQueue) setReadDeadline(t time.Time) {
+	dq.mu.Lock()
+	dq.dl = t
+	dq.mu.Unlock()
+	select {
+	case dq.wake <- struct{}{}:
+	default:
+	}
+} //                                                             setReadDeadline
+
+// end
@@ -0,0 +1,51 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[dead_letter.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"time"
+)
+
+// DeadLetter receives the data items that a Sender failed to deliver,
+// so that the application can persist them and replay them later,
+// instead of only getting an error returned by Send.
+//
+// Set Configuration.DeadLetter to use it.
+//
+type DeadLetter interface {
+
+	// Put is called once for every data item that could not be delivered,
+	// after the Sender has exhausted its retries or the Receiver has been
+	// reported unreachable. If Put returns an error, the Sender logs it.
+	//
+	// The item's Value is not copied, so Put must not
+	// retain it if the caller of Send may modify it.
+	//
+	Put(item *UndeliveredItem) error
+} //                                                                  DeadLetter
+
+// UndeliveredItem describes a data item a Sender failed to deliver.
+type UndeliveredItem struct {
+
+	// Address is the Receiver's address the item was sent to.
+	Address string
+
+	// Key and Value are the key and value that were passed to Send.
+	// To replay the item, pass them to Send again.
+	Key   string
+	Value []byte
+
+	// Reason is the error that Send returned.
+	Reason error
+
+	// Time is the time the Sender gave up delivering the item.
+	Time time.Time
+
+	// Stats contains the transfer statistics of the failed item.
+	Stats TransferStats
+} //                                                             UndeliveredItem
+
+// end
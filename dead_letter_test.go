@@ -0,0 +1,87 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[dead_letter_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_DeadLetter_*
+
+// -----------------------------------------------------------------------------
+
+// mockDeadLetter is a mock DeadLetter that collects undelivered items.
+type mockDeadLetter struct {
+	failPut bool
+	items   []*UndeliveredItem
+}
+
+// Put implements DeadLetter.
+func (mk *mockDeadLetter) Put(item *UndeliveredItem) error {
+	mk.items = append(mk.items, item)
+	if mk.failPut {
+		return makeError(0xEA3EFA, "failed Put")
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+// an item that can't be delivered must be given to Config.DeadLetter
+//
+// go test -run Test_DeadLetter_1
+//
+func Test_DeadLetter_1(t *testing.T) {
+	var dl mockDeadLetter
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:40487"
+	sd.Config.VerboseSender = false
+	sd.Config.DeadLetter = &dl
+	err := sd.SendString("greeting", "Hello World!")
+	if err == nil {
+		t.Fatal("0xEAE4AA")
+	}
+	if len(dl.items) != 1 {
+		t.Fatal("0xE184EC", len(dl.items))
+	}
+	it := dl.items[0]
+	if it.Address != "127.0.0.1:40487" || it.Key != "greeting" ||
+		string(it.Value) != "Hello World!" || it.Time.IsZero() {
+		t.Error("0xEBF4E1")
+	}
+	if !errors.Is(it.Reason, ErrReceiverUnreachable) {
+		t.Error("0xEB66B4", it.Reason)
+	}
+}
+
+// configuration errors must not be given to Config.DeadLetter,
+// while errors returned by DeadLetter.Put must be logged
+//
+// go test -run Test_DeadLetter_2
+//
+func Test_DeadLetter_2(t *testing.T) {
+	var tlog strings.Builder
+	dl := mockDeadLetter{failPut: true}
+	sd := makeTestSender()
+	sd.Config.VerboseSender = false
+	sd.Config.LogWriter = &tlog
+	sd.Config.DeadLetter = &dl
+	sd.Address = ""
+	_ = sd.SendString("greeting", "Hello World!")
+	if len(dl.items) != 0 {
+		t.Error("0xE0C643")
+	}
+	sd.Address = "127.0.0.1:40487"
+	_ = sd.SendString("greeting", "Hello World!")
+	if !strings.Contains(tlog.String(), "DeadLetter.Put: failed Put") {
+		t.Error("0xE6319C")
+	}
+}
+
+// end
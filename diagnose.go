@@ -0,0 +1,467 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                       /[diagnose.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diagnoseLossDuration is how long Diagnose() keeps sending probes
+// to measure packet loss. It's a variable so tests can shorten it.
+var diagnoseLossDuration = 5 * time.Second
+
+// diagnoseProbeInterval is the time between probes sent to measure loss
+const diagnoseProbeInterval = 50 * time.Millisecond
+
+// diagnoseProbeSize is the size in bytes of the (encrypted) probes used
+// to check reachability and measure loss. It is also the smallest
+// packet size tried when searching for the largest working packet.
+const diagnoseProbeSize = 64
+
+// Diagnosis is the report returned by Diagnose(). It describes the
+// results of the probes sent to a Receiver: whether it is reachable,
+// the round-trip time, the largest packet that gets through,
+// and the packet loss.
+type Diagnosis struct {
+
+	// Address is the address of the diagnosed Receiver
+	Address string
+
+	// KeyFingerprint is the fingerprint of the encryption key, which
+	// you can compare with the fingerprint logged by the Receiver
+	KeyFingerprint string
+
+	// KeyValid is true if the cipher accepted the
+	// encryption key and passed its self-test
+	KeyValid bool
+
+	// Reachable is true if the Receiver replied to a probe. Since probes
+	// are encrypted, this also means the Receiver has the same key.
+	Reachable bool
+
+	// RTT is the shortest round-trip time of the probes
+	RTT time.Duration
+
+	// MaxPacketSize is the size of the largest packet (i.e. encrypted
+	// UDP payload) the Receiver replied to. The path MTU is at least
+	// this size plus the size of the IP and UDP headers.
+	MaxPacketSize int
+
+	// ProbesSent and ProbesLost are the number of probes
+	// sent and left unanswered while measuring packet loss
+	ProbesSent int
+	ProbesLost int
+
+	// ClockOffset is how far the Receiver's clock is ahead of the
+	// Sender's clock (negative if it is behind), estimated from a
+	// probe's round-trip time. ClockKnown is false if the Receiver
+	// didn't report its time, e.g. because it is an older version.
+	ClockOffset time.Duration
+	ClockKnown  bool
+
+	// Problems lists the problems found, in plain language
+	Problems []string
+} //                                                                   Diagnosis
+
+// Diagnose creates a Sender and uses it to diagnose the connection
+// to the Receiver specified by address 'addr'. See Sender.Diagnose().
+//
+// config is an optional Configuration you can customize. If you leave it
+// out, Diagnose() will use the configuration returned by NewDefaultConfig().
+//
+func Diagnose(addr string, cryptoKey []byte, config ...*Configuration,
+) (*Diagnosis, error) {
+	if len(config) > 1 {
+		return nil, makeError(0xEAFDE7, "too many 'config' arguments")
+	}
+	var cf *Configuration
+	if len(config) == 1 {
+		cf = config[0]
+	}
+	if cf == nil {
+		cf = NewDefaultConfig()
+	}
+	sender := Sender{Address: addr, CryptoKey: cryptoKey, Config: cf}
+	return sender.Diagnose()
+} //                                                                    Diagnose
+
+// Diagnose runs a battery of probes against the Receiver at Sender.Address
+// and returns a report of the results. It validates the encryption key,
+// checks that the Receiver is reachable, measures the round-trip time,
+// searches for the largest packet size that gets through, and then
+// measures packet loss for 5 seconds.
+//
+// Returns an error (with a partly-filled report) only when the diagnosis
+// could not be carried out, e.g. when the key or address is invalid.
+// Problems found with the Receiver or the network are listed
+// in Diagnosis.Problems.
+//
+func (sd *Sender) Diagnose() (*Diagnosis, error) {
+	if sd.Config == nil {
+		sd.Config = NewDefaultConfig()
+	}
+	dg := &Diagnosis{Address: sd.Address, KeyFingerprint: sd.KeyFingerprint()}
+	err := sd.Config.Validate()
+	if err != nil {
+		return dg, sd.logError(0xEE832B, err)
+	}
+	err = sd.validateAddress()
+	if err != nil {
+		dg.problem(err)
+		return dg, sd.logError(0xE217DA, err)
+	}
+	err = sd.Config.Cipher.SetKey(sd.CryptoKey)
+	if err == nil {
+		err = cipherSelfTest(sd.Config.Cipher)
+	}
+	if err != nil {
+		dg.problem("invalid key:", err)
+		return dg, sd.logError(0xE684B3, "invalid Sender.CryptoKey:", err)
+	}
+	dg.KeyValid = true
+	conn, err := sd.connect()
+	if err != nil {
+		dg.problem("can't connect:", err)
+		return dg, err
+	}
+	err = setDontFragment(conn)
+	if err != nil && sd.Config.VerboseSender {
+		sd.logDebug("Don't Fragment bit not set:", err)
+	}
+	pr, err := newProber(conn, sd.Config.Cipher, sd.Config.PacketSizeLimit)
+	if err != nil {
+		_ = conn.Close()
+		return dg, sd.logError(0xE422DF, err)
+	}
+	defer pr.close()
+	//
+	// reachability and round-trip time
+	for i := 0; i < 3; i++ {
+		rtt, err := pr.ping(diagnoseProbeSize, sd.Config.ReplyTimeout)
+		if err == ErrReceiverUnreachable {
+			dg.problem("nothing is listening at", sd.Address)
+			return dg, nil
+		}
+		if err != nil {
+			continue
+		}
+		if !dg.Reachable || rtt < dg.RTT {
+			dg.RTT = rtt
+		}
+		dg.Reachable = true
+	}
+	if !dg.Reachable {
+		dg.problem("no reply from", sd.Address+": the receiver is down,",
+			"a firewall drops packets, or the receiver has another key")
+		return dg, nil
+	}
+	timeout := sd.probeTimeout(dg.RTT)
+	//
+	// clock skew
+	offset, err := pr.clockOffset(diagnoseProbeSize, timeout)
+	if err == nil {
+		dg.ClockOffset, dg.ClockKnown = offset, true
+		err = checkClockSkew(offset, sd.Config.MaxClockSkew)
+		if err != nil {
+			dg.problem(describeClockOffset(offset)+",",
+				"more than Configuration.MaxClockSkew;",
+				"synchronize the clocks, e.g. with NTP")
+		}
+	}
+	// largest working packet size
+	lo := pr.largestPacket(diagnoseProbeSize, sd.Config.PacketSizeLimit,
+		timeout)
+	dg.MaxPacketSize = lo
+	if lo < sd.Config.PacketSizeLimit {
+		dg.problem("packets larger than", lo, "bytes don't get through;",
+			"reduce Configuration.PacketSizeLimit")
+	}
+	// packet loss
+	var replies []<-chan struct{}
+	for t0 := time.Now(); time.Since(t0) < diagnoseLossDuration; {
+		done, err := pr.send(diagnoseProbeSize)
+		if err == nil {
+			replies = append(replies, done)
+		}
+		dg.ProbesSent++
+		time.Sleep(diagnoseProbeInterval)
+	}
+	deadline := time.After(timeout)
+wait:
+	for _, done := range replies {
+		select {
+		case <-done:
+		case <-deadline:
+			break wait
+		}
+	}
+	for _, done := range replies {
+		select {
+		case <-done:
+		default:
+			dg.ProbesLost++
+		}
+	}
+	dg.ProbesLost += dg.ProbesSent - len(replies)
+	if dg.ProbesLost > 0 {
+		dg.problem(fmt.Sprintf("%.1f%% packet loss", dg.Loss()*100))
+	}
+	return dg, nil
+} //                                                                    Diagnose
+
+// probeTimeout returns how long Diagnose() waits for the reply to a probe
+// once the round-trip time 'rtt' is known: long enough for a slow reply,
+// but no longer than Config.ReplyTimeout.
+func (sd *Sender) probeTimeout(rtt time.Duration) time.Duration {
+	ret := 100*time.Millisecond + 4*rtt
+	if ret > sd.Config.ReplyTimeout {
+		ret = sd.Config.ReplyTimeout
+	}
+	return ret
+} //                                                                probeTimeout
+
+// Loss returns the fraction (0 to 1) of probes that were lost
+func (dg *Diagnosis) Loss() float64 {
+	if dg.ProbesSent == 0 {
+		return 0
+	}
+	return float64(dg.ProbesLost) / float64(dg.ProbesSent)
+} //                                                                        Loss
+
+// String returns the report as human-readable text
+func (dg *Diagnosis) String() string {
+	var sb strings.Builder
+	yesNo := map[bool]string{true: "yes", false: "no"}
+	fmt.Fprintln(&sb, "address:        ", dg.Address)
+	fmt.Fprintln(&sb, "key fingerprint:", dg.KeyFingerprint)
+	fmt.Fprintln(&sb, "key valid:      ", yesNo[dg.KeyValid])
+	fmt.Fprintln(&sb, "reachable:      ", yesNo[dg.Reachable])
+	if dg.Reachable {
+		fmt.Fprintln(&sb, "round-trip time:", dg.RTT)
+		fmt.Fprintln(&sb, "max packet size:", dg.MaxPacketSize, "bytes")
+		fmt.Fprintf(&sb, "packet loss:     %.1f%% (%d of %d probes)\n",
+			dg.Loss()*100, dg.ProbesLost, dg.ProbesSent)
+		if dg.ClockKnown {
+			fmt.Fprintln(&sb, "clock offset:   ", dg.ClockOffset)
+		}
+	}
+	for _, s := range dg.Problems {
+		fmt.Fprintln(&sb, "problem:        ", s)
+	}
+	return sb.String()
+} //                                                                      String
+
+// problem adds a problem described by 'a' to the report
+func (dg *Diagnosis) problem(a ...interface{}) {
+	dg.Problems = append(dg.Problems, strings.TrimSpace(fmt.Sprintln(a...)))
+} //                                                                     problem
+
+// -----------------------------------------------------------------------------
+// # Prober
+
+// prober sends probe packets (tagProbe) through a UDP connection
+// and collects the replies (tagProbeReply) sent by the receiver.
+type prober struct {
+	conn     netUDPConn
+	cipher   SymmetricCipher
+	overhead int // number of bytes the cipher adds to each packet
+
+	mu      sync.Mutex
+	seq     int
+	pending map[string]*pendingProbe // by hash of the probe's plaintext
+
+	// failed is closed when the receiver turns out to be
+	// unreachable; err then holds ErrReceiverUnreachable
+	failed   chan struct{}
+	failOnce sync.Once
+	err      error
+} //                                                                      prober
+
+// pendingProbe is a probe sent by a prober, waiting for its reply.
+type pendingProbe struct {
+	done   chan struct{} // closed when the reply arrives
+	remote time.Time     // the Receiver's time, if the probe asked for it
+} //                                                                pendingProbe
+
+// newProber creates a prober that uses connection 'conn' and cipher
+// 'cphr', and starts reading replies of up to 'bufSize' bytes.
+func newProber(conn netUDPConn, cphr SymmetricCipher, bufSize int,
+) (*prober, error) {
+	ciphertext, err := cphr.Encrypt(nil)
+	if err != nil {
+		return nil, makeError(0xEB498D, err)
+	}
+	pr := &prober{
+		conn:     conn,
+		cipher:   cphr,
+		overhead: len(ciphertext),
+		pending:  make(map[string]*pendingProbe),
+		failed:   make(chan struct{}),
+	}
+	go pr.readReplies(bufSize)
+	return pr, nil
+} //                                                                   newProber
+
+// send sends a probe padded to 'size' bytes after encryption. Returns
+// a channel that is closed when the receiver's reply arrives.
+func (pr *prober) send(size int) (<-chan struct{}, error) {
+	pp, err := pr.sendProbe(size, false)
+	if err != nil {
+		return nil, err
+	}
+	return pp.done, nil
+} //                                                                        send
+
+// sendProbe sends a probe padded to 'size' bytes after encryption,
+// which asks for the receiver's time if 'askTime' is true.
+func (pr *prober) sendProbe(size int, askTime bool) (*pendingProbe, error) {
+	pr.mu.Lock()
+	pr.seq++
+	header := tagProbe + strconv.Itoa(pr.seq)
+	pr.mu.Unlock()
+	if askTime {
+		header += probeTimeField
+	}
+	plain := []byte(header + "\n")
+	if n := size - pr.overhead - len(plain); n > 0 {
+		plain = append(plain, make([]byte, n)...)
+	}
+	hash := string(getHash(plain))
+	pp := &pendingProbe{done: make(chan struct{})}
+	pr.mu.Lock()
+	pr.pending[hash] = pp
+	pr.mu.Unlock()
+	ciphertext, err := pr.cipher.Encrypt(plain)
+	if err == nil {
+		_, err = pr.conn.Write(ciphertext)
+	}
+	if err != nil {
+		pr.mu.Lock()
+		delete(pr.pending, hash)
+		pr.mu.Unlock()
+		return nil, err
+	}
+	return pp, nil
+} //                                                                   sendProbe
+
+// ping sends a probe of 'size' bytes and waits up to 'timeout' for its
+// reply. Returns the round-trip time, or an error if there was no reply.
+func (pr *prober) ping(size int, timeout time.Duration,
+) (time.Duration, error) {
+	t0 := time.Now()
+	done, err := pr.send(size)
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case <-done:
+		return time.Since(t0), nil
+	case <-pr.failed:
+		return 0, pr.err
+	case <-time.After(timeout):
+		return 0, errTimeout
+	}
+} //                                                                        ping
+
+// clockOffset sends a probe of 'size' bytes that asks for the receiver's
+// time, and waits up to 'timeout' for its reply. Returns how far the
+// receiver's clock is ahead of this machine's clock, assuming that the
+// reply took half of the round-trip time to arrive.
+func (pr *prober) clockOffset(size int, timeout time.Duration,
+) (time.Duration, error) {
+	t0 := time.Now()
+	pp, err := pr.sendProbe(size, true)
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case <-pp.done:
+	case <-pr.failed:
+		return 0, pr.err
+	case <-time.After(timeout):
+		return 0, errTimeout
+	}
+	rtt := time.Since(t0)
+	if pp.remote.IsZero() {
+		return 0, makeError(0xE1A6C3, "receiver didn't report its time")
+	}
+	return pp.remote.Sub(t0.Add(rtt / 2)), nil
+} //                                                                 clockOffset
+
+// largestPacket returns the size of the largest probe, from 'lo' to 'hi'
+// bytes, that gets a reply within 'timeout'. Probes of 'lo' bytes must
+// be known to get through. It does a binary search, in which each
+// size is tried twice before it is deemed too large.
+func (pr *prober) largestPacket(lo, hi int, timeout time.Duration) int {
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		_, err := pr.ping(mid, timeout)
+		if err != nil {
+			_, err = pr.ping(mid, timeout)
+		}
+		if err == nil {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+} //                                                               largestPacket
+
+// readReplies enters a loop that receives probe replies
+// and closes the matching channels returned by send().
+func (pr *prober) readReplies(bufSize int) {
+	buf := newReadBuffer(bufSize)
+	for {
+		// 'buf' is overwritten after every readAndDecrypt
+		recv, _, err := readAndDecrypt(pr.conn, time.Second, pr.cipher,
+			buf, bufSize)
+		if err == errClosed {
+			break
+		}
+		if err != nil {
+			ie := readICMPError(pr.conn)
+			if ie == nil {
+				ie = icmpErrorOf(err)
+			}
+			if ie != nil && ie.Unreachable() {
+				pr.fail(ErrReceiverUnreachable)
+			}
+			continue
+		}
+		hash, remote, err := readProbeReply(recv)
+		if err != nil {
+			continue
+		}
+		pr.mu.Lock()
+		pp := pr.pending[hash]
+		delete(pr.pending, hash)
+		pr.mu.Unlock()
+		if pp != nil {
+			pp.remote = remote
+			close(pp.done)
+		}
+	}
+} //                                                                 readReplies
+
+// fail marks the receiver as unreachable due to 'err'
+func (pr *prober) fail(err error) {
+	pr.failOnce.Do(func() {
+		pr.err = err
+		close(pr.failed)
+	})
+} //                                                                        fail
+
+// close closes the prober's connection, which ends readReplies()
+func (pr *prober) close() {
+	_ = pr.conn.Close()
+} //                                                                       close
+
+// end
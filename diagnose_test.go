@@ -0,0 +1,113 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[diagnose_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// (sd *Sender) Diagnose() (*Diagnosis, error)
+//
+// go test -run Test_Sender_Diagnose_*
+
+// a running receiver must be reachable, with no loss on the loopback
+func Test_Sender_Diagnose_1(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9879
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	defer func(d time.Duration) { diagnoseLossDuration = d }(
+		diagnoseLossDuration)
+	diagnoseLossDuration = 300 * time.Millisecond
+	//
+	sd := Sender{
+		Address:   "127.0.0.1:9879",
+		CryptoKey: rc.CryptoKey,
+		Config:    NewDefaultConfig(),
+	}
+	dg, err := sd.Diagnose()
+	if err != nil {
+		t.Error("0xEE4BD6", err)
+	}
+	if !dg.KeyValid || !dg.Reachable {
+		t.Error("0xEF5C83", dg)
+	}
+	if dg.RTT <= 0 {
+		t.Error("0xE62D61", dg.RTT)
+	}
+	if dg.MaxPacketSize != sd.Config.PacketSizeLimit {
+		t.Error("0xE18F7B", dg.MaxPacketSize)
+	}
+	if dg.ProbesSent < 2 || dg.ProbesLost != 0 || len(dg.Problems) != 0 {
+		t.Error("0xE8C8F5", dg)
+	}
+	// both ends share this machine's clock
+	if !dg.ClockKnown || dg.ClockOffset > dg.RTT || dg.ClockOffset < -dg.RTT {
+		t.Error("0xE7F0C2", dg.ClockKnown, dg.ClockOffset)
+	}
+}
+
+// must report an unreachable receiver
+func Test_Sender_Diagnose_2(t *testing.T) {
+	sd := makeTestSender()
+	dg, err := sd.Diagnose()
+	if err != nil {
+		t.Error("0xE26F52", err)
+	}
+	if !dg.KeyValid || dg.Reachable || len(dg.Problems) != 1 {
+		t.Error("0xE20F5B", dg)
+	}
+}
+
+// must fail with an invalid key
+func Test_Sender_Diagnose_3(t *testing.T) {
+	sd := makeTestSender()
+	sd.CryptoKey = []byte("too short")
+	dg, err := sd.Diagnose()
+	if !matchError(err, "invalid Sender.CryptoKey") {
+		t.Error("0xE34030", "wrong error:", err)
+	}
+	if dg.KeyValid || dg.Reachable {
+		t.Error("0xEAF792", dg)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// (dg *Diagnosis) String() string
+//
+// go test -run Test_Diagnosis_String_
+
+func Test_Diagnosis_String_(t *testing.T) {
+	dg := &Diagnosis{
+		Address:       "127.0.0.1:9876",
+		KeyValid:      true,
+		Reachable:     true,
+		RTT:           time.Millisecond,
+		MaxPacketSize: 1450,
+		ProbesSent:    100,
+		ProbesLost:    5,
+		Problems:      []string{"5.0% packet loss"},
+	}
+	s := dg.String()
+	for _, want := range []string{
+		"reachable:       yes",
+		"round-trip time: 1ms",
+		"max packet size: 1450 bytes",
+		"packet loss:     5.0% (5 of 100 probes)",
+		"problem:         5.0% packet loss",
+	} {
+		if !strings.Contains(s, want) {
+			t.Error("0xEB0E3F", "missing:", want, "in:\n"+s)
+		}
+	}
+}
+
+// end
@@ -0,0 +1,226 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[dir_watcher.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DirWatcher monitors a directory and sends each new or changed file in
+// it (and its subdirectories) as a data item, once the file has stopped
+// changing. The key of each item is Prefix followed by the file's path
+// within Dir, with forward slashes. On the other end, a FileWriter
+// with a FileRoute with the same Prefix writes the files, e.g.:
+//
+//	dw := udpt.DirWatcher{Dir: "outbox", Prefix: "outbox/", Sender: &sd}
+//	err := dw.Run(ctx)
+//
+// It polls the directory at every Interval, so it doesn't depend on
+// the file system's change notifications and works the same way on
+// every platform and on network drives.
+//
+type DirWatcher struct {
+
+	// Dir is the directory being watched.
+	Dir string
+
+	// Sender sends the files.
+	Sender *Sender
+
+	// Prefix is prepended to the keys of the data items sent.
+	Prefix string
+
+	// Interval is the time between scans of Dir. Zero means 1 second.
+	Interval time.Duration
+
+	// Debounce is how long a file must stay unchanged before it is
+	// sent, so files that are still being written aren't sent
+	// half-way. Zero means 2 seconds.
+	Debounce time.Duration
+
+	// Ignore holds patterns in the syntax of filepath.Match. Files and
+	// directories whose names match any of them are not sent, e.g.
+	// "*.tmp" or "~*". Names that begin with a dot are always ignored,
+	// like the temporary files of FileWriter.
+	Ignore []string
+
+	// SkipExisting makes Run() only send the files created or changed
+	// after it starts, not those already in Dir.
+	SkipExisting bool
+
+	// OnError, if specified, is called when a file can't be read or
+	// sent. The file is retried at the next scan, unless it changes.
+	OnError func(name string, err error)
+
+	// -------------------------------------------------------------------------
+
+	// files holds the state of each file seen, by its path within Dir
+	files map[string]*watchedFile
+} //                                                                  DirWatcher
+
+// watchedFile is the state of a file in a DirWatcher's directory.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+
+	// changed is when the change to the file was first noticed
+	changed time.Time
+
+	// sent is true once the current version of the file was sent
+	sent bool
+
+	// seen is false if the file wasn't found in the latest scan
+	seen bool
+} //                                                                 watchedFile
+
+// Run watches Dir and sends its new and changed files until context
+// 'ctx' is done, then returns the context's error.
+// Returns an error without watching if Dir can't be read.
+func (dw *DirWatcher) Run(ctx context.Context) error {
+	if dw.Sender == nil {
+		return makeError(0xED2938, "nil DirWatcher.Sender")
+	}
+	info, err := os.Stat(dw.Dir)
+	if err != nil {
+		return makeError(0xEDDCE2, err)
+	}
+	if !info.IsDir() {
+		return makeError(0xEB1AB7, "not a directory:", dw.Dir)
+	}
+	interval := dw.Interval
+	if interval <= 0 {
+		interval = 1 * time.Second
+	}
+	dw.files = make(map[string]*watchedFile)
+	if dw.SkipExisting {
+		dw.scan(time.Now())
+		for _, wf := range dw.files {
+			wf.sent = true
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		dw.scan(time.Now())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+} //                                                                         Run
+
+// scan walks Dir, notes the files that have changed since the previous
+// scan, and sends those that have stayed unchanged for Debounce.
+func (dw *DirWatcher) scan(now time.Time) {
+	if dw.files == nil {
+		dw.files = make(map[string]*watchedFile)
+	}
+	debounce := dw.Debounce
+	if debounce <= 0 {
+		debounce = 2 * time.Second
+	}
+	for _, wf := range dw.files {
+		wf.seen = false
+	}
+	_ = filepath.WalkDir(dw.Dir, func(
+		path string, de fs.DirEntry, err error,
+	) error {
+		if err != nil {
+			dw.fail(path, makeError(0xE084E2, err))
+			return nil
+		}
+		if path == dw.Dir {
+			return nil
+		}
+		if dw.ignored(de.Name()) {
+			if de.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !de.Type().IsRegular() {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return nil // removed during the scan
+		}
+		rel, _ := filepath.Rel(dw.Dir, path)
+		wf := dw.files[rel]
+		if wf == nil || wf.size != info.Size() ||
+			!wf.modTime.Equal(info.ModTime()) {
+			wf = &watchedFile{
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				changed: now,
+			}
+			dw.files[rel] = wf
+		}
+		wf.seen = true
+		if !wf.sent && now.Sub(wf.changed) >= debounce {
+			wf.sent = dw.send(rel, path)
+		}
+		return nil
+	})
+	for rel, wf := range dw.files {
+		if !wf.seen {
+			delete(dw.files, rel)
+		}
+	}
+} //                                                                        scan
+
+// send reads the file at 'path' and sends it with the key made from
+// its path 'rel' within Dir. Returns true if the file was sent.
+func (dw *DirWatcher) send(rel, path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		dw.fail(path, makeError(0xEC7CA4, err))
+		return false
+	}
+	err = dw.Sender.Send(dw.Prefix+filepath.ToSlash(rel), data)
+	if err != nil {
+		dw.fail(path, makeError(0xEBF5B7, err))
+		return false
+	}
+	return true
+} //                                                                        send
+
+// ignored returns true if files or directories named 'name'
+// must not be sent: hidden names, and those matching Ignore.
+func (dw *DirWatcher) ignored(name string) bool {
+	return ignoredName(name, dw.Ignore)
+} //                                                                     ignored
+
+// ignoredName returns true if files or directories named 'name' must
+// not be sent from a directory: names that begin with a dot, like the
+// temporary files of FileWriter, and those matching any of 'patterns'
+// (in the syntax of filepath.Match).
+func ignoredName(name string, patterns []string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	for _, pattern := range patterns {
+		if match, _ := filepath.Match(pattern, name); match {
+			return true
+		}
+	}
+	return false
+} //                                                                 ignoredName
+
+// fail passes the error 'err' concerning file 'name' to OnError.
+func (dw *DirWatcher) fail(name string, err error) {
+	if dw.OnError != nil {
+		dw.OnError(name, err)
+	}
+} //                                                                        fail
+
+// end
@@ -0,0 +1,125 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[dir_watcher_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// (dw *DirWatcher) scan(now time.Time)
+//
+// go test -run Test_DirWatcher_scan_
+//
+func Test_DirWatcher_scan_(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal("0xE49414", err)
+		}
+	}
+	var sent []string
+	sd := makeTestSender()
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive: func(k string, v []byte) error {
+			sent = append(sent, k+"="+string(v))
+			return nil
+		},
+	}
+	dw := DirWatcher{
+		Dir: dir, Sender: sd, Prefix: "in/",
+		Debounce: time.Second, Ignore: []string{"*.tmp", "skip"},
+	}
+	test := func(now time.Time, want ...string) {
+		t.Helper()
+		dw.scan(now)
+		sort.Strings(sent)
+		if strings.Join(sent, " ") != strings.Join(want, " ") {
+			t.Error("0xE3F358", sent, "want:", want)
+		}
+		sent = nil
+	}
+	write("a.txt", "1")
+	write("sub/b.txt", "2")
+	write("c.tmp", "3")
+	write(".d.txt", "4")
+	write("skip/e.txt", "5")
+	t0 := time.Now()
+	//
+	// files are only sent once they stop changing
+	test(t0)
+	test(t0.Add(time.Second), "in/a.txt=1", "in/sub/b.txt=2")
+	test(t0.Add(2 * time.Second))
+	//
+	// a changed file is sent again
+	write("a.txt", "11")
+	test(t0.Add(3 * time.Second))
+	test(t0.Add(4*time.Second), "in/a.txt=11")
+	//
+	// a removed file is forgotten, so it is sent if it comes back
+	_ = os.Remove(filepath.Join(dir, "sub", "b.txt"))
+	test(t0.Add(5 * time.Second))
+	if len(dw.files) != 1 {
+		t.Error("0xE7A95C", len(dw.files))
+	}
+	write("sub/b.txt", "2")
+	test(t0.Add(6 * time.Second))
+	test(t0.Add(7*time.Second), "in/sub/b.txt=2")
+}
+
+// (dw *DirWatcher) Run(ctx context.Context) error
+//
+// go test -run Test_DirWatcher_Run_
+//
+func Test_DirWatcher_Run_(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "old"), []byte("x"), 0644)
+	sd := makeTestSender()
+	received := make(chan string, 2)
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive: func(k string, v []byte) error {
+			received <- k
+			return nil
+		},
+	}
+	dw := DirWatcher{
+		Dir: dir, Sender: sd, SkipExisting: true,
+		Interval: 10 * time.Millisecond, Debounce: 10 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- dw.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	_ = os.WriteFile(filepath.Join(dir, "new"), []byte("y"), 0644)
+	select {
+	case k := <-received:
+		if k != "new" {
+			t.Error("0xE22194", "sent existing file:", k)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("0xEE17DD", "not sent")
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Error("0xE8346D", "wrong error:", err)
+	}
+	dw.Dir = filepath.Join(dir, "missing")
+	if err := dw.Run(context.Background()); err == nil {
+		t.Error("0xED97C9", "watched a missing directory")
+	}
+}
+
+// end
@@ -0,0 +1,292 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                       /dtls/[dtls.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// Package dtls provides a udpt Transport that carries the packets of
+// Senders and Receivers in DTLS 1.2 (RFC 6347), using pion/dtls, for
+// environments that mandate standardized transport security. Packets
+// are still encrypted with Configuration.Cipher inside DTLS.
+//
+// Assign it to Configuration.Transport on both the Sender and the
+// Receiver, with certificates or a pre-shared key in Config:
+//
+//	cf := udpt.NewDefaultConfig()
+//	cf.Transport = &dtls.Transport{Config: &piondtls.Config{
+//		Certificates: []tls.Certificate{cert},
+//	}}
+//
+// Each Sender connection makes a DTLS handshake with the Receiver when
+// it connects. DTLS adds about 40 bytes to each packet, so reduce
+// Configuration.PacketSizeLimit by as much to avoid IP fragmentation.
+//
+package dtls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/balacode/udpt"
+	piondtls "github.com/pion/dtls/v3"
+)
+
+// maxDatagramSize is the size of the buffer into which
+// the Receiver's connections read each DTLS record.
+const maxDatagramSize = 65535
+
+// Transport implements udpt.Transport using DTLS 1.2.
+type Transport struct {
+
+	// Config is the DTLS configuration, with the certificates or the
+	// pre-shared key (PSK) that authenticate the peers. Senders use it
+	// as clients, Receivers as servers. It must not be nil.
+	Config *piondtls.Config
+
+	// HandshakeTimeout is the longest time a DTLS handshake may take.
+	// Zero means 10 seconds.
+	HandshakeTimeout time.Duration
+
+	// IdleTimeout is how long a Receiver keeps the DTLS connection of a
+	// Sender that has stopped sending packets. Senders that send again
+	// after that make a new handshake. Zero means 10 minutes.
+	IdleTimeout time.Duration
+} //                                                                   Transport
+
+var _ udpt.Transport = (*Transport)(nil)
+
+// Dial implements udpt.Transport.Dial(): it connects to the Receiver
+// at 'raddr' and completes the DTLS handshake.
+func (tr *Transport) Dial(network string, laddr, raddr *net.UDPAddr,
+) (net.Conn, error) {
+	if tr.Config == nil {
+		return nil, errors.New("dtls: nil Transport.Config")
+	}
+	pc, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := piondtls.Client(pc, raddr, tr.Config)
+	if err != nil {
+		_ = pc.Close()
+		return nil, fmt.Errorf("dtls: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(),
+		tr.handshakeTimeout())
+	defer cancel()
+	err = conn.HandshakeContext(ctx)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("dtls: handshake with %s: %w", raddr, err)
+	}
+	return conn, nil
+} //                                                                        Dial
+
+// Listen implements udpt.Transport.Listen(): it accepts DTLS connections
+// from Senders at 'laddr', and returns a net.PacketConn from which the
+// Receiver reads the packets of all of them.
+func (tr *Transport) Listen(network string, laddr *net.UDPAddr,
+) (net.PacketConn, error) {
+	if tr.Config == nil {
+		return nil, errors.New("dtls: nil Transport.Config")
+	}
+	ln, err := piondtls.Listen(network, laddr, tr.Config)
+	if err != nil {
+		return nil, err
+	}
+	pl := &packetListener{
+		tr:      tr,
+		ln:      ln,
+		packets: make(chan packet, 256),
+		conns:   make(map[string]net.Conn),
+		closed:  make(chan struct{}),
+	}
+	go pl.accept()
+	return pl, nil
+} //                                                                      Listen
+
+// handshakeTimeout returns HandshakeTimeout, or its default.
+func (tr *Transport) handshakeTimeout() time.Duration {
+	if tr.HandshakeTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return tr.HandshakeTimeout
+} //                                                            handshakeTimeout
+
+// idleTimeout returns IdleTimeout, or its default.
+func (tr *Transport) idleTimeout() time.Duration {
+	if tr.IdleTimeout <= 0 {
+		return 10 * time.Minute
+	}
+	return tr.IdleTimeout
+} //                                                                 idleTimeout
+
+// -----------------------------------------------------------------------------
+
+// packet is a datagram received from a Sender's DTLS connection.
+type packet struct {
+	data []byte
+	addr net.Addr
+} //                                                                      packet
+
+// packetListener is the net.PacketConn returned by Listen(). It
+// accepts the DTLS connections of Senders, each read by its own
+// goroutine, and replies to each Sender on its connection.
+type packetListener struct {
+	tr       *Transport
+	ln       net.Listener
+	packets  chan packet
+	mu       sync.Mutex
+	conns    map[string]net.Conn // by remote address
+	deadline time.Time
+	closed   chan struct{}
+	once     sync.Once
+} //                                                              packetListener
+
+// ReadFrom implements net.PacketConn.ReadFrom(). It returns
+// os.ErrDeadlineExceeded when the read deadline passes,
+// and net.ErrClosed once the listener is closed.
+func (pl *packetListener) ReadFrom(b []byte) (int, net.Addr, error) {
+	pl.mu.Lock()
+	deadline := pl.deadline
+	pl.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case pk := <-pl.packets:
+		n := copy(b, pk.data)
+		if n < len(pk.data) {
+			n = len(b) // the caller detects truncation as len(b)
+		}
+		return n, pk.addr, nil
+	case <-pl.closed:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+} //                                                                    ReadFrom
+
+// WriteTo implements net.PacketConn.WriteTo(), writing 'b'
+// to the DTLS connection of the Sender at 'addr'.
+func (pl *packetListener) WriteTo(b []byte, addr net.Addr) (int, error) {
+	pl.mu.Lock()
+	conn := pl.conns[addr.String()]
+	pl.mu.Unlock()
+	if conn == nil {
+		return 0, fmt.Errorf("dtls: no connection from %s", addr)
+	}
+	return conn.Write(b)
+} //                                                                     WriteTo
+
+// Close implements net.PacketConn.Close(), closing
+// the listener and the connections of all Senders.
+func (pl *packetListener) Close() error {
+	var err error
+	pl.once.Do(func() {
+		close(pl.closed)
+		err = pl.ln.Close()
+		pl.mu.Lock()
+		for k, conn := range pl.conns {
+			_ = conn.Close()
+			delete(pl.conns, k)
+		}
+		pl.mu.Unlock()
+	})
+	return err
+} //                                                                       Close
+
+// LocalAddr implements net.PacketConn.LocalAddr().
+func (pl *packetListener) LocalAddr() net.Addr {
+	return pl.ln.Addr()
+} //                                                                   LocalAddr
+
+// SetDeadline implements net.PacketConn.SetDeadline().
+// Only the read deadline is used.
+func (pl *packetListener) SetDeadline(t time.Time) error {
+	return pl.SetReadDeadline(t)
+} //                                                                 SetDeadline
+
+// SetReadDeadline implements net.PacketConn.SetReadDeadline().
+// It applies to the calls of ReadFrom() made after it.
+func (pl *packetListener) SetReadDeadline(t time.Time) error {
+	pl.mu.Lock()
+	pl.deadline = t
+	pl.mu.Unlock()
+	return nil
+} //                                                             SetReadDeadline
+
+// SetWriteDeadline implements net.PacketConn.SetWriteDeadline().
+// It does nothing, since writes to DTLS connections don't block.
+func (pl *packetListener) SetWriteDeadline(t time.Time) error {
+	return nil
+} //                                                            SetWriteDeadline
+
+// accept accepts the connections of Senders until the listener is closed.
+func (pl *packetListener) accept() {
+	for {
+		conn, err := pl.ln.Accept()
+		if err != nil {
+			select {
+			case <-pl.closed:
+				return
+			default:
+				continue // e.g. refused by Config.OnConnectionAttempt
+			}
+		}
+		go pl.serve(conn)
+	}
+} //                                                                      accept
+
+// serve completes the handshake of the Sender's connection 'conn', then
+// passes the packets read from it to ReadFrom(), until the connection
+// fails, is closed by the Sender, or is idle for IdleTimeout.
+func (pl *packetListener) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(),
+		pl.tr.handshakeTimeout())
+	err := conn.(*piondtls.Conn).HandshakeContext(ctx)
+	cancel()
+	if err != nil {
+		return
+	}
+	addr := conn.RemoteAddr()
+	k := addr.String()
+	pl.mu.Lock()
+	if old := pl.conns[k]; old != nil {
+		_ = old.Close() // the Sender has reconnected from the same port
+	}
+	pl.conns[k] = conn
+	pl.mu.Unlock()
+	defer func() {
+		pl.mu.Lock()
+		if pl.conns[k] == conn {
+			delete(pl.conns, k)
+		}
+		pl.mu.Unlock()
+	}()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(pl.tr.idleTimeout()))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		select {
+		case pl.packets <- packet{data: data, addr: addr}:
+		case <-pl.closed:
+			return
+		}
+	}
+} //                                                                       serve
+
+// end
@@ -0,0 +1,85 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /dtls/[dtls_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package dtls
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/balacode/udpt"
+	piondtls "github.com/pion/dtls/v3"
+)
+
+// pskConfig returns a DTLS configuration with pre-shared key 'psk'.
+func pskConfig(psk string) *piondtls.Config {
+	return &piondtls.Config{
+		PSK:             func([]byte) ([]byte, error) { return []byte(psk), nil },
+		PSKIdentityHint: []byte("udpt"),
+		CipherSuites: []piondtls.CipherSuiteID{
+			piondtls.TLS_PSK_WITH_AES_128_GCM_SHA256,
+		},
+	}
+}
+
+// (tr *Transport) Dial(network string, laddr, raddr *net.UDPAddr,
+// ) (net.Conn, error)
+//
+// (tr *Transport) Listen(network string, laddr *net.UDPAddr,
+// ) (net.PacketConn, error)
+//
+// go test -run Test_Transport_
+//
+// must deliver data items over DTLS, and fail to
+// connect to a Receiver with another pre-shared key
+func Test_Transport_(t *testing.T) {
+	cryptoKey := []byte("0123456789abcdefghijklmnopqrst12")
+	received := make(chan []byte, 1)
+	rc := udpt.Receiver{
+		Port:      9861,
+		CryptoKey: cryptoKey,
+		Config:    udpt.NewDefaultConfig(),
+		Receive: func(k string, v []byte) error {
+			received <- v
+			return nil
+		},
+	}
+	rc.Config.Transport = &Transport{Config: pskConfig("secret")}
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	newSender := func(psk string) *udpt.Sender {
+		cf := udpt.NewDefaultConfig()
+		cf.SendRetries = 1
+		cf.ReplyTimeout = 500 * time.Millisecond
+		cf.Transport = &Transport{
+			Config:           pskConfig(psk),
+			HandshakeTimeout: 2 * time.Second,
+		}
+		return &udpt.Sender{Address: "127.0.0.1:9861", CryptoKey: cryptoKey,
+			Config: cf}
+	}
+	value := bytes.Repeat([]byte("DTLS "), 2000)
+	if err := newSender("secret").Send("key", value); err != nil {
+		t.Fatal("0xE5D8A3", err)
+	}
+	select {
+	case got := <-received:
+		if !bytes.Equal(got, value) {
+			t.Error("0xE2A6F9", "wrong value received")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("0xE8B3C4", "item not received")
+	}
+	// must fail when the handshake fails
+	err := newSender("wrong").Send("key", value)
+	if err == nil {
+		t.Error("0xE1F7D6", "sent with the wrong pre-shared key")
+	}
+}
+
+// end
@@ -0,0 +1,25 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                       /dtls/[go.mod]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// The DTLS transport is a separate module, so that udpt itself
+// keeps using only the standard library.
+module github.com/balacode/udpt/dtls
+
+go 1.21
+
+require (
+	github.com/balacode/udpt v0.0.0
+	github.com/pion/dtls/v3 v3.0.7
+)
+
+require (
+	github.com/pion/logging v0.2.4 // indirect
+	github.com/pion/transport/v3 v3.0.7 // indirect
+	golang.org/x/crypto v0.32.0 // indirect
+)
+
+replace github.com/balacode/udpt => ../
+
+// end
@@ -0,0 +1,62 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                         /[errors.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+)
+
+// ErrReceiverUnreachable is returned by Send when the network reports
+// that the Receiver can't be reached, for example when an ICMP "port
+// unreachable" message shows that nothing is listening at Sender.Address.
+//
+// Send returns this error as soon as it is reported, instead of
+// waiting for Config.ReplyTimeout to expire on every retry.
+//
+var ErrReceiverUnreachable = errors.New("receiver unreachable")
+
+// ErrUndeliveredPackets is returned by Send when some packets of a data
+// item were still not confirmed after Config.SendRetries attempts.
+var ErrUndeliveredPackets = errors.New("undelivered packets")
+
+// ErrNoFirstReply is returned by Send when no packet of a data item
+// was confirmed within Config.FirstReplyTimeout after sending began.
+var ErrNoFirstReply = errors.New("no reply from receiver")
+
+// ErrTransferStalled is returned by Send when a data item's transfer
+// had begun, but no further packets were confirmed for the duration
+// of Config.StallTimeout.
+var ErrTransferStalled = errors.New("transfer stalled")
+
+// ErrItemTimeout is returned by Send when a data item was not delivered
+// within Config.ItemTimeout, including the time spent on item retries.
+var ErrItemTimeout = errors.New("item timeout")
+
+// ErrItemStale is returned by Send when the retransmissions of a data
+// item were dropped because it had become stale, according to
+// Config.Staleness with Drop enabled.
+var ErrItemStale = errors.New("item stale")
+
+// ErrTransferCancelled is returned by Send when the data item's transfer
+// has been cancelled by Sender.CancelAll(). The writers returned by
+// Receiver.ReceiveStream are closed with an error that wraps it when
+// Receiver.CancelAll() cancels their data items.
+var ErrTransferCancelled = errors.New("transfer cancelled")
+
+// ErrProtocolVersion is returned by Send when the Receiver's protocol
+// version is outside the range from MinProtocolVersion to
+// ProtocolVersion. Receivers likewise refuse such Senders. The
+// versions are exchanged in the Config.KeyExchange handshake.
+var ErrProtocolVersion = errors.New("unsupported protocol version")
+
+// ErrClockSkew is reported when a peer's clock differs from this
+// machine's clock by more than Config.MaxClockSkew, so that times
+// exchanged with the peer can't be trusted. Sender.Diagnose() lists
+// it in Diagnosis.Problems, and an authenticated key exchange fails
+// with it (see Configuration.KeyExchange).
+var ErrClockSkew = errors.New("clock skew too large")
+
+// end
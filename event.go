@@ -0,0 +1,89 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                          /[event.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+// EventKind identifies the kind of an Event.
+type EventKind int
+
+const (
+	// PeerVerified occurs the first time packets from a new source
+	// address, or one idle for Config.ItemExpiry, are decrypted
+	// successfully, which proves that the peer at that address
+	// knows the encryption key.
+	PeerVerified EventKind = iota + 1
+
+	// Rebound occurs when Receiver.Rebind() has moved the Receiver
+	// to a new address. Event.Addr holds the new local address.
+	Rebound
+
+	// OversizedPacket occurs when a datagram longer than
+	// Config.PacketSizeLimit arrives. It is dropped, since it
+	// can't be read whole. This is a sign of a misconfigured
+	// peer, or of someone probing the Receiver.
+	OversizedPacket
+
+	// Unauthorized occurs when a fragment arrives from a Sender
+	// that isn't listed in Receiver.AuthTokens, or that fails
+	// authentication. The fragment is rejected.
+	Unauthorized
+
+	// ReplayedPacket occurs when a packet arrives that the Receiver
+	// has already received, i.e. it has been captured and replayed.
+	// It is dropped. See Configuration.ReplayWindow.
+	ReplayedPacket
+
+	// SlowHandler occurs when the Receiver's callback hasn't returned
+	// for a data item within Configuration.HandlerTimeout. Event.Key
+	// holds the item's key. See Configuration.DetachSlowHandlers.
+	SlowHandler
+)
+
+// String returns the name of the event kind, e.g. "PeerVerified".
+func (kind EventKind) String() string {
+	switch kind {
+	case PeerVerified:
+		return "PeerVerified"
+	case Rebound:
+		return "Rebound"
+	case OversizedPacket:
+		return "OversizedPacket"
+	case Unauthorized:
+		return "Unauthorized"
+	case ReplayedPacket:
+		return "ReplayedPacket"
+	case SlowHandler:
+		return "SlowHandler"
+	}
+	return "EventKind(" + strconv.Itoa(int(kind)) + ")"
+} //                                                                      String
+
+// -----------------------------------------------------------------------------
+
+// Event describes something notable that happened in a Receiver.
+// Receivers pass events to the Receiver.OnEvent callback.
+type Event struct {
+
+	// Kind specifies what happened.
+	Kind EventKind
+
+	// Addr is the address of the peer the event relates to,
+	// or the Receiver's own address for a Rebound event.
+	Addr net.Addr
+
+	// Key is the key of the data item the event relates to, if any.
+	Key string
+
+	// Time is the time the event occurred.
+	Time time.Time
+} //                                                                       Event
+
+// end
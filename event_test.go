@@ -0,0 +1,37 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[event_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"testing"
+)
+
+// (kind EventKind) String() string
+//
+// go test -run Test_EventKind_String_
+//
+func Test_EventKind_String_(t *testing.T) {
+	if s := PeerVerified.String(); s != "PeerVerified" {
+		t.Error("0xE79E64", s)
+	}
+	if s := Rebound.String(); s != "Rebound" {
+		t.Error("0xE0EBE4", s)
+	}
+	if s := OversizedPacket.String(); s != "OversizedPacket" {
+		t.Error("0xE9D0A6", s)
+	}
+	if s := ReplayedPacket.String(); s != "ReplayedPacket" {
+		t.Error("0xE4C9B2", s)
+	}
+	if s := SlowHandler.String(); s != "SlowHandler" {
+		t.Error("0xE8F2A7", s)
+	}
+	if s := EventKind(0).String(); s != "EventKind(0)" {
+		t.Error("0xEF4450", s)
+	}
+}
+
+// end
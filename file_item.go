@@ -0,0 +1,220 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[file_item.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileItemTag begins the value of the data items sent by SendFile(),
+// followed by the file's metadata on one line (see makeFileItem)
+// and the contents of the file.
+const fileItemTag = "UDPT-FILE "
+
+// FileMeta describes a file sent by SendFile(), and is restored on
+// the receiving end by WriteToDirectory().
+type FileMeta struct {
+
+	// Path is the file's path relative to the directory it is written
+	// to on the receiving end, with forward slashes.
+	Path string
+
+	// Mode is the file's permission bits.
+	Mode os.FileMode
+
+	// ModTime is the file's modification time.
+	ModTime time.Time
+} //                                                                    FileMeta
+
+// SendFile creates a Sender and uses it to send the file at 'path' to
+// the Receiver at address 'addr', along with the file's metadata (see
+// FileMeta). The file is sent as the data item with key 'k', which is
+// also the path it is written to by WriteToDirectory() on the other
+// end. If 'k' is blank, the file's name is used.
+//
+// cryptoKey and config are the same as for Send().
+//
+func SendFile(path, addr, k string, cryptoKey []byte,
+	config ...*Configuration,
+) error {
+	if len(config) > 1 {
+		return makeError(0xE5B1D8, "too many 'config' arguments")
+	}
+	var cf *Configuration
+	if len(config) == 1 {
+		cf = config[0]
+	}
+	if cf == nil {
+		cf = NewDefaultConfig()
+	}
+	sender := Sender{Address: addr, CryptoKey: cryptoKey, Config: cf}
+	return sender.SendFile(path, k)
+} //                                                                    SendFile
+
+// SendFile sends the file at 'path' to the Receiver specified by
+// Sender.Address, along with the file's modification time, permission
+// bits and its path relative to the Receiver's directory, which is 'k'
+// or, if 'k' is blank, the file's name. WriteToDirectory() restores
+// them on the receiving end.
+//
+// The whole file is read into memory. For very large files,
+// use SendFromReader(), which doesn't send the metadata.
+//
+func (sd *Sender) SendFile(path, k string) error {
+	if sd.Config == nil {
+		sd.Config = NewDefaultConfig()
+	}
+	_, err := sd.sendFile(context.Background(), path, k)
+	return err
+} //                                                                    SendFile
+
+// sendFile sends the file at 'path' with key 'k' like SendFile(),
+// within context 'ctx'. Returns the size of the file.
+func (sd *Sender) sendFile(ctx context.Context, path, k string,
+) (int64, error) {
+	if k == "" {
+		k = filepath.Base(path)
+	}
+	if !filepath.IsLocal(filepath.FromSlash(k)) {
+		return 0, sd.logError(0xE8F3A2, "key is not a relative path:", k)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, sd.logError(0xE1C6E7, err)
+	}
+	if !info.Mode().IsRegular() {
+		return 0, sd.logError(0xE4D9B0, "not a regular file:", path)
+	}
+	t0 := time.Now()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, sd.logError(0xE7A4C5, err)
+	}
+	sd.readTime = time.Since(t0)
+	return sd.sendFileItem(ctx, k, info, content)
+} //                                                                    sendFile
+
+// sendFileItem sends 'content' with key 'k' and the metadata in 'info'
+// as a file item (see makeFileItem), within context 'ctx'.
+// Returns the size of 'content'.
+func (sd *Sender) sendFileItem(ctx context.Context, k string,
+	info fs.FileInfo, content []byte,
+) (int64, error) {
+	meta := FileMeta{
+		Path:    filepath.ToSlash(k),
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime(),
+	}
+	err := sd.sendContext(ctx, k, makeFileItem(meta, content), nil)
+	return int64(len(content)), err
+} //                                                                sendFileItem
+
+// WriteToDirectory returns a function that can be assigned to
+// Receiver.Receive, which writes the files sent by SendFile() to
+// directory 'dir', restoring their metadata. Data items not sent by
+// SendFile() are written to the path given by their key, with the
+// default permissions of FileRoute.
+//
+// Files are written the same way as by FileWriter, so paths that are
+// not local to 'dir' are refused, and files appear atomically.
+//
+func WriteToDirectory(dir string) func(k string, v []byte) error {
+	return WriteToFS(OSFS{}, dir)
+} //                                                            WriteToDirectory
+
+// WriteToFS returns a function like WriteToDirectory(), which writes
+// the files to directory 'dir' in file system 'fsys'. Their
+// modification times are only restored if 'fsys' has a Chtimes()
+// method (see WritableFS).
+func WriteToFS(fsys WritableFS, dir string) func(k string, v []byte) error {
+	return func(k string, v []byte) error {
+		meta, content, ok := ParseFileItem(v)
+		if !ok {
+			meta, content = FileMeta{Path: k}, v
+		}
+		name := filepath.FromSlash(meta.Path)
+		if !filepath.IsLocal(name) {
+			return makeError(0xE3E0F9, "invalid file path:", meta.Path)
+		}
+		rt := FileRoute{Dir: dir, FS: fsys, FileMode: meta.Mode}
+		path := filepath.Join(dir, name)
+		err := rt.writeFile(path, content, false)
+		if err != nil {
+			return err
+		}
+		ct, ok := fsys.(interface {
+			Chtimes(name string, atime, mtime time.Time) error
+		})
+		if ok && !meta.ModTime.IsZero() {
+			err = ct.Chtimes(path, meta.ModTime, meta.ModTime)
+			if err != nil {
+				return makeError(0xE9B7D4, err)
+			}
+		}
+		return nil
+	}
+} //                                                                   WriteToFS
+
+// ParseFileItem splits the value 'v' of a data item sent by SendFile()
+// into the file's metadata and contents. Returns false if 'v' wasn't
+// sent by SendFile(). Use it in a Receive function to handle files
+// differently than WriteToDirectory() does.
+func ParseFileItem(v []byte) (meta FileMeta, content []byte, ok bool) {
+	if !bytes.HasPrefix(v, []byte(fileItemTag)) {
+		return FileMeta{}, nil, false
+	}
+	end := bytes.IndexByte(v, '\n')
+	if end == -1 {
+		return FileMeta{}, nil, false
+	}
+	s := string(v[len(fileItemTag):end]) + " "
+	path, err := strconv.Unquote(getPart(s, "path:", " "))
+	if err != nil || path == "" {
+		return FileMeta{}, nil, false
+	}
+	mode, err := strconv.ParseUint(getPart(s, " mode:", " "), 8, 32)
+	if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+		return FileMeta{}, nil, false
+	}
+	meta = FileMeta{Path: path, Mode: os.FileMode(mode)}
+	if mtime := getPart(s, " mtime:", " "); mtime != "0" {
+		nanos, err := strconv.ParseInt(mtime, 10, 64)
+		if err != nil {
+			return FileMeta{}, nil, false
+		}
+		meta.ModTime = time.Unix(0, nanos)
+	}
+	return meta, v[end+1:], true
+} //                                                               ParseFileItem
+
+// makeFileItem returns the value of the data item in which
+// SendFile() sends a file with metadata 'meta' and 'content'.
+func makeFileItem(meta FileMeta, content []byte) []byte {
+	var mtime int64
+	if !meta.ModTime.IsZero() {
+		mtime = meta.ModTime.UnixNano()
+	}
+	header := fmt.Sprintf("%spath:%s mode:%o mtime:%d\n", fileItemTag,
+		quoteFilePath(meta.Path), meta.Mode.Perm(), mtime)
+	ret := make([]byte, 0, len(header)+len(content))
+	return append(append(ret, header...), content...)
+} //                                                                makeFileItem
+
+// quoteFilePath quotes 'path' for the header of a file item, escaping
+// spaces too, so that the header's fields can be split at spaces.
+func quoteFilePath(path string) string {
+	return strings.ReplaceAll(strconv.Quote(path), " ", `\x20`)
+} //                                                               quoteFilePath
+
+// end
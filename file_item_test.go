@@ -0,0 +1,122 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[file_item_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_fileItem_*
+
+// -----------------------------------------------------------------------------
+
+// makeFileItem(meta FileMeta, content []byte) []byte
+// ParseFileItem(v []byte) (meta FileMeta, content []byte, ok bool)
+//
+// go test -run Test_fileItem_ParseFileItem_
+//
+func Test_fileItem_ParseFileItem_(t *testing.T) {
+	test := func(meta FileMeta, content string) {
+		t.Helper()
+		got, gotContent, ok := ParseFileItem(makeFileItem(meta,
+			[]byte(content)))
+		if !ok || got.Path != meta.Path || got.Mode != meta.Mode ||
+			!got.ModTime.Equal(meta.ModTime) || string(gotContent) != content {
+			t.Error("0xE6D3A8", "got:", got, string(gotContent), ok)
+		}
+	}
+	mtime := time.Unix(1700000000, 123456789)
+	test(FileMeta{Path: "a.txt", Mode: 0644, ModTime: mtime}, "abc")
+	test(FileMeta{Path: "sub dir/mode:7 x.txt", Mode: 0600}, "")
+	test(FileMeta{Path: "ünï/\"q\".bin", Mode: 0755, ModTime: mtime}, "\n\n")
+	//
+	for _, v := range []string{
+		"abc",
+		fileItemTag + "path:\"a\" mode:644 mtime:0",    // no newline
+		fileItemTag + "path:a mode:644 mtime:0\n",      // unquoted path
+		fileItemTag + "path:\"a\" mode:9 mtime:0\n",    // bad mode
+		fileItemTag + "path:\"a\" mode:4644 mtime:0\n", // not permissions
+		fileItemTag + "path:\"a\" mode:644 mtime:x\n",  // bad mtime
+	} {
+		if _, _, ok := ParseFileItem([]byte(v)); ok {
+			t.Error("0xE2B9F0", "parsed:", v)
+		}
+	}
+}
+
+// SendFile(path, addr, k string, cryptoKey []byte,
+//
+//	config ...*Configuration,
+//
+// ) error
+// WriteToDirectory(dir string) func(k string, v []byte) error
+//
+// go test -run Test_fileItem_SendFile_
+//
+func Test_fileItem_SendFile_(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	path := filepath.Join(src, "report.txt")
+	if err := os.WriteFile(path, []byte("contents"), 0640); err != nil {
+		t.Fatal("0xE0C4E1", err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal("0xE7F1B3", err)
+	}
+	sd := makeTestSender()
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive:   WriteToDirectory(dst),
+	}
+	for _, k := range []string{"", "out/copy.txt"} {
+		err := sd.SendFile(path, k)
+		if err != nil {
+			t.Fatal("0xE4A7D6", k, err)
+		}
+		if k == "" {
+			k = "report.txt"
+		}
+		got := filepath.Join(dst, filepath.FromSlash(k))
+		data, err := os.ReadFile(got)
+		if err != nil || string(data) != "contents" {
+			t.Error("0xE9C2A5", k, string(data), err)
+			continue
+		}
+		info, _ := os.Stat(got)
+		if !info.ModTime().Equal(mtime) {
+			t.Error("0xE5E8C0", k, "wrong mod time:", info.ModTime())
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0640 {
+			t.Error("0xE1B6F4", k, "wrong mode:", info.Mode())
+		}
+	}
+	// keys that aren't relative paths must be refused before sending
+	for _, k := range []string{"../x", "/abs"} {
+		if err := sd.SendFile(path, k); !matchError(err, "not a relative") {
+			t.Error("0xE8D0B2", k, "wrong error:", err)
+		}
+	}
+	if err := sd.SendFile(src, ""); !matchError(err, "not a regular file") {
+		t.Error("0xE3A5E7", "wrong error:", err)
+	}
+	// items not sent by SendFile() are written under their key
+	err := WriteToDirectory(dst)("plain.txt", []byte("plain"))
+	data, _ := os.ReadFile(filepath.Join(dst, "plain.txt"))
+	if err != nil || string(data) != "plain" {
+		t.Error("0xE6F9D1", string(data), err)
+	}
+	err = WriteToDirectory(dst)("../escape.txt", []byte("x"))
+	if !matchError(err, "invalid file path") {
+		t.Error("0xE0E2C8", "wrong error:", err)
+	}
+}
+
+// end
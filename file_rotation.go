@@ -0,0 +1,216 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[file_rotation.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileRotationInterval is the minimum time between the
+// rotations that FileWriter.Receive() starts.
+const fileRotationInterval = time.Minute
+
+// listableFS is a WritableFS in which FileRoute can rotate files.
+type listableFS interface {
+	WritableFS
+
+	// ReadDir lists directory 'name' like os.ReadDir().
+	ReadDir(name string) ([]fs.DirEntry, error)
+
+	// Open opens file 'name' for reading like os.Open().
+	Open(name string) (fs.File, error)
+} //                                                                  listableFS
+
+// rotatedFile is a file found in the directory of a FileRoute.
+type rotatedFile struct {
+	path string
+	size int64
+	mod  time.Time
+} //                                                                 rotatedFile
+
+// Rotate compresses and deletes the files in the directories of all
+// Routes, according to their CompressAfter, MaxAge and MaxBytes.
+// Receive() calls it in the background at most once a minute,
+// ignoring errors, so call it directly to handle them.
+func (fw *FileWriter) Rotate() error {
+	var errs []error
+	now := time.Now()
+	for i := range fw.Routes {
+		err := fw.Routes[i].rotate(now)
+		if err != nil {
+			errs = append(errs, makeError(0xE3D6A8, "route", i, err))
+		}
+	}
+	return errors.Join(errs...)
+} //                                                                      Rotate
+
+// rotateLater starts Rotate() in another goroutine, unless it is already
+// running or has run less than fileRotationInterval before 'now'.
+func (fw *FileWriter) rotateLater(now time.Time) {
+	fw.rotateMu.Lock()
+	defer fw.rotateMu.Unlock()
+	if fw.rotating || now.Sub(fw.rotated) < fileRotationInterval {
+		return
+	}
+	fw.rotating, fw.rotated = true, now
+	go func() {
+		_ = fw.Rotate()
+		fw.rotateMu.Lock()
+		fw.rotating = false
+		fw.rotateMu.Unlock()
+	}()
+} //                                                                 rotateLater
+
+// rotates returns true if the route rotates its files.
+func (rt *FileRoute) rotates() bool {
+	return rt.CompressAfter > 0 || rt.MaxAge > 0 || rt.MaxBytes > 0
+} //                                                                     rotates
+
+// rotate deletes the files in the route's directory last modified more
+// than MaxAge before 'now', compresses those modified more than
+// CompressAfter before it, then deletes the oldest files while the
+// rest total more than MaxBytes.
+func (rt *FileRoute) rotate(now time.Time) error {
+	if !rt.rotates() {
+		return nil
+	}
+	fsys, _, _ := rt.settings()
+	lfs, ok := fsys.(listableFS)
+	if !ok {
+		return makeError(0xE8E1C4, "FileRoute.FS can't list files")
+	}
+	files, err := listRotatedFiles(lfs, rt.Dir)
+	if err != nil {
+		return makeError(0xE5C9B7, err)
+	}
+	kept := files[:0]
+	for _, f := range files {
+		if rt.MaxAge > 0 && now.Sub(f.mod) > rt.MaxAge {
+			err = fsys.Remove(f.path)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return makeError(0xE2B5F9, err)
+			}
+			continue
+		}
+		if rt.CompressAfter > 0 && now.Sub(f.mod) > rt.CompressAfter &&
+			!strings.HasSuffix(f.path, ".gz") {
+			f, err = rt.compressFile(lfs, f)
+			if err != nil {
+				return makeError(0xE7A3D1, err)
+			}
+		}
+		kept = append(kept, f)
+	}
+	if rt.MaxBytes <= 0 {
+		return nil
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].mod.Before(kept[j].mod)
+	})
+	var total int64
+	for _, f := range kept {
+		total += f.size
+	}
+	for _, f := range kept {
+		if total <= rt.MaxBytes {
+			break
+		}
+		err = fsys.Remove(f.path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return makeError(0xE9F4C2, err)
+		}
+		total -= f.size
+	}
+	return nil
+} //                                                                      rotate
+
+// compressFile replaces file 'f' with a gzip-compressed copy named like
+// it with ".gz" added, keeping its modification time if 'lfs' has a
+// Chtimes() method. The copy is written like the files of writeFile().
+func (rt *FileRoute) compressFile(lfs listableFS, f rotatedFile,
+) (rotatedFile, error) {
+	in, err := lfs.Open(f.path)
+	if err != nil {
+		return f, err
+	}
+	defer in.Close()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return f, err
+	}
+	gzPath := f.path + ".gz"
+	err = rt.writeFile(gzPath, buf.Bytes(), false)
+	if err != nil {
+		return f, err
+	}
+	if ct, ok := lfs.(interface {
+		Chtimes(name string, atime, mtime time.Time) error
+	}); ok {
+		_ = ct.Chtimes(gzPath, f.mod, f.mod)
+	}
+	err = lfs.Remove(f.path)
+	if err != nil {
+		return f, err
+	}
+	return rotatedFile{path: gzPath, size: int64(buf.Len()), mod: f.mod}, nil
+} //                                                                compressFile
+
+// listRotatedFiles returns the files in directory 'dir' and its
+// subdirectories, except those whose names begin with a dot, such
+// as the temporary files of writeFile(). A missing 'dir' has none.
+func listRotatedFiles(lfs listableFS, dir string) ([]rotatedFile, error) {
+	entries, err := lfs.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ret []rotatedFile
+	for _, ent := range entries {
+		if strings.HasPrefix(ent.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, ent.Name())
+		if ent.IsDir() {
+			sub, err := listRotatedFiles(lfs, path)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, sub...)
+			continue
+		}
+		info, err := ent.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // removed meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		ret = append(ret, rotatedFile{
+			path: path, size: info.Size(), mod: info.ModTime(),
+		})
+	}
+	return ret, nil
+} //                                                            listRotatedFiles
+
+// end
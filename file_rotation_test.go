@@ -0,0 +1,96 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /[file_rotation_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// (fw *FileWriter) Rotate() error
+//
+// go test -run Test_FileWriter_Rotate_
+//
+func Test_FileWriter_Rotate_(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name string, size int, age time.Duration) {
+		path := filepath.Join(dir, name)
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		err := os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0644)
+		if err != nil {
+			t.Fatal("0xE4E9B1", err)
+		}
+		_ = os.Chtimes(path, now.Add(-age), now.Add(-age))
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+	write("expired.log", 10, 72*time.Hour)
+	write("sub/old.log", 1000, 30*time.Hour)
+	write("older.log", 1000, 40*time.Hour)
+	write("recent.log", 1000, time.Hour)
+	write("new.log", 1000, 0)
+	write(".partial.tmp", 10, 72*time.Hour)
+	fw, err := NewFileWriter(FileRoute{
+		Dir: dir, CompressAfter: 24 * time.Hour, MaxAge: 48 * time.Hour,
+		MaxBytes: 2050, // the two new files and one compressed file
+	})
+	if err != nil {
+		t.Fatal("0xE7D3C5", err)
+	}
+	if err := fw.Rotate(); err != nil {
+		t.Fatal("0xE2F8A9", err)
+	}
+	// must delete expired files, compress old ones, then delete the
+	// oldest until the rest fit in MaxBytes, ignoring temporary files
+	if exists("expired.log") || exists("older.log") || exists("older.log.gz") ||
+		exists("sub/old.log") || !exists("sub/old.log.gz") ||
+		!exists("recent.log") || !exists("new.log") ||
+		!exists(".partial.tmp") {
+		t.Error("0xE6A4F7")
+	}
+	f, err := os.Open(filepath.Join(dir, "sub/old.log.gz"))
+	if err != nil {
+		t.Fatal("0xE9B2D3", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal("0xE3C7E2", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil || !bytes.Equal(data, bytes.Repeat([]byte("x"), 1000)) {
+		t.Error("0xE5F1B8", len(data), err)
+	}
+	info, err := f.Stat()
+	if err != nil || now.Sub(info.ModTime()) < 29*time.Hour {
+		t.Error("0xE8A6C4", "modification time not kept", err)
+	}
+}
+
+// (rt *FileRoute) validate() error
+//
+// go test -run Test_FileRoute_validate_
+//
+func Test_FileRoute_validate_(t *testing.T) {
+	_, err := NewFileWriter(FileRoute{Dir: "a", MaxBytes: -1})
+	if !matchError(err, "negative FileRoute rotation limit") {
+		t.Error("0xE1D5A7", "wrong error:", err)
+	}
+	_, err = NewFileWriter(FileRoute{Dir: "a", FS: newMemFS(), MaxAge: 1})
+	if !matchError(err, "FileRoute.FS can't list files") {
+		t.Error("0xE4B9F2", "wrong error:", err)
+	}
+}
+
+// end
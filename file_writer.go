@@ -0,0 +1,263 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[file_writer.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileRoute maps the data items whose keys begin with Prefix to files in
+// directory Dir. The rest of the key is the file's path within Dir, e.g.
+// with Prefix "logs/" and Dir "/var/log/ingest", the item with key
+// "logs/app/1.log" is written to "/var/log/ingest/app/1.log".
+type FileRoute struct {
+
+	// Prefix is the beginning of the keys of the data items written to
+	// Dir. A blank Prefix matches all keys, so it can be a default route.
+	Prefix string
+
+	// Dir is the directory in which the files are written.
+	// It is created if it doesn't exist.
+	Dir string
+
+	// FS is the file system in which Dir is. Nil means OSFS.
+	FS WritableFS
+
+	// FileMode is the permission bits of the files written.
+	// Zero means 0644.
+	FileMode os.FileMode
+
+	// DirMode is the permission bits of the directories created.
+	// Zero means 0755.
+	DirMode os.FileMode
+
+	// Chown makes the files written owned by user UID and group GID,
+	// e.g. the account of the application consuming them. This usually
+	// requires privileges, and isn't supported on Windows.
+	Chown bool
+	UID   int
+	GID   int
+
+	// CompressAfter, MaxAge and MaxBytes rotate the files in Dir, so
+	// that long-running ingest nodes don't need a separate cleanup job:
+	// files last modified more than CompressAfter ago are compressed
+	// with gzip (adding ".gz" to their names), files last modified more
+	// than MaxAge ago are deleted, and then the oldest files are deleted
+	// while all the files in Dir total more than MaxBytes. Zero disables
+	// each of them. Files are rotated by FileWriter.Rotate(). This
+	// requires an FS that can list files, such as OSFS (see WritableFS).
+	CompressAfter time.Duration
+	MaxAge        time.Duration
+	MaxBytes      int64
+} //                                                                   FileRoute
+
+// FileWriter writes the data items received by a Receiver as files,
+// in the directory of the FileRoute that matches the key of each item.
+// Assign its Receive method to Receiver.Receive.
+//
+// Each file is written to a temporary file in its directory, named
+// like ".name.123456.tmp", which is renamed to the file's name once it
+// is complete. So programs watching the directory never see partial
+// files, provided that they ignore names that begin with a dot.
+// The Receiver only calls Receive after the item's hash has been
+// verified.
+//
+type FileWriter struct {
+
+	// Routes are the mappings of key prefixes to directories. The route
+	// with the longest Prefix that matches an item's key is used.
+	Routes []FileRoute
+
+	// Sync makes Receive flush each file, and then its directory, to
+	// disk before it returns, so that the file survives a crash of the
+	// machine once the Sender gets its confirmation. This is slower.
+	Sync bool
+
+	// rotateMu protects 'rotating', which is set while Rotate() runs in
+	// the background, and 'rotated', when rotateLater() last started it
+	rotateMu sync.Mutex
+	rotating bool
+	rotated  time.Time
+} //                                                                  FileWriter
+
+// NewFileWriter returns a FileWriter that writes data items
+// according to 'routes', or an error if a route is invalid.
+func NewFileWriter(routes ...FileRoute) (*FileWriter, error) {
+	fw := &FileWriter{Routes: routes}
+	for i := range routes {
+		err := routes[i].validate()
+		if err != nil {
+			return nil, makeError(0xEF1D0A, "route", i, err)
+		}
+	}
+	return fw, nil
+} //                                                               NewFileWriter
+
+// Receive writes the data item with key 'k' and value 'v' to a file,
+// and can be assigned to Receiver.Receive. Returns an error if no route
+// matches 'k', or if the rest of 'k' is not a local path, e.g. it is
+// absolute or contains "..", so a Sender can't write outside Dir.
+func (fw *FileWriter) Receive(k string, v []byte) error {
+	rt := fw.route(k)
+	if rt == nil {
+		return makeError(0xE44E66, "no FileRoute for key:", k)
+	}
+	name := filepath.FromSlash(strings.TrimPrefix(k, rt.Prefix))
+	if !filepath.IsLocal(name) {
+		return makeError(0xE10A65, "invalid file name in key:", k)
+	}
+	err := rt.writeFile(filepath.Join(rt.Dir, name), v, fw.Sync)
+	if err != nil {
+		return err
+	}
+	if rt.rotates() {
+		fw.rotateLater(time.Now())
+	}
+	return nil
+} //                                                                     Receive
+
+// route returns the route with the longest Prefix that matches
+// key 'k', or nil if there is none.
+func (fw *FileWriter) route(k string) *FileRoute {
+	var ret *FileRoute
+	for i := range fw.Routes {
+		rt := &fw.Routes[i]
+		if strings.HasPrefix(k, rt.Prefix) &&
+			(ret == nil || len(rt.Prefix) > len(ret.Prefix)) {
+			ret = rt
+		}
+	}
+	return ret
+} //                                                                       route
+
+// validate returns an error if the route can't be used.
+func (rt *FileRoute) validate() error {
+	if rt.Dir == "" {
+		return makeError(0xE379CF, "blank FileRoute.Dir")
+	}
+	if rt.FileMode&^os.ModePerm != 0 || rt.DirMode&^os.ModePerm != 0 {
+		return makeError(0xE29D1F, "FileRoute modes must be permission bits")
+	}
+	if rt.CompressAfter < 0 || rt.MaxAge < 0 || rt.MaxBytes < 0 {
+		return makeError(0xE6C2F8, "negative FileRoute rotation limit")
+	}
+	fsys, _, _ := rt.settings()
+	if _, ok := fsys.(listableFS); rt.rotates() && !ok {
+		return makeError(0xE1B7E5, "FileRoute.FS can't list files")
+	}
+	return nil
+} //                                                                    validate
+
+// writeFile writes 'data' to file 'path' in the route's file system
+// atomically, creating its directory if needed, and applies the
+// route's permissions and ownership. If 'sync' is true, flushes
+// the file and directory to disk.
+func (rt *FileRoute) writeFile(path string, data []byte, sync bool) error {
+	fsys, fileMode, dirMode := rt.settings()
+	dir := filepath.Dir(path)
+	var (
+		file     io.WriteCloser
+		tempPath string
+		err      error
+	)
+	for i := 0; i < 100; i++ {
+		tempPath = filepath.Join(dir, "."+filepath.Base(path)+"."+
+			strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp")
+		file, err = fsys.Create(tempPath, fileMode, dirMode)
+		if !errors.Is(err, fs.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return makeError(0xEB7CFF, err)
+	}
+	fail := func(id uint32, err error) error {
+		_ = file.Close()
+		_ = fsys.Remove(tempPath)
+		return makeError(id, err)
+	}
+	_, err = file.Write(data)
+	if err != nil {
+		return fail(0xEAC559, err)
+	}
+	if rt.Chown {
+		ch, ok := file.(interface{ Chown(uid, gid int) error })
+		if !ok {
+			return fail(0xE6BF17, errors.New("file system can't chown"))
+		}
+		err = ch.Chown(rt.UID, rt.GID)
+		if err != nil {
+			return fail(0xE0FC1D, err)
+		}
+	}
+	if sc, ok := file.(interface{ Sync() error }); ok && sync {
+		err = sc.Sync()
+		if err != nil {
+			return fail(0xEB9349, err)
+		}
+	}
+	err = file.Close()
+	if err != nil {
+		_ = fsys.Remove(tempPath)
+		return makeError(0xE9A31D, err)
+	}
+	err = fsys.Rename(tempPath, path)
+	if err != nil {
+		_ = fsys.Remove(tempPath)
+		return makeError(0xE02243, err)
+	}
+	if sd, ok := fsys.(interface{ SyncDir(name string) error }); ok && sync {
+		return sd.SyncDir(dir)
+	}
+	return nil
+} //                                                                   writeFile
+
+// settings returns the route's file system and permission
+// bits, or their defaults if they are not specified.
+func (rt *FileRoute) settings() (WritableFS, os.FileMode, os.FileMode) {
+	fsys, fileMode, dirMode := rt.FS, rt.FileMode, rt.DirMode
+	if fsys == nil {
+		fsys = OSFS{}
+	}
+	if fileMode == 0 {
+		fileMode = 0644
+	}
+	if dirMode == 0 {
+		dirMode = 0755
+	}
+	return fsys, fileMode, dirMode
+} //                                                                    settings
+
+// syncDir flushes directory 'dir' to disk, so that the files renamed
+// in it are not lost in a crash. Does nothing where directories
+// can't be flushed, e.g. on Windows.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return makeError(0xECA4B8, err)
+	}
+	defer d.Close()
+	err = d.Sync()
+	if err != nil {
+		return makeError(0xEC2F0B, err)
+	}
+	return nil
+} //                                                                     syncDir
+
+// end
@@ -0,0 +1,112 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[file_writer_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// (fw *FileWriter) Receive(k string, v []byte) error
+//
+// go test -run Test_FileWriter_Receive_
+//
+func Test_FileWriter_Receive_(t *testing.T) {
+	logs, configs, other := t.TempDir(), t.TempDir(), t.TempDir()
+	fw, err := NewFileWriter(
+		FileRoute{Prefix: "logs/", Dir: logs},
+		FileRoute{Prefix: "logs/secret/", Dir: configs, FileMode: 0600},
+		FileRoute{Prefix: "configs/", Dir: configs, FileMode: 0640,
+			Chown: true, UID: os.Getuid(), GID: os.Getgid()},
+		FileRoute{Dir: other},
+	)
+	if err != nil {
+		t.Fatal("0xE0643E", err)
+	}
+	test := func(k, path string, mode os.FileMode) {
+		err := fw.Receive(k, []byte(k))
+		if err != nil {
+			t.Error("0xE0443E", k, err)
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != k {
+			t.Error("0xE83784", k, err)
+			return
+		}
+		fi, _ := os.Stat(path)
+		if runtime.GOOS != "windows" && fi.Mode().Perm() != mode {
+			t.Error("0xE53588", k, fi.Mode())
+		}
+	}
+	test("logs/app/1.log", filepath.Join(logs, "app", "1.log"), 0644)
+	test("logs/secret/a", filepath.Join(configs, "a"), 0600) // longest prefix
+	test("configs/app.conf", filepath.Join(configs, "app.conf"), 0640)
+	test("other.txt", filepath.Join(other, "other.txt"), 0644)
+	//
+	// keys must not escape the route's directory
+	for _, k := range []string{"logs/../x", "logs/", "/etc/passwd", ""} {
+		err := fw.Receive(k, nil)
+		if !matchError(err, "invalid file name in key") {
+			t.Error("0xEDC6F3", k, "wrong error:", err)
+		}
+	}
+	fw.Routes = fw.Routes[:3]
+	err = fw.Receive("other.txt", nil)
+	if !matchError(err, "no FileRoute for key: other.txt") {
+		t.Error("0xE13283", "wrong error:", err)
+	}
+}
+
+// NewFileWriter(routes ...FileRoute) (*FileWriter, error)
+//
+// go test -run Test_NewFileWriter_
+//
+func Test_NewFileWriter_(t *testing.T) {
+	_, err := NewFileWriter(FileRoute{Dir: "a"}, FileRoute{Prefix: "b/"})
+	if !matchError(err, "route 1") || !matchError(err, "blank FileRoute.Dir") {
+		t.Error("0xE80866", "wrong error:", err)
+	}
+	_, err = NewFileWriter(FileRoute{Dir: "a", FileMode: os.ModeDir | 0755})
+	if !matchError(err, "FileRoute modes must be permission bits") {
+		t.Error("0xEEBBDB", "wrong error:", err)
+	}
+}
+
+// (rt *FileRoute) writeFile(path string, data []byte, sync bool) error
+//
+// go test -run Test_FileRoute_writeFile_
+//
+func Test_FileRoute_writeFile_(t *testing.T) {
+	dir := t.TempDir()
+	rt := FileRoute{Dir: dir}
+	path := filepath.Join(dir, "a.txt")
+	for _, data := range []string{"first", "second"} {
+		err := rt.writeFile(path, []byte(data), true)
+		if err != nil {
+			t.Fatal("0xE00683", err)
+		}
+		got, _ := os.ReadFile(path)
+		if string(got) != data {
+			t.Error("0xE7DDCD", string(got))
+		}
+	}
+	// a failed rename must not leave the temporary file behind
+	_ = os.Mkdir(filepath.Join(dir, "b"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "b", "c"), nil, 0644)
+	err := rt.writeFile(filepath.Join(dir, "b"), []byte("x"), false)
+	if err == nil {
+		t.Error("0xE1EE07", "replaced a directory")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Error("0xE7C2A4", "temporary files were left:", len(entries))
+	}
+}
+
+// end
@@ -5,6 +5,8 @@
 
 module github.com/balacode/udpt
 
-go 1.16
+// Go 1.21 is needed for log/slog (NewSlogLogger), and Go 1.20 for
+// crypto/ecdh (KeyExchange).
+go 1.21
 
 // end
@@ -0,0 +1,117 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                        /[handler.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Handler handles the data items received by a Receiver. Unlike the
+// Receive function, it is told where each item came from and how it
+// was transferred, so that it can make routing or authorization
+// decisions. Assign it to Receiver.Handler.
+type Handler interface {
+
+	// HandleItem is called when data item 'info' has been fully
+	// transferred, with its value 'v'. If it returns an error, the
+	// Receiver doesn't confirm the last piece of the item, so the
+	// Sender fails to deliver it.
+	HandleItem(info *ItemInfo, v []byte) error
+} //                                                                     Handler
+
+// HandlerFunc is a function that implements Handler.
+type HandlerFunc func(info *ItemInfo, v []byte) error
+
+// HandleItem calls f(info, v).
+func (f HandlerFunc) HandleItem(info *ItemInfo, v []byte) error {
+	return f(info, v)
+} //                                                                  HandleItem
+
+// ReceiveFunc returns a Handler that calls 'receive', a function with
+// the signature of Receiver.Receive, with the key and value of each
+// data item, so that existing Receive functions can be used as, or
+// wrapped by, Handlers.
+func ReceiveFunc(receive func(k string, v []byte) error) Handler {
+	return HandlerFunc(func(info *ItemInfo, v []byte) error {
+		return receive(info.Key, v)
+	})
+} //                                                                 ReceiveFunc
+
+// ItemInfo describes a data item passed to a Handler.
+type ItemInfo struct {
+
+	// Key is the key of the data item.
+	Key string
+
+	// Hash is the hash of the item's value, made by
+	// Configuration.Hasher (SHA-256 by default).
+	Hash []byte
+
+	// TransferID identifies the transfer of the item. It is made from
+	// Key and Hash, so it is the same when a Sender sends the same item
+	// again, e.g. to resume it, and can be used to detect duplicates.
+	TransferID string
+
+	// SenderID is the Sender.SenderID of the Sender that sent the item,
+	// which the Receiver has authenticated (see Receiver.AuthTokens).
+	// It is blank if the Receiver doesn't authenticate Senders.
+	SenderID string
+
+	// Sealed is true if the item was sealed end-to-end by its original
+	// Sender (see Receiver.EndToEndKey), possibly through relays. Hash
+	// is then the hash of the original value, which has been verified.
+	Sealed bool
+
+	// Addr is the address of the Sender, or nil if the item was
+	// delivered by a Sender in the same process, bypassing the
+	// network (see Configuration.LoopbackShortcut).
+	Addr net.Addr
+
+	// Started is when the first fragment of the item arrived,
+	// and Finished when the item was complete.
+	Started  time.Time
+	Finished time.Time
+
+	// Pieces is the number of pieces in which the item was sent,
+	// and CompressedSize their total size in bytes.
+	Pieces         int
+	CompressedSize int64
+
+	// Reply is an optional reply to the item, such as an ID or a status
+	// in JSON, which a Handler can set for the Sender's SendWithReply()
+	// to return (see RespondFunc). It can have up to MaxReplySize bytes.
+	// It is ignored if the Handler fails or is detached (see Config.
+	// DetachSlowHandlers), and Senders of earlier versions don't get it.
+	Reply []byte
+} //                                                                    ItemInfo
+
+// Elapsed returns how long it took to receive the item.
+func (info *ItemInfo) Elapsed() time.Duration {
+	return info.Finished.Sub(info.Started)
+} //                                                                     Elapsed
+
+// itemTransferID returns the ItemInfo.TransferID of
+// the data item with key 'k' and hash 'hash'.
+func itemTransferID(k string, hash []byte) string {
+	return fmt.Sprintf("%X", getHash([]byte(receivingItemID(k, hash)))[:8])
+} //                                                              itemTransferID
+
+// handler returns Receiver.Handler or, if it isn't
+// specified, a Handler that calls Receiver.Receive.
+// Returns nil if neither is specified.
+func (rc *Receiver) handler() Handler {
+	if rc.Handler != nil {
+		return rc.Handler
+	}
+	if rc.Receive != nil {
+		return ReceiveFunc(rc.Receive)
+	}
+	return nil
+} //                                                                     handler
+
+// end
@@ -0,0 +1,116 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[handler_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_handler_*
+
+// -----------------------------------------------------------------------------
+
+// go test -run Test_handler_Receiver_
+//
+// must pass the details of each item received over the network
+// to Receiver.Handler, instead of calling Receive
+func Test_handler_Receiver_(t *testing.T) {
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	infos := make(chan ItemInfo, 1)
+	rc := Receiver{
+		Port: 9896, CryptoKey: []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0"),
+		Config: cf,
+		Receive: func(k string, v []byte) error {
+			return errors.New("Receive called")
+		},
+		Handler: HandlerFunc(func(info *ItemInfo, v []byte) error {
+			if string(v) != "value" {
+				return errors.New("wrong value")
+			}
+			infos <- *info
+			return nil
+		}),
+	}
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	scf := NewDefaultConfig()
+	scf.LogWriter = nil
+	sd := Sender{Address: "127.0.0.1:9896", CryptoKey: rc.CryptoKey,
+		Config: scf}
+	t0 := time.Now()
+	if err := sd.Send("key", []byte("value")); err != nil {
+		t.Fatal("0xE3D9A1", err)
+	}
+	var info ItemInfo
+	select {
+	case info = <-infos:
+	case <-time.After(5 * time.Second):
+		t.Fatal("0xE8B2F6", "not received")
+	}
+	hash := getHash([]byte("value"))
+	if info.Key != "key" || !bytes.Equal(info.Hash, hash) ||
+		info.TransferID != itemTransferID("key", hash) ||
+		len(info.TransferID) != 16 {
+		t.Error("0xE5A7C0", info.Key, info.Hash, info.TransferID)
+	}
+	addr, ok := info.Addr.(*net.UDPAddr)
+	if !ok || !addr.IP.IsLoopback() {
+		t.Error("0xE1C4D8", info.Addr)
+	}
+	if info.Started.Before(t0) || info.Elapsed() < 0 ||
+		info.Pieces != 1 || info.CompressedSize < 1 {
+		t.Error("0xE6F3B9", info.Started, info.Elapsed(), info.Pieces,
+			info.CompressedSize)
+	}
+}
+
+// ReceiveFunc(receive func(k string, v []byte) error) Handler
+//
+// go test -run Test_handler_ReceiveFunc_
+//
+// must adapt a Receive function, and pass the details of items
+// delivered in the same process without a Sender address
+func Test_handler_ReceiveFunc_(t *testing.T) {
+	var got string
+	receive := ReceiveFunc(func(k string, v []byte) error {
+		got = k + "=" + string(v)
+		return nil
+	})
+	var info *ItemInfo
+	sd := makeTestSender()
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Handler: HandlerFunc(func(i *ItemInfo, v []byte) error {
+			info = i
+			return receive.HandleItem(i, v)
+		}),
+	}
+	if err := sd.Send("key", []byte("value")); err != nil {
+		t.Fatal("0xE4E1A5", err)
+	}
+	if got != "key=value" {
+		t.Error("0xE9D6C2", got)
+	}
+	if info == nil || info.Addr != nil ||
+		!bytes.Equal(info.Hash, getHash([]byte("value"))) {
+		t.Error("0xE2B8E7", info)
+	}
+	// without Receive, Handler or ReceiveStream, a Receiver can't run
+	rc := Receiver{Port: 9896, CryptoKey: sd.CryptoKey}
+	if err := rc.Run(); !matchError(err, "nil Receiver.Receive") {
+		t.Error("0xE7A0D4", "wrong error:", err)
+	}
+}
+
+// end
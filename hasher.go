@@ -0,0 +1,61 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                         /[hasher.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"crypto/sha256"
+	"hash"
+)
+
+// Hasher makes the hashes with which the values of data items are
+// checked after they have been received (see Configuration.Hasher).
+// The default, SHA256Hasher, is FIPS-approved. BLAKE3, which is much
+// faster for large values, is provided by the separate
+// github.com/balacode/udpt/blake3 module.
+type Hasher interface {
+
+	// New returns a new hash.Hash that makes 32-byte hashes.
+	// It must be safe to call concurrently.
+	New() hash.Hash
+} //                                                                      Hasher
+
+// SHA256Hasher is a Hasher that makes SHA-256 hashes.
+type SHA256Hasher struct{}
+
+// New implements Hasher.New() and returns a new SHA-256 hash.Hash.
+func (SHA256Hasher) New() hash.Hash {
+	return sha256.New()
+} //                                                                         New
+
+// newHash returns a new hash.Hash of 'hasher',
+// or a SHA-256 hash.Hash if 'hasher' is nil.
+func newHash(hasher Hasher) hash.Hash {
+	if hasher == nil {
+		return sha256.New()
+	}
+	return hasher.New()
+} //                                                                     newHash
+
+// hashWith returns the hash of 'data' made by
+// 'hasher', or its SHA-256 hash if 'hasher' is nil.
+func hashWith(hasher Hasher, data []byte) []byte {
+	return getHashDI(data, newHash(hasher))
+} //                                                                    hashWith
+
+// hasher returns Hasher, or nil if the configuration is nil.
+func (cf *Configuration) hasher() Hasher {
+	if cf == nil {
+		return nil
+	}
+	return cf.Hasher
+} //                                                                      hasher
+
+// hash returns the hash of the value of a data item, made by Hasher.
+func (cf *Configuration) hash(data []byte) []byte {
+	return hashWith(cf.hasher(), data)
+} //                                                                        hash
+
+// end
@@ -0,0 +1,83 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[hasher_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"hash"
+	"strings"
+	"testing"
+)
+
+// sha512Hasher is a Hasher that makes 64-byte hashes, which
+// Configuration.Validate() must refuse.
+type sha512Hasher struct{}
+
+func (sha512Hasher) New() hash.Hash { return sha512.New() }
+
+// sha512_256Hasher is a valid Hasher other than the default.
+type sha512_256Hasher struct{}
+
+func (sha512_256Hasher) New() hash.Hash { return sha512.New512_256() }
+
+// hashWith(hasher Hasher, data []byte) []byte
+//
+// go test -run Test_hashWith_
+//
+func Test_hashWith_(t *testing.T) {
+	data := []byte("abc")
+	if got := hashWith(nil, data); !bytes.Equal(got, getHash(data)) {
+		t.Error("0xE2B6D8", got)
+	}
+	if got := hashWith(SHA256Hasher{}, data); !bytes.Equal(got, getHash(data)) {
+		t.Error("0xE7E1A4", got)
+	}
+	want := sha512.Sum512_256(data)
+	if got := hashWith(sha512_256Hasher{}, data); !bytes.Equal(got, want[:]) {
+		t.Error("0xE0D9B3", got)
+	}
+	var cf *Configuration
+	if got := cf.hash(data); !bytes.Equal(got, getHash(data)) {
+		t.Error("0xE5C4F1", got)
+	}
+}
+
+// (di *dataItem) UnpackBytes(compressor Compression, workers int,
+// ) ([]byte, error)
+//
+// go test -run Test_Hasher_UnpackBytes_
+
+// must check the value of a data item with its Hasher
+func Test_Hasher_UnpackBytes_(t *testing.T) {
+	source := []byte(strings.Repeat("The quick brown fox. ", 100))
+	zc := &zlibCompressor{}
+	comp, err := zc.Compress(source)
+	if err != nil {
+		t.Fatal("0xE3A8E6", err)
+	}
+	hasher := sha512_256Hasher{}
+	di := dataItem{Hash: hashWith(hasher, source),
+		CompHash: hashWith(hasher, comp), CompressedPieces: [][]byte{comp},
+		hasher: hasher}
+	got, err := di.UnpackBytes(zc, 1)
+	if err != nil || !bytes.Equal(got, source) {
+		t.Error("0xE6F2C9", err)
+	}
+	// a SHA-256 hash doesn't match
+	di.hasher = nil
+	_, err = di.UnpackBytes(zc, 1)
+	if !matchError(err, "compressed data hash mismatch") {
+		t.Error("0xE1B5A7", "wrong error:", err)
+	}
+	di.CompHash = nil
+	_, err = di.UnpackBytes(zc, 1)
+	if !matchError(err, "hash mismatch") {
+		t.Error("0xE9D7F0", "wrong error:", err)
+	}
+}
+
+// end
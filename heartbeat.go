@@ -0,0 +1,190 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[heartbeat.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Heartbeat sends an encrypted probe (see Sender.Probe) to the Receiver
+// of each of its Peers at every Interval, and tells the application when
+// a peer starts or stops replying, so that it can track which peers are
+// alive without sending them dummy data items. Since the probes and
+// their replies are encrypted, only a peer that has CryptoKey counts
+// as alive. For liveness in both directions, run a Heartbeat at each
+// end, e.g.:
+//
+//	hb := udpt.Heartbeat{Peers: []string{"10.0.0.2:9876"}, CryptoKey: key,
+//		OnPeerDown: func(addr string) { log.Println(addr, "is down") }}
+//	err := hb.Run(ctx)
+//
+// Receivers that only accept negotiated session keys (see
+// Configuration.KeyExchange) don't reply to probes.
+//
+type Heartbeat struct {
+
+	// Peers are the addresses of the Receivers to watch,
+	// in the same form as Sender.Address.
+	Peers []string
+
+	// CryptoKey is the secret symmetric encryption key
+	// shared with the peers. See Sender.CryptoKey.
+	CryptoKey []byte
+
+	// Config contains the configuration settings. Its Cipher encrypts
+	// the probes. If it is nil, NewDefaultConfig() is used.
+	Config *Configuration
+
+	// Interval is the time between heartbeats, and how long each one
+	// waits for its reply. Zero means 1 second.
+	Interval time.Duration
+
+	// Misses is the number of heartbeats in a row without a reply after
+	// which a peer is deemed down, so that a single lost packet doesn't
+	// report it. Zero means 3.
+	Misses int
+
+	// OnPeerUp, if specified, is called when a peer replies for the
+	// first time, and when it replies again after it was down.
+	// It is called for each peer in a separate goroutine.
+	OnPeerUp func(addr string)
+
+	// OnPeerDown, if specified, is called when a peer has missed Misses
+	// heartbeats, either since it last replied, or since Run() started.
+	// It is called for each peer in a separate goroutine.
+	OnPeerDown func(addr string)
+} //                                                                   Heartbeat
+
+// peerLiveness is the state of a peer watched by a Heartbeat.
+type peerLiveness int
+
+const (
+	peerUnknown peerLiveness = iota // no reply or enough misses yet
+	peerUp                          // replied to the latest heartbeats
+	peerDown                        // missed the latest heartbeats
+)
+
+// Run sends heartbeats to Peers until context 'ctx' is done, then
+// returns the context's error. Returns an error without sending
+// heartbeats if there are no Peers, or if they or the configuration
+// are invalid.
+func (hb *Heartbeat) Run(ctx context.Context) error {
+	if len(hb.Peers) == 0 {
+		return makeError(0xE5A1C9, "no Heartbeat.Peers")
+	}
+	cf := hb.Config
+	if cf == nil {
+		cf = NewDefaultConfig()
+	}
+	err := cf.Validate()
+	if err != nil {
+		return makeError(0xE0B7D3, "invalid Heartbeat.Config:", err)
+	}
+	for _, addr := range hb.Peers {
+		sd := Sender{Address: addr, Config: cf}
+		err = sd.validateAddress()
+		if err != nil {
+			return makeError(0xE8C4F6, err)
+		}
+	}
+	err = cf.Cipher.SetKey(hb.CryptoKey)
+	if err != nil {
+		return makeError(0xE2F9A8, "invalid Heartbeat.CryptoKey:", err)
+	}
+	var wg sync.WaitGroup
+	for _, addr := range hb.Peers {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			hb.watchPeer(ctx, cf, addr)
+		}(addr)
+	}
+	wg.Wait()
+	return ctx.Err()
+} //                                                                         Run
+
+// watchPeer sends heartbeats to the Receiver at 'addr' until 'ctx' is
+// done. After an error such as ErrReceiverUnreachable, it connects
+// again for the next heartbeat, since the peer may be restarted.
+func (hb *Heartbeat) watchPeer(ctx context.Context, cf *Configuration,
+	addr string,
+) {
+	interval := hb.Interval
+	if interval <= 0 {
+		interval = 1 * time.Second
+	}
+	sd := Sender{Address: addr, Config: cf}
+	var pr *prober
+	defer func() {
+		if pr != nil {
+			pr.close()
+		}
+	}()
+	state := peerUnknown
+	misses := 0
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if pr == nil {
+			conn, err := sd.connect()
+			if err == nil {
+				pr, err = newProber(conn, cf.Cipher, cf.PacketSizeLimit)
+				if err != nil {
+					_ = conn.Close()
+				}
+			}
+			if err != nil {
+				_ = sd.logError(0xE6D3B1, "heartbeat:", err)
+			}
+		}
+		replied := false
+		if pr != nil {
+			_, err := pr.ping(diagnoseProbeSize, interval)
+			replied = err == nil
+			if err != nil && err != errTimeout {
+				pr.close()
+				pr = nil
+			}
+		}
+		state, misses = hb.beat(addr, state, misses, replied)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+} //                                                                   watchPeer
+
+// beat updates the liveness 'state' of the peer at 'addr' and the
+// number of heartbeats it has 'missed' in a row, after a heartbeat
+// that it 'replied' to or not, and calls OnPeerUp or OnPeerDown
+// when the state changes. Returns the new state and count.
+func (hb *Heartbeat) beat(addr string, state peerLiveness, missed int,
+	replied bool,
+) (peerLiveness, int) {
+	if replied {
+		if state != peerUp && hb.OnPeerUp != nil {
+			hb.OnPeerUp(addr)
+		}
+		return peerUp, 0
+	}
+	limit := hb.Misses
+	if limit <= 0 {
+		limit = 3
+	}
+	missed++
+	if missed < limit || state == peerDown {
+		return state, missed
+	}
+	if hb.OnPeerDown != nil {
+		hb.OnPeerDown(addr)
+	}
+	return peerDown, missed
+} //                                                                        beat
+
+// end
@@ -0,0 +1,106 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[heartbeat_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// (hb *Heartbeat) Run(ctx context.Context) error
+//
+// go test -run Test_Heartbeat_Run_
+
+// must report a peer up while its Receiver runs, and down after
+// it stops, then fail without peers or with an invalid address
+func Test_Heartbeat_Run_(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9872
+	go func() { _ = rc.Run() }()
+	time.Sleep(100 * time.Millisecond)
+	//
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(event string) func(addr string) {
+		return func(addr string) {
+			mu.Lock()
+			events = append(events, event+" "+addr)
+			mu.Unlock()
+		}
+	}
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	hb := Heartbeat{
+		Peers:      []string{"127.0.0.1:9872"},
+		CryptoKey:  rc.CryptoKey,
+		Config:     cf,
+		Interval:   50 * time.Millisecond,
+		Misses:     2,
+		OnPeerUp:   record("up"),
+		OnPeerDown: record("down"),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- hb.Run(ctx) }()
+	time.Sleep(300 * time.Millisecond)
+	rc.Stop()
+	time.Sleep(500 * time.Millisecond)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Error("0xE4B2E6", "wrong error:", err)
+	}
+	mu.Lock()
+	got := strings.Join(events, ", ")
+	mu.Unlock()
+	if got != "up 127.0.0.1:9872, down 127.0.0.1:9872" {
+		t.Error("0xE1D8C3", got)
+	}
+	// must fail without peers, or with an invalid address
+	hb.Peers = nil
+	if err := hb.Run(ctx); !matchError(err, "no Heartbeat.Peers") {
+		t.Error("0xE7C5A0", "wrong error:", err)
+	}
+	hb.Peers = []string{"127.0.0.1:0"}
+	if err := hb.Run(ctx); err == nil || err == context.Canceled {
+		t.Error("0xE0A9F2", "wrong error:", err)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// (hb *Heartbeat) beat(addr string, state peerLiveness, missed int,
+//     replied bool,
+// ) (peerLiveness, int)
+//
+// go test -run Test_Heartbeat_beat_
+
+// must report a peer up when it replies, and down only after
+// Misses heartbeats in a row without a reply, once each time
+func Test_Heartbeat_beat_(t *testing.T) {
+	var events []string
+	hb := Heartbeat{
+		Misses:     2,
+		OnPeerUp:   func(addr string) { events = append(events, "up") },
+		OnPeerDown: func(addr string) { events = append(events, "down") },
+	}
+	state, missed := peerUnknown, 0
+	for _, replied := range []bool{
+		false, false, false, true, true, false, true, false, false, false,
+	} {
+		state, missed = hb.beat("addr", state, missed, replied)
+	}
+	got := strings.Join(events, " ")
+	if got != "down up down" || state != peerDown || missed != 3 {
+		t.Error("0xE5E3B8", got, state, missed)
+	}
+}
+
+// end
@@ -0,0 +1,134 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                        /[history.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"time"
+)
+
+// TransferRecord is the outcome of sending a data item, as recorded
+// in the history of its destination address. See Sender.History().
+type TransferRecord struct {
+
+	// Time is when the Send started.
+	Time time.Time
+
+	// Duration is how long the Send took, including retries.
+	Duration time.Duration
+
+	// Label is the accounting label of the data item
+	// (see SendOptions.Label).
+	Label string
+
+	// ValueBytes is the size of the value sent.
+	ValueBytes int64
+
+	// PacketsSent is the number of packets written to the network,
+	// and PacketsResent how many of them were retransmissions.
+	PacketsSent   int64
+	PacketsResent int64
+
+	// AverageRTT is the average round-trip time of the packets confirmed.
+	AverageRTT time.Duration
+
+	// Err is the error with which the Send failed, or nil.
+	Err error
+} //                                                              TransferRecord
+
+// LossRate returns the fraction of the packets sent that were
+// retransmissions of lost packets, or 0 if no packets were sent.
+func (tr TransferRecord) LossRate() float64 {
+	if tr.PacketsSent < 1 {
+		return 0
+	}
+	return float64(tr.PacketsResent) / float64(tr.PacketsSent)
+} //                                                                    LossRate
+
+// transferHistory is a ring buffer of the
+// most recent TransferRecords of a destination.
+type transferHistory struct {
+	records []TransferRecord
+	next    int // index of the record to overwrite when full
+} //                                                             transferHistory
+
+// add appends 'rec' to the history, discarding the
+// oldest record if the history already has 'size' records.
+func (th *transferHistory) add(rec TransferRecord, size int) {
+	if len(th.records) != size && th.next != 0 {
+		th.records, th.next = th.list(), 0 // Config.HistorySize changed
+	}
+	if len(th.records) < size {
+		th.records = append(th.records, rec)
+		return
+	}
+	if len(th.records) > size {
+		th.records = th.records[len(th.records)-size:]
+	}
+	th.records[th.next] = rec
+	th.next = (th.next + 1) % size
+} //                                                                         add
+
+// list returns a copy of the records, oldest first.
+func (th *transferHistory) list() []TransferRecord {
+	ret := make([]TransferRecord, 0, len(th.records))
+	ret = append(ret, th.records[th.next:]...)
+	return append(ret, th.records[:th.next]...)
+} //                                                                        list
+
+// History returns the outcomes of the most recent data items sent by
+// this Sender to destination address 'addr', oldest first, or nil if
+// none were recorded. A blank 'addr' means Sender.Address. Up to
+// Config.HistorySize items are kept for each destination, so that
+// adaptive callers and dashboards can see trends such as rising loss
+// or round-trip times. It is safe to call while the Sender is sending.
+func (sd *Sender) History(addr string) []TransferRecord {
+	if addr == "" {
+		addr = sd.Address
+	}
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	th := sd.history[addr]
+	if th == nil {
+		return nil
+	}
+	return th.list()
+} //                                                                     History
+
+// addHistory records the outcome 'err' of the data item that
+// began sending at 't0' in the history of Sender.Address, kept by
+// the Sender that created this one for SendMany(), if any. 'before'
+// holds the statistics from before the data item was sent.
+func (sd *Sender) addHistory(t0 time.Time, before udpStats, err error) {
+	size := sd.Config.HistorySize
+	if size < 1 {
+		return
+	}
+	st := makeTransferStats(sd.stats.load().sub(before))
+	rec := TransferRecord{
+		Time:          t0,
+		Duration:      time.Since(t0),
+		Label:         sd.opts.Label,
+		ValueBytes:    st.ValueBytes,
+		PacketsSent:   st.PacketsSent,
+		PacketsResent: st.PacketsResent,
+		AverageRTT:    st.AverageRTT,
+		Err:           err,
+	}
+	owner := sd.owner()
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	if owner.history == nil {
+		owner.history = make(map[string]*transferHistory)
+	}
+	th := owner.history[sd.Address]
+	if th == nil {
+		th = &transferHistory{}
+		owner.history[sd.Address] = th
+	}
+	th.add(rec, size)
+} //                                                                  addHistory
+
+// end
@@ -0,0 +1,97 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[history_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// (sd *Sender) History(addr string) []TransferRecord
+//
+// go test -run Test_Sender_History_
+
+// must keep the outcomes of the last HistorySize items sent
+// to each destination, oldest first, including failures
+func Test_Sender_History_(t *testing.T) {
+	key := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	rc := Receiver{
+		Port: 9870, CryptoKey: key, Config: NewDefaultConfig(),
+		Receive: func(k string, v []byte) error { return nil },
+	}
+	rc.Config.LogWriter = nil
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	cf.HistorySize = 2
+	sd := Sender{Address: "127.0.0.1:9870", CryptoKey: key, Config: cf}
+	for i := 1; i <= 3; i++ {
+		err := sd.SendWithOptions("k", make([]byte, i*1000),
+			&SendOptions{Label: strconv.Itoa(i)})
+		if err != nil {
+			t.Fatal("0xE4F1A8", err)
+		}
+	}
+	got := sd.History("")
+	if len(got) != 2 || got[0].Label != "2" || got[1].Label != "3" ||
+		got[0].ValueBytes != 2000 || got[1].Err != nil ||
+		got[1].PacketsSent < 1 || got[1].LossRate() != 0 ||
+		got[1].Time.Before(got[0].Time) || got[1].Duration <= 0 {
+		t.Error("0xE9B2D5", got)
+	}
+	// a failure must be recorded under its own destination
+	sd.Address = "127.0.0.1:9869"
+	cf.SendRetries = 1
+	cf.ReplyTimeout = 100 * time.Millisecond
+	_ = sd.Send("k", []byte("lost"))
+	got = sd.History("127.0.0.1:9869")
+	if len(got) != 1 || got[0].Err == nil ||
+		len(sd.History("127.0.0.1:9870")) != 2 {
+		t.Error("0xE3C7A1", got)
+	}
+	// HistorySize zero must stop recording
+	cf.HistorySize = 0
+	_ = sd.Send("k", []byte("lost"))
+	if len(sd.History("")) != 1 {
+		t.Error("0xE6E8B4", sd.History(""))
+	}
+}
+
+// (th *transferHistory) add(rec TransferRecord, size int)
+//
+// go test -run Test_transferHistory_add_
+
+// must wrap around, and keep the newest records when the size shrinks
+func Test_transferHistory_add_(t *testing.T) {
+	var th transferHistory
+	labels := func() string {
+		ret := ""
+		for _, rec := range th.list() {
+			ret += rec.Label
+		}
+		return ret
+	}
+	for _, s := range []string{"a", "b", "c", "d", "e"} {
+		th.add(TransferRecord{Label: s}, 3)
+	}
+	if got := labels(); got != "cde" {
+		t.Error("0xE2A5F7", got)
+	}
+	th.add(TransferRecord{Label: "f"}, 2)
+	if got := labels(); got != "ef" {
+		t.Error("0xE8D4C3", got)
+	}
+	th.add(TransferRecord{Label: "g"}, 4)
+	if got := labels(); got != "efg" {
+		t.Error("0xE5F9B6", got)
+	}
+}
+
+// end
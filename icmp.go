@@ -0,0 +1,44 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                           /[icmp.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"syscall"
+)
+
+// icmpError describes an ICMP error that the operating system reported
+// for datagrams sent through a UDP connection.
+type icmpError struct {
+	errno syscall.Errno // e.g. ECONNREFUSED for "port unreachable"
+	mtu   int           // next-hop MTU if the error is "fragmentation needed"
+} //                                                                   icmpError
+
+// icmpErrorOf returns the icmpError reported in 'err', if 'err' was caused
+// by an ICMP message and reported by a socket call. Otherwise returns nil.
+func icmpErrorOf(err error) *icmpError {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return nil
+	}
+	switch errno {
+	case syscall.ECONNREFUSED, syscall.EHOSTUNREACH, syscall.ENETUNREACH:
+		return &icmpError{errno: errno}
+	}
+	return nil
+} //                                                                 icmpErrorOf
+
+// Unreachable returns true if the error shows that
+// the destination port, host or network can't be reached.
+func (ie *icmpError) Unreachable() bool {
+	switch ie.errno {
+	case syscall.ECONNREFUSED, syscall.EHOSTUNREACH, syscall.ENETUNREACH:
+		return true
+	}
+	return false
+} //                                                                 Unreachable
+
+// end
@@ -0,0 +1,148 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[icmp_linux.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build linux
+
+package udpt
+
+import (
+	"encoding/binary"
+	"syscall"
+)
+
+// soEEOriginICMP and soEEOriginICMP6 are the values of
+// sock_extended_err.ee_origin for errors caused by ICMP messages.
+const (
+	soEEOriginICMP  = 2
+	soEEOriginICMP6 = 3
+)
+
+// enableICMPErrors sets the IP_RECVERR (and IPV6_RECVERR) socket options
+// on 'conn', so that the kernel queues the details of ICMP errors, such
+// as the next-hop MTU when fragmentation is needed, in the socket's
+// error queue, from where readICMPError() can collect them.
+//
+// Does nothing if 'conn' is not backed by a socket (e.g. a mock).
+//
+func enableICMPErrors(conn netUDPConn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return makeError(0xE438CA, err)
+	}
+	var err4, err6 error
+	err = raw.Control(func(fd uintptr) {
+		err4 = syscall.SetsockoptInt(int(fd),
+			syscall.IPPROTO_IP, syscall.IP_RECVERR, 1)
+		err6 = syscall.SetsockoptInt(int(fd),
+			syscall.IPPROTO_IPV6, syscall.IPV6_RECVERR, 1)
+	})
+	if err != nil {
+		return makeError(0xE5C6DE, err)
+	}
+	if err4 != nil && err6 != nil {
+		return makeError(0xE2CB16, err4)
+	}
+	return nil
+} //                                                            enableICMPErrors
+
+// setDontFragment sets the IP_MTU_DISCOVER (and IPV6_MTU_DISCOVER) socket
+// options of 'conn' to "do", so that datagrams are sent with the Don't
+// Fragment bit set and writes of datagrams larger than the known path
+// MTU fail with EMSGSIZE instead of being fragmented.
+//
+// Does nothing if 'conn' is not backed by a socket (e.g. a mock).
+//
+func setDontFragment(conn netUDPConn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return makeError(0xEBEA45, err)
+	}
+	var err4, err6 error
+	err = raw.Control(func(fd uintptr) {
+		err4 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP,
+			syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+		err6 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6,
+			syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_DO)
+	})
+	if err != nil {
+		return makeError(0xEE6710, err)
+	}
+	if err4 != nil && err6 != nil {
+		return makeError(0xEDA7E2, err4)
+	}
+	return nil
+} //                                                             setDontFragment
+
+// readICMPError reads the next ICMP error from the error queue of the
+// socket behind 'conn' without blocking. Returns nil if there is none.
+func readICMPError(conn netUDPConn) *icmpError {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var (
+		buf  = make([]byte, 512)
+		oob  = make([]byte, 512)
+		oobn int
+	)
+	err = raw.Read(func(fd uintptr) bool {
+		_, oobn, _, _, err = syscall.Recvmsg(int(fd), buf, oob,
+			syscall.MSG_ERRQUEUE|syscall.MSG_DONTWAIT)
+		return true // don't wait for the queue to become readable
+	})
+	if err != nil {
+		return nil
+	}
+	return parseICMPError(oob[:oobn])
+} //                                                               readICMPError
+
+// parseICMPError extracts an icmpError from the control messages 'oob'
+// returned by recvmsg(MSG_ERRQUEUE). The data of an IP_RECVERR message
+// is a 'struct sock_extended_err' from <linux/errqueue.h>:
+//
+//	u32 ee_errno; u8 ee_origin, ee_type, ee_code, ee_pad;
+//	u32 ee_info;  u32 ee_data;
+//
+func parseICMPError(oob []byte) *icmpError {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for _, msg := range msgs {
+		h := msg.Header
+		isV4 := h.Level == syscall.IPPROTO_IP && h.Type == syscall.IP_RECVERR
+		isV6 := h.Level == syscall.IPPROTO_IPV6 &&
+			h.Type == syscall.IPV6_RECVERR
+		if !(isV4 || isV6) || len(msg.Data) < 16 {
+			continue
+		}
+		origin := msg.Data[4]
+		if origin != soEEOriginICMP && origin != soEEOriginICMP6 {
+			continue
+		}
+		ret := &icmpError{
+			errno: syscall.Errno(binary.NativeEndian.Uint32(msg.Data[0:4])),
+		}
+		if ret.errno == syscall.EMSGSIZE {
+			ret.mtu = int(binary.NativeEndian.Uint32(msg.Data[8:12]))
+		}
+		return ret
+	}
+	return nil
+} //                                                              parseICMPError
+
+// end
@@ -0,0 +1,76 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /[icmp_linux_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build linux
+
+package udpt
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// makeRecvErrMessage returns the control message that recvmsg(MSG_ERRQUEUE)
+// would return for an ICMP error with the given errno and ee_info value.
+func makeRecvErrMessage(errno syscall.Errno, info uint32) []byte {
+	ret := make([]byte, syscall.CmsgSpace(16))
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&ret[0]))
+	h.Level = syscall.IPPROTO_IP
+	h.Type = syscall.IP_RECVERR
+	h.SetLen(syscall.CmsgLen(16))
+	data := ret[syscall.CmsgLen(0):]
+	binary.NativeEndian.PutUint32(data[0:4], uint32(errno))
+	data[4] = soEEOriginICMP
+	binary.NativeEndian.PutUint32(data[8:12], info)
+	return ret
+}
+
+// parseICMPError(oob []byte) *icmpError
+//
+// go test -run Test_icmp_parseICMPError_
+//
+func Test_icmp_parseICMPError_(t *testing.T) {
+	ie := parseICMPError(makeRecvErrMessage(syscall.ECONNREFUSED, 0))
+	if ie == nil || !ie.Unreachable() || ie.mtu != 0 {
+		t.Error("0xE0F115")
+	}
+	ie = parseICMPError(makeRecvErrMessage(syscall.EMSGSIZE, 1280))
+	if ie == nil || ie.Unreachable() || ie.mtu != 1280 {
+		t.Error("0xE68500")
+	}
+	if parseICMPError(nil) != nil {
+		t.Error("0xE21136")
+	}
+	oob := makeRecvErrMessage(syscall.ECONNREFUSED, 0)
+	oob[syscall.CmsgLen(0)+4] = 1 // SO_EE_ORIGIN_LOCAL
+	if parseICMPError(oob) != nil {
+		t.Error("0xE57BE3")
+	}
+}
+
+// enableICMPErrors(conn netUDPConn) error
+//
+// go test -run Test_icmp_enableICMPErrors_
+//
+func Test_icmp_enableICMPErrors_(t *testing.T) {
+	conn := makeTestConn()
+	defer conn.Close()
+	if err := enableICMPErrors(conn); err != nil {
+		t.Error("0xEE660C", err)
+	}
+	if err := enableICMPErrors(&mockNetUDPConn{}); err != nil {
+		t.Error("0xE60E2A", err)
+	}
+	// with nothing queued, readICMPError must return nil without waiting
+	t0 := time.Now()
+	if readICMPError(conn) != nil || time.Since(t0) > time.Second {
+		t.Error("0xEE749A")
+	}
+}
+
+// end
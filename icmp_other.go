@@ -0,0 +1,28 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[icmp_other.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build !linux
+
+package udpt
+
+// enableICMPErrors does nothing on this platform: ICMP errors are
+// only reported through the errors returned by socket calls.
+func enableICMPErrors(conn netUDPConn) error {
+	return nil
+} //                                                            enableICMPErrors
+
+// readICMPError always returns nil on this
+// platform, since there is no socket error queue.
+func readICMPError(conn netUDPConn) *icmpError {
+	return nil
+} //                                                               readICMPError
+
+// setDontFragment does nothing on this platform: datagrams
+// are sent with the operating system's default settings.
+func setDontFragment(conn netUDPConn) error {
+	return nil
+} //                                                             setDontFragment
+
+// end
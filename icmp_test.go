@@ -0,0 +1,81 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[icmp_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_icmp_*
+
+// -----------------------------------------------------------------------------
+
+// icmpErrorOf(err error) *icmpError
+//
+// go test -run Test_icmp_icmpErrorOf_
+//
+func Test_icmp_icmpErrorOf_(t *testing.T) {
+	refused := &net.OpError{Op: "read", Net: "udp",
+		Err: os.NewSyscallError("recvfrom", syscall.ECONNREFUSED)}
+	ie := icmpErrorOf(makeError(0xEF9400, refused))
+	if ie == nil || !ie.Unreachable() {
+		t.Error("0xE34804")
+	}
+	if icmpErrorOf(syscall.EINVAL) != nil {
+		t.Error("0xEECD87")
+	}
+	if icmpErrorOf(errTimeout) != nil {
+		t.Error("0xEA21B3")
+	}
+}
+
+// (sd *Sender) handleReadError(conn netUDPConn, err error)
+//
+// go test -run Test_icmp_Sender_handleReadError_
+//
+func Test_icmp_Sender_handleReadError_(t *testing.T) {
+	sd := makeTestSender()
+	sd.Config.VerboseSender = false
+	sd.Address = "127.0.0.1:40486"
+	defer pathMTUs.Invalidate(sd.Address)
+	//
+	sd.handleReadError(nil, errTimeout)
+	if sd.failure() != nil || sd.takeMTUChanged() {
+		t.Error("0xED4286")
+	}
+	sd.handleReadError(nil, syscall.EHOSTUNREACH)
+	if !errors.Is(sd.failure(), ErrReceiverUnreachable) {
+		t.Error("0xE1A9B2")
+	}
+}
+
+// Send must fail quickly with ErrReceiverUnreachable
+// when nothing is listening at the destination port
+//
+// go test -run Test_icmp_Send_unreachable_
+//
+func Test_icmp_Send_unreachable_(t *testing.T) {
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:40486"
+	sd.Config.VerboseSender = false
+	sd.Config.ReplyTimeout = 5 * time.Second
+	t0 := time.Now()
+	err := sd.SendString("greeting", "Hello World!")
+	if !errors.Is(err, ErrReceiverUnreachable) {
+		t.Error("0xE9FE43", "wrong error:", err)
+	}
+	if time.Since(t0) >= sd.Config.ReplyTimeout {
+		t.Error("0xEB7649", "waited for timeout")
+	}
+}
+
+// end
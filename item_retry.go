@@ -0,0 +1,89 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[item_retry.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// ItemRetry specifies how a Sender retries delivering a whole data item
+// after all its packet retries have failed, so that callers don't need
+// to write the same retry loop around every call to Send.
+//
+// The delay before each retry is Backoff, doubled after every failed
+// attempt and limited to MaxBackoff. A random jitter of up to +/- 50%
+// is applied to each delay, so that many Senders that failed at the
+// same moment don't all retry at the same moment.
+//
+type ItemRetry struct {
+
+	// MaxAttempts is the maximum number of times Send tries to deliver a
+	// data item, including the first attempt. Zero or one disable retries.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry.
+	Backoff time.Duration
+
+	// MaxBackoff limits the delay between retries. Zero means no limit.
+	MaxBackoff time.Duration
+} //                                                                   ItemRetry
+
+// next returns the delay to wait before making the next attempt to
+// deliver an item, after 'attempt' attempts have failed with 'err'.
+// The jitter is read from 'random' (Configuration.Random), if not nil.
+// Returns false if the item should not be retried.
+func (ir *ItemRetry) next(attempt int, err error, random io.Reader,
+) (time.Duration, bool) {
+	if attempt >= ir.MaxAttempts || !isItemRetryable(err) {
+		return 0, false
+	}
+	delay := ir.Backoff
+	for i := 1; i < attempt; i++ {
+		if ir.MaxBackoff > 0 && delay >= ir.MaxBackoff ||
+			delay > math.MaxInt64/4 {
+			break
+		}
+		delay *= 2
+	}
+	if ir.MaxBackoff > 0 && delay > ir.MaxBackoff {
+		delay = ir.MaxBackoff
+	}
+	if delay > 1 {
+		delay = delay/2 + time.Duration(randomInt63n(random, int64(delay)))
+	}
+	return delay, true
+} //                                                                        next
+
+// validate returns an error if any of the settings is out of range.
+func (ir *ItemRetry) validate() error {
+	if ir.MaxAttempts < 0 {
+		return makeError(0xE667B0,
+			"invalid Configuration.ItemRetry.MaxAttempts:", ir.MaxAttempts)
+	}
+	if ir.Backoff < 0 {
+		return makeError(0xE5B6D6,
+			"invalid Configuration.ItemRetry.Backoff:", ir.Backoff)
+	}
+	if ir.MaxBackoff < 0 {
+		return makeError(0xEF8201,
+			"invalid Configuration.ItemRetry.MaxBackoff:", ir.MaxBackoff)
+	}
+	return nil
+} //                                                                    validate
+
+// isItemRetryable returns true if a data item that failed
+// with 'err' might be delivered by sending it again later.
+func isItemRetryable(err error) bool {
+	return errors.Is(err, ErrReceiverUnreachable) ||
+		errors.Is(err, ErrUndeliveredPackets) ||
+		errors.Is(err, ErrNoFirstReply) ||
+		errors.Is(err, ErrTransferStalled)
+} //                                                             isItemRetryable
+
+// end
@@ -0,0 +1,137 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /[item_retry_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_ItemRetry_*
+
+// -----------------------------------------------------------------------------
+
+// (ir *ItemRetry) next(attempt int, err error, random io.Reader,
+// ) (time.Duration, bool)
+//
+// go test -run Test_ItemRetry_next_
+//
+func Test_ItemRetry_next_(t *testing.T) {
+	ir := ItemRetry{MaxAttempts: 5, Backoff: 100 * time.Millisecond,
+		MaxBackoff: 300 * time.Millisecond}
+	//
+	// must not retry errors that retrying can't fix
+	if _, ok := ir.next(1, errors.New("invalid key"), nil); ok {
+		t.Error("0xE8FFEE")
+	}
+	// must not retry after the last attempt
+	if _, ok := ir.next(5, ErrReceiverUnreachable, nil); ok {
+		t.Error("0xE1AEE4")
+	}
+	for _, it := range []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 300 * time.Millisecond}, // limited by MaxBackoff
+		{4, 300 * time.Millisecond},
+	} {
+		err := makeError(0xE7F316, ErrUndeliveredPackets)
+		delay, ok := ir.next(it.attempt, err, nil)
+		if !ok || delay < it.base/2 || delay >= it.base*3/2 {
+			t.Error("0xEDFA56", "attempt:", it.attempt, "delay:", delay)
+		}
+	}
+	// zero attempts means no retries
+	ir.MaxAttempts = 0
+	if _, ok := ir.next(1, ErrReceiverUnreachable, nil); ok {
+		t.Error("0xE10003")
+	}
+	// the same random source must give the same delays
+	ir.MaxAttempts = 5
+	var delays [2][]time.Duration
+	for i := range delays {
+		random := rand.New(rand.NewSource(42))
+		for attempt := 1; attempt < 5; attempt++ {
+			delay, _ := ir.next(attempt, ErrUndeliveredPackets, random)
+			delays[i] = append(delays[i], delay)
+		}
+	}
+	if !reflect.DeepEqual(delays[0], delays[1]) {
+		t.Error("0xEBF0E2", delays)
+	}
+}
+
+// Send must retry a failed item Config.ItemRetry.MaxAttempts
+// times, before handing it to Config.DeadLetter
+//
+// go test -run Test_ItemRetry_Send_
+//
+func Test_ItemRetry_Send_(t *testing.T) {
+	var dl mockDeadLetter
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:40488"
+	sd.Config.VerboseSender = false
+	sd.Config.DeadLetter = &dl
+	sd.Config.ItemRetry = ItemRetry{MaxAttempts: 3, Backoff: time.Millisecond}
+	attempts := 0
+	connect := func() (netUDPConn, error) {
+		attempts++
+		return sd.connect()
+	}
+	err := sd.sendDI("k", []byte("v"), connect, sd.sendUndeliveredPackets)
+	if !errors.Is(err, ErrReceiverUnreachable) {
+		t.Error("0xE64A4D", "wrong error:", err)
+	}
+	if attempts != 3 {
+		t.Error("0xE98A12", "attempts:", attempts)
+	}
+	if len(dl.items) != 1 {
+		t.Error("0xEF8793", "dead letters:", len(dl.items))
+	}
+}
+
+// must not wait for a retry beyond Config.ItemTimeout
+func Test_ItemRetry_Send_2(t *testing.T) {
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:40488"
+	sd.Config.VerboseSender = false
+	sd.Config.ItemTimeout = time.Second
+	sd.Config.ItemRetry = ItemRetry{MaxAttempts: 3, Backoff: time.Hour}
+	attempts := 0
+	connect := func() (netUDPConn, error) {
+		attempts++
+		return sd.connect()
+	}
+	t0 := time.Now()
+	err := sd.sendDI("k", []byte("v"), connect, sd.sendUndeliveredPackets)
+	if !errors.Is(err, ErrItemTimeout) {
+		t.Error("0xE9C5B7", "wrong error:", err)
+	}
+	if elapsed := time.Since(t0); attempts != 1 || elapsed > 5*time.Second {
+		t.Error("0xE1D6A4", "attempts:", attempts, "elapsed:", elapsed)
+	}
+}
+
+// (ir *ItemRetry) validate() error
+//
+// go test -run Test_ItemRetry_validate_
+//
+func Test_ItemRetry_validate_(t *testing.T) {
+	cf := NewDefaultConfig()
+	cf.ItemRetry.Backoff = -1
+	err := cf.Validate()
+	if !matchError(err, "invalid Configuration.ItemRetry.Backoff") {
+		t.Error("0xE1C8C7", "wrong error:", err)
+	}
+}
+
+// end
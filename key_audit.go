@@ -0,0 +1,126 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[key_audit.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"math"
+	"sync"
+)
+
+// KeyAudit specifies what Senders and Receivers do when they start
+// with a weak encryption key (see Configuration.KeyAudit).
+type KeyAudit int
+
+const (
+	// KeyAuditOff doesn't check keys. This is the default.
+	KeyAuditOff KeyAudit = iota
+
+	// KeyAuditWarn logs an error for each weak key, once per key in
+	// each process, but still uses the key.
+	KeyAuditWarn
+
+	// KeyAuditRefuse makes Receiver.Run() and Sender.Send()
+	// fail with an error if any key is weak.
+	KeyAuditRefuse
+)
+
+// weakKeyMinEntropy is the minimum Shannon entropy, in bits per byte,
+// of a key that passes the audit. Random 16-byte keys have about 3.8.
+const weakKeyMinEntropy = 3.0
+
+// exampleKeys are keys published in the README and the demo, which
+// must never be used outside of them.
+var exampleKeys = [][]byte{
+	[]byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0"),
+}
+
+// keyAuditWarned holds the names and fingerprints of the weak
+// keys that KeyAuditWarn has already logged in this process.
+var keyAuditWarned sync.Map
+
+// auditedKey is a key checked by auditKeys(),
+// with the name of the setting that holds it.
+type auditedKey struct {
+	name string
+	key  []byte
+} //                                                                  auditedKey
+
+// auditKeys checks 'keys' according to Configuration.KeyAudit. Blank keys
+// are skipped. With KeyAuditWarn, each weak key is logged once with
+// 'logError', and nil is returned; with KeyAuditRefuse, returns an
+// error for the first weak key.
+func (cf *Configuration) auditKeys(
+	logError func(id uint32, a ...interface{}) error,
+	keys ...auditedKey,
+) error {
+	if cf.KeyAudit == KeyAuditOff {
+		return nil
+	}
+	for _, k := range keys {
+		if len(k.key) == 0 {
+			continue
+		}
+		reason := weakKeyReason(k.key)
+		if reason == "" {
+			continue
+		}
+		if cf.KeyAudit == KeyAuditRefuse {
+			return makeError(0xE5A1D7, "weak "+k.name+":", reason)
+		}
+		id := k.name + " " + KeyFingerprint(k.key)
+		if _, warned := keyAuditWarned.LoadOrStore(id, true); !warned {
+			_ = logError(0xE8B4E6, "WARNING: weak "+k.name+":", reason,
+				"- replace it with a random key before production use")
+		}
+	}
+	return nil
+} //                                                                   auditKeys
+
+// weakKeyReason returns why 'key' is weak, or a blank string if it
+// passes the audit: it must not be one of the example keys, repeat
+// one byte (e.g. all zeros), be a sequence like "abcdef...", or have
+// less than weakKeyMinEntropy bits of entropy per byte.
+func weakKeyReason(key []byte) string {
+	for _, ex := range exampleKeys {
+		if bytes.Equal(key, ex) {
+			return "it is the example key from the documentation"
+		}
+	}
+	if len(key) < 2 {
+		return "it is too short"
+	}
+	sequence := true
+	for i := 2; i < len(key); i++ {
+		if key[i]-key[i-1] != key[1]-key[0] {
+			sequence = false
+			break
+		}
+	}
+	switch {
+	case sequence && key[1] == key[0]:
+		return "all its bytes are the same"
+	case sequence:
+		return "its bytes are a sequence"
+	}
+	var counts [256]int
+	for _, b := range key {
+		counts[b]++
+	}
+	entropy := 0.0
+	for _, n := range counts {
+		if n > 0 {
+			p := float64(n) / float64(len(key))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	if entropy < weakKeyMinEntropy {
+		return "its entropy is too low"
+	}
+	return ""
+} //                                                               weakKeyReason
+
+// end
@@ -0,0 +1,101 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[key_audit_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// weakKeyReason(key []byte) string
+//
+// go test -run Test_weakKeyReason_
+//
+func Test_weakKeyReason_(t *testing.T) {
+	test := func(key []byte, want string) {
+		got := weakKeyReason(key)
+		if !strings.Contains(got, want) || (want == "") != (got == "") {
+			t.Error("0xE6A3F5", string(key), "got:", got, "want:", want)
+		}
+	}
+	test([]byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0"), "example key")
+	test(make([]byte, 32), "all its bytes are the same")
+	test(bytes.Repeat([]byte("k"), 16), "all its bytes are the same")
+	test([]byte("abcdefghijklmnopqrstuvwxyz"), "a sequence")
+	test([]byte("0000000011111111"), "entropy is too low")
+	test([]byte("abababababababababababababababab"), "entropy is too low")
+	test([]byte("Qd9#vL2pX7!mRz4T"), "")
+	test([]byte("7fK2wPq9Lx3Ns8Vb1Hc5Jd0Gt6Ry4Zm2"), "")
+}
+
+// (cf *Configuration) auditKeys(
+//     logError func(id uint32, a ...interface{}) error,
+//     keys ...auditedKey,
+// ) error
+//
+// go test -run Test_Configuration_auditKeys_
+//
+func Test_Configuration_auditKeys_(t *testing.T) {
+	weak := auditedKey{"Test.AuditKey", make([]byte, 32)}
+	var logged []uint32
+	logError := func(id uint32, a ...interface{}) error {
+		logged = append(logged, id)
+		return makeError(id, a...)
+	}
+	cf := NewDefaultConfig()
+	//
+	// must ignore weak keys by default
+	if err := cf.auditKeys(logError, weak); err != nil || len(logged) != 0 {
+		t.Error("0xE1F6B8", err, logged)
+	}
+	// must warn only once about the same key
+	cf.KeyAudit = KeyAuditWarn
+	for i := 0; i < 3; i++ {
+		if err := cf.auditKeys(logError, weak); err != nil {
+			t.Error("0xE7C2D5", err)
+		}
+	}
+	if len(logged) != 1 || logged[0] != 0xE8B4E6 {
+		t.Error("0xE3B9A4", logged)
+	}
+	// must refuse weak keys, but not blank ones
+	cf.KeyAudit = KeyAuditRefuse
+	err := cf.auditKeys(logError, auditedKey{"Test.Blank", nil}, weak)
+	if !matchError(err, "weak Test.AuditKey: all its bytes are the same") {
+		t.Error("0xE9D1C7", "wrong error:", err)
+	}
+	cf.KeyAudit = KeyAuditRefuse + 1
+	if cf.Validate() == nil {
+		t.Error("0xE4A8E3", "invalid KeyAudit accepted")
+	}
+}
+
+// Configuration.KeyAudit
+//
+// go test -run Test_KeyAudit_
+//
+// must refuse to run a Receiver or send with the example key
+func Test_KeyAudit_(t *testing.T) {
+	key := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	cf.KeyAudit = KeyAuditRefuse
+	rc := Receiver{
+		Port: 9860, CryptoKey: key, Config: cf,
+		Receive: func(k string, v []byte) error { return nil },
+	}
+	err := rc.Run()
+	if !matchError(err, "weak Receiver.CryptoKey: it is the example key") {
+		t.Error("0xE5C7F2", "wrong error:", err)
+	}
+	err = Send("127.0.0.1:9860", "k", []byte("v"), key, cf)
+	if !matchError(err, "weak Sender.CryptoKey: it is the example key") {
+		t.Error("0xE2E5B9", "wrong error:", err)
+	}
+}
+
+// end
@@ -0,0 +1,507 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[key_exchange.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// maxKeySessions is the number of addresses with which a Receiver keeps
+// session keys, and maxAddrSessions the number of session keys it keeps
+// for each address, so that a flood of handshakes can't make it use up
+// all its memory. The sessions that have been unused longest make way.
+const (
+	maxKeySessions  = 16384
+	maxAddrSessions = 4
+)
+
+// keySession is a session key that a Receiver has negotiated with the
+// Sender at one address. See Configuration.KeyExchange.
+type keySession struct {
+	cipher    SymmetricCipher // keyed with the session key, bound to AAD
+	senderKey []byte          // public key of the Sender
+	reply     []byte          // handshake reply, repeated if the Sender retries
+	sent      time.Time       // when the Sender made the handshake
+	last      time.Time       // when the session was last used
+	authentic bool            // the handshake was authenticated with a key
+} //                                                                  keySession
+
+// newKeyPair generates an ephemeral X25519 key pair, using random bytes
+// from 'random' (i.e. Configuration.Random) or, if nil, crypto/rand.
+func newKeyPair(random io.Reader) (*ecdh.PrivateKey, error) {
+	random = lockRandom(random)
+	if random == nil {
+		random = rand.Reader
+	}
+	key, err := ecdh.X25519().GenerateKey(random)
+	if err != nil {
+		return nil, makeError(0xE74190, err)
+	}
+	return key, nil
+} //                                                                  newKeyPair
+
+// handshakeVersionPrefix follows the public key in a handshake packet,
+// followed in turn by the sender's ProtocolVersion in decimal.
+// handshakeMACPrefix follows the public key, before the version, in a
+// handshake authenticated with a shared key, followed by its nonce,
+// the time when it was made, and its MAC.
+const (
+	handshakeVersionPrefix = "/v"
+	handshakeMACPrefix     = "/a"
+)
+
+// handshakeNonceSize is the size of the random nonce
+// in a handshake authenticated with a shared key.
+const handshakeNonceSize = 16
+
+// handshakePacket holds the fields of a handshake packet.
+type handshakePacket struct {
+	pub     []byte    // ephemeral public key
+	version int       // protocol version
+	nonce   []byte    // random nonce; nil if not authenticated
+	sent    time.Time // when it was made, if authenticated
+	mac     []byte    // nil if not authenticated (see handshakeMAC)
+} //                                                             handshakePacket
+
+// newHandshake returns a handshake carrying public key 'pub' and
+// protocol 'version', with a nonce from 'random' (i.e.
+// Configuration.Random) or, if nil, crypto/rand, if it
+// will be authenticated with a shared key ('authentic').
+func newHandshake(pub []byte, version int, authentic bool,
+	random io.Reader,
+) (*handshakePacket, error) {
+	hs := &handshakePacket{pub: pub, version: version}
+	if !authentic {
+		return hs, nil
+	}
+	random = lockRandom(random)
+	if random == nil {
+		random = rand.Reader
+	}
+	hs.nonce = make([]byte, handshakeNonceSize)
+	if _, err := io.ReadFull(random, hs.nonce); err != nil {
+		return nil, makeError(0xE5B2D9, err)
+	}
+	hs.sent = time.Now()
+	return hs, nil
+} //                                                                newHandshake
+
+// makeHandshake returns the packet of handshake 'hs'. Version 1 isn't
+// written in the packet, since peers of that version predate protocol
+// versions. If 'psk' isn't blank, the packet is authenticated with it
+// (see handshakeMAC); 'answer' is the handshake that 'hs' replies to,
+// or nil if 'hs' is the Sender's.
+func makeHandshake(hs *handshakePacket, psk []byte,
+	answer *handshakePacket,
+) []byte {
+	ret := append([]byte(tagHandshake), hs.pub...)
+	if len(psk) > 0 {
+		ret = append(ret, handshakeMACPrefix...)
+		ret = append(ret, hs.nonce...)
+		ret = binary.BigEndian.AppendUint64(ret, uint64(hs.sent.UnixNano()))
+		ret = append(ret, handshakeMAC(psk, hs, answer)...)
+	}
+	if hs.version > 1 {
+		ret = append(ret, handshakeVersionPrefix+strconv.Itoa(hs.version)...)
+	}
+	return ret
+} //                                                               makeHandshake
+
+// readHandshake reads a handshake packet made by makeHandshake().
+// Its MAC is nil if the handshake isn't authenticated.
+func readHandshake(recv []byte) (*handshakePacket, error) {
+	if !bytes.HasPrefix(recv, []byte(tagHandshake)) {
+		return nil, makeError(0xE2824C, "bad handshake header")
+	}
+	pub := recv[len(tagHandshake):]
+	if len(pub) < 32 {
+		return nil, makeError(0xE0F997, "bad handshake key")
+	}
+	hs := &handshakePacket{pub: pub[:32], version: 1}
+	rest := pub[32:]
+	if bytes.HasPrefix(rest, []byte(handshakeMACPrefix)) {
+		rest = rest[len(handshakeMACPrefix):]
+		if len(rest) < handshakeNonceSize+8+sha256.Size {
+			return nil, makeError(0xE5A7D2, "bad handshake MAC")
+		}
+		hs.nonce, rest = rest[:handshakeNonceSize], rest[handshakeNonceSize:]
+		hs.sent = time.Unix(0, int64(binary.BigEndian.Uint64(rest)))
+		hs.mac, rest = rest[8:8+sha256.Size], rest[8+sha256.Size:]
+	}
+	if bytes.HasPrefix(rest, []byte(handshakeVersionPrefix)) {
+		s := string(rest[len(handshakeVersionPrefix):])
+		version, err := strconv.Atoi(s)
+		if err != nil || version < 1 {
+			return nil, makeError(0xE6D04B, "bad handshake version")
+		}
+		hs.version = version
+		rest = nil
+	}
+	if len(rest) != 0 {
+		return nil, makeError(0xE0B8C5, "bad handshake key")
+	}
+	return hs, nil
+} //                                                               readHandshake
+
+// handshakeMAC returns the MAC that authenticates handshake 'hs' with
+// shared key 'psk', i.e. the CryptoKey of the Sender or the Receiver.
+// It covers the public key, nonce, time and version of 'hs' and, if
+// 'hs' is a reply, the public key, nonce and time of the handshake it
+// replies to ('answer'), so a reply can't be replayed to another one.
+func handshakeMAC(psk []byte, hs, answer *handshakePacket) []byte {
+	mac := hmac.New(sha256.New, psk)
+	write := func(hs *handshakePacket) {
+		mac.Write(hs.pub)
+		mac.Write(hs.nonce)
+		_ = binary.Write(mac, binary.BigEndian, hs.sent.UnixNano())
+	}
+	mac.Write([]byte(tagHandshake))
+	write(hs)
+	mac.Write([]byte(handshakeVersionPrefix + strconv.Itoa(hs.version)))
+	if answer != nil {
+		mac.Write([]byte(handshakeMACPrefix))
+		write(answer)
+	}
+	return mac.Sum(nil)
+} //                                                                handshakeMAC
+
+// sessionKey returns the 32-byte session key agreed between private key
+// 'priv' and the other end's public key 'peerKey'. Both ends derive it
+// from the shared secret and both public keys, 'senderKey' first, and
+// from the shared key 'psk', if the handshake was authenticated with it,
+// so that only peers that have that key can derive the session key.
+func sessionKey(priv *ecdh.PrivateKey, peerKey, senderKey, receiverKey,
+	psk []byte,
+) ([]byte, error) {
+	peer, err := ecdh.X25519().NewPublicKey(peerKey)
+	if err != nil {
+		return nil, makeError(0xE491B8, err)
+	}
+	secret, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, makeError(0xE3D01D, err) // e.g. a low-order point
+	}
+	hash := sha256.New()
+	if len(psk) > 0 {
+		hash = hmac.New(sha256.New, psk)
+	}
+	hash.Write([]byte(tagHandshake))
+	hash.Write(secret)
+	hash.Write(senderKey)
+	hash.Write(receiverKey)
+	return hash.Sum(nil), nil
+} //                                                                  sessionKey
+
+// newSessionCipher returns a new cipher of the same type and with the
+// same settings as 'cphr' (a built-in cipher), keyed with 'key'.
+func newSessionCipher(cphr SymmetricCipher, key []byte,
+) (SymmetricCipher, error) {
+	ret, err := cloneCipher(cphr)
+	if err != nil {
+		return nil, err
+	}
+	err = ret.SetKey(key)
+	if err != nil {
+		return nil, makeError(0xE0A824, err)
+	}
+	return ret, nil
+} //                                                            newSessionCipher
+
+// handshake negotiates a session key with the Receiver over 'conn', and
+// makes it the key of sd.cipher() until the next handshake. It resends
+// the handshake every Config.SendRetryInterval, for up to
+// Config.ReplyTimeout, then fails with ErrNoFirstReply. Fails with
+// ErrProtocolVersion if the Receiver's protocol version isn't supported.
+//
+// If the Sender has a CryptoKey, the handshake is authenticated with it,
+// and replies that aren't authenticated with the same key, or that reply
+// to another handshake, are ignored. It fails with ErrClockSkew if the
+// Receiver's clock is further off than Config.MaxClockSkew.
+//
+func (sd *Sender) handshake(conn netUDPConn) error {
+	sd.session = nil
+	priv, err := newKeyPair(sd.Config.Random)
+	if err != nil {
+		return err
+	}
+	hs, err := newHandshake(priv.PublicKey().Bytes(), ProtocolVersion,
+		len(sd.CryptoKey) > 0, sd.Config.Random)
+	if err != nil {
+		return err
+	}
+	interval := sd.Config.SendRetryInterval
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	buf := newReadBuffer(sd.Config.PacketSizeLimit)
+	deadline := time.Now().Add(sd.Config.ReplyTimeout)
+	for time.Now().Before(deadline) {
+		if err := sd.failure(); err != nil {
+			return err // e.g. the Send's context was cancelled
+		}
+		_, err = conn.Write(makeHandshake(hs, sd.CryptoKey, nil))
+		if err != nil {
+			return makeError(0xE31A8B, err)
+		}
+		resend := time.Now().Add(interval)
+		for time.Now().Before(resend) {
+			// 'buf' is overwritten after every readDatagram
+			recv, _, err := readDatagram(conn, time.Until(resend), buf,
+				sd.Config.PacketSizeLimit)
+			if err == errTimeout {
+				break
+			}
+			if err != nil {
+				return makeError(0xEF3943, err)
+			}
+			reply, err := readHandshake(recv)
+			if err != nil {
+				continue // e.g. a late reply to an earlier connection
+			}
+			if len(sd.CryptoKey) > 0 && !hmac.Equal(reply.mac,
+				handshakeMAC(sd.CryptoKey, reply, hs)) {
+				continue // e.g. a spoofed or stale reply
+			}
+			if len(sd.CryptoKey) > 0 {
+				err = checkClockSkew(time.Until(reply.sent),
+					sd.Config.MaxClockSkew)
+				if err != nil {
+					return makeError(0xE7B3D5, err, "Receiver at", sd.Address)
+				}
+			}
+			if !supportedProtocol(reply.version) {
+				return makeError(0xE7C4A1, ErrProtocolVersion,
+					reply.version, "of Receiver at", sd.Address)
+			}
+			key, err := sessionKey(priv, reply.pub, hs.pub, reply.pub,
+				sd.CryptoKey)
+			if err != nil {
+				return err
+			}
+			sd.session, err = newSessionCipher(sd.Config.Cipher, key)
+			return err
+		}
+	}
+	return makeError(0xE4BC9F, ErrNoFirstReply, "to key exchange handshake")
+} //                                                                   handshake
+
+// acceptHandshake replies to handshake packet 'recv' from the Sender at
+// 'addr', and keeps the session key negotiated with it to decrypt the
+// packets it sends from that address, until the session is unused for
+// Config.ItemExpiry. A handshake sent again gets the same reply.
+//
+// If the Receiver has a CryptoKey, only handshakes authenticated with
+// it, or with one of PreviousKeys, are accepted, and they replace the
+// earlier sessions of the address. Since such a handshake could have
+// been captured and replayed, it is refused if its nonce has been seen
+// before, if it was made before the handshake of the authentic session
+// it would replace, or at a time further off than Config.MaxClockSkew.
+// Otherwise, anyone can make a session,
+// so a new session is kept besides the earlier ones of the address,
+// instead of replacing them, up to maxAddrSessions.
+//
+// The reply is in the format of the Sender's protocol version. Senders
+// whose version isn't supported get no reply, and ErrProtocolVersion
+// is returned.
+//
+func (rc *Receiver) acceptHandshake(conn netUDPConn, addr net.Addr,
+	recv []byte,
+) error {
+	hs, err := readHandshake(recv)
+	if err != nil {
+		return err
+	}
+	psk, err := rc.handshakeKey(hs)
+	if err != nil {
+		return makeError(0xE8E2A6, err, "from", addr)
+	}
+	if !supportedProtocol(hs.version) {
+		return makeError(0xE2B95E, ErrProtocolVersion,
+			hs.version, "of Sender at", addr)
+	}
+	id := addr.String()
+	for _, ss := range rc.sessions[id] {
+		if bytes.Equal(ss.senderKey, hs.pub) {
+			ss.last = time.Now()
+			rc.sendReply(conn, addr, ss.reply) // the first reply was lost
+			return nil
+		}
+	}
+	if psk != nil {
+		err = rc.checkFresh(id, hs)
+		if err != nil {
+			return makeError(0xE8D6A3, err, "from", addr)
+		}
+	}
+	priv, err := newKeyPair(rc.Config.Random)
+	if err != nil {
+		return err
+	}
+	reply, err := newHandshake(priv.PublicKey().Bytes(), hs.version,
+		psk != nil, rc.Config.Random)
+	if err != nil {
+		return err
+	}
+	key, err := sessionKey(priv, hs.pub, hs.pub, reply.pub, psk)
+	if err != nil {
+		return err
+	}
+	cphr, err := newSessionCipher(rc.Config.Cipher, key)
+	if err != nil {
+		return err
+	}
+	cphr, err = bindAAD(cphr, rc.AAD)
+	if err != nil {
+		return makeError(0xEF18E7, err)
+	}
+	ss := &keySession{
+		cipher:    cphr,
+		senderKey: append([]byte(nil), hs.pub...),
+		reply:     makeHandshake(reply, psk, hs),
+		sent:      hs.sent,
+		last:      time.Now(),
+		authentic: psk != nil,
+	}
+	rc.addSession(id, ss)
+	if rc.Config.VerboseReceiver {
+		rc.logDebug("Receiver exchanged keys with", addr)
+	}
+	rc.sendReply(conn, addr, ss.reply)
+	return nil
+} //                                                             acceptHandshake
+
+// handshakeKey returns the key that authenticates handshake 'hs':
+// CryptoKey or one of PreviousKeys. Returns nil if the Receiver has
+// no CryptoKey and the handshake isn't authenticated, or an error if
+// the handshake can't be authenticated with any of the Receiver's keys.
+func (rc *Receiver) handshakeKey(hs *handshakePacket) ([]byte, error) {
+	if len(rc.CryptoKey) == 0 {
+		if hs.mac != nil {
+			return nil, makeError(0xE4D9B3,
+				"authenticated handshake, but no Receiver.CryptoKey")
+		}
+		return nil, nil
+	}
+	if hs.mac == nil {
+		return nil, makeError(0xE1C5E8, "handshake not authenticated")
+	}
+	for _, key := range append([][]byte{rc.CryptoKey}, rc.PreviousKeys...) {
+		if len(key) > 0 && hmac.Equal(hs.mac, handshakeMAC(key, hs, nil)) {
+			return key, nil
+		}
+	}
+	return nil, makeError(0xE6F8C4, "handshake authenticated with another key")
+} //                                                                handshakeKey
+
+// checkFresh returns an error if authenticated handshake 'hs', from the
+// Sender at address 'id', may have been replayed: if it was made at a
+// time further off than Config.MaxClockSkew (wrapping ErrClockSkew), if
+// its nonce has been seen, or if it was made before the handshake of an
+// authentic session of the address. Otherwise, it remembers the nonce.
+func (rc *Receiver) checkFresh(id string, hs *handshakePacket) error {
+	err := checkClockSkew(time.Until(hs.sent), rc.Config.MaxClockSkew)
+	if err != nil {
+		return err
+	}
+	for _, ss := range rc.sessions[id] {
+		if ss.authentic && !hs.sent.After(ss.sent) {
+			return makeError(0xE3F7C2, "stale handshake")
+		}
+	}
+	if rc.handshakes == nil {
+		rc.handshakes = newReplayWindow(maxKeySessions, 0)
+	}
+	if rc.handshakes.replayed(hs.nonce, nil, time.Time{}) {
+		return makeError(0xE9A4E6, "replayed handshake")
+	}
+	return nil
+} //                                                                  checkFresh
+
+// addSession keeps session 'ss', negotiated with the Sender at address
+// 'id'. An authenticated session replaces the address's earlier sessions,
+// while others are kept besides them, making way for the session that
+// has been unused longest once the address has maxAddrSessions. When
+// there are sessions for maxKeySessions addresses, the address whose
+// sessions have been unused longest is forgotten.
+func (rc *Receiver) addSession(id string, ss *keySession) {
+	if rc.sessions == nil {
+		rc.sessions = make(map[string][]*keySession)
+	}
+	list, ok := rc.sessions[id]
+	if !ok && len(rc.sessions) >= maxKeySessions {
+		var oldest string
+		var t0 time.Time
+		for k, l := range rc.sessions {
+			if last := l[0].last; t0.IsZero() || last.Before(t0) {
+				oldest, t0 = k, last
+			}
+		}
+		delete(rc.sessions, oldest)
+	}
+	if ss.authentic {
+		list = nil
+	}
+	if len(list) >= maxAddrSessions {
+		list = list[:maxAddrSessions-1]
+	}
+	rc.sessions[id] = append([]*keySession{ss}, list...)
+} //                                                                  addSession
+
+// decryptPacket decrypts 'data', a packet received from 'addr', with the
+// session keys negotiated with that address, if any, or with 'cphr',
+// into the memory of 'dst' if possible (see decryptTo). Returns the
+// plaintext, and the cipher with which to encrypt replies.
+func (rc *Receiver) decryptPacket(addr net.Addr, data, dst []byte,
+	cphr SymmetricCipher,
+) ([]byte, SymmetricCipher, error) {
+	if len(rc.sessions) > 0 {
+		if list := rc.sessions[addr.String()]; len(list) > 0 {
+			recv, err := decryptSession(list, data, dst)
+			if err != nil {
+				return nil, nil, makeError(0xE94893, err)
+			}
+			return recv, list[0].cipher, nil
+		}
+	}
+	recv, err := decryptTo(cphr, dst, data)
+	if err != nil {
+		return nil, nil, makeError(0xE5E9A3, err)
+	}
+	if ring, ok := cphr.(*keyRing); ok {
+		cphr = ring.last
+	}
+	return recv, cphr, nil
+} //                                                               decryptPacket
+
+// decryptSession decrypts 'data' with each session of 'list' in turn,
+// the last used first, into the memory of 'dst' if possible. The
+// session that decrypts it moves to the front of 'list'.
+func decryptSession(list []*keySession, data, dst []byte) ([]byte, error) {
+	var err error
+	for i, ss := range list {
+		var recv []byte
+		recv, err = decryptTo(ss.cipher, dst, data)
+		if err != nil {
+			continue
+		}
+		ss.last = time.Now()
+		copy(list[1:i+1], list[:i])
+		list[0] = ss
+		return recv, nil
+	}
+	return nil, err
+} //                                                              decryptSession
+
+// end
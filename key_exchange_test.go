@@ -0,0 +1,508 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[key_exchange_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// readHandshake(recv []byte) (*handshakePacket, error)
+//
+// go test -run Test_readHandshake_
+//
+func Test_readHandshake_(t *testing.T) {
+	pub := bytes.Repeat([]byte{7}, 32)
+	psk := []byte("handshake-key-0123456789abcdefgh")
+	for _, version := range []int{1, 2, 15} {
+		hs, _ := newHandshake(pub, version, false, nil)
+		got, err := readHandshake(makeHandshake(hs, nil, nil))
+		if err != nil || !bytes.Equal(got.pub, pub) ||
+			got.version != version || got.mac != nil || got.nonce != nil {
+			t.Error("0xE32B6B", version, got, err)
+		}
+		hs, _ = newHandshake(pub, version, true, nil)
+		got, err = readHandshake(makeHandshake(hs, psk, nil))
+		if err != nil || !bytes.Equal(got.pub, pub) ||
+			got.version != version || !bytes.Equal(got.nonce, hs.nonce) ||
+			!got.sent.Equal(hs.sent) ||
+			!bytes.Equal(got.mac, handshakeMAC(psk, hs, nil)) {
+			t.Error("0xE7D3A5", version, got, err)
+		}
+	}
+	test := func(recv, errSubstr string) {
+		_, err := readHandshake([]byte(recv))
+		if !matchError(err, errSubstr) {
+			t.Error("0xE66C9A", recv, "wrong error:", err)
+		}
+	}
+	test("", "bad handshake header")
+	test(tagConfirmation+string(pub), "bad handshake header")
+	test(tagHandshake+string(pub[:31]), "bad handshake key")
+	test(tagHandshake+string(pub)+"x", "bad handshake key")
+	test(tagHandshake+string(pub)+"/vx", "bad handshake version")
+	test(tagHandshake+string(pub)+"/v0", "bad handshake version")
+	test(tagHandshake+string(pub[:31])+"/v2", "bad handshake key")
+	test(tagHandshake+string(pub)+"/a"+string(pub), "bad handshake MAC")
+}
+
+// handshakeMAC(psk []byte, hs, answer *handshakePacket) []byte
+//
+// go test -run Test_handshakeMAC_
+//
+// must bind a reply to the handshake it answers,
+// and change with each field of the handshake
+func Test_handshakeMAC_(t *testing.T) {
+	psk := []byte("handshake-key-0123456789abcdefgh")
+	newHS := func(b byte) *handshakePacket {
+		hs, _ := newHandshake(bytes.Repeat([]byte{b}, 32), 2, true, nil)
+		return hs
+	}
+	hs, answer, other := newHS(1), newHS(2), newHS(2)
+	mac := handshakeMAC(psk, hs, answer)
+	if bytes.Equal(mac, handshakeMAC(psk, hs, nil)) ||
+		bytes.Equal(mac, handshakeMAC(psk, hs, other)) {
+		t.Error("0xE2C1B8", "reply not bound to the handshake it answers")
+	}
+	for i, change := range []func(hs *handshakePacket){
+		func(hs *handshakePacket) { hs.pub = bytes.Repeat([]byte{3}, 32) },
+		func(hs *handshakePacket) { hs.nonce = make([]byte, 16) },
+		func(hs *handshakePacket) { hs.sent = hs.sent.Add(1) },
+		func(hs *handshakePacket) { hs.version = 3 },
+	} {
+		changed := *hs
+		change(&changed)
+		if bytes.Equal(mac, handshakeMAC(psk, &changed, answer)) {
+			t.Error("0xE6E9D4", i)
+		}
+	}
+}
+
+// sessionKey(priv *ecdh.PrivateKey, peerKey, senderKey, receiverKey,
+//     psk []byte,
+// ) ([]byte, error)
+//
+// go test -run Test_sessionKey_
+//
+func Test_sessionKey_(t *testing.T) {
+	sender, _ := newKeyPair(nil)
+	receiver, _ := newKeyPair(nil)
+	sPub := sender.PublicKey().Bytes()
+	rPub := receiver.PublicKey().Bytes()
+	k1, err1 := sessionKey(sender, rPub, sPub, rPub, nil)
+	k2, err2 := sessionKey(receiver, sPub, sPub, rPub, nil)
+	if err1 != nil || err2 != nil || len(k1) != 32 || !bytes.Equal(k1, k2) {
+		t.Error("0xEA69E4", err1, err2)
+	}
+	// the shared key must change the session key
+	psk := []byte("handshake-key-0123456789abcdefgh")
+	k3, err3 := sessionKey(sender, rPub, sPub, rPub, psk)
+	k4, err4 := sessionKey(receiver, sPub, sPub, rPub, psk)
+	if err3 != nil || err4 != nil || len(k3) != 32 || !bytes.Equal(k3, k4) ||
+		bytes.Equal(k1, k3) {
+		t.Error("0xE2E7B4", err3, err4)
+	}
+	// a low-order public key would make the shared secret all zeros
+	_, err := sessionKey(sender, make([]byte, 32), sPub, rPub, nil)
+	if err == nil {
+		t.Error("0xED125A", "accepted a low-order public key")
+	}
+}
+
+// (rc *Receiver) acceptHandshake(conn netUDPConn, addr net.Addr,
+//     recv []byte,
+// ) error
+//
+// go test -run Test_Receiver_acceptHandshake_
+
+// must reply with its public key, and send the same reply
+// when the Sender repeats its handshake
+func Test_Receiver_acceptHandshake_(t *testing.T) {
+	rc := Receiver{Config: NewDefaultConfig()}
+	rc.Config.KeyExchange = true
+	conn := &mockNetUDPConn{}
+	addr := &mockNetAddr{network: "udp", addr: "127.8.9.10:11"}
+	sender, _ := newKeyPair(nil)
+	hs, _ := newHandshake(sender.PublicKey().Bytes(), 1, false, nil)
+	handshake := makeHandshake(hs, nil, nil)
+	for i := 0; i < 2; i++ {
+		err := rc.acceptHandshake(conn, addr, handshake)
+		if err != nil {
+			t.Fatal("0xE53347", err)
+		}
+	}
+	n := len(conn.written) / 2
+	if len(rc.sessions) != 1 || n != len(tagHandshake)+32 ||
+		!bytes.Equal(conn.written[:n], conn.written[n:]) {
+		t.Fatal("0xED0038", len(rc.sessions), len(conn.written))
+	}
+	// the session cipher must decrypt packets encrypted by the Sender
+	hs, _ = readHandshake(conn.written[:n])
+	key, _ := sessionKey(sender, hs.pub,
+		sender.PublicKey().Bytes(), hs.pub, nil)
+	cphr, _ := newSessionCipher(&aesCipher{}, key)
+	ciphertext, _ := cphr.Encrypt([]byte("abc"))
+	plaintext, reply, err := rc.decryptPacket(addr, ciphertext,
+		nil, rc.Config.Cipher)
+	if err != nil || string(plaintext) != "abc" ||
+		reply != rc.sessions[addr.String()][0].cipher {
+		t.Error("0xEFEB09", err)
+	}
+	err = rc.acceptHandshake(conn, addr, []byte(tagHandshake+"short"))
+	if !matchError(err, "bad handshake key") {
+		t.Error("0xEFC313", "wrong error:", err)
+	}
+}
+
+// must reply in the format of the Sender's protocol version,
+// and refuse Senders whose version isn't supported
+func Test_Receiver_acceptHandshake_2(t *testing.T) {
+	rc := Receiver{Config: NewDefaultConfig()}
+	rc.Config.KeyExchange = true
+	conn := &mockNetUDPConn{}
+	addr := &mockNetAddr{network: "udp", addr: "127.8.9.10:11"}
+	sender, _ := newKeyPair(nil)
+	newHS := func(version int) []byte {
+		hs, _ := newHandshake(sender.PublicKey().Bytes(), version, false, nil)
+		return makeHandshake(hs, nil, nil)
+	}
+	err := rc.acceptHandshake(conn, addr, newHS(ProtocolVersion))
+	if err != nil {
+		t.Fatal("0xE4E0B3", err)
+	}
+	reply, err := readHandshake(conn.written)
+	if err != nil || reply.version != ProtocolVersion {
+		t.Error("0xE5F1C8", reply, err)
+	}
+	conn.written = nil
+	err = rc.acceptHandshake(conn, &mockNetAddr{addr: "127.8.9.10:12"},
+		newHS(ProtocolVersion+1))
+	if !errors.Is(err, ErrProtocolVersion) || len(conn.written) != 0 {
+		t.Error("0xE0A97E", "wrong error:", err)
+	}
+}
+
+// with a CryptoKey, must only accept handshakes authenticated with it,
+// which replace the address's session, while unauthenticated sessions
+// are kept besides the earlier ones
+func Test_Receiver_acceptHandshake_3(t *testing.T) {
+	psk := []byte("handshake-key-0123456789abcdefgh")
+	rc := Receiver{Config: NewDefaultConfig(), CryptoKey: psk}
+	rc.Config.KeyExchange = true
+	conn := &mockNetUDPConn{}
+	addr := &mockNetAddr{network: "udp", addr: "127.8.9.10:11"}
+	var last *handshakePacket
+	newHS := func(psk []byte) []byte {
+		sender, _ := newKeyPair(nil)
+		last, _ = newHandshake(sender.PublicKey().Bytes(), ProtocolVersion,
+			psk != nil, nil)
+		return makeHandshake(last, psk, nil)
+	}
+	for _, it := range []struct {
+		psk       []byte
+		errSubstr string
+	}{
+		{nil, "handshake not authenticated"},
+		{[]byte("other-key-0123456789abcdefghijkl"), "with another key"},
+	} {
+		err := rc.acceptHandshake(conn, addr, newHS(it.psk))
+		if !matchError(err, it.errSubstr) || len(rc.sessions) != 0 {
+			t.Error("0xE9B3E6", "wrong error:", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		err := rc.acceptHandshake(conn, addr, newHS(psk))
+		if err != nil || len(rc.sessions[addr.String()]) != 1 {
+			t.Error("0xE4C2F7", i, err)
+		}
+	}
+	// the reply must be authenticated too, and bound to the handshake
+	reply, err := readHandshake(conn.written[len(conn.written)/2:])
+	if err != nil || !bytes.Equal(reply.mac, handshakeMAC(psk, reply, last)) {
+		t.Error("0xE8F5A9", err)
+	}
+	// without a CryptoKey, sessions must not replace each other
+	rc = Receiver{Config: rc.Config}
+	for i := 1; i <= maxAddrSessions+1; i++ {
+		err := rc.acceptHandshake(conn, addr, newHS(nil))
+		want := i
+		if want > maxAddrSessions {
+			want = maxAddrSessions
+		}
+		if err != nil || len(rc.sessions[addr.String()]) != want {
+			t.Error("0xE1A6D8", i, err, len(rc.sessions[addr.String()]))
+		}
+	}
+	err = rc.acceptHandshake(conn, addr, newHS(psk))
+	if !matchError(err, "no Receiver.CryptoKey") {
+		t.Error("0xE6C9B2", "wrong error:", err)
+	}
+}
+
+// with a CryptoKey, must refuse a replayed handshake, one made before
+// the authentic session of the address that it would replace, and one
+// made at a time further off than MaxClockSkew
+func Test_Receiver_acceptHandshake_4(t *testing.T) {
+	psk := []byte("handshake-key-0123456789abcdefgh")
+	rc := Receiver{Config: NewDefaultConfig(), CryptoKey: psk}
+	rc.Config.KeyExchange = true
+	conn := &mockNetUDPConn{}
+	addr := &mockNetAddr{network: "udp", addr: "127.8.9.10:11"}
+	other := &mockNetAddr{network: "udp", addr: "127.8.9.10:12"}
+	now := time.Now()
+	newHS := func(sent time.Time) []byte {
+		sender, _ := newKeyPair(nil)
+		hs, _ := newHandshake(sender.PublicKey().Bytes(), ProtocolVersion,
+			true, nil)
+		hs.sent = sent
+		return makeHandshake(hs, psk, nil)
+	}
+	older, newer := newHS(now.Add(-time.Second)), newHS(now)
+	if err := rc.acceptHandshake(conn, addr, newer); err != nil {
+		t.Fatal("0xE3A9F4", err)
+	}
+	session := rc.sessions[addr.String()][0]
+	err := rc.acceptHandshake(conn, addr, older)
+	if !matchError(err, "stale handshake") ||
+		rc.sessions[addr.String()][0] != session {
+		t.Error("0xE2B9F3", "wrong error:", err)
+	}
+	err = rc.acceptHandshake(conn, other, newer)
+	if !matchError(err, "replayed handshake") ||
+		len(rc.sessions[other.String()]) != 0 {
+		t.Error("0xE6D7A8", "wrong error:", err)
+	}
+	err = rc.acceptHandshake(conn, addr, newHS(now.Add(time.Second)))
+	if err != nil || rc.sessions[addr.String()][0] == session {
+		t.Error("0xE4C8A2", err)
+	}
+	skew := rc.Config.MaxClockSkew
+	for _, sent := range []time.Time{now.Add(2 * skew), now.Add(-2 * skew)} {
+		err = rc.acceptHandshake(conn, other, newHS(sent))
+		if !errors.Is(err, ErrClockSkew) ||
+			len(rc.sessions[other.String()]) != 0 {
+			t.Error("0xE9D2B6", "wrong error:", err)
+		}
+	}
+}
+
+// (rc *Receiver) addSession(id string, ss *keySession)
+//
+// go test -run Test_Receiver_addSession_
+//
+// must forget the address whose sessions have been unused
+// longest, once it has sessions for maxKeySessions addresses
+func Test_Receiver_addSession_(t *testing.T) {
+	var rc Receiver
+	now := time.Now()
+	for i := 0; i < maxKeySessions; i++ {
+		rc.addSession(strconv.Itoa(i),
+			&keySession{last: now.Add(time.Duration(i + 1))})
+	}
+	rc.sessions["7"][0].last = now
+	rc.addSession("new", &keySession{last: now})
+	if _, ok := rc.sessions["7"]; ok || len(rc.sessions) != maxKeySessions {
+		t.Error("0xE4F2D7", len(rc.sessions))
+	}
+}
+
+// (sd *Sender) handshake(conn netUDPConn) error
+//
+// go test -run Test_Sender_handshake_
+
+// a Sender and a Receiver without a shared key must transfer an item
+func Test_Sender_handshake_1(t *testing.T) {
+	newConfig := func() *Configuration {
+		cf := NewDefaultConfig()
+		cf.LogWriter = nil
+		cf.KeyExchange = true
+		return cf
+	}
+	received := make(chan string, 1)
+	rc := Receiver{
+		Port: 9891, Config: newConfig(), AAD: []byte("tenant"),
+		Receive: func(k string, v []byte) error {
+			received <- k + "=" + string(v)
+			return nil
+		},
+	}
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	sd := Sender{Address: "127.0.0.1:9891", Config: newConfig()}
+	err := sd.SendWithOptions("key", []byte("value"),
+		&SendOptions{AAD: []byte("tenant")})
+	if err != nil {
+		t.Error("0xE00D80", err)
+	}
+	select {
+	case got := <-received:
+		if got != "key=value" {
+			t.Error("0xE5B8D8", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("0xE6BF4C", "not received")
+	}
+}
+
+// must fail with ErrNoFirstReply if the Receiver doesn't reply
+func Test_Sender_handshake_2(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("0xED3F73", err)
+	}
+	defer conn.Close()
+	sd := makeTestSender()
+	sd.Address = conn.LocalAddr().String()
+	sd.Config.KeyExchange = true
+	sd.Config.ReplyTimeout = 100 * time.Millisecond
+	sd.Config.SendRetryInterval = 20 * time.Millisecond
+	sdConn, err := sd.connect()
+	if err != nil {
+		t.Fatal("0xEEBAEF", err)
+	}
+	defer sdConn.Close()
+	err = sd.handshake(sdConn)
+	if !errors.Is(err, ErrNoFirstReply) || sd.session != nil {
+		t.Error("0xEDF09D", "wrong error:", err)
+	}
+	// the handshake was sent again at each SendRetryInterval
+	buf := make([]byte, 100)
+	n := 0
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		if _, _, err := conn.ReadFrom(buf); err != nil {
+			break
+		}
+		n++
+	}
+	if n < 3 {
+		t.Error("0xE8650E", n)
+	}
+}
+
+// must fail with ErrProtocolVersion if the Receiver's
+// protocol version isn't supported
+func Test_Sender_handshake_3(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("0xE8C5D2", err)
+	}
+	defer conn.Close()
+	sd := makeTestSender()
+	sd.Address = conn.LocalAddr().String()
+	sd.Config.KeyExchange = true
+	go func() {
+		buf := make([]byte, 200)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		hs, _ := readHandshake(buf[:n])
+		receiver, _ := newKeyPair(nil)
+		reply, _ := newHandshake(receiver.PublicKey().Bytes(),
+			ProtocolVersion+1, len(sd.CryptoKey) > 0, nil)
+		_, _ = conn.WriteTo(makeHandshake(reply, sd.CryptoKey, hs), addr)
+	}()
+	sdConn, err := sd.connect()
+	if err != nil {
+		t.Fatal("0xE1C9E7", err)
+	}
+	defer sdConn.Close()
+	err = sd.handshake(sdConn)
+	if !errors.Is(err, ErrProtocolVersion) || sd.session != nil {
+		t.Error("0xE6A8F5", "wrong error:", err)
+	}
+}
+
+// Senders and Receivers with the same CryptoKey must transfer items
+// over authenticated handshakes, while a Sender with another key gets
+// no reply
+func Test_Sender_handshake_4(t *testing.T) {
+	key := []byte("handshake-key-0123456789abcdefgh")
+	newConfig := func() *Configuration {
+		cf := NewDefaultConfig()
+		cf.LogWriter = nil
+		cf.KeyExchange = true
+		cf.ReplyTimeout = 500 * time.Millisecond
+		return cf
+	}
+	received := make(chan string, 1)
+	rc := Receiver{
+		Port: 9851, CryptoKey: key, Config: newConfig(),
+		Receive: func(k string, v []byte) error {
+			received <- k + "=" + string(v)
+			return nil
+		},
+	}
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	sd := Sender{Address: "127.0.0.1:9851", CryptoKey: key, Config: newConfig()}
+	if err := sd.Send("key", []byte("value")); err != nil {
+		t.Error("0xE2D5C8", err)
+	}
+	select {
+	case got := <-received:
+		if got != "key=value" {
+			t.Error("0xE7B1E4", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("0xE3F8D6", "not received")
+	}
+	other := Sender{Address: "127.0.0.1:9851", Config: newConfig(),
+		CryptoKey: []byte("other-key-0123456789abcdefghijkl")}
+	other.Config.SendRetries = 1
+	err := other.Send("key", []byte("value"))
+	if !errors.Is(err, ErrNoFirstReply) {
+		t.Error("0xE9E4B7", "wrong error:", err)
+	}
+}
+
+// must fail with ErrClockSkew if the authenticated reply
+// was made at a time further off than MaxClockSkew
+func Test_Sender_handshake_5(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("0xE5F3A7", err)
+	}
+	defer conn.Close()
+	sd := makeTestSender()
+	sd.Address = conn.LocalAddr().String()
+	sd.CryptoKey = []byte("handshake-key-0123456789abcdefgh")
+	sd.Config.KeyExchange = true
+	sd.Config.MaxClockSkew = 30 * time.Second
+	go func() {
+		buf := make([]byte, 200)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		hs, _ := readHandshake(buf[:n])
+		receiver, _ := newKeyPair(nil)
+		reply, _ := newHandshake(receiver.PublicKey().Bytes(),
+			ProtocolVersion, true, nil)
+		reply.sent = reply.sent.Add(2 * sd.Config.MaxClockSkew)
+		_, _ = conn.WriteTo(makeHandshake(reply, sd.CryptoKey, hs), addr)
+	}()
+	sdConn, err := sd.connect()
+	if err != nil {
+		t.Fatal("0xE0A6C8", err)
+	}
+	defer sdConn.Close()
+	err = sd.handshake(sdConn)
+	if !errors.Is(err, ErrClockSkew) || sd.session != nil {
+		t.Error("0xE8B1F4", "wrong error:", err)
+	}
+}
+
+// end
@@ -0,0 +1,36 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /[key_fingerprint.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// keyFingerprintContext is hashed together with a key to make its
+// fingerprint, so the fingerprint differs from a plain SHA-256 hash
+// of the key that may be used or published somewhere else.
+const keyFingerprintContext = "udpt key fingerprint\x00"
+
+// KeyFingerprint returns a short fingerprint of 'cryptoKey',
+// e.g. "5C1F-9A0E-33B7-D2E4". Operators can compare the fingerprints
+// shown by a Sender and a Receiver to confirm that both ends are using
+// the same key, without revealing the key itself.
+//
+// Returns a blank string if the key is empty.
+//
+func KeyFingerprint(cryptoKey []byte) string {
+	if len(cryptoKey) == 0 {
+		return ""
+	}
+	hs := sha256.New()
+	hs.Write([]byte(keyFingerprintContext))
+	hs.Write(cryptoKey)
+	sum := hs.Sum(nil)
+	return fmt.Sprintf("%X-%X-%X-%X", sum[0:2], sum[2:4], sum[4:6], sum[6:8])
+} //                                                              KeyFingerprint
+
+// end
@@ -0,0 +1,34 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                           /[key_fingerprint_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"regexp"
+	"testing"
+)
+
+// KeyFingerprint(cryptoKey []byte) string
+//
+// go test -run Test_KeyFingerprint_
+//
+func Test_KeyFingerprint_(t *testing.T) {
+	key := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	fp := KeyFingerprint(key)
+	if !regexp.MustCompile(`^[0-9A-F]{4}(-[0-9A-F]{4}){3}$`).MatchString(fp) {
+		t.Error("0xEE924B", fp)
+	}
+	sd := Sender{CryptoKey: key}
+	rc := Receiver{CryptoKey: []byte(string(key))}
+	if sd.KeyFingerprint() != fp || rc.KeyFingerprint() != fp {
+		t.Error("0xE942D4")
+	}
+	other := KeyFingerprint([]byte("bA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0"))
+	if other == fp || KeyFingerprint(nil) != "" {
+		t.Error("0xEAC205")
+	}
+}
+
+// end
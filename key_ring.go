@@ -0,0 +1,107 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                       /[key_ring.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+)
+
+// keyRing is the SymmetricCipher of a Receiver that accepts several keys
+// (see Receiver.PreviousKeys). It holds a cipher for each key, starting
+// with the one for Receiver.CryptoKey, and decrypts packets with the
+// first one that succeeds. It isn't safe for concurrent use.
+type keyRing struct {
+	ciphers []SymmetricCipher
+
+	// last is the cipher that decrypted the last packet, with
+	// which the Receiver encrypts the replies to that packet
+	last SymmetricCipher
+} //                                                                     keyRing
+
+// newKeyCiphers returns a cipher for each of 'keys', of the same type and
+// with the same settings as 'cphr', which must be a built-in cipher.
+func newKeyCiphers(cphr SymmetricCipher, keys [][]byte,
+) ([]SymmetricCipher, error) {
+	var ret []SymmetricCipher
+	for i, key := range keys {
+		kc, err := cloneCipher(cphr)
+		if err != nil {
+			return nil, err
+		}
+		err = kc.SetKey(key)
+		if err != nil {
+			return nil, makeError(0xED67A5, "key", i, err)
+		}
+		ret = append(ret, kc)
+	}
+	return ret, nil
+} //                                                               newKeyCiphers
+
+// cloneCipher returns a new cipher without a key, of the same type and
+// with the same settings as 'cphr'. Only built-in ciphers can be cloned.
+func cloneCipher(cphr SymmetricCipher) (SymmetricCipher, error) {
+	switch c := cphr.(type) {
+	case *aesCipher:
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return &aesCipher{strict: c.strict, random: c.random}, nil
+	case *aeadCipher:
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return &aeadCipher{name: c.name, newAEAD: c.newAEAD,
+			strict: c.strict, random: c.random}, nil
+	}
+	return nil, makeError(0xEE6C42, "several keys require a built-in cipher")
+} //                                                                 cloneCipher
+
+// ValidateKey checks if 'cryptoKey' is acceptable for the first cipher.
+func (kr *keyRing) ValidateKey(cryptoKey []byte) error {
+	return kr.ciphers[0].ValidateKey(cryptoKey)
+} //                                                                 ValidateKey
+
+// SetKey sets the key of the first cipher. The Receiver sets the keys
+// of all the ciphers before it makes a keyRing.
+func (kr *keyRing) SetKey(cryptoKey []byte) error {
+	return kr.ciphers[0].SetKey(cryptoKey)
+} //                                                                      SetKey
+
+// Encrypt encrypts plaintext with the first cipher, i.e. Receiver.CryptoKey.
+func (kr *keyRing) Encrypt(plaintext []byte) ([]byte, error) {
+	return kr.ciphers[0].Encrypt(plaintext)
+} //                                                                     Encrypt
+
+// Decrypt tries to decrypt ciphertext with each cipher in turn, and
+// returns the error of the first cipher if none of them succeeds.
+func (kr *keyRing) Decrypt(ciphertext []byte) ([]byte, error) {
+	var first error
+	for _, cphr := range kr.ciphers {
+		plaintext, err := cphr.Decrypt(ciphertext)
+		if err == nil {
+			kr.last = cphr
+			return plaintext, nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return nil, first
+} //                                                                     Decrypt
+
+// acceptsKey returns true if the Receiver accepts packets
+// encrypted with 'key': CryptoKey or one of PreviousKeys.
+func (rc *Receiver) acceptsKey(key []byte) bool {
+	if bytes.Equal(rc.CryptoKey, key) {
+		return true
+	}
+	for _, pk := range rc.PreviousKeys {
+		if bytes.Equal(pk, key) {
+			return true
+		}
+	}
+	return false
+} //                                                                  acceptsKey
+
+// end
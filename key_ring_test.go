@@ -0,0 +1,139 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[key_ring_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// (kr *keyRing) Decrypt(ciphertext []byte) ([]byte, error)
+//
+// go test -run Test_keyRing_Decrypt_
+//
+func Test_keyRing_Decrypt_(t *testing.T) {
+	newKey := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	oldKey := []byte("0123456789abcdef0123456789abcdef")
+	current := &aesCipher{}
+	_ = current.SetKey(newKey)
+	previous, err := newKeyCiphers(current, [][]byte{oldKey})
+	if err != nil || len(previous) != 1 {
+		t.Fatal("0xEC6E22", err)
+	}
+	kr := &keyRing{ciphers: append([]SymmetricCipher{current}, previous...)}
+	for _, key := range [][]byte{newKey, oldKey} {
+		sender := &aesCipher{}
+		_ = sender.SetKey(key)
+		ciphertext, _ := sender.Encrypt([]byte("abc"))
+		plaintext, err := kr.Decrypt(ciphertext)
+		if err != nil || string(plaintext) != "abc" {
+			t.Error("0xEC392F", err)
+		}
+		// the reply must be encrypted with the Sender's key
+		reply, _ := kr.last.Encrypt([]byte("ok"))
+		plaintext, err = sender.Decrypt(reply)
+		if err != nil || string(plaintext) != "ok" {
+			t.Error("0xE6D593", err)
+		}
+	}
+	other := &aesCipher{}
+	_ = other.SetKey([]byte("ffffffffffffffffffffffffffffffff"))
+	ciphertext, _ := other.Encrypt([]byte("abc"))
+	_, err = kr.Decrypt(ciphertext)
+	if err == nil {
+		t.Error("0xE8CF31", "decrypted with an unknown key")
+	}
+}
+
+// newKeyCiphers(cphr SymmetricCipher, keys [][]byte,
+// ) ([]SymmetricCipher, error)
+//
+// go test -run Test_newKeyCiphers_
+//
+func Test_newKeyCiphers_(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	base := newTestAEADCipher().(*aeadCipher)
+	base.strict = true
+	ciphers, err := newKeyCiphers(base, [][]byte{key})
+	if err != nil {
+		t.Fatal("0xEDDC3D", err)
+	}
+	ac, ok := ciphers[0].(*aeadCipher)
+	if !ok || !ac.strict || !bytes.Equal(ac.cryptoKey, key) {
+		t.Error("0xE67D20", ciphers[0])
+	}
+	_, err = newKeyCiphers(&aesCipher{}, [][]byte{key, []byte("short")})
+	if !matchError(err, "key 1") {
+		t.Error("0xED92CD", "wrong error:", err)
+	}
+	_, err = newKeyCiphers(&plainCipher{}, [][]byte{key})
+	if !matchError(err, "several keys require a built-in cipher") {
+		t.Error("0xEF6C7A", "wrong error:", err)
+	}
+	ciphers, err = newKeyCiphers(&plainCipher{}, nil)
+	if err != nil || ciphers != nil {
+		t.Error("0xED4F56", err)
+	}
+}
+
+// (rc *Receiver) PreviousKeys
+//
+// go test -run Test_Receiver_PreviousKeys_
+
+// a Receiver must accept data items sent with its previous key, while
+// Senders switch to its new key
+func Test_Receiver_PreviousKeys_(t *testing.T) {
+	newKey := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	oldKey := []byte("0123456789abcdef0123456789abcdef")
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	received := make(chan string, 2)
+	rc := Receiver{
+		Port: 9890, CryptoKey: newKey, PreviousKeys: [][]byte{oldKey},
+		Config: cf,
+		Receive: func(k string, v []byte) error {
+			received <- k + "=" + string(v)
+			return nil
+		},
+	}
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	// each end needs its own Config, since the cipher holds the key
+	scf := NewDefaultConfig()
+	scf.LogWriter = nil
+	sd := Sender{Address: "127.0.0.1:9890", CryptoKey: oldKey, Config: scf}
+	err := sd.Send("old", []byte("key"))
+	if err != nil {
+		t.Error("0xEDF157", err)
+	}
+	err = sd.SetKey(newKey)
+	if err != nil {
+		t.Fatal("0xEEE73B", err)
+	}
+	err = sd.Send("new", []byte("key"))
+	if err != nil {
+		t.Error("0xEACA45", err)
+	}
+	for _, want := range []string{"old=key", "new=key"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Error("0xEE06A6", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("0xE51872", "not received:", want)
+		}
+	}
+	if !rc.acceptsKey(oldKey) || !rc.acceptsKey(newKey) ||
+		rc.acceptsKey([]byte("ffffffffffffffffffffffffffffffff")) {
+		t.Error("0xE6737D")
+	}
+}
+
+// end
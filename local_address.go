@@ -0,0 +1,67 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[local_address.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"net/netip"
+)
+
+// localUDPAddr returns the local address from which a Sender sends
+// to 'raddr': LocalAddress, an address of Interface in the same family
+// as 'raddr', or nil if neither is specified. The port is zero.
+func (cf *Configuration) localUDPAddr(raddr *net.UDPAddr,
+) (*net.UDPAddr, error) {
+	if cf.LocalAddress.IsValid() {
+		return net.UDPAddrFromAddrPort(
+			netip.AddrPortFrom(cf.LocalAddress, 0)), nil
+	}
+	if cf.Interface == "" {
+		return nil, nil
+	}
+	ifc, err := net.InterfaceByName(cf.Interface)
+	if err != nil {
+		return nil, makeError(0xE5A2D7, "Configuration.Interface:", err)
+	}
+	addrs, err := ifc.Addrs()
+	if err != nil {
+		return nil, makeError(0xE8C6F5, "Configuration.Interface:", err)
+	}
+	want4 := raddr.AddrPort().Addr().Unmap().Is4()
+	var linkLocal *net.UDPAddr
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok || ip.Unmap().Is4() != want4 {
+			continue
+		}
+		ip = ip.Unmap()
+		if ip.IsLinkLocalUnicast() { // used if there are no others
+			if linkLocal == nil {
+				if ip.Is6() {
+					ip = ip.WithZone(ifc.Name)
+				}
+				linkLocal = net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, 0))
+			}
+			continue
+		}
+		return net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, 0)), nil
+	}
+	if linkLocal != nil {
+		return linkLocal, nil
+	}
+	family := "IPv6"
+	if want4 {
+		family = "IPv4"
+	}
+	return nil, makeError(0xE3F8B4, "Configuration.Interface",
+		cf.Interface, "has no", family, "address")
+} //                                                                localUDPAddr
+
+// end
@@ -0,0 +1,68 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /[local_address_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+)
+
+// (cf *Configuration) localUDPAddr(raddr *net.UDPAddr,
+// ) (*net.UDPAddr, error)
+//
+// go test -run Test_Configuration_localUDPAddr_
+
+// must bind Senders to LocalAddress, or to an address of Interface
+// in the family of the Receiver's address
+func Test_Configuration_localUDPAddr_(t *testing.T) {
+	var laddr *net.UDPAddr
+	dial := func(network string, la, ra *net.UDPAddr) (netUDPConn, error) {
+		laddr = la
+		return netDialUDP(network, la, ra)
+	}
+	sd := Sender{Config: NewDefaultConfig(), Address: "127.0.0.1:9876"}
+	sd.Config.LogWriter = nil
+	conn, err := sd.connectDI(dial)
+	if err != nil || laddr != nil {
+		t.Fatal("0xE2B7A5", err, laddr)
+	}
+	_ = conn.Close()
+	//
+	sd.Config.LocalAddress = netip.MustParseAddr("127.0.0.1")
+	sd.LocalPort = 9868
+	conn, err = sd.connectDI(dial)
+	if err != nil || laddr.String() != "127.0.0.1:9868" {
+		t.Fatal("0xE9E4C1", err, laddr)
+	}
+	_ = conn.Close()
+	if sd.Config.Interface = "lo"; sd.Config.Validate() == nil {
+		t.Error("0xE5C1F8", "accepted LocalAddress and Interface")
+	}
+	// the loopback interface
+	sd.Config.LocalAddress = netip.Addr{}
+	sd.LocalPort = 0
+	ifcs, _ := net.Interfaces()
+	for _, ifc := range ifcs {
+		if ifc.Flags&net.FlagLoopback != 0 {
+			sd.Config.Interface = ifc.Name
+			break
+		}
+	}
+	conn, err = sd.connectDI(dial)
+	if err != nil || !laddr.IP.IsLoopback() || laddr.IP.To4() == nil {
+		t.Fatal("0xE7A3D6", err, laddr)
+	}
+	_ = conn.Close()
+	//
+	sd.Config.Interface = "no-such-interface"
+	_, err = sd.connectDI(dial)
+	if !matchError(err, "Configuration.Interface") {
+		t.Error("0xE1F6B2", "wrong error:", err)
+	}
+}
+
+// end
@@ -0,0 +1,129 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                         /[logger.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// Logger receives the diagnostics of Senders and Receivers as structured
+// log records, so applications can route them to their own logging
+// pipelines. Assign it to Config.Logger.
+//
+// Each message comes with 'fields': alternating keys and values, as
+// in log/slog. They always include "component" ("sender" or "receiver"),
+// and the errors passed to Error also include "id", the ID of the error
+// in the form "0xE12345".
+//
+// Its methods may be called from several goroutines at the same time.
+//
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+} //                                                                      Logger
+
+// defaultLogger holds the Logger set by SetDefaultLogger(). It is read
+// each time a message is logged, so all goroutines use the new Logger
+// as soon as it is set.
+var defaultLogger atomic.Pointer[loggerHolder]
+
+// loggerHolder holds a Logger in defaultLogger,
+// which can't store an interface directly.
+type loggerHolder struct {
+	lg Logger
+} //                                                                loggerHolder
+
+// SetDefaultLogger sets the Logger that receives the log messages of
+// all the Senders and Receivers whose Config has neither a Logger nor a
+// LogWriter, e.g. to redirect or silence them after startup. Passing
+// nil restores the initial behavior, which is not to log anything.
+// It is safe to call while Senders and Receivers are running.
+func SetDefaultLogger(lg Logger) {
+	defaultLogger.Store(&loggerHolder{lg: lg})
+} //                                                            SetDefaultLogger
+
+// DefaultLogger returns the Logger set by SetDefaultLogger(), or nil.
+func DefaultLogger() Logger {
+	if h := defaultLogger.Load(); h != nil {
+		return h.lg
+	}
+	return nil
+} //                                                               DefaultLogger
+
+// logger returns the Logger to which messages are logged: Config.Logger,
+// or DefaultLogger() if Config (which can be nil) has neither a Logger
+// nor a LogWriter. Returns nil if messages go to LogWriter, or nowhere.
+func (cf *Configuration) logger() Logger {
+	switch {
+	case cf == nil:
+		return DefaultLogger()
+	case cf.Logger != nil:
+		return cf.Logger
+	case cf.LogWriter != nil:
+		return nil
+	}
+	return DefaultLogger()
+} //                                                                      logger
+
+// slogLogger is a Logger that writes to a log/slog Logger.
+type slogLogger struct {
+	lg *slog.Logger
+} //                                                                  slogLogger
+
+// NewSlogLogger returns a Logger that writes to 'lg',
+// or to slog.Default() if 'lg' is nil.
+// E.g. sender.Config.Logger = NewSlogLogger(slog.Default())
+func NewSlogLogger(lg *slog.Logger) Logger {
+	if lg == nil {
+		lg = slog.Default()
+	}
+	return &slogLogger{lg: lg}
+} //                                                               NewSlogLogger
+
+// Debug logs 'msg' at slog.LevelDebug.
+func (sl *slogLogger) Debug(msg string, fields ...interface{}) {
+	sl.lg.Debug(msg, fields...)
+} //                                                                       Debug
+
+// Info logs 'msg' at slog.LevelInfo.
+func (sl *slogLogger) Info(msg string, fields ...interface{}) {
+	sl.lg.Info(msg, fields...)
+} //                                                                        Info
+
+// Error logs 'msg' at slog.LevelError.
+func (sl *slogLogger) Error(msg string, fields ...interface{}) {
+	sl.lg.Error(msg, fields...)
+} //                                                                       Error
+
+// errorRecord returns the message and fields with which logError()
+// passes error 'err' with ID 'id' to a Logger. The message doesn't
+// repeat the ID, which is in the "id" field.
+func errorRecord(component string, id uint32, err error,
+) (string, []interface{}) {
+	tag := fmt.Sprintf("0x%06X", id)
+	msg := strings.TrimPrefix(err.Error(), "ERROR "+tag+": ")
+	return msg, []interface{}{"component", component, "id", tag}
+} //                                                                 errorRecord
+
+// logMessage returns the message that logInfo() and logDebug() pass to
+// a Logger, without the blank lines and the lines of dashes that
+// separate messages in LogWriter. Returns "" if nothing is left.
+func logMessage(a ...interface{}) string {
+	var lines []string
+	for _, ln := range strings.Split(fmt.Sprintln(a...), "\n") {
+		ln = strings.TrimSpace(ln)
+		if strings.Trim(ln, "-") != "" {
+			lines = append(lines, ln)
+		}
+	}
+	return strings.Join(lines, " ")
+} //                                                                  logMessage
+
+// end
@@ -0,0 +1,203 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[logger_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testLogger is a Logger that records each message
+// as "level msg field=value ...".
+type testLogger struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (tl *testLogger) log(level, msg string, fields ...interface{}) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	s := level + " " + msg
+	for i := 0; i+1 < len(fields); i += 2 {
+		s += fmt.Sprint(" ", fields[i], "=", fields[i+1])
+	}
+	tl.records = append(tl.records, s)
+}
+
+func (tl *testLogger) Debug(msg string, fields ...interface{}) {
+	tl.log("DEBUG", msg, fields...)
+}
+
+func (tl *testLogger) Info(msg string, fields ...interface{}) {
+	tl.log("INFO", msg, fields...)
+}
+
+func (tl *testLogger) Error(msg string, fields ...interface{}) {
+	tl.log("ERROR", msg, fields...)
+}
+
+// NewSlogLogger(lg *slog.Logger) Logger
+//
+// go test -run Test_NewSlogLogger_
+//
+func Test_NewSlogLogger_(t *testing.T) {
+	var sb strings.Builder
+	lg := NewSlogLogger(slog.New(slog.NewTextHandler(&sb,
+		&slog.HandlerOptions{
+			Level: slog.LevelInfo,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})))
+	lg.Debug("hidden")
+	lg.Info("received: a", "component", "receiver")
+	lg.Error("bad", "component", "sender", "id", "0xE12345")
+	want := "level=INFO msg=\"received: a\" component=receiver\n" +
+		"level=ERROR msg=bad component=sender id=0xE12345\n"
+	if got := sb.String(); got != want {
+		t.Error("0xE9B01D", got)
+	}
+	if NewSlogLogger(nil).(*slogLogger).lg != slog.Default() {
+		t.Error("0xEE3E82")
+	}
+}
+
+// logMessage(a ...interface{}) string
+//
+// go test -run Test_logMessage_
+//
+func Test_logMessage_(t *testing.T) {
+	test := func(want string, a ...interface{}) {
+		if got := logMessage(a...); got != want {
+			t.Error("0xEA92D3", got, "want:", want)
+		}
+	}
+	test("")
+	test("", strings.Repeat("-", 80))
+	test("read 5 bytes", "read", 5, "bytes")
+	test("Sending a (3 bytes)",
+		"\n"+strings.Repeat("-", 80)+"\n"+"Sending a", "(3 bytes)")
+}
+
+// (sd *Sender) logError(id uint32, a ...interface{}) error
+// (sd *Sender) logDebug(a ...interface{})
+//
+// go test -run Test_Sender_Logger_
+//
+func Test_Sender_Logger_(t *testing.T) {
+	var tl testLogger
+	var sb strings.Builder
+	sd := makeTestSender()
+	sd.Config.Logger = &tl
+	sd.Config.LogWriter = &sb
+	err := sd.logError(0xE12345, "abc", makeError(0xE54321, "def"))
+	if !matchError(err, "ERROR 0xE12345: abc def") {
+		t.Error("0xE2D266", err)
+	}
+	sd.logInfo("ok")
+	sd.logDebug(strings.Repeat("-", 80))
+	sd.logDebug("Reconnecting to", sd.Address)
+	want := []string{
+		"ERROR abc def component=sender id=0xE12345",
+		"INFO ok component=sender",
+		"DEBUG Reconnecting to " + sd.Address + " component=sender",
+	}
+	if fmt.Sprint(tl.records) != fmt.Sprint(want) {
+		t.Error("0xE9FB57", tl.records)
+	}
+	// LogWriter isn't used when there's a Logger
+	if sb.Len() != 0 {
+		t.Error("0xE1CA33", sb.String())
+	}
+}
+
+// (rc *Receiver) logError(id uint32, a ...interface{}) error
+// (rc *Receiver) logInfo(a ...interface{})
+//
+// go test -run Test_Receiver_Logger_
+//
+func Test_Receiver_Logger_(t *testing.T) {
+	var tl testLogger
+	rc := Receiver{Config: NewDefaultConfig()}
+	rc.Config.Logger = &tl
+	_ = rc.logError(0xE12345, "error text")
+	rc.logInfo("received:", "key")
+	rc.logDebug()
+	want := []string{
+		"ERROR error text component=receiver id=0xE12345",
+		"INFO received: key component=receiver",
+	}
+	if fmt.Sprint(tl.records) != fmt.Sprint(want) {
+		t.Error("0xE159D0", tl.records)
+	}
+}
+
+// SetDefaultLogger(lg Logger)
+//
+// go test -run Test_SetDefaultLogger_
+//
+// must log to the default Logger only when Config has no Logger or
+// LogWriter, and switch Loggers safely while others are logging
+func Test_SetDefaultLogger_(t *testing.T) {
+	defer SetDefaultLogger(nil)
+	var first, second, own testLogger
+	SetDefaultLogger(&first)
+	sd := Sender{Config: NewDefaultConfig()}
+	rc := Receiver{}
+	_ = sd.logError(0xE12345, "sender error")
+	rc.logInfo("received:", "key")
+	want := []string{
+		"ERROR sender error component=sender id=0xE12345",
+		"INFO received: key component=receiver",
+	}
+	if fmt.Sprint(first.records) != fmt.Sprint(want) {
+		t.Error("0xE6B2D8", first.records)
+	}
+	// a Config with its own Logger or LogWriter isn't redirected
+	var sb strings.Builder
+	sd.Config.LogWriter = &sb
+	sd.logInfo("to LogWriter")
+	rc.Config = NewDefaultConfig()
+	rc.Config.Logger = &own
+	rc.logInfo("to own Logger")
+	if len(first.records) != 2 || sb.String() != "to LogWriter\n" ||
+		len(own.records) != 1 {
+		t.Error("0xE1D9A4", first.records, sb.String(), own.records)
+	}
+	// replace the default Logger while goroutines are logging
+	rc.Config.Logger = nil
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				rc.logInfo("message")
+			}
+		}()
+	}
+	SetDefaultLogger(&second)
+	wg.Wait()
+	first.mu.Lock()
+	n := len(first.records)
+	first.mu.Unlock()
+	if n+len(second.records) != 2+400 || DefaultLogger() != &second {
+		t.Error("0xE8F3C5", n, len(second.records))
+	}
+	SetDefaultLogger(nil)
+	rc.logInfo("not logged")
+	if DefaultLogger() != nil || n+len(second.records) != 2+400 {
+		t.Error("0xE4A7B1", "logged after SetDefaultLogger(nil)")
+	}
+}
+
+// end
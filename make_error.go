@@ -14,13 +14,39 @@ import (
 
 // makeError returns a new error instance by joining 'id' and 'a'.
 // The ID is formatted as a 6-digit hex string. e.g. "0xE12345"
+//
+// If any of the arguments in 'a' is an error, the returned error wraps
+// the first one, so errors.Is() can still match errors like
+// ErrReceiverUnreachable after they've been logged and returned.
+//
 func makeError(id uint32, a ...interface{}) error {
 	rx := regexp.MustCompile(`ERROR 0x[0-9a-fA-F]*: `)
 	m := joinArgs("", a...)
 	m = string(rx.ReplaceAll([]byte(m), []byte("")))
 	m = fmt.Sprintf("ERROR 0x%06X: ", id) + m
 	m = strings.TrimSpace(m)
+	for _, arg := range a {
+		if err, ok := arg.(error); ok && err != nil {
+			return &wrappedError{msg: m, err: err}
+		}
+	}
 	return errors.New(m)
 } //                                                                   makeError
 
+// wrappedError is an error with its own message, wrapping another error.
+type wrappedError struct {
+	msg string
+	err error
+} //                                                                wrappedError
+
+// Error returns the message of the error and implements the error interface.
+func (we *wrappedError) Error() string {
+	return we.msg
+} //                                                                       Error
+
+// Unwrap returns the wrapped error, for use by errors.Is() and errors.As().
+func (we *wrappedError) Unwrap() error {
+	return we.err
+} //                                                                      Unwrap
+
 // end
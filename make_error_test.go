@@ -6,6 +6,7 @@
 package udpt
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -49,4 +50,18 @@ func Test_makeError_(t *testing.T) {
 	}
 }
 
+// makeError must wrap the first error argument, so errors.Is() finds it
+func Test_makeError_3(t *testing.T) {
+	a := makeError(0xE04085, ErrReceiverUnreachable, "at", "127.0.0.1:9876")
+	b := makeError(0xEF313C, "send failed:", a)
+	if !errors.Is(b, ErrReceiverUnreachable) {
+		t.Error("0xE62DE4")
+	}
+	want := "ERROR 0x" + "EF313C: send failed: " +
+		"receiver unreachable at 127.0.0.1:9876"
+	if got := b.Error(); got != want {
+		t.Error("0xE97523", "got:", got)
+	}
+}
+
 // end
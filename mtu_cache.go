@@ -0,0 +1,102 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[mtu_cache.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"sync"
+	"time"
+)
+
+// pathMTUs is the path MTU cache shared by all Senders in this process.
+var pathMTUs = newMTUCache()
+
+// mtuCache remembers the path MTU discovered for each destination address,
+// so that a Sender doesn't need to re-discover it for every data item.
+//
+// Entries are added when a path MTU is discovered, or when only the
+// small packets of a data item get through (see Sender.reportPathLoss).
+// They expire after Config.MTUCacheExpiry, and are discarded earlier
+// when large packets to the destination keep getting lost, which usually
+// means the route has changed and the cached MTU no longer fits.
+//
+type mtuCache struct {
+	mu      sync.Mutex
+	entries map[string]*mtuEntry
+} //                                                                    mtuCache
+
+// mtuEntry holds the cached path MTU of a single destination.
+type mtuEntry struct {
+	mtu     int       // path MTU in bytes
+	expires time.Time // the entry is ignored after this time
+	losses  int       // consecutive items in which large packets were lost
+} //                                                                    mtuEntry
+
+// newMTUCache creates and returns a new, empty mtuCache.
+func newMTUCache() *mtuCache {
+	return &mtuCache{entries: make(map[string]*mtuEntry)}
+} //                                                                 newMTUCache
+
+// Get returns the cached path MTU of destination 'addr' and true,
+// or zero and false if there is no entry or the entry has expired.
+func (mc *mtuCache) Get(addr string) (mtu int, ok bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	en := mc.entries[addr]
+	if en == nil {
+		return 0, false
+	}
+	if time.Now().After(en.expires) {
+		delete(mc.entries, addr)
+		return 0, false
+	}
+	return en.mtu, true
+} //                                                                         Get
+
+// Put stores the path MTU of destination 'addr' for the 'expiry' duration.
+// If 'mtu' or 'expiry' is not positive, Put removes the entry instead.
+func (mc *mtuCache) Put(addr string, mtu int, expiry time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mtu < 1 || expiry <= 0 {
+		delete(mc.entries, addr)
+		return
+	}
+	mc.entries[addr] = &mtuEntry{mtu: mtu, expires: time.Now().Add(expiry)}
+} //                                                                         Put
+
+// Invalidate removes the cached path MTU of destination 'addr'.
+func (mc *mtuCache) Invalidate(addr string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	delete(mc.entries, addr)
+} //                                                                  Invalidate
+
+// ReportLoss records whether large packets to 'addr' were lost while
+// sending a data item. When such losses occur in 'limit' consecutive
+// items, the entry is invalidated and ReportLoss returns true.
+//
+// A 'limit' of zero disables invalidation on loss.
+//
+func (mc *mtuCache) ReportLoss(addr string, lostLarge bool, limit int) bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	en := mc.entries[addr]
+	if en == nil {
+		return false
+	}
+	if !lostLarge {
+		en.losses = 0
+		return false
+	}
+	en.losses++
+	if limit < 1 || en.losses < limit {
+		return false
+	}
+	delete(mc.entries, addr)
+	return true
+} //                                                                  ReportLoss
+
+// end
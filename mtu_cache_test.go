@@ -0,0 +1,140 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[mtu_cache_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_mtuCache_*
+
+// -----------------------------------------------------------------------------
+
+// (mc *mtuCache) Get(addr string) (mtu int, ok bool)
+// (mc *mtuCache) Put(addr string, mtu int, expiry time.Duration)
+//
+// go test -run Test_mtuCache_Get_
+//
+func Test_mtuCache_Get_(t *testing.T) {
+	mc := newMTUCache()
+	if mtu, ok := mc.Get("127.0.0.1:9876"); mtu != 0 || ok {
+		t.Error("0xE9F96E")
+	}
+	mc.Put("127.0.0.1:9876", 1400, time.Minute)
+	if mtu, ok := mc.Get("127.0.0.1:9876"); mtu != 1400 || !ok {
+		t.Error("0xEB2514")
+	}
+	// expired entries must not be returned
+	mc.entries["127.0.0.1:9876"].expires = time.Now().Add(-time.Second)
+	if mtu, ok := mc.Get("127.0.0.1:9876"); mtu != 0 || ok {
+		t.Error("0xE4DA4E")
+	}
+	if len(mc.entries) != 0 {
+		t.Error("0xE7373C")
+	}
+	// a zero expiry removes the entry
+	mc.Put("127.0.0.1:9876", 1400, time.Minute)
+	mc.Put("127.0.0.1:9876", 1400, 0)
+	if _, ok := mc.Get("127.0.0.1:9876"); ok {
+		t.Error("0xE0A4BF")
+	}
+}
+
+// (mc *mtuCache) ReportLoss(addr string, lostLarge bool, limit int) bool
+//
+// go test -run Test_mtuCache_ReportLoss_
+//
+func Test_mtuCache_ReportLoss_(t *testing.T) {
+	mc := newMTUCache()
+	mc.Put("a:1", 1400, time.Minute)
+	if mc.ReportLoss("a:1", true, 3) || mc.ReportLoss("a:1", true, 3) {
+		t.Error("0xEB39C8")
+	}
+	// an item without losses resets the count
+	if mc.ReportLoss("a:1", false, 3) || mc.ReportLoss("a:1", true, 3) {
+		t.Error("0xEBE5FE")
+	}
+	if mc.ReportLoss("a:1", true, 3) {
+		t.Error("0xE6E554")
+	}
+	if !mc.ReportLoss("a:1", true, 3) {
+		t.Error("0xE755B2")
+	}
+	if _, ok := mc.Get("a:1"); ok {
+		t.Error("0xEECD4F")
+	}
+	// a zero limit never invalidates
+	mc.Put("a:1", 1400, time.Minute)
+	for i := 0; i < 10; i++ {
+		if mc.ReportLoss("a:1", true, 0) {
+			t.Error("0xE9912F")
+		}
+	}
+}
+
+// (sd *Sender) payloadSize() int
+//
+// go test -run Test_Sender_payloadSize_
+//
+func Test_Sender_payloadSize_(t *testing.T) {
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:40485"
+	defer pathMTUs.Invalidate(sd.Address)
+	//
+	if n := sd.payloadSize(); n != sd.Config.PacketPayloadSize {
+		t.Error("0xE57E99", "got:", n)
+	}
+	pathMTUs.Put(sd.Address, 700, time.Minute)
+	want := 700 - ipUDPHeaderSize - packetHeaderReserve - sequenceHeaderSize
+	if n := sd.payloadSize(); n != want {
+		t.Error("0xE5C6CB", "got:", n)
+	}
+	// an MTU bigger than the configured packet size changes nothing
+	pathMTUs.Put(sd.Address, 9000, time.Minute)
+	if n := sd.payloadSize(); n != sd.Config.PacketPayloadSize {
+		t.Error("0xE40023", "got:", n)
+	}
+}
+
+// (sd *Sender) reportPathLoss()
+//
+// go test -run Test_Sender_reportPathLoss_
+//
+// must cache a safe MTU when only the small packets of an item got
+// through, and leave the cache alone when small packets were lost too
+func Test_Sender_reportPathLoss_(t *testing.T) {
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:40489"
+	sd.Config.MTUCacheExpiry = time.Minute
+	sd.Config.PacketPayloadSize = 900
+	defer pathMTUs.Invalidate(sd.Address)
+	hash := []byte("hash")
+	delivered := func(size int) senderPacket {
+		return senderPacket{data: make([]byte, size),
+			sentHash: hash, confirmedHash: hash}
+	}
+	lost := func(size int) senderPacket {
+		return senderPacket{data: make([]byte, size), sentHash: hash}
+	}
+	sd.packets = []senderPacket{lost(1400), delivered(1400), lost(100)}
+	sd.reportPathLoss()
+	if _, ok := pathMTUs.Get(sd.Address); ok {
+		t.Error("0xE8B5C2", "cached an MTU after random losses")
+	}
+	sd.packets = []senderPacket{lost(1400), lost(1400), delivered(100)}
+	sd.reportPathLoss()
+	mtu, ok := pathMTUs.Get(sd.Address)
+	if !ok || mtu != minSafeDatagramSize+ipUDPHeaderSize {
+		t.Error("0xE2D7A9", "got:", mtu, ok)
+	}
+	if n := sd.payloadSize(); n+packetHeaderReserve > minSafeDatagramSize {
+		t.Error("0xE6C4F1", "payload too large:", n)
+	}
+}
+
+// end
@@ -0,0 +1,135 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[multicast.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"time"
+)
+
+// Multicast distribution (see Sender.Multicast and Receiver.Group) sends
+// each piece of a data item once to a multicast group or a broadcast
+// address, so that every Receiver listening there gets it in one pass.
+//
+// Receivers reply to the Sender's own address as usual: a piece counts
+// as delivered once any Receiver confirms it. The Receivers that missed
+// pieces list them in NACKs (see Configuration.NackDelay), and the
+// Sender sends those pieces to the whole group again, even if other
+// Receivers have confirmed them. Once every piece has been confirmed,
+// the Sender keeps listening for NACKs for twice NackDelay, and the
+// Send completes when none arrive.
+
+// groupConn is the connection of a Sender in Multicast mode: a socket
+// that isn't connected to the group address, so that it can read the
+// replies of all the Receivers, and writes each packet to the group.
+type groupConn struct {
+	*net.UDPConn
+	group *net.UDPAddr
+} //                                                                   groupConn
+
+// dialGroup returns a groupConn bound to the local address 'laddr',
+// which writes to the multicast group or broadcast address 'raddr'.
+func dialGroup(network string, laddr, raddr *net.UDPAddr,
+) (netUDPConn, error) {
+	conn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err // unwrapped, so bindPort() can retry in-use ports
+	}
+	return groupConn{UDPConn: conn, group: raddr}, nil
+} //                                                                   dialGroup
+
+// Write writes a packet to the group.
+func (gc groupConn) Write(b []byte) (int, error) {
+	return gc.UDPConn.WriteTo(b, gc.group)
+} //                                                                       Write
+
+// validateMulticast checks that the Sender's settings work in Multicast
+// mode: Receivers only ask for missing pieces if Config.NackDelay is set,
+// and a session key can't be negotiated with a whole group.
+func (sd *Sender) validateMulticast() error {
+	if !sd.Multicast {
+		return nil
+	}
+	if sd.Config.NackDelay <= 0 {
+		return errors.New("Sender.Multicast requires Config.NackDelay")
+	}
+	if sd.Config.KeyExchange {
+		return errors.New("Sender.Multicast can't use Config.KeyExchange")
+	}
+	return nil
+} //                                                           validateMulticast
+
+// repairPiece marks packet 'pk', which a Receiver in the group reported
+// missing in a NACK, as undelivered, so that it is sent to the group
+// again, even though another Receiver has already confirmed it.
+func (sd *Sender) repairPiece(pk *senderPacket) {
+	pk.confirmedHash = nil
+	for i := range pk.subPackets {
+		pk.subPackets[i].confirmedHash = nil
+	}
+	if sd.Config.OnProgress == nil {
+		return
+	}
+	size := len(pk.data) - (bytes.IndexByte(pk.data, '\n') + 1)
+	sd.mu.Lock()
+	sd.progress -= int64(size) // added again when it's confirmed
+	sd.mu.Unlock()
+} //                                                                 repairPiece
+
+// awaitRepairs waits for NACKs from the Receivers in the group once
+// every piece of the data item has been confirmed. Returns true as soon
+// as a NACK makes pieces to be sent again, or false if none arrives for
+// twice Config.NackDelay, or the Send fails.
+func (sd *Sender) awaitRepairs() bool {
+	deadline := time.Now().Add(2 * sd.Config.NackDelay)
+	for time.Now().Before(deadline) {
+		if sd.takeNacked() {
+			return true
+		}
+		if sd.failure() != nil {
+			return false
+		}
+		time.Sleep(sd.Config.SendWaitInterval)
+	}
+	return sd.takeNacked()
+} //                                                                awaitRepairs
+
+// listenGroup returns a connection that has joined multicast group
+// Receiver.Group on Config.Interface, or on an interface chosen by the
+// system if it is blank, listening at the port of 'laddr'.
+func (rc *Receiver) listenGroup(laddr *net.UDPAddr) (netUDPConn, error) {
+	var ifc *net.Interface
+	if name := rc.Config.Interface; name != "" {
+		var err error
+		ifc, err = net.InterfaceByName(name)
+		if err != nil {
+			return nil, makeError(0xE4B8D2, "Configuration.Interface:", err)
+		}
+	}
+	group := &net.UDPAddr{IP: net.ParseIP(rc.Group), Port: laddr.Port}
+	conn, err := net.ListenMulticastUDP(rc.Config.network(), ifc, group)
+	if err != nil {
+		return nil, err
+	}
+	return watchOverflows(conn, &rc.counters.packetsDropped), nil
+} //                                                                 listenGroup
+
+// validateGroup checks that Receiver.Group, if specified,
+// is the IP address of a multicast group.
+func (rc *Receiver) validateGroup() error {
+	if rc.Group == "" {
+		return nil
+	}
+	ip := net.ParseIP(rc.Group)
+	if ip == nil || !ip.IsMulticast() {
+		return makeError(0xE7C1A9, "invalid Receiver.Group:", rc.Group)
+	}
+	return nil
+} //                                                               validateGroup
+
+// end
@@ -0,0 +1,142 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[multicast_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// (sd *Sender) repairPiece(pk *senderPacket)
+//
+// go test -run Test_Sender_repairPiece_
+
+// must resend pieces that a NACK reports as missing in Multicast mode,
+// even if another Receiver has confirmed them
+func Test_Sender_repairPiece_(t *testing.T) {
+	sd := makeTestSender()
+	sd.key, sd.comp = "key", []byte(strings.Repeat("x", 1000))
+	sd.dataHash = getHash([]byte("value"))
+	sd.Config.PacketPayloadSize = 100
+	_ = sd.makePackets(sd.key, sd.comp)
+	for i := range sd.packets {
+		sd.packets[i].sendCount = 1
+		sd.packets[i].sentHash = getHash(sd.packets[i].data)
+		sd.packets[i].confirmedHash = sd.packets[i].sentHash
+	}
+	missing := make([]bool, len(sd.packets))
+	missing[3] = true
+	nack := makeNack(sd.key, sd.dataHash, missing, 0, true)
+	//
+	// without Multicast, confirmed pieces stay delivered
+	sd.receiveNack(nack)
+	if !sd.DeliveredAllParts() || sd.takeNacked() {
+		t.Error("0xE6B9D1", sd.countDelivered())
+	}
+	sd.Multicast = true
+	sd.receiveNack(nack)
+	if sd.countDelivered() != len(sd.packets)-1 ||
+		sd.packets[3].IsDelivered() || !sd.takeNacked() {
+		t.Error("0xE2E4C8", sd.countDelivered())
+	}
+}
+
+// (sd *Sender) validateMulticast() error
+//
+// go test -run Test_Sender_validateMulticast_
+
+// must require NackDelay and refuse KeyExchange in Multicast mode
+func Test_Sender_validateMulticast_(t *testing.T) {
+	sd := makeTestSender()
+	sd.Multicast = true
+	sd.Config.NackDelay = time.Second
+	if err := sd.validateMulticast(); err != nil {
+		t.Error("0xE5D8A6", err)
+	}
+	sd.Config.NackDelay = 0
+	if err := sd.validateMulticast(); err == nil {
+		t.Error("0xE9C2B5", "NackDelay zero accepted")
+	}
+	sd.Config.NackDelay = time.Second
+	sd.Config.KeyExchange = true
+	if err := sd.validateMulticast(); err == nil {
+		t.Error("0xE1F7D4", "KeyExchange accepted")
+	}
+}
+
+// Sender.Multicast, Receiver.Group
+//
+// go test -run Test_Sender_Multicast_
+
+// must deliver a data item to every Receiver in the group
+func Test_Sender_Multicast_(t *testing.T) {
+	const group = "239.77.0.1"
+	skipWithoutMulticast(t, group, 9865)
+	key := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	var mu sync.Mutex
+	got := map[int][]byte{}
+	for i := 0; i < 2; i++ {
+		i := i
+		rc := Receiver{
+			Port: 9866, Group: group, CryptoKey: key,
+			Config: NewDefaultConfig(),
+			Receive: func(k string, v []byte) error {
+				mu.Lock()
+				defer mu.Unlock()
+				got[i] = v
+				return nil
+			},
+		}
+		rc.Config.LogWriter = nil
+		go func() { _ = rc.Run() }()
+		defer func() { rc.Stop() }()
+	}
+	time.Sleep(500 * time.Millisecond)
+	//
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	cf.NackDelay = 200 * time.Millisecond
+	sd := Sender{
+		Address: group + ":9866", CryptoKey: key, Config: cf, Multicast: true,
+	}
+	value := bytes.Repeat([]byte("multicast "), 1000)
+	if err := sd.Send("k", value); err != nil {
+		t.Fatal("0xE8D5F3", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if !bytes.Equal(got[0], value) || !bytes.Equal(got[1], value) {
+		t.Error("0xE3B6C9", len(got[0]), len(got[1]))
+	}
+}
+
+// skipWithoutMulticast skips the test if a datagram sent to multicast
+// 'group' at 'port' doesn't arrive, e.g. without a multicast interface.
+func skipWithoutMulticast(t *testing.T, group string, port int) {
+	addr := &net.UDPAddr{IP: net.ParseIP(group), Port: port}
+	conn, err := net.ListenMulticastUDP("udp4", nil, addr)
+	if err != nil {
+		t.Skip("multicast is not available:", err)
+	}
+	defer conn.Close()
+	out, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		t.Skip("multicast is not available:", err)
+	}
+	defer out.Close()
+	_, _ = out.WriteTo([]byte("probe"), addr)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadFrom(make([]byte, 16)); err != nil {
+		t.Skip("multicast is not available:", err)
+	}
+}
+
+// end
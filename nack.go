@@ -0,0 +1,215 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                           /[nack.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// nackRepeatLimit is the number of NACKs a Receiver sends for a data item
+// while no more of its fragments arrive, before giving up on the Sender.
+const nackRepeatLimit = 3
+
+// nackState tracks the fragments arriving for the data item being
+// received, so that the Receiver can send the Sender a NACK listing the
+// missing pieces when fragments stop arriving before the item is complete.
+type nackState struct {
+	addr   net.Addr        // address of the Sender
+	cipher SymmetricCipher // that decrypted the Sender's packets, or nil
+	key    string          // key of the data item
+	hash   []byte          // hash of the data item
+	count  int             // number of pieces, or 0 if no item is incomplete
+	last   time.Time       // when the last fragment arrived
+	sent   int             // number of NACKs sent since then
+	caps   Capabilities    // advertised by the Sender
+} //                                                                   nackState
+
+// note records that the fragment with header 'h' has arrived.
+// The Receiver's read loop sets 'addr'.
+func (ns *nackState) note(h *fragmentHeader) {
+	ns.key = h.key
+	ns.hash = h.hash
+	ns.count = h.packetCount
+	ns.caps = h.caps
+	ns.last = time.Now()
+	ns.sent = 0
+} //                                                                        note
+
+// nackReport contains the details read from a NACK packet. Pieces before
+// 'from' have been received. From 'from' onwards, each bit of 'bitmap'
+// is set if the corresponding piece is missing. The bitmap reports on
+// 'bits' pieces. Pieces beyond them are not reported on.
+type nackReport struct {
+	key    string
+	hash   []byte
+	count  int
+	from   int
+	bitmap []byte
+	bits   int
+} //                                                                  nackReport
+
+// makeNack returns a NACK packet reporting which of the pieces of the
+// data item with key 'k' and hash 'hash' are 'missing', starting from
+// the first missing piece. Returns nil if no piece is missing.
+//
+// The pieces are reported in a bitmap of up to 'maxBits' bits, rounded
+// down to whole bytes, so that the unused bits of the last byte only
+// follow the last piece. If the bitmap of an item with many pieces
+// would be cut short, the missing pieces come in runs, and 'runs' is
+// true because the Sender advertised CapNackRuns, the bitmap is sent
+// run-length encoded instead (see encodeNackRuns), which often
+// reports on all of the pieces in the same number of bytes.
+//
+func makeNack(k string, hash []byte, missing []bool, maxBits int,
+	runs bool,
+) []byte {
+	from := -1
+	for i, miss := range missing {
+		if miss {
+			from = i
+			break
+		}
+	}
+	if from == -1 {
+		return nil
+	}
+	n := len(missing) - from
+	limit := maxBits / 8 * 8
+	if limit > 0 && n > limit {
+		if runs {
+			encoded, covered := encodeNackRuns(missing[from:], limit/8)
+			if covered > limit {
+				header := tagNack + fmt.Sprintf(
+					"key:%s hash:%X count:%d runs:%d from:%d\n",
+					k, hash, len(missing), covered, from)
+				return append([]byte(header), encoded...)
+			}
+		}
+		n = limit
+	}
+	bitmap := make([]byte, (n+7)/8)
+	for i := 0; i < n; i++ {
+		if missing[from+i] {
+			bitmap[i/8] |= 1 << (i % 8)
+		}
+	}
+	header := tagNack + fmt.Sprintf("key:%s hash:%X count:%d from:%d\n",
+		k, hash, len(missing), from)
+	return append([]byte(header), bitmap...)
+} //                                                                    makeNack
+
+// encodeNackRuns encodes the bitmap of 'missing' pieces as the lengths of
+// its runs of missing and received pieces, alternately, starting with a
+// run of missing pieces. Each length is written as a uvarint. Only whole
+// runs are encoded, up to 'maxBytes' bytes. Returns the encoded runs and
+// the number of pieces they cover.
+func encodeNackRuns(missing []bool, maxBytes int) ([]byte, int) {
+	var ret []byte
+	var buf [binary.MaxVarintLen64]byte
+	covered := 0
+	for covered < len(missing) {
+		run, miss := 1, missing[covered]
+		for covered+run < len(missing) && missing[covered+run] == miss {
+			run++
+		}
+		n := binary.PutUvarint(buf[:], uint64(run))
+		if len(ret)+n > maxBytes {
+			break
+		}
+		ret = append(ret, buf[:n]...)
+		covered += run
+	}
+	return ret, covered
+} //                                                              encodeNackRuns
+
+// decodeNackRuns expands runs encoded by encodeNackRuns() into a bitmap
+// of 'bits' pieces. Returns an error if the runs don't add up to 'bits'.
+func decodeNackRuns(runs []byte, bits int) ([]byte, error) {
+	bitmap := make([]byte, (bits+7)/8)
+	at, miss := 0, true
+	for len(runs) > 0 {
+		run, n := binary.Uvarint(runs)
+		if n <= 0 || run < 1 || run > uint64(bits-at) {
+			return nil, makeError(0xEFC2F9, "bad run of pieces")
+		}
+		runs = runs[n:]
+		if miss {
+			for i := at; i < at+int(run); i++ {
+				bitmap[i/8] |= 1 << (i % 8)
+			}
+		}
+		at += int(run)
+		miss = !miss
+	}
+	if at != bits {
+		return nil, makeError(0xE2FE37, "runs don't cover all pieces")
+	}
+	return bitmap, nil
+} //                                                              decodeNackRuns
+
+// readNack reads a NACK packet made by makeNack().
+func readNack(recv []byte) (*nackReport, error) {
+	if !bytes.HasPrefix(recv, []byte(tagNack)) {
+		return nil, makeError(0xE4E072, "missing header")
+	}
+	end := bytes.IndexByte(recv, '\n')
+	if end == -1 {
+		return nil, makeError(0xE5BD2E, "newline not found")
+	}
+	s := string(recv[len(tagNack) : end+1])
+	var nr nackReport
+	var err error
+	nr.key = getPart(s, "key:", " ")
+	nr.hash, err = hex.DecodeString(getPart(s, "hash:", " "))
+	if err != nil || len(nr.hash) != 32 {
+		return nil, makeError(0xE20002, "bad hash")
+	}
+	nr.count, err = strconv.Atoi(getPart(s, "count:", " "))
+	if err != nil || nr.count < 1 {
+		return nil, makeError(0xE0093C, "bad 'count'")
+	}
+	nr.from, err = strconv.Atoi(getPart(s, "from:", "\n"))
+	if err != nil || nr.from < 0 || nr.from >= nr.count {
+		return nil, makeError(0xEA6DC5, "bad 'from'")
+	}
+	if !bytes.Contains(recv[:end], []byte(" runs:")) {
+		nr.bitmap = recv[end+1:]
+		nr.bits = len(nr.bitmap) * 8
+		return &nr, nil
+	}
+	nr.bits, err = strconv.Atoi(getPart(s, " runs:", " "))
+	if err != nil || nr.bits < 1 || nr.bits > nr.count-nr.from {
+		return nil, makeError(0xE1FAED, "bad 'runs'")
+	}
+	nr.bitmap, err = decodeNackRuns(recv[end+1:], nr.bits)
+	if err != nil {
+		return nil, makeError(0xE311CD, err)
+	}
+	return &nr, nil
+} //                                                                    readNack
+
+// missing returns true if the NACK reports piece 'i' as missing.
+func (nr *nackReport) missing(i int) bool {
+	i -= nr.from
+	return i >= 0 && i < nr.bits && nr.bitmap[i/8]&(1<<(i%8)) != 0
+} //                                                                     missing
+
+// received returns true if the NACK reports piece 'i' as received.
+func (nr *nackReport) received(i int) bool {
+	if i < nr.from {
+		return true
+	}
+	i -= nr.from
+	return i < nr.bits && nr.bitmap[i/8]&(1<<(i%8)) == 0
+} //                                                                    received
+
+// end
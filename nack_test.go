@@ -0,0 +1,124 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[nack_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"testing"
+)
+
+// makeNack(k string, hash []byte, missing []bool, maxBits int,
+//     runs bool,
+// ) []byte
+// readNack(recv []byte) (*nackReport, error)
+//
+// go test -run Test_makeNack_
+//
+func Test_makeNack_(t *testing.T) {
+	hash := getHash([]byte("value"))
+	missing := make([]bool, 40)
+	missing[3], missing[5], missing[20], missing[39] = true, true, true, true
+	//
+	nr, err := readNack(makeNack("key", hash, missing, 0, true))
+	if err != nil {
+		t.Fatal("0xE1FDF6", err)
+	}
+	if nr.key != "key" || !bytes.Equal(nr.hash, hash) ||
+		nr.count != 40 || nr.from != 3 || len(nr.bitmap) != 5 {
+		t.Error("0xEF8C55", nr.key, nr.count, nr.from, len(nr.bitmap))
+	}
+	for i, miss := range missing {
+		if nr.missing(i) != miss || nr.received(i) == miss {
+			t.Error("0xEAE587", i)
+		}
+	}
+	// 'maxBits' is rounded down to whole bytes,
+	// and pieces beyond the bitmap are not reported
+	nr, err = readNack(makeNack("key", hash, missing, 20, true))
+	if err != nil || len(nr.bitmap) != 2 {
+		t.Fatal("0xE67B49", err)
+	}
+	if !nr.missing(5) || nr.missing(20) || nr.received(20) {
+		t.Error("0xE7856D")
+	}
+	// nothing to report
+	if ret := makeNack("key", hash, make([]bool, 40), 0, true); ret != nil {
+		t.Error("0xE04E43", string(ret))
+	}
+	for _, s := range []string{
+		"NACK:key:key hash:00 count:40 from:3\n",
+		"NACK:key:key count:40 from:3",
+	} {
+		if _, err := readNack([]byte(s)); err == nil {
+			t.Error("0xE0D1DD", s)
+		}
+	}
+}
+
+// must run-length encode the bitmap of an item with many pieces,
+// when the bitmap wouldn't fit
+func Test_makeNack_2(t *testing.T) {
+	hash := getHash([]byte("value"))
+	missing := make([]bool, 200000)
+	for i := 1000; i < 200000; i += 10000 {
+		for j := i; j < i+500; j++ {
+			missing[j] = true
+		}
+	}
+	packet := makeNack("key", hash, missing, 8*1000, true)
+	if len(packet) > 1200 {
+		t.Error("0xE332FE", len(packet))
+	}
+	nr, err := readNack(packet)
+	if err != nil {
+		t.Fatal("0xE6A668", err)
+	}
+	if nr.from != 1000 || nr.bits != 199000 {
+		t.Error("0xEFD5F6", nr.from, nr.bits)
+	}
+	for i, miss := range missing {
+		if nr.missing(i) != miss || nr.received(i) == miss {
+			t.Error("0xE9B7EA", i)
+			break
+		}
+	}
+	// with a smaller limit, only the first whole runs are reported,
+	// still more pieces than a bitmap of 32 bits would cover
+	nr, err = readNack(makeNack("key", hash, missing, 32, true))
+	if err != nil || nr.bits != 10000 || !nr.missing(1499) ||
+		!nr.received(1500) || nr.received(11000) || nr.missing(11000) {
+		t.Error("0xE3EA95", err)
+	}
+	// Senders that don't advertise CapNackRuns get a plain bitmap
+	nr, err = readNack(makeNack("key", hash, missing, 8*1000, false))
+	if err != nil || nr.bits != 8000 || !nr.missing(1000) ||
+		nr.missing(1500) {
+		t.Error("0xE5C2B8", err)
+	}
+}
+
+// decodeNackRuns(runs []byte, bits int) ([]byte, error)
+//
+// go test -run Test_decodeNackRuns_
+//
+func Test_decodeNackRuns_(t *testing.T) {
+	got, err := decodeNackRuns([]byte{3, 2, 4}, 9)
+	if err != nil || !bytes.Equal(got, []byte{0xE7, 0x01}) {
+		t.Error("0xE00E46", got, err)
+	}
+	test := func(runs []byte, bits int, errSubstr string) {
+		_, err := decodeNackRuns(runs, bits)
+		if !matchError(err, errSubstr) {
+			t.Error("0xEA2732", runs, bits, "wrong error:", err)
+		}
+	}
+	test([]byte{3, 0, 4}, 7, "bad run of pieces")
+	test([]byte{3, 2, 5}, 9, "bad run of pieces")
+	test([]byte{0x80}, 9, "bad run of pieces")
+	test([]byte{3, 2}, 9, "runs don't cover all pieces")
+}
+
+// end
@@ -0,0 +1,414 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[nat_traversal.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NAT traversal: a Sender behind a NAT keeps the NAT's mapping of its
+// socket alive during long transfers with keepalive packets (see
+// Configuration.KeepaliveInterval). Two peers that are both behind NATs
+// can reach each other with the help of a Coordinator on a public
+// address: each peer calls Rendezvous() with the same session name, the
+// Coordinator tells each one the public address of the other, and both
+// send packets to each other at once, so that each NAT sees outgoing
+// packets to the other peer before its packets arrive, and lets them in.
+//
+// This works through most home and office NATs, but not through those
+// that map each destination to a different public port (symmetric
+// NATs). A Relay is then needed instead.
+
+// keepaliveCheckInterval is how often sendKeepalives() checks
+// whether a keepalive is due, and whether the transfer has ended.
+const keepaliveCheckInterval = 250 * time.Millisecond
+
+// rendezvousInterval is the time between the packets that Rendezvous()
+// sends to the Coordinator, and then to the peer, until the peer's
+// packets get through.
+const rendezvousInterval = 250 * time.Millisecond
+
+// coordinatorMaxSessions is the maximum number of sessions a Coordinator
+// keeps at a time, so that it can't be made to use up all its memory.
+const coordinatorMaxSessions = 65536
+
+// sendKeepalives sends a keepalive packet to the Receiver through 'conn'
+// whenever the Sender has sent nothing for Config.KeepaliveInterval,
+// until 'done' is closed.
+func (sd *Sender) sendKeepalives(conn netUDPConn, done <-chan struct{}) {
+	interval := sd.Config.KeepaliveInterval
+	if interval <= 0 || conn == nil {
+		return
+	}
+	cphr := sd.cipher()
+	atomic.StoreInt64(&sd.lastSent, time.Now().UnixNano())
+	for !isDone(done) {
+		last := time.Unix(0, atomic.LoadInt64(&sd.lastSent))
+		if wait := interval - time.Since(last); wait > 0 {
+			if wait > keepaliveCheckInterval {
+				wait = keepaliveCheckInterval
+			}
+			select {
+			case <-done:
+			case <-time.After(wait):
+			}
+			continue
+		}
+		err := sendKeepalive(conn, nil, cphr)
+		if err != nil && err != errClosed {
+			_ = sd.logError(0xE3D9A6, "keepalive:", err)
+		}
+		atomic.StoreInt64(&sd.lastSent, time.Now().UnixNano())
+		if sd.Config.VerboseSender {
+			sd.logDebug("Sender sent a keepalive to", sd.Address)
+		}
+	}
+} //                                                              sendKeepalives
+
+// sendKeepalive writes an encrypted keepalive packet to 'conn', or to
+// address 'addr' through it if 'addr' isn't nil.
+func sendKeepalive(conn netUDPConn, addr net.Addr, cphr SymmetricCipher,
+) error {
+	data, err := cphr.Encrypt([]byte(tagKeepalive))
+	if err != nil {
+		return err
+	}
+	if addr == nil {
+		_, err = conn.Write(data)
+	} else {
+		_, err = conn.WriteTo(data, addr)
+	}
+	return netError(err, 0xE5B1E8)
+} //                                                               sendKeepalive
+
+// -----------------------------------------------------------------------------
+
+// Coordinator runs on a public address, and introduces peers behind
+// NATs that call Rendezvous() with the same session name to each other,
+// so that they can send data items directly, e.g.:
+//
+//	cd := udpt.Coordinator{Port: 9870}
+//	err := cd.Run()
+//
+// It only learns the addresses of the peers and the names of their
+// sessions, not their keys, and carries none of their packets.
+//
+type Coordinator struct {
+
+	// Port is the port number on which the Coordinator listens.
+	// This number must be between 1 and 65535.
+	Port int
+
+	// Config contains the settings of the Coordinator, of which it uses
+	// Network, PacketSizeLimit, ReplyTimeout, AllowedSenders and
+	// DeniedSenders, ItemExpiry (how long it remembers a session), and
+	// logging. If nil, the default configuration is used.
+	Config *Configuration
+
+	// -------------------------------------------------------------------------
+
+	// mu protects 'conn'
+	mu sync.Mutex
+
+	// conn is the socket on which the Coordinator listens;
+	// setting it to nil makes Run() return
+	conn netUDPConn
+
+	// sessions holds the peers that joined each session,
+	// by its name. It is only used by Run().
+	sessions map[string]*meeting
+} //                                                                 Coordinator
+
+// meeting is a session of a Coordinator.
+type meeting struct {
+	peers []net.Addr // the (up to two) peers that joined it
+	last  time.Time  // when a peer last joined it
+} //                                                                     meeting
+
+// Run runs the Coordinator until Stop() is called.
+func (cd *Coordinator) Run() error {
+	return cd.RunContext(context.Background())
+} //                                                                         Run
+
+// RunContext runs the Coordinator like Run(), until
+// Stop() is called or 'ctx' is cancelled.
+func (cd *Coordinator) RunContext(ctx context.Context) error {
+	defer cd.Stop()
+	err := cd.init()
+	if err != nil {
+		return err
+	}
+	if ctx.Done() != nil {
+		stopped := make(chan struct{})
+		defer close(stopped)
+		go func() {
+			select {
+			case <-ctx.Done():
+				cd.Stop()
+			case <-stopped:
+			}
+		}()
+	}
+	buf := newReadBuffer(cd.Config.PacketSizeLimit)
+	lastExpiry := time.Now()
+	for {
+		cd.mu.Lock()
+		conn := cd.conn
+		cd.mu.Unlock()
+		if conn == nil {
+			break
+		}
+		now := time.Now()
+		if now.Sub(lastExpiry) >= time.Second {
+			lastExpiry = now
+			cd.expireSessions(now)
+		}
+		data, addr, err := readDatagram(conn, cd.Config.ReplyTimeout,
+			buf, cd.Config.PacketSizeLimit)
+		if err == errClosed || err == errTimeout {
+			continue
+		}
+		if err != nil {
+			_ = cd.logError(0xE1A6D3, err, "from", addr)
+			continue
+		}
+		if !cd.Config.senderAllowed(addr) {
+			continue
+		}
+		if !bytes.HasPrefix(data, []byte(tagMeet)) ||
+			len(data) == len(tagMeet) {
+			_ = cd.logError(0xE8C3B7, "invalid packet from", addr)
+			continue
+		}
+		peers := cd.meet(string(data[len(tagMeet):]), addr, now)
+		for i, pr := range peers {
+			reply := []byte(tagPeer + peers[1-i].String())
+			_, err = conn.WriteTo(reply, pr)
+			if err != nil {
+				_ = cd.logError(0xE6E9A1, "replying to", pr, err)
+			}
+		}
+	}
+	return ctx.Err()
+} //                                                                  RunContext
+
+// Stop stops the Coordinator by closing its socket at once.
+func (cd *Coordinator) Stop() {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	if cd.conn == nil {
+		return
+	}
+	_ = cd.conn.Close()
+	cd.conn = nil
+} //                                                                        Stop
+
+// init checks the Coordinator's settings and starts listening on Port.
+func (cd *Coordinator) init() error {
+	if cd.Config == nil {
+		cd.Config = NewDefaultConfig()
+	}
+	err := cd.Config.Validate()
+	if err != nil {
+		return cd.logError(0xE2B4D6, err)
+	}
+	if cd.Port < 1 || cd.Port > 65535 {
+		return cd.logError(0xE9A7C2, "invalid Coordinator.Port:", cd.Port)
+	}
+	conn, err := net.ListenUDP(cd.Config.network(), &net.UDPAddr{Port: cd.Port})
+	if err != nil {
+		return cd.logError(0xE4F1B9, err)
+	}
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	cd.conn = conn
+	cd.sessions = make(map[string]*meeting)
+	return nil
+} //                                                                        init
+
+// meet adds the peer at 'addr' to 'session'. Returns both peers of the
+// session once two have joined it, so each can be told of the other,
+// or nil while the other hasn't joined. When a third peer joins, e.g.
+// after one was restarted at a new address, it replaces the first.
+func (cd *Coordinator) meet(session string, addr net.Addr, now time.Time,
+) []net.Addr {
+	mt := cd.sessions[session]
+	if mt == nil {
+		if len(cd.sessions) >= coordinatorMaxSessions {
+			_ = cd.logError(0xE0D5E3, "too many sessions")
+			return nil
+		}
+		mt = &meeting{}
+		cd.sessions[session] = mt
+	}
+	mt.last = now
+	found := false
+	for _, pr := range mt.peers {
+		found = found || pr.String() == addr.String()
+	}
+	if !found {
+		if len(mt.peers) == 2 {
+			mt.peers = mt.peers[1:]
+		}
+		mt.peers = append(mt.peers, addr)
+	}
+	if len(mt.peers) < 2 {
+		return nil
+	}
+	return mt.peers
+} //                                                                        meet
+
+// expireSessions forgets the sessions that no peer
+// has joined for Config.ItemExpiry before 'now'.
+func (cd *Coordinator) expireSessions(now time.Time) {
+	expiry := cd.Config.ItemExpiry
+	if expiry == 0 {
+		expiry = defaultItemExpiry
+	}
+	for k, mt := range cd.sessions {
+		if now.Sub(mt.last) > expiry {
+			delete(cd.sessions, k)
+		}
+	}
+} //                                                              expireSessions
+
+// logError writes an error to Coordinator.Config.LogWriter, or
+// passes it to Config.Logger, like Receiver.logError().
+func (cd *Coordinator) logError(id uint32, a ...interface{}) error {
+	ret := makeError(id, a...)
+	if lg := cd.Config.logger(); lg != nil {
+		msg, fields := errorRecord("coordinator", id, ret)
+		lg.Error(msg, fields...)
+	} else if cd.Config != nil && cd.Config.LogWriter != nil {
+		fmt.Fprint(cd.Config.LogWriter, ret.Error())
+	}
+	return ret
+} //                                                                    logError
+
+// -----------------------------------------------------------------------------
+
+// Rendezvous joins 'session' at the Coordinator at address 'coordinator',
+// e.g. "public.example.com:9870", waits for the peer that joins the same
+// session, and punches a path through both NATs. The session name should
+// be hard to guess, e.g. a random string shared by both peers.
+//
+// Returns the socket through which the peer can be reached and the
+// peer's public address. Give the socket to a Receiver or Sender as its
+// PacketConn (with the peer's address as Sender.Address), and close it
+// when done. Set Configuration.KeepaliveInterval to keep the path open.
+//
+// The packets sent to the peer are encrypted with 'cryptoKey', which
+// must be the key both peers use, so an impostor can't take the peer's
+// place. Returns an error if 'ctx' is done first, so give it a deadline.
+//
+// 'config' is optional: if nil or omitted, NewDefaultConfig() is used.
+//
+func Rendezvous(ctx context.Context, coordinator, session string,
+	cryptoKey []byte, config ...*Configuration,
+) (net.PacketConn, *net.UDPAddr, error) {
+	if len(config) > 1 {
+		return nil, nil, makeError(0xE6C8A4, "too many 'config' arguments")
+	}
+	var cf *Configuration
+	if len(config) == 1 {
+		cf = config[0]
+	}
+	if cf == nil {
+		cf = NewDefaultConfig()
+	}
+	err := cf.Validate()
+	if err != nil {
+		return nil, nil, makeError(0xE3A2F7, "invalid config:", err)
+	}
+	if session == "" {
+		return nil, nil, makeError(0xE7B9D1, "blank session")
+	}
+	err = cf.Cipher.SetKey(cryptoKey)
+	if err != nil {
+		return nil, nil, makeError(0xE5D4C8, "invalid cryptoKey:", err)
+	}
+	network := cf.network()
+	server, err := net.ResolveUDPAddr(network, coordinator)
+	if err != nil {
+		return nil, nil, makeError(0xE1F3A5, "invalid coordinator:", err)
+	}
+	laddr, err := cf.localUDPAddr(server)
+	if err != nil {
+		return nil, nil, makeError(0xE2C9F8, err)
+	}
+	conn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, nil, makeError(0xE8A5D1, err)
+	}
+	peer, err := rendezvous(ctx, conn, server, session, cf)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	return conn, peer, nil
+} //                                                                  Rendezvous
+
+// rendezvous is only used by Rendezvous(): it sends joins to the
+// Coordinator at 'server' through 'conn' until it names the peer,
+// then keepalives to the peer until the peer's keepalives arrive.
+func rendezvous(ctx context.Context, conn netUDPConn, server *net.UDPAddr,
+	session string, cf *Configuration,
+) (*net.UDPAddr, error) {
+	buf := newReadBuffer(cf.PacketSizeLimit)
+	var peer *net.UDPAddr
+	for ctx.Err() == nil {
+		var err error
+		if peer == nil {
+			_, err = conn.WriteTo([]byte(tagMeet+session), server)
+		} else {
+			err = sendKeepalive(conn, peer, cf.Cipher)
+		}
+		if err != nil {
+			return nil, makeError(0xE4E7B2, err)
+		}
+		deadline := time.Now().Add(rendezvousInterval)
+		for wait := rendezvousInterval; wait > 0; {
+			data, addr, err := readDatagram(conn, wait, buf, cf.PacketSizeLimit)
+			wait = time.Until(deadline)
+			if err == errTimeout || err == errOversized {
+				continue
+			}
+			if err != nil {
+				return nil, makeError(0xE9F6C3, err)
+			}
+			from, ok := addr.(*net.UDPAddr)
+			switch {
+			case !ok:
+				continue
+			case from.IP.Equal(server.IP) && from.Port == server.Port:
+				if bytes.HasPrefix(data, []byte(tagPeer)) {
+					peer, _ = net.ResolveUDPAddr(cf.network(),
+						string(data[len(tagPeer):]))
+				}
+				continue
+			}
+			plain, err := cf.Cipher.Decrypt(data)
+			if err != nil || !bytes.HasPrefix(plain, []byte(tagKeepalive)) {
+				continue
+			}
+			// the peer's packets got through, so the path is open:
+			// make sure that the peer gets a few of ours too
+			for i := 0; i < 3; i++ {
+				_ = sendKeepalive(conn, from, cf.Cipher)
+			}
+			return from, nil
+		}
+	}
+	return nil, makeError(0xE0A8F4, "no peer joined the session:", ctx.Err())
+} //                                                                  rendezvous
+
+// end
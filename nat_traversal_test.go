@@ -0,0 +1,173 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /[nat_traversal_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// (sd *Sender) sendKeepalives(conn netUDPConn, done <-chan struct{})
+//
+// go test -run Test_Sender_sendKeepalives_
+
+// must send keepalives while the Sender sends nothing else,
+// and stop when 'done' is closed
+func Test_Sender_sendKeepalives_(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("0xE3C5A8", err)
+	}
+	defer server.Close()
+	conn, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal("0xE8F2B4", err)
+	}
+	defer conn.Close()
+	sd := makeTestSender()
+	sd.Config.VerboseSender = false
+	sd.Config.KeepaliveInterval = 50 * time.Millisecond
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		sd.sendKeepalives(conn, stop)
+		close(done)
+	}()
+	buf := make([]byte, 1024)
+	for i := 0; i < 2; i++ {
+		_ = server.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatal("0xE1D7C3", i, err)
+		}
+		plain, err := sd.Config.Cipher.Decrypt(buf[:n])
+		if err != nil || string(plain) != tagKeepalive {
+			t.Error("0xE6B8F1", string(plain), err)
+		}
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("0xE4A3D9", "didn't stop")
+	}
+}
+
+// (cd *Coordinator) meet(session string, addr net.Addr, now time.Time,
+// ) []net.Addr
+//
+// go test -run Test_Coordinator_meet_
+
+// must pair the first two peers that join a session, and
+// replace the first one when another peer joins
+func Test_Coordinator_meet_(t *testing.T) {
+	addr := func(port int) net.Addr {
+		return &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: port}
+	}
+	cd := Coordinator{sessions: make(map[string]*meeting)}
+	now := time.Now()
+	if peers := cd.meet("s", addr(1), now); peers != nil {
+		t.Error("0xE9E1B6", peers)
+	}
+	if peers := cd.meet("s", addr(1), now); peers != nil {
+		t.Error("0xE2F4C7", "repeated join paired:", peers)
+	}
+	if peers := cd.meet("other", addr(2), now); peers != nil {
+		t.Error("0xE7A6E2", peers)
+	}
+	peers := cd.meet("s", addr(3), now)
+	if len(peers) != 2 || peers[0].String() != addr(1).String() ||
+		peers[1].String() != addr(3).String() {
+		t.Error("0xE5C9A3", peers)
+	}
+	peers = cd.meet("s", addr(4), now)
+	if len(peers) != 2 || peers[0].String() != addr(3).String() ||
+		peers[1].String() != addr(4).String() {
+		t.Error("0xE0B2D8", peers)
+	}
+	cd.Config = NewDefaultConfig()
+	cd.expireSessions(now.Add(2 * defaultItemExpiry))
+	if len(cd.sessions) != 0 {
+		t.Error("0xE8D4F6", len(cd.sessions))
+	}
+}
+
+// Rendezvous(ctx context.Context, coordinator, session string,
+//     cryptoKey []byte, config ...*Configuration,
+// ) (net.PacketConn, *net.UDPAddr, error)
+//
+// go test -run Test_Rendezvous_
+
+// must introduce two peers through the Coordinator, and return sockets
+// on which they can transfer data items to each other
+func Test_Rendezvous_(t *testing.T) {
+	key := []byte("rendezvous-key-0123456789abcdefg")
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	cd := Coordinator{Port: 9858, Config: cf}
+	go func() { _ = cd.Run() }()
+	defer cd.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	type result struct {
+		conn net.PacketConn
+		peer *net.UDPAddr
+		err  error
+	}
+	results := make(chan result, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			conn, peer, err := Rendezvous(ctx, "127.0.0.1:9858", "s1", key,
+				NewDefaultConfig())
+			results <- result{conn, peer, err}
+		}()
+	}
+	a, b := <-results, <-results
+	if a.err != nil || b.err != nil {
+		t.Fatal("0xE3F8B5", a.err, b.err)
+	}
+	defer a.conn.Close()
+	defer b.conn.Close()
+	if a.peer.Port != b.conn.LocalAddr().(*net.UDPAddr).Port ||
+		b.peer.Port != a.conn.LocalAddr().(*net.UDPAddr).Port {
+		t.Fatal("0xE6D1A7", a.peer, b.peer)
+	}
+	got := make(chan []byte, 1)
+	rc := Receiver{
+		PacketConn: a.conn, CryptoKey: key, Config: NewDefaultConfig(),
+		Receive: func(k string, v []byte) error {
+			got <- v
+			return nil
+		},
+	}
+	rc.Config.LogWriter = nil
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	sd := Sender{
+		Address: b.peer.String(), PacketConn: b.conn, CryptoKey: key,
+		Config: NewDefaultConfig(),
+	}
+	sd.Config.LogWriter = nil
+	sd.Config.KeepaliveInterval = 20 * time.Second
+	value := bytes.Repeat([]byte("punched "), 1000)
+	if err := sd.Send("k", value); err != nil {
+		t.Fatal("0xE2A9E4", err)
+	}
+	if v := <-got; !bytes.Equal(v, value) {
+		t.Error("0xE9B5C1", len(v))
+	}
+	_, _, err := Rendezvous(ctx, "127.0.0.1:9858", "", key)
+	if !matchError(err, "blank session") {
+		t.Error("0xE4C6F8", "wrong error:", err)
+	}
+}
+
+// end
@@ -0,0 +1,68 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[packet_conn.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// suppliedConn adapts Sender.PacketConn to the netUDPConn used by
+// Senders. Each connect() makes a new one, so the goroutine reading
+// replies on the previous one stops (see collectConfirmations).
+type suppliedConn struct {
+	net.PacketConn
+	raddr  net.Addr
+	closed int32 // set by Close()
+} //                                                                suppliedConn
+
+// ReadFrom reads a datagram like net.PacketConn.ReadFrom(),
+// or returns net.ErrClosed once Close() has been called.
+func (sc *suppliedConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	if atomic.LoadInt32(&sc.closed) != 0 {
+		return 0, nil, net.ErrClosed
+	}
+	n, addr, err := sc.PacketConn.ReadFrom(b)
+	if err != nil && atomic.LoadInt32(&sc.closed) != 0 {
+		return 0, nil, net.ErrClosed
+	}
+	return n, addr, transportError(err)
+} //                                                                    ReadFrom
+
+// Write writes 'b' to the Receiver: with Write() if the connection
+// is connected to a remote address, or with WriteTo() otherwise.
+func (sc *suppliedConn) Write(b []byte) (int, error) {
+	if conn, ok := sc.PacketConn.(net.Conn); ok && conn.RemoteAddr() != nil {
+		return conn.Write(b)
+	}
+	return sc.PacketConn.WriteTo(b, sc.raddr)
+} //                                                                       Write
+
+// SetWriteBuffer sets the size of the transmit buffer, if
+// the underlying connection supports it, otherwise does nothing.
+func (sc *suppliedConn) SetWriteBuffer(bytes int) error {
+	return setWriteBuffer(sc.PacketConn, bytes)
+} //                                                              SetWriteBuffer
+
+// Close doesn't close the connection, which belongs to the caller.
+// It only interrupts any read in progress, which fails like further
+// reads with net.ErrClosed.
+func (sc *suppliedConn) Close() error {
+	atomic.StoreInt32(&sc.closed, 1)
+	return sc.PacketConn.SetReadDeadline(time.Now())
+} //                                                                       Close
+
+// receiverConn returns Receiver.PacketConn as the netUDPConn used by
+// Receivers, counting the datagrams dropped by a *net.UDPConn.
+func (rc *Receiver) receiverConn() netUDPConn {
+	if conn, ok := rc.PacketConn.(*net.UDPConn); ok {
+		return watchOverflows(conn, &rc.counters.packetsDropped)
+	}
+	return transportPacketConn{rc.PacketConn}
+} //                                                                receiverConn
+
+// end
@@ -0,0 +1,82 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[packet_conn_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Sender.PacketConn and Receiver.PacketConn
+//
+// go test -run Test_PacketConn_
+
+// must send and receive on sockets supplied by the caller, keeping the
+// Sender's socket open across data items, whether connected or not
+func Test_PacketConn_(t *testing.T) {
+	rpc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("0xE2C8F7", err)
+	}
+	received := make(chan string, 4)
+	rc := Receiver{
+		PacketConn: rpc,
+		CryptoKey:  []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0"),
+		Config:     NewDefaultConfig(),
+		Receive: func(k string, v []byte) error {
+			received <- k + "=" + string(v)
+			return nil
+		},
+	}
+	rc.Config.LogWriter = nil
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(200 * time.Millisecond)
+	addr := rpc.LocalAddr().(*net.UDPAddr)
+	if rc.Port != addr.Port {
+		t.Error("0xE7B1D3", rc.Port, addr.Port)
+	}
+	//
+	unconnected, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("0xE4A9C6", err)
+	}
+	defer unconnected.Close()
+	connected, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		t.Fatal("0xE9D5E2", err)
+	}
+	defer connected.Close()
+	for i, pc := range []net.PacketConn{unconnected, connected} {
+		cf := NewDefaultConfig()
+		cf.LogWriter = nil
+		sd := Sender{Address: addr.String(), CryptoKey: rc.CryptoKey,
+			Config: cf, PacketConn: pc}
+		for _, v := range []string{"a", "b"} {
+			v += strconv.Itoa(i) // the Receiver ignores repeated items
+			err = sd.Send("k", []byte(v))
+			if err != nil {
+				t.Fatal("0xE6F2A8", err)
+			}
+			select {
+			case got := <-received:
+				if got != "k="+v {
+					t.Error("0xE1C4B7", got)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("0xE8E7C1", "item not received:", v)
+			}
+		}
+		err = pc.SetReadDeadline(time.Time{}) // fails once closed
+		if err != nil {
+			t.Error("0xE3B6F9", "closed the Sender's PacketConn:", err)
+		}
+	}
+}
+
+// end
@@ -0,0 +1,297 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[packet_relay.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Relay forwards the packets that Senders send to its Port on to the
+// Receiver at Target, and the Receiver's replies back to each Sender,
+// so that transfers can cross a DMZ, or go through a hub in a
+// hub-and-spoke topology. Unlike RelayTo(), which receives whole data
+// items and sends them again, it forwards each packet as it arrives,
+// and holds no data. Unless InKey and OutKey are specified, it doesn't
+// decrypt the packets, so it needs no key.
+//
+// Each Sender's packets are forwarded from a socket of their own, so
+// the Receiver sees one Sender per socket, at the Relay's address.
+// Relays can be chained by making Target another Relay.
+//
+type Relay struct {
+
+	// Port is the port number on which the Relay receives packets.
+	// This number must be between 1 and 65535.
+	Port int
+
+	// Target is the address of the Receiver (or the next Relay) to which
+	// packets are forwarded, with the port number, e.g. "core:9876".
+	Target string
+
+	// InKey and OutKey, if specified, make the Relay re-encrypt packets:
+	// it decrypts the packets of Senders with InKey, their CryptoKey,
+	// and encrypts them with OutKey, the CryptoKey of the Receiver at
+	// Target, and re-encrypts replies the other way round. Packets
+	// that fail to decrypt are dropped. This requires a built-in
+	// Config.Cipher, and doesn't work with Config.KeyExchange.
+	InKey  []byte
+	OutKey []byte
+
+	// Config contains the settings of the Relay, of which it uses Cipher,
+	// Network, PacketSizeLimit, ReplyTimeout and ItemExpiry (how long it
+	// keeps the socket of a Sender from which no packets arrive), and
+	// logging. If nil, the default configuration is used.
+	Config *Configuration
+
+	// -------------------------------------------------------------------------
+
+	// mu protects 'conn' and 'peers'
+	mu sync.Mutex
+
+	// conn is the socket on which the Relay receives the packets of
+	// Senders; setting it to nil makes Run() return
+	conn netUDPConn
+
+	// peers holds the Senders whose packets have been
+	// forwarded recently, by their address
+	peers map[string]*relayPeer
+
+	// inCipher and outCipher are keyed with InKey and
+	// OutKey, or nil if packets aren't re-encrypted
+	inCipher  SymmetricCipher
+	outCipher SymmetricCipher
+} //                                                                       Relay
+
+// relayPeer is a Sender whose packets a Relay forwards.
+type relayPeer struct {
+	addr net.Addr   // the Sender's address
+	conn netUDPConn // connected to Relay.Target
+	last time.Time  // when a packet was last forwarded; protected by mu
+} //                                                                   relayPeer
+
+// Run runs the Relay, forwarding packets until Stop() is called.
+func (ry *Relay) Run() error {
+	return ry.RunContext(context.Background())
+} //                                                                         Run
+
+// RunContext runs the Relay like Run(), until
+// Stop() is called or 'ctx' is cancelled.
+func (ry *Relay) RunContext(ctx context.Context) error {
+	defer ry.Stop()
+	target, err := ry.init()
+	if err != nil {
+		return err
+	}
+	if ctx.Done() != nil {
+		stopped := make(chan struct{})
+		defer close(stopped)
+		go func() {
+			select {
+			case <-ctx.Done():
+				ry.Stop()
+			case <-stopped:
+			}
+		}()
+	}
+	buf := newReadBuffer(ry.Config.PacketSizeLimit)
+	lastExpiry := time.Now()
+	for {
+		ry.mu.Lock()
+		conn := ry.conn
+		ry.mu.Unlock()
+		if conn == nil {
+			break
+		}
+		if now := time.Now(); now.Sub(lastExpiry) >= time.Second {
+			lastExpiry = now
+			ry.expirePeers(now)
+		}
+		data, addr, err := readDatagram(conn, ry.Config.ReplyTimeout,
+			buf, ry.Config.PacketSizeLimit)
+		if err == errClosed || err == errTimeout {
+			continue
+		}
+		if err != nil {
+			_ = ry.logError(0xE5E2B8, err, "from", addr)
+			continue
+		}
+		if !ry.Config.senderAllowed(addr) {
+			continue
+		}
+		data, err = recrypt(data, ry.inCipher, ry.outCipher)
+		if err != nil {
+			_ = ry.logError(0xE8C4D9, "packet from", addr, err)
+			continue
+		}
+		pr, err := ry.peer(addr, target)
+		if err != nil {
+			_ = ry.logError(0xE3A9F6, err)
+			continue
+		}
+		_, err = pr.conn.Write(data)
+		if err != nil {
+			_ = ry.logError(0xE7D1C3, "forwarding to", ry.Target, err)
+		}
+	}
+	return ctx.Err()
+} //                                                                  RunContext
+
+// Stop stops the Relay by closing its sockets at once.
+func (ry *Relay) Stop() {
+	ry.mu.Lock()
+	defer ry.mu.Unlock()
+	if ry.conn == nil {
+		return
+	}
+	_ = ry.conn.Close()
+	ry.conn = nil
+	for k, pr := range ry.peers {
+		_ = pr.conn.Close()
+		delete(ry.peers, k)
+	}
+} //                                                                        Stop
+
+// init checks the Relay's settings, prepares its ciphers and starts
+// listening on Port. Returns the address of Target.
+func (ry *Relay) init() (*net.UDPAddr, error) {
+	if ry.Config == nil {
+		ry.Config = NewDefaultConfig()
+	}
+	err := ry.Config.Validate()
+	if err != nil {
+		return nil, ry.logError(0xE2F5A1, err)
+	}
+	if ry.Port < 1 || ry.Port > 65535 {
+		return nil, ry.logError(0xE9B6E4, "invalid Relay.Port:", ry.Port)
+	}
+	network := ry.Config.network()
+	target, err := net.ResolveUDPAddr(network, ry.Target)
+	if err != nil {
+		return nil, ry.logError(0xE4C2A9, "invalid Relay.Target:", err)
+	}
+	ry.inCipher, ry.outCipher = nil, nil
+	if len(ry.InKey) > 0 || len(ry.OutKey) > 0 {
+		ciphers, err := newKeyCiphers(ry.Config.Cipher,
+			[][]byte{ry.InKey, ry.OutKey})
+		if err != nil {
+			return nil, ry.logError(0xE6D8B5,
+				"invalid Relay.InKey or OutKey:", err)
+		}
+		ry.inCipher, ry.outCipher = ciphers[0], ciphers[1]
+	}
+	conn, err := net.ListenUDP(network, &net.UDPAddr{Port: ry.Port})
+	if err != nil {
+		return nil, ry.logError(0xE1E7C8, err)
+	}
+	ry.mu.Lock()
+	defer ry.mu.Unlock()
+	ry.conn = conn
+	ry.peers = make(map[string]*relayPeer)
+	return target, nil
+} //                                                                        init
+
+// peer returns the relayPeer of the Sender at 'addr', connecting
+// a socket for it to 'target' if its packets weren't being
+// forwarded already.
+func (ry *Relay) peer(addr net.Addr, target *net.UDPAddr,
+) (*relayPeer, error) {
+	ry.mu.Lock()
+	defer ry.mu.Unlock()
+	k := addr.String()
+	pr := ry.peers[k]
+	if pr == nil {
+		conn, err := netDialUDP(ry.Config.network(), nil, target)
+		if err != nil {
+			return nil, makeError(0xE0C3F7, err)
+		}
+		pr = &relayPeer{addr: addr, conn: conn}
+		ry.peers[k] = pr
+		go ry.returnReplies(pr, ry.conn)
+	}
+	pr.last = time.Now()
+	return pr, nil
+} //                                                                        peer
+
+// returnReplies forwards the replies that arrive on the socket of
+// peer 'pr' back to its Sender, through 'conn', until it is closed.
+func (ry *Relay) returnReplies(pr *relayPeer, conn netUDPConn) {
+	buf := newReadBuffer(ry.Config.PacketSizeLimit)
+	for {
+		data, _, err := readDatagram(pr.conn, ry.Config.ReplyTimeout,
+			buf, ry.Config.PacketSizeLimit)
+		if err == errClosed {
+			return
+		}
+		if err == errTimeout {
+			continue
+		}
+		if err != nil {
+			_ = ry.logError(0xE6F9A2, err, "from", ry.Target)
+			continue
+		}
+		data, err = recrypt(data, ry.outCipher, ry.inCipher)
+		if err != nil {
+			_ = ry.logError(0xE2C8B6, "reply from", ry.Target, err)
+			continue
+		}
+		ry.mu.Lock()
+		pr.last = time.Now()
+		ry.mu.Unlock()
+		_, err = conn.WriteTo(data, pr.addr)
+		if err != nil {
+			_ = ry.logError(0xE9E4D7, "replying to", pr.addr, err)
+		}
+	}
+} //                                                                returnReplies
+
+// expirePeers closes the sockets of the Senders whose packets and
+// replies stopped more than Config.ItemExpiry before 'now'.
+func (ry *Relay) expirePeers(now time.Time) {
+	expiry := ry.Config.ItemExpiry
+	if expiry == 0 {
+		expiry = defaultItemExpiry
+	}
+	ry.mu.Lock()
+	defer ry.mu.Unlock()
+	for k, pr := range ry.peers {
+		if now.Sub(pr.last) > expiry {
+			_ = pr.conn.Close()
+			delete(ry.peers, k)
+		}
+	}
+} //                                                                 expirePeers
+
+// recrypt decrypts 'data' with 'from' and encrypts it with 'to', or
+// returns it as it is if they are nil, i.e. it isn't re-encrypted.
+func recrypt(data []byte, from, to SymmetricCipher) ([]byte, error) {
+	if from == nil || to == nil {
+		return data, nil
+	}
+	plain, err := from.Decrypt(data)
+	if err != nil {
+		return nil, err
+	}
+	return to.Encrypt(plain)
+} //                                                                     recrypt
+
+// logError writes an error to Relay.Config.LogWriter, or
+// passes it to Config.Logger, like Receiver.logError().
+func (ry *Relay) logError(id uint32, a ...interface{}) error {
+	ret := makeError(id, a...)
+	if lg := ry.Config.logger(); lg != nil {
+		msg, fields := errorRecord("relay", id, ret)
+		lg.Error(msg, fields...)
+	} else if ry.Config != nil && ry.Config.LogWriter != nil {
+		fmt.Fprint(ry.Config.LogWriter, ret.Error())
+	}
+	return ret
+} //                                                                    logError
+
+// end
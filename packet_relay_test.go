@@ -0,0 +1,74 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[packet_relay_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// (ry *Relay) Run() error
+//
+// go test -run Test_Relay_Run_*
+
+// must forward packets to the Receiver and replies back to the Sender,
+// as they are, or re-encrypted with another key
+func Test_Relay_Run_1(t *testing.T) {
+	senderKey := []byte("sender-key-0123456789abcdefghijk")
+	receiverKey := []byte("receiver-key-0123456789abcdefghi")
+	for _, recrypt := range []bool{false, true} {
+		got := make(chan []byte, 1)
+		rc := Receiver{
+			Port: 9864, CryptoKey: senderKey, Config: NewDefaultConfig(),
+			Receive: func(k string, v []byte) error {
+				got <- v
+				return nil
+			},
+		}
+		rc.Config.LogWriter = nil
+		ry := Relay{Port: 9863, Target: "127.0.0.1:9864"}
+		if recrypt {
+			rc.CryptoKey = receiverKey
+			ry.InKey, ry.OutKey = senderKey, receiverKey
+		}
+		go func() { _ = rc.Run() }()
+		go func() { _ = ry.Run() }()
+		time.Sleep(500 * time.Millisecond)
+		//
+		cf := NewDefaultConfig()
+		cf.LogWriter = nil
+		sd := Sender{Address: "127.0.0.1:9863", CryptoKey: senderKey, Config: cf}
+		value := bytes.Repeat([]byte("relayed "), 1000)
+		err := sd.Send("k", value)
+		if err != nil {
+			t.Error("0xE4A8C1", recrypt, err)
+		} else if v := <-got; !bytes.Equal(v, value) {
+			t.Error("0xE7B3F5", recrypt, len(v))
+		}
+		ry.Stop()
+		rc.Stop()
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// must refuse invalid settings
+func Test_Relay_Run_2(t *testing.T) {
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	for _, ry := range []*Relay{
+		{Port: 0, Target: "127.0.0.1:9864", Config: cf},
+		{Port: 9863, Target: "127.0.0.1", Config: cf},
+		{Port: 9863, Target: "127.0.0.1:9864", InKey: []byte("x"),
+			Config: cf},
+	} {
+		if err := ry.Run(); err == nil {
+			t.Error("0xE1C5D8", "accepted:", ry.Port, ry.Target)
+		}
+	}
+}
+
+// end
@@ -0,0 +1,159 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[packet_trace.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// traceItemCount numbers the traced data items, so that each item
+// appears as a separate process in the trace viewer
+var traceItemCount int64
+
+// traceEvent is one event in the Chrome trace event format, which
+// can be viewed in chrome://tracing or https://ui.perfetto.dev
+type traceEvent struct {
+	Name  string                 `json:"name"`
+	Phase string                 `json:"ph"`
+	Time  int64                  `json:"ts"`
+	Dur   int64                  `json:"dur,omitempty"`
+	Pid   int                    `json:"pid"`
+	Tid   int                    `json:"tid"`
+	Scope string                 `json:"s,omitempty"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+} //                                                                  traceEvent
+
+// packetTrace records the timeline of sending one data item: when each
+// packet was sent, resent and confirmed, or went unconfirmed. Thread 0
+// shows the item itself, and thread n shows packet n-1.
+//
+// A trace holds at most 'limit' events (if 'limit' is above zero), so
+// that tracing a large item can't use up memory. Further events are
+// dropped and only counted.
+//
+type packetTrace struct {
+	mu      sync.Mutex
+	pid     int
+	limit   int
+	events  []traceEvent
+	dropped int
+} //                                                                 packetTrace
+
+// newPacketTrace creates and returns a new packetTrace
+// for the data item with key 'k', holding up to 'limit' events.
+func newPacketTrace(k string, limit int) *packetTrace {
+	pt := &packetTrace{
+		pid:   int(atomic.AddInt64(&traceItemCount, 1)),
+		limit: limit,
+	}
+	pt.add(traceEvent{
+		Name:  "process_name",
+		Phase: "M",
+		Args:  map[string]interface{}{"name": "item " + strconv.Quote(k)},
+	})
+	return pt
+} //                                                              newPacketTrace
+
+// add appends event 'ev' to the trace, unless the trace is full.
+// It does nothing if the trace is nil, i.e. when tracing is off.
+func (pt *packetTrace) add(ev traceEvent) {
+	if pt == nil {
+		return
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.limit > 0 && len(pt.events) >= pt.limit {
+		pt.dropped++
+		return
+	}
+	ev.Pid = pt.pid
+	pt.events = append(pt.events, ev)
+} //                                                                         add
+
+// instant adds an event that happened at time 't' on thread 'tid'.
+func (pt *packetTrace) instant(name string, tid int, t time.Time,
+	args map[string]interface{},
+) {
+	pt.add(traceEvent{Name: name, Phase: "i", Time: traceTime(t),
+		Tid: tid, Scope: "t", Args: args})
+} //                                                                     instant
+
+// span adds an event that lasted from 't0' to 't1' on thread 'tid'.
+func (pt *packetTrace) span(name string, tid int, t0, t1 time.Time,
+	args map[string]interface{},
+) {
+	pt.add(traceEvent{Name: name, Phase: "X", Time: traceTime(t0),
+		Dur: traceTime(t1) - traceTime(t0), Tid: tid, Args: args})
+} //                                                                        span
+
+// writeTo writes the events of the trace to 'w' as elements of a JSON
+// array. Unless 'opened' is true, i.e. the traces of earlier items have
+// already been written to 'w', it opens the array first. closeTrace()
+// closes it, so that the traces of any number of items make up one array.
+func (pt *packetTrace) writeTo(w io.Writer, opened bool) error {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	events := pt.events
+	if pt.dropped > 0 {
+		events = append(events, traceEvent{
+			Name:  "trace truncated",
+			Phase: "i",
+			Time:  traceTime(time.Now()),
+			Pid:   pt.pid,
+			Scope: "p",
+			Args:  map[string]interface{}{"dropped_events": pt.dropped},
+		})
+	}
+	var buf bytes.Buffer
+	if !opened {
+		buf.WriteString("[\n")
+	}
+	for i, ev := range events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return makeError(0xEDEFC1, err)
+		}
+		if opened || i > 0 {
+			buf.WriteString(",\n")
+		}
+		buf.Write(data)
+	}
+	_, err := w.Write(buf.Bytes())
+	if err != nil {
+		return makeError(0xECF2F9, err)
+	}
+	return nil
+} //                                                                     writeTo
+
+// closeTrace closes the JSON array that packetTrace.writeTo() opened in 'w'.
+func closeTrace(w io.Writer) error {
+	_, err := io.WriteString(w, "\n]\n")
+	if err != nil {
+		return makeError(0xE7B3D4, err)
+	}
+	return nil
+} //                                                                  closeTrace
+
+// sameWriter returns true if 'a' and 'b' are the same writer. Writers
+// that can't be compared, e.g. those of func types, are never the same.
+func sameWriter(a, b io.Writer) bool {
+	ta := reflect.TypeOf(a)
+	return ta == reflect.TypeOf(b) && ta != nil && ta.Comparable() && a == b
+} //                                                                  sameWriter
+
+// traceTime converts 't' to a trace timestamp, in microseconds.
+func traceTime(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Microsecond)
+} //                                                                   traceTime
+
+// end
@@ -0,0 +1,85 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[packet_trace_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// (pt *packetTrace) add(ev traceEvent)
+//
+// go test -run Test_packetTrace_add_
+//
+func Test_packetTrace_add_(t *testing.T) {
+	pt := newPacketTrace("key", 3)
+	t0 := time.Now()
+	for i := 0; i < 5; i++ {
+		pt.instant("send", i+1, t0, nil)
+	}
+	// the process_name event counts toward the limit
+	if len(pt.events) != 3 || pt.dropped != 3 {
+		t.Error("0xE9EE1A", len(pt.events), pt.dropped)
+	}
+	for _, ev := range pt.events {
+		if ev.Pid != pt.pid {
+			t.Error("0xE2308B", ev.Pid, pt.pid)
+		}
+	}
+	// a nil trace must ignore events
+	var nilTrace *packetTrace
+	nilTrace.instant("send", 1, t0, nil)
+}
+
+// (pt *packetTrace) writeTo(w io.Writer) error
+//
+// go test -run Test_packetTrace_writeTo_
+//
+func Test_packetTrace_writeTo_(t *testing.T) {
+	var buf bytes.Buffer
+	t0 := time.Now()
+	pt1 := newPacketTrace("first", 0)
+	pt1.span("in flight", 1, t0, t0.Add(1500*time.Microsecond), nil)
+	pt2 := newPacketTrace("second", 2)
+	pt2.instant("send", 1, t0, nil)
+	pt2.instant("send", 2, t0, nil)
+	for i, pt := range []*packetTrace{pt1, pt2} {
+		err := pt.writeTo(&buf, i > 0)
+		if err != nil {
+			t.Error("0xE3B574", err)
+		}
+	}
+	if err := closeTrace(&buf); err != nil {
+		t.Error("0xE6F1B3", err)
+	}
+	// both traces must make up a single JSON array
+	s := buf.String()
+	if strings.Count(s, "[") != 1 || !strings.HasPrefix(s, "[\n") {
+		t.Error("0xE51C99", s)
+	}
+	var events []traceEvent
+	err := json.Unmarshal(buf.Bytes(), &events)
+	if err != nil {
+		t.Fatal("0xE3A152", err)
+	}
+	var names []string
+	for _, ev := range events {
+		names = append(names, ev.Name)
+	}
+	got := strings.Join(names, " ")
+	want := "process_name in flight process_name send trace truncated"
+	if got != want {
+		t.Error("0xED8DB4", "want:", want, "got:", got)
+	}
+	if events[1].Dur != 1500 || events[1].Pid == events[2].Pid {
+		t.Error("0xEE46DF", events[1], events[2])
+	}
+}
+
+// end
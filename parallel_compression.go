@@ -0,0 +1,138 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                           /[parallel_compression.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"encoding/binary"
+	"runtime"
+)
+
+// chunkedFieldTag is the fragment header field with which a Sender marks
+// data items whose value it has compressed in chunks, in parallel.
+const chunkedFieldTag = "chunked:1 "
+
+// parallelChunkSize is the size of the chunks into which a Sender splits
+// a large value to compress them in parallel. Each chunk is compressed
+// on its own, which costs a little of the compression ratio.
+const parallelChunkSize = 1024 * 1024
+
+// compressionWorkers returns Config.CompressionWorkers, or
+// GOMAXPROCS if it is zero, but no more than 'chunks'.
+func compressionWorkers(cf *Configuration, chunks int) int {
+	n := cf.CompressionWorkers
+	if n == 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if n > chunks {
+		n = chunks
+	}
+	return n
+} //                                                          compressionWorkers
+
+// compressValue compresses value 'v' with Config.Compressor. A value of
+// at least two chunks is compressed in chunks, in parallel, if there
+// are several compression workers and the Receiver has advertised
+// CapParallelChunks. Returns the compressed value, and true if it is
+// compressed in chunks.
+func (sd *Sender) compressValue(v []byte) ([]byte, bool, error) {
+	chunks := (len(v) + parallelChunkSize - 1) / parallelChunkSize
+	workers := compressionWorkers(sd.Config, chunks)
+	if workers < 2 || !sd.peerSupports(CapParallelChunks) {
+		comp, err := sd.Config.Compressor.Compress(v)
+		return comp, false, err
+	}
+	comp, err := compressChunks(sd.Config.Compressor, v, workers)
+	return comp, true, err
+} //                                                               compressValue
+
+// compressChunks splits 'v' into chunks of parallelChunkSize, compresses
+// them on 'workers' goroutines with 'cmp', and returns them joined:
+//
+//	number of chunks (4 bytes) | compressed size of each chunk
+//	(4 bytes each) | the compressed chunks
+//
+// All numbers are big-endian.
+func compressChunks(cmp Compression, v []byte, workers int) ([]byte, error) {
+	n := (len(v) + parallelChunkSize - 1) / parallelChunkSize
+	comps := make([][]byte, n)
+	errs := make([]error, n)
+	wp := newWorkerPool(workers)
+	for i := 0; i < n; i++ {
+		i := i
+		a, b := i*parallelChunkSize, (i+1)*parallelChunkSize
+		if b > len(v) {
+			b = len(v)
+		}
+		wp.run(func() { comps[i], errs[i] = cmp.Compress(v[a:b]) })
+	}
+	wp.wait()
+	size := 4 + 4*n
+	for i, comp := range comps {
+		if errs[i] != nil {
+			return nil, makeError(0xE6B3F1, "chunk", i, errs[i])
+		}
+		size += len(comp)
+	}
+	ret := make([]byte, 0, size)
+	ret = binary.BigEndian.AppendUint32(ret, uint32(n))
+	for _, comp := range comps {
+		ret = binary.BigEndian.AppendUint32(ret, uint32(len(comp)))
+	}
+	for _, comp := range comps {
+		ret = append(ret, comp...)
+	}
+	return ret, nil
+} //                                                              compressChunks
+
+// uncompressChunks uncompresses value 'comp', compressed in chunks by
+// compressChunks(), on up to 'workers' goroutines with 'cmp'.
+func uncompressChunks(cmp Compression, comp []byte, workers int,
+) ([]byte, error) {
+	if len(comp) < 4 {
+		return nil, makeError(0xE2A8C5, "truncated chunked value")
+	}
+	n := int(binary.BigEndian.Uint32(comp))
+	if n < 1 || (len(comp)-4)/4 < n {
+		return nil, makeError(0xE9D1B4, "bad number of chunks:", n)
+	}
+	chunks := make([][]byte, n)
+	at := 4 + 4*n
+	for i := range chunks {
+		size := int(binary.BigEndian.Uint32(comp[4+4*i:]))
+		if size > len(comp)-at {
+			return nil, makeError(0xE4C7E2, "truncated chunk", i)
+		}
+		chunks[i] = comp[at : at+size]
+		at += size
+	}
+	if at != len(comp) {
+		return nil, makeError(0xE0F5A9, "extra bytes after chunks")
+	}
+	if workers > n {
+		workers = n
+	}
+	errs := make([]error, n)
+	wp := newWorkerPool(workers)
+	for i := range chunks {
+		i := i
+		wp.run(func() { chunks[i], errs[i] = cmp.Uncompress(chunks[i]) })
+	}
+	wp.wait()
+	size := 0
+	for i, chunk := range chunks {
+		if errs[i] != nil {
+			return nil, makeError(0xE7E2D6, "chunk", i, errs[i])
+		}
+		size += len(chunk)
+	}
+	ret := make([]byte, 0, size)
+	for _, chunk := range chunks {
+		ret = append(ret, chunk...)
+	}
+	return ret, nil
+} //                                                            uncompressChunks
+
+// end
@@ -0,0 +1,116 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                      /[parallel_compression_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_parallel_*
+
+// -----------------------------------------------------------------------------
+
+// makeTestLargeValue returns a value of 'size' bytes, half of it random
+func makeTestLargeValue(size int) []byte {
+	ret := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(ret[:size/2])
+	return ret
+}
+
+// compressChunks(cmp Compression, v []byte, workers int) ([]byte, error)
+// uncompressChunks(cmp Compression, comp []byte, workers int,
+// ) ([]byte, error)
+//
+// go test -run Test_parallel_compressChunks_
+//
+func Test_parallel_compressChunks_(t *testing.T) {
+	zc := &zlibCompressor{}
+	v := makeTestLargeValue(3*parallelChunkSize + 1000)
+	comp, err := compressChunks(zc, v, 4)
+	if err != nil {
+		t.Fatal("0xE5D2B8", err)
+	}
+	if n := int(comp[3]); n != 4 {
+		t.Error("0xE0A7F3", "chunks:", n)
+	}
+	for _, workers := range []int{1, 2, 8} {
+		got, err := uncompressChunks(zc, comp, workers)
+		if err != nil || !bytes.Equal(got, v) {
+			t.Error("0xE8C4D1", workers, err)
+		}
+	}
+	test := func(comp []byte, errSubstr string) {
+		t.Helper()
+		_, err := uncompressChunks(zc, comp, 2)
+		if !matchError(err, errSubstr) {
+			t.Error("0xE3F9A6", "wrong error:", err)
+		}
+	}
+	test(nil, "truncated chunked value")
+	test([]byte{0, 0, 0, 0}, "bad number of chunks")
+	test([]byte{0, 0, 1, 0, 0, 0, 0, 1}, "bad number of chunks")
+	test(comp[:len(comp)-1], "truncated chunk 3")
+	test(append(comp[:len(comp):len(comp)], 0), "extra bytes after chunks")
+	damaged := append([]byte(nil), comp...)
+	damaged[4+4*4] ^= 0xFF
+	test(damaged, "chunk 0")
+}
+
+// (sd *Sender) compressValue(v []byte) ([]byte, bool, error)
+//
+// go test -run Test_parallel_compressValue_
+//
+// must compress large values in chunks only for Receivers that
+// can uncompress them, which must then deliver the whole value
+func Test_parallel_compressValue_(t *testing.T) {
+	v := makeTestLargeValue(2*parallelChunkSize + 100)
+	sd := makeTestSender()
+	sd.Config.CompressionWorkers = 2
+	comp, chunked, err := sd.compressValue(v)
+	if err != nil || chunked {
+		t.Error("0xE6E1C4", "chunked before capabilities are known", err)
+	}
+	sd.setPeerCapabilities(sd.Config.capabilities())
+	sd.Config.CompressionWorkers = 1
+	if _, chunked, _ = sd.compressValue(v); chunked {
+		t.Error("0xE2B5D9", "chunked with one worker")
+	}
+	sd.Config.CompressionWorkers = 2
+	if _, chunked, _ = sd.compressValue(v[:parallelChunkSize]); chunked {
+		t.Error("0xE9F0B2", "chunked a value of one chunk")
+	}
+	comp, chunked, err = sd.compressValue(v)
+	if err != nil || !chunked {
+		t.Fatal("0xE4A3E7", err)
+	}
+	sd.dataHash = getHash(v)
+	sd.key, sd.comp, sd.chunked = "large", comp, chunked
+	err = sd.makePackets(sd.key, sd.comp)
+	if err != nil {
+		t.Fatal("0xE1D8C0", err)
+	}
+	var got []byte
+	rc := newRunnableReceiver()
+	rc.Config.CompressionWorkers = 2
+	rc.Receive = func(k string, v []byte) error {
+		got = v
+		return nil
+	}
+	for _, pk := range sd.packets {
+		_, err := rc.receiveFragment(pk.data)
+		if err != nil {
+			t.Fatal("0xE7C6A5", err)
+		}
+	}
+	if !bytes.Equal(got, v) {
+		t.Error("0xE5B9F8", "wrong value:", len(got))
+	}
+}
+
+// end
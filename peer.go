@@ -0,0 +1,272 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                           /[peer.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// peerQueueSize is the number of datagrams each side of
+// a Peer can hold until they are read (see datagramQueue).
+const peerQueueSize = 1024
+
+// Peer is an endpoint that both receives data items, like a Receiver,
+// and sends them, like a Sender, on a single UDP port with a single key,
+// so that request/response exchanges don't need two ports and two key
+// configurations, e.g.:
+//
+//	pr := udpt.Peer{Port: 9876, CryptoKey: key,
+//		Receive: func(k string, v []byte) error {
+//			return pr.Send(replyAddr, k, answer(v))
+//		}}
+//	go pr.Run()
+//	err := pr.Send("10.0.0.2:9876", "question", data)
+//
+// Each datagram that arrives is decrypted to tell the replies to its
+// own data items (confirmations and NACKs) from the data items of other
+// Peers or Senders, so Peers take more CPU time to receive than
+// Receivers. They require a built-in Config.Cipher, and don't work
+// with Config.KeyExchange.
+//
+type Peer struct {
+
+	// Port is the port number on which the Peer receives data items, and
+	// from which it sends them. This number must be between 1 and 65535.
+	Port int
+
+	// CryptoKey is the secret symmetric encryption key with which
+	// data items are sent and received. See Sender.CryptoKey.
+	CryptoKey []byte
+
+	// Config contains the settings of the Peer, which it uses both to
+	// receive and to send. If nil, the default configuration is used.
+	Config *Configuration
+
+	// Receive is called for each data item the Peer receives, like
+	// Receiver.Receive. It may call Send(), e.g. to send a response.
+	Receive func(k string, v []byte) error
+
+	// -------------------------------------------------------------------------
+
+	// mu protects 'conn', 'rc', 'recvSide' and 'sendSide'
+	mu sync.Mutex
+
+	// conn is the Peer's socket, or nil if it isn't running
+	conn *net.UDPConn
+
+	// rc is the Receiver that receives the Peer's data items
+	rc *Receiver
+
+	// recvSide and sendSide are the connections on which 'rc' and the
+	// Senders of Send() read the datagrams meant for them
+	recvSide *peerConn
+	sendSide *peerConn
+
+	// sendMu makes Send() send one data item at a time
+	sendMu sync.Mutex
+} //                                                                        Peer
+
+// Run runs the Peer, receiving data items until Stop() is called.
+// Send() can be used while it is running.
+func (pr *Peer) Run() error {
+	return pr.RunContext(context.Background())
+} //                                                                         Run
+
+// RunContext runs the Peer like Run(), until
+// Stop() is called or 'ctx' is cancelled.
+func (pr *Peer) RunContext(ctx context.Context) error {
+	defer pr.Stop()
+	rc, err := pr.init()
+	if err != nil {
+		return err
+	}
+	return rc.RunContext(ctx)
+} //                                                                  RunContext
+
+// Stop stops the Peer and closes its socket at once.
+// Data items being sent fail.
+func (pr *Peer) Stop() {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if pr.conn == nil {
+		return
+	}
+	pr.rc.Stop()
+	pr.recvSide.close()
+	pr.sendSide.close()
+	_ = pr.conn.Close()
+	pr.conn = nil
+} //                                                                        Stop
+
+// Send sends data item 'k' with value 'v' to the Peer or Receiver at
+// address 'addr' from the Peer's port, like Sender.Send(). Returns an
+// error if the Peer isn't running. Data items are sent one at a time:
+// concurrent calls wait for each other.
+func (pr *Peer) Send(addr, k string, v []byte) error {
+	return pr.SendContext(context.Background(), addr, k, v)
+} //                                                                        Send
+
+// SendContext sends a data item like Send(), but gives up
+// when 'ctx' is cancelled, like Sender.SendContext().
+func (pr *Peer) SendContext(ctx context.Context, addr, k string, v []byte,
+) error {
+	pr.sendMu.Lock()
+	defer pr.sendMu.Unlock()
+	pr.mu.Lock()
+	side, rc := pr.sendSide, pr.rc
+	pr.mu.Unlock()
+	if side == nil || side.isClosed() {
+		return makeError(0xE5C2D9, "Peer isn't running")
+	}
+	side.drain() // replies to earlier items that arrived late
+	cf := *rc.Config
+	cphr, err := cloneCipher(cf.Cipher)
+	if err != nil {
+		return makeError(0xE8E6B4, err)
+	}
+	cf.Cipher = cphr // so the Sender can key it while 'rc' decrypts
+	sd := Sender{
+		Address: addr, CryptoKey: pr.CryptoKey, Config: &cf,
+		PacketConn: side,
+	}
+	return sd.SendContext(ctx, k, v)
+} //                                                                 SendContext
+
+// init checks the Peer's settings, opens its socket and starts
+// dispatching its datagrams. Returns the Receiver to run.
+func (pr *Peer) init() (*Receiver, error) {
+	cf := pr.Config
+	if cf == nil {
+		cf = NewDefaultConfig()
+		pr.Config = cf
+	}
+	err := cf.Validate()
+	if err != nil {
+		return nil, makeError(0xE3B7A5, "invalid Peer.Config:", err)
+	}
+	if cf.KeyExchange {
+		return nil, makeError(0xE9D4F1, "Peer can't use Config.KeyExchange")
+	}
+	if pr.Port < 1 || pr.Port > 65535 {
+		return nil, makeError(0xE1E8C6, "invalid Peer.Port:", pr.Port)
+	}
+	ciphers, err := newKeyCiphers(cf.Cipher, [][]byte{pr.CryptoKey})
+	if err != nil {
+		return nil, makeError(0xE6A5B2, "invalid Peer.CryptoKey:", err)
+	}
+	conn, err := net.ListenUDP(cf.network(), &net.UDPAddr{Port: pr.Port})
+	if err != nil {
+		return nil, makeError(0xE4F9D7, err)
+	}
+	recvSide, sendSide := newPeerConn(conn), newPeerConn(conn)
+	rc := &Receiver{
+		PacketConn: recvSide, CryptoKey: pr.CryptoKey, Config: cf,
+		Receive: pr.Receive,
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.conn, pr.rc = conn, rc
+	pr.recvSide, pr.sendSide = recvSide, sendSide
+	go dispatchPeerDatagrams(conn, ciphers[0], cf.PacketSizeLimit,
+		recvSide, sendSide)
+	return rc, nil
+} //                                                                        init
+
+// dispatchPeerDatagrams reads the datagrams that arrive on 'conn' until it
+// is closed, and queues the replies to data items sent by the Peer, which
+// it finds by decrypting them with 'cphr', on 'sendSide', and all other
+// datagrams on 'recvSide', without decrypting them for the Receiver.
+func dispatchPeerDatagrams(conn *net.UDPConn, cphr SymmetricCipher,
+	sizeLimit int, recvSide, sendSide *peerConn,
+) {
+	buf := newReadBuffer(sizeLimit)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue // e.g. ICMP errors reported by some platforms
+		}
+		data := append([]byte(nil), buf[:n]...)
+		side := recvSide
+		if plain, err := cphr.Decrypt(data); err == nil &&
+			(bytes.HasPrefix(plain, []byte(tagConfirmation)) ||
+				bytes.HasPrefix(plain, []byte(tagNack)) ||
+				bytes.HasPrefix(plain, []byte(tagProbeReply))) {
+			side = sendSide
+		}
+		side.push(data, addr)
+	}
+} //                                                        dispatchPeerDatagrams
+
+// -----------------------------------------------------------------------------
+
+// peerConn is a net.PacketConn for one side of a Peer: it reads the
+// datagrams that dispatchPeerDatagrams() queues for that side, and
+// writes to the Peer's socket.
+type peerConn struct {
+	*datagramQueue              // datagrams not read yet
+	conn           *net.UDPConn // the Peer's socket
+} //                                                                    peerConn
+
+// newPeerConn returns a peerConn that writes to 'conn'.
+func newPeerConn(conn *net.UDPConn) *peerConn {
+	return &peerConn{datagramQueue: newDatagramQueue(peerQueueSize),
+		conn: conn}
+} //                                                                 newPeerConn
+
+// ReadFrom implements net.PacketConn.ReadFrom(): it reads the next queued
+// datagram, waiting until one is queued or the read deadline passes.
+func (pc *peerConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return pc.read(b)
+} //                                                                    ReadFrom
+
+// WriteTo implements net.PacketConn.WriteTo() on the Peer's socket.
+func (pc *peerConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if pc.isClosed() {
+		return 0, net.ErrClosed
+	}
+	return pc.conn.WriteTo(b, addr)
+} //                                                                     WriteTo
+
+// Close implements net.PacketConn.Close(). The Peer's socket
+// stays open: only Peer.Stop() closes it.
+func (pc *peerConn) Close() error {
+	pc.close()
+	return nil
+} //                                                                       Close
+
+// LocalAddr implements net.PacketConn.LocalAddr().
+func (pc *peerConn) LocalAddr() net.Addr {
+	return pc.conn.LocalAddr()
+} //                                                                   LocalAddr
+
+// SetDeadline implements net.PacketConn.SetDeadline().
+func (pc *peerConn) SetDeadline(t time.Time) error {
+	_ = pc.SetReadDeadline(t)
+	return pc.SetWriteDeadline(t)
+} //                                                                 SetDeadline
+
+// SetReadDeadline implements net.PacketConn.SetReadDeadline(),
+// waking up a read in progress to apply the new deadline.
+func (pc *peerConn) SetReadDeadline(t time.Time) error {
+	pc.setReadDeadline(t)
+	return nil
+} //                                                             SetReadDeadline
+
+// SetWriteDeadline implements net.PacketConn.SetWriteDeadline()
+// on the Peer's socket, which both sides share.
+func (pc *peerConn) SetWriteDeadline(t time.Time) error {
+	return pc.conn.SetWriteDeadline(t)
+} //                                                            SetWriteDeadline
+
+// end
@@ -0,0 +1,83 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[peer_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// (pr *Peer) Send(addr, k string, v []byte) error
+//
+// go test -run Test_Peer_Send_*
+
+// must exchange requests and responses between two Peers,
+// each on a single port, including from the Receive callback
+func Test_Peer_Send_1(t *testing.T) {
+	key := []byte("peer-key-0123456789abcdefghijklm")
+	newConfig := func() *Configuration {
+		cf := NewDefaultConfig()
+		cf.LogWriter = nil
+		return cf
+	}
+	responses := make(chan []byte, 1)
+	a := Peer{Port: 9855, CryptoKey: key, Config: newConfig(),
+		Receive: func(k string, v []byte) error {
+			responses <- v
+			return nil
+		},
+	}
+	var b Peer
+	b = Peer{Port: 9856, CryptoKey: key, Config: newConfig(),
+		Receive: func(k string, v []byte) error {
+			return b.Send("127.0.0.1:9855", "re:"+k, bytes.ToUpper(v))
+		},
+	}
+	go func() { _ = a.Run() }()
+	go func() { _ = b.Run() }()
+	defer a.Stop()
+	defer b.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	for _, size := range []int{10, 20000} {
+		request := bytes.Repeat([]byte("q"), size)
+		err := a.Send("127.0.0.1:9856", "question", request)
+		if err != nil {
+			t.Fatal("0xE7D5B2", size, err)
+		}
+		select {
+		case v := <-responses:
+			if !bytes.Equal(v, bytes.ToUpper(request)) {
+				t.Error("0xE3E1C9", size, len(v))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("0xE9A4D6", size, "no response")
+		}
+	}
+}
+
+// must refuse invalid settings, and sending while not running
+func Test_Peer_Send_2(t *testing.T) {
+	var pr Peer
+	err := pr.Send("127.0.0.1:9856", "k", []byte("v"))
+	if !matchError(err, "Peer isn't running") {
+		t.Error("0xE5B8E1", "wrong error:", err)
+	}
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	pr = Peer{Port: 0, Config: cf}
+	if err := pr.Run(); !matchError(err, "invalid Peer.Port") {
+		t.Error("0xE2C6F3", "wrong error:", err)
+	}
+	cf.KeyExchange = true
+	pr = Peer{Port: 9856, Config: cf}
+	if err := pr.Run(); !matchError(err, "can't use Config.KeyExchange") {
+		t.Error("0xE8F9A7", "wrong error:", err)
+	}
+}
+
+// end
@@ -0,0 +1,50 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[piece_checksum.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// pieceSumField is the fragment header field that holds the CRC-32C
+// checksum of the piece, or sub-piece, carried by the fragment. It lets
+// the Receiver discard a piece corrupted in memory, e.g. by faulty RAM
+// on either end, as soon as it arrives, instead of finding out only
+// when the hash of the joined value doesn't match. Fragments without
+// it, from older Senders, are not checked.
+const pieceSumField = "crc:"
+
+// castagnoliTable is the CRC-32C table, which is hardware-accelerated
+// on most platforms.
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// pieceSum returns the CRC-32C checksum of 'payload'.
+func pieceSum(payload []byte) uint32 {
+	return crc32.Checksum(payload, castagnoliTable)
+} //                                                                    pieceSum
+
+// makePieceSumField returns the pieceSumField of a fragment
+// that carries 'payload', followed by a space.
+func makePieceSumField(payload []byte) string {
+	return fmt.Sprintf("%s%08X ", pieceSumField, pieceSum(payload))
+} //                                                           makePieceSumField
+
+// corruptPieceReply returns the reply to a fragment of data item 'it'
+// whose piece didn't match its checksum: a NACK of the pieces that are
+// missing, which include it, so that the Sender sends it again at once.
+// Returns nil if the item has already been delivered.
+func (rc *Receiver) corruptPieceReply(it *receivingItem) []byte {
+	missing := it.missingPieces()
+	if missing == nil {
+		return nil
+	}
+	maxBits := 8 * (rc.Config.PacketSizeLimit - rc.Config.headerReserve())
+	return makeNack(it.nack.key, it.nack.hash, missing, maxBits,
+		it.nack.caps.Has(CapNackRuns))
+} //                                                           corruptPieceReply
+
+// end
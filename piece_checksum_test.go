@@ -0,0 +1,91 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /[piece_checksum_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+// (rc *Receiver) receiveFragment(recv []byte) (reply []byte, err error)
+//
+// go test -run Test_pieceSum_receiveFragment_
+
+// must store a piece that matches its checksum, but discard a corrupted
+// piece, count it, and reply with a NACK that reports it missing
+func Test_pieceSum_receiveFragment_(t *testing.T) {
+	rc := Receiver{Config: NewDefaultConfig(),
+		Receive: func(k string, v []byte) error { return nil }}
+	header := func(sn int, payload string) string {
+		return tagFragment + "key:abc hash:" + testHash + " " +
+			makePieceSumField([]byte(payload)) + "sn:" +
+			strconv.Itoa(sn) + " count:2\n"
+	}
+	reply, err := rc.receiveFragment([]byte(header(1, "AAAA") + "AAAA"))
+	if err != nil || !bytes.HasPrefix(reply, []byte(tagConfirmation)) {
+		t.Error("0xE6A2F7", err, string(reply))
+	}
+	reply, err = rc.receiveFragment([]byte(header(2, "BBBB") + "BxBB"))
+	if err != nil || !bytes.HasPrefix(reply, []byte(tagNack)) {
+		t.Fatal("0xE2E8B4", err, string(reply))
+	}
+	nr, err := readNack(reply)
+	if err != nil || !nr.received(0) || !nr.missing(1) {
+		t.Error("0xE9C3D6", err, nr)
+	}
+	if n := rc.Stats().PiecesCorrupted; n != 1 {
+		t.Error("0xE5F1A8", n)
+	}
+	for _, it := range rc.receiving {
+		if len(it.CompressedPieces[1]) != 0 {
+			t.Error("0xE0D7C5", "the corrupted piece was stored")
+		}
+	}
+	// a malformed checksum must be refused
+	_, err = rc.receiveFragment([]byte(tagFragment + "key:abc hash:" +
+		testHash + " crc:XYZ sn:1 count:2\nAAAA"))
+	if !matchError(err, "bad piece checksum") {
+		t.Error("0xE4B9E1", "wrong error:", err)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// (sd *Sender) splitSubPackets(pk *senderPacket) error
+//
+// go test -run Test_pieceSum_splitSubPackets_
+
+// must give each sub-piece the checksum of its own payload
+func Test_pieceSum_splitSubPackets_(t *testing.T) {
+	sd := makeTestSender()
+	sd.Config.SubPieceSize = 4
+	sd.dataHash = getHash([]byte("value"))
+	err := sd.splitPackets("k", []byte("0123456789"), 100)
+	if err != nil || len(sd.packets) != 1 {
+		t.Fatal("0xE8E4C2", err, len(sd.packets))
+	}
+	pk := &sd.packets[0]
+	if !bytes.Contains(pk.data, []byte(makePieceSumField(
+		[]byte("0123456789")))) {
+		t.Error("0xE3D0F6", string(pk.data))
+	}
+	err = sd.splitSubPackets(pk)
+	if err != nil || len(pk.subPackets) != 3 {
+		t.Fatal("0xE7A5B3", err, len(pk.subPackets))
+	}
+	for i, want := range []string{"0123", "4567", "89"} {
+		data := pk.subPackets[i].data
+		end := bytes.IndexByte(data, '\n')
+		if string(data[end+1:]) != want ||
+			bytes.Count(data[:end], []byte(pieceSumField)) != 1 ||
+			!bytes.Contains(data, []byte(makePieceSumField([]byte(want)))) {
+			t.Error("0xE1C8D9", i, string(data))
+		}
+	}
+}
+
+// end
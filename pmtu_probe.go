@@ -0,0 +1,53 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[pmtu_probe.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+// probePathMTU finds the largest packet that gets through to
+// Sender.Address and caches the path MTU for payloadSize(), if
+// Config.ProbePathMTU is enabled and no path MTU is cached yet.
+//
+// Probing is only an optimization: if the Receiver doesn't reply
+// to probes, nothing is cached and the data item is sent anyway,
+// so the transfer reports any problems with the Receiver.
+//
+func (sd *Sender) probePathMTU() {
+	if !sd.Config.ProbePathMTU || sd.Config.KeyExchange ||
+		sd.Config.MTUCacheExpiry <= 0 {
+		return
+	}
+	if _, ok := pathMTUs.Get(sd.Address); ok {
+		return
+	}
+	conn, err := sd.connect()
+	if err != nil {
+		_ = sd.logError(0xECA558, err)
+		return
+	}
+	err = setDontFragment(conn)
+	if err != nil && sd.Config.VerboseSender {
+		sd.logDebug("Don't Fragment bit not set:", err)
+	}
+	pr, err := newProber(conn, sd.cipher(), sd.Config.PacketSizeLimit)
+	if err != nil {
+		_ = conn.Close()
+		_ = sd.logError(0xEF4D1B, err)
+		return
+	}
+	defer pr.close()
+	rtt, err := pr.ping(diagnoseProbeSize, sd.Config.ReplyTimeout)
+	if err != nil {
+		_ = sd.logError(0xE02B7A, "no reply to path MTU probe:", err)
+		return
+	}
+	size := pr.largestPacket(diagnoseProbeSize, sd.Config.PacketSizeLimit,
+		sd.probeTimeout(rtt))
+	if sd.Config.VerboseSender {
+		sd.logDebug("Largest packet to", sd.Address, "is", size, "bytes")
+	}
+	pathMTUs.Put(sd.Address, size+ipUDPHeaderSize, sd.Config.MTUCacheExpiry)
+} //                                                                probePathMTU
+
+// end
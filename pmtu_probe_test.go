@@ -0,0 +1,71 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /[pmtu_probe_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// (sd *Sender) probePathMTU()
+//
+// go test -run Test_Sender_probePathMTU_
+
+// must find the largest packet the Receiver takes, and send
+// packets that fit it, even with a larger PacketPayloadSize
+func Test_Sender_probePathMTU_(t *testing.T) {
+	const addr = "127.0.0.1:9894"
+	defer pathMTUs.Put(addr, 0, 0)
+	key := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	//
+	// the Receiver drops datagrams larger than 900 bytes,
+	// like a path with a small MTU
+	rcf := NewDefaultConfig()
+	rcf.LogWriter = nil
+	rcf.PacketSizeLimit = 900
+	rcf.PacketPayloadSize = 512
+	received := make(chan []byte, 1)
+	rc := Receiver{
+		Port: 9894, CryptoKey: key, Config: rcf,
+		Receive: func(k string, v []byte) error {
+			received <- v
+			return nil
+		},
+	}
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	cf.ProbePathMTU = true
+	cf.SendRetries = 2
+	sd := Sender{Address: addr, CryptoKey: key, Config: cf}
+	value := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(value)
+	err := sd.Send("key", value)
+	if err != nil {
+		t.Error("0xE61230", err)
+	}
+	if mtu, _ := pathMTUs.Get(addr); mtu != 900+ipUDPHeaderSize {
+		t.Error("0xE91A53", mtu)
+	}
+	select {
+	case got := <-received:
+		if !bytes.Equal(got, value) {
+			t.Error("0xEF08CE", len(got))
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("0xE905D5", "not received")
+	}
+	if n := sd.payloadSize(); n != 900-packetHeaderReserve-sequenceHeaderSize {
+		t.Error("0xE2FC92", n)
+	}
+}
+
+// end
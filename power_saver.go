@@ -0,0 +1,223 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[power_saver.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Defaults of PowerSaver's settings.
+const (
+	defaultPowerBatchWindow    = 30 * time.Second
+	defaultPowerRadioIdleAfter = 10 * time.Second
+	defaultPowerMinRetry       = 2 * time.Second
+	defaultPowerMaxRetry       = 5 * time.Minute
+)
+
+// PowerSaver is both a SendScheduler and a RetryPolicy for mobile apps,
+// e.g. agents built with gomobile for Android or iOS, that saves battery
+// by letting the cellular or Wi-Fi radio sleep as long as possible:
+//
+//   - Data items that are ready while the radio is idle wait for up
+//     to BatchWindow, so that they are sent together in one burst.
+//   - Items that are ready while the radio is still awake from
+//     a recent burst start at once, since that costs little.
+//   - Lost packets are resent after delays that grow fourfold with
+//     each round, instead of with constant retransmission timers.
+//   - While the device is offline, items wait and resend rounds are
+//     put off, until the app reports that the network is back.
+//
+// The app reports network changes by calling NetworkChanged(), or
+// Configuration.NetworkChanged(), from the platform's callbacks, e.g.
+// ConnectivityManager.NetworkCallback on Android or NWPathMonitor on
+// iOS. Senders waiting on the PowerSaver then carry on at once, and
+// reconnect, since the device's address may have changed.
+//
+// NewProfileConfig(ProfileLowPower) returns a configuration that uses
+// a PowerSaver. A PowerSaver can be shared by the Senders of an app,
+// so they send in the same bursts. The zero value is ready to use.
+//
+type PowerSaver struct {
+
+	// BatchWindow is how long the first item that is ready while
+	// the radio is idle waits for others. The default is 30 seconds.
+	BatchWindow time.Duration
+
+	// RadioIdleAfter is how long the radio is assumed to stay awake
+	// after an item starts. The default is 10 seconds.
+	RadioIdleAfter time.Duration
+
+	// MinRetry and MaxRetry limit the delays before resend rounds.
+	// The first delay is twice the round-trip time, but not less than
+	// MinRetry. The defaults are 2 seconds and 5 minutes.
+	MinRetry time.Duration
+	MaxRetry time.Duration
+
+	// -------------------------------------------------------------------------
+
+	// mu protects the fields below
+	mu sync.Mutex
+
+	// offline is set while the app reports that the network is down
+	offline bool
+
+	// batchAt is when the current batch of items starts, and awakeUntil
+	// until when the radio is assumed to be awake after that
+	batchAt    time.Time
+	awakeUntil time.Time
+
+	// changed is closed and replaced when the network changes,
+	// to wake up the Senders that wait (see networkChange)
+	changed chan struct{}
+} //                                                                  PowerSaver
+
+// networkWaiter is implemented by the SendSchedulers and RetryPolicies
+// whose delays end early when the network changes, like PowerSaver.
+type networkWaiter interface {
+	networkChange() <-chan struct{}
+} //                                                               networkWaiter
+
+// NetworkChanged tells the PowerSaver that the device went offline, if
+// 'online' is false, or that it's online again, possibly on another
+// network, if 'online' is true. Senders waiting to start an item or to
+// resend packets then carry on at once: when going back online, the
+// items that are waiting start together. It may be called from any
+// goroutine, and more than once for the same change.
+func (ps *PowerSaver) NetworkChanged(online bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.offline = !online
+	if online {
+		now := time.Now()
+		ps.batchAt = now // the radio has just woken up
+		ps.awakeUntil = now.Add(ps.radioIdleAfter())
+	}
+	if ps.changed != nil {
+		close(ps.changed)
+		ps.changed = nil
+	}
+} //                                                              NetworkChanged
+
+// StartAt implements SendScheduler.StartAt(). It returns 'now' while the
+// radio is awake, the start of the current batch while it is idle, and
+// a time MaxRetry later while the device is offline.
+func (ps *PowerSaver) StartAt(item ScheduledItem, now time.Time) time.Time {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.offline {
+		return now.Add(ps.maxRetry())
+	}
+	if !now.Before(ps.batchAt) {
+		if now.Before(ps.awakeUntil) {
+			ps.awakeUntil = now.Add(ps.radioIdleAfter())
+			return now
+		}
+		ps.batchAt = now.Add(ps.batchWindow())
+		ps.awakeUntil = ps.batchAt.Add(ps.radioIdleAfter())
+	}
+	return ps.batchAt
+} //                                                                     StartAt
+
+// RetryDelay implements RetryPolicy.RetryDelay(). The delay is twice
+// 'rtt', within MinRetry and MaxRetry, and grows fourfold with each
+// round, with a random jitter of up to +/- 50%. While the device is
+// offline, it is MaxRetry.
+func (ps *PowerSaver) RetryDelay(round int, rtt time.Duration,
+) time.Duration {
+	max := ps.maxRetry()
+	ps.mu.Lock()
+	offline := ps.offline
+	ps.mu.Unlock()
+	if offline {
+		return max
+	}
+	delay := 2 * rtt
+	if min := ps.minRetry(); delay < min {
+		delay = min
+	}
+	for i := 1; i < round && delay < max && delay <= math.MaxInt64/4; i++ {
+		delay *= 4
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay/2 + time.Duration(randomInt63n(nil, int64(delay)))
+} //                                                                  RetryDelay
+
+// networkChange returns a channel that is closed
+// when the network changes (see NetworkChanged).
+func (ps *PowerSaver) networkChange() <-chan struct{} {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.changed == nil {
+		ps.changed = make(chan struct{})
+	}
+	return ps.changed
+} //                                                               networkChange
+
+// batchWindow returns BatchWindow or its default.
+func (ps *PowerSaver) batchWindow() time.Duration {
+	if ps.BatchWindow > 0 {
+		return ps.BatchWindow
+	}
+	return defaultPowerBatchWindow
+} //                                                                 batchWindow
+
+// radioIdleAfter returns RadioIdleAfter or its default.
+func (ps *PowerSaver) radioIdleAfter() time.Duration {
+	if ps.RadioIdleAfter > 0 {
+		return ps.RadioIdleAfter
+	}
+	return defaultPowerRadioIdleAfter
+} //                                                              radioIdleAfter
+
+// minRetry returns MinRetry or its default.
+func (ps *PowerSaver) minRetry() time.Duration {
+	if ps.MinRetry > 0 {
+		return ps.MinRetry
+	}
+	return defaultPowerMinRetry
+} //                                                                    minRetry
+
+// maxRetry returns MaxRetry or its default.
+func (ps *PowerSaver) maxRetry() time.Duration {
+	if ps.MaxRetry > 0 {
+		return ps.MaxRetry
+	}
+	return defaultPowerMaxRetry
+} //                                                                    maxRetry
+
+// -----------------------------------------------------------------------------
+
+// NetworkChanged passes a network change reported by the app to
+// Config.SendScheduler and Config.RetryPolicy, if they take it, such as
+// a PowerSaver (see PowerSaver.NetworkChanged), so that an app can
+// report changes without keeping track of them.
+func (cf *Configuration) NetworkChanged(online bool) {
+	type networkChanger interface {
+		NetworkChanged(online bool)
+	}
+	if nc, ok := cf.SendScheduler.(networkChanger); ok {
+		nc.NetworkChanged(online)
+	}
+	if nc, ok := cf.RetryPolicy.(networkChanger); ok {
+		nc.NetworkChanged(online)
+	}
+} //                                                              NetworkChanged
+
+// networkChangeOf returns a channel that is closed when the network
+// changes, if 'v', a SendScheduler or RetryPolicy, reports network
+// changes, such as a PowerSaver, or nil otherwise.
+func networkChangeOf(v interface{}) <-chan struct{} {
+	if nw, ok := v.(networkWaiter); ok {
+		return nw.networkChange()
+	}
+	return nil
+} //                                                             networkChangeOf
+
+// end
@@ -0,0 +1,118 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[power_saver_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_PowerSaver_*
+
+// -----------------------------------------------------------------------------
+
+// (ps *PowerSaver) StartAt(item ScheduledItem, now time.Time) time.Time
+//
+// go test -run Test_PowerSaver_StartAt_
+//
+// must batch the items that are ready while the radio is idle, start
+// them at once while it is awake, and hold them while offline
+func Test_PowerSaver_StartAt_(t *testing.T) {
+	t0 := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	ps := PowerSaver{BatchWindow: 30 * time.Second,
+		RadioIdleAfter: 10 * time.Second}
+	test := func(ofs, want time.Duration) {
+		t.Helper()
+		got := ps.StartAt(ScheduledItem{}, t0.Add(ofs))
+		if !got.Equal(t0.Add(want)) {
+			t.Error("0xE3D9A7", ofs, "got:", got.Sub(t0), "want:", want)
+		}
+	}
+	test(0, 30*time.Second)                // opens a batch
+	test(5*time.Second, 30*time.Second)    // joins it
+	test(30*time.Second, 30*time.Second)   // the batch starts
+	test(35*time.Second, 35*time.Second)   // the radio is awake
+	test(44*time.Second, 44*time.Second)   // and stays awake
+	test(55*time.Second, 85*time.Second)   // the radio went idle
+	test(100*time.Second, 130*time.Second) // likewise
+	//
+	ps.NetworkChanged(false)
+	now := time.Now()
+	if got := ps.StartAt(ScheduledItem{}, now); !got.Equal(
+		now.Add(defaultPowerMaxRetry)) {
+		t.Error("0xE7E5C1", "offline start:", got.Sub(now))
+	}
+	ps.NetworkChanged(true)
+	now = time.Now()
+	if got := ps.StartAt(ScheduledItem{}, now); !got.Equal(now) {
+		t.Error("0xE1A8F3", "must start at once when back online:",
+			got.Sub(now))
+	}
+}
+
+// (ps *PowerSaver) RetryDelay(round int, rtt time.Duration,
+// ) time.Duration
+//
+// go test -run Test_PowerSaver_RetryDelay_
+//
+// must back off fourfold with each round, within MinRetry and MaxRetry,
+// and wait MaxRetry while offline
+func Test_PowerSaver_RetryDelay_(t *testing.T) {
+	ps := PowerSaver{MinRetry: time.Second, MaxRetry: time.Minute}
+	test := func(round int, rtt, want time.Duration) {
+		t.Helper()
+		got := ps.RetryDelay(round, rtt)
+		if got < want/2 || got >= want*3/2 {
+			t.Error("0xE5C6D2", round, rtt, "got:", got, "want:", want)
+		}
+	}
+	test(1, 0, time.Second)
+	test(1, 2*time.Second, 4*time.Second)
+	test(3, 0, 16*time.Second)
+	test(4, 0, time.Minute)
+	test(1000, time.Hour, time.Minute)
+	ps.NetworkChanged(false)
+	if got := ps.RetryDelay(1, 0); got != time.Minute {
+		t.Error("0xE9B2E8", "offline delay:", got)
+	}
+}
+
+// (cf *Configuration) NetworkChanged(online bool)
+//
+// go test -run Test_PowerSaver_NetworkChanged_
+//
+// must wake a Sender whose item waits for its batch,
+// when the network comes back
+func Test_PowerSaver_NetworkChanged_(t *testing.T) {
+	key := []byte("power-key-0123456789abcdefghijkl")
+	rc := Receiver{Port: 9850, CryptoKey: key, Config: NewDefaultConfig(),
+		Receive: func(k string, v []byte) error { return nil },
+	}
+	rc.Config.LogWriter = nil
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	cf, err := NewProfileConfig(ProfileLowPower)
+	if err != nil {
+		t.Fatal("0xE2F4A6", err)
+	}
+	cf.LogWriter = nil
+	cf.SendScheduler.(*PowerSaver).BatchWindow = time.Hour
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cf.NetworkChanged(true)
+	}()
+	sd := Sender{Address: "127.0.0.1:9850", CryptoKey: key, Config: cf}
+	t0 := time.Now()
+	err = sd.Send("k", []byte("woken"))
+	if elapsed := time.Since(t0); err != nil || elapsed > 5*time.Second {
+		t.Error("0xE6A7B9", err, elapsed)
+	}
+}
+
+// end
@@ -0,0 +1,83 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                          /[probe.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"time"
+)
+
+// Probe creates a Sender and uses it to probe the Receiver specified
+// by address 'addr'. See Sender.Probe().
+//
+// config is an optional Configuration you can customize. If you leave it
+// out, Probe() will use the configuration returned by NewDefaultConfig().
+//
+func Probe(addr string, cryptoKey []byte, config ...*Configuration,
+) (time.Duration, error) {
+	if len(config) > 1 {
+		return 0, makeError(0xE4D7B2, "too many 'config' arguments")
+	}
+	var cf *Configuration
+	if len(config) == 1 {
+		cf = config[0]
+	}
+	if cf == nil {
+		cf = NewDefaultConfig()
+	}
+	sender := Sender{Address: addr, CryptoKey: cryptoKey, Config: cf}
+	return sender.Probe()
+} //                                                                       Probe
+
+// Probe sends one encrypted probe to the Receiver at Sender.Address and
+// waits up to Config.ReplyTimeout for its reply, without transferring
+// any data. It is meant for monitoring systems that check if Receivers
+// are available. Since probes are encrypted, a reply also means that the
+// Receiver has the same key.
+//
+// Returns the round-trip time, or an error that wraps
+// ErrReceiverUnreachable if nothing is listening at the address,
+// or ErrNoFirstReply if there was no reply in time.
+//
+// Receivers that only accept negotiated session keys (see
+// Configuration.KeyExchange) don't reply to probes.
+//
+func (sd *Sender) Probe() (time.Duration, error) {
+	if sd.Config == nil {
+		sd.Config = NewDefaultConfig()
+	}
+	err := sd.Config.Validate()
+	if err != nil {
+		return 0, sd.logError(0xE8A1F4, err)
+	}
+	err = sd.validateAddress()
+	if err != nil {
+		return 0, sd.logError(0xE2C6D9, err)
+	}
+	err = sd.Config.Cipher.SetKey(sd.CryptoKey)
+	if err != nil {
+		return 0, sd.logError(0xE7E4A0, "invalid Sender.CryptoKey:", err)
+	}
+	conn, err := sd.connect()
+	if err != nil {
+		return 0, err
+	}
+	pr, err := newProber(conn, sd.Config.Cipher, sd.Config.PacketSizeLimit)
+	if err != nil {
+		_ = conn.Close()
+		return 0, sd.logError(0xE5B3C8, err)
+	}
+	defer pr.close()
+	rtt, err := pr.ping(diagnoseProbeSize, sd.Config.ReplyTimeout)
+	switch {
+	case err == errTimeout:
+		return 0, makeError(0xE0F8D5, ErrNoFirstReply, "at", sd.Address)
+	case err != nil:
+		return 0, makeError(0xE9D2A6, err, "at", sd.Address)
+	}
+	return rtt, nil
+} //                                                                       Probe
+
+// end
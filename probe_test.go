@@ -0,0 +1,52 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[probe_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// (sd *Sender) Probe() (time.Duration, error)
+//
+// go test -run Test_Sender_Probe_
+
+// must return the round-trip time of a running receiver, and fail with
+// ErrNoFirstReply if the receiver has another key, or nothing listens
+func Test_Sender_Probe_(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9897
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	rtt, err := Probe("127.0.0.1:9897", rc.CryptoKey)
+	if err != nil || rtt <= 0 {
+		t.Error("0xE6C0A8", rtt, err)
+	}
+	cf := NewDefaultConfig()
+	cf.ReplyTimeout = 200 * time.Millisecond
+	_, err = Probe("127.0.0.1:9897", []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0"),
+		cf)
+	if !errors.Is(err, ErrNoFirstReply) {
+		t.Error("0xE3F5B1", "wrong error:", err)
+	}
+	// nothing listens: an ICMP error may report it at once
+	_, err = Probe("127.0.0.1:9898", rc.CryptoKey, cf)
+	if !errors.Is(err, ErrNoFirstReply) &&
+		!errors.Is(err, ErrReceiverUnreachable) {
+		t.Error("0xE8B7D2", "wrong error:", err)
+	}
+	sd := makeTestSender()
+	sd.CryptoKey = []byte("too short")
+	if _, err := sd.Probe(); !matchError(err, "invalid Sender.CryptoKey") {
+		t.Error("0xE1A4E9", "wrong error:", err)
+	}
+}
+
+// end
@@ -0,0 +1,132 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                        /[profile.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"strings"
+	"time"
+)
+
+// Names of the configuration profiles returned by NewProfileConfig().
+const (
+	// ProfileLANFast is for local networks with little loss and
+	// sub-millisecond latency: large packets sent back to back,
+	// short timeouts, and quick NACKs.
+	ProfileLANFast = "LANFast"
+
+	// ProfileWANBalanced is for transfers over the internet, with
+	// moderate latency and occasional loss. It is close to the defaults,
+	// but probes the path MTU and retries items that fail.
+	ProfileWANBalanced = "WANBalanced"
+
+	// ProfileLossyMobile is for mobile and Wi-Fi links with heavy,
+	// bursty loss and connections that drop out: small packets, sub-
+	// pieces, many retries, and resuming items that fail.
+	ProfileLossyMobile = "LossyMobile"
+
+	// ProfileSatellite is for links with very long round trips, such
+	// as geostationary satellites: long timeouts, and many packets and
+	// data items in flight to keep the link busy.
+	ProfileSatellite = "Satellite"
+
+	// ProfileLowPower is for mobile agents running on batteries, e.g.
+	// built with gomobile: a PowerSaver batches data items into bursts
+	// and backs off resending, packets are sent back to back so the
+	// radio can sleep sooner, and items that fail are resumed later.
+	// Report network changes with Configuration.NetworkChanged().
+	ProfileLowPower = "LowPower"
+)
+
+// ProfileNames returns the names of the configuration
+// profiles that NewProfileConfig() accepts.
+func ProfileNames() []string {
+	return []string{ProfileLANFast, ProfileWANBalanced, ProfileLossyMobile,
+		ProfileSatellite, ProfileLowPower}
+} //                                                                ProfileNames
+
+// NewProfileConfig returns the configuration settings tuned for the
+// environment named 'name', one of the Profile constants, such as
+// ProfileLANFast. The name is not case-sensitive. The settings start
+// from NewDefaultConfig(), so they can be adjusted further. Use the
+// same profile at both ends, since some settings apply to Receivers.
+//
+// There is no setting for forward error correction: lost pieces
+// are always resent, so the profiles tune how soon that happens.
+//
+// Returns an error if there is no profile named 'name'.
+//
+func NewProfileConfig(name string) (*Configuration, error) {
+	cf := NewDefaultConfig()
+	switch {
+	case strings.EqualFold(name, ProfileLANFast):
+		cf.PacketPayloadSize = defaultPacketSizeLimit - packetHeaderReserve
+		cf.MaxWorkers = 32
+		cf.MaxItemsInFlight = 8
+		cf.ReplyTimeout = 1 * time.Second
+		cf.FirstReplyTimeout = 5 * time.Second
+		cf.StallTimeout = 5 * time.Second
+		cf.SendPacketInterval = 0
+		cf.SendRetryInterval = 50 * time.Millisecond
+		cf.SendWaitInterval = 5 * time.Millisecond
+		cf.NackDelay = 100 * time.Millisecond
+	//
+	case strings.EqualFold(name, ProfileWANBalanced):
+		cf.ItemRetry = ItemRetry{MaxAttempts: 3, Backoff: time.Second,
+			MaxBackoff: 30 * time.Second}
+		cf.ProbePathMTU = true
+		cf.NackDelay = 500 * time.Millisecond
+	//
+	case strings.EqualFold(name, ProfileLossyMobile):
+		cf.PacketPayloadSize = 512
+		cf.SubPieceSize = 128
+		cf.SendRetries = 30
+		cf.MaxWorkers = 4
+		cf.ItemRetry = ItemRetry{MaxAttempts: 5, Backoff: 2 * time.Second,
+			MaxBackoff: time.Minute}
+		cf.ResumeTransfers = true
+		cf.ReplyTimeout = 3 * time.Second
+		cf.FirstReplyTimeout = 60 * time.Second
+		cf.StallTimeout = 60 * time.Second
+		cf.NackDelay = 250 * time.Millisecond
+		cf.ItemExpiry = 5 * time.Minute
+	//
+	case strings.EqualFold(name, ProfileSatellite):
+		cf.SubPieceSize = 256
+		cf.SendRetries = 20
+		cf.MaxWorkers = 32
+		cf.MaxItemsInFlight = 16
+		cf.ItemRetry = ItemRetry{MaxAttempts: 3, Backoff: 10 * time.Second,
+			MaxBackoff: 2 * time.Minute}
+		cf.ResumeTransfers = true
+		cf.ReplyTimeout = 20 * time.Second
+		cf.FirstReplyTimeout = 2 * time.Minute
+		cf.StallTimeout = 2 * time.Minute
+		cf.SendRetryInterval = time.Second
+		cf.SendWaitInterval = 100 * time.Millisecond
+		cf.NackDelay = 2 * time.Second
+		cf.ItemExpiry = 10 * time.Minute
+	//
+	case strings.EqualFold(name, ProfileLowPower):
+		ps := &PowerSaver{}
+		cf.SendScheduler = ps
+		cf.RetryPolicy = ps
+		cf.SendPacketInterval = 0
+		cf.SendRetries = 5
+		cf.ItemRetry = ItemRetry{MaxAttempts: 5, Backoff: time.Minute,
+			MaxBackoff: 15 * time.Minute}
+		cf.ResumeTransfers = true
+		cf.ReplyTimeout = 15 * time.Second
+		cf.FirstReplyTimeout = 60 * time.Second
+		cf.NackDelay = 2 * time.Second
+		cf.ItemExpiry = 30 * time.Minute
+	//
+	default:
+		return nil, makeError(0xE8D3A6, "unknown profile:", name)
+	}
+	return cf, nil
+} //                                                            NewProfileConfig
+
+// end
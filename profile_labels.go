@@ -0,0 +1,28 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[profile_labels.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// withProfileLabels calls 'fn' with the pprof labels in 'kv' (pairs of
+// keys and values) added to those of 'ctx', if Config.ProfileLabels is
+// set. The labels apply to the calling goroutine and to all goroutines
+// started by 'fn', so CPU profiles attribute their cost to a transfer.
+// Otherwise, it just calls 'fn' with 'ctx'.
+func withProfileLabels(ctx context.Context, cf *Configuration,
+	fn func(ctx context.Context), kv ...string,
+) {
+	if cf == nil || !cf.ProfileLabels {
+		fn(ctx)
+		return
+	}
+	pprof.Do(ctx, pprof.Labels(kv...), fn)
+} //                                                           withProfileLabels
+
+// end
@@ -0,0 +1,37 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /[profile_labels_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+)
+
+// withProfileLabels(ctx, cf, fn, kv ...string)
+//
+// go test -run Test_withProfileLabels_
+//
+func Test_withProfileLabels_(t *testing.T) {
+	cf := NewDefaultConfig()
+	for _, enabled := range []bool{false, true} {
+		cf.ProfileLabels = enabled
+		called := false
+		withProfileLabels(context.Background(), cf,
+			func(ctx context.Context) {
+				called = true
+				key, ok := pprof.Label(ctx, "udpt.key")
+				if ok != enabled || (enabled && key != "abc") {
+					t.Error("0xE110A7", enabled, key, ok)
+				}
+			}, "udpt.key", "abc")
+		if !called {
+			t.Error("0xE17640", enabled)
+		}
+	}
+}
+
+// end
@@ -0,0 +1,47 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[profile_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_NewProfileConfig_*
+
+// -----------------------------------------------------------------------------
+
+// NewProfileConfig(name string) (*Configuration, error)
+//
+// go test -run Test_NewProfileConfig_
+//
+// must return a valid configuration for every profile, by any
+// case of its name, and fail for unknown names
+func Test_NewProfileConfig_(t *testing.T) {
+	for _, name := range ProfileNames() {
+		cf, err := NewProfileConfig(name)
+		if err != nil {
+			t.Error("0xE5A9C3", name, err)
+			continue
+		}
+		if err := cf.Validate(); err != nil {
+			t.Error("0xE2D4B7", name, err)
+		}
+	}
+	lan, _ := NewProfileConfig("lanfast")
+	sat, _ := NewProfileConfig("SATELLITE")
+	if lan == nil || sat == nil || lan.ReplyTimeout >= sat.ReplyTimeout {
+		t.Error("0xE8F0A1", "wrong profile settings")
+	}
+	for _, name := range []string{"", "dialup"} {
+		if _, err := NewProfileConfig(name); !matchError(err,
+			"unknown profile") {
+			t.Error("0xE1C7E6", "wrong error:", err)
+		}
+	}
+}
+
+// end
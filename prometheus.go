@@ -0,0 +1,259 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[prometheus.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PrometheusCollector exports the statistics of Senders and Receivers in
+// the Prometheus text exposition format, so that operators can monitor
+// the health of transfers. It doesn't need the Prometheus client
+// library: serve it as an http.Handler, e.g.
+//
+//	http.Handle("/metrics", &udpt.PrometheusCollector{
+//	    Senders: []*udpt.Sender{&sd}, Receivers: []*udpt.Receiver{&rc},
+//	})
+//
+// The metrics of Senders are labelled with their "address", and
+// those of Receivers with their "port". Senders report the totals
+// of all the items they've sent (see Sender.TotalStats).
+//
+type PrometheusCollector struct {
+
+	// Namespace is the prefix of the metric names. Blank means "udpt".
+	Namespace string
+
+	// Senders and Receivers are the ones whose statistics are exported.
+	// Don't change them while the collector is in use.
+	Senders   []*Sender
+	Receivers []*Receiver
+} //                                                         PrometheusCollector
+
+// promMetric describes a metric exported by PrometheusCollector,
+// and reads its value from the statistics of a Sender or Receiver.
+type promMetric struct {
+	name     string
+	help     string
+	kind     string // "counter" or "gauge"
+	sender   func(st TransferStats) float64
+	receiver func(st ReceiverStats) float64
+} //                                                                  promMetric
+
+// senderMetrics are the metrics of each Sender
+var senderMetrics = []promMetric{
+	{name: "sender_packets_sent_total", kind: "counter",
+		help: "Packets sent, including retransmissions.",
+		sender: func(st TransferStats) float64 {
+			return float64(st.PacketsSent)
+		}},
+	{name: "sender_packets_resent_total", kind: "counter",
+		help: "Packets sent again because they were lost.",
+		sender: func(st TransferStats) float64 {
+			return float64(st.PacketsResent)
+		}},
+	{name: "sender_packets_delivered_total", kind: "counter",
+		help: "Packets confirmed by the Receiver.",
+		sender: func(st TransferStats) float64 {
+			return float64(st.PacketsDelivered)
+		}},
+	{name: "sender_packets_lost_total", kind: "counter",
+		help: "Packets never confirmed by the Receiver.",
+		sender: func(st TransferStats) float64 {
+			return float64(st.PacketsLost)
+		}},
+	{name: "sender_bytes_sent_total", kind: "counter",
+		help: "Bytes in the packets sent, before encryption.",
+		sender: func(st TransferStats) float64 {
+			return float64(st.BytesSent)
+		}},
+	{name: "sender_bytes_delivered_total", kind: "counter",
+		help: "Bytes in the packets confirmed by the Receiver.",
+		sender: func(st TransferStats) float64 {
+			return float64(st.BytesDelivered)
+		}},
+	{name: "sender_replies_rejected_total", kind: "counter",
+		help: "Replies from the Receiver that couldn't be decrypted.",
+		sender: func(st TransferStats) float64 {
+			return float64(st.RepliesRejected)
+		}},
+	{name: "sender_rtt_average_seconds", kind: "gauge",
+		help: "Average round-trip time of the packets confirmed.",
+		sender: func(st TransferStats) float64 {
+			return st.AverageRTT.Seconds()
+		}},
+	{name: "sender_compression_ratio", kind: "gauge",
+		help: "Size of the values sent divided by their compressed size.",
+		sender: func(st TransferStats) float64 {
+			return st.CompressionRatio()
+		}},
+	{name: "sender_read_seconds_total", kind: "counter",
+		help: "Time spent reading values from files and readers.",
+		sender: func(st TransferStats) float64 {
+			return st.ReadTime.Seconds()
+		}},
+	{name: "sender_compress_seconds_total", kind: "counter",
+		help: "Time spent compressing values.",
+		sender: func(st TransferStats) float64 {
+			return st.CompressTime.Seconds()
+		}},
+	{name: "sender_encrypt_seconds_total", kind: "counter",
+		help: "Time spent encrypting packets, summed over workers.",
+		sender: func(st TransferStats) float64 {
+			return st.EncryptTime.Seconds()
+		}},
+	{name: "sender_send_seconds_total", kind: "counter",
+		help: "Time spent writing packets, summed over workers.",
+		sender: func(st TransferStats) float64 {
+			return st.SendTime.Seconds()
+		}},
+	{name: "sender_ack_wait_seconds_total", kind: "counter",
+		help: "Time spent waiting for the Receiver to confirm packets.",
+		sender: func(st TransferStats) float64 {
+			return st.AckWaitTime.Seconds()
+		}},
+}
+
+// receiverMetrics are the metrics of each Receiver
+var receiverMetrics = []promMetric{
+	{name: "receiver_packets_received_total", kind: "counter",
+		help: "Packets received and decrypted.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.PacketsReceived)
+		}},
+	{name: "receiver_packets_rejected_total", kind: "counter",
+		help: "Packets that couldn't be read or decrypted.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.PacketsRejected)
+		}},
+	{name: "receiver_decrypt_failures_total", kind: "counter",
+		help: "Packets that couldn't be decrypted.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.DecryptFailures)
+		}},
+	{name: "receiver_packets_oversized_total", kind: "counter",
+		help: "Packets dropped for exceeding Config.PacketSizeLimit.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.PacketsOversized)
+		}},
+	{name: "receiver_packets_dropped_total", kind: "counter",
+		help: "Packets dropped by the kernel when the buffer was full.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.PacketsDropped)
+		}},
+	{name: "receiver_bytes_received_total", kind: "counter",
+		help: "Bytes in the packets received, before decryption.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.BytesReceived)
+		}},
+	{name: "receiver_items_delivered_total", kind: "counter",
+		help: "Data items passed to Receive.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.ItemsDelivered)
+		}},
+	{name: "receiver_bytes_delivered_total", kind: "counter",
+		help: "Bytes in the values passed to Receive.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.BytesDelivered)
+		}},
+	{name: "receiver_receive_errors_total", kind: "counter",
+		help: "Times Receive returned an error.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.ReceiveErrors)
+		}},
+	{name: "receiver_items_expired_total", kind: "counter",
+		help: "Incomplete data items discarded after Config.ItemExpiry.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.ItemsExpired)
+		}},
+	{name: "receiver_pieces_corrupted_total", kind: "counter",
+		help: "Pieces discarded because their checksum didn't match.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.PiecesCorrupted)
+		}},
+	{name: "receiver_packets_denied_total", kind: "counter",
+		help: "Datagrams dropped before decryption because of their address.",
+		receiver: func(st ReceiverStats) float64 {
+			return float64(st.PacketsDenied)
+		}},
+	{name: "receiver_compression_ratio", kind: "gauge",
+		help: "Size of the values delivered divided by their compressed size.",
+		receiver: func(st ReceiverStats) float64 {
+			return st.CompressionRatio()
+		}},
+}
+
+// promEscaper escapes label values in the text exposition format
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ServeHTTP writes the metrics in response to a scrape by Prometheus.
+// Implements http.Handler.
+func (pc *PrometheusCollector) ServeHTTP(w http.ResponseWriter,
+	r *http.Request,
+) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = pc.WriteTo(w)
+} //                                                                   ServeHTTP
+
+// WriteTo writes the current metrics to 'w' in the Prometheus text
+// exposition format. Returns the number of bytes written and any error.
+// Implements io.WriterTo.
+func (pc *PrometheusCollector) WriteTo(w io.Writer) (int64, error) {
+	ns := pc.Namespace
+	if ns == "" {
+		ns = "udpt"
+	}
+	var sb strings.Builder
+	writeFamily := func(m promMetric, samples func(name string)) {
+		name := ns + "_" + m.name
+		fmt.Fprintf(&sb, "# HELP %s %s\n", name, m.help)
+		fmt.Fprintf(&sb, "# TYPE %s %s\n", name, m.kind)
+		samples(name)
+	}
+	writeSample := func(name, label, value string, v float64) {
+		fmt.Fprintf(&sb, "%s{%s=\"%s\"} %s\n", name, label,
+			promEscaper.Replace(value), strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	if len(pc.Senders) > 0 {
+		stats := make([]TransferStats, len(pc.Senders))
+		for i, sd := range pc.Senders {
+			stats[i] = sd.TotalStats()
+		}
+		for _, m := range senderMetrics {
+			writeFamily(m, func(name string) {
+				for i, sd := range pc.Senders {
+					writeSample(name, "address", sd.Address,
+						m.sender(stats[i]))
+				}
+			})
+		}
+	}
+	if len(pc.Receivers) > 0 {
+		stats := make([]ReceiverStats, len(pc.Receivers))
+		for i, rc := range pc.Receivers {
+			stats[i] = rc.Stats()
+		}
+		for _, m := range receiverMetrics {
+			writeFamily(m, func(name string) {
+				for i, rc := range pc.Receivers {
+					writeSample(name, "port", strconv.Itoa(rc.Port),
+						m.receiver(stats[i]))
+				}
+			})
+		}
+	}
+	n, err := io.WriteString(w, sb.String())
+	if err != nil {
+		return int64(n), makeError(0xED377C, err)
+	}
+	return int64(n), nil
+} //                                                                     WriteTo
+
+// end
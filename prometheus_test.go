@@ -0,0 +1,81 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /[prometheus_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// (pc *PrometheusCollector) WriteTo(w io.Writer) (int64, error)
+//
+// go test -run Test_PrometheusCollector_WriteTo_
+//
+func Test_PrometheusCollector_WriteTo_(t *testing.T) {
+	sd := makeTestSender()
+	sd.Address = `127.0.0.1:9876"`
+	rc := &Receiver{
+		Port: 9876, CryptoKey: sd.CryptoKey,
+		Receive: func(k string, v []byte) error { return nil },
+	}
+	sd.LocalReceiver = rc
+	_ = sd.Send("a", []byte("12345"))
+	pc := PrometheusCollector{
+		Senders: []*Sender{sd}, Receivers: []*Receiver{rc},
+	}
+	var sb strings.Builder
+	n, err := pc.WriteTo(&sb)
+	got := sb.String()
+	if err != nil || n != int64(len(got)) {
+		t.Fatal("0xE00E96", n, err)
+	}
+	for _, want := range []string{
+		"# HELP udpt_sender_bytes_delivered_total " +
+			"Bytes in the packets confirmed by the Receiver.\n" +
+			"# TYPE udpt_sender_bytes_delivered_total counter\n" +
+			`udpt_sender_bytes_delivered_total{address="127.0.0.1:9876\""} 5` +
+			"\n",
+		"# TYPE udpt_sender_compression_ratio gauge\n" +
+			`udpt_sender_compression_ratio{address="127.0.0.1:9876\""} 1` +
+			"\n",
+		`udpt_receiver_items_delivered_total{port="9876"} 1` + "\n",
+		`udpt_receiver_bytes_delivered_total{port="9876"} 5` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Error("0xE4D52B", "missing:", want)
+		}
+	}
+	if strings.Count(got, "# TYPE") !=
+		len(senderMetrics)+len(receiverMetrics) {
+		t.Error("0xE139F0", got)
+	}
+}
+
+// (pc *PrometheusCollector) ServeHTTP(w http.ResponseWriter,
+//     r *http.Request,
+// )
+//
+// go test -run Test_PrometheusCollector_ServeHTTP_
+
+// must serve the metrics as plain text, named within Namespace
+func Test_PrometheusCollector_ServeHTTP_(t *testing.T) {
+	pc := PrometheusCollector{
+		Namespace: "app",
+		Receivers: []*Receiver{{Port: 1234}},
+	}
+	w := httptest.NewRecorder()
+	pc.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") ||
+		!strings.Contains(body,
+			`app_receiver_packets_received_total{port="1234"} 0`) ||
+		strings.Contains(body, "sender") {
+		t.Error("0xEE8B3C", body)
+	}
+}
+
+// end
@@ -0,0 +1,25 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                       /quic/[go.mod]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// The QUIC transport is a separate module, so that udpt itself
+// keeps using only the standard library.
+module github.com/balacode/udpt/quic
+
+go 1.24
+
+require (
+	github.com/balacode/udpt v0.0.0
+	github.com/quic-go/quic-go v0.59.1
+)
+
+require (
+	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/net v0.43.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+)
+
+replace github.com/balacode/udpt => ../
+
+// end
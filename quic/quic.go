@@ -0,0 +1,387 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                       /quic/[quic.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// Package quic provides a udpt Transport that carries the packets of
+// Senders and Receivers in QUIC DATAGRAM frames (RFC 9221), using
+// quic-go, for networks whose middleboxes block or throttle raw UDP
+// but let QUIC through. Data items keep udpt's semantics: names,
+// hashes, compression and Configuration.Cipher are used as without it,
+// and lost packets are resent by udpt, not by QUIC.
+//
+// Assign it to Configuration.Transport on both the Sender and the
+// Receiver, with a certificate on the Receiver's side:
+//
+//	cf := udpt.NewDefaultConfig()
+//	cf.PacketSizeLimit = quic.PacketSizeLimit
+//	cf.PacketPayloadSize = quic.PacketPayloadSize
+//	cf.Transport = &quic.Transport{TLSConfig: &tls.Config{
+//		Certificates: []tls.Certificate{cert},
+//	}}
+//
+// Each Sender connection makes a QUIC handshake with the Receiver when
+// it connects. A DATAGRAM frame must fit in a single QUIC packet, so
+// Configuration.PacketSizeLimit must not exceed PacketSizeLimit: the
+// Write of a longer packet fails. Reduce PacketPayloadSize to match.
+//
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/balacode/udpt"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// ALPN is the application protocol negotiated by Senders and Receivers
+// when TLSConfig.NextProtos is empty.
+const ALPN = "udpt"
+
+// PacketSizeLimit is the largest Configuration.PacketSizeLimit that fits
+// in a DATAGRAM frame on a path of the minimum size QUIC supports.
+const PacketSizeLimit = 1150
+
+// PacketPayloadSize is the largest Configuration.PacketPayloadSize
+// allowed with PacketSizeLimit.
+const PacketPayloadSize = 900
+
+// Transport implements udpt.Transport using QUIC datagrams.
+type Transport struct {
+
+	// TLSConfig is the TLS 1.3 configuration, with the Receiver's
+	// certificate, and the root certificates with which Senders verify
+	// it. Senders use it as clients, Receivers as servers. It must not
+	// be nil.
+	TLSConfig *tls.Config
+
+	// Config, if specified, is the QUIC configuration, e.g. with
+	// timeouts. Datagrams are always enabled. Nil means quic-go's
+	// defaults, with keep-alives so that idle connections stay open.
+	Config *quicgo.Config
+} //                                                                   Transport
+
+var _ udpt.Transport = (*Transport)(nil)
+
+// Dial implements udpt.Transport.Dial(): it connects to the Receiver
+// at 'raddr' and completes the QUIC handshake.
+func (tr *Transport) Dial(network string, laddr, raddr *net.UDPAddr,
+) (net.Conn, error) {
+	tlsConfig, err := tr.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	pc, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	qc, err := quicgo.Dial(context.Background(), pc, raddr, tlsConfig,
+		tr.config())
+	if err != nil {
+		_ = pc.Close()
+		return nil, fmt.Errorf("quic: handshake with %s: %w", raddr, err)
+	}
+	return &datagramConn{qc: qc, pc: pc}, nil
+} //                                                                        Dial
+
+// Listen implements udpt.Transport.Listen(): it accepts QUIC connections
+// from Senders at 'laddr', and returns a net.PacketConn from which the
+// Receiver reads the datagrams of all of them.
+func (tr *Transport) Listen(network string, laddr *net.UDPAddr,
+) (net.PacketConn, error) {
+	tlsConfig, err := tr.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	pc, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := quicgo.Listen(pc, tlsConfig, tr.config())
+	if err != nil {
+		_ = pc.Close()
+		return nil, fmt.Errorf("quic: %w", err)
+	}
+	pl := &packetListener{
+		ln:      ln,
+		pc:      pc,
+		packets: make(chan packet, 256),
+		conns:   make(map[string]*quicgo.Conn),
+		closed:  make(chan struct{}),
+	}
+	go pl.accept()
+	return pl, nil
+} //                                                                      Listen
+
+// config returns a copy of Config, or the default
+// QUIC configuration, with datagrams enabled.
+func (tr *Transport) config() *quicgo.Config {
+	var ret quicgo.Config
+	if tr.Config != nil {
+		ret = *tr.Config
+	} else {
+		ret.KeepAlivePeriod = 10 * time.Second
+	}
+	ret.EnableDatagrams = true
+	return &ret
+} //                                                                      config
+
+// tlsConfig returns a copy of TLSConfig, with
+// NextProtos set to ALPN if it is empty.
+func (tr *Transport) tlsConfig() (*tls.Config, error) {
+	if tr.TLSConfig == nil {
+		return nil, errors.New("quic: nil Transport.TLSConfig")
+	}
+	ret := tr.TLSConfig.Clone()
+	if len(ret.NextProtos) == 0 {
+		ret.NextProtos = []string{ALPN}
+	}
+	return ret, nil
+} //                                                                   tlsConfig
+
+// -----------------------------------------------------------------------------
+
+// datagramConn is the net.Conn returned by Dial(). It reads and
+// writes DATAGRAM frames on a Sender's QUIC connection.
+type datagramConn struct {
+	qc       *quicgo.Conn
+	pc       net.PacketConn // closed with the connection
+	mu       sync.Mutex
+	deadline time.Time
+} //                                                                datagramConn
+
+// Read implements net.Conn.Read(). It returns os.ErrDeadlineExceeded
+// when the read deadline passes. Datagrams longer than 'b' are
+// truncated.
+func (dc *datagramConn) Read(b []byte) (int, error) {
+	dc.mu.Lock()
+	deadline := dc.deadline
+	dc.mu.Unlock()
+	ctx := context.Background()
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	data, err := dc.qc.ReceiveDatagram(ctx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		return 0, err
+	}
+	return copy(b, data), nil
+} //                                                                        Read
+
+// Write implements net.Conn.Write(), sending 'b' in a DATAGRAM frame.
+func (dc *datagramConn) Write(b []byte) (int, error) {
+	err := dc.qc.SendDatagram(b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+} //                                                                       Write
+
+// Close implements net.Conn.Close(), closing the
+// QUIC connection and the socket it used.
+func (dc *datagramConn) Close() error {
+	err := dc.qc.CloseWithError(0, "")
+	if err2 := dc.pc.Close(); err == nil {
+		err = err2
+	}
+	return err
+} //                                                                       Close
+
+// LocalAddr implements net.Conn.LocalAddr().
+func (dc *datagramConn) LocalAddr() net.Addr {
+	return dc.qc.LocalAddr()
+} //                                                                   LocalAddr
+
+// RemoteAddr implements net.Conn.RemoteAddr().
+func (dc *datagramConn) RemoteAddr() net.Addr {
+	return dc.qc.RemoteAddr()
+} //                                                                  RemoteAddr
+
+// SetDeadline implements net.Conn.SetDeadline().
+// Only the read deadline is used.
+func (dc *datagramConn) SetDeadline(t time.Time) error {
+	return dc.SetReadDeadline(t)
+} //                                                                 SetDeadline
+
+// SetReadDeadline implements net.Conn.SetReadDeadline().
+// It applies to the calls of Read() made after it.
+func (dc *datagramConn) SetReadDeadline(t time.Time) error {
+	dc.mu.Lock()
+	dc.deadline = t
+	dc.mu.Unlock()
+	return nil
+} //                                                             SetReadDeadline
+
+// SetWriteDeadline implements net.Conn.SetWriteDeadline().
+// It does nothing, since sending datagrams doesn't block.
+func (dc *datagramConn) SetWriteDeadline(t time.Time) error {
+	return nil
+} //                                                            SetWriteDeadline
+
+// -----------------------------------------------------------------------------
+
+// packet is a datagram received from a Sender's QUIC connection.
+type packet struct {
+	data []byte
+	addr net.Addr
+} //                                                                      packet
+
+// packetListener is the net.PacketConn returned by Listen(). It
+// accepts the QUIC connections of Senders, each read by its own
+// goroutine, and replies to each Sender on its connection.
+type packetListener struct {
+	ln       *quicgo.Listener
+	pc       net.PacketConn // closed with the listener
+	packets  chan packet
+	mu       sync.Mutex
+	conns    map[string]*quicgo.Conn // by remote address
+	deadline time.Time
+	closed   chan struct{}
+	once     sync.Once
+} //                                                              packetListener
+
+// ReadFrom implements net.PacketConn.ReadFrom(). It returns
+// os.ErrDeadlineExceeded when the read deadline passes,
+// and net.ErrClosed once the listener is closed.
+func (pl *packetListener) ReadFrom(b []byte) (int, net.Addr, error) {
+	pl.mu.Lock()
+	deadline := pl.deadline
+	pl.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case pk := <-pl.packets:
+		n := copy(b, pk.data)
+		if n < len(pk.data) {
+			n = len(b) // the caller detects truncation as len(b)
+		}
+		return n, pk.addr, nil
+	case <-pl.closed:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+} //                                                                    ReadFrom
+
+// WriteTo implements net.PacketConn.WriteTo(), sending 'b' in
+// a DATAGRAM frame on the QUIC connection of the Sender at 'addr'.
+func (pl *packetListener) WriteTo(b []byte, addr net.Addr) (int, error) {
+	pl.mu.Lock()
+	qc := pl.conns[addr.String()]
+	pl.mu.Unlock()
+	if qc == nil {
+		return 0, fmt.Errorf("quic: no connection from %s", addr)
+	}
+	err := qc.SendDatagram(b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+} //                                                                     WriteTo
+
+// Close implements net.PacketConn.Close(), closing the
+// listener, the connections of all Senders and the socket.
+func (pl *packetListener) Close() error {
+	var err error
+	pl.once.Do(func() {
+		close(pl.closed)
+		pl.mu.Lock()
+		for k, qc := range pl.conns {
+			_ = qc.CloseWithError(0, "")
+			delete(pl.conns, k)
+		}
+		pl.mu.Unlock()
+		err = pl.ln.Close()
+		if err2 := pl.pc.Close(); err == nil {
+			err = err2
+		}
+	})
+	return err
+} //                                                                       Close
+
+// LocalAddr implements net.PacketConn.LocalAddr().
+func (pl *packetListener) LocalAddr() net.Addr {
+	return pl.ln.Addr()
+} //                                                                   LocalAddr
+
+// SetDeadline implements net.PacketConn.SetDeadline().
+// Only the read deadline is used.
+func (pl *packetListener) SetDeadline(t time.Time) error {
+	return pl.SetReadDeadline(t)
+} //                                                                 SetDeadline
+
+// SetReadDeadline implements net.PacketConn.SetReadDeadline().
+// It applies to the calls of ReadFrom() made after it.
+func (pl *packetListener) SetReadDeadline(t time.Time) error {
+	pl.mu.Lock()
+	pl.deadline = t
+	pl.mu.Unlock()
+	return nil
+} //                                                             SetReadDeadline
+
+// SetWriteDeadline implements net.PacketConn.SetWriteDeadline().
+// It does nothing, since sending datagrams doesn't block.
+func (pl *packetListener) SetWriteDeadline(t time.Time) error {
+	return nil
+} //                                                            SetWriteDeadline
+
+// accept accepts the connections of Senders until the listener is closed.
+func (pl *packetListener) accept() {
+	for {
+		qc, err := pl.ln.Accept(context.Background())
+		if err != nil {
+			return // the listener is closed
+		}
+		go pl.serve(qc)
+	}
+} //                                                                      accept
+
+// serve passes the datagrams read from the Sender's connection 'qc'
+// to ReadFrom(), until the connection is closed or times out.
+func (pl *packetListener) serve(qc *quicgo.Conn) {
+	defer func() { _ = qc.CloseWithError(0, "") }()
+	addr := qc.RemoteAddr()
+	k := addr.String()
+	pl.mu.Lock()
+	if old := pl.conns[k]; old != nil {
+		_ = old.CloseWithError(0, "") // the Sender has reconnected
+	}
+	pl.conns[k] = qc
+	pl.mu.Unlock()
+	defer func() {
+		pl.mu.Lock()
+		if pl.conns[k] == qc {
+			delete(pl.conns, k)
+		}
+		pl.mu.Unlock()
+	}()
+	for {
+		data, err := qc.ReceiveDatagram(context.Background())
+		if err != nil {
+			return
+		}
+		select {
+		case pl.packets <- packet{data: data, addr: addr}:
+		case <-pl.closed:
+			return
+		}
+	}
+} //                                                                       serve
+
+// end
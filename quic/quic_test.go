@@ -0,0 +1,113 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /quic/[quic_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package quic
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/balacode/udpt"
+)
+
+// selfSigned returns a self-signed certificate for "localhost",
+// and a pool with which clients can verify it.
+func selfSigned(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("0xE3A7D5", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal("0xE9C4B6", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("0xE6D1F3", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// (tr *Transport) Dial(network string, laddr, raddr *net.UDPAddr,
+// ) (net.Conn, error)
+//
+// (tr *Transport) Listen(network string, laddr *net.UDPAddr,
+// ) (net.PacketConn, error)
+//
+// go test -run Test_Transport_
+//
+// must deliver data items in QUIC datagrams, and fail
+// to connect to a Receiver with an untrusted certificate
+func Test_Transport_(t *testing.T) {
+	cert, pool := selfSigned(t)
+	cryptoKey := []byte("0123456789abcdefghijklmnopqrst12")
+	received := make(chan []byte, 1)
+	rc := udpt.Receiver{
+		Port:      9862,
+		CryptoKey: cryptoKey,
+		Config:    udpt.NewDefaultConfig(),
+		Receive: func(k string, v []byte) error {
+			received <- v
+			return nil
+		},
+	}
+	rc.Config.PacketSizeLimit = PacketSizeLimit
+	rc.Config.PacketPayloadSize = PacketPayloadSize
+	rc.Config.Transport = &Transport{TLSConfig: &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}}
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	newSender := func(roots *x509.CertPool) *udpt.Sender {
+		cf := udpt.NewDefaultConfig()
+		cf.PacketSizeLimit = PacketSizeLimit
+		cf.PacketPayloadSize = PacketPayloadSize
+		cf.SendRetries = 1
+		cf.ReplyTimeout = 500 * time.Millisecond
+		cf.Transport = &Transport{TLSConfig: &tls.Config{
+			RootCAs:    roots,
+			ServerName: "localhost",
+		}}
+		return &udpt.Sender{Address: "127.0.0.1:9862", CryptoKey: cryptoKey,
+			Config: cf}
+	}
+	value := bytes.Repeat([]byte("QUIC "), 2000)
+	if err := newSender(pool).Send("key", value); err != nil {
+		t.Fatal("0xE4B8A1", err)
+	}
+	select {
+	case got := <-received:
+		if !bytes.Equal(got, value) {
+			t.Error("0xE7F2C5", "wrong value received")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("0xE1D6E8", "item not received")
+	}
+	// must fail when the certificate can't be verified
+	err := newSender(x509.NewCertPool()).Send("key", value)
+	if err == nil {
+		t.Error("0xE5C3A9", "sent to an untrusted Receiver")
+	}
+}
+
+// end
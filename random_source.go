@@ -0,0 +1,103 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[random_source.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"reflect"
+	"sync"
+)
+
+// randomMu serializes the reads from Configuration.Random, which the
+// encryption workers, retry policies and key exchanges of any number
+// of Senders and Receivers may make at the same time.
+var randomMu sync.Mutex
+
+// lockedRandom reads from Configuration.Random while holding randomMu.
+type lockedRandom struct {
+	r io.Reader
+} //                                                                lockedRandom
+
+// Read implements io.Reader. It fills 'b' in one go, so that the bytes
+// of concurrent reads are never interleaved.
+func (lr lockedRandom) Read(b []byte) (int, error) {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+	return io.ReadFull(lr.r, b)
+} //                                                                        Read
+
+// lockRandom returns 'r' (i.e. Configuration.Random) wrapped
+// in a lockedRandom, or nil if 'r' is nil.
+func lockRandom(r io.Reader) io.Reader {
+	if r == nil {
+		return nil
+	}
+	if _, ok := r.(lockedRandom); ok {
+		return r
+	}
+	return lockedRandom{r: r}
+} //                                                                  lockRandom
+
+// sameRandom returns true if 'a' and 'b' read from the same source, even
+// if only one is wrapped in a lockedRandom. Sources that can't be
+// compared, e.g. those of func types, are never the same.
+func sameRandom(a, b io.Reader) bool {
+	if lr, ok := a.(lockedRandom); ok {
+		a = lr.r
+	}
+	if lr, ok := b.(lockedRandom); ok {
+		b = lr.r
+	}
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	ta := reflect.TypeOf(a)
+	return ta == reflect.TypeOf(b) && ta.Comparable() && a == b
+} //                                                                  sameRandom
+
+// randomCipher is implemented by the built-in ciphers, which
+// can generate their nonces from Configuration.Random.
+type randomCipher interface {
+
+	// setRandom makes the cipher read nonces from 'r',
+	// or from crypto/rand if 'r' is nil.
+	setRandom(r io.Reader)
+} //                                                                randomCipher
+
+// applyRandomSource is called at startup and passes Configuration.Random
+// to the cipher. It returns an error if Configuration.Random is specified
+// but the cipher can't use it, since the outputs would not be reproducible.
+func applyRandomSource(cf *Configuration) error {
+	rc, ok := cf.Cipher.(randomCipher)
+	if !ok {
+		if cf.Random != nil {
+			return makeError(0xEF4669,
+				"Configuration.Random requires a built-in cipher")
+		}
+		return nil
+	}
+	rc.setRandom(lockRandom(cf.Random))
+	return nil
+} //                                                           applyRandomSource
+
+// randomInt63n returns a random number from 0 to n-1 (n must be above
+// zero), reading it from 'r' or, if 'r' is nil, from math/rand.
+// If reading from 'r' fails, it returns n/2.
+func randomInt63n(r io.Reader, n int64) int64 {
+	if r == nil {
+		return rand.Int63n(n)
+	}
+	var buf [8]byte
+	_, err := io.ReadFull(lockRandom(r), buf[:])
+	if err != nil {
+		return n / 2
+	}
+	return int64(binary.BigEndian.Uint64(buf[:]) % uint64(n))
+} //                                                                randomInt63n
+
+// end
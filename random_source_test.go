@@ -0,0 +1,136 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /[random_source_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// applyRandomSource(cf *Configuration) error
+//
+// go test -run Test_applyRandomSource_
+//
+func Test_applyRandomSource_(t *testing.T) {
+	cf := NewDefaultConfig()
+	random := rand.New(rand.NewSource(1))
+	cf.Random = random
+	err := applyRandomSource(cf)
+	if err != nil || cf.Cipher.(*aesCipher).random != lockRandom(random) {
+		t.Error("0xEE40E4", err)
+	}
+	// must go back to crypto/rand when Random is cleared
+	cf.Random = nil
+	err = applyRandomSource(cf)
+	if err != nil || cf.Cipher.(*aesCipher).random != nil {
+		t.Error("0xE1D877", err)
+	}
+	// must fail when the cipher can't use Random
+	cf.Cipher = &plainCipher{}
+	if err := applyRandomSource(cf); err != nil {
+		t.Error("0xED2AF4", err)
+	}
+	cf.Random = random
+	err = applyRandomSource(cf)
+	if !matchError(err, "requires a built-in cipher") {
+		t.Error("0xE5C767", "wrong error:", err)
+	}
+}
+
+// must be safe while others that share the cipher encrypt with it,
+// e.g. the Senders of SendMany (run with -race to check)
+func Test_applyRandomSource_2(t *testing.T) {
+	cf := NewDefaultConfig()
+	cf.Random = rand.New(rand.NewSource(1))
+	_ = cf.Cipher.SetKey([]byte(testAESKey))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := applyRandomSource(cf); err != nil {
+					t.Error("0xE5D3A8", err)
+				}
+				if _, err := cf.Cipher.Encrypt([]byte("abc")); err != nil {
+					t.Error("0xE9C2B6", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// lockRandom(r io.Reader) io.Reader
+//
+// go test -run Test_lockRandom_
+//
+// must serialize concurrent reads, e.g. from the encryption workers
+func Test_lockRandom_(t *testing.T) {
+	if lockRandom(nil) != nil {
+		t.Error("0xE4B7D3", "must return nil for nil")
+	}
+	cr := &concurrencyReader{}
+	r := lockRandom(lockRandom(cr))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = randomInt63n(r, 1000)
+			}
+		}()
+	}
+	wg.Wait()
+	if atomic.LoadInt32(&cr.overlaps) != 0 {
+		t.Error("0xE8C1F6", "concurrent reads:", cr.overlaps)
+	}
+}
+
+// concurrencyReader is a random source that counts the reads
+// made while another read is in progress.
+type concurrencyReader struct {
+	busy, overlaps int32
+}
+
+func (cr *concurrencyReader) Read(b []byte) (int, error) {
+	if !atomic.CompareAndSwapInt32(&cr.busy, 0, 1) {
+		atomic.AddInt32(&cr.overlaps, 1)
+	}
+	for i := range b {
+		b[i] = byte(i)
+	}
+	atomic.StoreInt32(&cr.busy, 0)
+	return len(b), nil
+}
+
+// randomInt63n(r io.Reader, n int64) int64
+//
+// go test -run Test_randomInt63n_
+//
+func Test_randomInt63n_(t *testing.T) {
+	for _, n := range []int64{1, 2, 7, 1000} {
+		for i := 0; i < 100; i++ {
+			if v := randomInt63n(nil, n); v < 0 || v >= n {
+				t.Error("0xE5F678", n, v)
+			}
+		}
+	}
+	r := bytes.NewReader([]byte{0, 0, 0, 0, 0, 0, 0, 10, 0xFF})
+	if v := randomInt63n(r, 7); v != 3 {
+		t.Error("0xE93708", v)
+	}
+	// must return n/2 when 'r' runs out
+	if v := randomInt63n(r, 10); v != 5 {
+		t.Error("0xE90833", v)
+	}
+}
+
+// end
@@ -0,0 +1,147 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /[rate_controller.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"sync"
+	"time"
+)
+
+// RateController paces the packets sent by a Sender, so that senders on
+// constrained links don't send packets faster than the network can carry
+// them, which only causes more packets to be lost and resent.
+//
+// Set Configuration.RateController to use it. TokenBucket is the
+// built-in implementation. The methods may be called concurrently,
+// and by several Senders if they share a Configuration.
+//
+type RateController interface {
+
+	// Reserve is called before a packet of 'size' bytes is sent at
+	// time 'now', and returns how long the Sender must wait before
+	// sending it. Zero means the packet can be sent at once.
+	Reserve(size int, now time.Time) time.Duration
+
+	// OnAck is called when a packet of 'size' bytes has
+	// been confirmed by the Receiver, 'rtt' after it was sent.
+	OnAck(size int, rtt time.Duration)
+
+	// OnLoss is called when the Sender has stopped waiting for
+	// confirmations and 'lost' packets remain unconfirmed.
+	OnLoss(lost int)
+} //                                                              RateController
+
+// TokenBucket is a RateController that limits the sending rate to Rate
+// bytes per second, while allowing bursts of up to Burst bytes after
+// the Sender has been idle.
+//
+// It can also adapt Rate to the network in the manner of TCP's AIMD
+// (additive increase, multiplicative decrease): Rate grows by Increase
+// with every confirmed packet, and is multiplied by Decrease whenever
+// packets are lost, within the range from MinRate to MaxRate.
+//
+type TokenBucket struct {
+
+	// Rate is the sending rate, in bytes per second.
+	// Zero (or less) means there is no limit.
+	Rate float64
+
+	// Burst is the number of bytes that can be sent at once. A packet
+	// larger than Burst can still be sent when the bucket is full.
+	Burst int
+
+	// Increase is added to Rate for every confirmed packet,
+	// in bytes per second. Zero disables increases.
+	Increase float64
+
+	// Decrease is the factor by which Rate is multiplied when packets
+	// are lost, such as 0.5. Zero, or 1 or more, disables decreases.
+	Decrease float64
+
+	// MinRate and MaxRate limit the changes to Rate
+	// made by Increase and Decrease. A zero MaxRate
+	// means Rate can increase without limit.
+	MinRate float64
+	MaxRate float64
+
+	mu     sync.Mutex
+	tokens float64   // bytes that can be sent now; negative when in debt
+	last   time.Time // time of the last Reserve, or zero
+} //                                                                 TokenBucket
+
+// NewTokenBucket creates a TokenBucket that sends 'rate'
+// bytes per second, in bursts of up to 'burst' bytes.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{Rate: rate, Burst: burst}
+} //                                                              NewTokenBucket
+
+// Reserve implements RateController.Reserve().
+func (tb *TokenBucket) Reserve(size int, now time.Time) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.Rate <= 0 {
+		return 0
+	}
+	capacity := float64(tb.Burst)
+	if capacity < float64(size) {
+		capacity = float64(size)
+	}
+	if tb.last.IsZero() {
+		tb.tokens = capacity
+	} else if now.After(tb.last) {
+		tb.tokens += now.Sub(tb.last).Seconds() * tb.Rate
+		if tb.tokens > capacity {
+			tb.tokens = capacity
+		}
+	}
+	// 'last' only moves forward, so that reservations made while
+	// waiting for earlier ones are queued behind them
+	if now.After(tb.last) {
+		tb.last = now
+	}
+	tb.tokens -= float64(size)
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.Rate * float64(time.Second))
+} //                                                                     Reserve
+
+// OnAck implements RateController.OnAck().
+func (tb *TokenBucket) OnAck(size int, rtt time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.Increase <= 0 || tb.Rate <= 0 {
+		return
+	}
+	tb.Rate += tb.Increase
+	if tb.MaxRate > 0 && tb.Rate > tb.MaxRate {
+		tb.Rate = tb.MaxRate
+	}
+} //                                                                       OnAck
+
+// OnLoss implements RateController.OnLoss().
+func (tb *TokenBucket) OnLoss(lost int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.Decrease <= 0 || tb.Decrease >= 1 || tb.Rate <= 0 || lost < 1 {
+		return
+	}
+	tb.Rate *= tb.Decrease
+	if tb.Rate < tb.MinRate {
+		tb.Rate = tb.MinRate
+	}
+} //                                                                      OnLoss
+
+// setRate changes Rate to 'rate', allowing bursts of 10 ms
+// at that rate. Zero (or less) means there is no limit.
+func (tb *TokenBucket) setRate(rate float64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.Rate = rate
+	tb.Burst = int(rate / 100)
+} //                                                                     setRate
+
+// end
@@ -0,0 +1,103 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                           /[rate_controller_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"testing"
+	"time"
+)
+
+// (tb *TokenBucket) Reserve(size int, now time.Time) time.Duration
+//
+// go test -run Test_TokenBucket_Reserve_
+//
+func Test_TokenBucket_Reserve_(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tb := NewTokenBucket(1000, 1500) // 1000 bytes per second
+	for i, test := range []struct {
+		size  int
+		now   time.Time
+		delay time.Duration
+	}{
+		{1000, t0, 0},                                   // within the burst
+		{1000, t0, 500 * time.Millisecond},              // 500 bytes short
+		{1000, t0, 1500 * time.Millisecond},             // queued behind it
+		{500, t0.Add(5 * time.Second), 0},               // refilled to 1500
+		{2000, t0.Add(10 * time.Second), 0},             // larger than burst
+		{1, t0.Add(10 * time.Second), time.Millisecond}, // but not twice
+	} {
+		got := tb.Reserve(test.size, test.now)
+		if got != test.delay {
+			t.Error("0xEF1E31", i, "got:", got, "want:", test.delay)
+		}
+	}
+	// zero Rate means no limit
+	tb = &TokenBucket{}
+	if got := tb.Reserve(1e9, t0); got != 0 {
+		t.Error("0xE221E3", got)
+	}
+}
+
+// (tb *TokenBucket) OnAck(size int, rtt time.Duration)
+// (tb *TokenBucket) OnLoss(lost int)
+//
+// go test -run Test_TokenBucket_OnAck_
+//
+func Test_TokenBucket_OnAck_(t *testing.T) {
+	tb := &TokenBucket{Rate: 1000, Increase: 100, Decrease: 0.5,
+		MinRate: 300, MaxRate: 1150}
+	tb.OnAck(1000, time.Millisecond)
+	if tb.Rate != 1100 {
+		t.Error("0xE6792D", tb.Rate)
+	}
+	tb.OnAck(1000, time.Millisecond)
+	if tb.Rate != 1150 {
+		t.Error("0xEAAF99", tb.Rate)
+	}
+	tb.OnLoss(3)
+	if tb.Rate != 575 {
+		t.Error("0xE6C686", tb.Rate)
+	}
+	tb.OnLoss(1)
+	if tb.Rate != 300 {
+		t.Error("0xE426FB", tb.Rate)
+	}
+	// without Increase and Decrease, Rate doesn't change
+	tb = NewTokenBucket(1000, 0)
+	tb.OnAck(1000, time.Millisecond)
+	tb.OnLoss(1)
+	if tb.Rate != 1000 {
+		t.Error("0xE7B76E", tb.Rate)
+	}
+}
+
+// (tb *TokenBucket) setRate(rate float64)
+//
+// go test -run Test_TokenBucket_setRate_
+//
+func Test_TokenBucket_setRate_(t *testing.T) {
+	var tb TokenBucket
+	now := time.Now()
+	if d := tb.Reserve(1000000, now); d != 0 {
+		t.Error("0xE48087", d) // no limit yet
+	}
+	tb.setRate(1000)
+	if tb.Rate != 1000 || tb.Burst != 10 {
+		t.Error("0xE5BB3B", tb.Rate, tb.Burst)
+	}
+	if d := tb.Reserve(500, now); d != 0 {
+		t.Error("0xE9F49F", d) // the bucket starts full
+	}
+	if d := tb.Reserve(500, now); d != 500*time.Millisecond {
+		t.Error("0xE97D58", d)
+	}
+	tb.setRate(0)
+	if d := tb.Reserve(1000000, now); d != 0 {
+		t.Error("0xEC5E5E", d)
+	}
+}
+
+// end
@@ -15,6 +15,10 @@ import (
 // errClosed error occurs when trying to read from a closed connection.
 var errClosed = errors.New("use of closed network connection")
 
+// errOversized error occurs when a datagram larger than the size
+// limit is received. It is truncated when read, so it can't be used.
+var errOversized = errors.New("datagram exceeds Config.PacketSizeLimit")
+
 // errTimeout error occurs when a read operation times out.
 //
 // NOTE: this error is currently not checked for.
@@ -28,13 +32,19 @@ var errTimeout = errors.New("i/o timeout")
 // 'tempBuf' contains a temporary buffer that holds the received
 // packet's data. It is reused between calls to this function to
 // avoid unnecessary memory allocations and de-allocations.
-// The size of 'tempBuf' must be Config.PacketSizeLimit or greater.
+//
+// Datagrams longer than 'sizeLimit' (normally Config.PacketSizeLimit)
+// are not decrypted; readAndDecrypt returns errOversized and the address
+// of the sender instead. Since a datagram that doesn't fit in 'tempBuf'
+// is silently truncated, 'tempBuf' must be at least one byte longer
+// than 'sizeLimit' to detect them. See newReadBuffer().
 //
 func readAndDecrypt(
 	conn netUDPConn,
 	timeout time.Duration,
 	decryptor SymmetricCipher,
 	tempBuf []byte,
+	sizeLimit int,
 ) (
 	data []byte,
 	addr net.Addr,
@@ -49,6 +59,30 @@ func readAndDecrypt(
 	if tempBuf == nil {
 		return nil, nil, makeError(0xED80B0, "nil tempBuf")
 	}
+	data, addr, err = readDatagram(conn, timeout, tempBuf, sizeLimit)
+	if err != nil {
+		return nil, addr, err
+	}
+	data, err = decryptor.Decrypt(data)
+	if err != nil {
+		data, addr, err = nil, nil, makeError(0xE2B5A1, err)
+	}
+	return data, addr, err
+} //                                                              readAndDecrypt
+
+// readDatagram reads a datagram from 'conn' into 'tempBuf', like
+// readAndDecrypt() but without decrypting it. Returns the datagram,
+// which is overwritten by the next read, and the address of its sender.
+func readDatagram(
+	conn netUDPConn,
+	timeout time.Duration,
+	tempBuf []byte,
+	sizeLimit int,
+) (
+	data []byte,
+	addr net.Addr,
+	err error,
+) {
 	dl := time.Now().Add(timeout)
 	err = conn.SetReadDeadline(dl)
 	if err != nil {
@@ -59,12 +93,17 @@ func readAndDecrypt(
 	if err != nil {
 		return nil, nil, netError(err, 0xE0E0B1)
 	}
-	data, err = decryptor.Decrypt(tempBuf[:nRead])
-	if err != nil {
-		data, addr, err = nil, nil, makeError(0xE2B5A1, err)
+	if nRead > sizeLimit {
+		return nil, addr, errOversized
 	}
-	return data, addr, err
-} //                                                              readAndDecrypt
+	return tempBuf[:nRead], addr, nil
+} //                                                                readDatagram
+
+// newReadBuffer returns a buffer for readAndDecrypt() that is large
+// enough to detect datagrams longer than 'sizeLimit'.
+func newReadBuffer(sizeLimit int) []byte {
+	return make([]byte, sizeLimit+1)
+} //                                                               newReadBuffer
 
 // netError filters out network errors for readAndDecrypt() and returns
 // them as distinct error instances like errClosed and errTimeout.
@@ -12,7 +12,9 @@ import (
 )
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
-// readAndDecrypt(conn netUDPConn, tempBuf []byte, timeout time.Duration)
+// readAndDecrypt(conn netUDPConn, timeout time.Duration,
+//     decryptor SymmetricCipher, tempBuf []byte, sizeLimit int,
+// ) (data []byte, addr net.Addr, err error)
 //
 // go test -run Test_readAndDecrypt_*
 
@@ -23,6 +25,7 @@ func Test_readAndDecrypt_1(t *testing.T) {
 		time.Second,            // timeout
 		newTestAESCipher(t),    // decryptor
 		newTestAESCiphertext(), // tempBuf
+		65536,                  // sizeLimit
 	)
 	if string(data) != "abc" {
 		t.Error("0xE6E2DD")
@@ -43,6 +46,7 @@ func Test_readAndDecrypt_2(t *testing.T) {
 		time.Second, // timeout
 		nil,         // decryptor
 		nil,         // tempBuf
+		65536,       // sizeLimit
 	)
 	if len(data) != 0 {
 		t.Error("0xEF5EA3")
@@ -62,6 +66,7 @@ func Test_readAndDecrypt_3(t *testing.T) {
 		time.Second,         // timeout
 		nil,                 // decryptor <-failure: nil decryptor
 		make([]byte, 65536), // tempBuf
+		65536,               // sizeLimit
 	)
 	if len(data) != 0 {
 		t.Error("0xEA7CA1")
@@ -81,6 +86,7 @@ func Test_readAndDecrypt_4(t *testing.T) {
 		time.Second,         // timeout
 		newTestAESCipher(t), // decryptor
 		nil,                 // tempBuf <-failure: nil tempBuf
+		65536,               // sizeLimit
 	)
 	if len(data) != 0 {
 		t.Error("0xE6E42A")
@@ -100,6 +106,7 @@ func Test_readAndDecrypt_5(t *testing.T) {
 		time.Second,         // timeout
 		newTestAESCipher(t), // decryptor
 		make([]byte, 65536), // tempBuf
+		65536,               // sizeLimit
 	)
 	if len(data) != 0 {
 		t.Error("0xEC3C98")
@@ -119,6 +126,7 @@ func Test_readAndDecrypt_6(t *testing.T) {
 		time.Second,                         // timeout
 		newTestAESCipher(t),                 // decryptor
 		make([]byte, 65536),                 // tempBuf
+		65536,                               // sizeLimit
 	)
 	if len(data) != 0 {
 		t.Error("0xED40F6")
@@ -138,6 +146,7 @@ func Test_readAndDecrypt_7(t *testing.T) {
 		time.Second,                    // timeout
 		newTestAESCipher(t),            // decryptor
 		[]byte{0xA8, 0xE1, 0x7D, 0xD6}, // tempBuf <-failure: bad ciphertext
+		65536,                          // sizeLimit
 	)
 	if data != nil {
 		t.Error("0xEC9C89")
@@ -150,6 +159,27 @@ func Test_readAndDecrypt_7(t *testing.T) {
 	}
 }
 
+// must fail with errOversized, and return the sender's address,
+// when the datagram is longer than sizeLimit
+func Test_readAndDecrypt_8(t *testing.T) {
+	data, addr, err := readAndDecrypt(
+		&mockNetUDPConn{},   // conn
+		time.Second,         // timeout
+		newTestAESCipher(t), // decryptor
+		make([]byte, 11),    // tempBuf
+		10,                  // sizeLimit <-failure: 11 bytes read
+	)
+	if data != nil {
+		t.Error("0xE4D489")
+	}
+	if addr == nil || addr.String() != "127.8.9.10:11" {
+		t.Error("0xE90210", addr)
+	}
+	if err != errOversized {
+		t.Error("0xE8337F", "wrong error:", err)
+	}
+}
+
 // -----------------------------------------------------------------------------
 
 // netError(err error, otherErrorID uint32) error
@@ -0,0 +1,167 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /[reassembly_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// Tests checking that a Receiver assembles data items correctly,
+// no matter in which order or how many times pieces arrive. Each case
+// is repeated with several seeds, which shuffle the pieces differently.
+//
+// to run all tests in this file:
+// go test -v -run Test_reassembly_*
+
+// -----------------------------------------------------------------------------
+
+// pieces arriving in any order, with duplicates, must be
+// delivered exactly once, as soon as the last piece arrives
+//
+// go test -run Test_reassembly_1
+//
+func Test_reassembly_1(t *testing.T) {
+	for _, tc := range []struct {
+		size        int
+		payloadSize int
+	}{
+		{0, 1}, {1, 1}, {1, 64}, {10, 3}, {100, 7},
+		{500, 64}, {1000, 13}, {5000, 50},
+	} {
+		for seed := int64(1); seed <= 20; seed++ {
+			rnd := rand.New(rand.NewSource(seed))
+			v := make([]byte, tc.size) // random, so it doesn't compress
+			rnd.Read(v)
+			packets := makeTestFragments(v, tc.payloadSize)
+			//
+			// shuffle the pieces, and resend some pieces already sent
+			var order []int
+			for _, n := range rnd.Perm(len(packets)) {
+				for len(order) > 0 && rnd.Intn(3) == 0 {
+					order = append(order, order[rnd.Intn(len(order))])
+				}
+				order = append(order, n)
+			}
+			got, err := receiveTestFragments(packets, order)
+			if err != nil {
+				t.Error("0xE9D667", tc, seed, err)
+			}
+			if len(got) != 1 || !bytes.Equal(got[0], v) {
+				t.Error("0xE1B677", tc, seed, "deliveries:", len(got))
+			}
+		}
+	}
+}
+
+// pieces of two layouts of the same item (as when a Sender splits the
+// item into smaller pieces mid-transfer) must be delivered exactly once
+// when they arrive interleaved, in any order, with duplicates
+//
+// go test -run Test_reassembly_2
+//
+func Test_reassembly_2(t *testing.T) {
+	for _, tc := range []struct {
+		size         int
+		payloadSize1 int
+		payloadSize2 int
+	}{
+		{1, 1, 1}, {1, 64, 1}, {10, 3, 2}, {100, 7, 3},
+		{100, 3, 7}, {500, 64, 13}, {1000, 50, 25}, {5000, 64, 33},
+	} {
+		for seed := int64(1); seed <= 20; seed++ {
+			rnd := rand.New(rand.NewSource(seed))
+			v := make([]byte, tc.size) // random, so it doesn't compress
+			rnd.Read(v)
+			sd := makeTestFragmentSender(v, tc.payloadSize1)
+			var old [][]byte
+			for _, pk := range sd.packets {
+				old = append(old, pk.data)
+			}
+			sd.Config.PacketPayloadSize = tc.payloadSize2
+			_ = sd.resplitPackets()
+			packets := old
+			for _, pk := range sd.packets {
+				packets = append(packets, pk.data)
+			}
+			// some of the old pieces and all the new ones, interleaved
+			var a, b []int
+			for _, n := range rnd.Perm(len(old)) {
+				if rnd.Intn(2) == 0 {
+					a = append(a, n)
+				}
+			}
+			for _, n := range rnd.Perm(len(packets) - len(old)) {
+				b = append(b, len(old)+n)
+			}
+			var order []int
+			for len(a) > 0 || len(b) > 0 {
+				if len(b) == 0 || len(a) > 0 && rnd.Intn(2) == 0 {
+					order, a = append(order, a[0]), a[1:]
+				} else {
+					order, b = append(order, b[0]), b[1:]
+				}
+				if rnd.Intn(4) == 0 {
+					order = append(order, order[rnd.Intn(len(order))])
+				}
+			}
+			got, err := receiveTestFragments(packets, order)
+			if err != nil {
+				t.Error("0xEC3B3E", tc, seed, err)
+			}
+			if len(got) != 1 || !bytes.Equal(got[0], v) {
+				t.Error("0xED6C0D", tc, seed, "deliveries:", len(got))
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// makeTestFragments returns the (unencrypted) fragment packets
+// that a Sender creates to send 'v' using 'payloadSize'
+func makeTestFragments(v []byte, payloadSize int) [][]byte {
+	var ret [][]byte
+	for _, pk := range makeTestFragmentSender(v, payloadSize).packets {
+		ret = append(ret, pk.data)
+	}
+	return ret
+}
+
+// makeTestFragmentSender returns a Sender that has
+// split 'v' into packets with a payload of 'payloadSize'
+func makeTestFragmentSender(v []byte, payloadSize int) *Sender {
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = payloadSize
+	sd.dataHash = getHash(v)
+	sd.key = "key"
+	sd.comp, _ = sd.Config.Compressor.Compress(v)
+	_ = sd.makePackets(sd.key, sd.comp)
+	return sd
+}
+
+// receiveTestFragments passes 'packets' to a Receiver in the given
+// order and returns all the values the Receiver delivered
+func receiveTestFragments(packets [][]byte, order []int) ([][]byte, error) {
+	var ret [][]byte
+	rc := Receiver{
+		Config: NewDefaultConfig(),
+		Receive: func(k string, v []byte) error {
+			ret = append(ret, v)
+			return nil
+		},
+	}
+	for _, n := range order {
+		_, err := rc.receiveFragment(packets[n])
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+// end
@@ -14,32 +14,66 @@ package udpt
 // type Receiver struct
 //
 // # Public Methods
+//   ) KeyFingerprint() string
+//   ) Stats() ReceiverStats
 //   ) Run() error
+//   ) RunContext(ctx context.Context) error
 //   ) Stop()
+//   ) Close() error
+//   ) Rebind(addr string) error
 //
 // # Run() Internals
+//   ) cipher() SymmetricCipher
+//   ) currentConn() netUDPConn
+//   ) setConn(conn netUDPConn)
 //   ) initRun() error
 //   ) initRunDI(
+//   ) listen(
+//   ) receivePackets()
+//   ) readTimeout() time.Duration
+//   ) sendNacks(conn netUDPConn, cphr SymmetricCipher)
+//   ) expireItems(now time.Time)
 //   ) buildReply(recv []byte) (reply []byte, err error)
 //   ) sendReply(conn netUDPConn, addr net.Addr, reply []byte)
+//   ) verifyPeer(addr net.Addr) bool
+//   forgetOldest(seen map[string]time.Time)
 //
 // # Packet Handlers
 //   type fragmentHeader struct
 //   ) readFragmentHeader(recv []byte) (*fragmentHeader, error)
-//   ) receiveFragment(recv []byte) ([]byte, error)
+//   ) receiveFragment(recv []byte) (reply []byte, err error)
+//   ) receivingItemFor(h *fragmentHeader) *receivingItem
+//   ) receiveSubPiece(it *receivingItem, h *fragmentHeader, recv []byte,
+//   ) storeFragment(it *receivingItem, h *fragmentHeader, recv []byte,
+//   ) receiveStreamFragment(it *receivingItem, h *fragmentHeader,
+//   ) receiveLocal(k string, v []byte, senderID string,
+//   ) ([]byte, error)
+//   ) receiveLocalStream(k string, v []byte) error
+//   ) callReceive(info *ItemInfo, v []byte) error
 //
 // # Logging Methods
 //   ) logError(id uint32, a ...interface{}) error
 //   ) logInfo(a ...interface{})
+//   ) logDebug(a ...interface{})
+//   ) logAt(debug bool, a ...interface{})
+//
+// # Events
+//   ) emit(kind EventKind, addr net.Addr)
 
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -57,24 +91,25 @@ func Receive(
 	cryptoKey []byte,
 	receive func(k string, v []byte) error,
 ) error {
-	ch := make(chan error, 1)
-	var rc Receiver
-	go func() {
-		rc = Receiver{Port: port, CryptoKey: cryptoKey, Receive: receive}
-		err := rc.Run()
-		ch <- err
-	}()
-	defer rc.Stop()
-	select {
-	case err := <-ch:
-		return err
-	case <-ctx.Done():
+	rc := Receiver{Port: port, CryptoKey: cryptoKey, Receive: receive}
+	err := rc.RunContext(ctx)
+	if err != nil && errors.Is(err, ctx.Err()) {
 		return nil
 	}
+	return err
 } //                                                                     Receive
 
 // -----------------------------------------------------------------------------
 
+// drainTimeout is how long Receiver.Close() waits for further packets
+// that have already been sent, before it closes the connection.
+const drainTimeout = 50 * time.Millisecond
+
+// maxVerifiedPeers is the number of peer addresses a Receiver remembers
+// as verified (see OnPeerVerified), so that senders hopping between
+// addresses can't make it use up all its memory.
+const maxVerifiedPeers = 65536
+
 // Receiver receives data items sent by Send() or SendString().
 type Receiver struct {
 
@@ -82,14 +117,69 @@ type Receiver struct {
 	// This number must be between 1 and 65535.
 	Port int
 
+	// PacketConn, if specified, is the socket from which the Receiver
+	// reads packets and on which it replies, instead of listening on
+	// Port: e.g. a socket bound to a specific interface, one with
+	// SO_REUSEPORT, or an in-memory connection in tests. Port is then
+	// set to its local port, if it has one. Config.Transport is
+	// ignored, and Stop() closes it.
+	PacketConn net.PacketConn
+
+	// Group, if specified, is the IP address of a multicast group, for
+	// example "239.1.2.3", that the Receiver joins to receive the data
+	// items a Sender in Multicast mode sends to the group at Port, along
+	// with the packets sent to Port directly. It joins the group on
+	// Config.Interface, or on an interface chosen by the system if that
+	// is blank. Config.Transport is then ignored.
+	Group string
+
 	// CryptoKey is the secret symmetric encryption key that
 	// must be shared by the Sender and the Receiver.
 	//
 	// The correct size of this key depends
 	// on the implementation of SymmetricCipher.
 	//
+	// If Config.KeyExchange is enabled, it authenticates the handshakes
+	// of Senders, which must have the same key. It can be left blank,
+	// so that the Receiver accepts unauthenticated handshakes from
+	// Senders without a key (see Configuration.KeyExchange).
+	//
 	CryptoKey []byte
 
+	// PreviousKeys are keys that the Receiver accepts besides CryptoKey,
+	// so that shared keys can be rotated without a hard cutover: make the
+	// new key CryptoKey and list the old one here until all Senders have
+	// switched to the new key (see Sender.SetKey). Packets are decrypted
+	// with each key in turn, and replies are encrypted with the key of
+	// the packet. PreviousKeys requires a built-in cipher.
+	PreviousKeys [][]byte
+
+	// AAD is optional additional authenticated data, such as a tenant ID,
+	// that Senders must bind to their data items with SendOptions.AAD.
+	// Packets encrypted with another AAD (or without one) fail
+	// authentication and are dropped. AAD requires a cipher that
+	// implements AADCipher.
+	AAD []byte
+
+	// AuthTokens, if not empty, holds the authentication tokens of the
+	// Senders that may send data items to this Receiver, by their
+	// Sender.SenderID. Fragments from other Senders are rejected, even
+	// if they know CryptoKey, and ItemInfo.SenderID reports which
+	// Sender each item came from. Probes aren't authenticated.
+	AuthTokens map[string][]byte
+
+	// EndToEndKey, if specified, makes the Receiver the final destination
+	// of data items sealed with the same Sender.EndToEndKey, possibly
+	// forwarded by relays (see RelayTo). It opens each item and checks
+	// its original hash, and rejects items that aren't sealed. It can't
+	// be used with ReceiveStream or Archive.
+	//
+	// SignerKeys, if not empty, are the public keys of the Senders'
+	// SigningKeys: items that aren't signed with one are rejected.
+	//
+	EndToEndKey []byte
+	SignerKeys  []ed25519.PublicKey
+
 	// Config contains UDP and other configuration settings.
 	// These settings normally don't need to be changed.
 	Config *Configuration
@@ -103,74 +193,243 @@ type Receiver struct {
 	// The reason there are two parameters is to separate metadata like
 	// timestamps or filenames from the content of the transferred resource.
 	//
+	// To also get the Sender's address and other details of each item,
+	// specify Handler instead.
+	//
 	Receive func(k string, v []byte) error
 
+	// Handler is an optional alternative to Receive, which is called
+	// instead of it with the details of each data item (see ItemInfo).
+	// Use ReceiveFunc() to wrap an existing Receive function.
+	Handler Handler
+
+	// Archive is an optional hook for Receivers that only store or
+	// forward data items. If specified, it is called instead of
+	// Receive, Handler and ReceiveStream with the value of each item
+	// still compressed, as sent by the Sender, which saves the CPU
+	// time of uncompressing it. See UnpackArchived().
+	//
+	// Since the value isn't uncompressed, its hash (ItemInfo.Hash) can't
+	// be verified. Only the hash of the compressed value is, if Senders
+	// enable Configuration.HashCompressed. Each packet is authenticated
+	// by the cipher in any case.
+	//
+	Archive func(info *ItemInfo, comp []byte) error
+
+	// ReceiveStream is an optional callback for receiving data items that
+	// may be larger than memory. If specified, it is called instead of
+	// Receive when a new data item begins to arrive, and returns the
+	// writer into which the Receiver writes the item's value, such as
+	// an *os.File.
+	//
+	// The value is uncompressed and written as its pieces arrive in
+	// order, so only the pieces that arrive early are kept in memory.
+	// This requires a Compressor that implements StreamCompression,
+	// as the default one does. Other Compressors still work, but
+	// hold the whole compressed item in memory.
+	//
+	// If the Sender sets Configuration.VerifiedBlockSize, the value is
+	// only written once each block of the compressed item is verified,
+	// so the part already written can be consumed before the item is
+	// complete, e.g. to play a media file while it arrives.
+	//
+	// The writer is closed once the item is complete and its hash has
+	// been verified. If the item fails, for example because it was
+	// corrupted or expired (see Configuration.ItemExpiry), some of the
+	// value has already been written: if the writer has a
+	// CloseWithError(error) method (like *io.PipeWriter), it is called
+	// with the reason instead of Close.
+	//
+	ReceiveStream func(k string) (io.WriteCloser, error)
+
+	// Transforms, if specified, post-process each data item once it is
+	// complete and verified (and opened, with EndToEndKey), before it is
+	// passed to Receive or Handler: the item goes through the stages
+	// of the first route whose Pattern matches its key, e.g. to decode
+	// base64 or split NDJSON into records (see TransformStage). Each
+	// item that comes out is passed on separately, with the ItemInfo
+	// of the original item but its own key. If a stage fails, the item
+	// fails like it would if Receive failed. It can't be used with
+	// ReceiveStream or Archive.
+	Transforms []TransformRoute
+
+	// OnEvent is an optional callback that receives notable events,
+	// such as PeerVerified. It is called from the Receiver's read
+	// loop, so it should return quickly.
+	OnEvent func(ev *Event)
+
+	// OnPeerVerified is an optional hook called the first time packets
+	// from a new source address are decrypted successfully, i.e. when
+	// the peer has proven that it knows CryptoKey. Use it to provision
+	// resources for the peer, for example a per-peer output directory.
+	//
+	// If it returns an error, the packet is dropped and the hook
+	// is called again when the next packet from 'addr' arrives.
+	//
+	// A peer that sends nothing for Config.ItemExpiry is forgotten,
+	// so the hook is called again if it comes back later.
+	//
+	OnPeerVerified func(addr net.Addr) error
+
 	// -------------------------------------------------------------------------
 
 	// conn is the UDP connection on which Receiver listens;
 	// setting this to nil allows Run() to stop listening
 	conn netUDPConn
 
-	// receivingDataItem contains the data item
-	// currently being received from the Sender.
-	receivingDataItem dataItem
+	// receiving holds the data items being received, and those received
+	// recently, by receivingItemID(). It is protected by receivingMu.
+	receiving map[string]*receivingItem
+
+	// packetAddr is the source address of the packet being handled
+	// by the read loop, to which NACKs for its data item are sent
+	packetAddr net.Addr
+
+	// packetCipher is the cipher that decrypted the packet being handled
+	// by the read loop, with which NACKs for its data item are encrypted
+	packetCipher SymmetricCipher
+
+	// buffers recycles the buffers into which the read loop decrypts
+	// packets, and packetBuf is the buffer of the packet being handled,
+	// until storeFragment() claims or recycles it. See bufferPool.
+	buffers   *bufferPool
+	packetBuf *[]byte
+
+	// previousCiphers hold the ciphers for PreviousKeys.
+	// They are created by initRun().
+	previousCiphers []SymmetricCipher
+
+	// sessions holds the session keys negotiated with Senders, by their
+	// address, the last used first (see Config.KeyExchange). Sessions
+	// unused for Config.ItemExpiry are removed by expireItems(). Only
+	// the read loop uses it.
+	sessions map[string][]*keySession
+
+	// handshakes remembers the nonces of the authenticated handshakes
+	// that the Receiver has accepted, to refuse them if they are
+	// replayed (see checkFresh). Only the read loop uses it.
+	handshakes *replayWindow
+
+	// lastExpiry is when expireItems() last discarded expired items
+	lastExpiry time.Time
+
+	// verifiedPeers holds the addresses of peers whose packets have
+	// been successfully decrypted, and when they last sent one. Peers
+	// idle for Config.ItemExpiry are removed by expireItems().
+	verifiedPeers map[string]time.Time
+
+	// replays holds the packets received recently, to detect replayed
+	// packets (see Config.ReplayWindow). Only the read loop uses it.
+	replays *replayWindow
+
+	// counters holds the statistics returned by Stats()
+	counters receiverCounters
+
+	// connMu protects 'conn', which Stop() and Rebind() can replace
+	// while Run() is reading, and 'runDone'. It is a value, not created
+	// by initRun(), since Stop() and Close() can be called at any time.
+	connMu sync.Mutex
+
+	// receiveMu serializes calls to Receive, which can come from Run() and
+	// from Senders in this process delivering data items directly to
+	// this Receiver. It is created by initRun().
+	receiveMu *sync.Mutex
+
+	// draining is set to 1 by Close(), to make the read loop stop once
+	// it has handled the packets that have already arrived
+	draining int32
+
+	// runDone is closed when RunContext() returns. It is created
+	// by initRun() and protected by 'connMu'.
+	runDone chan struct{}
+
+	// receivingMu protects 'receiving', which the read loop uses while
+	// ActiveTransfers() and CancelAll() can be called from other
+	// goroutines. It is created by initRun().
+	receivingMu *sync.Mutex
+
+	// selfTest runs the self-tests of Config.StrictCrypto once, even if
+	// Run() is called again after Stop(). It is created by initRun().
+	selfTest *cryptoSelfTest
 } //                                                                    Receiver
 
 // -----------------------------------------------------------------------------
 // # Public Methods
 
+// KeyFingerprint returns the fingerprint of Receiver.CryptoKey.
+// Compare it with Sender.KeyFingerprint() to check if both
+// ends are using the same key. See KeyFingerprint() for details.
+func (rc *Receiver) KeyFingerprint() string {
+	return KeyFingerprint(rc.CryptoKey)
+} //                                                              KeyFingerprint
+
+// Stats returns the statistics of the Receiver, such as the number
+// of packets received and data items delivered. It is safe to call
+// while the Receiver is running.
+func (rc *Receiver) Stats() ReceiverStats {
+	return rc.counters.snapshot()
+} //                                                                       Stats
+
 // Run runs the receiver in a loop to process incoming packets.
 //
 // It calls Receive when a data transfer is complete, after the
 // receiver has received, decrypted and re-assembled a data item.
 //
 func (rc *Receiver) Run() error {
+	return rc.RunContext(context.Background())
+} //                                                                         Run
+
+// RunContext runs the receiver like Run(), until Stop() is called or
+// 'ctx' is cancelled. On cancellation, the Receiver stops at once and
+// releases its UDP port, and RunContext returns ctx.Err().
+func (rc *Receiver) RunContext(ctx context.Context) error {
 	defer rc.Stop()
 	if rc.Config == nil {
 		rc.Config = NewDefaultConfig()
 	}
+	if err := ctx.Err(); err != nil {
+		return rc.logError(0xE312E0, err)
+	}
 	err := rc.initRun()
 	if err != nil {
 		return err
 	}
-	// receive transmissions
-	encReq := make([]byte, rc.Config.PacketSizeLimit)
-	for rc.conn != nil {
-		// 'encReq' is overwritten after every readAndDecrypt
-		recv, addr, err := readAndDecrypt(rc.conn, rc.Config.ReplyTimeout,
-			rc.Config.Cipher, encReq)
-		if err == errClosed {
-			break
-		}
-		if err != nil {
-			_ = rc.logError(0xEA288A, err)
-			continue
-		}
-		if rc.Config.VerboseReceiver {
-			rc.logInfo()
-			rc.logInfo(strings.Repeat("-", 80))
-			rc.logInfo("Receiver read", len(recv), "bytes from", addr)
-		}
-		reply, err := rc.buildReply(recv)
-		if len(reply) == 0 || err != nil {
-			continue
-		}
-		encReply, err := rc.Config.Cipher.Encrypt(reply)
-		if err != nil {
-			_ = rc.logError(0xE5C3E8, err)
-			continue
+	defer close(rc.runDone)
+	if ctx.Done() != nil {
+		stopped := make(chan struct{})
+		defer close(stopped)
+		go func() {
+			select {
+			case <-ctx.Done():
+				rc.Stop()
+			case <-stopped:
+			}
+		}()
+	}
+	withProfileLabels(ctx, rc.Config, func(context.Context) {
+		rc.receivePackets()
+	}, "udpt.op", "receive", "udpt.port", strconv.Itoa(rc.Port))
+	rc.receivingMu.Lock()
+	defer rc.receivingMu.Unlock()
+	for _, it := range rc.receiving {
+		if it.stream != nil {
+			it.stream.abort(makeError(0xE15FB7, "Receiver stopped"))
 		}
-		rc.sendReply(rc.conn, addr, encReply)
+		rc.flushPieces(it)
 	}
-	return nil
-} //                                                                         Run
+	return ctx.Err()
+} //                                                                  RunContext
 
-// Stop stops the Receiver from listening and
-// receiving data by closing its connection.
+// Stop stops the Receiver from listening and receiving data by closing
+// its connection at once. It doesn't wait for Run() to return: use
+// Close() to stop the Receiver gracefully.
 func (rc *Receiver) Stop() {
+	rc.connMu.Lock()
+	defer rc.connMu.Unlock()
 	if rc.conn == nil {
 		return
 	}
+	localReceivers.Unregister(rc)
 	err := rc.conn.Close()
 	if err != nil {
 		_ = rc.logError(0xE9C2D1, err)
@@ -178,9 +437,122 @@ func (rc *Receiver) Stop() {
 	rc.conn = nil
 } //                                                                        Stop
 
+// Close stops a running Receiver gracefully: it stops waiting for new
+// packets, handles the packets that have already arrived, then closes
+// its connection. The data items that are still incomplete are
+// discarded, and the writers returned by ReceiveStream for them are
+// closed with an error. Close returns once Run() has returned, so the
+// UDP port has been released and Receive is no longer called.
+//
+// Returns an error if the Receiver is not running.
+//
+func (rc *Receiver) Close() error {
+	rc.connMu.Lock()
+	conn, done := rc.conn, rc.runDone
+	rc.connMu.Unlock()
+	if conn == nil || done == nil {
+		return rc.logError(0xE0F813, "Receiver is not running")
+	}
+	atomic.StoreInt32(&rc.draining, 1)
+	// wake the read loop up, if it is waiting for a packet
+	err := conn.SetReadDeadline(time.Now().Add(drainTimeout))
+	if err != nil {
+		_ = rc.logError(0xE07553, err)
+		rc.Stop()
+	}
+	<-done
+	return nil
+} //                                                                       Close
+
+// Rebind makes a running Receiver listen on a new address, such as ":9877"
+// or "10.0.0.5:9877", for environments where ports are reassigned at
+// runtime. Receiver.Port is updated to the new port number.
+//
+// The new address is bound before the old connection is closed, so if
+// binding fails, the Receiver keeps listening where it was. Data items
+// being received are kept, so Senders can complete them at the new
+// address. Emits a Rebound event with the new local address.
+//
+func (rc *Receiver) Rebind(addr string) error {
+	if rc.currentConn() == nil {
+		return rc.logError(0xE65295, "Receiver is not running")
+	}
+	udpAddr, err := net.ResolveUDPAddr(rc.Config.network(), addr)
+	if err != nil {
+		return rc.logError(0xE385F8, err)
+	}
+	conn, err := rc.listen(net.ListenUDP, udpAddr)
+	if err != nil {
+		return rc.logError(0xE145A0, err)
+	}
+	laddr, _ := localAddr(conn).(*net.UDPAddr)
+	if laddr == nil {
+		_ = conn.Close()
+		return rc.logError(0xE2B8C7, "no local UDP address")
+	}
+	rc.connMu.Lock()
+	old := rc.conn
+	if old == nil {
+		rc.connMu.Unlock()
+		_ = conn.Close()
+		return rc.logError(0xED9321, "Receiver is not running")
+	}
+	localReceivers.Unregister(rc)
+	rc.conn = conn
+	rc.Port = laddr.Port
+	localReceivers.Register(rc)
+	rc.connMu.Unlock()
+	//
+	err = old.Close()
+	if err != nil {
+		_ = rc.logError(0xEB1B00, err)
+	}
+	if rc.Config.VerboseReceiver {
+		rc.logDebug("Receiver rebound to", laddr)
+	}
+	rc.emit(Rebound, laddr)
+	return nil
+} //                                                                      Rebind
+
 // -----------------------------------------------------------------------------
 // # Run() Internals
 
+// cipher returns Config.Cipher, bound to Receiver.AAD. If there
+// are PreviousKeys, returns a keyRing that also tries their ciphers.
+func (rc *Receiver) cipher() SymmetricCipher {
+	cphr, err := bindAAD(rc.Config.Cipher, rc.AAD)
+	if err != nil {
+		return rc.Config.Cipher // initRun() has already failed
+	}
+	if len(rc.previousCiphers) == 0 {
+		return cphr
+	}
+	ring := &keyRing{ciphers: []SymmetricCipher{cphr}}
+	for _, pc := range rc.previousCiphers {
+		bc, err := bindAAD(pc, rc.AAD)
+		if err != nil {
+			continue // can't happen: 'pc' has the type of Config.Cipher
+		}
+		ring.ciphers = append(ring.ciphers, bc)
+	}
+	return ring
+} //                                                                      cipher
+
+// currentConn returns the connection on which the Receiver is listening,
+// or nil if it has been stopped.
+func (rc *Receiver) currentConn() netUDPConn {
+	rc.connMu.Lock()
+	defer rc.connMu.Unlock()
+	return rc.conn
+} //                                                                 currentConn
+
+// setConn sets the connection on which the Receiver listens.
+func (rc *Receiver) setConn(conn netUDPConn) {
+	rc.connMu.Lock()
+	rc.conn = conn
+	rc.connMu.Unlock()
+} //                                                                     setConn
+
 // initRun checks if the receiver is properly configured
 // and starts listening on the configured UDP address.
 func (rc *Receiver) initRun() error {
@@ -197,35 +569,411 @@ func (rc *Receiver) initRunDI(
 	if err != nil {
 		return rc.logError(0xE14BC8, err)
 	}
-	if rc.Port < 1 || rc.Port > 65535 {
+	if rc.PacketConn == nil && (rc.Port < 1 || rc.Port > 65535) {
 		return rc.logError(0xE58B2F, "invalid Receiver.Port:", rc.Port)
 	}
-	err = rc.Config.Cipher.SetKey(rc.CryptoKey)
+	err = rc.validateGroup()
+	if err != nil {
+		return rc.logError(0xE2A7C6, err)
+	}
+	if len(rc.CryptoKey) > 0 || !rc.Config.KeyExchange {
+		err = rc.Config.Cipher.SetKey(rc.CryptoKey)
+		if err != nil {
+			return rc.logError(0xE8A5C6, "invalid Receiver.CryptoKey:", err)
+		}
+	}
+	if rc.selfTest == nil {
+		rc.selfTest = &cryptoSelfTest{}
+	}
+	err = checkStrictCrypto(rc.Config, rc.selfTest)
+	if err != nil {
+		return rc.logError(0xE81AB6, err)
+	}
+	keys := []auditedKey{
+		{"Receiver.CryptoKey", rc.CryptoKey},
+		{"Receiver.EndToEndKey", rc.EndToEndKey},
+	}
+	for _, k := range rc.PreviousKeys {
+		keys = append(keys, auditedKey{"Receiver.PreviousKeys key", k})
+	}
+	err = rc.Config.auditKeys(rc.logError, keys...)
 	if err != nil {
-		return rc.logError(0xE8A5C6, "invalid Receiver.CryptoKey:", err)
+		return rc.logError(0xE2D8F4, err)
 	}
-	if rc.Receive == nil {
+	err = applyRandomSource(rc.Config)
+	if err != nil {
+		return rc.logError(0xEFFFEA, err)
+	}
+	_, err = bindAAD(rc.Config.Cipher, rc.AAD)
+	if err != nil {
+		return rc.logError(0xECADEE, "invalid Receiver.AAD:", err)
+	}
+	rc.previousCiphers, err = newKeyCiphers(rc.Config.Cipher, rc.PreviousKeys)
+	if err != nil {
+		return rc.logError(0xE57E75, "invalid Receiver.PreviousKeys:", err)
+	}
+	err = rc.validateAuthTokens()
+	if err != nil {
+		return rc.logError(0xE3A7E4, "invalid Receiver.AuthTokens:", err)
+	}
+	if rc.handler() == nil && rc.ReceiveStream == nil && rc.Archive == nil {
 		return rc.logError(0xE82C9E, "nil Receiver.Receive")
 	}
-	udpAddr, err := netResolveUDPAddr("udp",
-		fmt.Sprintf("0.0.0.0:%d", rc.Port))
+	if len(rc.EndToEndKey) > 0 &&
+		(rc.ReceiveStream != nil || rc.Archive != nil) {
+		return rc.logError(0xE7C0A5,
+			"Receiver.EndToEndKey requires Receive or Handler")
+	}
+	err = rc.validateTransforms()
+	if err != nil {
+		return rc.logError(0xE1B6C4, err)
+	}
+	rc.verifiedPeers = make(map[string]time.Time)
+	rc.replays = newReplayWindow(rc.Config.ReplayWindow, rc.Config.MaxClockSkew)
+	rc.buffers = newBufferPool(rc.Config.PacketSizeLimit)
+	rc.sessions = nil
+	rc.receiving = make(map[string]*receivingItem)
+	rc.counters = receiverCounters{}
+	rc.receiveMu = &sync.Mutex{}
+	rc.receivingMu = &sync.Mutex{}
+	rc.connMu.Lock()
+	rc.runDone = make(chan struct{})
+	rc.connMu.Unlock()
+	atomic.StoreInt32(&rc.draining, 0)
+	if rc.PacketConn != nil {
+		if laddr, ok := rc.PacketConn.LocalAddr().(*net.UDPAddr); ok {
+			rc.Port = laddr.Port
+		}
+		rc.setConn(rc.receiverConn())
+		return rc.initRunDone()
+	}
+	// listen on all the addresses of Config.Network: leaving the host
+	// blank makes "udp" sockets dual-stack, unlike "0.0.0.0"
+	udpAddr, err := netResolveUDPAddr(rc.Config.network(),
+		fmt.Sprintf(":%d", rc.Port))
 	if err != nil {
 		return rc.logError(0xE1D68C, err)
 	}
 	if rc.Config.VerboseReceiver {
-		rc.logInfo(strings.Repeat("-", 80))
-		rc.logInfo("Receiver listening...")
+		rc.logDebug(strings.Repeat("-", 80))
+		rc.logDebug("Receiver listening... crypto key:", rc.KeyFingerprint())
 	}
-	rc.conn, err = netListenUDP("udp", udpAddr)
+	var conn netUDPConn
+	port, err := bindPort(rc.Config, rc.Port, func(port int) error {
+		addr := udpAddr
+		if port != rc.Port {
+			addr = &net.UDPAddr{IP: udpAddr.IP, Port: port, Zone: udpAddr.Zone}
+		}
+		var err error
+		conn, err = rc.listen(netListenUDP, addr)
+		return err
+	})
 	if err != nil {
-		rc.conn = nil // avoid non-nil interface with nil concrete value
+		rc.setConn(nil) // avoid non-nil interface with nil concrete value
 		return rc.logError(0xEBF95F, err)
 	}
-	return nil
+	if port != rc.Port {
+		rc.logInfo("Receiver port", rc.Port, "in use, listening on", port)
+		rc.Port = port
+	}
+	rc.setConn(conn)
+	return rc.initRunDone()
 } //                                                                   initRunDI
 
-// buildReply builds a reply to the received data. Presently, the only packet
-// type received is a fragment (FRAG), replied with confirmation (CONF) packet.
+// initRunDone completes initRunDI() once the Receiver's connection is
+// set: it prepares Config.ResumeDir and registers the Receiver.
+func (rc *Receiver) initRunDone() error {
+	if dir := rc.Config.ResumeDir; dir != "" {
+		err := os.MkdirAll(dir, 0700)
+		if err == nil {
+			err = removeStaleResumeFiles(dir, time.Now().Add(-resumeFileExpiry))
+		}
+		if err != nil {
+			_ = rc.logError(0xE9F2C3, "Config.ResumeDir:", err)
+		}
+	}
+	localReceivers.Register(rc)
+	return nil
+} //                                                                 initRunDone
+
+// listen returns a connection listening at 'laddr', which has joined
+// Receiver.Group if specified, or is made by Config.Transport if
+// specified, otherwise by 'netListenUDP'.
+func (rc *Receiver) listen(
+	netListenUDP func(network string, laddr *net.UDPAddr) (*net.UDPConn, error),
+	laddr *net.UDPAddr,
+) (netUDPConn, error) {
+	if rc.Group != "" {
+		return rc.listenGroup(laddr)
+	}
+	if tr := rc.Config.Transport; tr != nil {
+		return listenTransport(tr, rc.Config.network(), laddr)
+	}
+	conn, err := netListenUDP(rc.Config.network(), laddr)
+	if err != nil {
+		return nil, err // not a non-nil interface with a nil *net.UDPConn
+	}
+	return watchOverflows(conn, &rc.counters.packetsDropped), nil
+} //                                                                      listen
+
+// receivePackets reads, decrypts and handles incoming packets, until
+// the Receiver is stopped. See Configuration.PinReceiveLoop.
+func (rc *Receiver) receivePackets() {
+	encReq := newReadBuffer(rc.Config.PacketSizeLimit)
+	cphr := rc.cipher()
+	var pinnedConn netUDPConn
+	if rc.Config.PinReceiveLoop {
+		unpin, err := pinThread(rc.Config.ReceiveLoopCPU)
+		if err != nil {
+			_ = rc.logError(0xECF1B0, "can't pin receive loop:", err)
+		} else {
+			defer unpin()
+		}
+	}
+	for {
+		conn := rc.currentConn()
+		if conn == nil {
+			break
+		}
+		if rc.Config.PinReceiveLoop && conn != pinnedConn {
+			pinnedConn = conn // set again after Rebind()
+			err := setIncomingCPU(conn, rc.Config.ReceiveLoopCPU)
+			if err != nil {
+				_ = rc.logError(0xED4195, "can't set SO_INCOMING_CPU:", err)
+			}
+		}
+		rc.expireItems(time.Now())
+		rc.sendNacks(conn, cphr)
+		// 'encReq' is overwritten after every readDatagram
+		data, addr, err := readDatagram(conn, rc.readTimeout(),
+			encReq, rc.Config.PacketSizeLimit)
+		if err == errClosed {
+			if rc.currentConn() != conn {
+				continue // closed by Stop(), or replaced by Rebind()
+			}
+			break // closed by something else: don't spin on it
+		}
+		if err == errOversized {
+			atomic.AddInt64(&rc.counters.packetsOversized, 1)
+			_ = rc.logError(0xE9F58D, err, "from", addr)
+			rc.emit(OversizedPacket, addr)
+			continue
+		}
+		if err == nil && !rc.Config.senderAllowed(addr) {
+			atomic.AddInt64(&rc.counters.packetsDenied, 1)
+			if rc.Config.VerboseReceiver {
+				rc.logDebug("Denied packet from", addr)
+			}
+			continue
+		}
+		if err == nil && rc.Config.KeyExchange &&
+			bytes.HasPrefix(data, []byte(tagHandshake)) {
+			err = rc.acceptHandshake(conn, addr, data)
+			if err != nil {
+				_ = rc.logError(0xE01D60, err)
+			}
+			continue
+		}
+		var recv []byte
+		buf := rc.buffers.get()
+		if err == nil {
+			recv, rc.packetCipher, err = rc.decryptPacket(addr, data, *buf, cphr)
+			if err != nil {
+				atomic.AddInt64(&rc.counters.decryptFailures, 1)
+			}
+		}
+		if err != nil {
+			rc.buffers.put(buf)
+		}
+		if err == errTimeout && atomic.LoadInt32(&rc.draining) != 0 {
+			rc.Stop() // Close() has been called, and no packets are left
+			continue
+		}
+		if err != nil {
+			if err != errTimeout {
+				atomic.AddInt64(&rc.counters.packetsRejected, 1)
+			}
+			_ = rc.logError(0xEA288A, err)
+			continue
+		}
+		var sn *sequenceNumber
+		recv, sn, err = readSequence(recv)
+		if err != nil {
+			atomic.AddInt64(&rc.counters.packetsRejected, 1)
+			_ = rc.logError(0xE3D4F7, err, "from", addr)
+			rc.buffers.put(buf)
+			continue
+		}
+		if rc.replays.replayed(data, sn, time.Now()) {
+			atomic.AddInt64(&rc.counters.packetsRejected, 1)
+			_ = rc.logError(0xE8C3F0, "replayed packet from", addr)
+			rc.emit(ReplayedPacket, addr)
+			rc.buffers.put(buf)
+			continue
+		}
+		atomic.AddInt64(&rc.counters.packetsReceived, 1)
+		atomic.AddInt64(&rc.counters.bytesReceived, int64(len(data)))
+		if !rc.verifyPeer(addr) {
+			rc.buffers.put(buf)
+			continue
+		}
+		if rc.Config.VerboseReceiver {
+			rc.logDebug()
+			rc.logDebug(strings.Repeat("-", 80))
+			rc.logDebug("Receiver read", len(recv), "bytes from", addr)
+		}
+		rc.packetAddr = addr
+		rc.packetBuf = buf
+		reply, err := rc.buildReply(recv)
+		rc.packetBuf = nil // unless claimed, left to the garbage collector
+		if len(reply) == 0 || err != nil {
+			continue
+		}
+		encReply, err := rc.packetCipher.Encrypt(reply)
+		if err != nil {
+			_ = rc.logError(0xE5C3E8, err)
+			continue
+		}
+		rc.sendReply(conn, addr, encReply)
+	}
+} //                                                              receivePackets
+
+// readTimeout returns how long the read loop should wait for a packet:
+// Config.ReplyTimeout, or less if a NACK will be due before that.
+func (rc *Receiver) readTimeout() time.Duration {
+	if atomic.LoadInt32(&rc.draining) != 0 {
+		return drainTimeout
+	}
+	timeout := rc.Config.ReplyTimeout
+	if rc.Config.NackDelay <= 0 {
+		return timeout
+	}
+	if rc.receivingMu != nil {
+		rc.receivingMu.Lock()
+		defer rc.receivingMu.Unlock()
+	}
+	for _, it := range rc.receiving {
+		ns := &it.nack
+		if ns.count == 0 || ns.addr == nil || ns.sent >= nackRepeatLimit {
+			continue
+		}
+		due := time.Until(ns.last.Add(
+			rc.Config.NackDelay * time.Duration(ns.sent+1)))
+		if due < time.Millisecond {
+			due = time.Millisecond
+		}
+		if due < timeout {
+			timeout = due
+		}
+	}
+	return timeout
+} //                                                                 readTimeout
+
+// sendNacks sends NACKs listing the missing pieces of the data items
+// whose fragments have stopped arriving for Config.NackDelay, to their
+// Senders. A NACK is repeated after each further NackDelay without
+// fragments, up to nackRepeatLimit times.
+func (rc *Receiver) sendNacks(conn netUDPConn, cphr SymmetricCipher) {
+	if rc.Config.NackDelay <= 0 {
+		return
+	}
+	if rc.receivingMu != nil {
+		rc.receivingMu.Lock()
+		defer rc.receivingMu.Unlock()
+	}
+	for _, it := range rc.receiving {
+		ns := &it.nack
+		if ns.count == 0 || ns.addr == nil || ns.sent >= nackRepeatLimit ||
+			time.Since(ns.last) <
+				rc.Config.NackDelay*time.Duration(ns.sent+1) {
+			continue
+		}
+		missing := it.missingPieces()
+		if missing == nil {
+			ns.count = 0 // the item is complete, or has failed
+			continue
+		}
+		ns.sent++
+		maxBits := 8 * (rc.Config.PacketSizeLimit - rc.Config.headerReserve())
+		packet := makeNack(ns.key, ns.hash, missing, maxBits,
+			ns.caps.Has(CapNackRuns))
+		if packet == nil {
+			continue
+		}
+		nackCipher := cphr
+		if ns.cipher != nil {
+			nackCipher = ns.cipher
+		}
+		encPacket, err := nackCipher.Encrypt(packet)
+		if err != nil {
+			_ = rc.logError(0xEF0CA5, err)
+			continue
+		}
+		if rc.Config.VerboseReceiver {
+			rc.logDebug("Receiver sending NACK for", ns.key, "to", ns.addr)
+		}
+		rc.sendReply(conn, ns.addr, encPacket)
+	}
+} //                                                                   sendNacks
+
+// expireItems discards the data items whose fragments stopped arriving
+// more than Config.ItemExpiry before 'now', including delivered items
+// kept to confirm packets sent again. It runs at most once a second.
+func (rc *Receiver) expireItems(now time.Time) {
+	if now.Sub(rc.lastExpiry) < time.Second {
+		return
+	}
+	rc.lastExpiry = now
+	expiry := rc.Config.ItemExpiry
+	if expiry == 0 {
+		expiry = defaultItemExpiry
+	}
+	if rc.receivingMu != nil {
+		rc.receivingMu.Lock()
+		defer rc.receivingMu.Unlock()
+	}
+	for id, it := range rc.receiving {
+		if now.Sub(it.nack.last) <= expiry {
+			continue
+		}
+		if it.stream != nil {
+			it.stream.abort(makeError(0xEDC424, "data item expired"))
+		}
+		if !it.done {
+			atomic.AddInt64(&rc.counters.itemsExpired, 1)
+			if rc.Config.VerboseReceiver {
+				rc.logDebug("Receiver discarded incomplete item", it.nack.key)
+			}
+		}
+		rc.flushPieces(it)
+		rc.releasePacketBuffers(it)
+		delete(rc.receiving, id)
+	}
+	for id, list := range rc.sessions {
+		n := 0
+		for _, ss := range list {
+			if now.Sub(ss.last) <= expiry {
+				list[n] = ss
+				n++
+			}
+		}
+		if n == 0 {
+			delete(rc.sessions, id)
+			continue
+		}
+		rc.sessions[id] = list[:n]
+	}
+	for k, last := range rc.verifiedPeers {
+		if now.Sub(last) > expiry {
+			delete(rc.verifiedPeers, k)
+		}
+	}
+} //                                                                 expireItems
+
+// buildReply builds a reply to the received data. A fragment (FRAG) is
+// replied with a confirmation (CONF) packet, and a probe (PING) sent
+// by Diagnose() is replied with a probe reply (PONG) packet.
+// Keepalives (KEEP) get no reply.
 func (rc *Receiver) buildReply(recv []byte) (reply []byte, err error) {
 	switch {
 	case len(recv) == 0:
@@ -234,6 +982,13 @@ func (rc *Receiver) buildReply(recv []byte) (reply []byte, err error) {
 	case bytes.HasPrefix(recv, []byte(tagFragment)):
 		reply, err = rc.receiveFragment(recv)
 		//
+	case bytes.HasPrefix(recv, []byte(tagProbe)):
+		reply = makeProbeReply(recv, time.Now())
+		//
+	case bytes.HasPrefix(recv, []byte(tagKeepalive)):
+		if rc.Config.VerboseReceiver {
+			rc.logDebug("Receiver got a keepalive")
+		}
 	default:
 		reply = []byte("invalid_packet_header")
 		err = rc.logError(0xE985CC, "invalid packet header")
@@ -255,10 +1010,61 @@ func (rc *Receiver) sendReply(conn netUDPConn, addr net.Addr, reply []byte) {
 		return
 	}
 	if rc.Config.VerboseReceiver {
-		rc.logInfo("Receiver wrote", nWrit, "bytes to", addr)
+		rc.logDebug("Receiver wrote", nWrit, "bytes to", addr)
 	}
 } //                                                                   sendReply
 
+// verifyPeer is called after a packet from 'addr' has been decrypted.
+//
+// The first time this happens for an address, it emits a PeerVerified
+// event and calls the OnPeerVerified hook. Returns false if the hook
+// failed, in which case the packet should be dropped. It remembers up
+// to maxVerifiedPeers addresses, forgetting the longest idle first.
+//
+func (rc *Receiver) verifyPeer(addr net.Addr) bool {
+	if addr == nil {
+		return true
+	}
+	k := addr.String()
+	now := time.Now()
+	if _, ok := rc.verifiedPeers[k]; ok {
+		rc.verifiedPeers[k] = now
+		return true
+	}
+	if rc.OnPeerVerified != nil {
+		err := rc.OnPeerVerified(addr)
+		if err != nil {
+			_ = rc.logError(0xEB7D74, "OnPeerVerified:", err)
+			return false
+		}
+	}
+	if rc.verifiedPeers == nil {
+		rc.verifiedPeers = make(map[string]time.Time)
+	}
+	if len(rc.verifiedPeers) >= maxVerifiedPeers {
+		forgetOldest(rc.verifiedPeers)
+	}
+	rc.verifiedPeers[k] = now
+	if rc.Config.VerboseReceiver {
+		rc.logDebug("Verified peer", k)
+	}
+	rc.emit(PeerVerified, addr)
+	return true
+} //                                                                  verifyPeer
+
+// forgetOldest removes the address that was seen longest ago from
+// 'seen', which maps addresses to when they were last seen.
+func forgetOldest(seen map[string]time.Time) {
+	var oldest string
+	var t0 time.Time
+	for k, t := range seen {
+		if t0.IsZero() || t.Before(t0) {
+			oldest, t0 = k, t
+		}
+	}
+	delete(seen, oldest)
+} //                                                                forgetOldest
+
 // -----------------------------------------------------------------------------
 // # Packet Handlers
 
@@ -267,8 +1073,22 @@ type fragmentHeader struct {
 	dataOffset  int    // position of compressed data (part of the value)
 	key         string // key 'k' of the key-value message
 	hash        []byte // hash of entire key-value message
+	compHash    []byte // hash of the compressed value, or nil if not sent
 	index       int    // 0-based index of this fragment
 	packetCount int    // total number of fragments (i.e. packets) in message
+	subIndex    int    // 0-based index of the sub-piece, if it is one
+	subCount    int    // number of sub-pieces of the piece, or 0 if whole
+	resume      bool   // the Sender resumes items (Config.ResumeTransfers)
+	chunked     bool   // the value is compressed in chunks
+	hasSum      bool   // the Sender sent the checksum of the piece in 'sum'
+	sum         uint32
+	hasCaps     bool   // the Sender advertised its capabilities in 'caps'
+	caps        Capabilities
+	vroot       []byte // hash of the first verified block, or nil if none
+	vblock      int    // size of verified blocks
+	vindex      int    // 0-based index of the block in which the piece ends
+	vnext       []byte // hash of the block after it, or nil if it's last
+	senderID    string // see Receiver.AuthTokens
 }
 
 // readFragmentHeader reads the header from a received fragment packet
@@ -291,6 +1111,14 @@ func (rc *Receiver) readFragmentHeader(recv []byte) (*fragmentHeader, error) {
 	if err != nil || len(h.hash) != 32 {
 		return nil, rc.logError(0xEB6CB7, "bad hash")
 	}
+	if comp := getPart(s, " comp:", " "); comp != "" {
+		h.compHash, err = hex.DecodeString(comp)
+		if err != nil || len(h.compHash) != 32 {
+			return nil, rc.logError(0xEF64D0, "bad compressed data hash")
+		}
+	} else if rc.Config.HashCompressed {
+		return nil, rc.logError(0xE2F0B7, "missing compressed data hash")
+	}
 	h.packetCount, _ = strconv.Atoi(getPart(s, "count:", "\n"))
 	if h.packetCount < 1 {
 		return nil, rc.logError(0xE18A95, "bad 'count'")
@@ -300,52 +1128,473 @@ func (rc *Receiver) readFragmentHeader(recv []byte) (*fragmentHeader, error) {
 		return nil, rc.logError(0xEF27F8, "bad 'sn'")
 	}
 	h.index--
+	if sub := getPart(s, " sub:", " "); sub != "" {
+		index, count, _ := strings.Cut(sub, "/")
+		h.subIndex, _ = strconv.Atoi(index)
+		h.subCount, _ = strconv.Atoi(count)
+		if h.subCount < 1 || h.subIndex < 1 || h.subIndex > h.subCount {
+			return nil, rc.logError(0xE25D87, "bad 'sub'")
+		}
+		h.subIndex--
+	}
+	if sum := getPart(s, " "+pieceSumField, " "); sum != "" {
+		n, err := strconv.ParseUint(sum, 16, 32)
+		if err != nil {
+			return nil, rc.logError(0xE7C2D4, "bad piece checksum")
+		}
+		h.sum, h.hasSum = uint32(n), true
+	}
+	err = readBlockFields(s, &h)
+	if err != nil {
+		return nil, rc.logError(0xE7E2A8, err)
+	}
+	h.resume = strings.Contains(s, " "+resumeFieldTag)
+	h.chunked = strings.Contains(s, " "+chunkedFieldTag)
+	if caps := getPart(s, " "+capabilitiesField, " "); caps != "" {
+		h.caps, err = parseCapabilities(caps)
+		if err != nil {
+			return nil, rc.logError(0xE0C7A9, err)
+		}
+		h.hasCaps = true
+	}
 	return &h, nil
 } //                                                          readFragmentHeader
 
 // receiveFragment handles a tagFragment packet sent by a Sender, and
 // sends back a confirmation packet (tagConfirmation) to the Sender.
-func (rc *Receiver) receiveFragment(recv []byte) ([]byte, error) {
+func (rc *Receiver) receiveFragment(recv []byte) (reply []byte, err error) {
+	senderID, err := rc.authorize(recv)
+	if err != nil {
+		atomic.AddInt64(&rc.counters.packetsRejected, 1)
+		rc.emit(Unauthorized, rc.packetAddr)
+		return nil, rc.logError(0xE0E8C3, err)
+	}
 	h, err := rc.readFragmentHeader(recv)
 	if err != nil {
 		return nil, err
 	}
-	it := &rc.receivingDataItem
-	it.Retain(h.key, h.hash, h.packetCount)
+	h.senderID = senderID
+	if rc.receivingMu != nil {
+		rc.receivingMu.Lock()
+		defer rc.receivingMu.Unlock()
+	}
+	it := rc.receivingItemFor(h)
+	if it.cancelled != nil {
+		return nil, rc.logError(0xE467F6, it.cancelled)
+	}
+	if h.hasSum && pieceSum(recv[h.dataOffset:]) != h.sum {
+		atomic.AddInt64(&rc.counters.piecesCorrupted, 1)
+		_ = rc.logError(0xE3B4C8, "corrupted piece", h.index+1, "of", h.key)
+		return rc.corruptPieceReply(it), nil
+	}
+	withProfileLabels(context.Background(), rc.Config,
+		func(context.Context) {
+			switch {
+			case h.subCount > 0:
+				reply, err = rc.receiveSubPiece(it, h, recv)
+			case rc.streaming():
+				reply, err = rc.receiveStreamFragment(it, h, recv)
+			default:
+				reply, err = rc.storeFragment(it, h, recv)
+			}
+		}, "udpt.op", "receive", "udpt.key", h.key,
+		"udpt.port", strconv.Itoa(rc.Port))
+	if err == nil && reply != nil && h.hasCaps {
+		reply = markConfirmationCaps(reply, rc.capabilities())
+	}
+	if err == nil && reply != nil && h.resume && it.delivered {
+		reply = markConfirmationDone(reply)
+	}
+	if err == nil && reply != nil && it.reply != nil &&
+		h.caps.Has(CapReplies) {
+		reply = markConfirmationReply(reply, it.reply)
+	}
+	return reply, err
+} //                                                             receiveFragment
+
+// receivingItemFor returns the data item to which the fragment with
+// header 'h' belongs, adding it to rc.receiving if it is new.
+func (rc *Receiver) receivingItemFor(h *fragmentHeader) *receivingItem {
+	id := receivingItemID(h.key, h.hash)
+	it := rc.receiving[id]
+	if it == nil {
+		if rc.receiving == nil {
+			rc.receiving = make(map[string]*receivingItem)
+		}
+		it = &receivingItem{started: time.Now(), senderID: h.senderID}
+		rc.receiving[id] = it
+		if rc.Config.ResumeDir != "" && !rc.streaming() {
+			rc.restorePieces(it, h)
+		}
+	}
+	if it.done {
+		it.nack.last = time.Now() // keep it while packets are sent again
+	} else {
+		it.nack.note(h)
+		it.nack.addr = rc.packetAddr
+		it.nack.cipher = rc.packetCipher
+	}
+	return it
+} //                                                            receivingItemFor
+
+// receiveSubPiece handles a fragment that carries part of a piece (see
+// Configuration.SubPieceSize) and confirms it. Once all parts of the
+// piece have arrived, the piece is handled like a whole fragment.
+func (rc *Receiver) receiveSubPiece(it *receivingItem, h *fragmentHeader,
+	recv []byte,
+) ([]byte, error) {
+	rc.packetBuf = nil // sub-pieces are kept in the packet's memory
+	if !it.done {
+		piece := it.putSubPiece(h, recv[h.dataOffset:])
+		if piece != nil {
+			whole := append(append([]byte{}, recv[:h.dataOffset]...), piece...)
+			var err error
+			if rc.streaming() {
+				_, err = rc.receiveStreamFragment(it, h, whole)
+			} else {
+				_, err = rc.storeFragment(it, h, whole)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	reply := makeConfirmation(getHash(recv),
+		rc.Config.MaxReceiveBytesPerSecond)
+	return reply, nil
+} //                                                             receiveSubPiece
+
+// storeFragment stores the fragment with header 'h' in data item 'it',
+// and passes the item to Receive once it's complete.
+func (rc *Receiver) storeFragment(it *receivingItem, h *fragmentHeader,
+	recv []byte,
+) ([]byte, error) {
+	reply := makeConfirmation(getHash(recv),
+		rc.Config.MaxReceiveBytesPerSecond)
+	if it.done {
+		rc.recyclePacketBuffer()
+		return reply, nil // already delivered, but the Sender sent it again
+	}
+	di := &it.dataItem
+	di.Retain(h.key, h.hash, h.packetCount)
+	if di.CompHash == nil {
+		di.CompHash = h.compHash
+	} else if !bytes.Equal(h.compHash, di.CompHash) {
+		return nil, rc.logError(0xE5E6F2, "compressed data hash changed")
+	}
+	di.Chunked = h.chunked
+	di.hasher = rc.Config.Hasher
 	compressedData := recv[h.dataOffset:]
 	if len(compressedData) < 1 {
 		return nil, rc.logError(0xE92B0F, "received no data")
 	}
 	// store the current piece
-	if len(it.CompressedPieces[h.index]) == 0 {
-		it.CompressedPieces[h.index] = compressedData
-	} else if !bytes.Equal(compressedData, it.CompressedPieces[h.index]) {
+	if len(di.CompressedPieces[h.index]) == 0 {
+		di.CompressedPieces[h.index] = compressedData
+		rc.claimPacketBuffer(it, compressedData)
+		rc.keepPiece(it, h, compressedData)
+		if onProgress := rc.Config.OnProgress; onProgress != nil {
+			received, total := di.progress()
+			onProgress(di.Key, received, total)
+		}
+	} else if !bytes.Equal(compressedData, di.CompressedPieces[h.index]) {
 		return nil, rc.logError(0xE1A99A, "unknown packet alteration")
+	} else {
+		rc.recyclePacketBuffer() // the piece was already stored
 	}
-	if it.IsLoaded() {
-		if rc.Receive == nil {
+	if di.IsLoaded() {
+		if rc.handler() == nil && rc.Archive == nil {
 			return nil, rc.logError(0xE49E2A, "nil Receiver.Receive")
 		}
-		data, err := it.UnpackBytes(rc.Config.Compressor)
+		var data []byte
+		var err error
+		if rc.Archive != nil {
+			data, err = di.joinPieces() // the Archive hook gets them as-is
+		} else {
+			data, err = di.UnpackBytes(rc.Config.Compressor,
+				compressionWorkers(rc.Config, len(di.CompressedPieces)))
+		}
 		if err != nil {
+			rc.dropPieces(it, di.Key, di.Hash) // e.g. a damaged kept piece
 			return nil, rc.logError(0xE3DB1D, err)
 		}
-		err = rc.Receive(it.Key, data)
+		info := &ItemInfo{
+			Key:        di.Key,
+			Hash:       di.Hash,
+			TransferID: itemTransferID(di.Key, di.Hash),
+			SenderID:   it.senderID,
+			Addr:       it.nack.addr,
+			Started:    it.started,
+			Finished:   time.Now(),
+			Pieces:     len(di.CompressedPieces),
+		}
+		for _, piece := range di.CompressedPieces {
+			info.CompressedSize += int64(len(piece))
+		}
+		err = rc.callReceive(info, data)
 		if err != nil {
 			return nil, rc.logError(0xE77B4D, err)
 		}
-		rc.logInfo("received:", it.Key)
+		it.reply = rc.itemReply(info)
+		atomic.AddInt64(&rc.counters.bytesCompressed, info.CompressedSize)
+		rc.logInfo("received:", di.Key)
 		if rc.Config.VerboseReceiver {
 			var sb strings.Builder
-			it.LogStats("receiveFragment", &sb)
-			rc.logInfo(sb.String())
+			di.LogStats("receiveFragment", &sb)
+			rc.logDebug(sb.String())
 		}
-		it.Reset()
+		rc.dropPieces(it, di.Key, di.Hash)
+		di.Reset()
+		rc.releasePacketBuffers(it)
+		it.done = true
+		it.delivered = true
 	}
-	confirmedHash := getHash(recv)
-	reply := append([]byte(tagConfirmation), confirmedHash...)
 	return reply, nil
-} //                                                             receiveFragment
+} //                                                               storeFragment
+
+// receiveStreamFragment handles a fragment when Receiver.ReceiveStream
+// is specified, by writing it to the itemStream of data item 'it', which
+// is created when the first fragment of the item arrives.
+func (rc *Receiver) receiveStreamFragment(it *receivingItem,
+	h *fragmentHeader, recv []byte,
+) ([]byte, error) {
+	st := it.stream
+	if st == nil {
+		w, err := rc.ReceiveStream(h.key)
+		if err != nil {
+			atomic.AddInt64(&rc.counters.receiveErrors, 1)
+			return nil, rc.logError(0xEDF957, "ReceiveStream:", err)
+		}
+		st = newItemStream(h, w, rc.Config.Compressor,
+			rc.Config.Hasher)
+		it.stream = st
+	}
+	if st.err != nil {
+		return nil, rc.logError(0xEB8E0F, st.err)
+	}
+	if !bytes.Equal(h.compHash, st.compHash) {
+		return nil, rc.logError(0xE55A79, "compressed data hash changed")
+	}
+	if (st.blocks == nil) != (h.vroot == nil) {
+		return nil, rc.logError(0xE0B5D9, "verified blocks changed")
+	}
+	if st.blocks != nil {
+		if err := st.blocks.learn(h); err != nil {
+			return nil, rc.logError(0xE6D2F8, err)
+		}
+	}
+	compressedData := recv[h.dataOffset:]
+	if len(compressedData) < 1 {
+		return nil, rc.logError(0xEA37CC, "received no data")
+	}
+	if !st.finished {
+		before := st.written
+		// pieces joined from sub-pieces are never deferred,
+		// since their sub-pieces have been confirmed already
+		limit := int64(rc.Config.StreamReorder.MaxBytes)
+		if h.subCount > 0 {
+			limit = 0
+		}
+		err := st.putWithin(h.index, h.packetCount, compressedData, limit)
+		if err == errReorderFull {
+			return rc.reorderReply(it), nil
+		}
+		if err != nil {
+			st.abort(err)
+			it.done = true
+			atomic.AddInt64(&rc.counters.receiveErrors, 1)
+			return nil, rc.logError(0xEE1C2A, err)
+		}
+		onProgress := rc.Config.OnProgress
+		if onProgress != nil && st.written != before {
+			written, total := st.progress(h.packetCount)
+			onProgress(st.key, written, total)
+		}
+		if st.complete() {
+			err = st.finish()
+			it.done = true
+			if err != nil {
+				atomic.AddInt64(&rc.counters.receiveErrors, 1)
+				return nil, rc.logError(0xEE8E77, err)
+			}
+			it.delivered = true
+			atomic.AddInt64(&rc.counters.itemsDelivered, 1)
+			atomic.AddInt64(&rc.counters.bytesDelivered, st.size)
+			atomic.AddInt64(&rc.counters.bytesCompressed, st.written)
+			rc.logInfo("received:", st.key)
+		}
+	}
+	reply := makeConfirmation(getHash(recv),
+		rc.Config.MaxReceiveBytesPerSecond)
+	return reply, nil
+} //                                                       receiveStreamFragment
+
+// receiveLocal receives a data item delivered directly by a Sender in
+// this process, bypassing the network. See Configuration.LoopbackShortcut.
+// 'senderID' is the Sender's SenderID, which the Sender has checked.
+// Returns the reply that the Handler made to the item, if any.
+func (rc *Receiver) receiveLocal(k string, v []byte, senderID string,
+) ([]byte, error) {
+	if rc.streaming() {
+		return nil, rc.receiveLocalStream(k, v)
+	}
+	if rc.handler() == nil && rc.Archive == nil {
+		return nil, rc.logError(0xEC6660, "nil Receiver.Receive")
+	}
+	now := time.Now()
+	info := &ItemInfo{Key: k, Started: now, Finished: now, Pieces: 1,
+		CompressedSize: int64(len(v))}
+	if len(rc.AuthTokens) > 0 {
+		info.SenderID = senderID
+	}
+	if rc.Handler != nil || rc.Archive != nil {
+		info.Hash = rc.Config.hash(v)
+		info.TransferID = itemTransferID(k, info.Hash)
+	}
+	// pass a copy, as Receive may keep 'v' while the Sender reuses it
+	data := append([]byte(nil), v...)
+	if rc.Archive != nil {
+		var compressor Compression = &zlibCompressor{}
+		if rc.Config != nil && rc.Config.Compressor != nil {
+			compressor = rc.Config.Compressor
+		}
+		comp, err := compressor.Compress(v)
+		if err != nil {
+			return nil, rc.logError(0xE6D1B9, err)
+		}
+		data = append([]byte(nil), comp...)
+		info.CompressedSize = int64(len(data))
+	}
+	err := rc.callReceive(info, data)
+	if err != nil {
+		return nil, rc.logError(0xE05536, err)
+	}
+	atomic.AddInt64(&rc.counters.bytesCompressed, int64(len(v)))
+	rc.logInfo("received:", k, "(local)")
+	return rc.itemReply(info), nil
+} //                                                                receiveLocal
+
+// receiveLocalStream writes a data item delivered directly by a
+// Sender in this process to a writer returned by ReceiveStream.
+func (rc *Receiver) receiveLocalStream(k string, v []byte) error {
+	w, err := rc.ReceiveStream(k)
+	if err != nil {
+		atomic.AddInt64(&rc.counters.receiveErrors, 1)
+		return rc.logError(0xEBE86A, "ReceiveStream:", err)
+	}
+	_, err = w.Write(v)
+	if err != nil {
+		err = makeError(0xEE977E, err)
+	}
+	err = closeStreamWriter(w, err)
+	if err != nil {
+		atomic.AddInt64(&rc.counters.receiveErrors, 1)
+		return rc.logError(0xE25EBC, err)
+	}
+	atomic.AddInt64(&rc.counters.itemsDelivered, 1)
+	atomic.AddInt64(&rc.counters.bytesDelivered, int64(len(v)))
+	atomic.AddInt64(&rc.counters.bytesCompressed, int64(len(v)))
+	rc.logInfo("received:", k, "(local)")
+	return nil
+} //                                                          receiveLocalStream
+
+// callReceive calls Handler or Receive with data item 'info' and its
+// value 'v' (opened first, if sealed end-to-end, then transformed), or
+// Archive with its compressed value, one call at a time, and counts
+// the delivered items and errors
+func (rc *Receiver) callReceive(info *ItemInfo, v []byte) error {
+	var err error
+	if len(rc.EndToEndKey) > 0 && rc.Archive == nil {
+		v, err = rc.openSealed(info, v)
+		if err != nil {
+			atomic.AddInt64(&rc.counters.receiveErrors, 1)
+			return err
+		}
+	}
+	items := []Item{{Key: info.Key, Value: v}}
+	if rc.Archive == nil {
+		items, err = rc.transform(info.Key, v)
+		if err != nil {
+			atomic.AddInt64(&rc.counters.receiveErrors, 1)
+			return err
+		}
+	}
+	if rc.receiveMu != nil {
+		rc.receiveMu.Lock()
+		defer rc.receiveMu.Unlock()
+	}
+	for _, it := range items {
+		itemInfo := *info // so detached handlers can't change 'info'
+		itemInfo.Key = it.Key
+		detached, err := rc.callHandler(&itemInfo, it.Value)
+		if detached {
+			continue
+		}
+		if itemInfo.Reply != nil {
+			info.Reply = itemInfo.Reply
+		}
+		rc.countDelivery(err, len(it.Value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+} //                                                                 callReceive
+
+// callHandler passes data item 'v' to the Archive callback or to the
+// handler, waiting at most Config.HandlerTimeout before it emits a
+// SlowHandler event. Returns true if the callback was left running
+// because of Config.DetachSlowHandlers, in which case it counts the
+// delivery itself when the callback returns.
+func (rc *Receiver) callHandler(info *ItemInfo, v []byte) (bool, error) {
+	call := func() error {
+		if rc.Archive != nil {
+			return rc.Archive(info, v)
+		}
+		return rc.handler().HandleItem(info, v)
+	}
+	if rc.Config == nil || rc.Config.HandlerTimeout <= 0 {
+		return false, call()
+	}
+	done := make(chan error, 1)
+	go func() { done <- call() }()
+	timer := time.NewTimer(rc.Config.HandlerTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return false, err
+	case <-timer.C:
+	}
+	_ = rc.logError(0xE5C1B7, "handler for", info.Key,
+		"hasn't returned after", rc.Config.HandlerTimeout)
+	if rc.OnEvent != nil {
+		rc.OnEvent(&Event{Kind: SlowHandler, Addr: info.Addr, Key: info.Key,
+			Time: time.Now()})
+	}
+	if !rc.Config.DetachSlowHandlers {
+		return false, <-done
+	}
+	go func() {
+		err := <-done
+		rc.countDelivery(err, len(v))
+		if err != nil {
+			_ = rc.logError(0xE2D9F4, "detached handler for", info.Key,
+				"failed:", err)
+		}
+	}()
+	return true, nil
+} //                                                                 callHandler
+
+// countDelivery updates the statistics after a callback returned
+// error 'err' (nil if it succeeded) for a data item of 'n' bytes.
+func (rc *Receiver) countDelivery(err error, n int) {
+	if err != nil {
+		atomic.AddInt64(&rc.counters.receiveErrors, 1)
+		return
+	}
+	atomic.AddInt64(&rc.counters.itemsDelivered, 1)
+	atomic.AddInt64(&rc.counters.bytesDelivered, int64(n))
+} //                                                               countDelivery
 
 // -----------------------------------------------------------------------------
 // # Logging Methods
@@ -354,7 +1603,10 @@ func (rc *Receiver) receiveFragment(recv []byte) ([]byte, error) {
 // prints to Receiver.Config.LogWriter (if not nil) to log the error.
 func (rc *Receiver) logError(id uint32, a ...interface{}) error {
 	ret := makeError(id, a...)
-	if rc.Config != nil && rc.Config.LogWriter != nil {
+	if lg := rc.Config.logger(); lg != nil {
+		msg, fields := errorRecord("receiver", id, ret)
+		lg.Error(msg, fields...)
+	} else if rc.Config != nil && rc.Config.LogWriter != nil {
 		s := ret.Error()
 		rc.Config.LogWriter.Write([]byte(s))
 	}
@@ -362,10 +1614,45 @@ func (rc *Receiver) logError(id uint32, a ...interface{}) error {
 } //                                                                    logError
 
 // logInfo writes to Receiver.Config.LogWriter (if not nil) to log a message.
+// If Config.Logger is set, passes the message to its Info method instead.
 func (rc *Receiver) logInfo(a ...interface{}) {
-	if rc.Config != nil && rc.Config.LogWriter != nil {
+	rc.logAt(false, a...)
+} //                                                                     logInfo
+
+// logDebug logs a message like logInfo(), but at the Debug level of
+// Config.Logger. It is used for the messages enabled by VerboseReceiver.
+func (rc *Receiver) logDebug(a ...interface{}) {
+	rc.logAt(true, a...)
+} //                                                                    logDebug
+
+// logAt implements logInfo() and logDebug().
+func (rc *Receiver) logAt(debug bool, a ...interface{}) {
+	switch lg := rc.Config.logger(); {
+	case lg != nil:
+		msg := logMessage(a...)
+		if msg == "" {
+			return
+		}
+		if debug {
+			lg.Debug(msg, "component", "receiver")
+			return
+		}
+		lg.Info(msg, "component", "receiver")
+	case rc.Config != nil && rc.Config.LogWriter != nil:
 		fmt.Fprintln(rc.Config.LogWriter, a...)
 	}
-} //                                                                     logInfo
+} //                                                                       logAt
+
+// -----------------------------------------------------------------------------
+// # Events
+
+// emit passes a new event of the specified kind,
+// relating to peer 'addr', to the OnEvent callback.
+func (rc *Receiver) emit(kind EventKind, addr net.Addr) {
+	if rc.OnEvent == nil {
+		return
+	}
+	rc.OnEvent(&Event{Kind: kind, Addr: addr, Time: time.Now()})
+} //                                                                        emit
 
 // end
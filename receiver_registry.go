@@ -0,0 +1,101 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[receiver_registry.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// localReceivers holds the Receivers running in this process.
+var localReceivers = newReceiverRegistry()
+
+// receiverRegistry keeps track of the Receivers listening in this
+// process by port number, so that a Sender sending to one of them
+// can deliver data items directly, without using the network.
+type receiverRegistry struct {
+	mu        sync.Mutex
+	receivers map[int]*Receiver
+} //                                                            receiverRegistry
+
+// newReceiverRegistry creates and returns a new, empty receiverRegistry.
+func newReceiverRegistry() *receiverRegistry {
+	return &receiverRegistry{receivers: make(map[int]*Receiver)}
+} //                                                         newReceiverRegistry
+
+// Register adds Receiver 'rc', listening on rc.Port, to the registry.
+func (rr *receiverRegistry) Register(rc *Receiver) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.receivers[rc.Port] = rc
+} //                                                                    Register
+
+// Unregister removes Receiver 'rc' from the registry,
+// unless its port has since been taken by another Receiver.
+func (rr *receiverRegistry) Unregister(rc *Receiver) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if rr.receivers[rc.Port] == rc {
+		delete(rr.receivers, rc.Port)
+	}
+} //                                                                  Unregister
+
+// Find returns the Receiver listening on the port of 'addr', provided
+// that the host of 'addr' resolves to this machine. Otherwise returns nil.
+func (rr *receiverRegistry) Find(addr string) *Receiver {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	port, _ := strconv.Atoi(portStr)
+	rr.mu.Lock()
+	rc := rr.receivers[port]
+	rr.mu.Unlock()
+	if rc == nil {
+		return nil
+	}
+	// a link-local IPv6 address may have a zone, like "fe80::1%eth0"
+	if i := strings.LastIndex(host, "%"); i != -1 {
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil
+		}
+		ip = udpAddr.IP
+	}
+	if !isLocalIP(ip) {
+		return nil
+	}
+	return rc
+} //                                                                        Find
+
+// isLocalIP returns true if 'ip' is a loopback or unspecified
+// address, or the address of one of this machine's interfaces.
+func isLocalIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+} //                                                                   isLocalIP
+
+// end
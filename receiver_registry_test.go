@@ -0,0 +1,66 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                         /[receiver_registry_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"testing"
+)
+
+// (rr *receiverRegistry) Find(addr string) *Receiver
+//
+// go test -run Test_receiverRegistry_Find_
+//
+func Test_receiverRegistry_Find_(t *testing.T) {
+	rr := newReceiverRegistry()
+	rc := &Receiver{Port: 9876}
+	rr.Register(rc)
+	for _, addr := range []string{
+		"127.0.0.1:9876", "localhost:9876", "[::1]:9876", "0.0.0.0:9876",
+	} {
+		if rr.Find(addr) != rc {
+			t.Error("0xE68A27", addr)
+		}
+	}
+	for _, addr := range []string{
+		"127.0.0.1:9875", "192.0.2.1:9876", "127.0.0.1", "",
+	} {
+		if rr.Find(addr) != nil {
+			t.Error("0xEE4D56", addr)
+		}
+	}
+	// must not remove a Receiver that has since taken the port
+	other := &Receiver{Port: 9876}
+	rr.Register(other)
+	rr.Unregister(rc)
+	if rr.Find("127.0.0.1:9876") != other {
+		t.Error("0xE07D69")
+	}
+	rr.Unregister(other)
+	if rr.Find("127.0.0.1:9876") != nil {
+		t.Error("0xEDCF3E")
+	}
+}
+
+// isLocalIP(ip net.IP) bool
+//
+// go test -run Test_isLocalIP_
+//
+func Test_isLocalIP_(t *testing.T) {
+	test := func(ip string, want bool) {
+		if got := isLocalIP(net.ParseIP(ip)); got != want {
+			t.Error("0xE21B73", ip, "want:", want, "got:", got)
+		}
+	}
+	test("127.0.0.1", true)
+	test("127.1.2.3", true)
+	test("::1", true)
+	test("0.0.0.0", true)
+	test("192.0.2.1", false) // TEST-NET-1, never assigned to a host
+	test("", false)
+}
+
+// end
@@ -0,0 +1,238 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[receiver_stats.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+)
+
+// ReceiverStats contains the statistics of a Receiver
+// since it started running. See Receiver.Stats().
+type ReceiverStats struct {
+
+	// PacketsReceived is the number of packets decrypted successfully.
+	PacketsReceived int64
+
+	// PacketsRejected is the number of packets that couldn't be read or
+	// decrypted, e.g. packets encrypted with another key, or tampered,
+	// and of packets dropped because they were replayed.
+	PacketsRejected int64
+
+	// PacketsOversized is the number of datagrams dropped because they
+	// were longer than Config.PacketSizeLimit. They are not included
+	// in PacketsRejected.
+	PacketsOversized int64
+
+	// PacketsDropped is the number of datagrams the kernel dropped
+	// because the socket's receive buffer was full, i.e. lost on this
+	// host rather than on the network. It is only counted on Linux,
+	// where the kernel reports it (see SO_RXQ_OVFL in socket(7)).
+	// Increasing the receive buffer size, or receiving faster,
+	// reduces it.
+	PacketsDropped int64
+
+	// ItemsDelivered is the number of data items passed to Receive.
+	ItemsDelivered int64
+
+	// BytesDelivered is the total size of the values passed to Receive.
+	BytesDelivered int64
+
+	// ReceiveErrors is the number of times Receive returned an error.
+	ReceiveErrors int64
+
+	// DecryptFailures is the number of packets in PacketsRejected that
+	// couldn't be decrypted, e.g. because they were encrypted with
+	// another key, or tampered with.
+	DecryptFailures int64
+
+	// BytesReceived is the total size of the packets in PacketsReceived,
+	// before decryption.
+	BytesReceived int64
+
+	// BytesCompressed is the total size of the data items in
+	// BytesDelivered as they were sent, i.e. compressed. Items delivered
+	// directly by a Sender in this process are counted uncompressed.
+	BytesCompressed int64
+
+	// ItemsExpired is the number of incomplete data items discarded
+	// because their fragments stopped arriving for Config.ItemExpiry,
+	// e.g. because their Sender died, to free the memory they held.
+	ItemsExpired int64
+
+	// PiecesCorrupted is the number of pieces whose checksum didn't
+	// match their contents. They are discarded and sent again.
+	PiecesCorrupted int64
+
+	// PacketsDenied is the number of datagrams dropped before they were
+	// decrypted, because they came from an address not allowed by
+	// Config.AllowedSenders, or denied by Config.DeniedSenders.
+	PacketsDenied int64
+} //                                                               ReceiverStats
+
+// receiverCounters holds the counters behind ReceiverStats. They are
+// updated by the Receiver's goroutines with atomic operations.
+type receiverCounters struct {
+	packetsReceived  int64
+	packetsRejected  int64
+	packetsOversized int64
+	packetsDropped   int64
+	itemsDelivered   int64
+	bytesDelivered   int64
+	receiveErrors    int64
+	decryptFailures  int64
+	bytesReceived    int64
+	bytesCompressed  int64
+	itemsExpired     int64
+	piecesCorrupted  int64
+	packetsDenied    int64
+} //                                                            receiverCounters
+
+// snapshot returns the current values of the counters
+func (rs *receiverCounters) snapshot() ReceiverStats {
+	return ReceiverStats{
+		PacketsReceived:  atomic.LoadInt64(&rs.packetsReceived),
+		PacketsRejected:  atomic.LoadInt64(&rs.packetsRejected),
+		PacketsOversized: atomic.LoadInt64(&rs.packetsOversized),
+		PacketsDropped:   atomic.LoadInt64(&rs.packetsDropped),
+		ItemsDelivered:   atomic.LoadInt64(&rs.itemsDelivered),
+		BytesDelivered:   atomic.LoadInt64(&rs.bytesDelivered),
+		ReceiveErrors:    atomic.LoadInt64(&rs.receiveErrors),
+		DecryptFailures:  atomic.LoadInt64(&rs.decryptFailures),
+		BytesReceived:    atomic.LoadInt64(&rs.bytesReceived),
+		BytesCompressed:  atomic.LoadInt64(&rs.bytesCompressed),
+		ItemsExpired:     atomic.LoadInt64(&rs.itemsExpired),
+		PiecesCorrupted:  atomic.LoadInt64(&rs.piecesCorrupted),
+		PacketsDenied:    atomic.LoadInt64(&rs.packetsDenied),
+	}
+} //                                                                    snapshot
+
+// CompressionRatio returns BytesDelivered divided by BytesCompressed,
+// e.g. 4.0 if the items were sent compressed to a quarter of their size.
+// Returns 0 if no items have been delivered.
+func (st ReceiverStats) CompressionRatio() float64 {
+	if st.BytesCompressed == 0 {
+		return 0
+	}
+	return float64(st.BytesDelivered) / float64(st.BytesCompressed)
+} //                                                            CompressionRatio
+
+// -----------------------------------------------------------------------------
+
+// receiverStatsJSON is the JSON form of ReceiverStats. Its field
+// names are part of the schema identified by StatsSchemaVersion.
+type receiverStatsJSON struct {
+	Schema           int   `json:"schema"`
+	PacketsReceived  int64 `json:"packets_received"`
+	PacketsRejected  int64 `json:"packets_rejected"`
+	ItemsDelivered   int64 `json:"items_delivered"`
+	BytesDelivered   int64 `json:"bytes_delivered"`
+	ReceiveErrors    int64 `json:"receive_errors"`
+	PacketsDropped   int64 `json:"packets_dropped"`
+	DecryptFailures  int64 `json:"decrypt_failures"`
+	BytesReceived    int64 `json:"bytes_received"`
+	BytesCompressed  int64 `json:"bytes_compressed"`
+	ItemsExpired     int64 `json:"items_expired"`
+	PiecesCorrupted  int64 `json:"pieces_corrupted"`
+	PacketsDenied    int64 `json:"packets_denied"`
+	PacketsOversized int64 `json:"packets_oversized"`
+} //                                                           receiverStatsJSON
+
+// MarshalJSON encodes the statistics as a JSON object with stable,
+// snake_case field names and a "schema" field holding StatsSchemaVersion.
+func (st ReceiverStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(receiverStatsJSON{
+		Schema:           StatsSchemaVersion,
+		PacketsReceived:  st.PacketsReceived,
+		PacketsRejected:  st.PacketsRejected,
+		ItemsDelivered:   st.ItemsDelivered,
+		BytesDelivered:   st.BytesDelivered,
+		ReceiveErrors:    st.ReceiveErrors,
+		PacketsDropped:   st.PacketsDropped,
+		DecryptFailures:  st.DecryptFailures,
+		BytesReceived:    st.BytesReceived,
+		BytesCompressed:  st.BytesCompressed,
+		ItemsExpired:     st.ItemsExpired,
+		PiecesCorrupted:  st.PiecesCorrupted,
+		PacketsDenied:    st.PacketsDenied,
+		PacketsOversized: st.PacketsOversized,
+	})
+} //                                                                 MarshalJSON
+
+// UnmarshalJSON decodes statistics encoded by MarshalJSON. It returns
+// an error if the data has a newer schema than StatsSchemaVersion.
+func (st *ReceiverStats) UnmarshalJSON(data []byte) error {
+	var js receiverStatsJSON
+	err := json.Unmarshal(data, &js)
+	if err != nil {
+		return err
+	}
+	err = checkStatsSchema(js.Schema)
+	if err != nil {
+		return err
+	}
+	*st = ReceiverStats{
+		PacketsReceived:  js.PacketsReceived,
+		PacketsRejected:  js.PacketsRejected,
+		PacketsOversized: js.PacketsOversized,
+		PacketsDropped:   js.PacketsDropped,
+		ItemsDelivered:   js.ItemsDelivered,
+		BytesDelivered:   js.BytesDelivered,
+		ReceiveErrors:    js.ReceiveErrors,
+		DecryptFailures:  js.DecryptFailures,
+		BytesReceived:    js.BytesReceived,
+		BytesCompressed:  js.BytesCompressed,
+		ItemsExpired:     js.ItemsExpired,
+		PiecesCorrupted:  js.PiecesCorrupted,
+		PacketsDenied:    js.PacketsDenied,
+	}
+	return nil
+} //                                                               UnmarshalJSON
+
+// CSVHeader returns the CSV column names of the
+// statistics, matching the fields of CSVRecord().
+// Implements StatsRecord.
+func (st ReceiverStats) CSVHeader() []string {
+	return []string{
+		"schema",
+		"packets_received",
+		"packets_rejected",
+		"items_delivered",
+		"bytes_delivered",
+		"receive_errors",
+		"packets_dropped",
+		"decrypt_failures",
+		"bytes_received",
+		"bytes_compressed",
+		"items_expired",
+		"pieces_corrupted",
+		"packets_denied",
+		"packets_oversized",
+	}
+} //                                                                   CSVHeader
+
+// CSVRecord returns the statistics as CSV fields. Implements StatsRecord.
+func (st ReceiverStats) CSVRecord() []string {
+	return []string{
+		strconv.Itoa(StatsSchemaVersion),
+		strconv.FormatInt(st.PacketsReceived, 10),
+		strconv.FormatInt(st.PacketsRejected, 10),
+		strconv.FormatInt(st.ItemsDelivered, 10),
+		strconv.FormatInt(st.BytesDelivered, 10),
+		strconv.FormatInt(st.ReceiveErrors, 10),
+		strconv.FormatInt(st.PacketsDropped, 10),
+		strconv.FormatInt(st.DecryptFailures, 10),
+		strconv.FormatInt(st.BytesReceived, 10),
+		strconv.FormatInt(st.BytesCompressed, 10),
+		strconv.FormatInt(st.ItemsExpired, 10),
+		strconv.FormatInt(st.PiecesCorrupted, 10),
+		strconv.FormatInt(st.PacketsDenied, 10),
+		strconv.FormatInt(st.PacketsOversized, 10),
+	}
+} //                                                                   CSVRecord
+
+// end
@@ -0,0 +1,74 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /[receiver_stats_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// (st ReceiverStats) MarshalJSON() ([]byte, error)
+// (st *ReceiverStats) UnmarshalJSON(data []byte) error
+//
+// go test -run Test_ReceiverStats_JSON_
+//
+func Test_ReceiverStats_JSON_(t *testing.T) {
+	st := ReceiverStats{
+		PacketsReceived:  100,
+		PacketsRejected:  2,
+		PacketsOversized: 3,
+		ItemsDelivered:   5,
+		BytesDelivered:   5000,
+		ReceiveErrors:    1,
+		PacketsDropped:   4,
+		DecryptFailures:  2,
+		BytesReceived:    90000,
+		BytesCompressed:  2500,
+		ItemsExpired:     6,
+		PiecesCorrupted:  7,
+		PacketsDenied:    8,
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Error("0xE2D9B1", err)
+	}
+	want := `{"schema":1,"packets_received":100,"packets_rejected":2,` +
+		`"items_delivered":5,"bytes_delivered":5000,` +
+		`"receive_errors":1,"packets_dropped":4,"decrypt_failures":2,` +
+		`"bytes_received":90000,"bytes_compressed":2500,"items_expired":6,` +
+		`"pieces_corrupted":7,"packets_denied":8,"packets_oversized":3}`
+	if string(data) != want {
+		t.Error("0xEAF7E6", "\nwant:", want, "\n got:", string(data))
+	}
+	var got ReceiverStats
+	err = json.Unmarshal(data, &got)
+	if got != st || err != nil {
+		t.Error("0xEC125E", got, err)
+	}
+	err = json.Unmarshal([]byte(`{"packets_received":1}`), &got)
+	if !matchError(err, "unsupported stats schema version: 0") {
+		t.Error("0xE0EDA6", "wrong error:", err)
+	}
+}
+
+// (st ReceiverStats) CSVRecord() []string
+//
+// go test -run Test_ReceiverStats_CSVRecord_
+//
+func Test_ReceiverStats_CSVRecord_(t *testing.T) {
+	st := ReceiverStats{PacketsReceived: 100, ItemsDelivered: 5,
+		ItemsExpired: 2}
+	got := strings.Join(st.CSVRecord(), ",")
+	if got != "1,100,0,5,0,0,0,0,0,0,2,0,0,0" {
+		t.Error("0xEC2CCE", got)
+	}
+	if len(st.CSVHeader()) != len(st.CSVRecord()) {
+		t.Error("0xE39363")
+	}
+}
+
+// end
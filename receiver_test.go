@@ -7,8 +7,13 @@ package udpt
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
 	"net"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -20,8 +25,8 @@ import (
 // -----------------------------------------------------------------------------
 
 // newRunnableReceiver() creates a Receiver with all required fields set
-func newRunnableReceiver() Receiver {
-	ret := Receiver{
+func newRunnableReceiver() *Receiver {
+	ret := &Receiver{
 		Port:      9876,
 		CryptoKey: []byte("0123456789abcdefghijklmnopqrst12"),
 		Config:    NewDefaultConfig(),
@@ -134,6 +139,129 @@ func Test_Receiver_Run_09(t *testing.T) {
 	}
 }
 
+// must drop a datagram longer than Config.PacketSizeLimit,
+// counting it and emitting an OversizedPacket event
+func Test_Receiver_Run_10(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9884
+	rc.Config.PacketSizeLimit = 300
+	rc.Config.PacketPayloadSize = 50
+	events := make(chan *Event, 1)
+	rc.OnEvent = func(ev *Event) { events <- ev }
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	conn, err := net.Dial("udp", "127.0.0.1:9884")
+	if err != nil {
+		t.Fatal("0xE3075A", err)
+	}
+	defer conn.Close()
+	_, err = conn.Write(make([]byte, 301))
+	if err != nil {
+		t.Fatal("0xE14F73", err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Kind != OversizedPacket || ev.Addr == nil {
+			t.Error("0xE2AB25", ev)
+		}
+	case <-time.After(time.Second):
+		t.Error("0xE63F4C", "no event")
+	}
+	st := rc.Stats()
+	if st.PacketsOversized != 1 || st.PacketsRejected != 0 {
+		t.Error("0xEDA81D", st)
+	}
+}
+
+// must drop a packet received again, counting it and
+// emitting a ReplayedPacket event
+func Test_Receiver_Run_11(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9878
+	events := make(chan *Event, 10)
+	rc.OnEvent = func(ev *Event) { events <- ev }
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	cphr := &aesCipher{}
+	_ = cphr.SetKey(rc.CryptoKey)
+	packet, err := cphr.Encrypt([]byte("captured"))
+	if err != nil {
+		t.Fatal("0xE0D5A3", err)
+	}
+	conn, err := net.Dial("udp", "127.0.0.1:9878")
+	if err != nil {
+		t.Fatal("0xE7A8C1", err)
+	}
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		_, err = conn.Write(packet)
+		if err != nil {
+			t.Fatal("0xE3B2F9", err)
+		}
+	}
+	timeout := time.After(time.Second)
+	for replayed := false; !replayed; {
+		select {
+		case ev := <-events:
+			replayed = ev.Kind == ReplayedPacket
+		case <-timeout:
+			t.Fatal("0xE9E4D6", "no ReplayedPacket event")
+		}
+	}
+	st := rc.Stats()
+	if st.PacketsReceived != 1 || st.PacketsRejected != 1 {
+		t.Error("0xE5C0B7", st)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (rc *Receiver) RunContext(ctx context.Context) error
+//
+// go test -run Test_Receiver_RunContext_*
+
+// must stop and release the port when the context is cancelled
+func Test_Receiver_RunContext_1(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9885
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- rc.RunContext(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Error("0xED6B61", "wrong error:", err)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("0xEBCC84", "RunContext didn't return")
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: 9885})
+	if err != nil {
+		t.Error("0xEA82F8", err)
+	} else {
+		_ = conn.Close()
+	}
+}
+
+// must not start with a cancelled context
+func Test_Receiver_RunContext_2(t *testing.T) {
+	rc := newRunnableReceiver()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := rc.RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Error("0xE5A1E3", "wrong error:", err)
+	}
+	if rc.conn != nil {
+		t.Error("0xE2C4B7")
+	}
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 // (rc *Receiver) Stop()
 //
@@ -165,6 +293,205 @@ func Test_Receiver_Stop_2(t *testing.T) {
 	}
 }
 
+// must not race with Run() starting in another goroutine
+// (run with -race to check)
+func Test_Receiver_Stop_3(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9852
+	ran := make(chan error, 1)
+	go func() { ran <- rc.Run() }()
+	for {
+		rc.Stop()
+		_ = rc.Close()
+		select {
+		case <-ran:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (rc *Receiver) Close() error
+//
+// go test -run Test_Receiver_Close_*
+
+// must fail if the Receiver is not running
+func Test_Receiver_Close_1(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Config.LogWriter = nil
+	err := rc.Close()
+	if !matchError(err, "Receiver is not running") {
+		t.Error("0xE4E48B", "wrong error:", err)
+	}
+}
+
+// must handle packets that have arrived, discard the incomplete
+// item, and return once Run() has released the port
+func Test_Receiver_Close_2(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = 100
+	sd.dataHash = getHash(v)
+	sd.comp = comp
+	_ = sd.makePackets("key", sd.comp)
+	var buf streamBuffer
+	rc := newRunnableReceiver()
+	rc.Port = 9892
+	rc.Config.ReplyTimeout = 10 * time.Second
+	rc.ReceiveStream = func(k string) (io.WriteCloser, error) {
+		return &buf, nil
+	}
+	ran := make(chan error, 1)
+	go func() { ran <- rc.Run() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	_ = sd.Config.Cipher.SetKey(rc.CryptoKey)
+	packet, _ := sd.Config.Cipher.Encrypt(sd.packets[0].data)
+	conn, err := net.Dial("udp", "127.0.0.1:9892")
+	if err != nil {
+		t.Fatal("0xEFEC06", err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write(packet)
+	t0 := time.Now()
+	err = rc.Close()
+	if err != nil || time.Since(t0) > time.Second {
+		t.Error("0xE568A3", err, time.Since(t0))
+	}
+	select {
+	case err = <-ran:
+		if err != nil {
+			t.Error("0xEF7E12", err)
+		}
+	default:
+		t.Error("0xE19D98", "Run() hasn't returned")
+	}
+	if !buf.closed || !matchError(buf.closeErr, "Receiver stopped") {
+		t.Error("0xE66FB7", buf.closed, buf.closeErr)
+	}
+	// the port must have been released
+	pc, err := net.ListenPacket("udp", "0.0.0.0:9892")
+	if err != nil {
+		t.Fatal("0xEDFD37", err)
+	}
+	_ = pc.Close()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (rc *Receiver) Stats() ReceiverStats
+//
+// go test -run Test_Receiver_Stats_
+
+// must count delivered items and Receive errors
+func Test_Receiver_Stats_(t *testing.T) {
+	rc := newRunnableReceiver()
+	_, _ = rc.receiveLocal("a", []byte("12345"), "")
+	rc.Receive = func(k string, v []byte) error {
+		return makeError(0xE7B3F9, "failed Receive")
+	}
+	_, _ = rc.receiveLocal("b", []byte("67890"), "")
+	want := ReceiverStats{ItemsDelivered: 1, BytesDelivered: 5,
+		ReceiveErrors: 1, BytesCompressed: 5}
+	if got := rc.Stats(); got != want {
+		t.Error("0xE4C2D8", got)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (rc *Receiver) Rebind(addr string) error
+//
+// go test -run Test_Receiver_Rebind_*
+
+// must keep receiving at the new address, and emit a Rebound event
+func Test_Receiver_Rebind_1(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9880
+	var got string
+	rc.Receive = func(k string, v []byte) error {
+		got = k + "=" + string(v)
+		return nil
+	}
+	var events []*Event
+	rc.OnEvent = func(ev *Event) { events = append(events, ev) }
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	err := rc.Rebind("127.0.0.1:9881")
+	if err != nil {
+		t.Error("0xE428F6", err)
+	}
+	if rc.Port != 9881 {
+		t.Error("0xED7C1C", rc.Port)
+	}
+	if len(events) != 1 || events[0].Kind != Rebound ||
+		events[0].Addr.String() != "127.0.0.1:9881" {
+		t.Error("0xE6760C", events)
+	}
+	cf := NewDefaultConfig()
+	err = Send("127.0.0.1:9881", "greeting", []byte("Hello!"),
+		rc.CryptoKey, cf)
+	if err != nil {
+		t.Error("0xE0A24C", err)
+	}
+	if got != "greeting=Hello!" {
+		t.Error("0xEB066F", got)
+	}
+}
+
+// must fail if the Receiver is not running
+func Test_Receiver_Rebind_2(t *testing.T) {
+	rc := newRunnableReceiver()
+	err := rc.Rebind(":9881")
+	if !matchError(err, "Receiver is not running") {
+		t.Error("0xE67E76", "wrong error:", err)
+	}
+}
+
+// must keep listening at the old address if the new one can't be bound
+func Test_Receiver_Rebind_3(t *testing.T) {
+	taken, err := net.ListenUDP("udp", &net.UDPAddr{Port: 9881})
+	if err != nil {
+		t.Fatal("0xE0C5A1", err)
+	}
+	defer taken.Close()
+	rc := newRunnableReceiver()
+	rc.Port = 9880
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	err = rc.Rebind(":9881")
+	if err == nil {
+		t.Error("0xECF18F")
+	}
+	if rc.Port != 9880 || rc.currentConn() == nil {
+		t.Error("0xE74088", rc.Port)
+	}
+}
+
+// must stop running, instead of spinning, when its socket
+// is closed by something other than Stop() or Rebind()
+func Test_Receiver_Rebind_4(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("0xE3B5A8", err)
+	}
+	rc := newRunnableReceiver()
+	rc.PacketConn = pc
+	done := make(chan error, 1)
+	go func() { done <- rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	_ = pc.Close()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Error("0xE7C2D1", "Run didn't return after the socket closed")
+	}
+}
+
 // -----------------------------------------------------------------------------
 // # Run() Helpers
 
@@ -211,7 +538,7 @@ func Test_Receiver_initRun_2(t *testing.T) {
 			if network != "udp" {
 				t.Error("0xE94D6D")
 			}
-			if addr != "0.0.0.0:9876" {
+			if addr != ":9876" {
 				t.Error("0xED87E1")
 			}
 			return &net.UDPAddr{IP: []byte{5, 4, 3, 2}, Port: 9876}, nil
@@ -586,6 +913,100 @@ func Test_Receiver_sendReply_3(t *testing.T) {
 	}
 }
 
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (rc *Receiver) verifyPeer(addr net.Addr) bool
+//
+// go test -run Test_Receiver_verifyPeer_*
+
+// must emit PeerVerified and call OnPeerVerified once per address
+func Test_Receiver_verifyPeer_1(t *testing.T) {
+	var events []*Event
+	var hooked []string
+	rc := Receiver{Config: NewDefaultConfig()}
+	rc.OnEvent = func(ev *Event) { events = append(events, ev) }
+	rc.OnPeerVerified = func(addr net.Addr) error {
+		hooked = append(hooked, addr.String())
+		return nil
+	}
+	a1 := &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 1001}
+	a2 := &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 1002}
+	for _, addr := range []net.Addr{a1, a1, a2, a1, a2} {
+		if !rc.verifyPeer(addr) {
+			t.Error("0xEEF310")
+		}
+	}
+	if len(events) != 2 || len(hooked) != 2 {
+		t.Fatal("0xEAF2BB", len(events), len(hooked))
+	}
+	if events[0].Kind != PeerVerified || events[0].Addr != a1 ||
+		events[1].Addr != a2 || events[0].Time.IsZero() {
+		t.Error("0xEA0086")
+	}
+}
+
+// must drop packets while OnPeerVerified fails, and retry the hook
+func Test_Receiver_verifyPeer_2(t *testing.T) {
+	var tlog strings.Builder
+	calls := 0
+	rc := Receiver{Config: NewDefaultConfig()}
+	rc.Config.LogWriter = &tlog
+	rc.OnPeerVerified = func(addr net.Addr) error {
+		calls++
+		if calls == 1 {
+			return makeError(0xEF6A43, "no disk space")
+		}
+		return nil
+	}
+	addr := &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 1001}
+	if rc.verifyPeer(addr) {
+		t.Error("0xE5CF2B")
+	}
+	if !strings.Contains(tlog.String(), "OnPeerVerified: no disk space") {
+		t.Error("0xE30D54")
+	}
+	if !rc.verifyPeer(addr) || !rc.verifyPeer(addr) || calls != 2 {
+		t.Error("0xEFC1A0")
+	}
+}
+
+// must forget peers that have been idle for Config.ItemExpiry,
+// and the longest idle peer when it remembers too many
+func Test_Receiver_verifyPeer_3(t *testing.T) {
+	calls := 0
+	rc := Receiver{Config: NewDefaultConfig()}
+	rc.Config.ItemExpiry = time.Minute
+	rc.OnPeerVerified = func(addr net.Addr) error {
+		calls++
+		return nil
+	}
+	addr := &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 1001}
+	rc.verifyPeer(addr)
+	rc.expireItems(time.Now().Add(30 * time.Second))
+	rc.verifyPeer(addr)
+	if calls != 1 || len(rc.verifiedPeers) != 1 {
+		t.Error("0xE7A2D9", calls, len(rc.verifiedPeers))
+	}
+	rc.lastExpiry = time.Time{}
+	rc.expireItems(time.Now().Add(2 * time.Minute))
+	if len(rc.verifiedPeers) != 0 {
+		t.Error("0xE1F9A6", len(rc.verifiedPeers))
+	}
+	rc.verifyPeer(addr)
+	if calls != 2 {
+		t.Error("0xE9D4F2", calls)
+	}
+	now := time.Now()
+	for i := 1; i < maxVerifiedPeers; i++ {
+		rc.verifiedPeers[strconv.Itoa(i)] = now.Add(time.Duration(i))
+	}
+	rc.verifiedPeers[addr.String()] = now.Add(-time.Second)
+	rc.verifyPeer(&net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 1002})
+	_, ok := rc.verifiedPeers[addr.String()]
+	if len(rc.verifiedPeers) != maxVerifiedPeers || ok {
+		t.Error("0xE5B8C3", len(rc.verifiedPeers), ok)
+	}
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 // (rc *Receiver) receiveFragment(recv []byte) ([]byte, error)
 //
@@ -709,6 +1130,348 @@ func Test_Receiver_receiveFragment_9(t *testing.T) {
 	}
 }
 
+// must fail because Config.HashCompressed requires a compressed data hash
+func Test_Receiver_receiveFragment_10(t *testing.T) {
+	rc := Receiver{Config: NewDefaultConfig()}
+	rc.Config.HashCompressed = true
+	data, err := rc.receiveFragment([]byte(tagFragment +
+		"key:abc hash:" + testHash + " sn:1 count:1\nxyz"))
+	if data != nil {
+		t.Error("0xEAAAE8")
+	}
+	if !matchError(err, "missing compressed data hash") {
+		t.Error("0xED42FA", "wrong error:", err)
+	}
+	data, err = rc.receiveFragment([]byte(tagFragment +
+		"key:abc hash:" + testHash + " comp:FF sn:1 count:1\nxyz"))
+	if data != nil {
+		t.Error("0xE2D4D9")
+	}
+	if !matchError(err, "bad compressed data hash") {
+		t.Error("0xE38C7F", "wrong error:", err)
+	}
+}
+
+// must deliver an item sent with Config.HashCompressed
+func Test_Receiver_receiveFragment_11(t *testing.T) {
+	v := []byte(strings.Repeat("0123456789", 20))
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.HashCompressed = true
+	sd.Config.PacketPayloadSize = 30
+	sd.dataHash = getHash(v)
+	sd.comp, _ = sd.Config.Compressor.Compress(v)
+	_ = sd.makePackets("key", sd.comp)
+	var got []byte
+	rc := Receiver{Config: sd.Config}
+	rc.Receive = func(k string, v []byte) error {
+		got = v
+		return nil
+	}
+	for _, pk := range sd.packets {
+		if !bytes.Contains(pk.data, []byte(" comp:")) {
+			t.Error("0xEAF1C8", string(pk.data))
+		}
+		_, err := rc.receiveFragment(pk.data)
+		if err != nil {
+			t.Error("0xEDDE22", err)
+		}
+	}
+	if !bytes.Equal(got, v) {
+		t.Error("0xE47BC6", string(got))
+	}
+}
+
+// must stream an item to the writer from ReceiveStream,
+// and confirm packets that arrive again once it's complete
+func Test_Receiver_receiveFragment_12(t *testing.T) {
+	v := make([]byte, 3000)
+	rand.New(rand.NewSource(1)).Read(v)
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = 100
+	sd.dataHash = getHash(v)
+	sd.comp, _ = sd.Config.Compressor.Compress(v)
+	_ = sd.makePackets("key", sd.comp)
+	var buf streamBuffer
+	opened := 0
+	rc := newRunnableReceiver()
+	rc.Receive = nil
+	rc.ReceiveStream = func(k string) (io.WriteCloser, error) {
+		if k != "key" {
+			t.Error("0xE6B497", k)
+		}
+		opened++
+		return &buf, nil
+	}
+	for i := len(sd.packets) - 1; i >= 0; i-- {
+		reply, err := rc.receiveFragment(sd.packets[i].data)
+		if err != nil || reply == nil {
+			t.Error("0xE490EB", err)
+		}
+	}
+	reply, err := rc.receiveFragment(sd.packets[0].data)
+	if err != nil || reply == nil {
+		t.Error("0xE2B4ED", err)
+	}
+	if !bytes.Equal(buf.Bytes(), v) || !buf.closed || opened != 1 {
+		t.Error("0xE3565C", buf.Len(), buf.closed, opened)
+	}
+	if st := rc.Stats(); st.ItemsDelivered != 1 || st.BytesDelivered != 3000 {
+		t.Error("0xE54682", st)
+	}
+	// a Sender in this process must also deliver to the writer
+	buf = streamBuffer{}
+	_, err = rc.receiveLocal("key", []byte("local"), "")
+	if err != nil || buf.String() != "local" || !buf.closed {
+		t.Error("0xEB957A", err, buf.String())
+	}
+}
+
+// must deliver two data items whose fragments arrive interleaved,
+// and must not deliver an item again when its packets are resent
+func Test_Receiver_receiveFragment_13(t *testing.T) {
+	var senders []*Sender
+	for i, k := range []string{"first", "second"} {
+		v := make([]byte, 300)
+		rand.New(rand.NewSource(int64(i))).Read(v)
+		sd := &Sender{Config: NewDefaultConfig()}
+		sd.Config.PacketPayloadSize = 30
+		sd.dataHash = getHash(v)
+		sd.comp, _ = sd.Config.Compressor.Compress(v)
+		_ = sd.makePackets(k, sd.comp)
+		if len(sd.packets) < 2 {
+			t.Fatal("0xE7D7D8", len(sd.packets))
+		}
+		senders = append(senders, sd)
+	}
+	got := map[string]int{}
+	rc := newRunnableReceiver()
+	rc.Receive = func(k string, v []byte) error {
+		got[k]++
+		return nil
+	}
+	for i := 0; i < len(senders[0].packets) ||
+		i < len(senders[1].packets); i++ {
+		for _, sd := range senders {
+			if i >= len(sd.packets) {
+				continue
+			}
+			_, err := rc.receiveFragment(sd.packets[i].data)
+			if err != nil {
+				t.Error("0xEE908C", err)
+			}
+		}
+	}
+	reply, err := rc.receiveFragment(senders[0].packets[0].data)
+	if err != nil || !bytes.HasPrefix(reply, []byte(tagConfirmation)) {
+		t.Error("0xEB769A", err, string(reply))
+	}
+	if len(got) != 2 || got["first"] != 1 || got["second"] != 1 {
+		t.Error("0xEDBD55", got)
+	}
+}
+
+// must report the compressed bytes collected to Config.OnProgress
+func Test_Receiver_receiveFragment_15(t *testing.T) {
+	v := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(v)
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = 100
+	sd.dataHash = getHash(v)
+	sd.comp, _ = sd.Config.Compressor.Compress(v)
+	_ = sd.makePackets("key", sd.comp)
+	for _, stream := range []bool{false, true} {
+		var calls int
+		var last [2]int64
+		rc := newRunnableReceiver()
+		rc.Config = NewDefaultConfig()
+		rc.Config.OnProgress = func(name string, received, total int64) {
+			calls++
+			last = [2]int64{received, total}
+		}
+		if stream {
+			rc.ReceiveStream = func(k string) (io.WriteCloser, error) {
+				return &streamBuffer{}, nil
+			}
+		}
+		for _, pk := range sd.packets {
+			_, _ = rc.receiveFragment(pk.data)
+		}
+		n := int64(len(sd.comp))
+		if calls != len(sd.packets) || last != [2]int64{n, n} {
+			t.Error("0xE25AF2", stream, calls, last, n)
+		}
+	}
+}
+
+// confirmations must advertise Config.MaxReceiveBytesPerSecond
+func Test_Receiver_receiveFragment_16(t *testing.T) {
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = 100
+	v := []byte(strings.Repeat("abc", 100))
+	sd.dataHash = getHash(v)
+	sd.comp = v
+	_ = sd.makePackets("key", sd.comp)
+	for _, want := range []int64{0, 250000} {
+		rc := newRunnableReceiver()
+		rc.Config = NewDefaultConfig()
+		rc.Config.MaxReceiveBytesPerSecond = want
+		reply, err := rc.receiveFragment(sd.packets[0].data)
+		if err != nil {
+			t.Fatal("0xE278A0", err)
+		}
+		hash, rate, err := readConfirmation(reply)
+		if err != nil || rate != want ||
+			!bytes.Equal(hash, getHash(sd.packets[0].data)) {
+			t.Error("0xE75A3B", want, rate, err)
+		}
+	}
+}
+
+// must fail because the sub-piece number exceeds the sub-piece count
+func Test_Receiver_receiveFragment_14(t *testing.T) {
+	rc := Receiver{Config: NewDefaultConfig()}
+	_, err := rc.receiveFragment([]byte(tagFragment +
+		"key:a hash:" + testHash + " sub:4/3 sn:1 count:1\n" + "data"))
+	if !matchError(err, "bad 'sub'") {
+		t.Error("0xE70557", "wrong error:", err)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (rc *Receiver) expireItems(now time.Time)
+//
+// go test -run Test_Receiver_expireItems_
+
+// must discard items idle for longer than Config.ItemExpiry, and abort
+// the writers of those that were still being streamed
+func Test_Receiver_expireItems_(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = 100
+	sd.dataHash = getHash(v)
+	sd.comp = comp
+	_ = sd.makePackets("key", sd.comp)
+	var buf streamBuffer
+	rc := newRunnableReceiver()
+	rc.Config.ItemExpiry = time.Minute
+	rc.ReceiveStream = func(k string) (io.WriteCloser, error) {
+		return &buf, nil
+	}
+	_, err := rc.receiveFragment(sd.packets[1].data)
+	if err != nil || len(rc.receiving) != 1 {
+		t.Fatal("0xE2035C", err, len(rc.receiving))
+	}
+	now := time.Now()
+	rc.expireItems(now)
+	if len(rc.receiving) != 1 || buf.closed {
+		t.Error("0xE74623", len(rc.receiving), buf.closed)
+	}
+	rc.lastExpiry = time.Time{}
+	rc.expireItems(now.Add(2 * time.Minute))
+	if len(rc.receiving) != 0 {
+		t.Error("0xEF91F6", len(rc.receiving))
+	}
+	if !buf.closed || !matchError(buf.closeErr, "data item expired") {
+		t.Error("0xE9F1F6", buf.closed, buf.closeErr)
+	}
+}
+
+// must free incomplete items whose Sender stopped sending,
+// counting them in ItemsExpired, but not delivered items
+func Test_Receiver_expireItems_2(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = 100
+	sd.dataHash = getHash(v)
+	sd.comp = comp
+	_ = sd.makePackets("abandoned", sd.comp)
+	if len(sd.packets) < 2 {
+		t.Fatal("0xE4D0A8", len(sd.packets))
+	}
+	rc := newRunnableReceiver()
+	rc.Config.ItemExpiry = time.Minute
+	_, err := rc.receiveFragment(sd.packets[0].data)
+	if err != nil || len(rc.receiving) != 1 {
+		t.Fatal("0xE8C3F6", err, len(rc.receiving))
+	}
+	for _, it := range rc.receiving {
+		it.done = true // delivered items are kept, but aren't counted
+	}
+	sd.dataHash = getHash([]byte("another"))
+	_ = sd.makePackets("another", sd.comp)
+	_, err = rc.receiveFragment(sd.packets[0].data)
+	if err != nil || len(rc.receiving) != 2 {
+		t.Fatal("0xE1F7B3", err, len(rc.receiving))
+	}
+	rc.expireItems(time.Now().Add(2 * time.Minute))
+	if len(rc.receiving) != 0 {
+		t.Error("0xE6A2C0", len(rc.receiving))
+	}
+	if n := rc.Stats().ItemsExpired; n != 1 {
+		t.Error("0xE3B9D5", "expired:", n)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (rc *Receiver) callHandler(info *ItemInfo, v []byte) (bool, error)
+//
+// go test -run Test_Receiver_callHandler_
+
+// must emit SlowHandler when the callback exceeds Config.HandlerTimeout,
+// and return early only if Config.DetachSlowHandlers is set
+func Test_Receiver_callHandler_(t *testing.T) {
+	release := make(chan struct{})
+	var events []*Event
+	rc := newRunnableReceiver()
+	rc.Config.LogWriter = nil
+	rc.Config.HandlerTimeout = 20 * time.Millisecond
+	rc.Receive = func(k string, v []byte) error {
+		if k == "slow" {
+			<-release
+		}
+		return nil
+	}
+	rc.OnEvent = func(ev *Event) { events = append(events, ev) }
+	//
+	// a callback that returns in time doesn't cause an event
+	err := rc.callReceive(&ItemInfo{Key: "fast"}, []byte("v"))
+	if err != nil || len(events) != 0 {
+		t.Error("0xE0D6C3", err, len(events))
+	}
+	// a slow callback is still waited for
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		release <- struct{}{}
+	}()
+	err = rc.callReceive(&ItemInfo{Key: "slow"}, []byte("v"))
+	if err != nil || len(events) != 1 {
+		t.Fatal("0xE7B1A9", err, len(events))
+	}
+	if events[0].Kind != SlowHandler || events[0].Key != "slow" {
+		t.Error("0xE4F8D2", events[0].Kind, events[0].Key)
+	}
+	if n := rc.Stats().ItemsDelivered; n != 2 {
+		t.Error("0xE9A3E6", "delivered:", n)
+	}
+	// unless it is detached, in which case it's counted when it returns
+	rc.Config.DetachSlowHandlers = true
+	start := time.Now()
+	err = rc.callReceive(&ItemInfo{Key: "slow"}, []byte("v"))
+	if err != nil || len(events) != 2 || time.Since(start) > time.Second {
+		t.Error("0xE2C5B8", err, len(events), time.Since(start))
+	}
+	if n := rc.Stats().ItemsDelivered; n != 2 {
+		t.Error("0xE6E0F1", "delivered:", n)
+	}
+	release <- struct{}{}
+	for i := 0; i < 100 && rc.Stats().ItemsDelivered != 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := rc.Stats().ItemsDelivered; n != 3 {
+		t.Error("0xE1B7C4", "delivered:", n)
+	}
+}
+
 // -----------------------------------------------------------------------------
 // # Logging Methods
 
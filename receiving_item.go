@@ -0,0 +1,113 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[receiving_item.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"time"
+)
+
+// defaultItemExpiry is used when Configuration.ItemExpiry is zero.
+const defaultItemExpiry = 1 * time.Minute
+
+// receivingItem is a data item being received by a Receiver. The
+// Receiver keeps them in a map by key and hash, so that several Senders,
+// or one Sender sending several items at once, can transfer data items
+// concurrently without mixing up their pieces.
+type receivingItem struct {
+	dataItem             // collects the pieces when Receive is used
+	stream   *itemStream // writes the pieces when ReceiveStream is used
+	nack     nackState   // when fragments arrive, see Config.NackDelay
+
+	// subPieces holds the parts of pieces being resent in sub-pieces
+	// (see Config.SubPieceSize), until all parts of a piece arrive
+	subPieces map[subPieceID][][]byte
+
+	// kept holds the pieces not yet written to the item's file in
+	// Config.ResumeDir, and keptBytes their total size in bytes
+	kept      []keptPiece
+	keptBytes int
+
+	// done is set once the item has been delivered, or has failed.
+	// The item is kept until it expires, to confirm packets sent again.
+	done bool
+
+	// delivered is set once the item has been delivered. Confirmations
+	// then tell Senders that resume data items that the item is complete.
+	delivered bool
+
+	// reply is the reply that the Handler made to the item once it was
+	// delivered (see ItemInfo.Reply), sent with its confirmations
+	reply []byte
+
+	// buffers are the pooled packet buffers that hold the item's
+	// pieces, recycled once it is done with them (see bufferPool)
+	buffers []*[]byte
+
+	senderID  string    // of the Sender, if Receiver.AuthTokens is used
+	started   time.Time // when the first fragment arrived
+	cancelled error     // set by Receiver.CancelAll()
+} //                                                               receivingItem
+
+// subPieceID identifies a piece being received in sub-pieces,
+// by the piece's index and the number of pieces in its layout.
+type subPieceID struct {
+	index int
+	count int
+} //                                                                  subPieceID
+
+// receivingItemID returns the key of the data item
+// with key 'k' and hash 'hash' in Receiver.receiving.
+func receivingItemID(k string, hash []byte) string {
+	return k + " " + string(hash)
+} //                                                             receivingItemID
+
+// putSubPiece stores 'data', the sub-piece with header 'h', and returns
+// the whole piece once all of its sub-pieces have arrived. Otherwise nil.
+func (it *receivingItem) putSubPiece(h *fragmentHeader, data []byte) []byte {
+	id := subPieceID{index: h.index, count: h.packetCount}
+	parts := it.subPieces[id]
+	if len(parts) != h.subCount {
+		parts = make([][]byte, h.subCount)
+	}
+	parts[h.subIndex] = data
+	if it.subPieces == nil {
+		it.subPieces = make(map[subPieceID][][]byte)
+	}
+	it.subPieces[id] = parts
+	for _, part := range parts {
+		if len(part) == 0 {
+			return nil
+		}
+	}
+	delete(it.subPieces, id)
+	return bytes.Join(parts, nil)
+} //                                                                 putSubPiece
+
+// missingPieces returns which pieces of the item haven't arrived yet,
+// or nil if it is no longer being received, or if that can't be told yet.
+func (it *receivingItem) missingPieces() []bool {
+	count := it.nack.count
+	if it.done || count == 0 {
+		return nil
+	}
+	if it.stream != nil {
+		if it.stream.finished {
+			return nil
+		}
+		return it.stream.missing(count)
+	}
+	if len(it.CompressedPieces) != count {
+		return nil
+	}
+	ret := make([]bool, count)
+	for i, piece := range it.CompressedPieces {
+		ret[i] = len(piece) == 0
+	}
+	return ret
+} //                                                               missingPieces
+
+// end
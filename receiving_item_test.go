@@ -0,0 +1,91 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /[receiving_item_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// receivingItemID(k string, hash []byte) string
+//
+// go test -run Test_receivingItemID_
+//
+func Test_receivingItemID_(t *testing.T) {
+	a := receivingItemID("key", getHash([]byte("a")))
+	if a != receivingItemID("key", getHash([]byte("a"))) {
+		t.Error("0xEF669F")
+	}
+	if a == receivingItemID("key", getHash([]byte("b"))) ||
+		a == receivingItemID("kez", getHash([]byte("a"))) {
+		t.Error("0xEDBE4A")
+	}
+}
+
+// (it *receivingItem) putSubPiece(h *fragmentHeader, data []byte) []byte
+//
+// go test -run Test_receivingItem_putSubPiece_
+//
+func Test_receivingItem_putSubPiece_(t *testing.T) {
+	var it receivingItem
+	h := fragmentHeader{index: 1, packetCount: 4, subCount: 3}
+	for i, part := range []string{"cd", "ab", "ef"} {
+		h.subIndex = []int{1, 0, 2}[i]
+		piece := it.putSubPiece(&h, []byte(part))
+		if (piece != nil) != (i == 2) {
+			t.Error("0xE2BE20", i, string(piece))
+		}
+		if piece != nil && string(piece) != "abcdef" {
+			t.Error("0xE97895", string(piece))
+		}
+	}
+	if len(it.subPieces) != 0 {
+		t.Error("0xE81AB2", len(it.subPieces))
+	}
+}
+
+// (it *receivingItem) missingPieces() []bool
+//
+// go test -run Test_receivingItem_missingPieces_
+
+// must list the pieces that haven't arrived, until the item is complete
+func Test_receivingItem_missingPieces_(t *testing.T) {
+	v := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(v)
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = 100
+	sd.dataHash = getHash(v)
+	sd.comp, _ = sd.Config.Compressor.Compress(v)
+	_ = sd.makePackets("key", sd.comp)
+	rc := newRunnableReceiver()
+	for i := 1; i < len(sd.packets); i += 2 {
+		_, err := rc.receiveFragment(sd.packets[i].data)
+		if err != nil {
+			t.Error("0xEE4E45", err)
+		}
+	}
+	it := rc.receiving[receivingItemID("key", sd.dataHash)]
+	if it == nil {
+		t.Fatal("0xE493C4", len(rc.receiving))
+	}
+	missing := it.missingPieces()
+	if len(missing) != len(sd.packets) {
+		t.Fatal("0xE6E082", len(missing))
+	}
+	for i, miss := range missing {
+		if miss != (i%2 == 0) {
+			t.Error("0xE1C954", i, miss)
+		}
+	}
+	for i := 0; i < len(sd.packets); i += 2 {
+		_, _ = rc.receiveFragment(sd.packets[i].data)
+	}
+	if missing := it.missingPieces(); missing != nil {
+		t.Error("0xECA1A5", missing)
+	}
+}
+
+// end
@@ -0,0 +1,175 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                          /[relay.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"sync"
+)
+
+// sealedMagic begins every value sealed with Sender.EndToEndKey.
+//
+// A sealed value is laid out as follows, the header being the part up
+// to and including the hash:
+//
+//	sealedMagic | flags (1 byte) | key length (2 bytes) | key |
+//	SHA-256 hash of the value | nonce + AES-256-GCM ciphertext |
+//	Ed25519 signature (only if flags has sealedSigned)
+//
+// The ciphertext is the compressed value, encrypted with the header as
+// additional authenticated data, and the signature covers everything
+// before it.
+const sealedMagic = "UDPTE2E1"
+
+// sealedSigned is the flag set in sealed values that end with a signature.
+const sealedSigned = 1
+
+// RelayTo returns a Handler for a relay: a Receiver that forwards each
+// data item it receives, under the same key, with Sender 'next', e.g.
+// from an edge site to a regional relay, then on to a core site.
+// Address 'next' to the next relay or the final Receiver.
+//
+// The relay doesn't need to know the final Receiver's EndToEndKey: items
+// sealed with Sender.EndToEndKey are forwarded as they are, so that the
+// final Receiver can still verify their hash and signature. The relay
+// only decrypts each hop with its transport CryptoKey. If forwarding
+// fails, the item isn't confirmed, so the previous hop retries it.
+// Set next.Config.DeadLetter to store items that can't be forwarded.
+//
+func RelayTo(next *Sender) Handler {
+	var mu sync.Mutex // a Sender sends one item at a time
+	return HandlerFunc(func(info *ItemInfo, v []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		err := next.Send(info.Key, v)
+		if err != nil {
+			return makeError(0xE5B7C2, "relaying to", next.Address+":", err)
+		}
+		return nil
+	})
+} //                                                                     RelayTo
+
+// seal returns value 'v' of the data item with key 'k', compressed and
+// sealed with Sender.EndToEndKey and signed with SigningKey, if given.
+// Returns 'v' as it is if the Sender has no EndToEndKey.
+func (sd *Sender) seal(k string, v []byte) ([]byte, error) {
+	if len(sd.EndToEndKey) == 0 {
+		return v, nil
+	}
+	if len(k) > 0xFFFF {
+		return nil, makeError(0xE3C4A8, "key too long to seal")
+	}
+	if sd.SigningKey != nil && len(sd.SigningKey) != ed25519.PrivateKeySize {
+		return nil, makeError(0xE8D2F1, "invalid Sender.SigningKey")
+	}
+	cphr := &aesCipher{random: lockRandom(sd.Config.Random)}
+	err := cphr.SetKey(sd.EndToEndKey)
+	if err != nil {
+		return nil, makeError(0xE1F6B3, "invalid Sender.EndToEndKey:", err)
+	}
+	comp, err := sd.Config.Compressor.Compress(v)
+	if err != nil {
+		return nil, makeError(0xE6A9D4, err)
+	}
+	var flags byte
+	if sd.SigningKey != nil {
+		flags |= sealedSigned
+	}
+	header := make([]byte, 0, len(sealedMagic)+3+len(k)+32)
+	header = append(header, sealedMagic...)
+	header = append(header, flags)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(k)))
+	header = append(header, k...)
+	header = append(header, sd.Config.hash(v)...)
+	ciphertext, err := cphr.EncryptAAD(comp, header)
+	if err != nil {
+		return nil, makeError(0xE0B8E5, err)
+	}
+	ret := append(header, ciphertext...)
+	if sd.SigningKey != nil {
+		ret = append(ret, ed25519.Sign(sd.SigningKey, ret)...)
+	}
+	return ret, nil
+} //                                                                        seal
+
+// openSealed checks the signature of sealed value 'v' against
+// Receiver.SignerKeys, if given, decrypts it with Receiver.EndToEndKey, and returns the original value
+// after checking its hash. It sets info.Hash to the original hash and
+// info.Sealed. Returns an error if 'v' isn't sealed, or if its key
+// isn't info.Key, i.e. a relay has changed the key.
+func (rc *Receiver) openSealed(info *ItemInfo, v []byte) ([]byte, error) {
+	if !bytes.HasPrefix(v, []byte(sealedMagic)) ||
+		len(v) < len(sealedMagic)+3 {
+		return nil, makeError(0xE4E0C7, "data item isn't sealed end-to-end")
+	}
+	flags := v[len(sealedMagic)]
+	at := len(sealedMagic) + 1
+	keyLen := int(binary.BigEndian.Uint16(v[at:]))
+	at += 2
+	if len(v) < at+keyLen+32 {
+		return nil, makeError(0xE9A3B6, "truncated sealed value")
+	}
+	k := string(v[at : at+keyLen])
+	hash := v[at+keyLen : at+keyLen+32]
+	header := v[:at+keyLen+32]
+	body := v[len(header):]
+	if flags&sealedSigned != 0 {
+		if len(body) < ed25519.SignatureSize {
+			return nil, makeError(0xE2C7D8, "truncated signature")
+		}
+		signed := v[:len(v)-ed25519.SignatureSize]
+		sig := v[len(signed):]
+		if len(rc.SignerKeys) > 0 && !rc.verifySigner(signed, sig) {
+			return nil, makeError(0xE7F1A2, "bad end-to-end signature")
+		}
+		body = body[:len(body)-ed25519.SignatureSize]
+	} else if len(rc.SignerKeys) > 0 {
+		return nil, makeError(0xE5D4E9, "data item isn't signed")
+	}
+	if k != info.Key {
+		return nil, makeError(0xE0A6F4, "sealed key", k,
+			"doesn't match key", info.Key)
+	}
+	cphr := &aesCipher{}
+	err := cphr.SetKey(rc.EndToEndKey)
+	if err != nil {
+		return nil, makeError(0xE8B5C1, "invalid Receiver.EndToEndKey:", err)
+	}
+	comp, err := cphr.DecryptAAD(body, header)
+	if err != nil {
+		return nil, makeError(0xE3E9A0, "can't open sealed value:", err)
+	}
+	var compressor Compression = &zlibCompressor{}
+	if rc.Config != nil && rc.Config.Compressor != nil {
+		compressor = rc.Config.Compressor
+	}
+	ret, err := compressor.Uncompress(comp)
+	if err != nil {
+		return nil, makeError(0xE6C2F5, err)
+	}
+	if !bytes.Equal(rc.Config.hash(ret), hash) {
+		return nil, makeError(0xE1D8B4, "end-to-end hash mismatch")
+	}
+	info.Hash = append([]byte(nil), hash...)
+	info.Sealed = true
+	return ret, nil
+} //                                                                  openSealed
+
+// verifySigner returns true if 'sig' is the signature
+// of 'signed' by one of the keys in Receiver.SignerKeys.
+func (rc *Receiver) verifySigner(signed, sig []byte) bool {
+	for _, pub := range rc.SignerKeys {
+		if len(pub) == ed25519.PublicKeySize &&
+			ed25519.Verify(pub, signed, sig) {
+			return true
+		}
+	}
+	return false
+} //                                                                verifySigner
+
+// end
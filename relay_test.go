@@ -0,0 +1,146 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[relay_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_relay_*
+
+// -----------------------------------------------------------------------------
+
+// RelayTo(next *Sender) Handler
+//
+// go test -run Test_relay_RelayTo_
+//
+// must forward items through a chain of relays that can't read
+// them, and the final Receiver must verify their hash and signature
+func Test_relay_RelayTo_(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("0xE1C6B9", err)
+	}
+	e2eKey := []byte("e2e-key-0123456789abcdefghijklmn")
+	value := []byte(strings.Repeat("end-to-end ", 500))
+	//
+	// core: the final Receiver, in this process
+	got := make(chan *ItemInfo, 1)
+	core := &Receiver{
+		CryptoKey:   []byte("core-transport-key-0123456789abc"),
+		EndToEndKey: e2eKey,
+		SignerKeys:  []ed25519.PublicKey{pub},
+		Handler: HandlerFunc(func(info *ItemInfo, v []byte) error {
+			if !bytes.Equal(v, value) {
+				t.Error("0xE8A2D4", "wrong value")
+			}
+			got <- info
+			return nil
+		}),
+	}
+	// regional relay: receives over UDP and forwards to the core
+	seen := 0
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	relay := Receiver{
+		Port: 9879, CryptoKey: []byte("edge-transport-key-0123456789abc"),
+		Config: cf,
+		Handler: HandlerFunc(func(info *ItemInfo, v []byte) error {
+			seen++
+			if bytes.Contains(v, []byte("end-to-end")) {
+				t.Error("0xE3F7A0", "the relay can read the value")
+			}
+			return RelayTo(&Sender{CryptoKey: core.CryptoKey,
+				LocalReceiver: core}).HandleItem(info, v)
+		}),
+	}
+	go func() { _ = relay.Run() }()
+	defer func() { relay.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	// edge: seals and signs the item
+	scf := NewDefaultConfig()
+	scf.LogWriter = nil
+	edge := Sender{Address: "127.0.0.1:9879", CryptoKey: relay.CryptoKey,
+		EndToEndKey: e2eKey, SigningKey: priv, Config: scf}
+	err = edge.Send("report", value)
+	if err != nil {
+		t.Fatal("0xE6D0B2", err)
+	}
+	select {
+	case info := <-got:
+		if info.Key != "report" || !info.Sealed ||
+			!bytes.Equal(info.Hash, getHash(value)) {
+			t.Error("0xE0B4E8", info.Key, info.Sealed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("0xE5E9C3", "not received")
+	}
+	if seen != 1 {
+		t.Error("0xE2A1F6", "relay saw", seen, "items")
+	}
+}
+
+// (rc *Receiver) openSealed(info *ItemInfo, v []byte) ([]byte, error)
+//
+// go test -run Test_relay_openSealed_
+//
+// must reject altered, unsigned, wrongly signed and unsealed items
+func Test_relay_openSealed_(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(nil)
+	sd := makeTestSender()
+	sd.EndToEndKey = []byte("e2e-key-0123456789abcdefghijklmn")
+	sd.SigningKey = priv
+	rc := newRunnableReceiver()
+	rc.EndToEndKey = sd.EndToEndKey
+	rc.SignerKeys = []ed25519.PublicKey{otherPub, pub}
+	sealed, err := sd.seal("k", []byte("value"))
+	if err != nil {
+		t.Fatal("0xE9C5A7", err)
+	}
+	test := func(k string, v []byte, errSubstr string) {
+		t.Helper()
+		info := &ItemInfo{Key: k}
+		ret, err := rc.openSealed(info, v)
+		if !matchError(err, errSubstr) {
+			t.Error("0xE4B8D1", "wrong error:", err)
+		}
+		if err == nil && (string(ret) != "value" || !info.Sealed) {
+			t.Error("0xE7E3B5", string(ret), info.Sealed)
+		}
+	}
+	test("k", sealed, "")
+	test("renamed", sealed, "doesn't match key")
+	test("k", []byte("value"), "isn't sealed end-to-end")
+	altered := append([]byte(nil), sealed...)
+	altered[len(altered)-ed25519.SignatureSize-1] ^= 1
+	test("k", altered, "bad end-to-end signature")
+	//
+	sd.SigningKey = nil
+	unsigned, _ := sd.seal("k", []byte("value"))
+	test("k", unsigned, "isn't signed")
+	sd.SigningKey = otherPriv
+	rc.SignerKeys = []ed25519.PublicKey{pub}
+	signed, _ := sd.seal("k", []byte("value"))
+	test("k", signed, "bad end-to-end signature")
+	//
+	// without SignerKeys, the sealed value still can't be altered
+	rc.SignerKeys = nil
+	test("k", signed, "")
+	altered = append([]byte(nil), unsigned...)
+	altered[len(altered)-1] ^= 1
+	test("k", altered, "can't open sealed value")
+	rc.EndToEndKey = []byte("another-key-0123456789abcdefghij")
+	test("k", unsigned, "can't open sealed value")
+}
+
+// end
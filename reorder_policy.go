@@ -0,0 +1,67 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[reorder_policy.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+// ReorderPolicy specifies how much of a data item received with
+// Receiver.ReceiveStream may arrive out of order. Pieces that arrive
+// before the pieces preceding them are kept in memory until they can
+// be written in sequence. Without a limit, a gap early in a large item
+// can make the Receiver hold most of the item in memory.
+//
+// When a piece doesn't fit in the buffer, the Receiver doesn't confirm
+// it, so the Sender sends it again once the gap has been filled. By
+// default, the Receiver then waits for the Sender to resend the gap's
+// pieces, which it does when their confirmations are overdue.
+//
+type ReorderPolicy struct {
+
+	// MaxBytes is the number of bytes of out-of-order pieces the Receiver
+	// keeps for each data item. Pieces that fill the gap are always
+	// accepted. Zero means no limit.
+	MaxBytes int
+
+	// RequestRetransmit makes the Receiver send the Sender a NACK listing
+	// the missing pieces, as soon as a piece doesn't fit in the buffer,
+	// instead of waiting for the Sender to resend them. Only one NACK is
+	// sent for each gap.
+	RequestRetransmit bool
+} //                                                               ReorderPolicy
+
+// validate returns an error if the policy's settings are invalid.
+func (rp *ReorderPolicy) validate() error {
+	if rp.MaxBytes < 0 {
+		return makeError(0xE6F0C4,
+			"invalid Configuration.StreamReorder.MaxBytes:", rp.MaxBytes)
+	}
+	return nil
+} //                                                                    validate
+
+// reorderReply returns the reply to a fragment of data item 'it' that
+// didn't fit in the reordering buffer of its stream. That is nil, so
+// that the Sender sends the fragment again, or a NACK of the missing
+// pieces if Config.StreamReorder.RequestRetransmit is set and no NACK
+// has been sent for the current gap yet.
+func (rc *Receiver) reorderReply(it *receivingItem) []byte {
+	st := it.stream
+	if rc.Config.VerboseReceiver {
+		rc.logDebug("Receiver deferred a piece of", st.key,
+			"beyond the reorder buffer")
+	}
+	if !rc.Config.StreamReorder.RequestRetransmit ||
+		(st.gapNacked && st.gapAt == st.written) {
+		return nil
+	}
+	missing := it.missingPieces()
+	if missing == nil {
+		return nil
+	}
+	maxBits := 8 * (rc.Config.PacketSizeLimit - rc.Config.headerReserve())
+	st.gapNacked, st.gapAt = true, st.written
+	return makeNack(st.key, st.hash, missing, maxBits,
+		it.nack.caps.Has(CapNackRuns))
+} //                                                                reorderReply
+
+// end
@@ -0,0 +1,125 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /[reorder_policy_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_ReorderPolicy_*
+
+// -----------------------------------------------------------------------------
+
+// (st *itemStream) putWithin(index, count int, data []byte, limit int64,
+// ) error
+//
+// go test -run Test_ReorderPolicy_putWithin_
+//
+func Test_ReorderPolicy_putWithin_(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	var buf streamBuffer
+	st := newItemStream(&fragmentHeader{hash: getHash(v)},
+		&buf, &zlibCompressor{}, nil)
+	pieces := splitTestPieces(comp, 100)
+	n := len(pieces)
+	// two pieces fit ahead of piece 0, but not a third one
+	test := func(i int, want error) {
+		t.Helper()
+		if err := st.putWithin(i, n, pieces[i], 250); err != want {
+			t.Error("0xE3D8A6", i, "wrong error:", err)
+		}
+	}
+	test(2, nil)
+	test(3, nil)
+	test(4, errReorderFull)
+	test(n-1, nil) // just a few bytes, so it fits
+	if st.buffered != int64(200+len(pieces[n-1])) || len(st.pending) != 3 ||
+		st.end != int64(len(comp)) {
+		t.Error("0xE5A6D0", st.buffered, len(st.pending), st.end)
+	}
+	// pieces that fill the gap are always accepted
+	for i := 0; i < n; i++ {
+		if err := st.putWithin(i, n, pieces[i], 250); err != nil {
+			t.Error("0xE0C9F2", i, err)
+		}
+	}
+	if !st.complete() || st.buffered != 0 {
+		t.Fatal("0xE7F4B3", st.written, st.end, st.buffered)
+	}
+	if err := st.finish(); err != nil || !bytes.Equal(buf.Bytes(), v) {
+		t.Error("0xE2E5C8", err)
+	}
+}
+
+// go test -run Test_ReorderPolicy_Receiver_
+//
+// must not confirm pieces beyond Config.StreamReorder.MaxBytes, must
+// send one NACK for each gap with RequestRetransmit, and must still
+// deliver the item once the gap is filled
+func Test_ReorderPolicy_Receiver_(t *testing.T) {
+	v := make([]byte, 3000)
+	rand.New(rand.NewSource(1)).Read(v)
+	sd := &Sender{Config: NewDefaultConfig()}
+	sd.Config.PacketPayloadSize = 100
+	sd.dataHash = getHash(v)
+	sd.comp, _ = sd.Config.Compressor.Compress(v)
+	_ = sd.makePackets("key", sd.comp)
+	n := len(sd.packets)
+	if n < 6 {
+		t.Fatal("0xE4A2B9", n)
+	}
+	for _, retransmit := range []bool{false, true} {
+		var buf streamBuffer
+		rc := newRunnableReceiver()
+		rc.Config.StreamReorder = ReorderPolicy{
+			MaxBytes:          250,
+			RequestRetransmit: retransmit,
+		}
+		rc.Receive = nil
+		rc.ReceiveStream = func(k string) (io.WriteCloser, error) {
+			return &buf, nil
+		}
+		send := func(i int) []byte {
+			reply, err := rc.receiveFragment(sd.packets[i].data)
+			if err != nil {
+				t.Error("0xE8C7D1", i, err)
+			}
+			return reply
+		}
+		for _, i := range []int{2, 3} {
+			if reply := send(i); !bytes.HasPrefix(reply, []byte(tagConfirmation)) {
+				t.Error("0xE1F0A4", retransmit, i, string(reply))
+			}
+		}
+		reply := send(4)
+		if retransmit != bytes.HasPrefix(reply, []byte(tagNack)) ||
+			(!retransmit && reply != nil) {
+			t.Error("0xE6D3E7", retransmit, "wrong reply:", string(reply))
+		}
+		if retransmit {
+			nr, err := readNack(reply)
+			if err != nil || !nr.missing(0) || !nr.missing(4) ||
+				nr.missing(2) || nr.missing(3) {
+				t.Error("0xE0B5F6", "wrong NACK:", nr, err)
+			}
+		}
+		if reply := send(5); reply != nil {
+			t.Error("0xE4E8A2", retransmit, "NACK sent again for the gap")
+		}
+		for i := 0; i < n; i++ {
+			send(i)
+		}
+		if !bytes.Equal(buf.Bytes(), v) || !buf.closed {
+			t.Error("0xE9D6B0", retransmit, buf.Len(), buf.closed)
+		}
+	}
+}
+
+// end
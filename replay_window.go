@@ -0,0 +1,274 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[replay_window.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Senders number the data packets they send (see packetSequence), inside
+// the encrypted part of each packet, so a Receiver can tell a replayed
+// packet by its number however many packets have arrived since then:
+// it remembers which of the last sequenceWindowSize numbers of each
+// Sender it has received, and drops any older ones. Each packet also
+// carries the time it was sent, which must be within
+// Configuration.MaxClockSkew of the Receiver's clock, so packets of a
+// Sender that the Receiver has forgotten can't be replayed either.
+//
+// Packets without numbers, i.e. keepalives, probes and packets from
+// Senders of earlier versions, are remembered by their hashes instead,
+// as long as there is room in the window (Configuration.ReplayWindow).
+
+// defaultReplayWindow is the default value of Configuration.ReplayWindow
+const defaultReplayWindow = 65536
+
+// sequenceWindowSize is the number of the most recent packet numbers of
+// each Sender that a Receiver remembers. It must be a multiple of 64.
+const sequenceWindowSize = 1024
+
+// replayMaxStreams is the maximum number of Senders (packet streams)
+// whose packet numbers a Receiver remembers at a time.
+const replayMaxStreams = 4096
+
+// sequenceHeaderSize is the largest number of bytes that
+// the sequence header (tagSequence) adds to a packet.
+const sequenceHeaderSize = len(tagSequence) + 3*17
+
+// packetID identifies an encrypted packet. Senders encrypt every packet
+// they send, including those they resend, with a new random nonce, so
+// the same packet arriving twice has been captured and replayed (or, in
+// rare cases, duplicated by the network).
+type packetID [16]byte
+
+// replayWindow remembers the packets that a Receiver has decrypted, to
+// detect packets received again: the numbers of the packets of each
+// Sender in 'streams', and the IDs of the last 'size' packets without
+// numbers in 'seen'. It is only used by the Receiver's read loop.
+type replayWindow struct {
+	seen map[packetID]struct{}
+	ring []packetID // the IDs in 'seen', oldest first from 'next'
+	next int        // index in 'ring' of the ID to forget next
+
+	// streams holds the packet numbers received from each Sender,
+	// by the ID of its packet stream
+	streams map[uint64]*streamWindow
+
+	// maxSkew is Configuration.MaxClockSkew. Zero disables the
+	// check of the time when each numbered packet was sent.
+	maxSkew time.Duration
+} //                                                                replayWindow
+
+// newReplayWindow returns a replayWindow that remembers 'size' packets
+// without numbers, and drops numbered packets sent at a time further
+// than 'maxSkew' from the Receiver's clock. It returns nil if 'size'
+// is zero, i.e. replays aren't detected.
+func newReplayWindow(size int, maxSkew time.Duration) *replayWindow {
+	if size < 1 {
+		return nil
+	}
+	return &replayWindow{
+		seen:    make(map[packetID]struct{}, size),
+		ring:    make([]packetID, 0, size),
+		streams: make(map[uint64]*streamWindow),
+		maxSkew: maxSkew,
+	}
+} //                                                             newReplayWindow
+
+// replayed returns true if encrypted packet 'data', which arrived at
+// time 'now' with sequence number 'sn' (nil if it has none), has been
+// received before, or if it was sent at a time too far from 'now'.
+// Otherwise it adds the packet to the window and returns false.
+func (rw *replayWindow) replayed(data []byte, sn *sequenceNumber,
+	now time.Time,
+) bool {
+	if rw == nil {
+		return false
+	}
+	if sn == nil {
+		return rw.replayedHash(data)
+	}
+	if rw.maxSkew > 0 {
+		if d := now.Sub(sn.sent); d > rw.maxSkew || d < -rw.maxSkew {
+			return true // replayed after the stream was forgotten
+		}
+	}
+	sw := rw.streams[sn.stream]
+	if sw == nil {
+		rw.makeRoom(now)
+		sw = &streamWindow{top: sn.n}
+		rw.streams[sn.stream] = sw
+	}
+	sw.last = now
+	return !sw.add(sn.n)
+} //                                                                    replayed
+
+// replayedHash is like replayed(), for packets without a sequence
+// number. When the window is full, it forgets the oldest packet.
+func (rw *replayWindow) replayedHash(data []byte) bool {
+	var id packetID
+	sum := sha256.Sum256(data)
+	copy(id[:], sum[:])
+	if _, ok := rw.seen[id]; ok {
+		return true
+	}
+	if len(rw.ring) < cap(rw.ring) {
+		rw.ring = append(rw.ring, id)
+	} else {
+		delete(rw.seen, rw.ring[rw.next])
+		rw.ring[rw.next] = id
+		rw.next = (rw.next + 1) % len(rw.ring)
+	}
+	rw.seen[id] = struct{}{}
+	return false
+} //                                                                replayedHash
+
+// makeRoom makes room for a new stream when 'streams' is full, by
+// forgetting the streams that have been idle for so long that their
+// packets are no longer accepted anyway (twice 'maxSkew'), or else
+// the stream that has been idle the longest.
+func (rw *replayWindow) makeRoom(now time.Time) {
+	if len(rw.streams) < replayMaxStreams {
+		return
+	}
+	var oldest uint64
+	var oldestTime time.Time
+	for id, sw := range rw.streams {
+		if rw.maxSkew > 0 && now.Sub(sw.last) > 2*rw.maxSkew {
+			delete(rw.streams, id)
+			continue
+		}
+		if oldestTime.IsZero() || sw.last.Before(oldestTime) {
+			oldest, oldestTime = id, sw.last
+		}
+	}
+	if len(rw.streams) >= replayMaxStreams {
+		delete(rw.streams, oldest)
+	}
+} //                                                                    makeRoom
+
+// -----------------------------------------------------------------------------
+
+// streamWindow is a sliding window of the last sequenceWindowSize packet
+// numbers of a Sender's packet stream: bit n%sequenceWindowSize of 'bits'
+// is set if packet number n, from top-sequenceWindowSize+1 to top, has
+// been received.
+type streamWindow struct {
+	top  uint64
+	bits [sequenceWindowSize / 64]uint64
+	last time.Time // when the last packet of the stream arrived
+} //                                                                streamWindow
+
+// add records packet number 'n' as received and returns true, unless
+// it has been received already or is older than the window.
+func (sw *streamWindow) add(n uint64) bool {
+	word := &sw.bits[n/64%uint64(len(sw.bits))]
+	bit := uint64(1) << (n % 64)
+	switch {
+	case n > sw.top:
+		if n-sw.top >= sequenceWindowSize {
+			sw.bits = [sequenceWindowSize / 64]uint64{}
+		} else {
+			for i := sw.top + 1; i < n; i++ { // forget numbers below the window
+				sw.bits[i/64%uint64(len(sw.bits))] &^= 1 << (i % 64)
+			}
+		}
+		sw.top = n
+	case sw.top-n >= sequenceWindowSize:
+		return false // older than the window
+	case *word&bit != 0:
+		return false
+	}
+	*word |= bit
+	return true
+} //                                                                         add
+
+// -----------------------------------------------------------------------------
+
+// sequenceNumber is the number a Sender gives to a packet: the ID of the
+// Sender's packet stream, the number of the packet in it, and the time
+// when it was sent.
+type sequenceNumber struct {
+	stream uint64
+	n      uint64
+	sent   time.Time
+} //                                                              sequenceNumber
+
+// readSequence returns packet 'recv' without its sequence header, and
+// the sequence number in it, or 'recv' itself and nil if it has none.
+func readSequence(recv []byte) ([]byte, *sequenceNumber, error) {
+	if !bytes.HasPrefix(recv, []byte(tagSequence)) {
+		return recv, nil, nil
+	}
+	end := bytes.IndexByte(recv, '\n')
+	if end == -1 {
+		return nil, nil, makeError(0xE4B7D1, "bad sequence header")
+	}
+	fields := bytes.Fields(recv[len(tagSequence):end])
+	if len(fields) != 3 {
+		return nil, nil, makeError(0xE1F5C8, "bad sequence header")
+	}
+	var nums [3]uint64
+	for i, field := range fields {
+		n, err := strconv.ParseUint(string(field), 16, 64)
+		if err != nil {
+			return nil, nil, makeError(0xE7C8B3, "bad sequence header:", err)
+		}
+		nums[i] = n
+	}
+	sn := sequenceNumber{
+		stream: nums[0],
+		sent:   time.Unix(0, int64(nums[1])),
+		n:      nums[2],
+	}
+	return recv[end+1:], &sn, nil
+} //                                                                readSequence
+
+// -----------------------------------------------------------------------------
+
+// packetSequence numbers the packets that a Sender sends. Its stream
+// ID is chosen at random when the first packet is numbered.
+type packetSequence struct {
+	once   sync.Once
+	stream uint64
+	next   uint64 // the last number given, accessed atomically
+} //                                                              packetSequence
+
+// prefix returns packet 'data' with a sequence header
+// giving it the next number and send time 'now'.
+func (ps *packetSequence) prefix(data []byte, now time.Time) []byte {
+	ps.once.Do(func() {
+		var buf [8]byte
+		_, _ = rand.Read(buf[:]) // never fails (see crypto/rand)
+		ps.stream = binary.BigEndian.Uint64(buf[:])
+	})
+	n := atomic.AddUint64(&ps.next, 1)
+	ret := make([]byte, 0, sequenceHeaderSize+len(data))
+	ret = fmt.Appendf(ret, "%s%X %X %X\n", tagSequence, ps.stream,
+		now.UnixNano(), n)
+	return append(ret, data...)
+} //                                                                      prefix
+
+// sequencedCipher wraps the cipher with which a Sender encrypts its
+// data packets, to number each packet with 'seq' before encrypting it.
+type sequencedCipher struct {
+	SymmetricCipher
+	seq *packetSequence
+} //                                                             sequencedCipher
+
+// Encrypt numbers 'plaintext' and encrypts it.
+func (sc sequencedCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	return sc.SymmetricCipher.Encrypt(sc.seq.prefix(plaintext, time.Now()))
+} //                                                                     Encrypt
+
+// end
@@ -0,0 +1,138 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /[replay_window_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_replayWindow_*
+
+// -----------------------------------------------------------------------------
+
+// (rw *replayWindow) replayed(data []byte, sn *sequenceNumber,
+// now time.Time) bool
+//
+// go test -run Test_replayWindow_replayed_*
+
+// must detect packets without numbers seen within the window,
+// and forget the oldest packets once the window is full
+func Test_replayWindow_replayed_1(t *testing.T) {
+	packet := func(n int) []byte { return []byte("packet " + strconv.Itoa(n)) }
+	replayed := func(rw *replayWindow, data []byte) bool {
+		return rw.replayed(data, nil, time.Now())
+	}
+	rw := newReplayWindow(3, 0)
+	for n := 1; n <= 3; n++ {
+		if replayed(rw, packet(n)) {
+			t.Error("0xE2F8A4", "new packet", n, "seen as replayed")
+		}
+	}
+	for n := 1; n <= 3; n++ {
+		if !replayed(rw, packet(n)) {
+			t.Error("0xE8B1D6", "replayed packet", n, "not detected")
+		}
+	}
+	// packet 4 pushes packet 1 out of the window, 5 pushes out 2
+	if replayed(rw, packet(4)) || replayed(rw, packet(5)) {
+		t.Error("0xE5D3C0", "new packet seen as replayed")
+	}
+	if replayed(rw, packet(1)) {
+		t.Error("0xE0A7E2", "packet 1 should have been forgotten")
+	}
+	if !replayed(rw, packet(5)) || len(rw.seen) != 3 {
+		t.Error("0xE7C4B9", len(rw.seen))
+	}
+	// a zero window detects nothing
+	rw = newReplayWindow(0, 0)
+	if rw != nil || replayed(rw, packet(1)) || replayed(rw, packet(1)) {
+		t.Error("0xE3E9F5", "zero window detected a replay")
+	}
+}
+
+// must detect numbered packets received again however many packets
+// have arrived since, drop those older than the window or sent at a
+// time too far from the Receiver's clock, and tell streams apart
+func Test_replayWindow_replayed_2(t *testing.T) {
+	now := time.Now()
+	rw := newReplayWindow(3, time.Minute)
+	sn := func(stream, n uint64) *sequenceNumber {
+		return &sequenceNumber{stream: stream, n: n, sent: now}
+	}
+	for n := uint64(1); n <= 3*sequenceWindowSize; n++ {
+		if n == 5 {
+			continue // lost, and arriving late
+		}
+		if rw.replayed(nil, sn(1, n), now) {
+			t.Fatal("0xE5A1E9", "new packet", n, "seen as replayed")
+		}
+	}
+	if !rw.replayed(nil, sn(1, 3*sequenceWindowSize), now) ||
+		!rw.replayed(nil, sn(1, 2*sequenceWindowSize+1), now) {
+		t.Error("0xE2E7D3", "replayed packet not detected")
+	}
+	// packets 5 and 2*sequenceWindowSize are below the window
+	if !rw.replayed(nil, sn(1, 5), now) ||
+		!rw.replayed(nil, sn(1, 2*sequenceWindowSize), now) {
+		t.Error("0xE6B5C4", "packet below the window accepted")
+	}
+	// a late packet within the window is accepted once
+	rw.replayed(nil, sn(1, 3*sequenceWindowSize+10), now)
+	if rw.replayed(nil, sn(1, 3*sequenceWindowSize+5), now) ||
+		!rw.replayed(nil, sn(1, 3*sequenceWindowSize+5), now) {
+		t.Error("0xE0C9D7", "late packet not accepted once")
+	}
+	// other streams have windows of their own
+	if rw.replayed(nil, sn(2, 1), now) || !rw.replayed(nil, sn(2, 1), now) {
+		t.Error("0xE4F8A1", "other stream")
+	}
+	// packets sent too long ago, or in the future, are dropped
+	stale := &sequenceNumber{stream: 3, n: 1, sent: now.Add(-2 * time.Minute)}
+	early := &sequenceNumber{stream: 3, n: 2, sent: now.Add(2 * time.Minute)}
+	if !rw.replayed(nil, stale, now) || !rw.replayed(nil, early, now) ||
+		rw.streams[3] != nil {
+		t.Error("0xE9B3C7", "packet sent at a wrong time accepted")
+	}
+}
+
+// readSequence(recv []byte) ([]byte, *sequenceNumber, error)
+//
+// (ps *packetSequence) prefix(data []byte, now time.Time) []byte
+//
+// go test -run Test_readSequence_
+//
+// must read the sequence numbers that packetSequence gives to
+// packets, and return packets without a sequence header as they are
+func Test_readSequence_(t *testing.T) {
+	var ps packetSequence
+	now := time.Now()
+	for n := uint64(1); n <= 3; n++ {
+		recv := ps.prefix([]byte("FRAG:data"), now)
+		if len(recv) > sequenceHeaderSize+len("FRAG:data") {
+			t.Error("0xE1D6E2", "header too long:", string(recv))
+		}
+		got, sn, err := readSequence(recv)
+		if err != nil || string(got) != "FRAG:data" || sn == nil ||
+			sn.stream != ps.stream || sn.n != n || !sn.sent.Equal(now) {
+			t.Error("0xE7A2F5", err, string(got), sn)
+		}
+	}
+	got, sn, err := readSequence([]byte("KEEP:"))
+	if err != nil || sn != nil || !bytes.Equal(got, []byte("KEEP:")) {
+		t.Error("0xE3C8D1", err, sn)
+	}
+	for _, bad := range []string{"SEQN:1 2 3", "SEQN:1 2\n", "SEQN:1 2 X\n"} {
+		if _, _, err := readSequence([]byte(bad)); err == nil {
+			t.Error("0xE8E4B6", "accepted", bad)
+		}
+	}
+}
+
+// end
@@ -0,0 +1,123 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                          /[reply.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// MaxReplySize is the largest reply, in bytes, that a Handler can
+// return to the Sender of a data item (see ItemInfo.Reply), so that
+// it fits in a confirmation packet along with its other fields.
+const MaxReplySize = 1024
+
+// confirmationReplyField is the field of a confirmation packet in which
+// the Receiver returns the reply of its Handler to a Sender that
+// advertises CapReplies. It follows the confirmed hash, and is followed
+// by the length of the reply in 4 hexadecimal digits, then the reply.
+const confirmationReplyField = "reply:"
+
+// RespondFunc returns a Handler that calls 'respond' with the key and
+// value of each data item, and returns the reply it makes to the Sender,
+// e.g. an ID or a status in JSON, for RPC-like exchanges in which the
+// Sender calls SendWithReply(), e.g.:
+//
+//	rc.Handler = udpt.RespondFunc(func(k string, v []byte) ([]byte, error) {
+//		id, err := store(k, v)
+//		return []byte(id), err
+//	})
+//
+func RespondFunc(respond func(k string, v []byte) ([]byte, error)) Handler {
+	return HandlerFunc(func(info *ItemInfo, v []byte) error {
+		reply, err := respond(info.Key, v)
+		info.Reply = reply
+		return err
+	})
+} //                                                                 RespondFunc
+
+// SendWithReply transfers a key-value to the Receiver like Send(), and
+// returns the reply its Handler made (see ItemInfo.Reply), which is
+// nil if the Handler made none, or if the Receiver is a version of
+// this package that doesn't return replies (see CapReplies).
+func (sd *Sender) SendWithReply(k string, v []byte) ([]byte, error) {
+	return sd.SendContextWithReply(context.Background(), k, v)
+} //                                                               SendWithReply
+
+// SendContextWithReply transfers a key-value like SendWithReply(),
+// but stops as soon as 'ctx' is cancelled, like SendContext().
+func (sd *Sender) SendContextWithReply(ctx context.Context, k string,
+	v []byte,
+) ([]byte, error) {
+	err := sd.sendContext(ctx, k, v, nil)
+	if err != nil {
+		return nil, err
+	}
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	return sd.reply, nil
+} //                                                        SendContextWithReply
+
+// setReply sets the reply to the data item being sent.
+func (sd *Sender) setReply(reply []byte) {
+	sd.mu.Lock()
+	sd.reply = reply
+	sd.mu.Unlock()
+} //                                                                    setReply
+
+// itemReply returns the reply that the Handler made to data item 'info',
+// or nil if it made none, or a reply longer than MaxReplySize.
+func (rc *Receiver) itemReply(info *ItemInfo) []byte {
+	if len(info.Reply) > MaxReplySize {
+		_ = rc.logError(0xE3C8A5, "reply to", info.Key, "has",
+			len(info.Reply), "bytes; MaxReplySize is", MaxReplySize)
+		return nil
+	}
+	if len(info.Reply) == 0 {
+		return nil
+	}
+	return append([]byte(nil), info.Reply...)
+} //                                                                   itemReply
+
+// markConfirmationReply adds 'reply' to confirmation 'conf', after
+// the confirmed hash. 'reply' must not be longer than MaxReplySize.
+func markConfirmationReply(conf, reply []byte) []byte {
+	at := len(tagConfirmation) + 32
+	ret := make([]byte, 0,
+		len(conf)+len(confirmationReplyField)+4+len(reply))
+	ret = append(ret, conf[:at]...)
+	ret = append(ret, confirmationReplyField...)
+	ret = append(ret, fmt.Sprintf("%04x", len(reply))...)
+	ret = append(ret, reply...)
+	return append(ret, conf[at:]...)
+} //                                                       markConfirmationReply
+
+// splitConfirmationReply returns confirmation packet 'recv' without
+// its reply field (see markConfirmationReply), and the reply, which
+// is nil if 'recv' has no reply field.
+func splitConfirmationReply(recv []byte) (conf, reply []byte) {
+	at := len(tagConfirmation) + 32
+	if !bytes.HasPrefix(recv, []byte(tagConfirmation)) || len(recv) < at ||
+		!bytes.HasPrefix(recv[at:], []byte(confirmationReplyField)) {
+		return recv, nil
+	}
+	start := at + len(confirmationReplyField) + 4
+	if len(recv) < start {
+		return recv, nil // readConfirmation() reports the bad field
+	}
+	size, err := strconv.ParseUint(string(recv[start-4:start]), 16, 16)
+	end := start + int(size)
+	if err != nil || end > len(recv) {
+		return recv, nil
+	}
+	reply = append([]byte(nil), recv[start:end]...)
+	conf = append(append([]byte(nil), recv[:at]...), recv[end:]...)
+	return conf, reply
+} //                                                      splitConfirmationReply
+
+// end
@@ -0,0 +1,107 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                     /[reply_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_reply_*
+
+// -----------------------------------------------------------------------------
+
+// markConfirmationReply(conf, reply []byte) []byte
+// splitConfirmationReply(recv []byte) (conf, reply []byte)
+//
+// go test -run Test_reply_confirmation_
+//
+// must carry any bytes as a reply, even ones that look like other
+// confirmation fields, without changing how the fields are read
+func Test_reply_confirmation_(t *testing.T) {
+	hash := getHash([]byte("abc"))
+	conf := markConfirmationCaps(makeConfirmation(hash, 5000), CapReplies)
+	conf = markConfirmationDone(conf)
+	for _, reply := range []string{"id:42", "caps:ff", "rate:1done", "done"} {
+		recv := markConfirmationReply(conf, []byte(reply))
+		gotHash, rate, err := readConfirmation(recv)
+		if err != nil || !bytes.Equal(gotHash, hash) || rate != 5000 {
+			t.Error("0xE7B4D2", reply, err, rate)
+		}
+		if caps, ok := confirmationCaps(recv); !ok || caps != CapReplies {
+			t.Error("0xE9A6F1", reply, caps, ok)
+		}
+		if !confirmsDone(recv) {
+			t.Error("0xE2F5C8", reply, "done marker lost")
+		}
+		rest, got := splitConfirmationReply(recv)
+		if string(got) != reply || !bytes.Equal(rest, conf) {
+			t.Error("0xE6D1A4", "got:", string(got), "want:", reply)
+		}
+	}
+	// must not report a reply in confirmations without one
+	recv := makeConfirmation(hash, 0)
+	if _, got := splitConfirmationReply(recv); got != nil {
+		t.Error("0xE4E9B7", "unexpected reply:", got)
+	}
+	if !confirmsDone(markConfirmationReply(markConfirmationDone(recv),
+		[]byte("x"))) || confirmsDone(markConfirmationReply(recv,
+		[]byte("done"))) {
+		t.Error("0xE8C2F6", "wrong done marker")
+	}
+}
+
+// (sd *Sender) SendWithReply(k string, v []byte) ([]byte, error)
+//
+// go test -run Test_reply_SendWithReply_
+//
+// must return the reply made by the Receiver's Handler, over the
+// network and through the loopback shortcut, and no reply that is
+// longer than MaxReplySize
+func Test_reply_SendWithReply_(t *testing.T) {
+	key := []byte("reply-key-0123456789abcdefghijkl")
+	rc := Receiver{Port: 9859, CryptoKey: key, Config: NewDefaultConfig(),
+		Handler: RespondFunc(func(k string, v []byte) ([]byte, error) {
+			if k == "huge" {
+				return make([]byte, MaxReplySize+1), nil
+			}
+			return []byte(fmt.Sprintf(`{"key":%q,"size":%d}`, k, len(v))),
+				nil
+		}),
+	}
+	rc.Config.LogWriter = nil
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	sd := Sender{Address: "127.0.0.1:9859", CryptoKey: key, Config: cf}
+	for _, size := range []int{10, 50000} {
+		got, err := sd.SendWithReply("item", bytes.Repeat([]byte("v"), size))
+		want := fmt.Sprintf(`{"key":"item","size":%d}`, size)
+		if err != nil || string(got) != want {
+			t.Error("0xE1D7B9", size, err, "got:", string(got))
+		}
+	}
+	got, err := sd.SendWithReply("huge", []byte("v"))
+	if err != nil || got != nil {
+		t.Error("0xE5B3C4", err, "got:", len(got), "bytes")
+	}
+	if err := sd.Send("k", []byte("v")); err != nil {
+		t.Error("0xE0F6D8", err)
+	}
+	local := Sender{LocalReceiver: &rc, CryptoKey: key, Config: cf}
+	got, err = local.SendWithReply("local", []byte("abc"))
+	if err != nil || string(got) != `{"key":"local","size":3}` {
+		t.Error("0xE7C9A2", err, "got:", string(got))
+	}
+}
+
+// end
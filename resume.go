@@ -0,0 +1,390 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                         /[resume.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// resumeFieldTag is the fragment header field with which a Sender
+// resuming data items (Config.ResumeTransfers) asks the Receiver to
+// mark its confirmations with confirmationDoneField once the data
+// item is complete.
+const resumeFieldTag = "resume:1 "
+
+// resumeFileExt is the extension of the files in which
+// a Receiver keeps the pieces of incomplete data items.
+const resumeFileExt = ".udpt-part"
+
+// resumeFileExpiry is the age after which a Receiver deletes the
+// files of data items that no Sender resumed, when it starts running.
+const resumeFileExpiry = 24 * time.Hour
+
+// resumeTokenLimit is the maximum number of resume tokens kept by a
+// Sender. The oldest ones are discarded when it is exceeded.
+const resumeTokenLimit = 64
+
+// defaultResumeFlushBytes is the default of Config.ResumeFlushBytes.
+const defaultResumeFlushBytes = 256 * 1024
+
+// resumeToken records which pieces of a data item the Receiver had
+// confirmed when the Sender failed to deliver it, so that sending the
+// same item again resumes from the missing pieces.
+type resumeToken struct {
+	count     int       // number of pieces in the item's layout
+	delivered []bool    // pieces confirmed by the Receiver
+	saved     time.Time // when the token was saved
+} //                                                                 resumeToken
+
+// -----------------------------------------------------------------------------
+// # Sender
+
+// saveResumeToken records which pieces of the current data item have
+// been delivered, if Config.ResumeTransfers is enabled and any were.
+func (sd *Sender) saveResumeToken() {
+	if !sd.Config.ResumeTransfers || sd.countDelivered() == 0 {
+		return
+	}
+	sd.packetsMu.Lock()
+	tk := &resumeToken{
+		count:     len(sd.packets),
+		delivered: make([]bool, len(sd.packets)),
+		saved:     time.Now(),
+	}
+	for i := range sd.packets {
+		tk.delivered[i] = sd.packets[i].IsDelivered()
+	}
+	sd.packetsMu.Unlock()
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.resume == nil {
+		sd.resume = make(map[string]*resumeToken)
+	}
+	for len(sd.resume) >= resumeTokenLimit {
+		oldest := ""
+		for id, old := range sd.resume {
+			if oldest == "" || old.saved.Before(sd.resume[oldest].saved) {
+				oldest = id
+			}
+		}
+		delete(sd.resume, oldest)
+	}
+	sd.resume[receivingItemID(sd.key, sd.dataHash)] = tk
+} //                                                             saveResumeToken
+
+// applyResumeToken marks the packets of the current data item that the
+// Receiver confirmed in an earlier, failed Send of the same item, so
+// that they are not sent in the first round. At least one packet is
+// always sent, so that the Receiver reports on the item.
+//
+// The token is discarded, since it is replaced if this Send fails too.
+// It is ignored if the item has since been split into another number
+// of packets.
+//
+func (sd *Sender) applyResumeToken() {
+	id := receivingItemID(sd.key, sd.dataHash)
+	sd.mu.Lock()
+	tk := sd.resume[id]
+	delete(sd.resume, id)
+	sd.mu.Unlock()
+	sd.packetsMu.Lock()
+	defer sd.packetsMu.Unlock()
+	if tk == nil || tk.count != len(sd.packets) {
+		return
+	}
+	skipped, last := 0, -1
+	for i, delivered := range tk.delivered {
+		if delivered {
+			sd.packets[i].resumed = true
+			skipped++
+			last = i
+		}
+	}
+	if skipped == len(sd.packets) {
+		sd.packets[last].resumed = false
+		skipped--
+	}
+	if sd.Config.VerboseSender {
+		sd.logDebug("Resuming", sd.key, "without", skipped, "of",
+			len(sd.packets), "packets")
+	}
+} //                                                            applyResumeToken
+
+// clearResumed makes the packets skipped by applyResumeToken() eligible
+// for sending again, after the Receiver had a round to report them.
+func (sd *Sender) clearResumed() {
+	sd.packetsMu.Lock()
+	for i := range sd.packets {
+		sd.packets[i].resumed = false
+	}
+	sd.packetsMu.Unlock()
+} //                                                                clearResumed
+
+// receiveDone marks every packet of the current data item as delivered,
+// when the Receiver confirms that it has the complete item, including
+// the packets skipped by applyResumeToken().
+func (sd *Sender) receiveDone() {
+	now := time.Now()
+	var delivered []*senderPacket
+	sd.packetsMu.Lock()
+	for i := range sd.packets {
+		pk := &sd.packets[i]
+		if pk.IsDelivered() {
+			continue
+		}
+		pk.confirmedTime = now
+		pk.confirmedHash = pk.sentHash
+		delivered = append(delivered, pk)
+	}
+	sd.packetsMu.Unlock()
+	for _, pk := range delivered {
+		sd.pieceDelivered(pk)
+	}
+} //                                                                 receiveDone
+
+// confirmsCurrentItem returns true if 'hash' is the
+// hash of a packet of the data item being sent.
+func (sd *Sender) confirmsCurrentItem(hash []byte) bool {
+	sd.packetsMu.Lock()
+	defer sd.packetsMu.Unlock()
+	for i := range sd.packets {
+		if sd.packets[i].confirmedBy(hash) != nil {
+			return true
+		}
+	}
+	return false
+} //                                                         confirmsCurrentItem
+
+// -----------------------------------------------------------------------------
+// # Receiver
+
+// resumeFilePath returns the path of the file in directory 'dir' in which
+// the pieces of the data item with key 'k' and hash 'hash' are kept.
+func resumeFilePath(dir, k string, hash []byte) string {
+	sum := sha256.Sum256([]byte(receivingItemID(k, hash)))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+resumeFileExt)
+} //                                                              resumeFilePath
+
+// resumeFileHeader returns the first line of the file
+// in which the pieces of a data item are kept.
+func resumeFileHeader(k string, hash []byte) string {
+	return fmt.Sprintf("udpt-part key:%s hash:%X\n", k, hash)
+} //                                                            resumeFileHeader
+
+// keptPiece is a piece of a data item that a Receiver
+// hasn't written to the item's file in Config.ResumeDir yet.
+type keptPiece struct {
+	count int // number of pieces in the layout of the piece
+	index int // 0-based index of the piece in its layout
+	data  []byte
+} //                                                                   keptPiece
+
+// appendResumePieces appends 'pieces' of the data item with key 'k' and
+// hash 'hash' to the file at 'path' in one write, creating the file if
+// needed. Each piece is written as its layout's number of pieces, its
+// index and its length (as uvarints) followed by its bytes. The pieces
+// are sorted by layout and index, so that contiguous pieces are kept
+// together.
+func appendResumePieces(path, k string, hash []byte, pieces []keptPiece,
+) error {
+	sort.Slice(pieces, func(i, j int) bool {
+		a, b := pieces[i], pieces[j]
+		return a.count < b.count || (a.count == b.count && a.index < b.index)
+	})
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return makeError(0xE2E6B4, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return makeError(0xE6C1F0, err)
+	}
+	var rec []byte
+	if info.Size() == 0 {
+		rec = []byte(resumeFileHeader(k, hash))
+	}
+	for _, pc := range pieces {
+		rec = binary.AppendUvarint(rec, uint64(pc.count))
+		rec = binary.AppendUvarint(rec, uint64(pc.index))
+		rec = binary.AppendUvarint(rec, uint64(len(pc.data)))
+		rec = append(rec, pc.data...)
+	}
+	_, err = file.Write(rec)
+	if err != nil {
+		_ = file.Close()
+		return makeError(0xE9A3D5, err)
+	}
+	err = file.Close()
+	if err != nil {
+		return makeError(0xE3F8B2, err)
+	}
+	return nil
+} //                                                          appendResumePieces
+
+// loadResumePieces reads the pieces written by appendResumePieces() to
+// the file at 'path', provided they belong to the data item with key
+// 'k' and hash 'hash' split into 'count' pieces. Returns nil if there
+// is no such file. A piece cut short, e.g. by a crash while it was
+// being written, is ignored.
+func loadResumePieces(path, k string, hash []byte, count int,
+) ([][]byte, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, makeError(0xE8D0C7, err)
+	}
+	defer file.Close()
+	rd := bufio.NewReader(file)
+	header, err := rd.ReadString('\n')
+	if err != nil || header != resumeFileHeader(k, hash) {
+		return nil, nil // another item with the same file name, or damaged
+	}
+	var pieces [][]byte
+	for {
+		n, err := binary.ReadUvarint(rd)
+		if err != nil {
+			break
+		}
+		index, err := binary.ReadUvarint(rd)
+		if err != nil || index >= n {
+			break
+		}
+		size, err := binary.ReadUvarint(rd)
+		if err != nil || size > uint64(1<<31) {
+			break
+		}
+		piece := make([]byte, size)
+		_, err = io.ReadFull(rd, piece)
+		if err != nil {
+			break
+		}
+		if n != uint64(count) {
+			continue // a piece of another layout of the item
+		}
+		if pieces == nil {
+			pieces = make([][]byte, count)
+		}
+		pieces[index] = piece
+	}
+	return pieces, nil
+} //                                                            loadResumePieces
+
+// removeStaleResumeFiles deletes the files in directory 'dir' in which
+// pieces of data items were kept, if they haven't changed since 'before'.
+func removeStaleResumeFiles(dir string, before time.Time) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return makeError(0xE0D9A6, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), resumeFileExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		err = os.Remove(filepath.Join(dir, entry.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return makeError(0xE7B2E1, err)
+		}
+	}
+	return nil
+} //                                                      removeStaleResumeFiles
+
+// restorePieces loads the pieces of the data item 'it' with header 'h'
+// that an earlier run of the Receiver kept in Config.ResumeDir.
+func (rc *Receiver) restorePieces(it *receivingItem, h *fragmentHeader) {
+	path := resumeFilePath(rc.Config.ResumeDir, h.key, h.hash)
+	pieces, err := loadResumePieces(path, h.key, h.hash, h.packetCount)
+	if err != nil {
+		_ = rc.logError(0xE4A8C2, err)
+		return
+	}
+	restored := 0
+	for _, piece := range pieces {
+		if len(piece) > 0 {
+			restored++
+		}
+	}
+	if restored == 0 {
+		return
+	}
+	it.dataItem.Retain(h.key, h.hash, h.packetCount)
+	copy(it.CompressedPieces, pieces)
+	if rc.Config.VerboseReceiver {
+		rc.logDebug("Receiver restored", restored, "of", h.packetCount,
+			"pieces of", h.key)
+	}
+} //                                                               restorePieces
+
+// keepPiece adds 'piece', with header 'h', to the pieces of data item
+// 'it' to write to its file in Config.ResumeDir, and writes them once
+// they reach Config.ResumeFlushBytes. Does nothing without ResumeDir.
+func (rc *Receiver) keepPiece(it *receivingItem, h *fragmentHeader,
+	piece []byte,
+) {
+	if rc.Config.ResumeDir == "" {
+		return
+	}
+	it.kept = append(it.kept, keptPiece{
+		count: h.packetCount,
+		index: h.index,
+		data:  piece,
+	})
+	it.keptBytes += len(piece)
+	limit := rc.Config.ResumeFlushBytes
+	if limit == 0 {
+		limit = defaultResumeFlushBytes
+	}
+	if it.keptBytes >= limit {
+		rc.flushPieces(it)
+	}
+} //                                                                   keepPiece
+
+// flushPieces writes the pieces kept by keepPiece() for data item 'it'
+// to its file in Config.ResumeDir. They are discarded if this fails,
+// since the Sender sends them again if the item is resumed.
+func (rc *Receiver) flushPieces(it *receivingItem) {
+	if len(it.kept) == 0 {
+		return
+	}
+	di := &it.dataItem
+	path := resumeFilePath(rc.Config.ResumeDir, di.Key, di.Hash)
+	err := appendResumePieces(path, di.Key, di.Hash, it.kept)
+	if err != nil {
+		_ = rc.logError(0xE5C3B9, err)
+	}
+	it.kept, it.keptBytes = nil, 0
+} //                                                                 flushPieces
+
+// dropPieces discards the pieces of data item 'it', with key 'k' and
+// hash 'hash', that were kept in Config.ResumeDir or are still to be.
+func (rc *Receiver) dropPieces(it *receivingItem, k string, hash []byte) {
+	if rc.Config.ResumeDir == "" {
+		return
+	}
+	it.kept, it.keptBytes = nil, 0
+	err := os.Remove(resumeFilePath(rc.Config.ResumeDir, k, hash))
+	if err != nil && !os.IsNotExist(err) {
+		_ = rc.logError(0xE1D7A4, err)
+	}
+} //                                                                  dropPieces
+
+// end
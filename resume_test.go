@@ -0,0 +1,306 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[resume_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_resume_*
+
+// -----------------------------------------------------------------------------
+
+// appendResumePieces(path, k string, hash []byte, pieces []keptPiece,
+// ) error
+// loadResumePieces(path, k string, hash []byte, count int,
+// ) ([][]byte, error)
+//
+// go test -run Test_resume_pieces_
+//
+func Test_resume_pieces_(t *testing.T) {
+	hash := getHash([]byte("value"))
+	path := resumeFilePath(t.TempDir(), "key", hash)
+	//
+	pieces, err := loadResumePieces(path, "key", hash, 3)
+	if pieces != nil || err != nil {
+		t.Error("0xE4C2A7", "missing file must load nothing:", pieces, err)
+	}
+	for _, kept := range [][]keptPiece{
+		{{count: 3, index: 2, data: []byte("c")}},
+		{{count: 4, index: 1, data: []byte("x")},
+			{count: 3, index: 0, data: []byte("a")}},
+	} {
+		err = appendResumePieces(path, "key", hash, kept)
+		if err != nil {
+			t.Fatal("0xE7A0D3", err)
+		}
+	}
+	pieces, err = loadResumePieces(path, "key", hash, 3)
+	if err != nil || len(pieces) != 3 || string(pieces[0]) != "a" ||
+		pieces[1] != nil || string(pieces[2]) != "c" {
+		t.Error("0xE1F6B8", "wrong pieces:", pieces, err)
+	}
+	// only the pieces of the requested layout must be loaded
+	pieces, _ = loadResumePieces(path, "key", hash, 4)
+	if len(pieces) != 4 || string(pieces[1]) != "x" || pieces[0] != nil {
+		t.Error("0xE9B3C1", "wrong pieces of another layout:", pieces)
+	}
+	pieces, _ = loadResumePieces(path, "key", hash, 5)
+	if pieces != nil {
+		t.Error("0xE6A2F8", "loaded a layout not kept:", pieces)
+	}
+	pieces, _ = loadResumePieces(path, "other", hash, 3)
+	if pieces != nil {
+		t.Error("0xE5D8E4", "loaded another item:", pieces)
+	}
+	// a piece cut short must be ignored
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal("0xE2A9F5", err)
+	}
+	_, _ = file.Write([]byte{3, 1, 10, 'x'})
+	_ = file.Close()
+	pieces, err = loadResumePieces(path, "key", hash, 3)
+	if err != nil || pieces[1] != nil || string(pieces[2]) != "c" {
+		t.Error("0xE6E4A0", "wrong pieces:", pieces, err)
+	}
+}
+
+// removeStaleResumeFiles(dir string, before time.Time) error
+//
+// go test -run Test_resume_removeStaleResumeFiles_
+//
+func Test_resume_removeStaleResumeFiles_(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale"+resumeFileExt)
+	fresh := filepath.Join(dir, "fresh"+resumeFileExt)
+	other := filepath.Join(dir, "other.txt")
+	for _, path := range []string{stale, fresh, other} {
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal("0xE3B7C9", err)
+		}
+	}
+	old := time.Now().Add(-2 * resumeFileExpiry)
+	_ = os.Chtimes(stale, old, old)
+	_ = os.Chtimes(other, old, old)
+	//
+	err := removeStaleResumeFiles(dir, time.Now().Add(-resumeFileExpiry))
+	if err != nil {
+		t.Error("0xE8C5D3", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("0xE0F1B6", "stale file not removed")
+	}
+	for _, path := range []string{fresh, other} {
+		if _, err := os.Stat(path); err != nil {
+			t.Error("0xE7D9A3", "removed", path)
+		}
+	}
+}
+
+// markConfirmationDone(reply []byte) []byte
+// confirmsDone(recv []byte) bool
+//
+// go test -run Test_resume_confirmationDone_
+//
+func Test_resume_confirmationDone_(t *testing.T) {
+	hash := getHash([]byte("abc"))
+	for _, rate := range []int64{0, 1000} {
+		reply := makeConfirmation(hash, rate)
+		if confirmsDone(reply) {
+			t.Error("0xE2C8F4", "unmarked confirmation is done")
+		}
+		reply = markConfirmationDone(reply)
+		if !confirmsDone(reply) {
+			t.Error("0xE5A0B7", "marked confirmation isn't done")
+		}
+		gotHash, gotRate, err := readConfirmation(reply)
+		if err != nil || !bytes.Equal(gotHash, hash) || gotRate != rate {
+			t.Error("0xE9E3C0", "wrong confirmation:", gotHash, gotRate, err)
+		}
+	}
+}
+
+// (sd *Sender) saveResumeToken()
+// (sd *Sender) applyResumeToken()
+//
+// go test -run Test_resume_resumeToken_
+//
+func Test_resume_resumeToken_(t *testing.T) {
+	newSender := func(resume bool) *Sender {
+		sd := makeTestSender()
+		sd.Config.VerboseSender = false
+		sd.Config.ResumeTransfers = resume
+		sd.key = "key"
+		sd.dataHash = getHash([]byte("value"))
+		err := sd.splitPackets("key", bytes.Repeat([]byte("x"), 2000), 500)
+		if err != nil {
+			t.Fatal("0xE4D1E8", err)
+		}
+		return sd
+	}
+	deliver := func(sd *Sender, indexes ...int) {
+		for _, i := range indexes {
+			pk := &sd.packets[i]
+			pk.confirmedHash = pk.sentHash
+		}
+	}
+	resumed := func(sd *Sender) (ret []int) {
+		for i := range sd.packets {
+			if sd.packets[i].resumed {
+				ret = append(ret, i)
+			}
+		}
+		return ret
+	}
+	// tokens are only kept with Config.ResumeTransfers
+	sd := newSender(false)
+	deliver(sd, 0, 2)
+	sd.saveResumeToken()
+	if len(sd.resume) != 0 {
+		t.Error("0xE1A5C3", "token saved without ResumeTransfers")
+	}
+	// the delivered packets are skipped once, then the token is gone
+	sd = newSender(true)
+	deliver(sd, 0, 2)
+	sd.saveResumeToken()
+	sd.resetConfirmations()
+	sd.applyResumeToken()
+	if got := resumed(sd); len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Error("0xE6B2D9", "wrong resumed packets:", got)
+	}
+	if len(sd.resume) != 0 {
+		t.Error("0xE0C7E5", "token not discarded")
+	}
+	sd.clearResumed()
+	if got := resumed(sd); len(got) != 0 {
+		t.Error("0xE3F4A1", "packets still resumed:", got)
+	}
+	// one packet is always sent, even if all were delivered
+	deliver(sd, 0, 1, 2, 3)
+	sd.saveResumeToken()
+	sd.resetConfirmations()
+	sd.applyResumeToken()
+	if got := resumed(sd); len(got) != len(sd.packets)-1 {
+		t.Error("0xE8A6F0", "wrong resumed packets:", got)
+	}
+	// receiveDone() delivers every packet, including skipped ones
+	sd.receiveDone()
+	if n := sd.countDelivered(); n != len(sd.packets) {
+		t.Error("0xE2E9B4", "delivered", n, "of", len(sd.packets))
+	}
+}
+
+// go test -run Test_resume_Receiver_
+//
+// must deliver a data item from the pieces kept by an earlier Receiver
+// and the pieces sent to a new one, and mark the confirmation as done
+func Test_resume_Receiver_(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	sd := makeTestSender()
+	sd.Config.ResumeTransfers = true
+	sd.key = "key"
+	sd.dataHash = getHash(v)
+	err := sd.splitPackets("key", comp, 100)
+	if err != nil {
+		t.Fatal("0xE7C0A8", err)
+	}
+	dir := t.TempDir()
+	var received []byte
+	newReceiver := func() *Receiver {
+		cf := NewDefaultConfig()
+		cf.ResumeDir = dir
+		cf.ResumeFlushBytes = 1
+		return &Receiver{Config: cf, Receive: func(k string, v []byte) error {
+			received = v
+			return nil
+		}}
+	}
+	n := len(sd.packets)
+	rc := newReceiver()
+	for i := 0; i < n-1; i++ {
+		reply, err := rc.receiveFragment(sd.packets[i].data)
+		if err != nil || confirmsDone(reply) {
+			t.Fatal("0xE4B9D6", i, err)
+		}
+	}
+	rc = newReceiver() // e.g. after a restart
+	reply, err := rc.receiveFragment(sd.packets[n-1].data)
+	if err != nil {
+		t.Fatal("0xE9D2F7", err)
+	}
+	if !bytes.Equal(received, v) {
+		t.Error("0xE5F8C4", "wrong value received")
+	}
+	if !confirmsDone(reply) {
+		t.Error("0xE0A3E9", "confirmation not marked as done")
+	}
+	path := resumeFilePath(dir, "key", getHash(v))
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("0xE3C6B1", "pieces not deleted after delivery")
+	}
+}
+
+// (rc *Receiver) keepPiece(it *receivingItem, h *fragmentHeader,
+//     piece []byte,
+// )
+//
+// go test -run Test_resume_keepPiece_
+//
+// must write the kept pieces in one write, once they
+// reach Config.ResumeFlushBytes, or when flushed
+func Test_resume_keepPiece_(t *testing.T) {
+	dir := t.TempDir()
+	hash := getHash([]byte("value"))
+	path := resumeFilePath(dir, "key", hash)
+	cf := NewDefaultConfig()
+	cf.ResumeDir = dir
+	cf.ResumeFlushBytes = 6
+	rc := Receiver{Config: cf}
+	it := &receivingItem{}
+	it.dataItem.Retain("key", hash, 4)
+	keep := func(index int, data string) {
+		h := &fragmentHeader{key: "key", hash: hash, index: index,
+			packetCount: 4}
+		rc.keepPiece(it, h, []byte(data))
+	}
+	written := func() [][]byte {
+		pieces, _ := loadResumePieces(path, "key", hash, 4)
+		return pieces
+	}
+	keep(2, "cc")
+	keep(0, "aa")
+	if written() != nil {
+		t.Error("0xE0D5B8", "pieces written before ResumeFlushBytes")
+	}
+	keep(3, "dd")
+	if pieces := written(); string(pieces[0]) != "aa" ||
+		string(pieces[2]) != "cc" || string(pieces[3]) != "dd" {
+		t.Error("0xE4E1A9", "wrong pieces written:", pieces)
+	}
+	keep(1, "bb")
+	if pieces := written(); pieces[1] != nil {
+		t.Error("0xE8F6C2", "piece written before ResumeFlushBytes")
+	}
+	rc.flushPieces(it)
+	if pieces := written(); string(pieces[1]) != "bb" || it.kept != nil {
+		t.Error("0xE2C3D0", "pieces not flushed:", pieces)
+	}
+	// pieces must not be written once the item is delivered
+	keep(1, "bb")
+	rc.dropPieces(it, "key", hash)
+	rc.flushPieces(it)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("0xE7B0E4", "pieces written after delivery")
+	}
+}
+
+// end
@@ -0,0 +1,132 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[retry_policy.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// RetryPolicy decides how long a Sender waits, after a round of sending
+// the packets of a data item, before it resends the packets that haven't
+// been confirmed. Set Configuration.RetryPolicy to use it. BackoffRetry
+// is the default, and FixedRetry gives deterministic delays for tests.
+// The methods may be called concurrently, by several Senders.
+type RetryPolicy interface {
+
+	// RetryDelay returns the delay before resend round 'round' of a data
+	// item, starting from 1. 'rtt' is the smoothed round-trip time to
+	// the Receiver, measured from its confirmations, or zero if none
+	// have been measured yet.
+	RetryDelay(round int, rtt time.Duration) time.Duration
+} //                                                                 RetryPolicy
+
+// FixedRetry is a RetryPolicy that always waits the same time.
+type FixedRetry time.Duration
+
+// RetryDelay implements RetryPolicy.RetryDelay() and returns 'fr'.
+func (fr FixedRetry) RetryDelay(round int, rtt time.Duration) time.Duration {
+	return time.Duration(fr)
+} //                                                                  RetryDelay
+
+// BackoffRetry is a RetryPolicy with exponential backoff driven by the
+// round-trip time: the first delay is twice the RTT, or Initial before
+// the RTT has been measured, and it doubles with every further round,
+// within the range from Min to Max. A random jitter of up to +/- 50%
+// is applied to each delay, so that Senders that lost packets at the
+// same moment don't all resend them at the same moment.
+type BackoffRetry struct {
+
+	// Initial is the first delay before the RTT is known.
+	Initial time.Duration
+
+	// Min and Max limit the delays. A zero Max means no limit.
+	Min time.Duration
+	Max time.Duration
+
+	// Random, if specified, is the source of the jitter,
+	// instead of math/rand. See Configuration.Random.
+	Random io.Reader
+} //                                                                BackoffRetry
+
+// RetryDelay implements RetryPolicy.RetryDelay().
+func (br *BackoffRetry) RetryDelay(round int, rtt time.Duration,
+) time.Duration {
+	delay := br.Initial
+	if rtt > 0 {
+		delay = 2 * rtt
+	}
+	if delay < br.Min {
+		delay = br.Min
+	}
+	for i := 1; i < round; i++ {
+		if br.Max > 0 && delay >= br.Max || delay > math.MaxInt64/4 {
+			break
+		}
+		delay *= 2
+	}
+	if br.Max > 0 && delay > br.Max {
+		delay = br.Max
+	}
+	if delay > 1 {
+		delay = delay/2 + time.Duration(randomInt63n(br.Random, int64(delay)))
+	}
+	return delay
+} //                                                                  RetryDelay
+
+// minRetryDelay is the default BackoffRetry.Min, which
+// stops RTTs measured on fast links from causing busy loops
+const minRetryDelay = 10 * time.Millisecond
+
+// retryPolicy returns Config.RetryPolicy or, if it isn't specified,
+// a BackoffRetry that starts from Config.SendRetryInterval and backs
+// off up to 8 times that. If SendRetryInterval is zero, the Sender
+// resends packets without waiting.
+func (sd *Sender) retryPolicy() RetryPolicy {
+	cf := sd.Config
+	if cf.RetryPolicy != nil {
+		return cf.RetryPolicy
+	}
+	if cf.SendRetryInterval <= 0 {
+		return FixedRetry(0)
+	}
+	min := minRetryDelay
+	if min > cf.SendRetryInterval {
+		min = cf.SendRetryInterval
+	}
+	return &BackoffRetry{Initial: cf.SendRetryInterval, Min: min,
+		Max: 8 * cf.SendRetryInterval, Random: cf.Random}
+} //                                                                 retryPolicy
+
+// updateRTT adds round-trip time 'rtt', measured from a confirmation, to
+// the smoothed RTT of the Receiver at Sender.Address, like TCP does.
+// The smoothed RTT is shared with the Senders of SendMany().
+func (sd *Sender) updateRTT(rtt time.Duration) {
+	owner := sd.owner()
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	if owner.rttAddr != sd.Address || owner.srtt == 0 {
+		owner.rttAddr = sd.Address
+		owner.srtt = rtt
+		return
+	}
+	owner.srtt += (rtt - owner.srtt) / 8
+} //                                                                   updateRTT
+
+// smoothedRTT returns the smoothed RTT of the Receiver
+// at Sender.Address, or zero if it hasn't been measured.
+func (sd *Sender) smoothedRTT() time.Duration {
+	owner := sd.owner()
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	if owner.rttAddr != sd.Address {
+		return 0
+	}
+	return owner.srtt
+} //                                                                 smoothedRTT
+
+// end
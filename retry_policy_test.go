@@ -0,0 +1,106 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[retry_policy_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_RetryPolicy_*
+
+// -----------------------------------------------------------------------------
+
+// (br *BackoffRetry) RetryDelay(round int, rtt time.Duration,
+// ) time.Duration
+//
+// go test -run Test_RetryPolicy_BackoffRetry_
+//
+// must start from Initial or twice the RTT, double the delay every
+// round within Min and Max, and apply the jitter
+func Test_RetryPolicy_BackoffRetry_(t *testing.T) {
+	ms := time.Millisecond
+	// reading zeros gives the lowest jitter: half of each delay
+	br := &BackoffRetry{Initial: 100 * ms, Min: 10 * ms, Max: 400 * ms,
+		Random: bytes.NewReader(make([]byte, 1000))}
+	test := func(round int, rtt, want time.Duration) {
+		t.Helper()
+		if got := br.RetryDelay(round, rtt); got != want {
+			t.Error("0xE4B9D2", "round", round, "rtt", rtt, "got", got,
+				"want", want)
+		}
+	}
+	test(1, 0, 50*ms)
+	test(2, 0, 100*ms)
+	test(1, 30*ms, 30*ms)
+	test(2, 30*ms, 60*ms)
+	test(1, 1*ms, 5*ms) // limited by Min
+	test(4, 0, 200*ms)  // limited by Max
+	test(9, 0, 200*ms)
+	//
+	// without Random, the jitter stays within +/- 50%
+	br.Random = nil
+	for i := 0; i < 100; i++ {
+		if d := br.RetryDelay(1, 0); d < 50*ms || d >= 150*ms {
+			t.Error("0xE1F6A3", d)
+		}
+	}
+	if d := FixedRetry(70*ms).RetryDelay(5, 30*ms); d != 70*ms {
+		t.Error("0xE7C2B8", d)
+	}
+}
+
+// (sd *Sender) retryPolicy() RetryPolicy
+//
+// go test -run Test_RetryPolicy_retryPolicy_
+//
+func Test_RetryPolicy_retryPolicy_(t *testing.T) {
+	sd := makeTestSender()
+	sd.Config.SendRetryInterval = 0
+	if rp := sd.retryPolicy(); rp != FixedRetry(0) {
+		t.Error("0xE3A0E5", rp)
+	}
+	sd.Config.SendRetryInterval = 250 * time.Millisecond
+	br, ok := sd.retryPolicy().(*BackoffRetry)
+	if !ok || br.Initial != 250*time.Millisecond ||
+		br.Min != minRetryDelay || br.Max != 2*time.Second {
+		t.Error("0xE9D4C7", br)
+	}
+	sd.Config.RetryPolicy = FixedRetry(time.Second)
+	if rp := sd.retryPolicy(); rp != FixedRetry(time.Second) {
+		t.Error("0xE6E8B1", rp)
+	}
+}
+
+// (sd *Sender) updateRTT(rtt time.Duration)
+//
+// go test -run Test_RetryPolicy_updateRTT_
+//
+// must smooth the RTT of each Receiver, sharing it with SendMany()
+func Test_RetryPolicy_updateRTT_(t *testing.T) {
+	sd := makeTestSender()
+	if rtt := sd.smoothedRTT(); rtt != 0 {
+		t.Error("0xE0B5F4", rtt)
+	}
+	sd.updateRTT(80 * time.Millisecond)
+	sd.itemSender().updateRTT(160 * time.Millisecond)
+	if rtt := sd.smoothedRTT(); rtt != 90*time.Millisecond {
+		t.Error("0xE5C1A9", rtt)
+	}
+	// another Receiver's RTT is measured anew
+	sd.Address = "127.0.0.1:9999"
+	if rtt := sd.smoothedRTT(); rtt != 0 {
+		t.Error("0xE2F7D6", rtt)
+	}
+	sd.updateRTT(20 * time.Millisecond)
+	if rtt := sd.smoothedRTT(); rtt != 20*time.Millisecond {
+		t.Error("0xE8A3C0", rtt)
+	}
+}
+
+// end
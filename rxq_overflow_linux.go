@@ -0,0 +1,83 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /[rxq_overflow_linux.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build linux
+
+package udpt
+
+import (
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"syscall"
+)
+
+// overflowConn is a UDP connection with the SO_RXQ_OVFL socket option
+// set, so that the kernel reports with each datagram how many datagrams
+// it has dropped because the socket's receive buffer was full. ReadFrom
+// adds the newly dropped datagrams to the counter at 'dropped'.
+type overflowConn struct {
+	*net.UDPConn
+	oob     []byte
+	last    uint32 // the kernel's last reported count, for this socket
+	dropped *int64 // updated atomically
+} //                                                                overflowConn
+
+// watchOverflows sets the SO_RXQ_OVFL socket option of 'conn' and
+// returns a connection that counts the datagrams dropped by the kernel
+// in 'dropped'. If the option can't be set, it returns 'conn' as it is.
+func watchOverflows(conn *net.UDPConn, dropped *int64) netUDPConn {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return conn
+	}
+	var errOpt error
+	err = raw.Control(func(fd uintptr) {
+		errOpt = syscall.SetsockoptInt(int(fd),
+			syscall.SOL_SOCKET, syscall.SO_RXQ_OVFL, 1)
+	})
+	if err != nil || errOpt != nil {
+		return conn
+	}
+	return &overflowConn{
+		UDPConn: conn,
+		oob:     make([]byte, syscall.CmsgSpace(4)),
+		dropped: dropped,
+	}
+} //                                                              watchOverflows
+
+// ReadFrom reads a datagram like net.UDPConn.ReadFrom(), and counts
+// the datagrams the kernel has dropped since the previous one.
+func (oc *overflowConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, oobn, _, addr, err := oc.ReadMsgUDP(b, oc.oob)
+	if count, ok := parseRxqOverflow(oc.oob[:oobn]); ok {
+		// the count wraps around, so the difference is still correct
+		atomic.AddInt64(oc.dropped, int64(count-oc.last))
+		oc.last = count
+	}
+	if addr == nil {
+		return n, nil, err // avoid non-nil interface with nil value
+	}
+	return n, addr, err
+} //                                                                    ReadFrom
+
+// parseRxqOverflow returns the kernel's count of dropped datagrams from
+// the SO_RXQ_OVFL control message in 'oob'. The kernel only sends it
+// once datagrams have been dropped.
+func parseRxqOverflow(oob []byte) (count uint32, ok bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, false
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level == syscall.SOL_SOCKET &&
+			msg.Header.Type == syscall.SO_RXQ_OVFL && len(msg.Data) >= 4 {
+			return binary.NativeEndian.Uint32(msg.Data), true
+		}
+	}
+	return 0, false
+} //                                                            parseRxqOverflow
+
+// end
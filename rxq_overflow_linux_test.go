@@ -0,0 +1,62 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                        /[rxq_overflow_linux_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build linux
+
+package udpt
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// (oc *overflowConn) ReadFrom(b []byte) (int, net.Addr, error)
+//
+// go test -run Test_overflowConn_ReadFrom_
+
+// must count the datagrams dropped when the receive buffer is full
+func Test_overflowConn_ReadFrom_(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("0xEE2133", err)
+	}
+	var dropped int64
+	rd := watchOverflows(conn, &dropped)
+	defer rd.Close()
+	if _, ok := rd.(*overflowConn); !ok {
+		t.Fatal("0xEE680C", "SO_RXQ_OVFL not set")
+	}
+	_ = conn.SetReadBuffer(4096) // the kernel's minimum
+	sender, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal("0xE2C645", err)
+	}
+	defer sender.Close()
+	packet := make([]byte, 1000)
+	for i := 0; i < 200; i++ {
+		_, _ = sender.Write(packet)
+	}
+	// the kernel reports the drops with the next datagram it queues
+	buf := make([]byte, 2000)
+	received := 0
+	for {
+		_ = rd.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		if _, _, err := rd.ReadFrom(buf); err != nil {
+			break
+		}
+		received++
+	}
+	_, _ = sender.Write(packet)
+	_ = rd.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := rd.ReadFrom(buf); err == nil {
+		received++
+	}
+	if received < 2 || dropped == 0 || received+int(dropped) != 201 {
+		t.Error("0xECD8BF", received, dropped)
+	}
+}
+
+// end
@@ -0,0 +1,20 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /[rxq_overflow_other.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build !linux
+
+package udpt
+
+import (
+	"net"
+)
+
+// watchOverflows returns 'conn' as it is on this platform, where
+// the kernel doesn't report the datagrams it drops.
+func watchOverflows(conn *net.UDPConn, dropped *int64) netUDPConn {
+	return conn
+} //                                                              watchOverflows
+
+// end
@@ -0,0 +1,84 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[send_budget.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"time"
+)
+
+// sendBudget keeps track of the time limits that apply while sending
+// one data item: Config.FirstReplyTimeout, Config.StallTimeout and
+// Config.ItemTimeout. Unlike Config.ReplyTimeout, which only limits
+// each wait for confirmations, these limits fail the Send.
+type sendBudget struct {
+	itemStart    time.Time // when Send began sending the item
+	attemptStart time.Time // when the current attempt began
+	lastProgress time.Time // when a new packet was last confirmed
+	delivered    int       // number of packets confirmed at lastProgress
+	replied      bool      // set when the first packet is confirmed
+} //                                                                  sendBudget
+
+// beginItem starts the budget of a new data item at time 'now'.
+func (bd *sendBudget) beginItem(now time.Time) {
+	bd.itemStart = now
+	bd.beginAttempt(now)
+} //                                                                   beginItem
+
+// beginAttempt starts a new attempt to deliver the
+// item (see Config.ItemRetry) at time 'now'.
+func (bd *sendBudget) beginAttempt(now time.Time) {
+	bd.attemptStart = now
+	bd.lastProgress = now
+	bd.delivered = 0
+	bd.replied = false
+} //                                                                beginAttempt
+
+// update records that 'delivered' packets have been confirmed
+// by time 'now'. Returns true if that number has increased.
+func (bd *sendBudget) update(delivered int, now time.Time) bool {
+	if delivered <= bd.delivered {
+		// fewer packets after they've been resplit to a smaller MTU
+		bd.delivered = delivered
+		return false
+	}
+	bd.delivered = delivered
+	bd.lastProgress = now
+	bd.replied = true
+	return true
+} //                                                                      update
+
+// check returns ErrItemTimeout, ErrNoFirstReply or ErrTransferStalled
+// if the corresponding limit in 'cf' has been exceeded by time 'now'.
+// Limits set to zero are not checked.
+func (bd *sendBudget) check(cf *Configuration, now time.Time) error {
+	if cf.ItemTimeout > 0 && now.Sub(bd.itemStart) >= cf.ItemTimeout {
+		return ErrItemTimeout
+	}
+	if !bd.replied {
+		if cf.FirstReplyTimeout > 0 &&
+			now.Sub(bd.attemptStart) >= cf.FirstReplyTimeout {
+			return ErrNoFirstReply
+		}
+		return nil
+	}
+	if cf.StallTimeout > 0 && now.Sub(bd.lastProgress) >= cf.StallTimeout {
+		return ErrTransferStalled
+	}
+	return nil
+} //                                                                       check
+
+// timeLeft returns the time left before Config.ItemTimeout at time
+// 'now', which is zero or less once it has passed, and false if
+// ItemTimeout is zero, i.e. there is no limit.
+func (bd *sendBudget) timeLeft(cf *Configuration, now time.Time,
+) (time.Duration, bool) {
+	if cf.ItemTimeout <= 0 {
+		return 0, false
+	}
+	return cf.ItemTimeout - now.Sub(bd.itemStart), true
+} //                                                                    timeLeft
+
+// end
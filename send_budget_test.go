@@ -0,0 +1,60 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[send_budget_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"testing"
+	"time"
+)
+
+// (bd *sendBudget) check(cf *Configuration, now time.Time) error
+//
+// go test -run Test_sendBudget_check_
+//
+func Test_sendBudget_check_(t *testing.T) {
+	cf := &Configuration{
+		FirstReplyTimeout: 2 * time.Second,
+		StallTimeout:      3 * time.Second,
+		ItemTimeout:       10 * time.Second,
+	}
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(secs int) time.Time {
+		return t0.Add(time.Duration(secs) * time.Second)
+	}
+	var bd sendBudget
+	bd.beginItem(t0)
+	if err := bd.check(cf, at(1)); err != nil {
+		t.Error("0xE6C0AD", err)
+	}
+	if err := bd.check(cf, at(2)); err != ErrNoFirstReply {
+		t.Error("0xE3EC3C", "wrong error:", err)
+	}
+	// progress resets the stall timer, and no progress doesn't
+	if !bd.update(1, at(1)) || bd.update(1, at(3)) || !bd.update(2, at(4)) {
+		t.Error("0xEAEA09")
+	}
+	if err := bd.check(cf, at(6)); err != nil {
+		t.Error("0xE07079", err)
+	}
+	if err := bd.check(cf, at(7)); err != ErrTransferStalled {
+		t.Error("0xE69DA1", "wrong error:", err)
+	}
+	// a new attempt waits for the first reply again,
+	// but the item's deadline stays where it was
+	bd.beginAttempt(at(8))
+	if err := bd.check(cf, at(9)); err != nil {
+		t.Error("0xE1D10B", err)
+	}
+	if err := bd.check(cf, at(10)); err != ErrItemTimeout {
+		t.Error("0xE669E3", "wrong error:", err)
+	}
+	// zero limits are never exceeded
+	if err := bd.check(&Configuration{}, at(1000)); err != nil {
+		t.Error("0xE46381", err)
+	}
+}
+
+// end
@@ -0,0 +1,186 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[send_directory.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DirectoryOptions contains options for Sender.SendDirectory().
+// The zero value sends every file in the directory tree.
+type DirectoryOptions struct {
+
+	// Prefix is prepended to the relative path of each file to make the
+	// key of its data item, e.g. "backup/" sends "a/b.txt" with the key
+	// "backup/a/b.txt", which WriteToDirectory() writes to that path.
+	Prefix string
+
+	// Ignore holds patterns in the syntax of filepath.Match. Files and
+	// directories whose names match any of them are not sent. Names
+	// that begin with a dot are always ignored, as by DirWatcher.
+	Ignore []string
+
+	// OnFile, if specified, is called once each file has been sent or
+	// has failed. It isn't called concurrently.
+	OnFile func(res FileResult)
+} //                                                            DirectoryOptions
+
+// FileResult is the outcome of sending one file with SendDirectory().
+type FileResult struct {
+	Path    string        // path within the directory, with forward slashes
+	Key     string        // key of the data item sent
+	Size    int64         // size of the file in bytes
+	Elapsed time.Duration // time it took to send the file
+	Err     error         // why the file wasn't delivered, or nil
+} //                                                                  FileResult
+
+// DirectoryResult is the outcome of Sender.SendDirectory().
+type DirectoryResult struct {
+	Files   []FileResult  // the files found, in lexical order
+	Sent    int           // number of files delivered
+	Failed  int           // number of files not delivered
+	Bytes   int64         // total size of the files delivered
+	Elapsed time.Duration // time it took to send all the files
+} //                                                             DirectoryResult
+
+// SendDirectory walks the directory tree at 'dir' and sends each regular
+// file in it to the Receiver specified by Sender.Address, as SendFile()
+// does, with the key made from its path within 'dir'. Assign the
+// function returned by WriteToDirectory() to Receiver.Receive, to
+// write the files to the same relative paths, with their metadata.
+//
+// Like SendMany(), it keeps up to Config.MaxItemsInFlight files in
+// flight at once, each read into memory, and CancelAll() cancels the
+// files being sent and those still waiting.
+//
+// Returns the result of each file, and the errors of the files that
+// failed, joined by errors.Join(), or nil if all were delivered.
+// Returns a nil result if 'dir' can't be read.
+//
+func (sd *Sender) SendDirectory(dir string, opts *DirectoryOptions,
+) (*DirectoryResult, error) {
+	if sd.Config == nil {
+		sd.Config = NewDefaultConfig()
+	}
+	if opts == nil {
+		opts = &DirectoryOptions{}
+	}
+	t0 := time.Now()
+	files, err := listDirectoryFiles(dir, opts.Ignore)
+	if err != nil {
+		return nil, sd.logError(0xE2D6C9, err)
+	}
+	return sd.sendFiles(files, opts, t0, func(
+		ctx context.Context, isd *Sender, rel, k string,
+	) (int64, error) {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		return isd.sendFile(ctx, path, k)
+	})
+} //                                                               SendDirectory
+
+// sendFiles sends the files at the relative paths 'files' with 'send',
+// each with its own item Sender (see itemSender), keeping up to
+// Config.MaxItemsInFlight files in flight, and reports them as
+// SendDirectory() does. 't0' is when the sending began.
+func (sd *Sender) sendFiles(files []string, opts *DirectoryOptions,
+	t0 time.Time, send func(
+		ctx context.Context, isd *Sender, rel, k string,
+	) (int64, error),
+) (*DirectoryResult, error) {
+	n := sd.Config.MaxItemsInFlight
+	if n == 0 {
+		n = defaultMaxItemsInFlight
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	defer sd.addActive(nil, cancel)() // cancels the files not yet started
+	ret := &DirectoryResult{Files: make([]FileResult, len(files))}
+	var mu sync.Mutex // serializes OnFile
+	workers := newWorkerPool(n)
+	for i, rel := range files {
+		i, rel := i, rel
+		res := &ret.Files[i]
+		res.Path = rel
+		res.Key = opts.Prefix + rel
+		workers.run(func() {
+			started := time.Now()
+			isd := sd.itemSender()
+			res.Size, res.Err = send(ctx, isd, rel, res.Key)
+			res.Elapsed = time.Since(started)
+			sd.addItemStats(isd)
+			if res.Err != nil {
+				res.Err = makeError(0xE9C4B1, "file", rel+":", res.Err)
+			}
+			if opts.OnFile != nil {
+				mu.Lock()
+				opts.OnFile(*res)
+				mu.Unlock()
+			}
+		})
+	}
+	workers.wait()
+	errs := make([]error, 0, len(files))
+	for _, res := range ret.Files {
+		if res.Err != nil {
+			ret.Failed++
+			errs = append(errs, res.Err)
+			continue
+		}
+		ret.Sent++
+		ret.Bytes += res.Size
+	}
+	ret.Elapsed = time.Since(t0)
+	// the files overlap, so the transfer time is the time they all took
+	sd.mu.Lock()
+	sd.stats.transferTime += ret.Elapsed
+	sd.mu.Unlock()
+	return ret, errors.Join(errs...)
+} //                                                                   sendFiles
+
+// listDirectoryFiles returns the paths of the regular files in the
+// directory tree at 'dir', relative to 'dir' and with forward slashes,
+// in lexical order, leaving out the names ignored by ignoredName().
+func listDirectoryFiles(dir string, ignore []string) ([]string, error) {
+	var ret []string
+	err := filepath.WalkDir(dir, func(
+		path string, de fs.DirEntry, err error,
+	) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			if !de.IsDir() {
+				return makeError(0xE5A8F3, "not a directory:", dir)
+			}
+			return nil
+		}
+		if ignoredName(de.Name(), ignore) {
+			if de.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if de.Type().IsRegular() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			ret = append(ret, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+} //                                                          listDirectoryFiles
+
+// end
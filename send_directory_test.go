@@ -0,0 +1,96 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /[send_directory_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// (sd *Sender) SendDirectory(dir string, opts *DirectoryOptions,
+// ) (*DirectoryResult, error)
+//
+// go test -run Test_Sender_SendDirectory_
+//
+func Test_Sender_SendDirectory_(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	write := func(name, data string) {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal("0xE6C1A8", err)
+		}
+	}
+	write("a.txt", "1")
+	write("sub/b.txt", "22")
+	write("sub/deep/c.txt", "333")
+	write("fail.txt", "4444")
+	write("skip.tmp", "5")
+	write(".hidden/d.txt", "6")
+	//
+	var mu sync.Mutex
+	writeFile := WriteToDirectory(dst)
+	sd := makeTestSender()
+	sd.Config.VerboseSender = false
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive: func(k string, v []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if strings.HasSuffix(k, "fail.txt") {
+				return makeError(0xE3B9D4, "refused")
+			}
+			return writeFile(k, v)
+		},
+	}
+	var reported []string
+	res, err := sd.SendDirectory(src, &DirectoryOptions{
+		Prefix: "in/",
+		Ignore: []string{"*.tmp"},
+		OnFile: func(res FileResult) {
+			reported = append(reported, res.Path)
+		},
+	})
+	if !matchError(err, "file fail.txt:") {
+		t.Error("0xE0E6B2", "wrong error:", err)
+	}
+	if res == nil {
+		t.Fatal("0xE8A2C7", "nil result")
+	}
+	var paths []string
+	for _, fr := range res.Files {
+		paths = append(paths, fr.Path)
+		if fr.Key != "in/"+fr.Path || (fr.Err != nil) != (fr.Path == "fail.txt") {
+			t.Error("0xE5F0D3", "wrong result:", fr)
+		}
+	}
+	if got := strings.Join(paths, " "); got !=
+		"a.txt fail.txt sub/b.txt sub/deep/c.txt" {
+		t.Error("0xE2C7E9", "wrong files:", got)
+	}
+	if res.Sent != 3 || res.Failed != 1 || res.Bytes != 6 ||
+		len(reported) != 4 {
+		t.Error("0xE9D4A0", res.Sent, res.Failed, res.Bytes, reported)
+	}
+	for name, want := range map[string]string{
+		"in/a.txt": "1", "in/sub/b.txt": "22", "in/sub/deep/c.txt": "333",
+	} {
+		data, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil || string(data) != want {
+			t.Error("0xE4B8F1", name, string(data), err)
+		}
+	}
+	// must fail without a result if the directory can't be read
+	res, err = sd.SendDirectory(filepath.Join(src, "a.txt"), nil)
+	if res != nil || !matchError(err, "not a directory") {
+		t.Error("0xE7A3C5", "wrong error:", err)
+	}
+}
+
+// end
@@ -0,0 +1,118 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                        /[send_fs.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// SendFS sends the regular files in file system 'fsys' whose names match
+// any of 'patterns' to the Receiver specified by Sender.Address, as
+// SendDirectory() does, so that files can be sent from an embed.FS, a
+// zip.Reader, or any other fs.FS, without writing them to temporary
+// files. The key of each file's data item is opts.Prefix followed by
+// its name in 'fsys'.
+//
+// The patterns are in the syntax of fs.Glob, e.g. "*.html" or
+// "static/*/*.css". Directories that match are sent with all the
+// files in them. With no patterns, all the files in 'fsys' are sent.
+// Names that begin with a dot, or match opts.Ignore, are left out.
+//
+// Returns the result of each file, and the errors of the files that
+// failed, joined by errors.Join(), or nil if all were delivered.
+// Returns a nil result if a pattern is malformed or 'fsys' can't
+// be read.
+//
+func (sd *Sender) SendFS(fsys fs.FS, patterns []string,
+	opts *DirectoryOptions,
+) (*DirectoryResult, error) {
+	if sd.Config == nil {
+		sd.Config = NewDefaultConfig()
+	}
+	if opts == nil {
+		opts = &DirectoryOptions{}
+	}
+	t0 := time.Now()
+	files, err := listFSFiles(fsys, patterns, opts.Ignore)
+	if err != nil {
+		return nil, sd.logError(0xE3C9A6, err)
+	}
+	return sd.sendFiles(files, opts, t0, func(
+		ctx context.Context, isd *Sender, name, k string,
+	) (int64, error) {
+		return isd.sendFSFile(ctx, fsys, name, k)
+	})
+} //                                                                      SendFS
+
+// sendFSFile sends the file 'name' in 'fsys' with key 'k' like
+// sendFile(), within context 'ctx'. Returns the size of the file.
+func (sd *Sender) sendFSFile(ctx context.Context, fsys fs.FS,
+	name, k string,
+) (int64, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return 0, sd.logError(0xE8D2B7, err)
+	}
+	t0 := time.Now()
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return 0, sd.logError(0xE1A5C8, err)
+	}
+	sd.readTime = time.Since(t0)
+	return sd.sendFileItem(ctx, k, info, content)
+} //                                                                  sendFSFile
+
+// listFSFiles returns the names of the regular files in 'fsys' that
+// match any of 'patterns', or are in directories that match, or all
+// its files if there are no patterns, in lexical order and without
+// duplicates, leaving out the names ignored by ignoredName().
+func listFSFiles(fsys fs.FS, patterns, ignore []string,
+) ([]string, error) {
+	roots := []string{"."}
+	if len(patterns) > 0 {
+		roots = nil
+		for _, pattern := range patterns {
+			matches, err := fs.Glob(fsys, pattern)
+			if err != nil {
+				return nil, makeError(0xE6F4D1, "pattern", pattern+":", err)
+			}
+			roots = append(roots, matches...)
+		}
+	}
+	seen := make(map[string]bool)
+	var ret []string
+	for _, root := range roots {
+		err := fs.WalkDir(fsys, root, func(
+			name string, de fs.DirEntry, err error,
+		) error {
+			if err != nil {
+				return err
+			}
+			if name != "." && ignoredName(path.Base(name), ignore) {
+				if de.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if de.Type().IsRegular() && !seen[name] {
+				seen[name] = true
+				ret = append(ret, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+} //                                                                 listFSFiles
+
+// end
@@ -0,0 +1,85 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[send_fs_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// (sd *Sender) SendFS(fsys fs.FS, patterns []string,
+//     opts *DirectoryOptions,
+// ) (*DirectoryResult, error)
+//
+// go test -run Test_Sender_SendFS_
+//
+func Test_Sender_SendFS_(t *testing.T) {
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	file := func(data string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(data), Mode: 0640, ModTime: mtime}
+	}
+	fsys := fstest.MapFS{
+		"index.html":          file("1"),
+		"notes.txt":           file("22"),
+		"static/css/a.css":    file("333"),
+		"static/css/skip.tmp": file("4444"),
+		"static/.hidden.css":  file("5"),
+		"static/js/b.js":      file("66"),
+	}
+	dst := t.TempDir()
+	var mu sync.Mutex
+	writeFile := WriteToDirectory(dst)
+	sd := makeTestSender()
+	sd.Config.VerboseSender = false
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive: func(k string, v []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return writeFile(k, v)
+		},
+	}
+	res, err := sd.SendFS(fsys, []string{"*.html", "static/*", "static/js/*"},
+		&DirectoryOptions{Prefix: "www/", Ignore: []string{"*.tmp"}})
+	if err != nil || res == nil {
+		t.Fatal("0xE4C7B2", "wrong error:", err)
+	}
+	var paths []string
+	for _, fr := range res.Files {
+		paths = append(paths, fr.Path)
+	}
+	if got := strings.Join(paths, " "); got !=
+		"index.html static/css/a.css static/js/b.js" {
+		t.Error("0xE9A3F5", "wrong files:", got)
+	}
+	if res.Sent != 3 || res.Failed != 0 || res.Bytes != 6 {
+		t.Error("0xE2E8D6", res.Sent, res.Failed, res.Bytes)
+	}
+	path := filepath.Join(dst, "www", "static", "css", "a.css")
+	data, err := os.ReadFile(path)
+	info, _ := os.Stat(path)
+	if err != nil || string(data) != "333" || info == nil ||
+		!info.ModTime().Equal(mtime) || info.Mode().Perm() != 0640 {
+		t.Error("0xE5B1A9", string(data), err)
+	}
+	// with no patterns, must send all the files
+	res, err = sd.SendFS(fsys, nil, nil)
+	if err != nil || res == nil || res.Sent != 5 {
+		t.Error("0xE0D6C8", "wrong result:", res, err)
+	}
+	// must fail without a result if a pattern is malformed
+	res, err = sd.SendFS(fsys, []string{"["}, nil)
+	if res != nil || !matchError(err, "pattern [:") {
+		t.Error("0xE8F2D7", "wrong error:", err)
+	}
+}
+
+// end
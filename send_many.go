@@ -0,0 +1,114 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[send_many.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// defaultMaxItemsInFlight is the number of data items SendMany()
+// sends at once when Configuration.MaxItemsInFlight is zero.
+const defaultMaxItemsInFlight = 4
+
+// Item is a data item to be sent by Sender.SendMany().
+type Item struct {
+	Key   string
+	Value []byte
+
+	// Options apply to this item only. If nil,
+	// the item is sent like Sender.Send() does.
+	Options *SendOptions
+} //                                                                        Item
+
+// SendMany transfers 'items' to the Receiver specified by Sender.Address,
+// keeping up to Config.MaxItemsInFlight of them in flight at once. Their
+// packets are interleaved, so the Sender doesn't wait idly for the last
+// confirmations of one item before it starts sending the next.
+//
+// Each item is sent on a connection of its own, as SendWithOptions()
+// would send it, unless Sender.PacketConn is specified: then the items
+// are sent one at a time on it. Items may arrive in any order. Once all
+// items have been attempted, SendMany returns the errors of those that
+// failed, joined by errors.Join(), or nil if all have been delivered.
+//
+// CancelAll() cancels the items being sent, and those still waiting.
+//
+func (sd *Sender) SendMany(items []Item) error {
+	if sd.Config == nil {
+		sd.Config = NewDefaultConfig()
+	}
+	n := sd.Config.MaxItemsInFlight
+	if n == 0 {
+		n = defaultMaxItemsInFlight
+	}
+	if sd.PacketConn != nil {
+		n = 1 // the items would read each other's replies
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	defer sd.addActive(nil, cancel)() // cancels the items not yet started
+	t0 := time.Now()
+	errs := make([]error, len(items))
+	workers := newWorkerPool(n)
+	for i := range items {
+		i := i
+		workers.run(func() {
+			it := &items[i]
+			isd := sd.itemSender()
+			err := isd.sendContext(ctx, it.Key, it.Value, it.Options)
+			sd.addItemStats(isd)
+			if err != nil {
+				errs[i] = makeError(0xEF2F8C, "item", it.Key+":", err)
+			}
+		})
+	}
+	workers.wait()
+	// the items overlap, so the transfer time is the time they all took
+	sd.mu.Lock()
+	sd.stats.transferTime += time.Since(t0)
+	sd.mu.Unlock()
+	return errors.Join(errs...)
+} //                                                                    SendMany
+
+// itemSender returns a new Sender with the same settings as this one,
+// so that SendMany() can send each item without sharing its state.
+func (sd *Sender) itemSender() *Sender {
+	return &Sender{
+		Address:       sd.Address,
+		CryptoKey:     sd.CryptoKey,
+		Config:        sd.Config,
+		SenderID:      sd.SenderID,
+		AuthToken:     sd.AuthToken,
+		EndToEndKey:   sd.EndToEndKey,
+		SigningKey:    sd.SigningKey,
+		LocalPort:     sd.LocalPort,
+		PacketConn:    sd.PacketConn,
+		Multicast:     sd.Multicast,
+		LocalReceiver: sd.LocalReceiver,
+		parent:        sd,
+	}
+} //                                                                  itemSender
+
+// addItemStats adds the statistics of 'isd', which has sent an item for
+// SendMany(), to this Sender's statistics and label statistics.
+func (sd *Sender) addItemStats(isd *Sender) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	// the items are sent in parallel, so their transfer times overlap
+	transferTime := sd.stats.transferTime
+	sd.stats = sd.stats.add(isd.stats.load())
+	sd.stats.transferTime = transferTime
+	if sd.labels == nil {
+		sd.labels = make(map[string]udpStats)
+	}
+	for label, st := range isd.labels {
+		sd.labels[label] = sd.labels[label].add(st)
+	}
+} //                                                                addItemStats
+
+// end
@@ -0,0 +1,67 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[send_many_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// (sd *Sender) SendMany(items []Item) error
+//
+// go test -run Test_Sender_SendMany_
+//
+func Test_Sender_SendMany_(t *testing.T) {
+	cryptoKey := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	cf.MaxItemsInFlight = 3
+	var mu sync.Mutex
+	received := map[string][]byte{}
+	rc := Receiver{
+		Port: 9889, CryptoKey: cryptoKey, Config: cf,
+		Receive: func(k string, v []byte) error {
+			mu.Lock()
+			received[k] = v
+			mu.Unlock()
+			return nil
+		},
+	}
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	items := make([]Item, 8)
+	for i := range items {
+		items[i].Key = fmt.Sprint("item", i)
+		items[i].Value = make([]byte, 5000)
+		rand.New(rand.NewSource(int64(i))).Read(items[i].Value)
+	}
+	items[5].Options = &SendOptions{Label: "five"}
+	sd := Sender{Address: "127.0.0.1:9889", CryptoKey: cryptoKey, Config: cf}
+	err := sd.SendMany(items)
+	if err != nil {
+		t.Error("0xEB06F4", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, it := range items {
+		if !bytes.Equal(received[it.Key], it.Value) {
+			t.Error("0xE0D43B", "mismatch for key:", it.Key)
+		}
+	}
+	st := sd.Stats()
+	if st.PacketsDelivered < int64(len(items)) ||
+		sd.LabelStats()["five"].PacketsDelivered < 1 {
+		t.Error("0xEE8878", st, sd.LabelStats())
+	}
+}
+
+// end
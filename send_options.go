@@ -0,0 +1,30 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[send_options.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+// SendOptions contains options that apply to a single data item sent
+// with Sender.SendWithOptions(). The zero value gives the same
+// behavior as Sender.Send().
+type SendOptions struct {
+
+	// AAD is additional authenticated data, such as a tenant ID, that is
+	// bound into the encryption of every packet of the item. It isn't
+	// sent, but the Receiver must be configured with the same value in
+	// Receiver.AAD, otherwise the packets fail authentication. This means
+	// that packets can't be replayed to a Receiver of another context,
+	// even if all the Receivers share the same CryptoKey.
+	//
+	// AAD requires a cipher that implements AADCipher.
+	//
+	AAD []byte
+
+	// Label is an accounting label, such as the name of the team on
+	// whose behalf the item is sent. Sender.LabelStats() totals the
+	// bytes and packets sent under each label.
+	Label string
+} //                                                                 SendOptions
+
+// end
@@ -0,0 +1,107 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[send_reader_at.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// SendFromReaderAt sends 'size' bytes read from 'r' to the Receiver
+// specified by Sender.Address, in chunks of Config.StreamChunkSize
+// bytes with the same keys as SendFromReader(). It is meant for random
+// access sources, such as files and block devices: up to
+// Config.MaxItemsInFlight chunks are read at once, each by its own
+// goroutine, and sent in parallel like the items of SendMany(). Only
+// the chunks in flight are held in memory, so lost pieces are resent
+// without keeping the whole source buffered. Chunks may arrive in
+// any order.
+//
+// Returns the first error with which a chunk couldn't be read or
+// delivered, after which the other chunks are not sent. Reading
+// fewer than 'size' bytes from 'r' is an error.
+//
+func (sd *Sender) SendFromReaderAt(name string, r io.ReaderAt, size int64,
+) error {
+	if sd.Config == nil {
+		sd.Config = NewDefaultConfig()
+	}
+	if size < 0 {
+		return sd.logError(0xE3D6A2, "invalid size:", size)
+	}
+	chunkSize := int64(sd.Config.StreamChunkSize)
+	if chunkSize < 1 {
+		chunkSize = defaultStreamChunkSize
+	}
+	count := (size + chunkSize - 1) / chunkSize
+	if count == 0 {
+		count = 1 // send an empty source as one empty chunk
+	}
+	inFlight := sd.Config.MaxItemsInFlight
+	if inFlight == 0 {
+		inFlight = defaultMaxItemsInFlight
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	defer sd.addActive(nil, cancel)() // cancels the chunks not yet sent
+	t0 := time.Now()
+	workers := newWorkerPool(inFlight)
+	for n := int64(1); n <= count && ctx.Err() == nil; n++ {
+		n := n
+		workers.run(func() {
+			off := (n - 1) * chunkSize
+			length := size - off
+			if length > chunkSize {
+				length = chunkSize
+			}
+			err := sd.sendChunkAt(ctx, name, r, off, length, n, count)
+			if err != nil {
+				cancel(err)
+			}
+		})
+	}
+	workers.wait()
+	// the chunks overlap, so the transfer time is the time they all took
+	sd.mu.Lock()
+	sd.stats.transferTime += time.Since(t0)
+	sd.mu.Unlock()
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return nil
+} //                                                            SendFromReaderAt
+
+// sendChunkAt reads the 'length' bytes at offset 'off' of 'r', which are
+// chunk 'n' of 'count' of 'name', and sends them for SendFromReaderAt()
+// with a Sender of their own, within context 'ctx'.
+func (sd *Sender) sendChunkAt(ctx context.Context, name string,
+	r io.ReaderAt, off, length, n, count int64,
+) error {
+	chunk := make([]byte, length)
+	t0 := time.Now()
+	got, err := r.ReadAt(chunk, off)
+	if got == len(chunk) {
+		err = nil // ReadAt may return io.EOF with the last bytes
+	} else if err == io.EOF || err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return sd.logError(0xE8B1F5, "reading chunk", n, "of", count,
+			"of", name+":", err)
+	}
+	isd := sd.itemSender()
+	isd.readTime = time.Since(t0)
+	err = isd.sendContext(ctx, ChunkKey(name, n, count), chunk, nil)
+	sd.addItemStats(isd)
+	if err != nil {
+		return sd.logError(0xE5E9C4, "sending chunk", n, "of", count,
+			"of", name+":", err)
+	}
+	return nil
+} //                                                                 sendChunkAt
+
+// end
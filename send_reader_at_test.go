@@ -0,0 +1,92 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /[send_reader_at_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+// (sd *Sender) SendFromReaderAt(name string, r io.ReaderAt, size int64,
+// ) error
+//
+// go test -run Test_Sender_SendFromReaderAt_*
+
+// must send all chunks, in parallel, with the keys of SendFromReader()
+func Test_Sender_SendFromReaderAt_1(t *testing.T) {
+	sd := makeTestSender()
+	sd.Config.StreamChunkSize = 4
+	sd.Config.MaxItemsInFlight = 2
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive: func(k string, v []byte) error {
+			mu.Lock()
+			got = append(got, k+"="+string(v))
+			mu.Unlock()
+			return nil
+		},
+	}
+	err := sd.SendFromReaderAt("abc", strings.NewReader("0123456789"), 10)
+	if err != nil {
+		t.Error("0xE2C7A5", err)
+	}
+	sort.Strings(got)
+	want := []string{
+		"abc#chunk:1/3=0123",
+		"abc#chunk:2/3=4567",
+		"abc#chunk:3/3=89",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("0xE9A4D1", got)
+	}
+	if st := sd.Stats(); st.ValueBytes != 10 {
+		t.Error("0xE6F8B0", st.ValueBytes)
+	}
+	got = nil
+	err = sd.SendFromReaderAt("empty", strings.NewReader(""), 0)
+	if err != nil || len(got) != 1 || got[0] != "empty#chunk:1/1=" {
+		t.Error("0xE0B3E7", err, got)
+	}
+}
+
+// must fail when the source ends before 'size' bytes, or 'size' is invalid
+func Test_Sender_SendFromReaderAt_2(t *testing.T) {
+	sd := makeTestSender()
+	sd.Config.StreamChunkSize = 4
+	sd.Config.MaxItemsInFlight = 1
+	var count int
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive: func(k string, v []byte) error {
+			count++
+			return nil
+		},
+	}
+	err := sd.SendFromReaderAt("abc", strings.NewReader("012345"), 10)
+	if !errors.Is(err, io.ErrUnexpectedEOF) ||
+		!matchError(err, "reading chunk 2 of 3") {
+		t.Error("0xE4D2C8", "wrong error:", err)
+	}
+	if count != 1 {
+		t.Error("0xE7B9F3", count)
+	}
+	err = sd.SendFromReaderAt("abc", strings.NewReader(""), -1)
+	if !matchError(err, "invalid size") {
+		t.Error("0xE1E6A4", "wrong error:", err)
+	}
+}
+
+// end
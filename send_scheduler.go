@@ -0,0 +1,160 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[send_scheduler.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"sync"
+	"time"
+)
+
+// SendScheduler decides when a Sender starts sending each data item, once
+// the item has been compressed and is ready to go. Set
+// Configuration.SendScheduler to use it. SendImmediately is the default,
+// CoalescingSchedule starts items together, and OffPeakSchedule only
+// starts them within a daily time window. The methods may be called
+// concurrently, by several Senders.
+type SendScheduler interface {
+
+	// StartAt returns when the Sender may start sending 'item', which
+	// became ready at 'now'. A time that isn't after 'now' starts it
+	// at once. The Sender waits until then, unless its Send is
+	// cancelled first (see Sender.CancelAll).
+	StartAt(item ScheduledItem, now time.Time) time.Time
+} //                                                               SendScheduler
+
+// ScheduledItem describes a data item to a SendScheduler.
+type ScheduledItem struct {
+
+	// Key is the key of the data item.
+	Key string
+
+	// Address is the address of the Receiver it is being sent to.
+	Address string
+
+	// Size is the length of its value, in bytes, before compression.
+	Size int
+
+	// Label is its SendOptions.Label, if any.
+	Label string
+} //                                                               ScheduledItem
+
+// SendImmediately is a SendScheduler that starts every item at once.
+type SendImmediately struct{}
+
+// StartAt implements SendScheduler.StartAt() and returns 'now'.
+func (SendImmediately) StartAt(item ScheduledItem, now time.Time,
+) time.Time {
+	return now
+} //                                                                     StartAt
+
+// CoalescingSchedule is a SendScheduler that delays each item by up to
+// Window, so that the items that become ready within Window of the first
+// one start together, e.g. to wake up a radio or a dial-up link once
+// for a batch of items, instead of for each one.
+type CoalescingSchedule struct {
+
+	// Window is how long the first item of a batch waits for others.
+	Window time.Duration
+
+	// mu protects 'end'
+	mu sync.Mutex
+
+	// end is when the current batch starts
+	end time.Time
+} //                                                          CoalescingSchedule
+
+// StartAt implements SendScheduler.StartAt(). Returns the end of the
+// current batch, or starts a new batch if it has already started.
+func (cs *CoalescingSchedule) StartAt(item ScheduledItem, now time.Time,
+) time.Time {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if now.Before(cs.end) {
+		return cs.end
+	}
+	cs.end = now.Add(cs.Window)
+	return cs.end
+} //                                                                     StartAt
+
+// OffPeakSchedule is a SendScheduler that only starts items within a daily
+// time window, e.g. from 22:00 to 06:00, so that bulk transfers stay off
+// links that are busy or metered during the day. Items that become ready
+// outside the window wait for its next start.
+type OffPeakSchedule struct {
+
+	// Start and End are the times of day at which the window begins and
+	// ends, as offsets from midnight, e.g. 22 * time.Hour. If End is
+	// before Start, the window spans midnight. If they are equal, it
+	// spans the whole day.
+	Start time.Duration
+	End   time.Duration
+
+	// Location is the time zone of Start and End.
+	// If it is nil, the local time zone is used.
+	Location *time.Location
+
+	// MinSize, if specified, exempts items smaller than MinSize
+	// bytes, such as urgent messages, which start at once.
+	MinSize int
+} //                                                             OffPeakSchedule
+
+// StartAt implements SendScheduler.StartAt(). Returns 'now' if it is
+// within the window, or else the next time the window begins.
+func (op *OffPeakSchedule) StartAt(item ScheduledItem, now time.Time,
+) time.Time {
+	if item.Size < op.MinSize || op.Start == op.End {
+		return now
+	}
+	loc := op.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t := now.In(loc)
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	ofs := t.Sub(midnight)
+	inWindow := op.Start <= ofs && ofs < op.End
+	if op.End < op.Start {
+		inWindow = ofs >= op.Start || ofs < op.End
+	}
+	switch {
+	case inWindow:
+		return now
+	case ofs < op.Start:
+		return midnight.Add(op.Start)
+	}
+	return time.Date(y, m, d+1, 0, 0, 0, 0, loc).Add(op.Start)
+} //                                                                     StartAt
+
+// waitForSchedule waits until Config.SendScheduler lets the Sender start
+// sending data item 'k', whose value is 'v', asking it again after each
+// network change (see PowerSaver). Returns an error if the Send is
+// cancelled meanwhile.
+func (sd *Sender) waitForSchedule(k string, v []byte) error {
+	sch := sd.Config.SendScheduler
+	if sch == nil {
+		return nil
+	}
+	for {
+		change := networkChangeOf(sch) // before StartAt, not to miss one
+		now := time.Now()
+		at := sch.StartAt(ScheduledItem{
+			Key: k, Address: sd.Address, Size: len(v), Label: sd.opts.Label,
+		}, now)
+		if !at.After(now) {
+			return nil
+		}
+		if sd.Config.VerboseSender {
+			sd.logDebug("Scheduled item", k, "to start at", at)
+		}
+		changed, err := sd.sleepUntilChange(at.Sub(now), change)
+		if !changed {
+			return err
+		}
+	}
+} //                                                             waitForSchedule
+
+// end
@@ -0,0 +1,121 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /[send_scheduler_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// (op *OffPeakSchedule) StartAt(item ScheduledItem, now time.Time,
+// ) time.Time
+//
+// go test -run Test_OffPeakSchedule_StartAt_
+//
+func Test_OffPeakSchedule_StartAt_(t *testing.T) {
+	day := func(d, h, m int) time.Time {
+		return time.Date(2026, 3, d, h, m, 0, 0, time.UTC)
+	}
+	test := func(op OffPeakSchedule, size int, now, want time.Time) {
+		got := op.StartAt(ScheduledItem{Size: size}, now)
+		if !got.Equal(want) {
+			t.Error("0xE2D7B3", op.Start, op.End, now, "got:", got,
+				"want:", want)
+		}
+	}
+	night := OffPeakSchedule{
+		Start: 22 * time.Hour, End: 6 * time.Hour, Location: time.UTC,
+	}
+	test(night, 100, day(10, 23, 0), day(10, 23, 0))
+	test(night, 100, day(10, 5, 59), day(10, 5, 59))
+	test(night, 100, day(10, 6, 0), day(10, 22, 0))
+	test(night, 100, day(10, 12, 0), day(10, 22, 0))
+	//
+	lunch := OffPeakSchedule{
+		Start: 12 * time.Hour, End: 13 * time.Hour, Location: time.UTC,
+	}
+	test(lunch, 100, day(10, 9, 0), day(10, 12, 0))
+	test(lunch, 100, day(10, 12, 30), day(10, 12, 30))
+	test(lunch, 100, day(10, 13, 0), day(11, 12, 0))
+	//
+	// must start small items, and all items of a whole-day window, at once
+	lunch.MinSize = 1000
+	test(lunch, 999, day(10, 9, 0), day(10, 9, 0))
+	test(lunch, 1000, day(10, 9, 0), day(10, 12, 0))
+	allDay := OffPeakSchedule{Start: time.Hour, End: time.Hour}
+	test(allDay, 100, day(10, 0, 0), day(10, 0, 0))
+}
+
+// (cs *CoalescingSchedule) StartAt(item ScheduledItem, now time.Time,
+// ) time.Time
+//
+// go test -run Test_CoalescingSchedule_StartAt_
+//
+// must start the items that become ready within Window of the first
+// one together, and begin a new batch after that
+func Test_CoalescingSchedule_StartAt_(t *testing.T) {
+	t0 := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	cs := CoalescingSchedule{Window: time.Second}
+	for _, ofs := range []time.Duration{0, 500 * time.Millisecond, 999} {
+		got := cs.StartAt(ScheduledItem{}, t0.Add(ofs))
+		if !got.Equal(t0.Add(time.Second)) {
+			t.Error("0xE8B1F6", ofs, got)
+		}
+	}
+	got := cs.StartAt(ScheduledItem{}, t0.Add(time.Second))
+	if !got.Equal(t0.Add(2 * time.Second)) {
+		t.Error("0xE5A9C2", got)
+	}
+	got = SendImmediately{}.StartAt(ScheduledItem{}, t0)
+	if !got.Equal(t0) {
+		t.Error("0xE1C4E7", got)
+	}
+}
+
+// Configuration.SendScheduler
+//
+// go test -run Test_SendScheduler_
+//
+// must delay the start of each Send until the scheduled time,
+// unless the Send is cancelled meanwhile
+func Test_SendScheduler_(t *testing.T) {
+	key := []byte("scheduler-key-0123456789abcdefgh")
+	got := make(chan time.Time, 1)
+	rc := Receiver{
+		Port: 9857, CryptoKey: key, Config: NewDefaultConfig(),
+		Receive: func(k string, v []byte) error {
+			got <- time.Now()
+			return nil
+		},
+	}
+	rc.Config.LogWriter = nil
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	cf.SendScheduler = &CoalescingSchedule{Window: 300 * time.Millisecond}
+	sd := Sender{Address: "127.0.0.1:9857", CryptoKey: key, Config: cf}
+	t0 := time.Now()
+	if err := sd.Send("k", []byte("scheduled")); err != nil {
+		t.Fatal("0xE7E3A5", err)
+	}
+	if at := <-got; at.Sub(t0) < 300*time.Millisecond {
+		t.Error("0xE4B6D1", "started early:", at.Sub(t0))
+	}
+	cf.SendScheduler = &CoalescingSchedule{Window: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(),
+		200*time.Millisecond)
+	defer cancel()
+	err := sd.SendContext(ctx, "k", []byte("never"))
+	if err == nil || time.Since(t0) > 5*time.Second {
+		t.Error("0xE9D2C8", "not cancelled:", err)
+	}
+}
+
+// end
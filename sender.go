@@ -18,34 +18,80 @@ package udpt
 // # Main Methods (sd *Sender)
 //   ) Send(k string, v []byte) error
 //   ) SendString(k, v string) error
+//   ) SendWithOptions(k string, v []byte, opts *SendOptions) error
+//   ) SendContext(ctx context.Context, k string, v []byte) error
+//   ) SendFromReader(name string, r io.Reader, size int64) error
+//   ) SetKey(cryptoKey []byte) error
+//   ) Close() error
 //
 // # Informatory Properties (sd *Sender)
 //   ) AverageResponseMs() float64
 //   ) DeliveredAllParts() bool
+//   ) KeyFingerprint() string
+//   ) LabelStats() map[string]TransferStats
+//   ) Stats() TransferStats
+//   ) TotalStats() TransferStats
 //   ) TransferSpeedKBpS() float64
 //
 // # Informatory Methods (sd *Sender)
 //   ) LogStats(w ...io.Writer)
 //
 // # Internal Lifecycle Methods (sd *Sender)
+//   ) sendContext( . . .
 //   ) beginSend(k string, v []byte) error
+//   ) localReceiver() *Receiver
+//   ) sendLocal(rc *Receiver, k string, v []byte) error
+//   ) transferItem( . . .
 //   ) makePackets(k string, comp []byte) error
+//   ) resplitPackets() error
+//   ) splitPackets(k string, comp []byte, max int) error
+//   ) splitSubPackets(pk *senderPacket) error
 //   ) connect() (netUDPConn, error)
 //   ) connectDI( . . .
+//   ) reconnect(connect func() (netUDPConn, error)) error
 //   ) sendUndeliveredPackets() error
-//   ) collectConfirmations()
+//   ) partsToSend(i int) (string, []*senderPacket, error)
+//   ) sendPacket(pk *senderPacket) error
+//   ) startLoops(conn netUDPConn)
+//   ) collectConfirmations(conn netUDPConn, done <-chan struct{})
+//   ) confirmPacket(hash []byte)
+//   ) handleReadError(conn netUDPConn, err error)
+//   ) receiveNack(recv []byte)
 //   ) waitForAllConfirmations()
 //   ) close()
 //   ) endSend() error
 //
 // # Internal Helper Methods (sd *Sender)
 //   ) logError(id uint32, a ...interface{}) error
+//   ) cipher() SymmetricCipher
+//   ) failure() error
+//   ) sleep(d time.Duration) error
+//   ) sleepUntilChange(d time.Duration, change <-chan struct{},
+//   ) (bool, error)
 //   ) logInfo(a ...interface{})
+//   ) logDebug(a ...interface{})
+//   ) logAt(debug bool, a ...interface{})
 //   ) makePacket(data []byte) (*senderPacket, error)
+//   ) putDeadLetter(k string, v []byte, reason error)
+//   ) addLabelStats(before udpStats)
+//   ) resetConfirmations()
+//   ) countDelivered() int
+//   ) pieceDelivered(pk *senderPacket)
+//   ) receiverLimit() *TokenBucket
+//   ) sendLimit() *TokenBucket
+//   ) takeMTUChanged() bool
+//   ) takeNacked() bool
+//   ) isConnBroken() bool
+//   ) takeConnBroken() bool
+//   ) writeTrace()
+//   ) payloadSize() int
+//   ) reportPathLoss()
 //   ) validateAddress() error
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"io"
@@ -53,6 +99,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -91,6 +138,10 @@ func Send(addr, k string, v, cryptoKey []byte, config ...*Configuration) error {
 	}
 	sender := Sender{Address: addr, CryptoKey: cryptoKey, Config: cf}
 	err := sender.Send(k, v)
+	// close the JSON array written to Config.TraceWriter, if any
+	if err2 := sender.Close(); err == nil {
+		err = err2
+	}
 	return err
 } //                                                                        Send
 
@@ -123,12 +174,30 @@ func SendString(addr, k, v string, cryptoKey []byte, config ...*Configuration,
 
 // udpStats contains UDP transfer statistics, such as the transfer
 // speed and the number of packets delivered and lost.
+//
+// The fields from packetsSent to repliesRejected, and encryptNanos and
+// sendNanos, are updated by the goroutines that send packets and receive
+// confirmations, with atomic operations.
+//
 type udpStats struct {
 	bytesDelivered   int64
 	bytesLost        int64
 	packetsDelivered int64
 	packetsLost      int64
 	transferTime     time.Duration
+	packetsSent      int64
+	packetsResent    int64
+	bytesSent        int64
+	rttNanos         int64 // total round-trip time of confirmed packets
+	rttCount         int64 // number of packets in rttNanos
+	repliesRejected  int64
+	valueBytes       int64
+	compressedBytes  int64
+	readTime         time.Duration
+	compressTime     time.Duration
+	encryptNanos     int64
+	sendNanos        int64
+	ackWaitTime      time.Duration
 } //                                                                    udpStats
 
 // Sender coordinates sending key-value messages to a listening Receiver.
@@ -146,23 +215,142 @@ type Sender struct {
 	//
 	Address string
 
+	// LocalPort is the UDP port the Sender sends from, for firewalls that
+	// only let known source ports through. If it is in use, the Sender
+	// retries and tries Config.AltPorts, like a Receiver. Senders in the
+	// same process that send at the same time, including those started
+	// by SendMany(), need different ports, so give them AltPorts.
+	// Zero lets the system choose a free port.
+	LocalPort int
+
+	// PacketConn, if specified, is the socket on which the Sender sends
+	// packets to Address and reads the Receiver's replies, instead of a
+	// socket it opens itself for each data item: e.g. a socket bound to
+	// a specific interface, one with SO_REUSEPORT, or an in-memory
+	// connection in tests. LocalPort and Config.Transport are then
+	// ignored. The Sender doesn't close it, and only one data item at
+	// a time may be sent on it, so SendMany() sends items one by one.
+	PacketConn net.PacketConn
+
+	// Multicast makes the Sender distribute each data item in one pass to
+	// all the Receivers at Address, which is then a multicast group that
+	// Receivers join (see Receiver.Group), e.g. "239.1.2.3:9876", or a
+	// broadcast address on the LAN, e.g. "192.168.1.255:9876". Pieces
+	// are sent to the group once, and again when a Receiver that missed
+	// them asks for them in a NACK, so it requires Config.NackDelay.
+	//
+	// The Send succeeds once every piece has been confirmed by some
+	// Receiver and no NACKs have arrived for twice Config.NackDelay.
+	// It can't tell whether Receivers that got no packets at all exist.
+	// Config.KeyExchange can't be used, Config.Transport is ignored,
+	// and data items are never delivered by LoopbackShortcut.
+	//
+	Multicast bool
+
 	// CryptoKey is the secret symmetric encryption key that
 	// must be shared by the Sender and the Receiver.
 	//
 	// The correct size of this key depends on
 	// the implementation of SymmetricCipher.
 	//
+	// If Config.KeyExchange is enabled, the Sender negotiates a session
+	// key instead, and uses CryptoKey to authenticate the handshake. It
+	// can be left blank only if the Receiver's CryptoKey is blank too
+	// (see Configuration.KeyExchange).
+	//
 	CryptoKey []byte
 
 	// Config contains UDP and other configuration settings.
 	// These settings normally don't need to be changed.
 	Config *Configuration
 
+	// SenderID and AuthToken identify this Sender to Receivers that only
+	// accept authorized Senders (see Receiver.AuthTokens), besides the
+	// shared CryptoKey. Each fragment header then carries SenderID and
+	// an HMAC of the header keyed with AuthToken, and the Receiver
+	// reports SenderID with each data item (see ItemInfo.SenderID).
+	// SenderID can have up to 64 letters, digits, or any of "-._@".
+	SenderID  string
+	AuthToken []byte
+
+	// EndToEndKey, if specified, seals the value of each data item for
+	// the final Receiver, which must have the same Receiver.EndToEndKey,
+	// so that relays in between (see RelayTo) can forward it but not read
+	// or alter it. It must be 32 bytes long (AES-256). SigningKey, if
+	// also specified, signs each sealed item, so that the final Receiver
+	// can check who sent it (see Receiver.SignerKeys).
+	EndToEndKey []byte
+	SigningKey  ed25519.PrivateKey
+
+	// LocalReceiver, if specified, is a Receiver in this process to which
+	// Send() delivers data items directly, without using the network.
+	// Address is then ignored. The Receiver doesn't need to be running,
+	// but must accept CryptoKey.
+	LocalReceiver *Receiver
+
 	// -------------------------------------------------------------------------
 
 	// conn holds the UDP connection to a Receiver
 	conn netUDPConn
 
+	// done is closed by close() to stop collectConfirmations() and
+	// sendKeepalives(), which use the connection in other goroutines.
+	// close() then waits for them to return, using 'loops'.
+	done  chan struct{}
+	loops sync.WaitGroup
+
+	// mu protects 'failed', 'mtuChanged', 'connBroken' and 'nacked',
+	// which are set by collectConfirmations() in another goroutine, and
+	// 'labels', 'history', 'active' and 'peerCaps', which LabelStats(),
+	// History(), ActiveTransfers(), CancelAll() and PeerCapabilities()
+	// can use in another goroutine
+	mu sync.Mutex
+
+	// failed holds an error that makes the current Send fail at once,
+	// without further retries, e.g. ErrReceiverUnreachable
+	failed error
+
+	// mtuChanged is set when an ICMP message reports a smaller path MTU,
+	// so the packets of the current item must be rebuilt to fit it
+	mtuChanged bool
+
+	// nacked is set when a NACK from the Receiver reports missing
+	// packets, so they should be resent without waiting any longer
+	nacked bool
+
+	// connBroken is set when a socket call fails with a fatal error,
+	// so the connection must be recreated before resending packets
+	connBroken bool
+
+	// packetsMu protects 'packets' and their delivery state (send times
+	// and counts, confirmations, sub-packets and 'resumed' flags), which
+	// collectConfirmations() updates in another goroutine while they
+	// are being sent. User callbacks are never called while it's held.
+	packetsMu sync.Mutex
+
+	// lastSent is the time (in Unix nanoseconds) when the last packet
+	// was sent, for Config.KeepaliveInterval. It is accessed atomically.
+	lastSent int64
+
+	// seq numbers the data packets sent, so that Receivers
+	// can drop replayed packets (see Config.ReplayWindow)
+	seq packetSequence
+
+	// opts contains the options of the data item being sent
+	opts SendOptions
+
+	// ctx is the context of the current Send, or nil. When it is
+	// cancelled, the Send stops retrying and closes the connection.
+	ctx context.Context
+
+	// key and comp contain the key and compressed value of the data item
+	// being sent, kept in case packets need to be rebuilt during sending
+	key  string
+	comp []byte
+
+	// chunked is set if 'comp' is compressed in chunks (see compressValue)
+	chunked bool
+
 	// dataHash contains the hash of all bytes of the data item being sent
 	dataHash []byte
 
@@ -170,6 +358,10 @@ type Sender struct {
 	// some of them may have been delivered, while others may need (re)sending
 	packets []senderPacket
 
+	// progress is the number of compressed bytes of the current data
+	// item confirmed so far, for Config.OnProgress. Protected by 'mu'.
+	progress int64
+
 	// startTime is the time the first packet was sent, after
 	// the bytes of the data item have been compressed
 	startTime time.Time
@@ -177,6 +369,77 @@ type Sender struct {
 	// stats contains UDP transfer statistics, such as the transfer
 	// speed and the number of packets delivered and lost
 	stats udpStats
+
+	// readTime is the time spent reading the value of the next data item
+	// from a file or reader, which beginSend() adds to 'stats'
+	readTime time.Duration
+
+	// budget tracks the time limits of the data item being sent
+	budget sendBudget
+
+	// labels totals the statistics of the data items
+	// sent so far, by their SendOptions.Label
+	labels map[string]udpStats
+
+	// trace records the timeline of the data item being sent,
+	// if Config.TraceWriter is specified. Otherwise it is nil.
+	trace *packetTrace
+
+	// traceOut is the writer in which writeTrace() has opened the JSON
+	// array of this Sender's traces, until Close() closes it, or nil.
+	// traceMu protects it, and serializes writing the traces, since the
+	// Senders created by SendMany() write them through their owner().
+	traceMu  sync.Mutex
+	traceOut io.Writer
+
+	// active holds the transfers of this Sender that CancelAll() can
+	// cancel, including those of the Senders created by SendMany()
+	active map[*activeTransfer]struct{}
+
+	// transfer describes the current Send in ActiveTransfers(),
+	// for Config.Staleness, or is nil
+	transfer *TransferInfo
+
+	// session is the cipher keyed with the session key negotiated by
+	// handshake() for the current connection (see Config.KeyExchange)
+	session SymmetricCipher
+
+	// selfTest runs the self-tests of Config.StrictCrypto once, at the
+	// start of the first Send, rather than at the start of every Send
+	selfTest cryptoSelfTest
+
+	// rxLimit paces the packets sent to the rate advertised by the
+	// Receiver in its confirmations (Config.MaxReceiveBytesPerSecond)
+	rxLimit TokenBucket
+
+	// txLimit paces the packets sent to Config.MaxSendBytesPerSecond
+	txLimit TokenBucket
+
+	// resume holds the resume tokens of the data items that this Sender
+	// failed to deliver, by receivingItemID() (see Config.ResumeTransfers).
+	// It is protected by 'mu'.
+	resume map[string]*resumeToken
+
+	// history holds the outcomes of the most recent data items sent,
+	// by Address (see History). It is protected by 'mu'.
+	history map[string]*transferHistory
+
+	// reply is the reply to the data item last sent, which
+	// SendWithReply() returns. It is protected by 'mu'.
+	reply []byte
+
+	// peerCaps holds the capabilities last advertised by the Receiver
+	// (see PeerCapabilities), or is nil if none have been advertised
+	peerCaps *peerCapabilities
+
+	// srtt is the smoothed round-trip time to the Receiver at rttAddr,
+	// for RetryPolicy. Both are protected by 'mu'. See updateRTT().
+	srtt    time.Duration
+	rttAddr string
+
+	// parent is the Sender whose SendMany() created this Sender, which
+	// lists its transfer in ActiveTransfers(). Otherwise it is nil.
+	parent *Sender
 } //                                                                      Sender
 
 // -----------------------------------------------------------------------------
@@ -192,9 +455,27 @@ type Sender struct {
 // as the free memory available on the Sender's and Receiver's machine.
 //
 func (sd *Sender) Send(k string, v []byte) error {
-	return sd.sendDI(k, v, sd.connect, sd.sendUndeliveredPackets)
+	return sd.SendWithOptions(k, v, nil)
 } //                                                                        Send
 
+// SendWithOptions transfers a key-value to the Receiver specified by
+// Sender.Address, like Send(), applying the options in 'opts' to this
+// data item only. If 'opts' is nil, it behaves exactly like Send().
+func (sd *Sender) SendWithOptions(k string, v []byte, opts *SendOptions,
+) error {
+	return sd.sendContext(context.Background(), k, v, opts)
+} //                                                             SendWithOptions
+
+// SendContext transfers a key-value to the Receiver specified by
+// Sender.Address, like Send(), but stops as soon as 'ctx' is cancelled
+// or its deadline passes: packets are no longer sent or resent, the
+// data item is not retried and the connection is closed. In that case,
+// it returns an error that wraps ctx.Err().
+func (sd *Sender) SendContext(ctx context.Context, k string, v []byte,
+) error {
+	return sd.sendContext(ctx, k, v, nil)
+} //                                                                 SendContext
+
 // sendDI is only used by Send() and provides parameters for
 // dependency injection, to enable mocking during testing.
 func (sd *Sender) sendDI(k string, v []byte,
@@ -204,31 +485,164 @@ func (sd *Sender) sendDI(k string, v []byte,
 	if sd.Config == nil {
 		sd.Config = NewDefaultConfig()
 	}
+	if rc := sd.localReceiver(); rc != nil {
+		err := sd.sendLocal(rc, k, v)
+		sd.addLabelStats(udpStats{}) // sendLocal resets sd.stats
+		return err
+	}
+	before := sd.stats
+	t0 := time.Now()
 	err := sd.beginSend(k, v)
 	if err != nil {
 		return err
 	}
+	defer func() { sd.addLabelStats(before) }()
+	defer func() { sd.addHistory(t0, before, err) }()
+	defer func() { sd.comp = nil }()
+	t1 := time.Now()
+	err = sd.waitForSchedule(k, v)
+	if err != nil {
+		err = sd.logError(0xE6F3B8, err)
+		return err
+	}
+	t0 = t0.Add(time.Since(t1)) // History doesn't count the wait
+	if sd.Config.TraceWriter != nil {
+		sd.trace = newPacketTrace(k, sd.Config.TraceMaxEvents)
+		defer sd.writeTrace()
+	}
+	sd.budget.beginItem(time.Now())
+	sd.applyResumeToken()
+	for attempt := 1; ; attempt++ {
+		err = sd.transferItem(connect, sendUndeliveredPackets)
+		if err == nil {
+			return nil
+		}
+		sd.saveResumeToken()
+		delay, retry := sd.Config.ItemRetry.next(attempt, err,
+			sd.Config.Random)
+		if !retry {
+			break
+		}
+		if left, ok := sd.budget.timeLeft(sd.Config, time.Now()); ok {
+			if left <= 0 {
+				err = sd.logError(0xE4C8B2, ErrItemTimeout)
+				break
+			}
+			if delay > left {
+				delay = left
+			}
+		}
+		if sd.Config.VerboseSender {
+			sd.logDebug("Retrying item", k, "in", delay)
+		}
+		change := networkChangeOf(sd.Config.RetryPolicy)
+		if _, e := sd.sleepUntilChange(delay, change); e != nil {
+			err = sd.logError(0xE37476, e)
+			break
+		}
+		if left, ok := sd.budget.timeLeft(sd.Config, time.Now()); ok &&
+			left <= 0 {
+			err = sd.logError(0xE2F7C5, ErrItemTimeout)
+			break
+		}
+		if e := sd.giveWayIfStale(); e != nil {
+			err = sd.logError(0xE35262, e)
+			break
+		}
+		sd.resetConfirmations()
+		sd.applyResumeToken()
+	}
+	sd.putDeadLetter(k, v, err)
+	return err
+} //                                                                      sendDI
+
+// transferItem connects to the Receiver and sends the packets of the
+// current data item, resending lost packets up to Config.SendRetries
+// times, then closes the connection.
+func (sd *Sender) transferItem(
+	connect func() (netUDPConn, error),
+	sendUndeliveredPackets func() error,
+) error {
+	sd.mu.Lock()
+	sd.failed = nil
+	sd.connBroken = false
+	sd.mu.Unlock()
 	newConn, err := connect()
 	if err != nil {
 		return sd.logError(0xE8B8D0, err)
 	}
 	sd.conn = newConn
-	go sd.collectConfirmations() // exits when conn becomes nil
-	for retries := 0; retries < sd.Config.SendRetries; retries++ {
+	if sd.Config.KeyExchange {
+		err = sd.handshake(newConn)
+		if err != nil {
+			sd.close()
+			return sd.logError(0xE9BF3D, err)
+		}
+	}
+	sd.startLoops(newConn)
+	sd.budget.beginAttempt(time.Now())
+	policy := sd.retryPolicy()
+	round := 0
+	for retries, resend := 0, false; retries < sd.Config.SendRetries; {
+		if resend {
+			err = sd.giveWayIfStale()
+			if err != nil {
+				sd.close()
+				return sd.logError(0xE519EE, err)
+			}
+		}
+		resend = true
+		delivered := sd.countDelivered()
 		err = sendUndeliveredPackets()
 		if err != nil {
 			defer func() { sd.close() }()
 			return sd.logError(0xE23CE0, err)
 		}
 		sd.waitForAllConfirmations()
+		sd.clearResumed()
+		if err = sd.failure(); err != nil {
+			sd.close()
+			return sd.logError(0xE88045, err, "at", sd.Address)
+		}
 		if sd.DeliveredAllParts() {
-			break
+			if !sd.Multicast || !sd.awaitRepairs() {
+				break
+			}
+			retries++ // a Receiver in the group asked for missing pieces
+			continue
+		}
+		// with a stall timeout, only rounds without progress use up retries
+		if sd.Config.StallTimeout == 0 || sd.countDelivered() <= delivered {
+			retries++
+		}
+		round++
+		change := networkChangeOf(policy)
+		changed, err := sd.sleepUntilChange(
+			policy.RetryDelay(round, sd.smoothedRTT()), change)
+		if err != nil {
+			sd.close()
+			return sd.logError(0xE41606, err)
+		}
+		if sd.takeConnBroken() || changed {
+			err = sd.reconnect(connect)
+			if err != nil {
+				return err
+			}
+		}
+		if sd.takeMTUChanged() {
+			err = sd.resplitPackets()
+			if err != nil {
+				sd.close()
+				return err
+			}
+			sd.trace.instant("resplit", 0, time.Now(),
+				map[string]interface{}{"packets": len(sd.packets)})
 		}
-		time.Sleep(sd.Config.SendRetryInterval)
 	}
+	sd.reportPathLoss()
 	sd.close()
 	return sd.endSend()
-} //                                                                      sendDI
+} //                                                                transferItem
 
 // SendString transfers a key and value string
 // to the Receiver specified by Sender.Address.
@@ -244,6 +658,99 @@ func (sd *Sender) SendString(k string, v string) error {
 	return sd.Send(k, []byte(v))
 } //                                                                  SendString
 
+// SendFromReader sends 'size' bytes read from 'r' to the Receiver
+// specified by Sender.Address, without reading them all into memory.
+// This is meant for large payloads, such as multi-gigabyte files.
+//
+// The bytes are read, compressed and sent one chunk at a time, each
+// chunk of Config.StreamChunkSize bytes being sent as a separate data
+// item, in order. The Receiver delivers each chunk to Receive under
+// the key returned by ChunkKey(name, n, count). Use ParseChunkKey()
+// in Receive to join the chunks.
+//
+// Returns an error if any chunk can't be delivered, or if 'r'
+// ends before 'size' bytes have been read.
+//
+func (sd *Sender) SendFromReader(name string, r io.Reader, size int64,
+) error {
+	if sd.Config == nil {
+		sd.Config = NewDefaultConfig()
+	}
+	if size < 0 {
+		return sd.logError(0xE134E3, "invalid size:", size)
+	}
+	chunkSize := int64(sd.Config.StreamChunkSize)
+	if chunkSize < 1 {
+		chunkSize = defaultStreamChunkSize
+	}
+	count := (size + chunkSize - 1) / chunkSize
+	if count == 0 {
+		count = 1 // send an empty stream as one empty chunk
+	}
+	buf := make([]byte, chunkSize)
+	for n := int64(1); n <= count; n++ {
+		chunk := buf
+		if rest := size - (n-1)*chunkSize; rest < chunkSize {
+			chunk = buf[:rest]
+		}
+		t0 := time.Now()
+		_, err := io.ReadFull(r, chunk)
+		sd.readTime = time.Since(t0)
+		if err != nil {
+			return sd.logError(0xED15DB, "reading chunk", n, "of", count,
+				"of", name+":", err)
+		}
+		err = sd.Send(ChunkKey(name, n, count), chunk)
+		if err != nil {
+			return sd.logError(0xE4E7C0, "sending chunk", n, "of", count,
+				"of", name+":", err)
+		}
+	}
+	return nil
+} //                                                              SendFromReader
+
+// SetKey changes CryptoKey, the key with which the Sender encrypts the
+// data items it sends next, for example to rotate keys without a hard
+// cutover (see Receiver.PreviousKeys). It keeps a copy of 'cryptoKey'.
+// Call it between sends: a send in progress may fail.
+//
+// Returns an error if the key isn't valid for Config.Cipher.
+//
+func (sd *Sender) SetKey(cryptoKey []byte) error {
+	if sd.Config == nil {
+		sd.Config = NewDefaultConfig()
+	}
+	if sd.Config.Cipher == nil {
+		return sd.logError(0xE073A3, "nil Sender.Config.Cipher")
+	}
+	err := sd.Config.Cipher.ValidateKey(cryptoKey)
+	if err != nil {
+		return sd.logError(0xE4F0EA, "invalid key:", err)
+	}
+	sd.CryptoKey = append([]byte(nil), cryptoKey...)
+	return nil
+} //                                                                      SetKey
+
+// Close closes the JSON array of the timelines written to
+// Config.TraceWriter, so that it holds a complete, valid trace. Call it
+// when the Sender won't send any more data items; a later Send starts a
+// new array. It doesn't close Config.TraceWriter itself, and does nothing
+// if nothing has been traced.
+func (sd *Sender) Close() error {
+	sd.traceMu.Lock()
+	defer sd.traceMu.Unlock()
+	if sd.traceOut == nil {
+		return nil
+	}
+	w := sd.traceOut
+	sd.traceOut = nil
+	err := closeTrace(w)
+	if err != nil {
+		return sd.logError(0xE5B9C2, err)
+	}
+	return nil
+} //                                                                       Close
+
 // -----------------------------------------------------------------------------
 // # Informatory Properties (sd *Sender)
 
@@ -270,9 +777,11 @@ func (sd *Sender) DeliveredAllParts() bool {
 			_ = sd.logError(0xEC7A22, "Sender.DeliveredAllParts panic:", r)
 		}
 	}()
+	sd.packetsMu.Lock()
+	defer sd.packetsMu.Unlock()
 	ret := len(sd.packets) > 0
-	for _, pk := range sd.packets {
-		if !bytes.Equal(pk.sentHash, pk.confirmedHash) {
+	for i := range sd.packets {
+		if !sd.packets[i].IsDelivered() {
 			ret = false
 			break
 		}
@@ -280,6 +789,45 @@ func (sd *Sender) DeliveredAllParts() bool {
 	return ret
 } //                                                           DeliveredAllParts
 
+// KeyFingerprint returns the fingerprint of Sender.CryptoKey.
+// Compare it with Receiver.KeyFingerprint() to check if both
+// ends are using the same key. See KeyFingerprint() for details.
+func (sd *Sender) KeyFingerprint() string {
+	return KeyFingerprint(sd.CryptoKey)
+} //                                                              KeyFingerprint
+
+// LabelStats returns the transfer statistics of all the data items sent
+// by this Sender, totalled by accounting label (see SendOptions.Label),
+// to attribute bandwidth usage. Items sent without a label are totalled
+// under "". It is safe to call while the Sender is sending.
+func (sd *Sender) LabelStats() map[string]TransferStats {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	ret := make(map[string]TransferStats, len(sd.labels))
+	for label, st := range sd.labels {
+		ret[label] = makeTransferStats(st)
+	}
+	return ret
+} //                                                                  LabelStats
+
+// Stats returns the transfer statistics of the last data item sent.
+func (sd *Sender) Stats() TransferStats {
+	return makeTransferStats(sd.stats.load())
+} //                                                                       Stats
+
+// TotalStats returns the transfer statistics of all the data items sent
+// by this Sender, i.e. the totals of LabelStats(). It is safe to call
+// while the Sender is sending, e.g. to export them as metrics.
+func (sd *Sender) TotalStats() TransferStats {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	var total udpStats
+	for _, st := range sd.labels {
+		total = total.add(st)
+	}
+	return makeTransferStats(total)
+} //                                                                  TotalStats
+
 // TransferSpeedKBpS returns the transfer speed of the current Send
 // operation, in Kilobytes (more accurately, Kibibytes) per second.
 func (sd *Sender) TransferSpeedKBpS() float64 {
@@ -303,6 +851,7 @@ func (sd *Sender) LogStats(w ...io.Writer) {
 		log = func(a ...interface{}) { fmt.Fprintln(w[0], a...) }
 	}
 	tItem := time.Duration(0)
+	sd.packetsMu.Lock()
 	for i, pk := range sd.packets {
 		tPacket, status := time.Duration(0), "✔"
 		if pk.IsDelivered() {
@@ -325,6 +874,7 @@ func (sd *Sender) LogStats(w ...io.Writer) {
 		log("SN:", sn, "T0:", t0, "T1:", t1, status, ms)
 		tItem += tPacket
 	}
+	sd.packetsMu.Unlock()
 	var (
 		sec   = sd.stats.transferTime.Seconds()
 		avg   = sd.AverageResponseMs()
@@ -345,6 +895,37 @@ func (sd *Sender) LogStats(w ...io.Writer) {
 // -----------------------------------------------------------------------------
 // # Internal Lifecycle Methods (sd *Sender)
 
+// sendContext is called by the Send methods to send a data item
+// with options 'opts' (which can be nil) within context 'ctx'.
+func (sd *Sender) sendContext(
+	ctx context.Context,
+	k string,
+	v []byte,
+	opts *SendOptions,
+) error {
+	if ctx.Err() != nil {
+		return sd.logError(0xE6A2C5, context.Cause(ctx))
+	}
+	sd.opts = SendOptions{}
+	sd.setReply(nil)
+	if opts != nil {
+		sd.opts = *opts
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	info := &TransferInfo{Key: k, Address: sd.Address, Started: time.Now()}
+	defer sd.addActive(info, cancel)()
+	sd.transfer = info
+	defer func() { sd.transfer = nil }()
+	sd.ctx = ctx
+	defer func() { sd.ctx = nil }()
+	var err error
+	withProfileLabels(ctx, sd.Config, func(context.Context) {
+		err = sd.sendDI(k, v, sd.connect, sd.sendUndeliveredPackets)
+	}, "udpt.op", "send", "udpt.key", k, "udpt.addr", sd.Address)
+	return err
+} //                                                                 sendContext
+
 // beginSend checks if the sender is properly configured before sending
 func (sd *Sender) beginSend(k string, v []byte) error {
 	//
@@ -352,30 +933,77 @@ func (sd *Sender) beginSend(k string, v []byte) error {
 	if sd.Config.Cipher == nil {
 		return sd.logError(0xE83D07, "nil Sender.Config.Cipher")
 	}
-	err := sd.Config.Cipher.SetKey(sd.CryptoKey)
+	var err error
+	if len(sd.CryptoKey) > 0 || !sd.Config.KeyExchange {
+		err = sd.Config.Cipher.SetKey(sd.CryptoKey)
+		if err != nil {
+			return sd.logError(0xE02D7B, "invalid Sender.CryptoKey:", err)
+		}
+	}
+	err = checkStrictCrypto(sd.Config, &sd.selfTest)
+	if err != nil {
+		return sd.logError(0xEC89E7, err)
+	}
+	err = applyRandomSource(sd.Config)
+	if err != nil {
+		return sd.logError(0xEF6CB7, err)
+	}
+	_, err = bindAAD(sd.Config.Cipher, sd.opts.AAD)
 	if err != nil {
-		return sd.logError(0xE02D7B, "invalid Sender.CryptoKey:", err)
+		return sd.logError(0xEB8B1B, "invalid SendOptions.AAD:", err)
 	}
 	// check settings
 	err = sd.Config.Validate()
 	if err != nil {
 		return sd.logError(0xE5D92D, "invalid Sender.Config:", err)
 	}
+	err = sd.Config.auditKeys(sd.logError,
+		auditedKey{"Sender.CryptoKey", sd.CryptoKey},
+		auditedKey{"Sender.EndToEndKey", sd.EndToEndKey},
+	)
+	if err != nil {
+		return sd.logError(0xE4D7A2, err)
+	}
 	err = sd.validateAddress()
 	if err != nil {
 		return sd.logError(0xE5A04A, err)
 	}
-	sd.dataHash = getHash(v)
+	err = sd.validateMulticast()
+	if err != nil {
+		return sd.logError(0xE9D3B2, err)
+	}
+	err = sd.validateAuth()
+	if err != nil {
+		return sd.logError(0xE6E2B9, err)
+	}
+	v, err = sd.seal(k, v)
+	if err != nil {
+		return sd.logError(0xE4C1D7, err)
+	}
+	sd.sendLimit().setRate(float64(sd.Config.MaxSendBytesPerSecond))
+	sd.mu.Lock()
+	sd.mtuChanged = false
+	sd.mu.Unlock()
+	sd.probePathMTU()
+	sd.dataHash = sd.Config.hash(v)
 	if sd.Config.VerboseSender {
-		sd.logInfo("\n" + strings.Repeat("-", 80) + "\n" +
-			fmt.Sprintf("Send key: %s size: %d hash: %X",
-				k, len(v), sd.dataHash))
+		sd.logDebug("\n" + strings.Repeat("-", 80) + "\n" +
+			fmt.Sprintf("Send key: %s size: %d hash: %X crypto key: %s",
+				k, len(v), sd.dataHash, sd.KeyFingerprint()))
 	}
-	comp, err := sd.Config.Compressor.Compress(v)
+	t0 := time.Now()
+	comp, chunked, err := sd.compressValue(v)
 	if err != nil {
 		return sd.logError(0xE2EB59, err)
 	}
+	sd.stats.compressTime += time.Since(t0)
+	sd.stats.readTime += sd.readTime
+	sd.readTime = 0
+	sd.chunked = chunked
 	sd.startTime = time.Now()
+	sd.key, sd.comp = k, comp
+	sd.stats.valueBytes += int64(len(v))
+	sd.stats.compressedBytes += int64(len(comp))
 	err = sd.makePackets(k, comp)
 	if err != nil {
 		return err
@@ -383,19 +1011,119 @@ func (sd *Sender) beginSend(k string, v []byte) error {
 	return nil
 } //                                                                   beginSend
 
+// localReceiver returns the Receiver in this process to which data items
+// should be delivered directly: Sender.LocalReceiver, or (if
+// Config.LoopbackShortcut is enabled) a running Receiver that listens
+// at Sender.Address that accepts CryptoKey and has the same AAD.
+// Otherwise nil.
+func (sd *Sender) localReceiver() *Receiver {
+	if sd.LocalReceiver != nil {
+		return sd.LocalReceiver
+	}
+	if !sd.Config.LoopbackShortcut || sd.Multicast {
+		return nil
+	}
+	rc := localReceivers.Find(sd.Address)
+	if rc == nil || !rc.acceptsKey(sd.CryptoKey) ||
+		!bytes.Equal(rc.AAD, sd.opts.AAD) {
+		return nil
+	}
+	return rc
+} //                                                               localReceiver
+
+// sendLocal delivers a data item directly to Receiver 'rc' in this process
+func (sd *Sender) sendLocal(rc *Receiver, k string, v []byte) error {
+	if !rc.acceptsKey(sd.CryptoKey) {
+		return sd.logError(0xE38A99,
+			"Sender.LocalReceiver has a different CryptoKey")
+	}
+	if !bytes.Equal(rc.AAD, sd.opts.AAD) {
+		return sd.logError(0xEBCC94,
+			"Sender.LocalReceiver has a different AAD")
+	}
+	if err := rc.authorizeLocal(sd.SenderID, sd.AuthToken); err != nil {
+		return sd.logError(0xE9B5F0, "Sender.LocalReceiver:", err)
+	}
+	if sd.Config.VerboseSender {
+		sd.logDebug("\n" + strings.Repeat("-", 80) + "\n" +
+			fmt.Sprintf("Send key: %s size: %d to local receiver", k, len(v)))
+	}
+	sealed, err := sd.seal(k, v)
+	if err != nil {
+		return sd.logError(0xE2A5B0, err)
+	}
+	sd.packets = nil
+	sd.stats = udpStats{}
+	t0 := time.Now()
+	reply, err := rc.receiveLocal(k, sealed, sd.SenderID)
+	sd.stats.transferTime = time.Since(t0)
+	if err != nil {
+		err = sd.logError(0xECF41B, err)
+		sd.putDeadLetter(k, v, err)
+		return err
+	}
+	sd.stats.bytesDelivered = int64(len(v))
+	sd.stats.valueBytes = int64(len(v))
+	sd.stats.compressedBytes = int64(len(v))
+	sd.setReply(reply)
+	return nil
+} //                                                                   sendLocal
+
 // makePackets creates the packets for sending over UDP,
 // by partitioning compressed message 'comp'
 func (sd *Sender) makePackets(k string, comp []byte) error {
+	return sd.splitPackets(k, comp, sd.payloadSize())
+} //                                                                 makePackets
+
+// resplitPackets re-creates the packets of the current data item after
+// the path MTU has shrunk during its transfer. There are always more new
+// packets than old ones, because the Receiver tells apart the pieces
+// of the old and new layouts of an item by their packet count.
+func (sd *Sender) resplitPackets() error {
+	length, prev := len(sd.comp), len(sd.packets)
+	max := sd.payloadSize()
+	if prev > 0 && (length+max-1)/max <= prev {
+		max = length / (prev + 1)
+	}
+	if max < 1 {
+		max = 1
+	}
+	return sd.splitPackets(sd.key, sd.comp, max)
+} //                                                              resplitPackets
+
+// splitPackets partitions compressed message 'comp' into
+// packets with a payload of at most 'max' bytes each
+func (sd *Sender) splitPackets(k string, comp []byte, max int) error {
 	length := len(comp)
 	if length == 0 {
+		sd.packetsMu.Lock()
 		sd.packets = nil
+		sd.packetsMu.Unlock()
 		return nil
 	}
-	max := sd.Config.PacketPayloadSize
+	var chain [][]byte
+	if size := sd.Config.VerifiedBlockSize; size > 0 {
+		if max > size {
+			max = size // so every block has a piece that ends in it
+		}
+		chain = sd.Config.blockChain(comp, size)
+	}
 	n := length / max
 	if (n * max) < length {
 		n++
 	}
+	compField := ""
+	if sd.Config.HashCompressed {
+		compField = fmt.Sprintf("comp:%X ", sd.Config.hash(comp))
+	}
+	if sd.Config.ResumeTransfers {
+		compField += resumeFieldTag
+	}
+	if sd.chunked {
+		compField += chunkedFieldTag
+	}
+	compField += fmt.Sprintf("%s%X ", capabilitiesField,
+		uint32(sd.Config.capabilities()))
 	packets := make([]senderPacket, n)
 	for i := range packets {
 		a := i * max
@@ -404,8 +1132,10 @@ func (sd *Sender) makePackets(k string, comp []byte) error {
 			b = len(comp)
 		}
 		header := tagFragment + fmt.Sprintf(
-			"key:%s hash:%X sn:%d count:%d\n",
-			k, sd.dataHash, i+1, n,
+			"key:%s hash:%X %s%s%ssn:%d count:%d\n",
+			k, sd.dataHash, compField,
+			makeBlockFields(chain, sd.Config.VerifiedBlockSize, b),
+			makePieceSumField(comp[a:b]), i+1, n,
 		)
 		pk, err := sd.makePacket(append([]byte(header), comp[a:b]...))
 		if err != nil {
@@ -413,9 +1143,51 @@ func (sd *Sender) makePackets(k string, comp []byte) error {
 		}
 		packets[i] = *pk
 	}
+	sd.packetsMu.Lock()
 	sd.packets = packets
+	sd.packetsMu.Unlock()
+	sd.mu.Lock()
+	sd.progress = 0
+	sd.mu.Unlock()
 	return nil
-} //                                                                 makePackets
+} //                                                                splitPackets
+
+// splitSubPackets splits the piece carried by packet 'pk' into sub-pieces
+// of at most Config.SubPieceSize bytes, to be resent in packets of their
+// own. Their headers number them with a "sub:" field. It does nothing
+// if SubPieceSize is zero, or if the piece isn't larger than that.
+func (sd *Sender) splitSubPackets(pk *senderPacket) error {
+	size := sd.Config.SubPieceSize
+	end := bytes.IndexByte(pk.data, '\n')
+	sn := bytes.Index(pk.data, []byte(" sn:"))
+	if end == -1 || sn == -1 || sn > end {
+		return sd.logError(0xE040D1, "bad packet header")
+	}
+	payload := pk.data[end+1:]
+	if size < 1 || len(payload) <= size {
+		return nil
+	}
+	sumField := makePieceSumField(payload) // replaced by each sub-piece's
+	n := (len(payload) + size - 1) / size
+	subs := make([]senderPacket, n)
+	for i := range subs {
+		a := i * size
+		b := a + size
+		if b > len(payload) {
+			b = len(payload)
+		}
+		header := strings.Replace(string(pk.data[:sn+1]), sumField, "", 1) +
+			fmt.Sprintf("sub:%d/%d ", i+1, n) +
+			makePieceSumField(payload[a:b]) + string(pk.data[sn+1:end+1])
+		sub, err := sd.makePacket(append([]byte(header), payload[a:b]...))
+		if err != nil {
+			return sd.logError(0xE76B7A, err)
+		}
+		subs[i] = *sub
+	}
+	pk.subPackets = subs
+	return nil
+} //                                                             splitSubPackets
 
 // connect connects to the Receiver at Sender.Address and
 // returns a new UDP connection or nil and an error instance.
@@ -423,6 +1195,24 @@ func (sd *Sender) makePackets(k string, comp []byte) error {
 // Note that it doesn't change the value of Sender.conn
 //
 func (sd *Sender) connect() (netUDPConn, error) {
+	if pc := sd.PacketConn; pc != nil {
+		return sd.connectDI(func(_ string, _, raddr *net.UDPAddr,
+		) (netUDPConn, error) {
+			return &suppliedConn{PacketConn: pc, raddr: raddr}, nil
+		})
+	}
+	if sd.Multicast {
+		return sd.connectDI(dialGroup)
+	}
+	if tr := sd.Config.Transport; tr != nil {
+		return sd.connectDI(func(network string, laddr, raddr *net.UDPAddr,
+		) (netUDPConn, error) {
+			return dialTransport(tr, network, laddr, raddr)
+		})
+	}
+	if err := noUDPSockets(); err != nil {
+		return nil, sd.logError(0xE1F2B6, err)
+	}
 	return sd.connectDI(netDialUDP)
 } //                                                                     connect
 
@@ -431,12 +1221,29 @@ func (sd *Sender) connect() (netUDPConn, error) {
 func (sd *Sender) connectDI(
 	netDialUDP func(_ string, _, _ *net.UDPAddr) (netUDPConn, error),
 ) (netUDPConn, error) {
-	udpAddr, err := net.ResolveUDPAddr("udp", sd.Address)
+	network := sd.Config.network()
+	udpAddr, err := net.ResolveUDPAddr(network, sd.Address)
 	if err != nil {
 		return nil, sd.logError(0xEC7C6B, "ResolveUDPAddr:", err)
 	}
+	laddr, err := sd.Config.localUDPAddr(udpAddr)
+	if err != nil {
+		return nil, sd.logError(0xE6B3C8, err)
+	}
 	var conn netUDPConn
-	conn, err = netDialUDP("udp", nil, udpAddr)
+	if sd.LocalPort == 0 {
+		conn, err = netDialUDP(network, laddr, udpAddr)
+	} else {
+		_, err = bindPort(sd.Config, sd.LocalPort, func(port int) error {
+			addr := &net.UDPAddr{Port: port}
+			if laddr != nil {
+				addr.IP, addr.Zone = laddr.IP, laddr.Zone
+			}
+			var err error
+			conn, err = netDialUDP(network, addr, udpAddr)
+			return err
+		})
+	}
 	if err != nil {
 		return nil, sd.logError(0xE15CE1, err)
 	}
@@ -444,86 +1251,406 @@ func (sd *Sender) connectDI(
 	if err != nil {
 		return nil, sd.logError(0xE5F9C7, err)
 	}
+	err = enableICMPErrors(conn)
+	if err != nil && sd.Config.VerboseSender {
+		sd.logDebug("ICMP error reporting not enabled:", err)
+	}
 	return conn, nil
 } //                                                                   connectDI
 
-// sendUndeliveredPackets sends all undelivered
-// packets to the destination Receiver.
+// reconnect replaces a connection that failed with a fatal socket error
+// by a new one, so that the packets not yet delivered can be resent.
+func (sd *Sender) reconnect(connect func() (netUDPConn, error)) error {
+	if sd.Config.VerboseSender {
+		sd.logDebug("Reconnecting to", sd.Address)
+	}
+	sd.trace.instant("reconnect", 0, time.Now(), nil)
+	sd.close()
+	newConn, err := connect()
+	if err != nil {
+		return sd.logError(0xE9C65B, err)
+	}
+	sd.conn = newConn
+	if sd.Config.KeyExchange {
+		err = sd.handshake(newConn)
+		if err != nil {
+			sd.close()
+			return sd.logError(0xE20632, err)
+		}
+	}
+	sd.startLoops(newConn)
+	return nil
+} //                                                                   reconnect
+
+// startLoops starts collectConfirmations() and sendKeepalives()
+// in their own goroutines, to run on 'conn' until close().
+func (sd *Sender) startLoops(conn netUDPConn) {
+	done := make(chan struct{})
+	sd.done = done
+	sd.loops.Add(2)
+	go func() {
+		defer sd.loops.Done()
+		sd.collectConfirmations(conn, done)
+	}()
+	go func() {
+		defer sd.loops.Done()
+		sd.sendKeepalives(conn, done)
+	}()
+} //                                                                  startLoops
+
+// isDone returns true once channel 'done' has been closed.
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+} //                                                                      isDone
+
+// sendUndeliveredPackets sends all undelivered packets to the
+// destination Receiver. Large pieces that were lost are resent
+// in sub-pieces, if Config.SubPieceSize allows it.
 func (sd *Sender) sendUndeliveredPackets() error {
-	var wg sync.WaitGroup
+	workers := newWorkerPool(sd.Config.MaxWorkers)
+	defer workers.wait()
 	n := len(sd.packets)
 	for i := 0; i < n; i++ {
-		pk := &sd.packets[i]
-		if pk.IsDelivered() {
-			continue
+		event, parts, err := sd.partsToSend(i)
+		if err != nil {
+			return sd.logError(0xE58BCE, err)
 		}
-		time.Sleep(sd.Config.SendPacketInterval)
-		wg.Add(1)
-		go func() {
-			err := pk.Send(sd.conn, sd.Config.Cipher)
-			if err != nil {
-				_ = sd.logError(0xE67BA4, err)
+		tid := i + 1
+		for _, part := range parts {
+			if sd.failure() != nil {
+				return nil // e.g. unreachable, or the Send's context was cancelled
+			}
+			time.Sleep(sd.Config.SendPacketInterval)
+			now := time.Now()
+			wait := sd.receiverLimit().Reserve(len(part.data), now)
+			if d := sd.sendLimit().Reserve(len(part.data), now); d > wait {
+				wait = d
+			}
+			if rc := sd.Config.RateController; rc != nil {
+				if d := rc.Reserve(len(part.data), time.Now()); d > wait {
+					wait = d
+				}
+			}
+			if wait > 0 {
+				err := sd.sleep(wait)
+				if err != nil {
+					return nil // the Send's context was cancelled
+				}
 			}
-			wg.Done()
-		}()
+			part := part
+			workers.run(func() {
+				err := sd.sendPacket(part)
+				if err != nil {
+					_ = sd.logError(0xE67BA4, err)
+				} else {
+					if event == "resend" {
+						atomic.AddInt64(&sd.stats.packetsResent, 1)
+					}
+					sd.trace.instant(event, tid, part.sentTime,
+						map[string]interface{}{"bytes": len(part.data)})
+				}
+			})
+		}
 	}
-	wg.Wait()
 	return nil
 } //                                                      sendUndeliveredPackets
 
+// partsToSend returns the parts of packet number 'i' that must be
+// sent, and "send" or "resend" for the trace. A lost piece is split in
+// sub-pieces before it's resent, if the Receiver supports them.
+func (sd *Sender) partsToSend(i int) (string, []*senderPacket, error) {
+	sd.packetsMu.Lock()
+	defer sd.packetsMu.Unlock()
+	pk := &sd.packets[i]
+	if pk.IsDelivered() || pk.resumed {
+		return "", nil, nil
+	}
+	event := "send"
+	if pk.sendCount > 0 || pk.subPackets != nil {
+		event = "resend"
+		if pk.subPackets == nil && sd.peerSupports(CapSubPieces) {
+			err := sd.splitSubPackets(pk)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	return event, pk.undeliveredParts(), nil
+} //                                                                 partsToSend
+
+// sendPacket sends packet 'pk', sending it again after a short delay if
+// the socket reports a transient error. After a fatal error, it marks
+// the connection as broken, so transferItem() replaces it.
+func (sd *Sender) sendPacket(pk *senderPacket) error {
+	delay := sendTransientDelay
+	for attempt := 0; ; attempt++ {
+		t0 := time.Now()
+		cphr := sequencedCipher{sd.cipher(), &sd.seq}
+		err := pk.Send(sd.conn, cphr, &sd.packetsMu)
+		if err == nil {
+			// Send() encrypts the packet, then sets sentTime and writes it
+			atomic.AddInt64(&sd.stats.packetsSent, 1)
+			atomic.AddInt64(&sd.stats.bytesSent, int64(len(pk.data)))
+			atomic.AddInt64(&sd.stats.encryptNanos,
+				int64(pk.sentTime.Sub(t0)))
+			atomic.AddInt64(&sd.stats.sendNanos,
+				int64(time.Since(pk.sentTime)))
+			atomic.StoreInt64(&sd.lastSent, pk.sentTime.UnixNano())
+		}
+		switch classifySocketError(err) {
+		case socketErrorTransient:
+			if attempt < sendTransientRetries {
+				time.Sleep(delay)
+				delay *= 2
+				continue
+			}
+		case socketErrorFatal:
+			sd.mu.Lock()
+			sd.connBroken = true
+			sd.mu.Unlock()
+		}
+		return err
+	}
+} //                                                                  sendPacket
+
 // collectConfirmations enters a loop that receives confirmation packets
-// from the sender, and marks all confirmed packets as delivered.
-func (sd *Sender) collectConfirmations() {
-	encReply := make([]byte, sd.Config.PacketSizeLimit)
-	for sd.conn != nil {
-		// 'encReply' is overwritten after every readAndDecrypt
-		recv, addr, err := readAndDecrypt(sd.conn, sd.Config.ReplyTimeout,
-			sd.Config.Cipher, encReply)
+// from the sender through 'conn', and marks all confirmed packets as
+// delivered, until 'done' is closed.
+func (sd *Sender) collectConfirmations(conn netUDPConn, done <-chan struct{}) {
+	encReply := newReadBuffer(sd.Config.PacketSizeLimit)
+	cphr := sd.cipher()
+	workers := newWorkerPool(sd.Config.MaxWorkers)
+	defer workers.wait()
+	for !isDone(done) {
+		// 'encReply' is overwritten after every readDatagram
+		data, addr, err := readDatagram(conn, sd.Config.ReplyTimeout,
+			encReply, sd.Config.PacketSizeLimit)
 		if err == errClosed {
 			break
 		}
+		var recv []byte
+		if err == nil {
+			recv, err = cphr.Decrypt(data)
+			if err != nil {
+				atomic.AddInt64(&sd.stats.repliesRejected, 1)
+				_ = sd.logError(0xE46C13, "reply from", addr, err)
+				continue
+			}
+		}
 		if err != nil {
-			_ = sd.logError(0xE9D1CC, err)
+			sd.handleReadError(conn, err)
+			if classifySocketError(err) == socketErrorFatal {
+				break // transferItem() reconnects and restarts this loop
+			}
 			continue
 		}
-		if !bytes.HasPrefix(recv, []byte(tagConfirmation)) {
-			_ = sd.logError(0xE96D3B, "bad reply header")
+		if bytes.HasPrefix(recv, []byte(tagNack)) {
+			sd.receiveNack(recv)
+			continue
+		}
+		if bytes.HasPrefix(recv, []byte(tagKeepalive)) {
+			continue // from a peer still punching through (see Rendezvous)
+		}
+		confirmedHash, rate, err := readConfirmation(recv)
+		if err != nil {
+			_ = sd.logError(0xE96D3B, err)
 			if sd.Config.VerboseSender {
-				sd.logInfo("ERROR received:", len(recv), "bytes")
+				sd.logDebug("ERROR received:", len(recv), "bytes")
 			}
 			continue
 		}
-		confirmedHash := recv[len(tagConfirmation):]
+		sd.receiverLimit().setRate(float64(rate))
+		if caps, ok := confirmationCaps(recv); ok {
+			sd.setPeerCapabilities(caps)
+		}
 		if sd.Config.VerboseSender {
-			sd.logInfo("Sender received", len(recv), "bytes from", addr)
-		}
-		go func(confirmedHash []byte) {
-			for i, pk := range sd.packets {
-				if bytes.Equal(pk.sentHash, confirmedHash) {
-					sd.packets[i].confirmedTime = time.Now()
-					sd.packets[i].confirmedHash = confirmedHash
-					break
-				}
-			}
-		}(confirmedHash)
+			sd.logDebug("Sender received", len(recv), "bytes from", addr)
+		}
+		if _, reply := splitConfirmationReply(recv); reply != nil &&
+			sd.confirmsCurrentItem(confirmedHash) {
+			sd.setReply(reply) // before the item can be fully confirmed
+		}
+		if confirmsDone(recv) && sd.confirmsCurrentItem(confirmedHash) {
+			sd.receiveDone()
+			continue
+		}
+		workers.run(func() {
+			sd.confirmPacket(confirmedHash)
+		})
 	}
 } //                                                        collectConfirmations
 
+// confirmPacket marks the packet that carries 'hash', which is a piece
+// (or part of a piece) of the current data item, as delivered, since
+// the Receiver has confirmed it. It ignores hashes of other items.
+func (sd *Sender) confirmPacket(hash []byte) {
+	sd.packetsMu.Lock()
+	var pk, piece *senderPacket
+	tid := 0
+	for i := range sd.packets {
+		if pk = sd.packets[i].confirmedBy(hash); pk != nil {
+			piece, tid = &sd.packets[i], i+1
+			break
+		}
+	}
+	if pk == nil {
+		sd.packetsMu.Unlock()
+		return
+	}
+	wasDelivered := piece.IsDelivered()
+	first := pk.confirmedHash == nil
+	pk.confirmedTime = time.Now()
+	pk.confirmedHash = hash
+	sentTime, confirmedTime := pk.sentTime, pk.confirmedTime
+	delivered := !wasDelivered && piece.IsDelivered()
+	sd.packetsMu.Unlock()
+	sd.trace.span("in flight", tid, sentTime, confirmedTime, nil)
+	if first {
+		rtt := confirmedTime.Sub(sentTime)
+		atomic.AddInt64(&sd.stats.rttNanos, int64(rtt))
+		atomic.AddInt64(&sd.stats.rttCount, 1)
+		sd.updateRTT(rtt)
+		if rc := sd.Config.RateController; rc != nil {
+			rc.OnAck(len(pk.data), rtt)
+		}
+	}
+	if delivered {
+		sd.pieceDelivered(piece)
+	}
+} //                                                               confirmPacket
+
+// handleReadError handles an error that occurred while reading
+// confirmations. Errors caused by ICMP messages make the current Send
+// fail immediately (e.g. "port unreachable" gives ErrReceiverUnreachable)
+// or reduce the path MTU cached for Sender.Address (for "fragmentation
+// needed"). Fatal socket errors make transferItem() reconnect.
+// Other errors are just logged. 'conn' is the connection read from.
+func (sd *Sender) handleReadError(conn netUDPConn, err error) {
+	if classifySocketError(err) == socketErrorFatal {
+		_ = sd.logError(0xEDD75D, err)
+		sd.mu.Lock()
+		sd.connBroken = true
+		sd.mu.Unlock()
+		return
+	}
+	ie := readICMPError(conn)
+	if ie == nil {
+		ie = icmpErrorOf(err)
+	}
+	switch {
+	case ie == nil:
+		_ = sd.logError(0xE9D1CC, err)
+	case ie.mtu > 0:
+		if sd.Config.VerboseSender {
+			sd.logDebug("Path MTU to", sd.Address, "reduced to", ie.mtu)
+		}
+		pathMTUs.Put(sd.Address, ie.mtu, sd.Config.MTUCacheExpiry)
+		sd.mu.Lock()
+		sd.mtuChanged = true
+		sd.mu.Unlock()
+	case ie.Unreachable():
+		sd.mu.Lock()
+		if sd.failed == nil {
+			sd.failed = ErrReceiverUnreachable
+		}
+		sd.mu.Unlock()
+	}
+} //                                                             handleReadError
+
+// receiveNack handles a NACK packet, in which the Receiver lists the
+// missing pieces of the data item. Packets reported as received are
+// marked as delivered, even if their confirmations were lost. If any
+// packets are missing, waitForAllConfirmations() stops waiting, so
+// that transferItem() resends them at once.
+func (sd *Sender) receiveNack(recv []byte) {
+	nr, err := readNack(recv)
+	if err != nil {
+		_ = sd.logError(0xE58C90, err)
+		return
+	}
+	sd.packetsMu.Lock()
+	if nr.key != sd.key || !bytes.Equal(nr.hash, sd.dataHash) ||
+		nr.count != len(sd.packets) {
+		sd.packetsMu.Unlock()
+		return // for an earlier item, or before the packets were resplit
+	}
+	now := time.Now()
+	missing := 0
+	var delivered []*senderPacket
+	for i := range sd.packets {
+		pk := &sd.packets[i]
+		if pk.sendCount == 0 && !pk.resumed {
+			continue
+		}
+		if pk.IsDelivered() {
+			if sd.Multicast && nr.missing(i) {
+				sd.repairPiece(pk) // confirmed by another Receiver
+				missing++
+			}
+			continue
+		}
+		if nr.received(i) {
+			pk.confirmedTime = now
+			pk.confirmedHash = pk.sentHash
+			delivered = append(delivered, pk)
+		} else if nr.missing(i) {
+			pk.resumed = false
+			missing++
+		}
+	}
+	sd.packetsMu.Unlock()
+	for _, pk := range delivered {
+		sd.pieceDelivered(pk)
+	}
+	if sd.Config.VerboseSender {
+		sd.logDebug("Sender received NACK,", missing, "packets missing")
+	}
+	sd.trace.instant("nack", 0, now,
+		map[string]interface{}{"missing": missing})
+	if missing > 0 {
+		sd.mu.Lock()
+		sd.nacked = true
+		sd.mu.Unlock()
+	}
+} //                                                                 receiveNack
+
 // waitForAllConfirmations waits for all confirmation packets to
 // be received from the receiver. Since UDP packet delivery is not
 // guaranteed, some confirmations may not be received. This method
-// will only wait for the duration specified in Config.ReplyTimeout.
+// will only wait for the duration specified in Config.ReplyTimeout,
+// and makes the Send fail when a limit such as Config.StallTimeout
+// has been exceeded (see sendBudget). It stops waiting early when a
+// NACK from the Receiver reports missing packets.
 func (sd *Sender) waitForAllConfirmations() {
 	if sd.Config.VerboseSender {
-		sd.logInfo("Waiting . . .")
+		sd.logDebug("Waiting . . .")
 	}
+	sd.takeNacked() // NACKs received while sending are out of date
 	t0 := time.Now()
 	for {
 		time.Sleep(sd.Config.SendWaitInterval)
 		if sd.DeliveredAllParts() {
 			if sd.Config.VerboseSender {
-				sd.logInfo("Delivered all packets")
+				sd.logDebug("Delivered all packets")
+			}
+			break
+		}
+		if sd.failure() != nil || sd.isConnBroken() || sd.takeNacked() {
+			break
+		}
+		now := time.Now()
+		sd.budget.update(sd.countDelivered(), now)
+		if err := sd.budget.check(sd.Config, now); err != nil {
+			sd.mu.Lock()
+			if sd.failed == nil {
+				sd.failed = err
 			}
+			sd.mu.Unlock()
 			break
 		}
 		since := time.Since(t0)
@@ -533,27 +1660,43 @@ func (sd *Sender) waitForAllConfirmations() {
 			break
 		}
 	}
-	for _, pk := range sd.packets {
+	t1 := time.Now()
+	sd.stats.ackWaitTime += t1.Sub(t0)
+	lost := 0
+	sd.packetsMu.Lock()
+	for i, pk := range sd.packets {
 		if pk.IsDelivered() {
 			sd.stats.bytesDelivered += int64(len(pk.data))
 			sd.stats.packetsDelivered++
 		} else {
 			sd.stats.bytesLost += int64(len(pk.data))
 			sd.stats.packetsLost++
+			sd.trace.instant("unconfirmed", i+1, t1, nil)
+			lost++
 		}
 	}
+	sd.packetsMu.Unlock()
+	if rc := sd.Config.RateController; rc != nil && lost > 0 {
+		rc.OnLoss(lost)
+	}
 	if sd.Config.VerboseSender {
-		sd.logInfo("Waited:", time.Since(t0))
+		sd.logDebug("Waited:", time.Since(t0))
 	}
 } //                                                     waitForAllConfirmations
 
-// close closes the UDP connection.
+// close closes the UDP connection, and waits until the goroutines
+// started by startLoops() have stopped using it.
 func (sd *Sender) close() {
 	if sd.conn == nil {
 		return
 	}
+	if sd.done != nil {
+		close(sd.done)
+		sd.done = nil
+	}
 	err := sd.conn.Close()
 	sd.conn = nil
+	sd.loops.Wait()
 	if err != nil {
 		_ = sd.logError(0xEA7D7E, err)
 	}
@@ -562,7 +1705,7 @@ func (sd *Sender) close() {
 // endSend finializes Send() by checking if the message was delivered
 func (sd *Sender) endSend() error {
 	if !sd.DeliveredAllParts() {
-		return sd.logError(0xE1C3A7, "undelivered packets")
+		return sd.logError(0xE1C3A7, ErrUndeliveredPackets)
 	}
 	if sd.Config.VerboseSender {
 		sd.LogStats()
@@ -573,11 +1716,70 @@ func (sd *Sender) endSend() error {
 // -----------------------------------------------------------------------------
 // # Internal Helper Methods (sd *Sender)
 
+// cipher returns Config.Cipher, or the cipher of the session key
+// negotiated with the Receiver (see Config.KeyExchange), bound to
+// SendOptions.AAD of the current data item
+func (sd *Sender) cipher() SymmetricCipher {
+	base := sd.Config.Cipher
+	if sd.Config.KeyExchange && sd.session != nil {
+		base = sd.session
+	}
+	cphr, err := bindAAD(base, sd.opts.AAD)
+	if err != nil {
+		return sd.Config.Cipher // beginSend() has already failed
+	}
+	return cphr
+} //                                                                      cipher
+
+// failure returns the error that made the current Send fail
+// immediately, or nil if there is no such error. This includes
+// the error of the Send's context, once it has been cancelled.
+func (sd *Sender) failure() error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.failed == nil && sd.ctx != nil {
+		return context.Cause(sd.ctx)
+	}
+	return sd.failed
+} //                                                                     failure
+
+// sleep pauses for duration 'd', or until the context of the current
+// Send is cancelled, in which case it returns the cancellation cause.
+// (That's the context's error, unless CancelAll() cancelled the Send.)
+func (sd *Sender) sleep(d time.Duration) error {
+	_, err := sd.sleepUntilChange(d, nil)
+	return err
+} //                                                                       sleep
+
+// sleepUntilChange pauses like sleep(), but also stops when 'change' is
+// closed, e.g. on a network change (see networkChangeOf), in which case
+// it returns true. A nil 'change' never stops it.
+func (sd *Sender) sleepUntilChange(d time.Duration, change <-chan struct{},
+) (bool, error) {
+	var done <-chan struct{}
+	if sd.ctx != nil {
+		done = sd.ctx.Done()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return false, nil
+	case <-change:
+		return true, nil
+	case <-done:
+		return false, context.Cause(sd.ctx)
+	}
+} //                                                            sleepUntilChange
+
 // logError returns a new error generated by joining 'id' and 'a' and
 // prints to Sender.Config.LogWriter (if not nil) to log the error.
 func (sd *Sender) logError(id uint32, a ...interface{}) error {
 	ret := makeError(id, a...)
-	if sd.Config != nil && sd.Config.LogWriter != nil {
+	if lg := sd.Config.logger(); lg != nil {
+		msg, fields := errorRecord("sender", id, ret)
+		lg.Error(msg, fields...)
+	} else if sd.Config != nil && sd.Config.LogWriter != nil {
 		s := ret.Error()
 		fmt.Fprintln(sd.Config.LogWriter, s)
 	}
@@ -585,11 +1787,34 @@ func (sd *Sender) logError(id uint32, a ...interface{}) error {
 } //                                                                    logError
 
 // logInfo writes to Sender.Config.LogWriter (if not nil) to log a message.
+// If Config.Logger is set, passes the message to its Info method instead.
 func (sd *Sender) logInfo(a ...interface{}) {
-	if sd.Config != nil && sd.Config.LogWriter != nil {
+	sd.logAt(false, a...)
+} //                                                                     logInfo
+
+// logDebug logs a message like logInfo(), but at the Debug level of
+// Config.Logger. It is used for the messages enabled by VerboseSender.
+func (sd *Sender) logDebug(a ...interface{}) {
+	sd.logAt(true, a...)
+} //                                                                    logDebug
+
+// logAt implements logInfo() and logDebug().
+func (sd *Sender) logAt(debug bool, a ...interface{}) {
+	switch lg := sd.Config.logger(); {
+	case lg != nil:
+		msg := logMessage(a...)
+		if msg == "" {
+			return
+		}
+		if debug {
+			lg.Debug(msg, "component", "sender")
+			return
+		}
+		lg.Info(msg, "component", "sender")
+	case sd.Config != nil && sd.Config.LogWriter != nil:
 		fmt.Fprintln(sd.Config.LogWriter, a...)
 	}
-} //                                                                     logInfo
+} //                                                                       logAt
 
 // makePacket prepares a packet for immediate sending: it stores,
 // hashes data and sets the packet's sentTime to current time.
@@ -597,6 +1822,7 @@ func (sd *Sender) logInfo(a ...interface{}) {
 // The size of the packet must not exceed Config.PacketSizeLimit
 //
 func (sd *Sender) makePacket(data []byte) (*senderPacket, error) {
+	data = sd.signFragment(data)
 	if len(data) > sd.Config.PacketSizeLimit {
 		return nil, sd.logError(0xE71F9B, "len(data) > Config.PacketSizeLimit")
 	}
@@ -610,16 +1836,239 @@ func (sd *Sender) makePacket(data []byte) (*senderPacket, error) {
 	return &pk, nil
 } //                                                                  makePacket
 
+// addLabelStats adds the statistics of the data item just sent, i.e. the
+// increase of sd.stats since they were 'before', to the item's label.
+func (sd *Sender) addLabelStats(before udpStats) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.labels == nil {
+		sd.labels = make(map[string]udpStats)
+	}
+	st := sd.labels[sd.opts.Label]
+	sd.labels[sd.opts.Label] = st.add(sd.stats.load().sub(before))
+} //                                                               addLabelStats
+
+// putDeadLetter hands an undelivered data item to Config.DeadLetter,
+// if one is specified. Any error returned by the DeadLetter is logged.
+func (sd *Sender) putDeadLetter(k string, v []byte, reason error) {
+	if sd.Config.DeadLetter == nil {
+		return
+	}
+	item := UndeliveredItem{
+		Address: sd.Address,
+		Key:     k,
+		Value:   v,
+		Reason:  reason,
+		Time:    time.Now(),
+		Stats:   makeTransferStats(sd.stats),
+	}
+	err := sd.Config.DeadLetter.Put(&item)
+	if err != nil {
+		_ = sd.logError(0xEF1EA9, "DeadLetter.Put:", err)
+	}
+} //                                                               putDeadLetter
+
+// resetConfirmations marks all packets of the current data item as
+// undelivered, so that they are all sent again when the whole item is
+// retried. (The Receiver may have lost the pieces it already confirmed.)
+func (sd *Sender) resetConfirmations() {
+	sd.packetsMu.Lock()
+	for i := range sd.packets {
+		sd.packets[i].confirmedHash = nil
+		sd.packets[i].confirmedTime = time.Time{}
+		sd.packets[i].subPackets = nil
+	}
+	sd.packetsMu.Unlock()
+	sd.mu.Lock()
+	sd.progress = 0
+	sd.mu.Unlock()
+} //                                                          resetConfirmations
+
+// countDelivered returns the number of packets of the
+// current data item that have been confirmed so far.
+func (sd *Sender) countDelivered() int {
+	sd.packetsMu.Lock()
+	defer sd.packetsMu.Unlock()
+	n := 0
+	for _, pk := range sd.packets {
+		if pk.IsDelivered() {
+			n++
+		}
+	}
+	return n
+} //                                                              countDelivered
+
+// pieceDelivered adds the piece carried by packet 'pk', which has just
+// been delivered, to the progress reported to Config.OnProgress.
+func (sd *Sender) pieceDelivered(pk *senderPacket) {
+	onProgress := sd.Config.OnProgress
+	if onProgress == nil {
+		return
+	}
+	size := len(pk.data) - (bytes.IndexByte(pk.data, '\n') + 1)
+	sd.mu.Lock()
+	sd.progress += int64(size)
+	progress := sd.progress
+	sd.mu.Unlock()
+	onProgress(sd.key, progress, int64(len(sd.comp)))
+} //                                                              pieceDelivered
+
+// receiverLimit returns the TokenBucket that paces packets to the rate
+// advertised by the Receiver. It is shared by the Senders of SendMany().
+func (sd *Sender) receiverLimit() *TokenBucket {
+	return &sd.owner().rxLimit
+} //                                                               receiverLimit
+
+// sendLimit returns the TokenBucket that paces the packets sent to
+// Config.MaxSendBytesPerSecond. Like receiverLimit(), it is shared
+// with the Senders created by SendMany().
+func (sd *Sender) sendLimit() *TokenBucket {
+	return &sd.owner().txLimit
+} //                                                                   sendLimit
+
+// takeNacked returns true (and clears the flag) if a NACK has
+// reported missing packets since it was last called.
+func (sd *Sender) takeNacked() bool {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	ret := sd.nacked
+	sd.nacked = false
+	return ret
+} //                                                                  takeNacked
+
+// takeMTUChanged returns true (and clears the flag) if a
+// smaller path MTU has been reported since it was last called.
+func (sd *Sender) takeMTUChanged() bool {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	ret := sd.mtuChanged
+	sd.mtuChanged = false
+	return ret
+} //                                                              takeMTUChanged
+
+// isConnBroken returns true if a fatal socket error has made
+// the connection unusable, without clearing the flag.
+func (sd *Sender) isConnBroken() bool {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	return sd.connBroken
+} //                                                                isConnBroken
+
+// takeConnBroken returns true (and clears the flag) if a fatal
+// socket error has made the connection unusable.
+func (sd *Sender) takeConnBroken() bool {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	ret := sd.connBroken
+	sd.connBroken = false
+	return ret
+} //                                                              takeConnBroken
+
+// writeTrace writes the timeline of the data item just sent to
+// Config.TraceWriter, ending it with a span covering the whole item.
+func (sd *Sender) writeTrace() {
+	pt := sd.trace
+	sd.trace = nil
+	pt.span("item", 0, sd.startTime, time.Now(), map[string]interface{}{
+		"key":       sd.key,
+		"packets":   len(sd.packets),
+		"delivered": sd.countDelivered(),
+	})
+	w := sd.Config.TraceWriter
+	owner := sd.owner()
+	owner.traceMu.Lock()
+	defer owner.traceMu.Unlock()
+	if owner.traceOut != nil && !sameWriter(owner.traceOut, w) {
+		// Config.TraceWriter has been changed: finish the old trace
+		err := closeTrace(owner.traceOut)
+		if err != nil {
+			_ = sd.logError(0xE8D6A1, err)
+		}
+		owner.traceOut = nil
+	}
+	err := pt.writeTo(w, owner.traceOut != nil)
+	if err != nil {
+		_ = sd.logError(0xEEFDED, err)
+		return
+	}
+	owner.traceOut = w
+} //                                                                  writeTrace
+
+// payloadSize returns the number of data bytes to put in each packet.
+//
+// This is Config.PacketPayloadSize, unless a smaller path MTU has been
+// cached for Sender.Address, in which case the payload is reduced so
+// that packets are not fragmented along the way. It is also reduced
+// to fit the default Config.PacketSizeLimit if the Receiver has
+// advertised capabilities without CapJumboPackets.
+//
+func (sd *Sender) payloadSize() int {
+	ret := sd.Config.PacketPayloadSize
+	reserve := sd.Config.headerReserve() + sequenceHeaderSize +
+		sd.authFieldsSize()
+	if n := sd.Config.PacketSizeLimit - reserve; n < ret {
+		ret = n // to make room for the sequence and authentication fields
+	}
+	caps, known := sd.PeerCapabilities()
+	if known && !caps.Has(CapJumboPackets) {
+		n := defaultPacketSizeLimit - reserve
+		if n < ret {
+			ret = n
+		}
+	}
+	mtu, ok := pathMTUs.Get(sd.Address)
+	if !ok {
+		return ret
+	}
+	n := mtu - ipUDPHeaderSize - reserve
+	if n > 0 && n < ret {
+		ret = n
+	}
+	return ret
+} //                                                                 payloadSize
+
+// reportPathLoss tells the path MTU cache if any large packets were lost
+// while sending the current item, so that it can discard a cached MTU
+// that no longer fits the route to Sender.Address.
+//
+// If large packets were lost while small ones got through, and no MTU
+// is cached, the path probably drops packets that are too big without
+// reporting it, so it caches an MTU that only allows packets of up to
+// minSafeDatagramSize bytes, until Config.MTUCacheExpiry has passed.
+//
+func (sd *Sender) reportPathLoss() {
+	lostLarge, gotSmall := false, false
+	sd.packetsMu.Lock()
+	for _, pk := range sd.packets {
+		large := len(pk.data) > minSafeDatagramSize
+		if pk.IsDelivered() {
+			gotSmall = gotSmall || !large
+		} else {
+			lostLarge = lostLarge || large
+		}
+	}
+	sd.packetsMu.Unlock()
+	pathMTUs.ReportLoss(sd.Address, lostLarge, sd.Config.MTUCacheLossLimit)
+	if !lostLarge || !gotSmall {
+		return
+	}
+	if _, ok := pathMTUs.Get(sd.Address); !ok {
+		pathMTUs.Put(sd.Address, minSafeDatagramSize+ipUDPHeaderSize,
+			sd.Config.MTUCacheExpiry)
+	}
+} //                                                              reportPathLoss
+
 // validateAddress returns nil if Address is valid, or an error otherwise.
-// Presently it only checks if the address contains a valid port number.
+// Presently it only checks if the address contains a valid port number,
+// and that IPv6 addresses are enclosed in brackets, e.g. "[::1]:9876".
 func (sd *Sender) validateAddress() error {
 	ad := sd.Address
 	if strings.TrimSpace(ad) == "" {
 		return errors.New("missing Sender.Address")
 	}
 	var port int
-	if i := strings.Index(ad, ":"); i != -1 {
-		port, _ = strconv.Atoi(ad[i+1:])
+	if _, portStr, err := net.SplitHostPort(ad); err == nil {
+		port, _ = strconv.Atoi(portStr)
 	}
 	if port < 1 || port > 65535 {
 		return errors.New("invalid port in Sender.Address")
@@ -0,0 +1,53 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[sender_filter.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"net/netip"
+)
+
+// validatePrefixes returns an error if any of 'prefixes' is invalid,
+// e.g. a zero netip.Prefix.
+func validatePrefixes(prefixes []netip.Prefix) error {
+	for _, pfx := range prefixes {
+		if !pfx.IsValid() {
+			return makeError(0xE6B1F4, "invalid prefix:", pfx)
+		}
+	}
+	return nil
+} //                                                            validatePrefixes
+
+// senderAllowed returns true if datagrams from 'addr' are accepted:
+// when it is in none of DeniedSenders and, unless AllowedSenders is
+// empty, in one of AllowedSenders. IPv4 addresses received on a
+// dual-stack socket as IPv4-mapped IPv6 addresses are matched as IPv4.
+func (cf *Configuration) senderAllowed(addr net.Addr) bool {
+	if len(cf.AllowedSenders) == 0 && len(cf.DeniedSenders) == 0 {
+		return true
+	}
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok || udpAddr == nil {
+		return len(cf.AllowedSenders) == 0
+	}
+	ip := udpAddr.AddrPort().Addr().Unmap()
+	for _, pfx := range cf.DeniedSenders {
+		if pfx.Contains(ip) {
+			return false
+		}
+	}
+	if len(cf.AllowedSenders) == 0 {
+		return true
+	}
+	for _, pfx := range cf.AllowedSenders {
+		if pfx.Contains(ip) {
+			return true
+		}
+	}
+	return false
+} //                                                               senderAllowed
+
+// end
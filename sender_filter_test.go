@@ -0,0 +1,57 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /[sender_filter_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+)
+
+// -----------------------------------------------------------------------------
+// (cf *Configuration) senderAllowed(addr net.Addr) bool
+//
+// go test -run Test_Configuration_senderAllowed_
+
+// must accept only addresses in AllowedSenders, if any, and refuse
+// those in DeniedSenders, matching IPv4-mapped addresses as IPv4
+func Test_Configuration_senderAllowed_(t *testing.T) {
+	udp := func(s string) net.Addr {
+		return net.UDPAddrFromAddrPort(netip.MustParseAddrPort(s))
+	}
+	cf := NewDefaultConfig()
+	if !cf.senderAllowed(udp("203.0.113.7:5000")) {
+		t.Error("0xE2C6A5", "refused without lists")
+	}
+	cf.AllowedSenders = []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+	cf.DeniedSenders = []netip.Prefix{netip.MustParsePrefix("10.9.0.0/16")}
+	for _, tc := range []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3:5000", true},
+		{"[::ffff:10.1.2.3]:5000", true},
+		{"[fd00::2]:5000", true},
+		{"10.9.8.7:5000", false},
+		{"[::ffff:10.9.8.7]:5000", false},
+		{"203.0.113.7:5000", false},
+		{"[2001:db8::1]:5000", false},
+	} {
+		if got := cf.senderAllowed(udp(tc.addr)); got != tc.want {
+			t.Error("0xE7F3B0", tc.addr, "want:", tc.want, "got:", got)
+		}
+	}
+	// an invalid prefix must fail validation
+	cf.DeniedSenders = []netip.Prefix{{}}
+	if err := cf.Validate(); !matchError(err, "DeniedSenders") {
+		t.Error("0xE1B8D4", "wrong error:", err)
+	}
+}
+
+// end
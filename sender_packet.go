@@ -8,6 +8,7 @@ package udpt
 import (
 	"bytes"
 	"io"
+	"sync"
 	"time"
 )
 
@@ -19,18 +20,73 @@ type senderPacket struct {
 	sentTime      time.Time
 	confirmedHash []byte
 	confirmedTime time.Time
+	sendCount     int
+
+	// resumed is set when the Receiver confirmed the packet in an earlier
+	// Send of the same data item, so it isn't sent in the first round
+	// (see Config.ResumeTransfers)
+	resumed bool
+
+	// subPackets hold the piece in smaller packets, once it
+	// is resent in sub-pieces (see Config.SubPieceSize)
+	subPackets []senderPacket
 } //                                                                senderPacket
 
 // IsDelivered returns true if this packet has been successfully
-// delivered (by receiving a successful confirmation packet).
+// delivered (by receiving a successful confirmation packet), or
+// if all of its sub-packets have been delivered.
 func (pk *senderPacket) IsDelivered() bool {
-	ret := pk.confirmedHash != nil &&
-		bytes.Equal(pk.sentHash, pk.confirmedHash)
-	return ret
+	if pk.confirmedHash != nil && bytes.Equal(pk.sentHash, pk.confirmedHash) {
+		return true
+	}
+	for i := range pk.subPackets {
+		if !pk.subPackets[i].IsDelivered() {
+			return false
+		}
+	}
+	return len(pk.subPackets) > 0
 } //                                                                 IsDelivered
 
+// confirmedBy returns this packet, or the sub-packet,
+// whose hash is 'hash'. Returns nil if there is none.
+func (pk *senderPacket) confirmedBy(hash []byte) *senderPacket {
+	if bytes.Equal(pk.sentHash, hash) {
+		return pk
+	}
+	for i := range pk.subPackets {
+		if bytes.Equal(pk.subPackets[i].sentHash, hash) {
+			return &pk.subPackets[i]
+		}
+	}
+	return nil
+} //                                                                 confirmedBy
+
+// undeliveredParts returns this packet if it has no sub-packets.
+// Otherwise it returns the sub-packets that haven't been delivered.
+func (pk *senderPacket) undeliveredParts() []*senderPacket {
+	if len(pk.subPackets) == 0 {
+		return []*senderPacket{pk}
+	}
+	var ret []*senderPacket
+	for i := range pk.subPackets {
+		if !pk.subPackets[i].IsDelivered() {
+			ret = append(ret, &pk.subPackets[i])
+		}
+	}
+	return ret
+} //                                                            undeliveredParts
+
 // Send encrypts and sends this packet through connection 'conn'.
-func (pk *senderPacket) Send(conn netUDPConn, cipher SymmetricCipher) error {
+//
+// 'mu' is locked while the send time and count of the packet are
+// updated, since confirmations are handled in another goroutine
+// (see Sender.packetsMu). It isn't held while encrypting or writing.
+//
+func (pk *senderPacket) Send(
+	conn netUDPConn,
+	cipher SymmetricCipher,
+	mu sync.Locker,
+) error {
 	if conn == nil {
 		return makeError(0xE4B1BA, "nil connection")
 	}
@@ -41,11 +97,16 @@ func (pk *senderPacket) Send(conn netUDPConn, cipher SymmetricCipher) error {
 	if err != nil {
 		return makeError(0xEB39C3, err)
 	}
+	mu.Lock()
 	pk.sentTime = time.Now()
+	mu.Unlock()
 	_, err = io.Copy(conn, bytes.NewReader(ciphertext))
 	if err != nil {
 		return makeError(0xE93D1F, err)
 	}
+	mu.Lock()
+	pk.sendCount++
+	mu.Unlock()
 	return nil
 } //                                                                        Send
 
@@ -7,6 +7,7 @@ package udpt
 
 import (
 	"net"
+	"sync"
 	"testing"
 )
 
@@ -32,10 +33,45 @@ func Test_senderPacket_IsDelivered_(t *testing.T) {
 	if pk.IsDelivered() != true {
 		t.Error("0xEE46BB")
 	}
+	// a piece resent in sub-pieces is delivered once they all are
+	pk.confirmedHash = nil
+	pk.subPackets = []senderPacket{
+		{sentHash: getHash([]byte("a")), confirmedHash: getHash([]byte("a"))},
+		{sentHash: getHash([]byte("bc"))},
+	}
+	if pk.IsDelivered() != false {
+		t.Error("0xE5AC1E")
+	}
+	pk.subPackets[1].confirmedHash = getHash([]byte("bc"))
+	if pk.IsDelivered() != true {
+		t.Error("0xE968BA")
+	}
+}
+
+// (pk *senderPacket) confirmedBy(hash []byte) *senderPacket
+//
+// go test -run Test_senderPacket_confirmedBy_
+//
+func Test_senderPacket_confirmedBy_(t *testing.T) {
+	pk := senderPacket{sentHash: getHash([]byte("abc"))}
+	pk.subPackets = []senderPacket{
+		{sentHash: getHash([]byte("a"))},
+		{sentHash: getHash([]byte("bc"))},
+	}
+	if pk.confirmedBy(getHash([]byte("abc"))) != &pk {
+		t.Error("0xE028D9")
+	}
+	if pk.confirmedBy(getHash([]byte("bc"))) != &pk.subPackets[1] {
+		t.Error("0xE17FB8")
+	}
+	if pk.confirmedBy(getHash([]byte("x"))) != nil {
+		t.Error("0xEF9A69")
+	}
 }
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
-// (pk *senderPacket) Send(conn *net.UDPConn, cipher SymmetricCipher) error
+// (pk *senderPacket) Send(conn netUDPConn, cipher SymmetricCipher,
+// mu sync.Locker) error
 //
 // go test -run Test_senderPacket_Send_*
 
@@ -45,7 +81,7 @@ func Test_senderPacket_Send_1(t *testing.T) {
 	conn := makeTestConn()
 	cipher := &aesCipher{}
 	cipher.SetKey([]byte("12345678901234567890123456789012"))
-	err := pk.Send(conn, cipher)
+	err := pk.Send(conn, cipher, &sync.Mutex{})
 	if err != nil {
 		t.Error("0xED62D8", err)
 	}
@@ -54,7 +90,7 @@ func Test_senderPacket_Send_1(t *testing.T) {
 // must fail when passed a nil connection
 func Test_senderPacket_Send_2(t *testing.T) {
 	var pk senderPacket
-	err := pk.Send(nil, nil)
+	err := pk.Send(nil, nil, &sync.Mutex{})
 	if !matchError(err, "nil conn") {
 		t.Error("0xE31FF5", "wrong error:", err)
 	}
@@ -66,7 +102,7 @@ func Test_senderPacket_Send_3(t *testing.T) {
 	conn := &net.UDPConn{} // bad connection
 	cipher := &aesCipher{}
 	cipher.SetKey([]byte("12345678901234567890123456789012"))
-	err := pk.Send(conn, cipher)
+	err := pk.Send(conn, cipher, &sync.Mutex{})
 	if !matchError(err, "invalid argument") {
 		// TODO: above error description may differ on Linux or Mac OS
 		t.Error("0xE65B73", "wrong error:", err)
@@ -77,7 +113,7 @@ func Test_senderPacket_Send_3(t *testing.T) {
 func Test_senderPacket_Send_4(t *testing.T) {
 	var pk senderPacket
 	conn := makeTestConn()
-	err := pk.Send(conn, nil)
+	err := pk.Send(conn, nil, &sync.Mutex{})
 	if !matchError(err, "nil cipher") {
 		t.Error("0xE03CD3", "wrong error:", err)
 	}
@@ -88,7 +124,7 @@ func Test_senderPacket_Send_5(t *testing.T) {
 	var pk senderPacket
 	conn := makeTestConn()
 	cipher := &aesCipher{}
-	err := pk.Send(conn, cipher)
+	err := pk.Send(conn, cipher, &sync.Mutex{})
 	if !matchError(err, "AES-256 key must be 32 bytes long") {
 		t.Error("0xE12AB8", "wrong error:", err)
 	}
@@ -99,7 +135,7 @@ func Test_senderPacket_Send_6(t *testing.T) {
 	var pk senderPacket
 	conn := makeTestConn()
 	cipher := &aesCipher{cryptoKey: []byte{1, 2, 3}}
-	err := pk.Send(conn, cipher)
+	err := pk.Send(conn, cipher, &sync.Mutex{})
 	if !matchError(err, "AES-256 key must be 32 bytes long") {
 		t.Error("0xE53A3B", "wrong error:", err)
 	}
@@ -7,8 +7,16 @@ package udpt
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
 	"net"
+	"reflect"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -34,6 +42,28 @@ func Test_Send_A(t *testing.T) {
 	}
 }
 
+// must close the trace written to Config.TraceWriter, so it is valid JSON
+func Test_Send_B(t *testing.T) {
+	cryptoKey := []byte("3z5EdC485Ex9Wy0AsY4Apu6930Bx57Z0")
+	received := map[string][]byte{}
+	_, rc := makeConfigAndReceiver(cryptoKey, &received)
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(200 * time.Millisecond)
+	//
+	var buf bytes.Buffer
+	cf := NewDefaultConfig()
+	cf.TraceWriter = &buf
+	err := Send("127.0.0.1:9876", "traced", []byte("value"), cryptoKey, cf)
+	if err != nil {
+		t.Error("0xE7C3B9", err)
+	}
+	var events []traceEvent
+	if err := json.Unmarshal(buf.Bytes(), &events); err != nil {
+		t.Error("0xE3A6D4", err, "in:\n"+buf.String())
+	}
+}
+
 // -----------------------------------------------------------------------------
 
 // SendString(addr, k, v string, cryptoKey []byte, config ...*Configuration,
@@ -120,7 +150,7 @@ func Test_Sender_Send_1(t *testing.T) {
 	sd.Config.ReplyTimeout = 500 * time.Millisecond
 	sd.Config.WriteTimeout = 500 * time.Millisecond
 	err = sd.Send("", nil)
-	if !matchError(err, "undelivered packets") {
+	if !errors.Is(err, ErrReceiverUnreachable) {
 		t.Error("0xEB8B96", "wrong error:", err)
 	}
 }
@@ -151,6 +181,350 @@ func Test_Sender_Send_3(t *testing.T) {
 	}
 }
 
+// must deliver directly to Sender.LocalReceiver, without the network
+func Test_Sender_Send_4(t *testing.T) {
+	sd := makeTestSender()
+	var got string
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive: func(k string, v []byte) error {
+			got = k + "=" + string(v)
+			return nil
+		},
+	}
+	err := sd.Send("greeting", []byte("Hello!"))
+	if err != nil {
+		t.Error("0xEC2783", err)
+	}
+	if got != "greeting=Hello!" {
+		t.Error("0xE26C7C", got)
+	}
+	if sd.stats.bytesDelivered != 6 {
+		t.Error("0xED5925", sd.stats.bytesDelivered)
+	}
+}
+
+// must fail when Sender.LocalReceiver has another key
+func Test_Sender_Send_5(t *testing.T) {
+	sd := makeTestSender()
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: []byte("abcdefghijklmnopqrstuvwxyz123456"),
+		Receive:   func(k string, v []byte) error { return nil },
+	}
+	err := sd.Send("greeting", []byte("Hello!"))
+	if !matchError(err, "different CryptoKey") {
+		t.Error("0xE3A12B", "wrong error:", err)
+	}
+}
+
+// must not use the shortcut when Config.LoopbackShortcut is off
+func Test_Sender_Send_6(t *testing.T) {
+	sd := makeTestSender()
+	rc := &Receiver{Port: 9876, CryptoKey: sd.CryptoKey}
+	localReceivers.Register(rc)
+	defer localReceivers.Unregister(rc)
+	if sd.localReceiver() != nil {
+		t.Error("0xEF507F")
+	}
+	sd.Config.LoopbackShortcut = true
+	if sd.localReceiver() != rc {
+		t.Error("0xE0D16E")
+	}
+	sd.CryptoKey = []byte("abcdefghijklmnopqrstuvwxyz123456")
+	if sd.localReceiver() != nil {
+		t.Error("0xE379DC")
+	}
+}
+
+// must write a timeline of the sent item to Config.TraceWriter
+func Test_Sender_Send_7(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9883
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	var buf bytes.Buffer
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:9883"
+	sd.CryptoKey = rc.CryptoKey
+	sd.Config.TraceWriter = &buf
+	sd.Config.PacketPayloadSize = 100
+	v := make([]byte, 1000) // random, so it doesn't compress
+	rand.New(rand.NewSource(1)).Read(v)
+	err := sd.Send("traced", v)
+	if err != nil {
+		t.Error("0xE06740", err)
+	}
+	s := buf.String()
+	for _, want := range []string{
+		`"name":"item \"traced\""`,
+		`"name":"send"`,
+		`"name":"in flight"`,
+		`"name":"item"`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Error("0xEF4732", "missing:", want, "in:\n"+s)
+		}
+	}
+	if sd.trace != nil {
+		t.Error("0xE851E0")
+	}
+	// must close the JSON array, once
+	for i := 0; i < 2; i++ {
+		if err := sd.Close(); err != nil {
+			t.Error("0xE2C9A7", err)
+		}
+	}
+	var events []traceEvent
+	if err := json.Unmarshal(buf.Bytes(), &events); err != nil {
+		t.Error("0xE4A8F5", err, "in:\n"+buf.String())
+	}
+}
+
+// must pace packets with Config.RateController and report confirmations
+func Test_Sender_Send_9(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9888
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	const rate = 20000
+	tb := &TokenBucket{Rate: rate, Increase: 1}
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:9888"
+	sd.CryptoKey = rc.CryptoKey
+	sd.Config.RateController = tb
+	sd.Config.PacketPayloadSize = 100
+	v := make([]byte, 1000) // random, so it doesn't compress
+	rand.New(rand.NewSource(1)).Read(v)
+	t0 := time.Now()
+	err := sd.Send("paced", v)
+	if err != nil {
+		t.Error("0xEE8476", err)
+	}
+	// all packets but the first must wait for the bucket to refill
+	size := 0
+	for _, pk := range sd.packets[1:] {
+		size += len(pk.data)
+	}
+	min := time.Duration(float64(size) / rate * float64(time.Second))
+	if d := time.Since(t0); d < min {
+		t.Error("0xED6DD0", "took:", d, "expected at least:", min)
+	}
+	if tb.Rate != rate+float64(len(sd.packets)) {
+		t.Error("0xE9A99E", "OnAck not called for every packet:", tb.Rate)
+	}
+}
+
+// must fail with ErrNoFirstReply when nothing is confirmed in time,
+// without waiting for Config.ReplyTimeout or using up all retries
+func Test_Sender_Send_8(t *testing.T) {
+	// a socket that never confirms anything
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: 9887})
+	if err != nil {
+		t.Fatal("0xEA3CB6", err)
+	}
+	defer conn.Close()
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:9887"
+	sd.Config.SendRetries = 100
+	sd.Config.ReplyTimeout = time.Second
+	sd.Config.FirstReplyTimeout = 100 * time.Millisecond
+	t0 := time.Now()
+	err = sd.Send("key", []byte("value"))
+	if !errors.Is(err, ErrNoFirstReply) {
+		t.Error("0xE8B374", "wrong error:", err)
+	}
+	if d := time.Since(t0); d > 500*time.Millisecond {
+		t.Error("0xE084F9", "took:", d)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) SendWithOptions(k string, v []byte, opts *SendOptions) error
+//
+// go test -run Test_Sender_SendWithOptions_*
+
+// items must only be delivered to a Receiver with the same AAD
+func Test_Sender_SendWithOptions_1(t *testing.T) {
+	received := map[string][]byte{}
+	cryptoKey := []byte("3z5EdC485Ex9Wy0AsY4Apu6930Bx57Z0")
+	cf, rc := makeConfigAndReceiver(cryptoKey, &received)
+	cf.SendRetries = 2
+	rc.AAD = []byte("tenant-a")
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	sd := Sender{Address: "127.0.0.1:9876", CryptoKey: cryptoKey, Config: cf}
+	err := sd.SendWithOptions("a", []byte("1"),
+		&SendOptions{AAD: []byte("tenant-a")})
+	if err != nil {
+		t.Error("0xEEBF4A", err)
+	}
+	err = sd.SendWithOptions("b", []byte("2"),
+		&SendOptions{AAD: []byte("tenant-b")})
+	if !errors.Is(err, ErrUndeliveredPackets) {
+		t.Error("0xEB78B5", "wrong error:", err)
+	}
+	err = sd.Send("c", []byte("3"))
+	if !errors.Is(err, ErrUndeliveredPackets) {
+		t.Error("0xE32677", "wrong error:", err)
+	}
+	if len(received) != 1 || string(received["a"]) != "1" {
+		t.Error("0xECAF6D", received)
+	}
+}
+
+// must fail when the cipher doesn't support AAD
+func Test_Sender_SendWithOptions_2(t *testing.T) {
+	sd := makeTestSender()
+	sd.Config.Cipher = &plainCipher{}
+	err := sd.SendWithOptions("a", []byte("1"),
+		&SendOptions{AAD: []byte("tenant-a")})
+	if !matchError(err, "invalid SendOptions.AAD") {
+		t.Error("0xED5D55", "wrong error:", err)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) SendContext(ctx context.Context, k string, v []byte) error
+//
+// go test -run Test_Sender_SendContext_*
+
+// must not send anything when the context is already cancelled
+func Test_Sender_SendContext_1(t *testing.T) {
+	sd := makeTestSender()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := sd.SendContext(ctx, "key", []byte("value"))
+	if !errors.Is(err, context.Canceled) {
+		t.Error("0xE70482", "wrong error:", err)
+	}
+	if sd.packets != nil {
+		t.Error("0xECD550")
+	}
+}
+
+// must stop retrying and close the connection when the deadline passes
+func Test_Sender_SendContext_2(t *testing.T) {
+	// a socket that never confirms anything
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: 9886})
+	if err != nil {
+		t.Fatal("0xE0F3A9", err)
+	}
+	defer conn.Close()
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:9886"
+	sd.Config.SendRetries = 100
+	sd.Config.ReplyTimeout = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(),
+		200*time.Millisecond)
+	defer cancel()
+	t0 := time.Now()
+	err = sd.SendContext(ctx, "key", []byte("value"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("0xEBC25E", "wrong error:", err)
+	}
+	if d := time.Since(t0); d > 500*time.Millisecond {
+		t.Error("0xEC4EC3", "took:", d)
+	}
+	if sd.conn != nil || sd.ctx != nil {
+		t.Error("0xEE3B04")
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) SendFromReader(name string, r io.Reader, size int64) error
+//
+// go test -run Test_Sender_SendFromReader_*
+
+// must send the stream in order, one chunk per data item
+func Test_Sender_SendFromReader_1(t *testing.T) {
+	sd := makeTestSender()
+	sd.Config.StreamChunkSize = 4
+	var got []string
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive: func(k string, v []byte) error {
+			got = append(got, k+"="+string(v))
+			return nil
+		},
+	}
+	err := sd.SendFromReader("abc", strings.NewReader("0123456789"), 10)
+	if err != nil {
+		t.Error("0xE75BB1", err)
+	}
+	want := []string{
+		"abc#chunk:1/3=0123",
+		"abc#chunk:2/3=4567",
+		"abc#chunk:3/3=89",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("0xEF4806", got)
+	}
+	got = nil
+	err = sd.SendFromReader("empty", strings.NewReader(""), 0)
+	if err != nil || len(got) != 1 || got[0] != "empty#chunk:1/1=" {
+		t.Error("0xE17F7C", err, got)
+	}
+}
+
+// must fail when the reader ends before 'size' bytes, or 'size' is invalid
+func Test_Sender_SendFromReader_2(t *testing.T) {
+	sd := makeTestSender()
+	sd.Config.StreamChunkSize = 4
+	var count int
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive: func(k string, v []byte) error {
+			count++
+			return nil
+		},
+	}
+	err := sd.SendFromReader("abc", strings.NewReader("012345"), 10)
+	if !errors.Is(err, io.ErrUnexpectedEOF) ||
+		!matchError(err, "reading chunk 2 of 3") {
+		t.Error("0xEA2848", "wrong error:", err)
+	}
+	if count != 1 {
+		t.Error("0xE11F4B", count)
+	}
+	err = sd.SendFromReader("abc", strings.NewReader(""), -1)
+	if !matchError(err, "invalid size") {
+		t.Error("0xEE38FF", "wrong error:", err)
+	}
+}
+
+// (sd *Sender) SetKey(cryptoKey []byte) error
+//
+// go test -run Test_Sender_SetKey_
+
+// must switch to a valid key, keeping a copy, and reject invalid ones
+func Test_Sender_SetKey_(t *testing.T) {
+	sd := makeTestSender()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	err := sd.SetKey(key)
+	if err != nil || !bytes.Equal(sd.CryptoKey, key) {
+		t.Error("0xE23465", err)
+	}
+	key[0] = 'X'
+	if sd.CryptoKey[0] != '0' {
+		t.Error("0xEAC87B", "the key wasn't copied")
+	}
+	err = sd.SetKey([]byte("short"))
+	if !matchError(err, "invalid key") || sd.CryptoKey[0] != '0' {
+		t.Error("0xE8066D", "wrong error:", err)
+	}
+	sd.Config.Cipher = nil
+	err = sd.SetKey(key)
+	if !matchError(err, "nil Sender.Config.Cipher") {
+		t.Error("0xE3F96E", "wrong error:", err)
+	}
+}
+
 // -----------------------------------------------------------------------------
 
 // (sd *Sender) SendString(k, v string) error
@@ -160,7 +534,7 @@ func Test_Sender_Send_3(t *testing.T) {
 func Test_Sender_SendString_(t *testing.T) {
 	sd := makeTestSender()
 	err := sd.SendString("greeting", "Hello World!")
-	if !matchError(err, "undelivered packets") {
+	if !matchError(err, "receiver unreachable at 127.0.0.0:9876") {
 		t.Error("0xEE8E8D", "wrong error:", err)
 	}
 }
@@ -184,6 +558,91 @@ func Test_Sender_AverageResponseMs_(t *testing.T) {
 	}
 }
 
+// (sd *Sender) LabelStats() map[string]TransferStats
+//
+// go test -run Test_Sender_LabelStats_
+//
+func Test_Sender_LabelStats_(t *testing.T) {
+	sd := makeTestSender()
+	sd.LocalReceiver = &Receiver{
+		CryptoKey: sd.CryptoKey,
+		Receive:   func(k string, v []byte) error { return nil },
+	}
+	a := &SendOptions{Label: "team-a"}
+	_ = sd.SendWithOptions("1", []byte("12345"), a)
+	_ = sd.SendWithOptions("2", []byte("123"), a)
+	_ = sd.SendWithOptions("3", []byte("1"), &SendOptions{Label: "team-b"})
+	_ = sd.Send("4", []byte("12"))
+	got := sd.LabelStats()
+	if len(got) != 3 ||
+		got["team-a"].BytesDelivered != 8 ||
+		got["team-b"].BytesDelivered != 1 ||
+		got[""].BytesDelivered != 2 {
+		t.Error("0xE8A99D", got)
+	}
+	// packets lost over the network must be attributed too
+	sd.LocalReceiver = nil
+	_ = sd.SendWithOptions("5", []byte("12345"), a)
+	if st := sd.LabelStats()["team-a"]; st.PacketsLost < 1 ||
+		st.BytesDelivered != 8 {
+		t.Error("0xEB72C6", st)
+	}
+}
+
+// (sd *Sender) TotalStats() TransferStats
+//
+// go test -run Test_Sender_TotalStats_
+
+// must count the packets sent, their round-trip times, the
+// compression of the items on both ends, and the time in each stage
+func Test_Sender_TotalStats_(t *testing.T) {
+	newConfig := func() *Configuration {
+		cf := NewDefaultConfig()
+		cf.LogWriter = nil
+		return cf
+	}
+	key := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	rc := Receiver{
+		Port: 9893, CryptoKey: key, Config: newConfig(),
+		Receive: func(k string, v []byte) error { return nil },
+	}
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	sd := Sender{Address: "127.0.0.1:9893", CryptoKey: key, Config: newConfig()}
+	value := bytes.Repeat([]byte("abcd"), 1000)
+	_ = sd.SendWithOptions("1", value, &SendOptions{Label: "a"})
+	_ = sd.SendWithOptions("2", value, &SendOptions{Label: "b"})
+	st := sd.TotalStats()
+	if st.PacketsSent < 2 || st.BytesSent < st.BytesDelivered ||
+		st.PacketsDelivered != 2 || st.AverageRTT <= 0 ||
+		st.ValueBytes != 8000 || st.CompressionRatio() <= 1 {
+		t.Error("0xE6A61B", st)
+	}
+	// must time the stages of sending, except reading
+	if st.ReadTime != 0 || st.CompressTime <= 0 || st.EncryptTime <= 0 ||
+		st.SendTime <= 0 || st.AckWaitTime <= 0 {
+		t.Error("0xE3C8B2", st)
+	}
+	rs := rc.Stats()
+	if rs.ItemsDelivered != 2 || rs.BytesReceived <= st.BytesSent ||
+		rs.BytesCompressed != st.CompressedBytes ||
+		rs.CompressionRatio() != st.CompressionRatio() {
+		t.Error("0xEEE9FD", rs)
+	}
+	// packets encrypted with another key must count as decrypt failures
+	other := Sender{Address: "127.0.0.1:9893", Config: newConfig(),
+		CryptoKey: []byte("0123456789abcdef0123456789abcdef")}
+	other.Config.SendRetries = 1
+	other.Config.ReplyTimeout = 100 * time.Millisecond
+	_ = other.Send("3", []byte("x"))
+	if rs := rc.Stats(); rs.DecryptFailures < 1 ||
+		rs.PacketsRejected < rs.DecryptFailures {
+		t.Error("0xEA1F79", rs)
+	}
+}
+
 // (sd *Sender) TransferSpeedKBpS() float64
 //
 // go test -run Test_Sender_TransferSpeedKBpS_
@@ -362,6 +821,40 @@ func Test_Sender_close_2(t *testing.T) {
 	}
 }
 
+// must stop collectConfirmations() and sendKeepalives() before returning
+// (run with -race to check)
+func Test_Sender_close_3(t *testing.T) {
+	loopback := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	server, err := net.ListenUDP("udp", loopback)
+	if err != nil {
+		t.Fatal("0xE4D1B7", err)
+	}
+	defer server.Close()
+	conn, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal("0xE8A3C5", err)
+	}
+	sd := makeTestSender()
+	sd.Config.VerboseSender = false
+	sd.Config.KeepaliveInterval = 10 * time.Millisecond
+	sd.conn = conn
+	sd.startLoops(conn)
+	time.Sleep(50 * time.Millisecond)
+	closed := make(chan struct{})
+	go func() {
+		sd.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("0xE2C6F9", "close() didn't return")
+	}
+	if sd.conn != nil || sd.done != nil {
+		t.Error("0xE6F1A4")
+	}
+}
+
 // -----------------------------------------------------------------------------
 // # Internal Helper Methods (sd *Sender)
 
@@ -426,6 +919,361 @@ func Test_Sender_makePacket_2(t *testing.T) {
 	}
 }
 
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) resplitPackets() error
+//
+// go test -run Test_Sender_resplitPackets_
+
+// re-split packets must always outnumber the old ones
+func Test_Sender_resplitPackets_(t *testing.T) {
+	sd := makeTestSender()
+	sd.key, sd.comp = "key", []byte(strings.Repeat("x", 1000))
+	sd.Config.PacketPayloadSize = 300
+	_ = sd.makePackets(sd.key, sd.comp)
+	if len(sd.packets) != 4 {
+		t.Error("0xE38445", len(sd.packets))
+	}
+	// 290 bytes still needs 4 packets, so they must be smaller
+	sd.Config.PacketPayloadSize = 290
+	err := sd.resplitPackets()
+	if err != nil || len(sd.packets) != 5 {
+		t.Error("0xEB68A2", err, len(sd.packets))
+	}
+	// 100 bytes needs 10 packets
+	sd.Config.PacketPayloadSize = 100
+	err = sd.resplitPackets()
+	if err != nil || len(sd.packets) != 10 {
+		t.Error("0xE4F9B1", err, len(sd.packets))
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) pieceDelivered(pk *senderPacket)
+//
+// go test -run Test_Sender_pieceDelivered_
+
+// must report the compressed bytes confirmed to Config.OnProgress
+func Test_Sender_pieceDelivered_(t *testing.T) {
+	sd := makeTestSender()
+	sd.key, sd.comp = "key", []byte(strings.Repeat("x", 1000))
+	sd.Config.PacketPayloadSize = 300
+	_ = sd.makePackets(sd.key, sd.comp)
+	var got []int64
+	sd.Config.OnProgress = func(name string, sentBytes, totalBytes int64) {
+		if name != "key" || totalBytes != 1000 {
+			t.Error("0xECF449", name, totalBytes)
+		}
+		got = append(got, sentBytes)
+	}
+	for i := len(sd.packets) - 1; i >= 0; i-- {
+		pk := &sd.packets[i]
+		sd.confirmPacket(pk.sentHash)
+		sd.confirmPacket(pk.sentHash) // counted only once
+	}
+	if !reflect.DeepEqual(got, []int64{100, 400, 700, 1000}) {
+		t.Error("0xE4C2C1", got)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) receiverLimit() *TokenBucket
+//
+// go test -run Test_Sender_receiverLimit_
+
+// the Senders of SendMany() must share the rate advertised by the Receiver
+func Test_Sender_receiverLimit_(t *testing.T) {
+	sd := makeTestSender()
+	isd := sd.itemSender()
+	if isd.receiverLimit() != sd.receiverLimit() ||
+		sd.receiverLimit() != &sd.rxLimit {
+		t.Error("0xEC14CA")
+	}
+	isd.receiverLimit().setRate(2000)
+	if sd.rxLimit.Rate != 2000 {
+		t.Error("0xE0FA68", sd.rxLimit.Rate)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) sendLimit() *TokenBucket
+//
+// go test -run Test_Sender_sendLimit_
+
+// must not send faster than Config.MaxSendBytesPerSecond
+func Test_Sender_sendLimit_(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9877
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	cf := NewDefaultConfig()
+	cf.MaxSendBytesPerSecond = 10000
+	sd := Sender{Address: "127.0.0.1:9877", CryptoKey: rc.CryptoKey,
+		Config: cf}
+	v := make([]byte, 10000)
+	_, _ = rand.Read(v) // random bytes don't compress
+	t0 := time.Now()
+	err := sd.Send("capped", v)
+	if err != nil {
+		t.Fatal("0xE4D7A9", err)
+	}
+	if d := time.Since(t0); d < 800*time.Millisecond {
+		t.Error("0xE9A2C6", "sent 10 KB at 10 KB/s in", d)
+	}
+	if sd.itemSender().sendLimit() != &sd.txLimit || sd.txLimit.Rate != 10000 {
+		t.Error("0xE2E5B0", sd.txLimit.Rate)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) splitSubPackets(pk *senderPacket) error
+//
+// go test -run Test_Sender_splitSubPackets_
+
+// a Receiver must assemble pieces resent in sub-pieces, and confirm each
+func Test_Sender_splitSubPackets_(t *testing.T) {
+	v := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(v)
+	sd := makeTestSender()
+	sd.Config.PacketPayloadSize = 400
+	sd.dataHash = getHash(v)
+	sd.comp, _ = sd.Config.Compressor.Compress(v)
+	_ = sd.makePackets("key", sd.comp)
+	//
+	// sub-pieces are disabled by default
+	if err := sd.splitSubPackets(&sd.packets[0]); err != nil ||
+		sd.packets[0].subPackets != nil {
+		t.Error("0xEF2E9B", err)
+	}
+	sd.Config.SubPieceSize = 150
+	var got []byte
+	rc := newRunnableReceiver()
+	rc.Receive = func(k string, v []byte) error {
+		got = v
+		return nil
+	}
+	for i := range sd.packets {
+		pk := &sd.packets[i]
+		if err := sd.splitSubPackets(pk); err != nil {
+			t.Fatal("0xECFFF2", err)
+		}
+		if len(pk.data) > 400 && len(pk.subPackets) != 3 {
+			t.Error("0xEFA3D8", i, len(pk.subPackets))
+		}
+		for j := len(pk.subPackets) - 1; j >= 0; j-- {
+			sub := &pk.subPackets[j]
+			reply, err := rc.receiveFragment(sub.data)
+			if err != nil {
+				t.Fatal("0xE73640", err)
+			}
+			confirmed, _, err := readConfirmation(reply)
+			if err != nil || pk.confirmedBy(confirmed) != sub {
+				t.Error("0xECFB50", i, j)
+			}
+			sd.confirmPacket(confirmed)
+		}
+	}
+	if !sd.DeliveredAllParts() || !bytes.Equal(got, v) {
+		t.Error("0xE15ECB", sd.countDelivered(), len(got))
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) receiveNack(recv []byte)
+//
+// go test -run Test_Sender_receiveNack_
+
+// must mark the packets a NACK reports as received as delivered,
+// and flag the missing ones to be resent
+func Test_Sender_receiveNack_(t *testing.T) {
+	sd := makeTestSender()
+	sd.key, sd.comp = "key", []byte(strings.Repeat("x", 1000))
+	sd.dataHash = getHash([]byte("value"))
+	sd.Config.PacketPayloadSize = 100
+	_ = sd.makePackets(sd.key, sd.comp)
+	for i := range sd.packets {
+		sd.packets[i].sendCount = 1
+		sd.packets[i].sentHash = getHash(sd.packets[i].data)
+	}
+	missing := make([]bool, len(sd.packets))
+	missing[2], missing[7] = true, true
+	//
+	// a NACK for another item must be ignored
+	sd.receiveNack(makeNack("other", sd.dataHash, missing, 0, true))
+	if sd.countDelivered() != 0 || sd.takeNacked() {
+		t.Error("0xE92B39", sd.countDelivered())
+	}
+	sd.receiveNack(makeNack(sd.key, sd.dataHash, missing, 0, true))
+	if sd.countDelivered() != len(sd.packets)-2 || !sd.takeNacked() {
+		t.Error("0xE4735C", sd.countDelivered())
+	}
+	if sd.packets[2].IsDelivered() || sd.packets[7].IsDelivered() {
+		t.Error("0xEF5F00")
+	}
+}
+
+// must not race with packets being sent and confirmed in other goroutines
+// (run with -race to check)
+func Test_Sender_receiveNack_concurrent_(t *testing.T) {
+	sd := makeTestSender()
+	sd.key, sd.comp = "key", []byte(strings.Repeat("x", 1000))
+	sd.dataHash = getHash([]byte("value"))
+	sd.Config.PacketPayloadSize = 100
+	_ = sd.makePackets(sd.key, sd.comp)
+	missing := make([]bool, len(sd.packets))
+	missing[2] = true
+	nack := makeNack(sd.key, sd.dataHash, missing, 0, true)
+	loopback := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	listener, err := net.ListenUDP("udp", loopback)
+	if err != nil {
+		t.Fatal("0xE5C9A2", err)
+	}
+	defer listener.Close()
+	conn, err := net.DialUDP("udp", nil, listener.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal("0xE2D7B4", err)
+	}
+	defer conn.Close()
+	cipher := &aesCipher{}
+	cipher.SetKey([]byte("12345678901234567890123456789012"))
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := range sd.packets {
+			err := sd.packets[i].Send(conn, cipher, &sd.packetsMu)
+			if err != nil {
+				t.Error("0xE3B8D6", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			sd.receiveNack(nack)
+			sd.resetConfirmations()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			sd.confirmPacket(sd.packets[i%len(sd.packets)].sentHash)
+			sd.DeliveredAllParts()
+			sd.countDelivered()
+		}
+	}()
+	wg.Wait()
+	sd.resetConfirmations()
+	sd.receiveNack(nack)
+	if sd.countDelivered() != len(sd.packets)-1 {
+		t.Error("0xE7A4C1", sd.countDelivered())
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) sendPacket(pk *senderPacket) error
+//
+// go test -run Test_Sender_sendPacket_*
+
+// must resend after transient errors, without marking the connection broken
+func Test_Sender_sendPacket_1(t *testing.T) {
+	sd := makeTestSender()
+	_ = sd.Config.Cipher.SetKey(sd.CryptoKey)
+	conn := &errnoConn{errs: []error{syscall.ENOBUFS, syscall.EPERM}}
+	sd.conn = conn
+	err := sd.sendPacket(&senderPacket{data: []byte("abc")})
+	if err != nil {
+		t.Error("0xED5268", err)
+	}
+	if conn.nWrite != 3 || len(conn.written) == 0 || sd.isConnBroken() {
+		t.Error("0xE25C06", conn.nWrite, len(conn.written))
+	}
+}
+
+// must give up after a fatal error, marking the connection broken
+func Test_Sender_sendPacket_2(t *testing.T) {
+	sd := makeTestSender()
+	_ = sd.Config.Cipher.SetKey(sd.CryptoKey)
+	conn := &errnoConn{errs: []error{syscall.EBADF}}
+	sd.conn = conn
+	err := sd.sendPacket(&senderPacket{data: []byte("abc")})
+	if classifySocketError(err) != socketErrorFatal {
+		t.Error("0xE1FDFF", "wrong error:", err)
+	}
+	if conn.nWrite != 1 || !sd.takeConnBroken() || sd.isConnBroken() {
+		t.Error("0xED0E0A", conn.nWrite)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// (sd *Sender) reconnect(connect func() (netUDPConn, error)) error
+//
+// go test -run Test_Sender_reconnect_
+
+// a transfer must complete over a new connection
+// when the first one fails with a fatal error
+func Test_Sender_reconnect_(t *testing.T) {
+	rc := newRunnableReceiver()
+	rc.Port = 9882
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	sd := makeTestSender()
+	sd.Address = "127.0.0.1:9882"
+	sd.CryptoKey = rc.CryptoKey
+	connects := 0
+	connect := func() (netUDPConn, error) {
+		connects++
+		conn, err := sd.connect()
+		if connects == 1 && err == nil {
+			return &brokenConn{conn}, nil
+		}
+		return conn, err
+	}
+	err := sd.beginSend("key", []byte("value"))
+	if err != nil {
+		t.Fatal("0xE2A492", err)
+	}
+	err = sd.transferItem(connect, sd.sendUndeliveredPackets)
+	if err != nil {
+		t.Error("0xE9A4F0", err)
+	}
+	if connects != 2 {
+		t.Error("0xE6C21D", connects)
+	}
+}
+
+// errnoConn is a mock connection whose Write
+// returns each error in 'errs' once, in order.
+type errnoConn struct {
+	mockNetUDPConn
+	errs []error
+}
+
+// Write implements Conn.Write().
+func (mk *errnoConn) Write(b []byte) (int, error) {
+	if len(mk.errs) > 0 {
+		mk.nWrite++
+		err := mk.errs[0]
+		mk.errs = mk.errs[1:]
+		return 0, &net.OpError{Op: "write", Net: "udp", Err: err}
+	}
+	return mk.mockNetUDPConn.Write(b)
+}
+
+// brokenConn wraps a connection whose
+// socket fails as if it had been closed.
+type brokenConn struct {
+	netUDPConn
+}
+
+// Write implements Conn.Write().
+func (bc *brokenConn) Write(b []byte) (int, error) {
+	return 0, &net.OpError{Op: "write", Net: "udp", Err: syscall.EBADF}
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 // (sd *Sender) validateAddress() error
 //
@@ -471,6 +1319,23 @@ func Test_Sender_validateAddress_4(t *testing.T) {
 	}
 }
 
+// must accept IPv6 addresses, including link-local ones with a zone
+func Test_Sender_validateAddress_5(t *testing.T) {
+	sd := makeTestSender()
+	for _, addr := range []string{"[::1]:9876", "[fe80::1%eth0]:9876"} {
+		sd.Address = addr
+		err := sd.validateAddress()
+		if err != nil {
+			t.Error("0xE8C35A", addr, err)
+		}
+	}
+	sd.Address = "::1:9876" // missing brackets
+	err := sd.validateAddress()
+	if !matchError(err, "invalid port in Sender.Address") {
+		t.Error("0xE1F6B9", "wrong error:", err)
+	}
+}
+
 // -----------------------------------------------------------------------------
 
 // makeConfigAndReceiver creates and returns a
@@ -0,0 +1,59 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[socket_error.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// sendTransientRetries is the number of times a packet is sent again
+// after a transient socket error, before the error is given up on.
+const sendTransientRetries = 3
+
+// sendTransientDelay is the wait before the first resend of a packet after
+// a transient socket error. It doubles with every following attempt.
+var sendTransientDelay = time.Millisecond
+
+// socketErrorKind classifies errors returned by socket calls,
+// to decide whether to retry, reconnect or give up.
+type socketErrorKind int
+
+const (
+	// socketErrorOther is any error not caused by the socket itself, or
+	// one handled elsewhere, like ICMP errors (see icmpErrorOf)
+	socketErrorOther socketErrorKind = iota
+
+	// socketErrorTransient is a passing condition of the local
+	// network stack, such as a full send buffer, an interrupted
+	// call or a packet dropped by a full conntrack table (EPERM)
+	socketErrorTransient
+
+	// socketErrorFatal means the socket can no longer be used,
+	// for example because the descriptor was closed under it
+	// or the interface it was bound to went away
+	socketErrorFatal
+) //                                                             socketErrorKind
+
+// classifySocketError returns the kind of socket error 'err' is.
+func classifySocketError(err error) socketErrorKind {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return socketErrorOther
+	}
+	switch errno {
+	case syscall.EINTR, syscall.EAGAIN, syscall.ENOBUFS, syscall.ENOMEM,
+		syscall.EPERM:
+		return socketErrorTransient
+	case syscall.EBADF, syscall.ENOTSOCK, syscall.ENOTCONN, syscall.EPIPE,
+		syscall.ENETDOWN, syscall.EADDRNOTAVAIL:
+		return socketErrorFatal
+	}
+	return socketErrorOther
+} //                                                         classifySocketError
+
+// end
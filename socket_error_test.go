@@ -0,0 +1,44 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[socket_error_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// classifySocketError(err error) socketErrorKind
+//
+// go test -run Test_classifySocketError_
+//
+func Test_classifySocketError_(t *testing.T) {
+	test := func(err error, want socketErrorKind) {
+		if got := classifySocketError(err); got != want {
+			t.Error("0xE7F85A", err, "want:", want, "got:", got)
+		}
+	}
+	opError := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "write", Net: "udp",
+			Err: os.NewSyscallError("write", errno)}
+	}
+	test(nil, socketErrorOther)
+	test(errTimeout, socketErrorOther)
+	test(opError(syscall.ECONNREFUSED), socketErrorOther)
+	test(opError(syscall.EMSGSIZE), socketErrorOther)
+	//
+	test(syscall.ENOBUFS, socketErrorTransient)
+	test(opError(syscall.EINTR), socketErrorTransient)
+	test(opError(syscall.EPERM), socketErrorTransient)
+	test(makeError(0xE5785E, opError(syscall.EAGAIN)), socketErrorTransient)
+	//
+	test(syscall.EBADF, socketErrorFatal)
+	test(opError(syscall.ENOTSOCK), socketErrorFatal)
+	test(makeError(0xE4BDA6, opError(syscall.ENETDOWN)), socketErrorFatal)
+}
+
+// end
@@ -0,0 +1,113 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[staleness.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"time"
+)
+
+// StalenessPolicy specifies when the retransmissions of a data item are
+// no longer worth their bandwidth, and what a Sender does with them then.
+// It only affects packets sent again: a stale item's first transmission
+// is never held back.
+//
+// A stale item's retransmissions are deprioritized: they wait while any
+// item that began later is being sent by the same Sender (including the
+// other items of SendMany), or until the item's ItemTimeout ends.
+// With Drop, they are dropped instead, and Send fails at once.
+//
+type StalenessPolicy struct {
+
+	// Superseded makes a data item stale once the Sender begins sending
+	// a newer data item with the same key, e.g. in SendMany().
+	Superseded bool
+
+	// NearDeadline makes a data item stale once less than this duration
+	// remains before Configuration.ItemTimeout. Zero disables it.
+	NearDeadline time.Duration
+
+	// Drop makes a stale data item fail with ErrItemStale,
+	// instead of deprioritizing its retransmissions.
+	Drop bool
+} //                                                             StalenessPolicy
+
+// validate returns an error if any of the settings is out of range.
+func (sp *StalenessPolicy) validate() error {
+	if sp.NearDeadline < 0 {
+		return makeError(0xE23A39,
+			"invalid Configuration.Staleness.NearDeadline:", sp.NearDeadline)
+	}
+	return nil
+} //                                                                    validate
+
+// staleReason returns why the data item being sent is stale at time
+// 'now' according to Config.Staleness, or a blank string if it isn't.
+func (sd *Sender) staleReason(now time.Time) string {
+	sp := &sd.Config.Staleness
+	if sp.NearDeadline > 0 && sd.Config.ItemTimeout > 0 &&
+		now.Sub(sd.budget.itemStart) >= sd.Config.ItemTimeout-sp.NearDeadline {
+		return "near its deadline"
+	}
+	if !sp.Superseded || sd.transfer == nil {
+		return ""
+	}
+	owner := sd.owner()
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	for at := range owner.active {
+		if at.info != nil && at.info.Key == sd.transfer.Key &&
+			at.info.Started.After(sd.transfer.Started) {
+			return "superseded by a newer item"
+		}
+	}
+	return ""
+} //                                                                 staleReason
+
+// fresherInFlight returns true if the Sender is sending a data item
+// that began after the current one, e.g. another item of SendMany().
+func (sd *Sender) fresherInFlight() bool {
+	if sd.transfer == nil {
+		return false
+	}
+	owner := sd.owner()
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	for at := range owner.active {
+		if at.info != nil && at.info.Started.After(sd.transfer.Started) {
+			return true
+		}
+	}
+	return false
+} //                                                             fresherInFlight
+
+// giveWayIfStale applies Config.Staleness before the packets of the
+// current data item are sent again. If the item is stale, it returns
+// ErrItemStale if the policy drops stale items, or otherwise waits
+// while fresher items are in flight, or until a time limit is reached.
+func (sd *Sender) giveWayIfStale() error {
+	for {
+		reason := sd.staleReason(time.Now())
+		if reason == "" {
+			return nil
+		}
+		if sd.Config.Staleness.Drop {
+			return makeError(0xEAFEFB, ErrItemStale, reason)
+		}
+		if !sd.fresherInFlight() {
+			return nil
+		}
+		err := sd.sleep(sd.Config.SendRetryInterval)
+		if err != nil {
+			return err // the Send's context was cancelled
+		}
+		err = sd.budget.check(sd.Config, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+} //                                                              giveWayIfStale
+
+// end
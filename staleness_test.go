@@ -0,0 +1,101 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[staleness_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// (sd *Sender) staleReason(now time.Time) string
+//
+// go test -run Test_Sender_staleReason_
+//
+func Test_Sender_staleReason_(t *testing.T) {
+	owner := makeTestSender()
+	sd := owner.itemSender()
+	now := time.Now()
+	sd.budget.beginItem(now.Add(-9 * time.Second))
+	sd.transfer = &TransferInfo{Key: "a", Started: now}
+	defer sd.addActive(sd.transfer, func(error) {})()
+	//
+	// by default, items never become stale
+	sd.Config.ItemTimeout = 10 * time.Second
+	if got := sd.staleReason(now); got != "" {
+		t.Error("0xE635AB", got)
+	}
+	sd.Config.Staleness.NearDeadline = 500 * time.Millisecond
+	if got := sd.staleReason(now); got != "" {
+		t.Error("0xE4E66D", got)
+	}
+	sd.Config.Staleness.NearDeadline = 2 * time.Second
+	if got := sd.staleReason(now); got != "near its deadline" {
+		t.Error("0xE567BB", got)
+	}
+	sd.Config.Staleness.NearDeadline = 0
+	sd.Config.Staleness.Superseded = true
+	//
+	// an item with another key, and an older item, don't supersede it
+	defer sd.addActive(&TransferInfo{Key: "b", Started: now.Add(1)},
+		func(error) {})()
+	defer sd.addActive(&TransferInfo{Key: "a", Started: now.Add(-1)},
+		func(error) {})()
+	if got := sd.staleReason(now); got != "" {
+		t.Error("0xE3B5C5", got)
+	}
+	defer sd.addActive(&TransferInfo{Key: "a", Started: now.Add(1)},
+		func(error) {})()
+	if got := sd.staleReason(now); got != "superseded by a newer item" {
+		t.Error("0xE59348", got)
+	}
+}
+
+// (sd *Sender) giveWayIfStale() error
+//
+// go test -run Test_Sender_giveWayIfStale_
+//
+func Test_Sender_giveWayIfStale_(t *testing.T) {
+	sd := makeTestSender().itemSender()
+	sd.Config.SendRetryInterval = 10 * time.Millisecond
+	sd.Config.Staleness.Superseded = true
+	now := time.Now()
+	sd.budget.beginItem(now)
+	sd.transfer = &TransferInfo{Key: "a", Started: now}
+	if err := sd.giveWayIfStale(); err != nil {
+		t.Error("0xEBA315", err)
+	}
+	remove := sd.addActive(&TransferInfo{Key: "a", Started: now.Add(1)},
+		func(error) {})
+	//
+	// must wait while the newer item is being sent
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		remove()
+	}()
+	t0 := time.Now()
+	err := sd.giveWayIfStale()
+	if err != nil || time.Since(t0) < 100*time.Millisecond {
+		t.Error("0xE48C98", err, time.Since(t0))
+	}
+	// must stop waiting when the item's time is up
+	defer sd.addActive(&TransferInfo{Key: "a", Started: now.Add(1)},
+		func(error) {})()
+	sd.Config.ItemTimeout = 50 * time.Millisecond
+	err = sd.giveWayIfStale()
+	if !errors.Is(err, ErrItemTimeout) {
+		t.Error("0xEDB524", "wrong error:", err)
+	}
+	// must drop the item's retransmissions with Drop
+	sd.Config.Staleness.Drop = true
+	err = sd.giveWayIfStale()
+	if !errors.Is(err, ErrItemStale) ||
+		!matchError(err, "superseded by a newer item") {
+		t.Error("0xEE009E", "wrong error:", err)
+	}
+}
+
+// end
@@ -0,0 +1,79 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[stats_record.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// StatsSchemaVersion is the version of the JSON and CSV formats of
+// TransferStats and ReceiverStats. It is written in the "schema" field
+// of every serialized record, and is incremented whenever a field is
+// renamed or removed. (Adding a field doesn't change the version: new
+// fields are appended, so that existing CSV columns keep their places.)
+const StatsSchemaVersion = 1
+
+// StatsRecord is implemented by statistics that can be written as
+// CSV rows, i.e. TransferStats and ReceiverStats.
+type StatsRecord interface {
+
+	// CSVHeader returns the names of the CSV columns.
+	CSVHeader() []string
+
+	// CSVRecord returns the values of the CSV columns.
+	CSVRecord() []string
+} //                                                                 StatsRecord
+
+// StatsCSVWriter writes statistics to a CSV file, one row per record,
+// preceded by a header row written before the first record.
+type StatsCSVWriter struct {
+	w      *csv.Writer
+	header []string
+} //                                                              StatsCSVWriter
+
+// NewStatsCSVWriter returns a new StatsCSVWriter that writes to 'w'.
+func NewStatsCSVWriter(w io.Writer) *StatsCSVWriter {
+	return &StatsCSVWriter{w: csv.NewWriter(w)}
+} //                                                           NewStatsCSVWriter
+
+// Write writes 'rec' as a CSV row and flushes it to the underlying writer.
+// All records written by the same StatsCSVWriter must be of the same kind.
+func (sw *StatsCSVWriter) Write(rec StatsRecord) error {
+	header := rec.CSVHeader()
+	if sw.header == nil {
+		err := sw.w.Write(header)
+		if err != nil {
+			return makeError(0xEA48E3, err)
+		}
+		sw.header = header
+	} else if strings.Join(header, ",") != strings.Join(sw.header, ",") {
+		return makeError(0xE126EE, "can't mix kinds of stats in a CSV file")
+	}
+	err := sw.w.Write(rec.CSVRecord())
+	if err != nil {
+		return makeError(0xEE655E, err)
+	}
+	sw.w.Flush()
+	err = sw.w.Error()
+	if err != nil {
+		return makeError(0xE6057B, err)
+	}
+	return nil
+} //                                                                       Write
+
+// checkStatsSchema returns an error if stats serialized with
+// schema version 'schema' can't be read by this version.
+func checkStatsSchema(schema int) error {
+	if schema < 1 || schema > StatsSchemaVersion {
+		return makeError(0xE825DC, "unsupported stats schema version:",
+			schema)
+	}
+	return nil
+} //                                                            checkStatsSchema
+
+// end
@@ -0,0 +1,46 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[stats_record_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"strings"
+	"testing"
+)
+
+// (sw *StatsCSVWriter) Write(rec StatsRecord) error
+//
+// go test -run Test_StatsCSVWriter_Write_
+//
+func Test_StatsCSVWriter_Write_(t *testing.T) {
+	var sb strings.Builder
+	sw := NewStatsCSVWriter(&sb)
+	err := sw.Write(TransferStats{BytesDelivered: 1})
+	if err != nil {
+		t.Error("0xEAE80A", err)
+	}
+	err = sw.Write(TransferStats{BytesDelivered: 2})
+	if err != nil {
+		t.Error("0xE18FC9", err)
+	}
+	want := "" +
+		"schema,bytes_delivered,bytes_lost,packets_delivered," +
+		"packets_lost,transfer_time_ns,packets_sent,packets_resent," +
+		"bytes_sent,average_rtt_ns,replies_rejected,value_bytes," +
+		"compressed_bytes,read_time_ns,compress_time_ns,encrypt_time_ns," +
+		"send_time_ns,ack_wait_time_ns\n" +
+		"1,1,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0\n" +
+		"1,2,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0\n"
+	if sb.String() != want {
+		t.Error("0xE6806C", "\nwant:\n"+want, "\ngot:\n"+sb.String())
+	}
+	// must not mix kinds of stats
+	err = sw.Write(ReceiverStats{})
+	if !matchError(err, "can't mix kinds of stats") {
+		t.Error("0xE9E1A0", "wrong error:", err)
+	}
+}
+
+// end
@@ -0,0 +1,53 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[stream_chunk.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// defaultStreamChunkSize is the size of the chunks sent by
+// Sender.SendFromReader() when Config.StreamChunkSize is zero.
+const defaultStreamChunkSize = 1024 * 1024 // 1 MiB
+
+// chunkKeyTag separates the name of a stream from the chunk
+// number and chunk count in the keys of the stream's chunks.
+const chunkKeyTag = "#chunk:"
+
+// ChunkKey returns the key under which Sender.SendFromReader() and
+// SendFromReaderAt() send chunk number 'n' (from 1 to 'count') of the
+// stream called 'name'.
+// For example, ChunkKey("backup.tar", 2, 5) returns "backup.tar#chunk:2/5".
+func ChunkKey(name string, n, count int64) string {
+	return name + chunkKeyTag +
+		strconv.FormatInt(n, 10) + "/" + strconv.FormatInt(count, 10)
+} //                                                                    ChunkKey
+
+// ParseChunkKey splits a key made by ChunkKey() into the name of the
+// stream, the chunk number and the number of chunks in the stream.
+// A Receive function can use it to join the chunks of a stream.
+//
+// Returns false if 'k' is not a valid chunk key.
+//
+func ParseChunkKey(k string) (name string, n, count int64, ok bool) {
+	at := strings.LastIndex(k, chunkKeyTag)
+	if at == -1 {
+		return "", 0, 0, false
+	}
+	nums := strings.SplitN(k[at+len(chunkKeyTag):], "/", 2)
+	if len(nums) != 2 {
+		return "", 0, 0, false
+	}
+	n, err1 := strconv.ParseInt(nums[0], 10, 64)
+	count, err2 := strconv.ParseInt(nums[1], 10, 64)
+	if err1 != nil || err2 != nil || n < 1 || n > count {
+		return "", 0, 0, false
+	}
+	return k[:at], n, count, true
+} //                                                               ParseChunkKey
+
+// end
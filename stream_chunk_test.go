@@ -0,0 +1,40 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[stream_chunk_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"testing"
+)
+
+// ChunkKey(name string, n, count int64) string
+// ParseChunkKey(k string) (name string, n, count int64, ok bool)
+//
+// go test -run Test_ChunkKey_
+//
+func Test_ChunkKey_(t *testing.T) {
+	k := ChunkKey("backup.tar", 2, 5)
+	if k != "backup.tar#chunk:2/5" {
+		t.Error("0xE8EC14", k)
+	}
+	name, n, count, ok := ParseChunkKey(k)
+	if name != "backup.tar" || n != 2 || count != 5 || !ok {
+		t.Error("0xE700FD", name, n, count, ok)
+	}
+	for _, k := range []string{
+		"backup.tar",
+		"backup.tar#chunk:2",
+		"backup.tar#chunk:a/5",
+		"backup.tar#chunk:0/5",
+		"backup.tar#chunk:6/5",
+	} {
+		_, _, _, ok := ParseChunkKey(k)
+		if ok {
+			t.Error("0xE6F6A2", k)
+		}
+	}
+}
+
+// end
@@ -0,0 +1,409 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[stream_receive.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+)
+
+// StreamCompression is implemented by a Compression that can uncompress
+// data while it is still arriving. Receiver.ReceiveStream needs it to
+// write data items without holding them in memory. The built-in zlib
+// Compressor implements it.
+type StreamCompression interface {
+	Compression
+
+	// NewUncompressReader returns a reader of the bytes
+	// uncompressed from the compressed bytes read from 'r'.
+	NewUncompressReader(r io.Reader) (io.ReadCloser, error)
+} //                                                           StreamCompression
+
+// streamAborter is implemented by writers returned by
+// Receiver.ReceiveStream that should be told why a data item
+// failed, such as *io.PipeWriter.
+type streamAborter interface {
+	CloseWithError(err error) error
+} //                                                               streamAborter
+
+// itemStream writes a data item being received to the writer returned
+// by Receiver.ReceiveStream. Compressed bytes are passed on as soon as
+// all bytes before them have arrived, to a goroutine that uncompresses
+// them into the writer. Only pieces that arrive ahead of their turn
+// are kept in memory.
+//
+// Pieces are placed by their offset in the compressed data, not by
+// their sequence number, since the Sender may split the item into
+// smaller pieces when the path MTU shrinks (see dataItem.layouts).
+//
+type itemStream struct {
+	key      string
+	hash     []byte // hash of the uncompressed value, from the header
+	compHash []byte // hash of the compressed value, or nil if not sent
+	w        io.WriteCloser
+
+	pw         *io.PipeWriter // compressed bytes to uncompress
+	done       chan error     // result of uncompressing
+	compHasher hash.Hash      // hashes the bytes written to 'pw'
+	written    int64          // number of bytes written to 'pw'
+	end        int64          // length of compressed value, or -1
+	finished   bool           // set when the item is complete or failed
+	err        error          // why the item failed, if it did
+
+	// pending holds pieces that arrived before the bytes preceding them,
+	// by offset. lastPieces holds last pieces whose offset isn't known
+	// yet, by packet count. pieceSizes holds the size of pieces other
+	// than the last, by packet count.
+	pending    map[int64][]byte
+	lastPieces map[int][]byte
+	pieceSizes map[int]int
+
+	// buffered is the number of bytes held in 'pending' and 'lastPieces'
+	// (see Configuration.StreamReorder)
+	buffered int64
+
+	// gapNacked is set once reorderReply() has sent a NACK for the gap
+	// that ends at offset gapAt, i.e. where 'written' was then
+	gapNacked bool
+	gapAt     int64
+
+	// size and dataHash are the length and hash of the uncompressed
+	// value, set by the uncompressing goroutine before 'done'
+	size     int64
+	dataHash []byte
+
+	// blocks holds back the compressed bytes until the block they belong
+	// to is verified, if the Sender sent verified blocks. Otherwise nil.
+	blocks *blockVerifier
+} //                                                                  itemStream
+
+// newItemStream creates an itemStream that writes the data item
+// described by 'h' to 'w', and starts uncompressing with 'comp'.
+// The value is hashed with 'hasher', or with SHA-256 if it is nil.
+func newItemStream(h *fragmentHeader, w io.WriteCloser, comp Compression,
+	hasher Hasher,
+) *itemStream {
+	pr, pw := io.Pipe()
+	st := &itemStream{
+		key:        h.key,
+		hash:       h.hash,
+		compHash:   h.compHash,
+		w:          w,
+		pw:         pw,
+		done:       make(chan error, 1),
+		compHasher: newHash(hasher),
+		end:        -1,
+		pending:    make(map[int64][]byte),
+		lastPieces: make(map[int][]byte),
+		pieceSizes: make(map[int]int),
+	}
+	if h.vroot != nil {
+		st.blocks = newBlockVerifier(h, hasher)
+	}
+	go func() {
+		hs := newHash(hasher)
+		n, err := uncompressStream(comp, pr, io.MultiWriter(w, hs))
+		if err != nil {
+			_ = pr.CloseWithError(err)
+		}
+		st.size = n
+		st.dataHash = hs.Sum(nil)
+		st.done <- err
+	}()
+	return st
+} //                                                               newItemStream
+
+// errReorderFull is returned by itemStream.putWithin() when a piece
+// that arrived ahead of its turn doesn't fit in the reordering buffer.
+var errReorderFull = errors.New("reorder buffer full")
+
+// put adds piece 'data', with 0-based 'index' out of 'count' pieces,
+// and writes any bytes that have become contiguous.
+func (st *itemStream) put(index, count int, data []byte) error {
+	return st.putWithin(index, count, data, 0)
+} //                                                                         put
+
+// putWithin is like put(), but if 'limit' is more than zero, and 'data'
+// arrived ahead of its turn, it only keeps 'data' if the pieces kept
+// in memory stay within 'limit' bytes. Otherwise it returns
+// errReorderFull, and the stream is unchanged.
+func (st *itemStream) putWithin(index, count int, data []byte, limit int64,
+) error {
+	if index == count-1 {
+		if count == 1 {
+			return st.place(0, data, true, limit)
+		}
+		size, ok := st.pieceSizes[count]
+		if !ok {
+			// keep the piece until its offset is known
+			growth := int64(len(data) - len(st.lastPieces[count]))
+			if limit > 0 && st.buffered+growth > limit {
+				return errReorderFull
+			}
+			st.lastPieces[count] = data
+			st.buffered += growth
+			return nil
+		}
+		return st.place(int64(count-1)*int64(size), data, true, limit)
+	}
+	size, ok := st.pieceSizes[count]
+	if ok && size != len(data) {
+		return makeError(0xE45D34, "piece size changed")
+	}
+	err := st.place(int64(index)*int64(len(data)), data, false, limit)
+	if err != nil {
+		return err
+	}
+	st.pieceSizes[count] = len(data)
+	if last := st.lastPieces[count]; last != nil {
+		delete(st.lastPieces, count)
+		st.buffered -= int64(len(last))
+		return st.place(int64(count-1)*int64(len(data)), last, true, 0)
+	}
+	return nil
+} //                                                                   putWithin
+
+// place writes 'data', which starts at offset 'off' of the compressed
+// value, if all bytes before it have been written. Otherwise it keeps
+// it until they have, unless that would take the bytes kept beyond
+// 'limit' (if more than zero). 'isLast' is true if 'data' ends the value.
+func (st *itemStream) place(off int64, data []byte, isLast bool,
+	limit int64,
+) error {
+	if off > st.written {
+		growth := int64(len(data) - len(st.pending[off]))
+		if growth <= 0 {
+			return st.setEnd(off, data, isLast)
+		}
+		if limit > 0 && st.buffered+growth > limit {
+			return errReorderFull
+		}
+		err := st.setEnd(off, data, isLast)
+		if err != nil {
+			return err
+		}
+		st.pending[off] = data
+		st.buffered += growth
+		return nil
+	}
+	err := st.setEnd(off, data, isLast)
+	if err != nil {
+		return err
+	}
+	err = st.write(off, data)
+	if err != nil {
+		return err
+	}
+	// write the pending pieces that have become contiguous
+	for progress := true; progress; {
+		progress = false
+		for off, data := range st.pending {
+			if off > st.written {
+				continue
+			}
+			delete(st.pending, off)
+			st.buffered -= int64(len(data))
+			err := st.write(off, data)
+			if err != nil {
+				return err
+			}
+			progress = true
+		}
+	}
+	return nil
+} //                                                                       place
+
+// setEnd records the length of the compressed value if 'data', which
+// starts at offset 'off', is its last piece ('isLast').
+func (st *itemStream) setEnd(off int64, data []byte, isLast bool) error {
+	if !isLast {
+		return nil
+	}
+	end := off + int64(len(data))
+	if st.end != -1 && st.end != end {
+		return makeError(0xED1B6D, "compressed data length changed")
+	}
+	st.end = end
+	return nil
+} //                                                                      setEnd
+
+// write writes the part of 'data' (which starts at offset 'off')
+// that hasn't been written yet. 'off' must not exceed st.written.
+// With verified blocks, the bytes are only passed on by release()
+// once the block they belong to has been verified.
+func (st *itemStream) write(off int64, data []byte) error {
+	end := off + int64(len(data))
+	if end <= st.written {
+		return nil // a duplicate, or overlapped by another layout's piece
+	}
+	if st.end != -1 && end > st.end {
+		return makeError(0xE2623F, "piece beyond end of compressed data")
+	}
+	data = data[st.written-off:]
+	st.compHasher.Write(data)
+	st.written = end
+	if st.blocks != nil {
+		return st.blocks.add(data, st.complete(), st.release)
+	}
+	return st.release(data)
+} //                                                                       write
+
+// release passes compressed bytes that have been
+// written (and verified) on to be uncompressed.
+func (st *itemStream) release(data []byte) error {
+	_, err := st.pw.Write(data)
+	if err != nil {
+		return makeError(0xE1EA25, err)
+	}
+	return nil
+} //                                                                     release
+
+// missing returns which of the pieces of the layout with 'count' pieces
+// haven't arrived yet, or nil if the size of its pieces isn't known yet.
+// A piece counts as arrived once all of its bytes have been written or
+// are pending, whichever layout they arrived in.
+func (st *itemStream) missing(count int) []bool {
+	if count == 1 {
+		return []bool{!st.complete()}
+	}
+	size, ok := st.pieceSizes[count]
+	if !ok {
+		return nil
+	}
+	ret := make([]bool, count)
+	for i := range ret {
+		off := int64(i) * int64(size)
+		end := off + int64(size)
+		if i == count-1 {
+			if st.end == -1 {
+				ret[i] = true
+				continue
+			}
+			end = st.end
+		}
+		pending, ok := st.pending[off]
+		ret[i] = end > st.written && !(ok && off+int64(len(pending)) >= end)
+	}
+	return ret
+} //                                                                     missing
+
+// progress returns the number of compressed bytes written so far, and
+// the length of the compressed value. Until the last piece has arrived,
+// the length is estimated from the size of the pieces of the layout
+// with 'count' pieces.
+func (st *itemStream) progress(count int) (written, total int64) {
+	total = st.end
+	if total == -1 {
+		total = int64(count) * int64(st.pieceSizes[count])
+	}
+	if total < st.written {
+		total = st.written
+	}
+	return st.written, total
+} //                                                                    progress
+
+// complete returns true if all compressed bytes have been written.
+func (st *itemStream) complete() bool {
+	return st.end != -1 && st.written == st.end
+} //                                                                    complete
+
+// finish waits until the item has been uncompressed into the writer,
+// checks its hashes, and closes the writer. Call it once complete()
+// returns true. Returns an error if the item is corrupted.
+func (st *itemStream) finish() error {
+	st.finished = true
+	_ = st.pw.Close()
+	err := <-st.done
+	switch {
+	case err != nil:
+		err = makeError(0xE9C82A, err)
+	case st.compHash != nil &&
+		!bytes.Equal(st.compHasher.Sum(nil), st.compHash):
+		err = makeError(0xE6DEA8,
+			"compressed data hash mismatch (corrupted before uncompressing)")
+	case !bytes.Equal(st.dataHash, st.hash):
+		err = makeError(0xEFEEE1, "hash mismatch")
+	}
+	st.err = err
+	return closeStreamWriter(st.w, err)
+} //                                                                      finish
+
+// abort stops writing the item because of 'err',
+// and closes the writer. It does nothing if the
+// item has already finished or been aborted.
+func (st *itemStream) abort(err error) {
+	if st.finished {
+		return
+	}
+	st.finished = true
+	st.err = err
+	_ = st.pw.CloseWithError(err)
+	<-st.done
+	_ = closeStreamWriter(st.w, err)
+} //                                                                       abort
+
+// uncompressStream uncompresses the bytes read from 'r' into 'w', and
+// returns the number of uncompressed bytes. If 'comp' can't uncompress
+// a stream, it reads all of 'r' into memory and uncompresses it at once.
+func uncompressStream(comp Compression, r io.Reader, w io.Writer,
+) (int64, error) {
+	sc, ok := comp.(StreamCompression)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return 0, makeError(0xE03065, err)
+		}
+		data, err = comp.Uncompress(data)
+		if err != nil {
+			return 0, makeError(0xE3816D, err)
+		}
+		n, err := w.Write(data)
+		if err != nil {
+			return int64(n), makeError(0xE21C98, err)
+		}
+		return int64(n), nil
+	}
+	rd, err := sc.NewUncompressReader(r)
+	if err != nil {
+		return 0, makeError(0xEA20F8, err)
+	}
+	n, err := io.Copy(w, rd)
+	if err != nil {
+		return n, makeError(0xEC338F, err)
+	}
+	err = rd.Close()
+	if err != nil {
+		return n, makeError(0xE9ED06, err)
+	}
+	// skip anything after the compressed stream, like zlib's size suffix
+	_, err = io.Copy(io.Discard, r)
+	if err != nil {
+		return n, makeError(0xE05C01, err)
+	}
+	return n, nil
+} //                                                            uncompressStream
+
+// closeStreamWriter closes 'w' and returns 'err' if it is not nil. Writers
+// that implement streamAborter are then closed with CloseWithError(err).
+func closeStreamWriter(w io.WriteCloser, err error) error {
+	if err == nil {
+		err = w.Close()
+		if err != nil {
+			return makeError(0xEC73BE, err)
+		}
+		return nil
+	}
+	if ab, ok := w.(streamAborter); ok {
+		_ = ab.CloseWithError(err)
+	} else {
+		_ = w.Close()
+	}
+	return err
+} //                                                           closeStreamWriter
+
+// end
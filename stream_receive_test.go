@@ -0,0 +1,187 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /[stream_receive_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// (st *itemStream) put(index, count int, data []byte) error
+//
+// go test -run Test_itemStream_put_
+//
+func Test_itemStream_put_(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	var buf streamBuffer
+	st := newItemStream(&fragmentHeader{hash: getHash(v)},
+		&buf, &zlibCompressor{}, nil)
+	// the first half in 100-byte pieces, in reverse order, then all
+	// the pieces of a 70-byte layout, last first (as after resplitting)
+	big := splitTestPieces(comp, 100)
+	small := splitTestPieces(comp, 70)
+	for i := len(big)/2 - 1; i >= 0; i-- {
+		if err := st.put(i, len(big), big[i]); err != nil {
+			t.Error("0xEB7BDF", err)
+		}
+	}
+	if st.written != int64(len(big)/2*100) || len(st.pending) != 0 {
+		t.Error("0xE0AD83", st.written, len(st.pending))
+	}
+	for i := len(small) - 1; i >= 0; i-- {
+		if err := st.put(i, len(small), small[i]); err != nil {
+			t.Error("0xE7911A", err)
+		}
+	}
+	if !st.complete() {
+		t.Fatal("0xE7A4EB", st.written, st.end)
+	}
+	if err := st.finish(); err != nil {
+		t.Error("0xE3E9FB", err)
+	}
+	if !bytes.Equal(buf.Bytes(), v) || !buf.closed || buf.closeErr != nil {
+		t.Error("0xE01F6D", buf.Len(), buf.closed, buf.closeErr)
+	}
+	// must reject a piece that doesn't match the size of the others
+	st = newItemStream(&fragmentHeader{hash: getHash(v)},
+		&streamBuffer{}, &zlibCompressor{}, nil)
+	_ = st.put(1, len(big), big[1])
+	err := st.put(2, len(big), big[2][:50])
+	if !matchError(err, "piece size changed") {
+		t.Error("0xE98357", "wrong error:", err)
+	}
+	st.abort(err)
+}
+
+// (st *itemStream) finish() error
+//
+// go test -run Test_itemStream_finish_
+//
+func Test_itemStream_finish_(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	for _, cmp := range []Compression{
+		&zlibCompressor{},
+		struct{ Compression }{&zlibCompressor{}}, // not a StreamCompression
+	} {
+		// must close the writer with an error when the hash doesn't match
+		var buf streamBuffer
+		hash := getHash(append([]byte("x"), v...))
+		st := newItemStream(&fragmentHeader{hash: hash}, &buf, cmp, nil)
+		_ = st.put(0, 1, comp)
+		err := st.finish()
+		if !matchError(err, "hash mismatch") {
+			t.Error("0xEC0CE2", "wrong error:", err)
+		}
+		if !buf.closed || buf.closeErr != err {
+			t.Error("0xE0B6E8", buf.closed, buf.closeErr)
+		}
+		if !bytes.Equal(buf.Bytes(), v) {
+			t.Error("0xE15CA0", buf.Len())
+		}
+	}
+}
+
+// (st *itemStream) missing(count int) []bool
+//
+// go test -run Test_itemStream_missing_
+//
+func Test_itemStream_missing_(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	st := newItemStream(&fragmentHeader{hash: getHash(v)},
+		&streamBuffer{}, &zlibCompressor{}, nil)
+	defer st.abort(makeError(0xE37C29, "test ended"))
+	pieces := splitTestPieces(comp, 100)
+	n := len(pieces)
+	if st.missing(n) != nil {
+		t.Error("0xE8FDD9", "piece size isn't known yet")
+	}
+	// piece 1 is written, 3 is pending, and the last one is unplaced
+	_ = st.put(0, n, pieces[0])
+	_ = st.put(1, n, pieces[1])
+	_ = st.put(3, n, pieces[3])
+	missing := st.missing(n)
+	for i, miss := range missing {
+		if miss != (i == 2 || i > 3) {
+			t.Error("0xE64C9C", i, miss)
+		}
+	}
+	_ = st.put(n-1, n, pieces[n-1])
+	if st.missing(n)[n-1] {
+		t.Error("0xEEB6D9")
+	}
+}
+
+// (st *itemStream) progress(count int) (written, total int64)
+//
+// go test -run Test_itemStream_progress_
+//
+func Test_itemStream_progress_(t *testing.T) {
+	v, comp := makeTestStreamItem(t)
+	st := newItemStream(&fragmentHeader{hash: getHash(v)},
+		&streamBuffer{}, &zlibCompressor{}, nil)
+	defer st.abort(makeError(0xEBC344, "test ended"))
+	pieces := splitTestPieces(comp, 100)
+	n := len(pieces)
+	_ = st.put(0, n, pieces[0])
+	written, total := st.progress(n)
+	if written != 100 || total != int64(n*100) {
+		t.Error("0xEFD399", written, total)
+	}
+	for i := 1; i < n; i++ {
+		_ = st.put(i, n, pieces[i])
+	}
+	written, total = st.progress(n)
+	if written != int64(len(comp)) || total != int64(len(comp)) {
+		t.Error("0xE845FA", written, total, len(comp))
+	}
+}
+
+// makeTestStreamItem returns a value and its compressed bytes, which
+// are long enough to be split into many pieces.
+func makeTestStreamItem(t *testing.T) (v, comp []byte) {
+	v = make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(v[:2500])
+	comp, err := (&zlibCompressor{}).Compress(v)
+	if err != nil {
+		t.Fatal("0xEA1C98", err)
+	}
+	return v, comp
+}
+
+// splitTestPieces splits 'comp' into pieces of 'size' bytes,
+// the way Sender.splitPackets() does.
+func splitTestPieces(comp []byte, size int) [][]byte {
+	var ret [][]byte
+	for len(comp) > size {
+		ret = append(ret, comp[:size])
+		comp = comp[size:]
+	}
+	return append(ret, comp)
+}
+
+// streamBuffer is a bytes.Buffer that implements
+// io.WriteCloser and records how it was closed.
+type streamBuffer struct {
+	bytes.Buffer
+	closed   bool
+	closeErr error
+}
+
+// Close implements io.Closer.
+func (sb *streamBuffer) Close() error {
+	sb.closed = true
+	return nil
+}
+
+// CloseWithError implements streamAborter.
+func (sb *streamBuffer) CloseWithError(err error) error {
+	sb.closed = true
+	sb.closeErr = err
+	return nil
+}
+
+// end
@@ -0,0 +1,186 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                  /[strict_crypto.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sync"
+)
+
+// strictNonceSize and strictTagSize are the AEAD parameters pinned by
+// Configuration.StrictCrypto: a 96-bit nonce and a full 128-bit tag.
+const (
+	strictNonceSize = 12
+	strictTagSize   = 16
+)
+
+// strictCipher is implemented by the built-in ciphers that can pin
+// their AEAD parameters when Configuration.StrictCrypto is enabled.
+type strictCipher interface {
+
+	// setStrict turns strict mode on or off. In strict mode, the cipher
+	// refuses keys that would give it any other AEAD parameters than
+	// strictNonceSize and strictTagSize, and refuses packets too short
+	// to contain a full nonce and tag (e.g. packets with truncated tags).
+	//
+	// Returns an error if the cipher is already
+	// initialized with other AEAD parameters.
+	//
+	setStrict(strict bool) error
+} //                                                                strictCipher
+
+// cryptoSelfTest runs the crypto self-tests of Configuration.StrictCrypto
+// once per Sender or Receiver, instead of at the start of every Send.
+type cryptoSelfTest struct {
+	once sync.Once
+	err  error
+} //                                                              cryptoSelfTest
+
+// run runs the self-tests for the type of 'cphr' the first
+// time it is called, and returns their result every time.
+func (st *cryptoSelfTest) run(cphr SymmetricCipher) error {
+	st.once.Do(func() {
+		st.err = runCryptoSelfTests(cphr)
+	})
+	return st.err
+} //                                                                         run
+
+// checkStrictCrypto is called at startup, after the cipher has been given
+// its key. When Configuration.StrictCrypto is enabled, it pins the AEAD
+// parameters of the cipher and runs the crypto self-tests, unless 'st'
+// has already run them.
+func checkStrictCrypto(cf *Configuration, st *cryptoSelfTest) error {
+	sc, ok := cf.Cipher.(strictCipher)
+	if !cf.StrictCrypto {
+		if ok {
+			_ = sc.setStrict(false)
+		}
+		return nil
+	}
+	if !ok {
+		return makeError(0xEC9C2F,
+			"Configuration.StrictCrypto requires a built-in cipher")
+	}
+	err := sc.setStrict(true)
+	if err != nil {
+		return err
+	}
+	return st.run(cf.Cipher)
+} //                                                           checkStrictCrypto
+
+// runCryptoSelfTests runs the known answer test of AES-256-GCM, if
+// 'cphr' uses it, then cipherSelfTest() on a new cipher of the same
+// type. The new cipher is keyed and draws its nonces from crypto/rand,
+// so the self-tests never use up Configuration.Random.
+func runCryptoSelfTests(cphr SymmetricCipher) error {
+	var (
+		fresh SymmetricCipher
+		err   error
+	)
+	switch c := cphr.(type) {
+	case *aesCipher:
+		err = aesKnownAnswerTest()
+		fresh = &aesCipher{strict: true}
+	case *aeadCipher:
+		// modules that add AEAD algorithms test them against
+		// known answers themselves, e.g. udpt/chacha
+		fresh = &aeadCipher{name: c.name, newAEAD: c.newAEAD, strict: true}
+	default:
+		return cipherSelfTest(cphr)
+	}
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return makeError(0xE6D2B8, err)
+	}
+	err = fresh.SetKey(key)
+	if err != nil {
+		return makeError(0xE3A9C5, err)
+	}
+	return cipherSelfTest(fresh)
+} //                                                          runCryptoSelfTests
+
+// checkAEADParams returns an error if the nonce or tag size of 'aead'
+// differs from the parameters pinned by Configuration.StrictCrypto.
+func checkAEADParams(aead cipher.AEAD) error {
+	if aead.NonceSize() != strictNonceSize ||
+		aead.Overhead() != strictTagSize {
+		return makeError(0xEF317E, "AEAD parameters differ from",
+			strictNonceSize, "byte nonce and", strictTagSize, "byte tag")
+	}
+	return nil
+} //                                                             checkAEADParams
+
+// aesKnownAnswerTest checks that AES-256-GCM produces the expected
+// ciphertext and tag for Test Case 14 of "The Galois/Counter Mode of
+// Operation (GCM)" by McGrew and Viega: a zero key, zero nonce and a
+// zero 16-byte plaintext.
+func aesKnownAnswerTest() error {
+	const want = "cea7403d4d606b6e074ec5d3baf39d18" + // ciphertext
+		"d0d1c8a799996bf0265b98b5d48ab919" // tag
+	ac := aesCipher{strict: true}
+	err := ac.SetKey(make([]byte, 32))
+	if err != nil {
+		return makeError(0xEC2A0B, err)
+	}
+	zeroNonce := func(_ io.Reader, b []byte) (int, error) {
+		for i := range b {
+			b[i] = 0
+		}
+		return len(b), nil
+	}
+	ciphertext, err := ac.encryptDI(make([]byte, 16), nil, zeroNonce)
+	if err != nil {
+		return makeError(0xE9E524, err)
+	}
+	got := hex.EncodeToString(ciphertext[strictNonceSize:])
+	if got != want {
+		return makeError(0xEEE2AC, "AES-256-GCM known answer test failed")
+	}
+	return nil
+} //                                                          aesKnownAnswerTest
+
+// cipherSelfTest checks that 'cphr', already initialized with its key,
+// decrypts what it encrypts, uses a fresh nonce for each packet and
+// rejects tampered and truncated packets.
+func cipherSelfTest(cphr SymmetricCipher) error {
+	plaintext := []byte("udpt cipher self-test")
+	c1, err := cphr.Encrypt(plaintext)
+	if err != nil {
+		return makeError(0xEB584D, "cipher self-test:", err)
+	}
+	c2, err := cphr.Encrypt(plaintext)
+	if err != nil {
+		return makeError(0xEAAA7E, "cipher self-test:", err)
+	}
+	if bytes.Equal(c1, c2) {
+		return makeError(0xEE6CEF, "cipher self-test: nonce reused")
+	}
+	got, err := cphr.Decrypt(c1)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		return makeError(0xED3FE3, "cipher self-test: decryption failed")
+	}
+	tampered := append([]byte(nil), c1...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err = cphr.Decrypt(tampered); err == nil {
+		return makeError(0xE64E28,
+			"cipher self-test: accepted a tampered packet")
+	}
+	if _, err = cphr.Decrypt(c1[:len(c1)-1]); err == nil {
+		return makeError(0xEF5525,
+			"cipher self-test: accepted a truncated packet")
+	}
+	return nil
+} //                                                              cipherSelfTest
+
+// end
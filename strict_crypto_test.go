@@ -0,0 +1,147 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                             /[strict_crypto_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"sync"
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_strictCrypto_*
+
+// -----------------------------------------------------------------------------
+
+// plainCipher is a SymmetricCipher that doesn't encrypt at all,
+// used to check that self-tests catch a broken cipher.
+type plainCipher struct{}
+
+func (*plainCipher) ValidateKey([]byte) error         { return nil }
+func (*plainCipher) SetKey([]byte) error              { return nil }
+func (*plainCipher) Encrypt(b []byte) ([]byte, error) { return b, nil }
+func (*plainCipher) Decrypt(b []byte) ([]byte, error) { return b, nil }
+
+// -----------------------------------------------------------------------------
+
+// checkStrictCrypto(cf *Configuration, st *cryptoSelfTest) error
+//
+// go test -run Test_strictCrypto_checkStrictCrypto_
+//
+func Test_strictCrypto_checkStrictCrypto_(t *testing.T) {
+	cf := NewDefaultConfig()
+	ac := cf.Cipher.(*aesCipher)
+	_ = ac.SetKey([]byte(testAESKey))
+	if err := checkStrictCrypto(cf, &cryptoSelfTest{}); err != nil || ac.strict {
+		t.Error("0xE5E830", err)
+	}
+	cf.StrictCrypto = true
+	if err := checkStrictCrypto(cf, &cryptoSelfTest{}); err != nil || !ac.strict {
+		t.Error("0xE41886", err)
+	}
+	cf.Cipher = &plainCipher{}
+	err := checkStrictCrypto(cf, &cryptoSelfTest{})
+	if !matchError(err, "StrictCrypto requires a built-in cipher") {
+		t.Error("0xEF1DB8", "wrong error:", err)
+	}
+}
+
+// must be safe while others that share the cipher use it, e.g. the
+// Senders of SendMany (run with -race to check)
+func Test_strictCrypto_checkStrictCrypto_2(t *testing.T) {
+	cf := NewDefaultConfig()
+	cf.StrictCrypto = true
+	_ = cf.Cipher.SetKey([]byte(testAESKey))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := checkStrictCrypto(cf, &cryptoSelfTest{}); err != nil {
+					t.Error("0xE7B2C4", err)
+				}
+				sealed, _ := cf.Cipher.Encrypt([]byte("abc"))
+				if _, err := cf.Cipher.Decrypt(sealed); err != nil {
+					t.Error("0xE1D9F3", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// (st *cryptoSelfTest) run(cphr SymmetricCipher) error
+//
+// go test -run Test_strictCrypto_cryptoSelfTest_
+//
+// must run the self-tests only once, and return their result every time
+func Test_strictCrypto_cryptoSelfTest_(t *testing.T) {
+	var st cryptoSelfTest
+	for i := 0; i < 2; i++ {
+		err := st.run(&plainCipher{})
+		if !matchError(err, "nonce reused") {
+			t.Error("0xE2B8D6", i, "wrong error:", err)
+		}
+	}
+	if err := st.run(newTestAESCipher(t)); err == nil {
+		t.Error("0xE3D8F2", "must not run the self-tests again")
+	}
+	st = cryptoSelfTest{}
+	if err := st.run(newTestAESCipher(t)); err != nil {
+		t.Error("0xE6B4C9", err)
+	}
+}
+
+// cipherSelfTest(cphr SymmetricCipher) error
+//
+// go test -run Test_strictCrypto_cipherSelfTest_
+//
+func Test_strictCrypto_cipherSelfTest_(t *testing.T) {
+	if err := cipherSelfTest(newTestAESCipher(t)); err != nil {
+		t.Error("0xED0DA5", err)
+	}
+	err := cipherSelfTest(&plainCipher{})
+	if !matchError(err, "nonce reused") {
+		t.Error("0xE2D569", "wrong error:", err)
+	}
+	if err := aesKnownAnswerTest(); err != nil {
+		t.Error("0xE19843", err)
+	}
+}
+
+// strict mode must refuse truncated packets and short tags
+//
+// go test -run Test_strictCrypto_aesCipher_
+//
+func Test_strictCrypto_aesCipher_(t *testing.T) {
+	ac := newTestAESCipher(t)
+	ciphertext, _ := ac.Encrypt(nil)
+	_ = ac.setStrict(true)
+	_, err := ac.Decrypt(ciphertext[:strictNonceSize+8])
+	if !matchError(err, "truncated ciphertext") {
+		t.Error("0xE4F3F7", "wrong error:", err)
+	}
+	shortTag := func(c cipher.Block) (cipher.AEAD, error) {
+		return cipher.NewGCMWithTagSize(c, 12)
+	}
+	ac = &aesCipher{strict: true}
+	err = ac.setKeyDI([]byte(testAESKey), aes.NewCipher, shortTag)
+	if !matchError(err, "AEAD parameters differ") {
+		t.Error("0xE3EB00", "wrong error:", err)
+	}
+	ac.strict = false
+	err = ac.setKeyDI([]byte(testAESKey), aes.NewCipher, shortTag)
+	if err != nil {
+		t.Error("0xE355C9", err)
+	}
+	if err = ac.setStrict(true); !matchError(err, "AEAD parameters differ") {
+		t.Error("0xECEC30", "wrong error:", err)
+	}
+}
+
+// end
@@ -19,6 +19,9 @@ type SymmetricCipher interface {
 	// If the cipher is already initialized with the given key, does nothing.
 	// The same key is used for encryption and decryption.
 	//
+	// Implementations must keep a copy of the key rather than
+	// 'cryptoKey' itself, since callers may reuse or zero it.
+	//
 	SetKey(cryptoKey []byte) error
 
 	// Encrypt encrypts plaintext using the key given to SetKey and
@@ -36,4 +39,23 @@ type SymmetricCipher interface {
 	Decrypt(ciphertext []byte) (plaintext []byte, err error)
 } //                                                             SymmetricCipher
 
+// AADCipher is an optional interface implemented by ciphers that can bind
+// additional authenticated data (AAD) to ciphertext. The AAD isn't sent,
+// but decryption fails unless the same AAD is given to DecryptAAD that
+// was given to EncryptAAD. The built-in ciphers implement AADCipher.
+//
+// SendOptions.AAD and Receiver.AAD require a cipher that implements it.
+//
+type AADCipher interface {
+	SymmetricCipher
+
+	// EncryptAAD encrypts plaintext like Encrypt,
+	// and binds 'aad' to the returned ciphertext.
+	EncryptAAD(plaintext, aad []byte) (ciphertext []byte, err error)
+
+	// DecryptAAD decrypts ciphertext like Decrypt, but fails
+	// if the ciphertext was not encrypted with the same 'aad'.
+	DecryptAAD(ciphertext, aad []byte) (plaintext []byte, err error)
+} //                                                                   AADCipher
+
 // end
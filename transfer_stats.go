@@ -0,0 +1,353 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[transfer_stats.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// TransferStats contains statistics of a data item transfer,
+// such as the number of packets and bytes delivered and lost.
+type TransferStats struct {
+
+	// BytesDelivered is the number of bytes in delivered packets.
+	BytesDelivered int64
+
+	// BytesLost is the number of bytes in packets that were not confirmed.
+	BytesLost int64
+
+	// PacketsDelivered is the number of packets confirmed by the Receiver.
+	PacketsDelivered int64
+
+	// PacketsLost is the number of packets not confirmed by the Receiver.
+	PacketsLost int64
+
+	// TransferTime is the time spent sending packets and
+	// waiting for their confirmations.
+	TransferTime time.Duration
+
+	// PacketsSent is the number of packets written to the network,
+	// including retransmissions.
+	PacketsSent int64
+
+	// PacketsResent is the number of packets in PacketsSent that
+	// were retransmissions of lost packets.
+	PacketsResent int64
+
+	// BytesSent is the number of bytes in the packets sent,
+	// before encryption.
+	BytesSent int64
+
+	// AverageRTT is the average round-trip time of the packets
+	// confirmed: from sending each packet to receiving its confirmation.
+	AverageRTT time.Duration
+
+	// RepliesRejected is the number of replies from the Receiver that
+	// couldn't be decrypted, e.g. replies encrypted with another key.
+	RepliesRejected int64
+
+	// ValueBytes is the size of the values sent,
+	// and CompressedBytes their size after compression.
+	ValueBytes      int64
+	CompressedBytes int64
+
+	// ReadTime, CompressTime, EncryptTime, SendTime and AckWaitTime are
+	// the times spent in each stage of sending: reading the values from
+	// files or readers, compressing them, encrypting packets, writing
+	// packets to the network, and waiting for the Receiver to confirm
+	// them. Encryption and sending run in several workers at once, so
+	// their times can add up to more than TransferTime. Stages() gives
+	// the throughput of each stage.
+	ReadTime     time.Duration
+	CompressTime time.Duration
+	EncryptTime  time.Duration
+	SendTime     time.Duration
+	AckWaitTime  time.Duration
+} //                                                               TransferStats
+
+// PipelineStage contains the statistics of a stage of sending.
+// See TransferStats.Stages().
+type PipelineStage struct {
+
+	// Name is "read", "compress", "encrypt", "send" or "ack-wait".
+	Name string
+
+	// Time is the time spent in the stage.
+	Time time.Duration
+
+	// Bytes is the number of bytes that passed through the stage.
+	Bytes int64
+} //                                                               PipelineStage
+
+// BytesPerSecond returns the throughput of the stage,
+// or 0 if no time was spent in it.
+func (ps PipelineStage) BytesPerSecond() float64 {
+	if ps.Time <= 0 {
+		return 0
+	}
+	return float64(ps.Bytes) / ps.Time.Seconds()
+} //                                                              BytesPerSecond
+
+// makeTransferStats returns the exported form of internal udpStats.
+func makeTransferStats(st udpStats) TransferStats {
+	ret := TransferStats{
+		BytesDelivered:   st.bytesDelivered,
+		BytesLost:        st.bytesLost,
+		PacketsDelivered: st.packetsDelivered,
+		PacketsLost:      st.packetsLost,
+		TransferTime:     st.transferTime,
+		PacketsSent:      st.packetsSent,
+		PacketsResent:    st.packetsResent,
+		BytesSent:        st.bytesSent,
+		RepliesRejected:  st.repliesRejected,
+		ValueBytes:       st.valueBytes,
+		CompressedBytes:  st.compressedBytes,
+		ReadTime:         st.readTime,
+		CompressTime:     st.compressTime,
+		EncryptTime:      time.Duration(st.encryptNanos),
+		SendTime:         time.Duration(st.sendNanos),
+		AckWaitTime:      st.ackWaitTime,
+	}
+	if st.rttCount > 0 {
+		ret.AverageRTT = time.Duration(st.rttNanos / st.rttCount)
+	}
+	return ret
+} //                                                           makeTransferStats
+
+// CompressionRatio returns ValueBytes divided by CompressedBytes,
+// e.g. 4.0 if the values were compressed to a quarter of their size.
+// Returns 0 if nothing has been sent.
+func (st TransferStats) CompressionRatio() float64 {
+	if st.CompressedBytes == 0 {
+		return 0
+	}
+	return float64(st.ValueBytes) / float64(st.CompressedBytes)
+} //                                                            CompressionRatio
+
+// Stages returns the statistics of each stage of sending, in pipeline
+// order, to find the bottleneck: slow reading or compression is bound
+// by the CPU or disk, slow sending by the network, and a long wait for
+// confirmations by the path or the Receiver.
+func (st TransferStats) Stages() []PipelineStage {
+	return []PipelineStage{
+		{Name: "read", Time: st.ReadTime, Bytes: st.ValueBytes},
+		{Name: "compress", Time: st.CompressTime, Bytes: st.ValueBytes},
+		{Name: "encrypt", Time: st.EncryptTime, Bytes: st.BytesSent},
+		{Name: "send", Time: st.SendTime, Bytes: st.BytesSent},
+		{Name: "ack-wait", Time: st.AckWaitTime, Bytes: st.BytesDelivered},
+	}
+} //                                                                      Stages
+
+// load returns a copy of the statistics, reading the fields that are
+// updated concurrently with atomic operations.
+func (st *udpStats) load() udpStats {
+	return udpStats{
+		bytesDelivered:   st.bytesDelivered,
+		bytesLost:        st.bytesLost,
+		packetsDelivered: st.packetsDelivered,
+		packetsLost:      st.packetsLost,
+		transferTime:     st.transferTime,
+		packetsSent:      atomic.LoadInt64(&st.packetsSent),
+		packetsResent:    atomic.LoadInt64(&st.packetsResent),
+		bytesSent:        atomic.LoadInt64(&st.bytesSent),
+		rttNanos:         atomic.LoadInt64(&st.rttNanos),
+		rttCount:         atomic.LoadInt64(&st.rttCount),
+		repliesRejected:  atomic.LoadInt64(&st.repliesRejected),
+		valueBytes:       st.valueBytes,
+		compressedBytes:  st.compressedBytes,
+		readTime:         st.readTime,
+		compressTime:     st.compressTime,
+		encryptNanos:     atomic.LoadInt64(&st.encryptNanos),
+		sendNanos:        atomic.LoadInt64(&st.sendNanos),
+		ackWaitTime:      st.ackWaitTime,
+	}
+} //                                                                        load
+
+// add returns the sum of the statistics 'st' and 'other'.
+func (st udpStats) add(other udpStats) udpStats {
+	return udpStats{
+		bytesDelivered:   st.bytesDelivered + other.bytesDelivered,
+		bytesLost:        st.bytesLost + other.bytesLost,
+		packetsDelivered: st.packetsDelivered + other.packetsDelivered,
+		packetsLost:      st.packetsLost + other.packetsLost,
+		transferTime:     st.transferTime + other.transferTime,
+		packetsSent:      st.packetsSent + other.packetsSent,
+		packetsResent:    st.packetsResent + other.packetsResent,
+		bytesSent:        st.bytesSent + other.bytesSent,
+		rttNanos:         st.rttNanos + other.rttNanos,
+		rttCount:         st.rttCount + other.rttCount,
+		repliesRejected:  st.repliesRejected + other.repliesRejected,
+		valueBytes:       st.valueBytes + other.valueBytes,
+		compressedBytes:  st.compressedBytes + other.compressedBytes,
+		readTime:         st.readTime + other.readTime,
+		compressTime:     st.compressTime + other.compressTime,
+		encryptNanos:     st.encryptNanos + other.encryptNanos,
+		sendNanos:        st.sendNanos + other.sendNanos,
+		ackWaitTime:      st.ackWaitTime + other.ackWaitTime,
+	}
+} //                                                                         add
+
+// sub returns the statistics 'st' less 'before', i.e. their increase.
+func (st udpStats) sub(before udpStats) udpStats {
+	return udpStats{
+		bytesDelivered:   st.bytesDelivered - before.bytesDelivered,
+		bytesLost:        st.bytesLost - before.bytesLost,
+		packetsDelivered: st.packetsDelivered - before.packetsDelivered,
+		packetsLost:      st.packetsLost - before.packetsLost,
+		transferTime:     st.transferTime - before.transferTime,
+		packetsSent:      st.packetsSent - before.packetsSent,
+		packetsResent:    st.packetsResent - before.packetsResent,
+		bytesSent:        st.bytesSent - before.bytesSent,
+		rttNanos:         st.rttNanos - before.rttNanos,
+		rttCount:         st.rttCount - before.rttCount,
+		repliesRejected:  st.repliesRejected - before.repliesRejected,
+		valueBytes:       st.valueBytes - before.valueBytes,
+		compressedBytes:  st.compressedBytes - before.compressedBytes,
+		readTime:         st.readTime - before.readTime,
+		compressTime:     st.compressTime - before.compressTime,
+		encryptNanos:     st.encryptNanos - before.encryptNanos,
+		sendNanos:        st.sendNanos - before.sendNanos,
+		ackWaitTime:      st.ackWaitTime - before.ackWaitTime,
+	}
+} //                                                                         sub
+
+// transferStatsJSON is the JSON form of TransferStats. Its field
+// names are part of the schema identified by StatsSchemaVersion.
+type transferStatsJSON struct {
+	Schema           int   `json:"schema"`
+	BytesDelivered   int64 `json:"bytes_delivered"`
+	BytesLost        int64 `json:"bytes_lost"`
+	PacketsDelivered int64 `json:"packets_delivered"`
+	PacketsLost      int64 `json:"packets_lost"`
+	TransferTimeNs   int64 `json:"transfer_time_ns"`
+	PacketsSent      int64 `json:"packets_sent"`
+	PacketsResent    int64 `json:"packets_resent"`
+	BytesSent        int64 `json:"bytes_sent"`
+	AverageRTTNs     int64 `json:"average_rtt_ns"`
+	RepliesRejected  int64 `json:"replies_rejected"`
+	ValueBytes       int64 `json:"value_bytes"`
+	CompressedBytes  int64 `json:"compressed_bytes"`
+	ReadTimeNs       int64 `json:"read_time_ns"`
+	CompressTimeNs   int64 `json:"compress_time_ns"`
+	EncryptTimeNs    int64 `json:"encrypt_time_ns"`
+	SendTimeNs       int64 `json:"send_time_ns"`
+	AckWaitTimeNs    int64 `json:"ack_wait_time_ns"`
+} //                                                           transferStatsJSON
+
+// MarshalJSON encodes the statistics as a JSON object with stable,
+// snake_case field names and a "schema" field holding
+// StatsSchemaVersion. The durations are given in nanoseconds.
+func (st TransferStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(transferStatsJSON{
+		Schema:           StatsSchemaVersion,
+		BytesDelivered:   st.BytesDelivered,
+		BytesLost:        st.BytesLost,
+		PacketsDelivered: st.PacketsDelivered,
+		PacketsLost:      st.PacketsLost,
+		TransferTimeNs:   int64(st.TransferTime),
+		PacketsSent:      st.PacketsSent,
+		PacketsResent:    st.PacketsResent,
+		BytesSent:        st.BytesSent,
+		AverageRTTNs:     int64(st.AverageRTT),
+		RepliesRejected:  st.RepliesRejected,
+		ValueBytes:       st.ValueBytes,
+		CompressedBytes:  st.CompressedBytes,
+		ReadTimeNs:       int64(st.ReadTime),
+		CompressTimeNs:   int64(st.CompressTime),
+		EncryptTimeNs:    int64(st.EncryptTime),
+		SendTimeNs:       int64(st.SendTime),
+		AckWaitTimeNs:    int64(st.AckWaitTime),
+	})
+} //                                                                 MarshalJSON
+
+// UnmarshalJSON decodes statistics encoded by MarshalJSON. It returns
+// an error if the data has a newer schema than StatsSchemaVersion.
+func (st *TransferStats) UnmarshalJSON(data []byte) error {
+	var js transferStatsJSON
+	err := json.Unmarshal(data, &js)
+	if err != nil {
+		return err
+	}
+	err = checkStatsSchema(js.Schema)
+	if err != nil {
+		return err
+	}
+	*st = TransferStats{
+		BytesDelivered:   js.BytesDelivered,
+		BytesLost:        js.BytesLost,
+		PacketsDelivered: js.PacketsDelivered,
+		PacketsLost:      js.PacketsLost,
+		TransferTime:     time.Duration(js.TransferTimeNs),
+		PacketsSent:      js.PacketsSent,
+		PacketsResent:    js.PacketsResent,
+		BytesSent:        js.BytesSent,
+		AverageRTT:       time.Duration(js.AverageRTTNs),
+		RepliesRejected:  js.RepliesRejected,
+		ValueBytes:       js.ValueBytes,
+		CompressedBytes:  js.CompressedBytes,
+		ReadTime:         time.Duration(js.ReadTimeNs),
+		CompressTime:     time.Duration(js.CompressTimeNs),
+		EncryptTime:      time.Duration(js.EncryptTimeNs),
+		SendTime:         time.Duration(js.SendTimeNs),
+		AckWaitTime:      time.Duration(js.AckWaitTimeNs),
+	}
+	return nil
+} //                                                               UnmarshalJSON
+
+// CSVHeader returns the CSV column names of the
+// statistics, matching the fields of CSVRecord().
+// Implements StatsRecord.
+func (st TransferStats) CSVHeader() []string {
+	return []string{
+		"schema",
+		"bytes_delivered",
+		"bytes_lost",
+		"packets_delivered",
+		"packets_lost",
+		"transfer_time_ns",
+		"packets_sent",
+		"packets_resent",
+		"bytes_sent",
+		"average_rtt_ns",
+		"replies_rejected",
+		"value_bytes",
+		"compressed_bytes",
+		"read_time_ns",
+		"compress_time_ns",
+		"encrypt_time_ns",
+		"send_time_ns",
+		"ack_wait_time_ns",
+	}
+} //                                                                   CSVHeader
+
+// CSVRecord returns the statistics as CSV fields. Implements StatsRecord.
+func (st TransferStats) CSVRecord() []string {
+	return []string{
+		strconv.Itoa(StatsSchemaVersion),
+		strconv.FormatInt(st.BytesDelivered, 10),
+		strconv.FormatInt(st.BytesLost, 10),
+		strconv.FormatInt(st.PacketsDelivered, 10),
+		strconv.FormatInt(st.PacketsLost, 10),
+		strconv.FormatInt(int64(st.TransferTime), 10),
+		strconv.FormatInt(st.PacketsSent, 10),
+		strconv.FormatInt(st.PacketsResent, 10),
+		strconv.FormatInt(st.BytesSent, 10),
+		strconv.FormatInt(int64(st.AverageRTT), 10),
+		strconv.FormatInt(st.RepliesRejected, 10),
+		strconv.FormatInt(st.ValueBytes, 10),
+		strconv.FormatInt(st.CompressedBytes, 10),
+		strconv.FormatInt(int64(st.ReadTime), 10),
+		strconv.FormatInt(int64(st.CompressTime), 10),
+		strconv.FormatInt(int64(st.EncryptTime), 10),
+		strconv.FormatInt(int64(st.SendTime), 10),
+		strconv.FormatInt(int64(st.AckWaitTime), 10),
+	}
+} //                                                                   CSVRecord
+
+// end
@@ -0,0 +1,108 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /[transfer_stats_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// (st TransferStats) MarshalJSON() ([]byte, error)
+// (st *TransferStats) UnmarshalJSON(data []byte) error
+//
+// go test -run Test_TransferStats_JSON_
+//
+func Test_TransferStats_JSON_(t *testing.T) {
+	st := TransferStats{
+		BytesDelivered:   1000,
+		BytesLost:        20,
+		PacketsDelivered: 10,
+		PacketsLost:      1,
+		TransferTime:     1500 * time.Millisecond,
+		PacketsSent:      12,
+		PacketsResent:    2,
+		BytesSent:        1100,
+		AverageRTT:       3 * time.Millisecond,
+		RepliesRejected:  1,
+		ValueBytes:       4000,
+		CompressedBytes:  1000,
+		ReadTime:         4 * time.Millisecond,
+		CompressTime:     5 * time.Millisecond,
+		EncryptTime:      6 * time.Millisecond,
+		SendTime:         7 * time.Millisecond,
+		AckWaitTime:      8 * time.Millisecond,
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Error("0xE5A37A", err)
+	}
+	want := `{"schema":1,"bytes_delivered":1000,"bytes_lost":20,` +
+		`"packets_delivered":10,"packets_lost":1,` +
+		`"transfer_time_ns":1500000000,"packets_sent":12,` +
+		`"packets_resent":2,"bytes_sent":1100,"average_rtt_ns":3000000,` +
+		`"replies_rejected":1,"value_bytes":4000,"compressed_bytes":1000,` +
+		`"read_time_ns":4000000,"compress_time_ns":5000000,` +
+		`"encrypt_time_ns":6000000,"send_time_ns":7000000,` +
+		`"ack_wait_time_ns":8000000}`
+	if string(data) != want {
+		t.Error("0xE0DDA4", "\nwant:", want, "\n got:", string(data))
+	}
+	var got TransferStats
+	err = json.Unmarshal(data, &got)
+	if got != st || err != nil {
+		t.Error("0xEE4E4E", got, err)
+	}
+	// must refuse an unknown schema version
+	err = json.Unmarshal([]byte(`{"schema":2}`), &got)
+	if !matchError(err, "unsupported stats schema version: 2") {
+		t.Error("0xE33124", "wrong error:", err)
+	}
+}
+
+// (st TransferStats) CSVRecord() []string
+//
+// go test -run Test_TransferStats_CSVRecord_
+//
+func Test_TransferStats_CSVRecord_(t *testing.T) {
+	st := TransferStats{BytesDelivered: 1000, TransferTime: time.Second}
+	got := strings.Join(st.CSVRecord(), ",")
+	if got != "1,1000,0,0,0,1000000000,0,0,0,0,0,0,0,0,0,0,0,0" {
+		t.Error("0xE0F7BE", got)
+	}
+	if len(st.CSVHeader()) != len(st.CSVRecord()) {
+		t.Error("0xE2C488")
+	}
+}
+
+// (st TransferStats) Stages() []PipelineStage
+// (ps PipelineStage) BytesPerSecond() float64
+//
+// go test -run Test_TransferStats_Stages_
+//
+func Test_TransferStats_Stages_(t *testing.T) {
+	st := TransferStats{
+		ValueBytes:     4000,
+		BytesSent:      2000,
+		BytesDelivered: 1000,
+		CompressTime:   2 * time.Second,
+		SendTime:       500 * time.Millisecond,
+		AckWaitTime:    time.Second,
+	}
+	var sb strings.Builder
+	for _, ps := range st.Stages() {
+		sb.WriteString(ps.Name + ":" +
+			strconv.FormatFloat(ps.BytesPerSecond(), 'f', -1, 64) + " ")
+	}
+	want := "read:0 compress:2000 encrypt:0 send:4000 ack-wait:1000 "
+	if sb.String() != want {
+		t.Error("0xE7D2A9", "\nwant:", want, "\n got:", sb.String())
+	}
+}
+
+// end
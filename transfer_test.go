@@ -8,6 +8,7 @@ package udpt
 import (
 	"bytes"
 	"fmt"
+	"net"
 	"strings"
 	"testing"
 	"time"
@@ -42,6 +43,44 @@ func Test_transfer_3(t *testing.T) {
 	testTransfer(itemCount, itemSize, t)
 }
 
+// go test -run Test_transfer_ipv6
+//
+// must transfer data items over IPv6 loopback, to a dual-stack
+// Receiver and to one that only listens on IPv6
+func Test_transfer_ipv6(t *testing.T) {
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skip("IPv6 is not available:", err)
+	}
+	_ = conn.Close()
+	cryptoKey := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	for _, network := range []string{"udp", "udp6"} {
+		received := make(chan string, 1)
+		cf := NewDefaultConfig()
+		cf.Network = network
+		cf.ReplyTimeout = 250 * time.Millisecond
+		rc := Receiver{
+			Port: 9876, CryptoKey: cryptoKey, Config: cf,
+			Receive: func(k string, v []byte) error {
+				received <- k + "=" + string(v)
+				return nil
+			},
+		}
+		go func() { _ = rc.Run() }()
+		time.Sleep(100 * time.Millisecond)
+		//
+		sd := Sender{Address: "[::1]:9876", CryptoKey: cryptoKey, Config: cf}
+		err := sd.SendString("key", network)
+		if err != nil {
+			t.Error("0xE5A2D7", network, err)
+		} else if got := <-received; got != "key="+network {
+			t.Error("0xE90B6E", network, "got:", got)
+		}
+		rc.Stop()
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 // testTransfer runs a transfer test with different packet counts and sizes.
 //
 // This test sends several packets from a Sender to a Receiver.
@@ -0,0 +1,141 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[transform.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"path"
+	"strconv"
+)
+
+// TransformStage is a stage of a Receiver's transformation pipeline (see
+// Receiver.Transforms). It returns the data items into which it turns the
+// item with key 'k' and value 'v': usually one item with the same key,
+// but it may split the item into several, like SplitLines, or drop it
+// by returning none. The Options of the items returned are ignored.
+type TransformStage func(k string, v []byte) ([]Item, error)
+
+// TransformRoute applies Stages, in order, to the data items whose keys
+// match Pattern. Each stage is applied to every item returned by the
+// stage before it.
+type TransformRoute struct {
+
+	// Pattern matches the keys of the data items to transform, in the
+	// syntax of path.Match, e.g. "logs/*.ndjson". A blank Pattern
+	// matches all keys, so it can be a default route.
+	Pattern string
+
+	// Stages are the stages of the pipeline.
+	Stages []TransformStage
+} //                                                              TransformRoute
+
+// DecryptWith returns a TransformStage that decrypts the value of each
+// item with 'cphr', e.g. an envelope encrypted by the application
+// inside the data item, with a key that relays never see.
+func DecryptWith(cphr SymmetricCipher) TransformStage {
+	return func(k string, v []byte) ([]Item, error) {
+		plain, err := cphr.Decrypt(v)
+		if err != nil {
+			return nil, err
+		}
+		return []Item{{Key: k, Value: plain}}, nil
+	}
+} //                                                                 DecryptWith
+
+// Gunzip is a TransformStage that uncompresses values compressed
+// with gzip, e.g. files that were compressed before they were sent.
+func Gunzip(k string, v []byte) ([]Item, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(v))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	return []Item{{Key: k, Value: plain}}, nil
+} //                                                                      Gunzip
+
+// DecodeBase64 is a TransformStage that decodes values in standard
+// base64 encoding, ignoring line breaks and surrounding whitespace.
+func DecodeBase64(k string, v []byte) ([]Item, error) {
+	v = bytes.TrimSpace(v)
+	v = bytes.ReplaceAll(v, []byte("\r"), nil)
+	v = bytes.ReplaceAll(v, []byte("\n"), nil)
+	plain := make([]byte, base64.StdEncoding.DecodedLen(len(v)))
+	n, err := base64.StdEncoding.Decode(plain, v)
+	if err != nil {
+		return nil, err
+	}
+	return []Item{{Key: k, Value: plain[:n]}}, nil
+} //                                                                DecodeBase64
+
+// SplitLines is a TransformStage that splits each value into its lines,
+// e.g. the records of NDJSON (newline-delimited JSON), and returns each
+// line as an item, without its line break. The key of each item is the
+// original key followed by "#" and the line's number, counting from 1,
+// e.g. "events.ndjson#1". Blank lines are skipped but counted.
+func SplitLines(k string, v []byte) ([]Item, error) {
+	var ret []Item
+	for i, ln := range bytes.Split(v, []byte("\n")) {
+		ln = bytes.TrimSuffix(ln, []byte("\r"))
+		if len(bytes.TrimSpace(ln)) == 0 {
+			continue
+		}
+		ret = append(ret, Item{Key: k + "#" + strconv.Itoa(i+1), Value: ln})
+	}
+	return ret, nil
+} //                                                                  SplitLines
+
+// transform passes data item 'k' with value 'v' through the stages of
+// the first of Receiver.Transforms that matches 'k', and returns the
+// resulting items, or just the item itself if no route matches.
+func (rc *Receiver) transform(k string, v []byte) ([]Item, error) {
+	items := []Item{{Key: k, Value: v}}
+	for _, rt := range rc.Transforms {
+		if match, _ := path.Match(rt.Pattern, k); !match && rt.Pattern != "" {
+			continue
+		}
+		for i, stage := range rt.Stages {
+			var next []Item
+			for _, it := range items {
+				out, err := stage(it.Key, it.Value)
+				if err != nil {
+					return nil, makeError(0xE7A2D6, "transform stage", i,
+						"of", it.Key+":", err)
+				}
+				next = append(next, out...)
+			}
+			items = next
+		}
+		break
+	}
+	return items, nil
+} //                                                                   transform
+
+// validateTransforms checks that the Patterns of Receiver.Transforms are
+// valid, and that the Receiver delivers values that can be transformed.
+func (rc *Receiver) validateTransforms() error {
+	if len(rc.Transforms) == 0 {
+		return nil
+	}
+	if rc.ReceiveStream != nil || rc.Archive != nil {
+		return makeError(0xE4C9B1,
+			"Receiver.Transforms requires Receive or Handler")
+	}
+	for i, rt := range rc.Transforms {
+		if _, err := path.Match(rt.Pattern, ""); err != nil {
+			return makeError(0xE2E7F5, "Receiver.Transforms", i,
+				"pattern", rt.Pattern+":", err)
+		}
+	}
+	return nil
+} //                                                          validateTransforms
+
+// end
@@ -0,0 +1,132 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[transform_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_transform_*
+
+// -----------------------------------------------------------------------------
+
+// itemsString returns 'items' as text, for comparing them in tests.
+func itemsString(items []Item) string {
+	var sb strings.Builder
+	for _, it := range items {
+		fmt.Fprintf(&sb, "%s=%s;", it.Key, it.Value)
+	}
+	return sb.String()
+}
+
+// -----------------------------------------------------------------------------
+
+// SplitLines(k string, v []byte) ([]Item, error)
+//
+// go test -run Test_transform_SplitLines_
+//
+func Test_transform_SplitLines_(t *testing.T) {
+	items, err := SplitLines("e.ndjson", []byte("{\"a\":1}\r\n\n{\"b\":2}\n"))
+	got := itemsString(items)
+	want := `e.ndjson#1={"a":1};e.ndjson#3={"b":2};`
+	if err != nil || got != want {
+		t.Error("0xE5F2A9", err, "got:", got, "want:", want)
+	}
+}
+
+// DecodeBase64(k string, v []byte) ([]Item, error)
+// Gunzip(k string, v []byte) ([]Item, error)
+// DecryptWith(cphr SymmetricCipher) TransformStage
+//
+// go test -run Test_transform_stages_
+//
+func Test_transform_stages_(t *testing.T) {
+	items, err := DecodeBase64("k", []byte(" aGVs\nbG8=\r\n"))
+	if got := itemsString(items); err != nil || got != "k=hello;" {
+		t.Error("0xE8C7B3", err, got)
+	}
+	if _, err = DecodeBase64("k", []byte("*")); err == nil {
+		t.Error("0xE3A1F8", "invalid base64 accepted")
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte("unzipped"))
+	_ = zw.Close()
+	items, err = Gunzip("k", buf.Bytes())
+	if got := itemsString(items); err != nil || got != "k=unzipped;" {
+		t.Error("0xE6D9C5", err, got)
+	}
+	cphr := &aesCipher{}
+	_ = cphr.SetKey([]byte("envelope-key-0123456789abcdefghi"))
+	sealed, _ := cphr.Encrypt([]byte("inner"))
+	items, err = DecryptWith(cphr)("k", sealed)
+	if got := itemsString(items); err != nil || got != "k=inner;" {
+		t.Error("0xE1E4D2", err, got)
+	}
+}
+
+// (rc *Receiver) callReceive(info *ItemInfo, v []byte) error
+//
+// go test -run Test_transform_Receiver_Transforms_
+//
+// must pass each item through the stages of the first matching route,
+// and deliver each resulting item separately
+func Test_transform_Receiver_Transforms_(t *testing.T) {
+	var got []string
+	rc := newRunnableReceiver()
+	rc.Config.LogWriter = nil
+	rc.Receive = func(k string, v []byte) error {
+		got = append(got, k+"="+string(v))
+		return nil
+	}
+	rc.Transforms = []TransformRoute{
+		{Pattern: "logs/*.b64", Stages: []TransformStage{
+			DecodeBase64, SplitLines,
+		}},
+		{Pattern: "logs/*", Stages: []TransformStage{
+			func(k string, v []byte) ([]Item, error) {
+				return []Item{{Key: k, Value: bytes.ToUpper(v)}}, nil
+			},
+		}},
+	}
+	if err := rc.validateTransforms(); err != nil {
+		t.Fatal("0xE9B3E7", err)
+	}
+	b64 := base64.StdEncoding.EncodeToString([]byte("one\ntwo\n"))
+	for _, it := range []Item{
+		{Key: "logs/a.b64", Value: []byte(b64)},
+		{Key: "logs/b.txt", Value: []byte("up")},
+		{Key: "other", Value: []byte("as is")},
+	} {
+		if err := rc.callReceive(&ItemInfo{Key: it.Key}, it.Value); err != nil {
+			t.Error("0xE4D8A1", it.Key, err)
+		}
+	}
+	want := "logs/a.b64#1=one|logs/a.b64#2=two|logs/b.txt=UP|other=as is"
+	if s := strings.Join(got, "|"); s != want {
+		t.Error("0xE7F1C6", "got:", s, "want:", want)
+	}
+	if n := rc.Stats().ItemsDelivered; n != 4 {
+		t.Error("0xE2B9D4", "delivered:", n)
+	}
+	// must fail the item if a stage fails
+	err := rc.callReceive(&ItemInfo{Key: "logs/bad.b64"}, []byte("*"))
+	if !matchError(err, "transform stage 0 of logs/bad.b64") {
+		t.Error("0xE5A6F3", "wrong error:", err)
+	}
+	rc.Transforms = []TransformRoute{{Pattern: "[", Stages: nil}}
+	if err := rc.validateTransforms(); err == nil {
+		t.Error("0xE0C3B8", "invalid pattern accepted")
+	}
+}
+
+// end
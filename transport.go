@@ -0,0 +1,129 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /[transport.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"os"
+)
+
+// Transport carries the packets of Senders and Receivers over another
+// protocol than plain UDP, such as DTLS, which is provided by the
+// separate github.com/balacode/udpt/dtls module, for environments that
+// mandate standardized transport security (see Configuration.Transport).
+//
+// Each packet written must be delivered as one datagram, or not at all,
+// and each read must return one datagram. Packets are still encrypted
+// with Configuration.Cipher before they are written.
+//
+type Transport interface {
+
+	// Dial returns a connection from the local address 'laddr', which
+	// is nil unless Sender.LocalPort, Configuration.LocalAddress or
+	// Configuration.Interface is specified, to the Receiver at 'raddr',
+	// on network "udp", "udp4" or "udp6".
+	Dial(network string, laddr, raddr *net.UDPAddr) (net.Conn, error)
+
+	// Listen returns a connection on which a Receiver reads the packets
+	// of Senders at the local address 'laddr', and replies to them.
+	Listen(network string, laddr *net.UDPAddr) (net.PacketConn, error)
+} //                                                                   Transport
+
+// transportConn adapts a net.Conn returned by Transport.Dial()
+// to the netUDPConn used by Senders.
+type transportConn struct {
+	net.Conn
+} //                                                               transportConn
+
+// dialTransport returns a connection to 'raddr' made by 'tr'.
+func dialTransport(tr Transport, network string, laddr, raddr *net.UDPAddr,
+) (netUDPConn, error) {
+	conn, err := tr.Dial(network, laddr, raddr)
+	if err != nil {
+		return nil, err // unwrapped, so bindPort() can retry in-use ports
+	}
+	return transportConn{conn}, nil
+} //                                                               dialTransport
+
+// ReadFrom reads a datagram like Read(), from the remote address.
+func (tc transportConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := tc.Read(b)
+	return n, tc.RemoteAddr(), transportError(err)
+} //                                                                    ReadFrom
+
+// WriteTo writes a datagram like Write(), since
+// the connection only has one remote address.
+func (tc transportConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return tc.Write(b)
+} //                                                                     WriteTo
+
+// SetWriteBuffer sets the size of the transmit buffer, if
+// the underlying connection supports it, otherwise does nothing.
+func (tc transportConn) SetWriteBuffer(bytes int) error {
+	return setWriteBuffer(tc.Conn, bytes)
+} //                                                              SetWriteBuffer
+
+// transportPacketConn adapts a net.PacketConn returned by
+// Transport.Listen() to the netUDPConn used by Receivers.
+type transportPacketConn struct {
+	net.PacketConn
+} //                                                         transportPacketConn
+
+// listenTransport returns a connection at 'laddr' made by 'tr'.
+func listenTransport(tr Transport, network string, laddr *net.UDPAddr,
+) (netUDPConn, error) {
+	conn, err := tr.Listen(network, laddr)
+	if err != nil {
+		return nil, err // unwrapped, so bindPort() can retry in-use ports
+	}
+	return transportPacketConn{conn}, nil
+} //                                                             listenTransport
+
+// ReadFrom reads a datagram like net.PacketConn.ReadFrom().
+func (tc transportPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := tc.PacketConn.ReadFrom(b)
+	return n, addr, transportError(err)
+} //                                                                    ReadFrom
+
+// Write always fails: a Receiver's connection has no
+// single remote address, so replies use WriteTo().
+func (tc transportPacketConn) Write(p []byte) (int, error) {
+	return 0, makeError(0xE4E1B7, "Write on a Transport listener")
+} //                                                                       Write
+
+// SetWriteBuffer sets the size of the transmit buffer, if
+// the underlying connection supports it, otherwise does nothing.
+func (tc transportPacketConn) SetWriteBuffer(bytes int) error {
+	return setWriteBuffer(tc.PacketConn, bytes)
+} //                                                              SetWriteBuffer
+
+// setWriteBuffer calls SetWriteBuffer on 'conn' if it has that method.
+func setWriteBuffer(conn interface{}, bytes int) error {
+	if wb, ok := conn.(interface{ SetWriteBuffer(int) error }); ok {
+		return wb.SetWriteBuffer(bytes)
+	}
+	return nil
+} //                                                              setWriteBuffer
+
+// transportError returns os.ErrDeadlineExceeded for any timeout error
+// of a Transport's connection, so that netError() recognizes it as
+// errTimeout, whatever its message. Returns other errors as they are.
+func transportError(err error) error {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return os.ErrDeadlineExceeded
+	}
+	return err
+} //                                                              transportError
+
+// localAddr returns the local address of 'conn', or nil if it has none.
+func localAddr(conn netUDPConn) net.Addr {
+	if la, ok := conn.(interface{ LocalAddr() net.Addr }); ok {
+		return la.LocalAddr()
+	}
+	return nil
+} //                                                                   localAddr
+
+// end
@@ -0,0 +1,74 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /[transport_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTransport is a Transport over plain UDP
+// that counts the connections it makes.
+type countingTransport struct {
+	dials, listens int32
+}
+
+func (ct *countingTransport) Dial(network string, laddr, raddr *net.UDPAddr,
+) (net.Conn, error) {
+	atomic.AddInt32(&ct.dials, 1)
+	return net.DialUDP(network, laddr, raddr)
+}
+
+func (ct *countingTransport) Listen(network string, laddr *net.UDPAddr,
+) (net.PacketConn, error) {
+	atomic.AddInt32(&ct.listens, 1)
+	return net.ListenUDP(network, laddr)
+}
+
+// -----------------------------------------------------------------------------
+// Configuration.Transport
+//
+// go test -run Test_Configuration_Transport_
+
+// must carry the packets of the Sender and Receiver
+// over the connections made by the Transport
+func Test_Configuration_Transport_(t *testing.T) {
+	tr := &countingTransport{}
+	received := make(chan string, 1)
+	rc := newRunnableReceiver()
+	rc.Port = 9871
+	rc.Config.Transport = tr
+	rc.Receive = func(k string, v []byte) error {
+		received <- k + "=" + string(v)
+		return nil
+	}
+	go func() { _ = rc.Run() }()
+	defer rc.Stop()
+	time.Sleep(100 * time.Millisecond)
+	//
+	cf := NewDefaultConfig()
+	cf.Transport = tr
+	sd := Sender{Address: "127.0.0.1:9871", CryptoKey: rc.CryptoKey,
+		Config: cf}
+	if err := sd.Send("key", []byte("value")); err != nil {
+		t.Fatal("0xE3F9C1", err)
+	}
+	select {
+	case got := <-received:
+		if got != "key=value" {
+			t.Error("0xE6A4D8", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("0xE0C8B5", "item not received")
+	}
+	if atomic.LoadInt32(&tr.dials) < 1 || atomic.LoadInt32(&tr.listens) != 1 {
+		t.Error("0xE9E2A7", tr.dials, tr.listens)
+	}
+}
+
+// end
@@ -0,0 +1,16 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /[udp_sockets_other.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build !js && !wasip1
+
+package udpt
+
+// noUDPSockets returns nil, since UDP sockets
+// can be opened on this platform.
+func noUDPSockets() error {
+	return nil
+} //                                                                noUDPSockets
+
+// end
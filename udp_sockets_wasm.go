@@ -0,0 +1,22 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[udp_sockets_wasm.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build js || wasip1
+
+package udpt
+
+import (
+	"runtime"
+)
+
+// noUDPSockets returns an error, since programs compiled for GOOS=js or
+// wasip1 can't open UDP sockets: Senders must send through a Transport,
+// such as a ChannelTransport, or a supplied Sender.PacketConn.
+func noUDPSockets() error {
+	return makeError(0xE4A8C5, "can't open UDP sockets on", runtime.GOOS+
+		": specify Config.Transport or Sender.PacketConn")
+} //                                                                noUDPSockets
+
+// end
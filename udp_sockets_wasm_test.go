@@ -0,0 +1,30 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                          /[udp_sockets_wasm_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build js || wasip1
+
+package udpt
+
+import (
+	"testing"
+)
+
+// (sd *Sender) connect() (netUDPConn, error)
+//
+// go test -run Test_udp_sockets_connect_
+//
+// must tell how to send where UDP sockets can't be opened
+func Test_udp_sockets_connect_(t *testing.T) {
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	sd := Sender{Address: "127.0.0.1:9876",
+		CryptoKey: []byte("0123456789abcdefghijklmnopqrst12"), Config: cf}
+	_, err := sd.connect()
+	if !matchError(err, "specify Config.Transport or Sender.PacketConn") {
+		t.Error("0xE4C1A6", "wrong error:", err)
+	}
+}
+
+// end
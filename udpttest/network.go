@@ -0,0 +1,281 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /udpttest/[network.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// Package udpttest provides utilities for testing udpt: Network, an
+// in-memory network that loses datagrams, and Soak, a harness that
+// runs randomized transfers over it for as long as required, checking
+// invariants, to certify releases for always-on deployments.
+//
+package udpttest
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/balacode/udpt"
+)
+
+// firstEphemeralPort is the first port that
+// Network assigns to connections made by Dial().
+const firstEphemeralPort = 49152
+
+// inboxSize is the number of datagrams each connection of a Network
+// buffers before further datagrams are dropped, like a socket buffer.
+const inboxSize = 1024
+
+// Network is an in-memory network that implements udpt.Transport. Assign
+// it to Configuration.Transport at both ends, with LoopbackShortcut
+// disabled, to transfer data items without sockets, losing datagrams
+// at random. Connections are identified by port only: the host in
+// Sender.Address is ignored.
+//
+// The zero value is a network that delivers every datagram.
+// A Network must not be copied after it has been used.
+//
+type Network struct {
+
+	// LossRate is the fraction of datagrams lost, from 0 to 1.
+	LossRate float64
+
+	// Seed seeds the random loss of datagrams. Zero means 1.
+	Seed int64
+
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	conns    map[int]*conn // by port
+	nextPort int
+	sent     int64
+	dropped  int64
+} //                                                                     Network
+
+var _ udpt.Transport = (*Network)(nil)
+
+// Dial implements udpt.Transport.Dial(), and returns a connection
+// to port raddr.Port from port laddr.Port, or from a free port
+// if 'laddr' is nil.
+func (nw *Network) Dial(network string, laddr, raddr *net.UDPAddr,
+) (net.Conn, error) {
+	port := 0
+	if laddr != nil {
+		port = laddr.Port
+	}
+	return nw.open(port, raddr)
+} //                                                                        Dial
+
+// Listen implements udpt.Transport.Listen(), and returns
+// a connection that receives the datagrams sent to laddr.Port.
+func (nw *Network) Listen(network string, laddr *net.UDPAddr,
+) (net.PacketConn, error) {
+	return nw.open(laddr.Port, nil)
+} //                                                                      Listen
+
+// Stats returns the number of datagrams sent on the
+// network so far, and how many of them were lost.
+func (nw *Network) Stats() (sent, dropped int64) {
+	return atomic.LoadInt64(&nw.sent), atomic.LoadInt64(&nw.dropped)
+} //                                                                       Stats
+
+// OpenConns returns the number of connections not closed yet.
+func (nw *Network) OpenConns() int {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return len(nw.conns)
+} //                                                                   OpenConns
+
+// open returns a new connection at 'port', or at a free port if 'port'
+// is zero, which sends to 'raddr'. Fails with syscall.EADDRINUSE if
+// 'port' is in use.
+func (nw *Network) open(port int, raddr *net.UDPAddr) (*conn, error) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	if nw.conns == nil {
+		nw.conns = make(map[int]*conn)
+		nw.nextPort = firstEphemeralPort
+	}
+	if port == 0 {
+		for nw.conns[nw.nextPort] != nil {
+			nw.nextPort++
+			if nw.nextPort > 65535 {
+				nw.nextPort = firstEphemeralPort
+			}
+		}
+		port = nw.nextPort
+	}
+	if nw.conns[port] != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udp",
+			Err: os.NewSyscallError("bind", syscall.EADDRINUSE)}
+	}
+	cn := &conn{
+		nw:     nw,
+		laddr:  &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port},
+		raddr:  raddr,
+		inbox:  make(chan datagram, inboxSize),
+		closed: make(chan struct{}),
+	}
+	nw.conns[port] = cn
+	return cn, nil
+} //                                                                        open
+
+// deliver passes a copy of 'data' from 'from' to the connection at
+// 'to', unless it is lost, there is no connection at 'to', or the
+// connection's inbox is full.
+func (nw *Network) deliver(from, to *net.UDPAddr, data []byte) {
+	atomic.AddInt64(&nw.sent, 1)
+	nw.mu.Lock()
+	if nw.rnd == nil {
+		seed := nw.Seed
+		if seed == 0 {
+			seed = 1
+		}
+		nw.rnd = rand.New(rand.NewSource(seed))
+	}
+	lost := nw.LossRate > 0 && nw.rnd.Float64() < nw.LossRate
+	dst := nw.conns[to.Port]
+	nw.mu.Unlock()
+	if lost || dst == nil {
+		atomic.AddInt64(&nw.dropped, 1)
+		return
+	}
+	dg := datagram{data: append([]byte(nil), data...), addr: from}
+	select {
+	case dst.inbox <- dg:
+	default:
+		atomic.AddInt64(&nw.dropped, 1)
+	}
+} //                                                                     deliver
+
+// -----------------------------------------------------------------------------
+
+// datagram is a datagram waiting in the inbox of a connection.
+type datagram struct {
+	data []byte
+	addr net.Addr
+} //                                                                    datagram
+
+// conn is a connection of a Network. It implements both net.Conn,
+// for Senders, and net.PacketConn, for Receivers.
+type conn struct {
+	nw       *Network
+	laddr    *net.UDPAddr
+	raddr    *net.UDPAddr // nil for Receivers
+	inbox    chan datagram
+	mu       sync.Mutex
+	deadline time.Time
+	closed   chan struct{}
+	once     sync.Once
+} //                                                                        conn
+
+// Read implements net.Conn.Read().
+func (cn *conn) Read(b []byte) (int, error) {
+	n, _, err := cn.ReadFrom(b)
+	return n, err
+} //                                                                        Read
+
+// ReadFrom implements net.PacketConn.ReadFrom(). Datagrams longer than
+// 'b' are truncated. It returns os.ErrDeadlineExceeded when the read
+// deadline passes, and net.ErrClosed once the connection is closed.
+func (cn *conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	cn.mu.Lock()
+	deadline := cn.deadline
+	cn.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-cn.closed:
+		return 0, nil, net.ErrClosed
+	default:
+	}
+	select {
+	case dg := <-cn.inbox:
+		return copy(b, dg.data), dg.addr, nil
+	case <-cn.closed:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+} //                                                                    ReadFrom
+
+// Write implements net.Conn.Write(), sending
+// 'b' to the remote address given to Dial().
+func (cn *conn) Write(b []byte) (int, error) {
+	if cn.raddr == nil {
+		return 0, fmt.Errorf("udpttest: Write on a listening connection")
+	}
+	return cn.WriteTo(b, cn.raddr)
+} //                                                                       Write
+
+// WriteTo implements net.PacketConn.WriteTo().
+func (cn *conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-cn.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	to, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("udpttest: not a UDP address: %v", addr)
+	}
+	cn.nw.deliver(cn.laddr, to, b)
+	return len(b), nil
+} //                                                                     WriteTo
+
+// Close implements net.Conn.Close(), freeing the connection's port.
+func (cn *conn) Close() error {
+	cn.once.Do(func() {
+		close(cn.closed)
+		cn.nw.mu.Lock()
+		if cn.nw.conns[cn.laddr.Port] == cn {
+			delete(cn.nw.conns, cn.laddr.Port)
+		}
+		cn.nw.mu.Unlock()
+	})
+	return nil
+} //                                                                       Close
+
+// LocalAddr implements net.Conn.LocalAddr().
+func (cn *conn) LocalAddr() net.Addr {
+	return cn.laddr
+} //                                                                   LocalAddr
+
+// RemoteAddr implements net.Conn.RemoteAddr().
+func (cn *conn) RemoteAddr() net.Addr {
+	if cn.raddr == nil {
+		return nil // not a nil *net.UDPAddr in a non-nil interface
+	}
+	return cn.raddr
+} //                                                                  RemoteAddr
+
+// SetDeadline implements net.Conn.SetDeadline().
+// Only the read deadline is used, since writes don't block.
+func (cn *conn) SetDeadline(t time.Time) error {
+	return cn.SetReadDeadline(t)
+} //                                                                 SetDeadline
+
+// SetReadDeadline implements net.Conn.SetReadDeadline().
+// It applies to the reads started after it.
+func (cn *conn) SetReadDeadline(t time.Time) error {
+	cn.mu.Lock()
+	cn.deadline = t
+	cn.mu.Unlock()
+	return nil
+} //                                                             SetReadDeadline
+
+// SetWriteDeadline implements net.Conn.SetWriteDeadline().
+// It does nothing, since writes don't block.
+func (cn *conn) SetWriteDeadline(t time.Time) error {
+	return nil
+} //                                                            SetWriteDeadline
+
+// end
@@ -0,0 +1,13 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                            /udpttest/[norace_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+//go:build !race
+
+package udpttest
+
+// raceEnabled is true when the tests are built with -race
+const raceEnabled = false
+
+// end
@@ -0,0 +1,344 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /udpttest/[soak.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpttest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/balacode/udpt"
+)
+
+// soakPort is the port of the Receiver on the Soak's Network.
+const soakPort = 9000
+
+// Soak runs randomized transfers from several Senders to a Receiver
+// over a lossy in-memory Network for Duration, then checks that:
+//
+//   - every data item delivered was sent, exactly once, with the
+//     hash of the value sent, and every item sent without error
+//     was delivered;
+//   - the Receiver's statistics count the items and bytes delivered,
+//     and the Senders' and Receiver's statistics agree with the
+//     Network's count of datagrams;
+//   - once the Senders and Receiver have stopped, no connections
+//     are left open, and the number of goroutines is back to what
+//     it was before, so nothing leaks over a long run.
+//
+// Run it for hours, e.g. from a test with a command-line flag, to
+// certify a release for always-on deployments. See SoakReport.
+//
+type Soak struct {
+
+	// Duration is how long to keep starting transfers.
+	// Zero means 10 seconds.
+	Duration time.Duration
+
+	// Config, if specified, is the configuration used by the Senders
+	// and the Receiver. Its Transport and LoopbackShortcut are replaced.
+	// Nil means NewProfileConfig(ProfileLANFast), with no interval
+	// between packets and short timeouts.
+	Config *udpt.Configuration
+
+	// LossRate is the fraction of datagrams lost by the Network.
+	LossRate float64
+
+	// Senders is the number of Senders sending at once. Zero means 4.
+	Senders int
+
+	// MaxValueSize is the largest size of the random values sent.
+	// Zero means 64 KiB.
+	MaxValueSize int
+
+	// Seed seeds the sizes and contents of the values,
+	// and the Network's loss. Zero means 1.
+	Seed int64
+
+	// Logf, if specified, is called with a progress report every
+	// 10 seconds, e.g. testing.T.Logf.
+	Logf func(format string, a ...interface{})
+} //                                                                        Soak
+
+// SoakReport is the outcome of Soak.Run().
+type SoakReport struct {
+	Items          int64         // data items sent without error
+	Failed         int64         // data items whose Send() failed
+	Delivered      int64         // data items delivered to the Receiver
+	Bytes          int64         // bytes in the values delivered
+	Datagrams      int64         // datagrams sent on the Network
+	DatagramsLost  int64         // datagrams the Network lost
+	GoroutinesLeft int           // goroutines more than before Run()
+	Elapsed        time.Duration // time the run took
+	Violations     []string      // invariants that didn't hold
+} //                                                                  SoakReport
+
+// soakItem is a data item sent by a Soak.
+type soakItem struct {
+	hash      [32]byte
+	sent      bool // Send() returned nil
+	delivered int  // number of times the Receiver got it
+} //                                                                    soakItem
+
+// Run runs the soak test until Duration has passed or 'ctx' is done,
+// whichever is first. Returns the report, and an error listing the
+// invariants that didn't hold, or nil if all held. Returns a nil
+// report if the Receiver can't start.
+func (sk *Soak) Run(ctx context.Context) (*SoakReport, error) {
+	t0 := time.Now()
+	goroutines := runtime.NumGoroutine()
+	cf, err := sk.config()
+	if err != nil {
+		return nil, err
+	}
+	seed := sk.Seed
+	if seed == 0 {
+		seed = 1
+	}
+	nw := &Network{LossRate: sk.LossRate, Seed: seed}
+	cf.Transport = nw
+	cf.LoopbackShortcut = false
+	cryptoKey := make([]byte, 32)
+	_, _ = rand.Read(cryptoKey)
+	//
+	var (
+		mu    sync.Mutex
+		items = make(map[string]*soakItem)
+		rep   = &SoakReport{}
+	)
+	violate := func(format string, a ...interface{}) {
+		mu.Lock()
+		rep.Violations = append(rep.Violations, fmt.Sprintf(format, a...))
+		mu.Unlock()
+	}
+	rc := &udpt.Receiver{Port: soakPort, CryptoKey: cryptoKey, Config: cf,
+		Receive: func(k string, v []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			it := items[k]
+			switch {
+			case it == nil:
+				rep.Violations = append(rep.Violations,
+					"delivered an item never sent: "+k)
+			case sha256.Sum256(v) != it.hash:
+				rep.Violations = append(rep.Violations,
+					"delivered a wrong value: "+k)
+			default:
+				it.delivered++
+				rep.Delivered++
+				rep.Bytes += int64(len(v))
+			}
+			return nil
+		}}
+	runErr := make(chan error, 1)
+	go func() { runErr <- rc.Run() }()
+	if err := waitForReceiver(nw, runErr); err != nil {
+		return nil, err
+	}
+	//
+	duration := sk.Duration
+	if duration <= 0 {
+		duration = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	senders := sk.Senders
+	if senders <= 0 {
+		senders = 4
+	}
+	var (
+		wg         sync.WaitGroup
+		senderMu   sync.Mutex
+		senderSent int64
+	)
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rnd := mrand.New(mrand.NewSource(seed + int64(i)))
+			sd := &udpt.Sender{Address: "127.0.0.1:" + strconv.Itoa(soakPort),
+				CryptoKey: cryptoKey, Config: cf}
+			for n := 0; ctx.Err() == nil; n++ {
+				k := "soak/" + strconv.Itoa(i) + "/" + strconv.Itoa(n)
+				v := sk.randomValue(rnd)
+				mu.Lock()
+				items[k] = &soakItem{hash: sha256.Sum256(v)}
+				mu.Unlock()
+				err := sd.Send(k, v)
+				mu.Lock()
+				if err == nil {
+					items[k].sent = true
+					rep.Items++
+				} else {
+					rep.Failed++
+				}
+				mu.Unlock()
+			}
+			st := sd.TotalStats()
+			if st.PacketsResent > st.PacketsSent {
+				violate("sender %d: inconsistent stats: %+v", i, st)
+			}
+			senderMu.Lock()
+			senderSent += st.PacketsSent
+			senderMu.Unlock()
+		}(i)
+	}
+	stopProgress := sk.reportProgress(ctx, nw, t0, &mu, rep)
+	wg.Wait()
+	stopProgress()
+	time.Sleep(100 * time.Millisecond) // let the last packets arrive
+	rc.Stop()
+	if err := <-runErr; err != nil {
+		violate("Receiver.Run: %v", err)
+	}
+	//
+	// check the invariants
+	rs := rc.Stats()
+	rep.Datagrams, rep.DatagramsLost = nw.Stats()
+	mu.Lock()
+	for k, it := range items {
+		if it.delivered > 1 {
+			rep.Violations = append(rep.Violations,
+				fmt.Sprintf("delivered %d times: %s", it.delivered, k))
+		}
+		if it.sent && it.delivered == 0 {
+			rep.Violations = append(rep.Violations, "sent but lost: "+k)
+		}
+	}
+	if rs.ItemsDelivered != rep.Delivered ||
+		rs.BytesDelivered != rep.Bytes {
+		rep.Violations = append(rep.Violations, fmt.Sprintf(
+			"Receiver stats: %d items, %d bytes; delivered: %d, %d",
+			rs.ItemsDelivered, rs.BytesDelivered, rep.Delivered, rep.Bytes))
+	}
+	if senderSent+rs.PacketsReceived > rep.Datagrams {
+		rep.Violations = append(rep.Violations, fmt.Sprintf(
+			"%d packets sent and %d received, but %d datagrams",
+			senderSent, rs.PacketsReceived, rep.Datagrams))
+	}
+	mu.Unlock()
+	if n := nw.OpenConns(); n != 0 {
+		violate("%d connections left open", n)
+	}
+	if n := waitForGoroutines(goroutines, 5*time.Second); n > 0 {
+		rep.GoroutinesLeft = n
+		violate("%d goroutines leaked", n)
+	}
+	rep.Elapsed = time.Since(t0)
+	if len(rep.Violations) > 0 {
+		return rep, errors.New("soak: " + strconv.Itoa(len(rep.Violations)) +
+			" violations, first: " + rep.Violations[0])
+	}
+	return rep, nil
+} //                                                                         Run
+
+// config returns a copy of Config, or the default
+// configuration of a Soak, after validating it.
+func (sk *Soak) config() (*udpt.Configuration, error) {
+	var cf *udpt.Configuration
+	if sk.Config != nil {
+		dup := *sk.Config
+		cf = &dup
+	} else {
+		var err error
+		cf, err = udpt.NewProfileConfig(udpt.ProfileLANFast)
+		if err != nil {
+			return nil, err
+		}
+		cf.SendPacketInterval = 0
+		cf.SendRetryInterval = 10 * time.Millisecond
+		cf.ReplyTimeout = 200 * time.Millisecond
+		cf.NackDelay = 20 * time.Millisecond
+		cf.SendRetries = 50
+	}
+	return cf, cf.Validate()
+} //                                                                      config
+
+// reportProgress calls Logf, if specified, every 10 seconds until 'ctx'
+// is done. Returns a function that waits for it to stop reporting.
+func (sk *Soak) reportProgress(ctx context.Context, nw *Network,
+	t0 time.Time, mu *sync.Mutex, rep *SoakReport,
+) (wait func()) {
+	if sk.Logf == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			sent, lost := nw.Stats()
+			mu.Lock()
+			items, failed, delivered := rep.Items, rep.Failed, rep.Delivered
+			mu.Unlock()
+			sk.Logf("soak: %v: %d items sent, %d failed, %d delivered;"+
+				" %d datagrams, %d lost",
+				time.Since(t0).Round(time.Second), items, failed, delivered,
+				sent, lost)
+		}
+	}()
+	return func() { <-done }
+} //                                                              reportProgress
+
+// randomValue returns a value of random size and contents, half of
+// which repeats a random pattern, so that it can be compressed.
+func (sk *Soak) randomValue(rnd *mrand.Rand) []byte {
+	limit := sk.MaxValueSize
+	if limit <= 0 {
+		limit = 64 * 1024
+	}
+	ret := make([]byte, 1+rnd.Intn(limit))
+	_, _ = rnd.Read(ret[:len(ret)/2])
+	for i := len(ret) / 2; i < len(ret); i++ {
+		ret[i] = ret[i%16]
+	}
+	return ret
+} //                                                                 randomValue
+
+// waitForReceiver waits until the Receiver listens on 'nw',
+// or returns the error with which it failed to start.
+func waitForReceiver(nw *Network, runErr chan error) error {
+	for i := 0; i < 500; i++ {
+		select {
+		case err := <-runErr:
+			return fmt.Errorf("soak: Receiver.Run: %w", err)
+		default:
+		}
+		if nw.OpenConns() > 0 {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return errors.New("soak: Receiver didn't start")
+} //                                                             waitForReceiver
+
+// waitForGoroutines waits up to 'timeout' for the number of goroutines
+// to drop to 'want', and returns how many more than 'want' are left.
+func waitForGoroutines(want int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		n := runtime.NumGoroutine() - want
+		if n <= 0 || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+} //                                                           waitForGoroutines
+
+// end
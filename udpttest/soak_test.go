@@ -0,0 +1,132 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                              /udpttest/[soak_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpttest
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// soakDuration is how long Test_Soak_Run_ runs, e.g. to certify a
+// release: go test ./udpttest -run Test_Soak_Run_ -soak 4h -timeout 5h
+var soakDuration = flag.Duration("soak", 2*time.Second,
+	"duration of the soak test")
+
+// (nw *Network) Dial(network string, laddr, raddr *net.UDPAddr,
+// ) (net.Conn, error)
+//
+// (nw *Network) Listen(network string, laddr *net.UDPAddr,
+// ) (net.PacketConn, error)
+//
+// go test -run Test_Network_
+//
+// must deliver datagrams between connections, lose them at the
+// given rate, refuse ports in use and honor read deadlines
+func Test_Network_(t *testing.T) {
+	nw := &Network{}
+	ln, err := nw.Listen("udp", &net.UDPAddr{Port: 9000})
+	if err != nil {
+		t.Fatal("0xE7C2A1", err)
+	}
+	_, err = nw.Listen("udp", &net.UDPAddr{Port: 9000})
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Error("0xE3D9B1", "wrong error:", err)
+	}
+	cn, err := nw.Dial("udp", nil, &net.UDPAddr{Port: 9000})
+	if err != nil {
+		t.Fatal("0xE5A1F8", err)
+	}
+	if _, err = cn.Write([]byte("ping")); err != nil {
+		t.Fatal("0xE9B6C2", err)
+	}
+	buf := make([]byte, 16)
+	n, addr, err := ln.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "ping" ||
+		addr.String() != cn.LocalAddr().String() {
+		t.Error("0xE2F4D7", err, string(buf[:n]), addr)
+	}
+	_ = ln.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, _, err = ln.ReadFrom(buf)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Error("0xE6A8E3", "wrong error:", err)
+	}
+	_ = cn.Close()
+	_ = ln.Close()
+	_, _, err = ln.ReadFrom(buf)
+	if !errors.Is(err, net.ErrClosed) || nw.OpenConns() != 0 {
+		t.Error("0xE4C5B9", err, nw.OpenConns())
+	}
+	// must lose about a quarter of the datagrams
+	lossy := &Network{LossRate: 0.25}
+	for i := 0; i < 1000; i++ {
+		lossy.deliver(nil, &net.UDPAddr{Port: 1}, nil)
+	}
+	if sent, lost := lossy.Stats(); sent != 1000 || lost != 1000 {
+		t.Error("0xE8D3A2", sent, lost) // no connection at port 1
+	}
+	ln, _ = lossy.Listen("udp", &net.UDPAddr{Port: 1})
+	defer ln.Close()
+	for i := 0; i < 1000; i++ {
+		lossy.deliver(nil, &net.UDPAddr{Port: 1}, nil)
+	}
+	if _, lost := lossy.Stats(); lost < 1000+150 || lost > 1000+350 {
+		t.Error("0xE1E7C5", "lost", lost-1000, "of 1000")
+	}
+}
+
+// (sk *Soak) Run(ctx context.Context) (*SoakReport, error)
+//
+// go test -run Test_Soak_Run_
+//
+// must transfer data items over a lossy Network without
+// violating any invariant or leaking goroutines
+func Test_Soak_Run_(t *testing.T) {
+	sk := &Soak{Duration: *soakDuration, LossRate: 0.05, Logf: t.Logf}
+	rep, err := sk.Run(context.Background())
+	if err != nil {
+		t.Fatal("0xE5B2D8", err)
+	}
+	if rep.Items == 0 || rep.Delivered < rep.Items ||
+		rep.DatagramsLost == 0 || rep.GoroutinesLeft > 0 {
+		t.Error("0xE0F9A7", "wrong report:", *rep)
+	}
+	t.Logf("%+v", *rep)
+}
+
+// go test -run Test_Soak_Run_race_
+//
+// must pass Test_Soak_Run_ with the race detector, since the Receiver
+// and Senders of a Soak share one Configuration (and its cipher)
+func Test_Soak_Run_race_(t *testing.T) {
+	if raceEnabled {
+		t.Skip("Test_Soak_Run_ is already running with -race")
+	}
+	if testing.Short() {
+		t.Skip("skipped in -short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found:", err)
+	}
+	out, err := exec.Command(gobin, "test", "-race", "-count=1",
+		"-run", "^Test_Soak_Run_$", ".").CombinedOutput()
+	if err != nil && strings.Contains(string(out), "-race requires cgo") {
+		t.Skip("the race detector is not available:", string(out))
+	}
+	if err != nil {
+		t.Error("0xE6C1D9", err, string(out))
+	}
+}
+
+// end
@@ -0,0 +1,182 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                /[verified_blocks.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Verified blocks (see Configuration.VerifiedBlockSize) let a Receiver
+// with ReceiveStream check each block of a data item as soon as all of
+// its bytes have arrived, instead of only once the whole item has.
+//
+// The compressed value is divided into blocks of VerifiedBlockSize
+// bytes, and the blocks are hashed from last to first: the hash of each
+// block covers its bytes followed by the hash of the next block, so the
+// hash of the first block (the root) covers the whole value. This is a
+// Merkle tree in which each node has one block and one subtree.
+//
+// Each fragment header carries the root, the block size, and the hash
+// of the block that follows the block in which the fragment's piece
+// ends, in the fields "vroot:<hex> vblock:<size> vnext:<index>/<hex>".
+// Since pieces are never longer than a block, the piece that starts a
+// block always ends in it, so the hash of the next block is known once
+// a block is complete. The last block has no next block, so its
+// "vnext" hash is blank.
+
+// verifiedFieldsSize is the number of bytes the verified block fields
+// add to each fragment header, when Config.VerifiedBlockSize is set.
+const verifiedFieldsSize = len("vroot: vblock: vnext:/ ") + 64 + 10 + 10 + 64
+
+// blockChain returns the hashes of the blocks of 'comp' of 'size' bytes
+// each, first to last. Each block's hash covers the block's bytes and
+// the hash of the next block.
+func (cf *Configuration) blockChain(comp []byte, size int) [][]byte {
+	n := (len(comp) + size - 1) / size
+	ret := make([][]byte, n)
+	var next []byte
+	for i := n - 1; i >= 0; i-- {
+		a, b := i*size, (i+1)*size
+		if b > len(comp) {
+			b = len(comp)
+		}
+		ret[i] = blockHash(cf.hasher(), comp[a:b], next)
+		next = ret[i]
+	}
+	return ret
+} //                                                                  blockChain
+
+// blockHash returns the hash of 'block' followed by
+// 'next', the hash of the next block, made by 'hasher'.
+func blockHash(hasher Hasher, block, next []byte) []byte {
+	hs := newHash(hasher)
+	hs.Write(block)
+	hs.Write(next)
+	return hs.Sum(nil)
+} //                                                                   blockHash
+
+// makeBlockFields returns the fragment header fields for the piece that
+// ends at offset 'end' of the compressed value, whose blocks of 'size'
+// bytes have the hashes in 'chain', or "" if 'chain' is nil.
+func makeBlockFields(chain [][]byte, size, end int) string {
+	if chain == nil {
+		return ""
+	}
+	i := (end - 1) / size
+	next := ""
+	if i+1 < len(chain) {
+		next = fmt.Sprintf("%X", chain[i+1])
+	}
+	return fmt.Sprintf("vroot:%X vblock:%d vnext:%d/%s ",
+		chain[0], size, i, next)
+} //                                                             makeBlockFields
+
+// readBlockFields reads the verified block fields of fragment header
+// 's' into 'h', if there are any.
+func readBlockFields(s string, h *fragmentHeader) error {
+	root := getPart(s, " vroot:", " ")
+	if root == "" {
+		return nil
+	}
+	var err error
+	h.vroot, err = hex.DecodeString(root)
+	if err != nil || len(h.vroot) != 32 {
+		return makeError(0xE1D9B4, "bad 'vroot'")
+	}
+	h.vblock, _ = strconv.Atoi(getPart(s, " vblock:", " "))
+	if h.vblock < 1 {
+		return makeError(0xE6A2C7, "bad 'vblock'")
+	}
+	index, next, _ := strings.Cut(getPart(s, " vnext:", " "), "/")
+	h.vindex, err = strconv.Atoi(index)
+	if err != nil || h.vindex < 0 {
+		return makeError(0xE3E5D1, "bad 'vnext'")
+	}
+	h.vnext, err = hex.DecodeString(next)
+	if err != nil || (len(h.vnext) != 0 && len(h.vnext) != 32) {
+		return makeError(0xE8B4F6, "bad 'vnext'")
+	}
+	return nil
+} //                                                             readBlockFields
+
+// -----------------------------------------------------------------------------
+
+// blockVerifier holds back the compressed bytes of a data item being
+// streamed until the block they belong to has been verified.
+type blockVerifier struct {
+	hasher Hasher
+	root   []byte
+	size   int
+	index  int            // index of the block being filled
+	want   []byte         // expected hash of the block being filled
+	next   map[int][]byte // hash of the block after each block
+	buf    []byte         // bytes of the block being filled
+} //                                                               blockVerifier
+
+// newBlockVerifier returns a blockVerifier for
+// the data item described by fragment header 'h'.
+func newBlockVerifier(h *fragmentHeader, hasher Hasher) *blockVerifier {
+	return &blockVerifier{
+		hasher: hasher,
+		root:   h.vroot,
+		size:   h.vblock,
+		want:   h.vroot,
+		next:   make(map[int][]byte),
+	}
+} //                                                            newBlockVerifier
+
+// learn records the hash of the next block carried by fragment
+// header 'h'. Fails if 'h' describes the blocks differently.
+func (bv *blockVerifier) learn(h *fragmentHeader) error {
+	if !bytes.Equal(h.vroot, bv.root) || h.vblock != bv.size {
+		return makeError(0xE5F7A2, "verified blocks changed")
+	}
+	if old, ok := bv.next[h.vindex]; ok && !bytes.Equal(old, h.vnext) {
+		return makeError(0xE2C3E9, "hash of block", h.vindex+2, "changed")
+	}
+	bv.next[h.vindex] = h.vnext
+	return nil
+} //                                                                       learn
+
+// add appends 'data' to the block being filled, and passes each block
+// that is full, or the last block if 'last' is true, to 'release' once
+// it has been verified. Returns an error if a block doesn't match its
+// hash, in which case no further blocks are released.
+func (bv *blockVerifier) add(data []byte, last bool,
+	release func(block []byte) error,
+) error {
+	bv.buf = append(bv.buf, data...)
+	for len(bv.buf) >= bv.size || (last && len(bv.buf) > 0) {
+		n := bv.size
+		if n > len(bv.buf) {
+			n = len(bv.buf)
+		}
+		isLast := last && n == len(bv.buf)
+		next, ok := bv.next[bv.index]
+		if !ok || (len(next) == 0) != isLast {
+			return makeError(0xE9A6D3, "hash of block", bv.index+2,
+				"not received")
+		}
+		if !bytes.Equal(blockHash(bv.hasher, bv.buf[:n], next), bv.want) {
+			return makeError(0xE4C8B1, "block", bv.index+1, "hash mismatch")
+		}
+		err := release(bv.buf[:n])
+		if err != nil {
+			return err
+		}
+		bv.buf = append(bv.buf[:0], bv.buf[n:]...)
+		delete(bv.next, bv.index)
+		bv.index++
+		bv.want = next
+	}
+	return nil
+} //                                                                         add
+
+// end
@@ -0,0 +1,118 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                           /[verified_blocks_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// (bv *blockVerifier) add(data []byte, last bool,
+//     release func(block []byte) error,
+// ) error
+//
+// go test -run Test_blockVerifier_add_
+
+// must release only whole verified blocks, and the last block once
+// 'last' is set, and must release nothing after a tampered block
+func Test_blockVerifier_add_(t *testing.T) {
+	comp := make([]byte, 250)
+	rand.New(rand.NewSource(1)).Read(comp)
+	cf := NewDefaultConfig()
+	chain := cf.blockChain(comp, 100)
+	newVerifier := func() *blockVerifier {
+		bv := newBlockVerifier(&fragmentHeader{vroot: chain[0], vblock: 100},
+			cf.Hasher)
+		for _, end := range []int{100, 200, 250} {
+			var h fragmentHeader
+			err := readBlockFields(" "+makeBlockFields(chain, 100, end), &h)
+			if err != nil {
+				t.Fatal("0xE7B3D6", err)
+			}
+			if err := bv.learn(&h); err != nil {
+				t.Fatal("0xE2D8A5", err)
+			}
+		}
+		return bv
+	}
+	var released []byte
+	release := func(block []byte) error {
+		released = append(released, block...)
+		return nil
+	}
+	bv := newVerifier()
+	for a := 0; a < 240; a += 60 {
+		if err := bv.add(comp[a:a+60], false, release); err != nil {
+			t.Error("0xE8F2C3", err)
+		}
+	}
+	if !bytes.Equal(released, comp[:200]) {
+		t.Error("0xE4A9E7", len(released))
+	}
+	if err := bv.add(comp[240:], true, release); err != nil {
+		t.Error("0xE1C6B8", err)
+	}
+	if !bytes.Equal(released, comp) {
+		t.Error("0xE9D4A6", len(released))
+	}
+	// a tampered second block
+	released = nil
+	bad := append([]byte{}, comp...)
+	bad[150] ^= 1
+	err := newVerifier().add(bad, true, release)
+	if !matchError(err, "block 2 hash mismatch") ||
+		!bytes.Equal(released, comp[:100]) {
+		t.Error("0xE5B1F9", "wrong error:", err, len(released))
+	}
+}
+
+// Configuration.VerifiedBlockSize
+//
+// go test -run Test_VerifiedBlockSize_
+
+// must deliver a value sent in verified blocks to ReceiveStream
+func Test_VerifiedBlockSize_(t *testing.T) {
+	key := []byte("aA2Xh41FiC4Wtj3e5b2LbytMdn6on7P0")
+	got := make(chan []byte, 1)
+	rc := Receiver{
+		Port: 9867, CryptoKey: key, Config: NewDefaultConfig(),
+		ReceiveStream: func(k string) (io.WriteCloser, error) {
+			pr, pw := io.Pipe()
+			go func() {
+				v, _ := io.ReadAll(pr)
+				got <- v
+			}()
+			return pw, nil
+		},
+	}
+	rc.Config.LogWriter = nil
+	go func() { _ = rc.Run() }()
+	defer func() { rc.Stop() }()
+	time.Sleep(500 * time.Millisecond)
+	//
+	cf := NewDefaultConfig()
+	cf.LogWriter = nil
+	cf.VerifiedBlockSize = 2500
+	value := make([]byte, 20000)
+	rand.New(rand.NewSource(2)).Read(value)
+	sd := Sender{Address: "127.0.0.1:9867", CryptoKey: key, Config: cf}
+	if err := sd.Send("k", value); err != nil {
+		t.Fatal("0xE3F9C2", err)
+	}
+	select {
+	case v := <-got:
+		if !bytes.Equal(v, value) {
+			t.Error("0xE6C4D8", len(v))
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("0xE8A1B7", "value not received")
+	}
+}
+
+// end
@@ -0,0 +1,104 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                        /[version.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// ModulePath is the import path of this module.
+const ModulePath = "github.com/balacode/udpt"
+
+// ProtocolVersion is the version of the wire protocol spoken by this
+// package. Version 1 is the protocol of Senders and Receivers that
+// don't announce a version; version 2 announces it in the key
+// exchange handshake (see Configuration.KeyExchange).
+const ProtocolVersion = 2
+
+// MinProtocolVersion is the oldest protocol version of a peer that this
+// package can talk to. The key exchange handshake fails with
+// ErrProtocolVersion if the peer's version is outside the range from
+// MinProtocolVersion to ProtocolVersion.
+const MinProtocolVersion = 1
+
+// BuildInfo describes the build of this package, so that applications
+// can log it, e.g. when reporting problems with a transfer.
+type BuildInfo struct {
+
+	// Version is the version of this module, such as "v1.2.3", or
+	// "(devel)" if it was built from a working copy of its source.
+	Version string
+
+	// ProtocolVersion and MinProtocolVersion are the
+	// constants of the same name in this package.
+	ProtocolVersion    int
+	MinProtocolVersion int
+
+	// GoVersion is the version of Go used to build the program.
+	GoVersion string
+
+	// Revision is the version control revision the program was built
+	// from, and Modified is true if the working copy had uncommitted
+	// changes. They are only known when this module is the program's
+	// main module and was built from a repository.
+	Revision string
+	Modified bool
+} //                                                                   BuildInfo
+
+// Version returns the version of this module, such as "v1.2.3",
+// or "(devel)" if it isn't known. See GetBuildInfo().
+func Version() string {
+	return GetBuildInfo().Version
+} //                                                                     Version
+
+// GetBuildInfo returns the build information of this package,
+// read from the build information embedded in the program.
+func GetBuildInfo() BuildInfo {
+	ret := BuildInfo{
+		Version:            "(devel)",
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		GoVersion:          runtime.Version(),
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ret
+	}
+	var mod *debug.Module
+	if bi.Main.Path == ModulePath {
+		mod = &bi.Main
+		for _, st := range bi.Settings {
+			switch st.Key {
+			case "vcs.revision":
+				ret.Revision = st.Value
+			case "vcs.modified":
+				ret.Modified = st.Value == "true"
+			}
+		}
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == ModulePath {
+			mod = dep
+			if dep.Replace != nil {
+				mod = dep.Replace
+			}
+			break
+		}
+	}
+	if mod != nil && mod.Version != "" {
+		ret.Version = mod.Version
+	}
+	return ret
+} //                                                                GetBuildInfo
+
+// supportedProtocol returns true if a peer speaking
+// protocol 'version' can be talked to.
+func supportedProtocol(version int) bool {
+	return version >= MinProtocolVersion && version <= ProtocolVersion
+} //                                                           supportedProtocol
+
+// end
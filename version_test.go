@@ -0,0 +1,52 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                   /[version_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"runtime"
+	"testing"
+)
+
+// to run all tests in this file:
+// go test -v -run Test_version_*
+
+// -----------------------------------------------------------------------------
+
+// GetBuildInfo() BuildInfo
+//
+// go test -run Test_version_GetBuildInfo_
+//
+func Test_version_GetBuildInfo_(t *testing.T) {
+	bi := GetBuildInfo()
+	if bi.Version == "" || bi.Version != Version() {
+		t.Error("0xE3F6A2", bi.Version, Version())
+	}
+	if bi.ProtocolVersion != ProtocolVersion ||
+		bi.MinProtocolVersion != MinProtocolVersion {
+		t.Error("0xE9D4B7", bi.ProtocolVersion, bi.MinProtocolVersion)
+	}
+	if bi.GoVersion != runtime.Version() {
+		t.Error("0xE2A15C", bi.GoVersion)
+	}
+}
+
+// supportedProtocol(version int) bool
+//
+// go test -run Test_version_supportedProtocol_
+//
+func Test_version_supportedProtocol_(t *testing.T) {
+	test := func(version int, want bool) {
+		if got := supportedProtocol(version); got != want {
+			t.Error("0xE7B3E0", version, "got:", got)
+		}
+	}
+	test(MinProtocolVersion-1, false)
+	test(MinProtocolVersion, true)
+	test(ProtocolVersion, true)
+	test(ProtocolVersion+1, false)
+}
+
+// end
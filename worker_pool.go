@@ -0,0 +1,73 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[worker_pool.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"sync"
+)
+
+// defaultMaxWorkers is the number of goroutines a worker pool
+// may use when Configuration.MaxWorkers is zero.
+const defaultMaxWorkers = 16
+
+// workerPool runs tasks on a bounded number of goroutines. Workers are
+// started as tasks arrive, until there are 'size' of them, and are then
+// reused for the following tasks, so that sending thousands of packets
+// doesn't start thousands of goroutines.
+//
+// run() must only be called from one goroutine. Call wait() once all
+// tasks have been given, to wait for them and let the workers exit.
+//
+type workerPool struct {
+	tasks   chan func()
+	size    int
+	started int
+	wg      sync.WaitGroup
+} //                                                                  workerPool
+
+// newWorkerPool creates a workerPool with up to 'size' workers.
+// If 'size' is zero (or less), uses defaultMaxWorkers.
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = defaultMaxWorkers
+	}
+	return &workerPool{tasks: make(chan func()), size: size}
+} //                                                               newWorkerPool
+
+// run gives 'task' to an idle worker, or starts a new worker if there
+// are fewer than the pool's size. Otherwise it waits until a worker
+// becomes idle.
+func (wp *workerPool) run(task func()) {
+	if wp.started < wp.size {
+		select {
+		case wp.tasks <- task:
+		default:
+			wp.started++
+			wp.wg.Add(1)
+			go wp.work(task)
+		}
+		return
+	}
+	wp.tasks <- task
+} //                                                                         run
+
+// work runs 'task', then the tasks given by run()
+// until wait() closes the task channel.
+func (wp *workerPool) work(task func()) {
+	defer wp.wg.Done()
+	for ; task != nil; task = <-wp.tasks {
+		task()
+	}
+} //                                                                        work
+
+// wait waits until all tasks have finished and all workers have exited.
+// The pool can't be used afterwards.
+func (wp *workerPool) wait() {
+	close(wp.tasks)
+	wp.wg.Wait()
+} //                                                                        wait
+
+// end
@@ -0,0 +1,47 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[worker_pool_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// (wp *workerPool) run(task func())
+//
+// go test -run Test_workerPool_run_
+
+// must run every task, on no more goroutines than the pool's size
+func Test_workerPool_run_(t *testing.T) {
+	wp := newWorkerPool(4)
+	var mu sync.Mutex
+	running, most, done := 0, 0, 0
+	for i := 0; i < 100; i++ {
+		wp.run(func() {
+			mu.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			done++
+			mu.Unlock()
+		})
+	}
+	wp.wait()
+	if done != 100 || most > 4 || wp.started > 4 {
+		t.Error("0xE6256D", done, most, wp.started)
+	}
+	if newWorkerPool(0).size != defaultMaxWorkers {
+		t.Error("0xEADD28")
+	}
+}
+
+// end
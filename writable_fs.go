@@ -0,0 +1,105 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                    /[writable_fs.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WritableFS is a file system to which FileWriter and WriteToFS() write
+// the data items received, such as an in-memory file system in tests,
+// or an adapter for cloud storage in serverless environments. OSFS
+// writes to the operating system's file system.
+//
+// Each file is written to a temporary file, which is renamed to the
+// file's name once it is complete. Names are made by filepath.Join().
+//
+// Files are flushed and their ownership is set (see FileWriter.Sync and
+// FileRoute.Chown) if the io.WriteCloser returned by Create() has Sync()
+// and Chown() methods, like *os.File. Directories are flushed if the
+// WritableFS has a SyncDir(name string) error method, and modification
+// times are set by WriteToFS() if it has a Chtimes() method like
+// os.Chtimes(). FileRoute only rotates files (see FileRoute.MaxAge)
+// if the WritableFS also has ReadDir() and Open() methods like
+// os.ReadDir() and os.Open().
+//
+type WritableFS interface {
+
+	// Create creates the new file 'name' with permission bits 'perm',
+	// and any missing parent directories with permission bits
+	// 'dirPerm', and returns it for writing. It fails with an error
+	// matching fs.ErrExist if the file already exists.
+	Create(name string, perm, dirPerm os.FileMode) (io.WriteCloser, error)
+
+	// Rename renames (moves) file 'oldName' to 'newName',
+	// replacing 'newName' if it exists.
+	Rename(oldName, newName string) error
+
+	// Remove removes file 'name'.
+	Remove(name string) error
+} //                                                                  WritableFS
+
+// OSFS is a WritableFS that writes to the operating system's file system.
+type OSFS struct{}
+
+var _ WritableFS = OSFS{}
+
+// Create implements WritableFS.Create() and returns an *os.File.
+// The file gets exactly the permission bits 'perm', whatever the umask.
+func (OSFS) Create(name string, perm, dirPerm os.FileMode,
+) (io.WriteCloser, error) {
+	err := os.MkdirAll(filepath.Dir(name), dirPerm)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return nil, err
+	}
+	err = file.Chmod(perm)
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(name)
+		return nil, err
+	}
+	return file, nil
+} //                                                                      Create
+
+// Rename implements WritableFS.Rename() using os.Rename().
+func (OSFS) Rename(oldName, newName string) error {
+	return os.Rename(oldName, newName)
+} //                                                                      Rename
+
+// Remove implements WritableFS.Remove() using os.Remove().
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+} //                                                                      Remove
+
+// ReadDir lists directory 'name' using os.ReadDir().
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+} //                                                                     ReadDir
+
+// Open opens file 'name' for reading using os.Open().
+func (OSFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+} //                                                                        Open
+
+// SyncDir flushes directory 'name' to disk (see syncDir).
+func (OSFS) SyncDir(name string) error {
+	return syncDir(name)
+} //                                                                     SyncDir
+
+// Chtimes sets the access and modification times of file 'name'.
+func (OSFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+} //                                                                     Chtimes
+
+// end
@@ -0,0 +1,130 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                               /[writable_fs_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package udpt
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memFS is an in-memory WritableFS without directories.
+type memFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	modes map[string]os.FileMode
+}
+
+// memFile is a file being written to a memFS.
+type memFile struct {
+	fsys *memFS
+	name string
+	buf  bytes.Buffer
+}
+
+func newMemFS() *memFS {
+	return &memFS{
+		files: make(map[string][]byte),
+		modes: make(map[string]os.FileMode),
+	}
+}
+
+func (mf *memFS) Create(name string, perm, dirPerm os.FileMode,
+) (io.WriteCloser, error) {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+	if _, exists := mf.files[name]; exists {
+		return nil, fs.ErrExist
+	}
+	mf.files[name] = nil
+	mf.modes[name] = perm
+	return &memFile{fsys: mf, name: name}, nil
+}
+
+func (mf *memFS) Rename(oldName, newName string) error {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+	data, exists := mf.files[oldName]
+	if !exists {
+		return fs.ErrNotExist
+	}
+	mf.files[newName], mf.modes[newName] = data, mf.modes[oldName]
+	delete(mf.files, oldName)
+	delete(mf.modes, oldName)
+	return nil
+}
+
+func (mf *memFS) Remove(name string) error {
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+	delete(mf.files, name)
+	delete(mf.modes, name)
+	return nil
+}
+
+func (mf *memFile) Write(p []byte) (int, error) { return mf.buf.Write(p) }
+
+func (mf *memFile) Close() error {
+	mf.fsys.mu.Lock()
+	defer mf.fsys.mu.Unlock()
+	mf.fsys.files[mf.name] = mf.buf.Bytes()
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// FileRoute.FS
+//
+// go test -run Test_FileRoute_FS_
+
+// must write files to the route's WritableFS without leaving temporary
+// files, and fail when ownership is requested but can't be set
+func Test_FileRoute_FS_(t *testing.T) {
+	mem := newMemFS()
+	fw, err := NewFileWriter(FileRoute{Prefix: "in/", Dir: "/out", FS: mem,
+		FileMode: 0600})
+	if err != nil {
+		t.Fatal("0xE4D1C7", err)
+	}
+	for _, data := range []string{"first", "second"} {
+		err = fw.Receive("in/a/b.txt", []byte(data))
+		if err != nil {
+			t.Fatal("0xE8A5F2", err)
+		}
+	}
+	path := filepath.Join("/out", "a", "b.txt")
+	var names []string
+	for name := range mem.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != path || string(mem.files[path]) !=
+		"second" || mem.modes[path] != 0600 {
+		t.Error("0xE2F6B3", names, string(mem.files[path]), mem.modes[path])
+	}
+	// ownership can't be set on a memFS
+	fw.Routes[0].Chown = true
+	err = fw.Receive("in/c.txt", nil)
+	if !matchError(err, "can't chown") || len(mem.files) != 1 {
+		t.Error("0xE6C0A9", "wrong error:", err, len(mem.files))
+	}
+	// WriteToFS must write the files sent by SendFile()
+	write := WriteToFS(mem, "/files")
+	item := makeFileItem(FileMeta{Path: "d/e.txt", Mode: 0640}, []byte("x"))
+	err = write("ignored", item)
+	path = filepath.Join("/files", "d", "e.txt")
+	if err != nil || string(mem.files[path]) != "x" ||
+		mem.modes[path] != 0640 {
+		t.Error("0xE1B9D5", err, string(mem.files[path]), mem.modes[path])
+	}
+}
+
+// end
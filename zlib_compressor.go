@@ -88,4 +88,12 @@ func (*zlibCompressor) uncompressDI(
 	return ret, nil
 } //                                                                uncompressDI
 
+// NewUncompressReader returns a reader of the bytes uncompressed from
+// the zlib stream read from 'r', which lets a Receiver uncompress data
+// items as they arrive (see StreamCompression). The size of the
+// uncompressed data that follows the stream is not read.
+func (*zlibCompressor) NewUncompressReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+} //                                                         NewUncompressReader
+
 // end
@@ -0,0 +1,172 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /zstd/[dict.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// dictMagic begins every Zstandard dictionary (RFC 8878, section 5)
+const dictMagic = 0xEC30A437
+
+// DictTrainer samples representative payloads, such as the values of
+// data items, and trains a Zstandard dictionary from them with Train.
+// A dictionary greatly improves the compression of small payloads that
+// share a structure, e.g. JSON or Protobuf messages of a few hundred
+// bytes, which on their own are too short to compress well.
+//
+// When more than MaxSamples payloads are added, each one replaces a
+// random sample, so the samples represent all of them. It is safe
+// for concurrent use, e.g. from a Receiver's handler.
+type DictTrainer struct {
+
+	// MaxSamples is the number of payloads kept. Zero means 1000.
+	MaxSamples int
+
+	// MaxSize is the maximum size of the dictionary's content, in
+	// bytes. Zero means 64 KiB.
+	MaxSize int
+
+	mu      sync.Mutex
+	samples [][]byte
+	added   int
+} //                                                                 DictTrainer
+
+// Add adds 'payload' to the samples, keeping a copy of it.
+func (dt *DictTrainer) Add(payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	max := dt.MaxSamples
+	if max <= 0 {
+		max = 1000
+	}
+	dt.added++
+	if len(dt.samples) < max {
+		dt.samples = append(dt.samples, append([]byte(nil), payload...))
+		return
+	}
+	// reservoir sampling: keep each payload with probability max/added
+	if i := rand.Intn(dt.added); i < max {
+		dt.samples[i] = append([]byte(nil), payload...)
+	}
+} //                                                                         Add
+
+// Train returns a dictionary trained from the samples, for use with
+// NewWithDict() or SaveDict(). Its content is made of half the samples,
+// the most recent ones last, up to MaxSize bytes, and its entropy tables
+// are tuned by compressing the other half with it. 'id' identifies it
+// in compressed data; zero derives an ID from the content. Returns an
+// error if no samples have been added.
+func (dt *DictTrainer) Train(id uint32) (dict []byte, err error) {
+	dt.mu.Lock()
+	samples := append([][]byte(nil), dt.samples...)
+	maxSize := dt.MaxSize
+	dt.mu.Unlock()
+	if len(samples) == 0 {
+		return nil, errors.New("zstd: no samples to train a dictionary")
+	}
+	if maxSize <= 0 {
+		maxSize = 64 * 1024
+	}
+	// Zstandard references recent content with shorter offsets,
+	// so the samples at the end of the history are the cheapest
+	contents, recent := samples, samples
+	if len(samples) > 1 {
+		contents, recent = samples[:len(samples)/2], samples[len(samples)/2:]
+	}
+	var history []byte
+	for i := len(recent) - 1; i >= 0 && len(history) < maxSize; i-- {
+		s := recent[i]
+		if n := maxSize - len(history); len(s) > n {
+			s = s[:n]
+		}
+		history = append(append([]byte(nil), s...), history...)
+	}
+	if len(history) < 8 {
+		return nil, errors.New("zstd: samples too small to train a dictionary")
+	}
+	if id == 0 {
+		// IDs below 32768 are reserved for registered dictionaries
+		id = 32768 + crc32.ChecksumIEEE(history)%(1<<31-32768)
+	}
+	defer func() {
+		// BuildDict panics if the history matches the contents entirely
+		if r := recover(); r != nil {
+			dict, err = nil, fmt.Errorf("zstd: can't train dictionary: %v", r)
+		}
+	}()
+	dict, err = zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: contents,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("zstd: %w", err)
+	}
+	return dict, nil
+} //                                                                       Train
+
+// NewWithDict creates a Compressor like New(), which compresses and
+// uncompresses with dictionary 'dict', made by DictTrainer.Train() or
+// loaded with LoadDict(). The Sender and the Receiver must use the
+// same dictionary: data compressed with it can't be uncompressed
+// without it.
+func NewWithDict(level int, dict []byte) *Compressor {
+	return &Compressor{level: level, dict: dict}
+} //                                                                 NewWithDict
+
+// SaveDict writes dictionary 'dict' to the file at 'path',
+// so that both ends can load it with LoadDict().
+func SaveDict(path string, dict []byte) error {
+	err := checkDict(dict)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, dict, 0644)
+	if err != nil {
+		return fmt.Errorf("zstd: %w", err)
+	}
+	return nil
+} //                                                                    SaveDict
+
+// LoadDict reads a dictionary saved by SaveDict(), or by the zstd
+// command's --train option, from the file at 'path'. Returns an error
+// if the file can't be read or doesn't hold a Zstandard dictionary.
+func LoadDict(path string) ([]byte, error) {
+	dict, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("zstd: %w", err)
+	}
+	err = checkDict(dict)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, path)
+	}
+	return dict, nil
+} //                                                                    LoadDict
+
+// checkDict returns an error if 'dict' isn't a Zstandard dictionary.
+func checkDict(dict []byte) error {
+	if len(dict) < 8 || binary.LittleEndian.Uint32(dict) != dictMagic ||
+		bytes.Equal(dict[4:8], []byte{0, 0, 0, 0}) {
+		return errors.New("zstd: not a dictionary")
+	}
+	return nil
+} //                                                                   checkDict
+
+// end
@@ -0,0 +1,108 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /zstd/[dict_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package zstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeTestMessage returns a small JSON message like those
+// of a telemetry workload, which compresses poorly alone
+func makeTestMessage(i int) []byte {
+	return []byte(fmt.Sprintf(`{"device":"sensor-%04d","type":"reading",`+
+		`"temperature":%d.%d,"humidity":%d,"status":"ok","firmware":"2.4.1"}`,
+		i, 15+i%10, i%10, 40+i%30))
+}
+
+// (dt *DictTrainer) Train(id uint32) ([]byte, error)
+// NewWithDict(level int, dict []byte) *Compressor
+//
+// go test -run Test_DictTrainer_
+//
+// must train a dictionary that compresses small messages better
+func Test_DictTrainer_(t *testing.T) {
+	var dt DictTrainer
+	if _, err := dt.Train(0); err == nil {
+		t.Error("0xE5C2A9", "trained without samples")
+	}
+	dt.MaxSamples = 100
+	for i := 0; i < 500; i++ {
+		dt.Add(makeTestMessage(i))
+	}
+	if len(dt.samples) != 100 {
+		t.Error("0xE1A8D3", len(dt.samples))
+	}
+	dict, err := dt.Train(0)
+	if err != nil {
+		t.Fatal("0xE9E4B0", err)
+	}
+	msg := makeTestMessage(1234)
+	plain, _ := New(3).Compress(msg)
+	zc := NewWithDict(3, dict)
+	comp, err := zc.Compress(msg)
+	if err != nil || len(comp) >= len(plain) {
+		t.Error("0xE4F1C7", err, len(comp), len(plain))
+	}
+	got, err := zc.Uncompress(comp)
+	if err != nil || !bytes.Equal(got, msg) {
+		t.Error("0xE7B5E2", err)
+	}
+	rd, err := zc.NewUncompressReader(bytes.NewReader(comp))
+	if err != nil {
+		t.Fatal("0xE2D7A4", err)
+	}
+	got, err = io.ReadAll(rd)
+	if err != nil || !bytes.Equal(got, msg) {
+		t.Error("0xE0A3F8", err)
+	}
+	_ = rd.Close()
+	// can't uncompress without the dictionary
+	if _, err := New(3).Uncompress(comp); err == nil {
+		t.Error("0xE6C9B1")
+	}
+}
+
+// SaveDict(path string, dict []byte) error
+// LoadDict(path string) ([]byte, error)
+//
+// go test -run Test_LoadDict_
+//
+func Test_LoadDict_(t *testing.T) {
+	var dt DictTrainer
+	for i := 0; i < 50; i++ {
+		dt.Add(makeTestMessage(i))
+	}
+	dict, err := dt.Train(40000)
+	if err != nil {
+		t.Fatal("0xE8A0C6", err)
+	}
+	path := filepath.Join(t.TempDir(), "telemetry.dict")
+	err = SaveDict(path, dict)
+	if err != nil {
+		t.Fatal("0xE3F5D2", err)
+	}
+	got, err := LoadDict(path)
+	if err != nil || !bytes.Equal(got, dict) {
+		t.Error("0xE7D2B8", err)
+	}
+	if err := SaveDict(path, []byte("not a dictionary")); err == nil {
+		t.Error("0xE4B6F0")
+	}
+	_ = os.WriteFile(path, []byte("not a dictionary"), 0644)
+	if _, err := LoadDict(path); err == nil {
+		t.Error("0xE1E9C5")
+	}
+	if _, err := LoadDict(path + ".missing"); err == nil {
+		t.Error("0xE5A4D7")
+	}
+}
+
+// end
@@ -0,0 +1,19 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                       /zstd/[go.mod]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// The Zstandard compressor is a separate module, so that udpt itself
+// keeps using only the standard library.
+module github.com/balacode/udpt/zstd
+
+go 1.21
+
+require (
+	github.com/balacode/udpt v0.0.0
+	github.com/klauspost/compress v1.17.9
+)
+
+replace github.com/balacode/udpt => ../
+
+// end
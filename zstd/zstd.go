@@ -0,0 +1,113 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                      /zstd/[zstd.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+// Package zstd provides a udpt Compression that uses Zstandard
+// (RFC 8878), which compresses and uncompresses much faster than
+// zlib at similar ratios, making it better for file transfers.
+//
+// Assign it to Configuration.Compressor on both the Sender and the
+// Receiver:
+//
+//	cf := udpt.NewDefaultConfig()
+//	cf.Compressor = zstd.New(3)
+//
+// For small data items, train a dictionary with DictTrainer
+// and use NewWithDict() instead.
+//
+package zstd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/balacode/udpt"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor implements udpt.Compression and udpt.StreamCompression
+// using Zstandard. It is safe for concurrent use.
+type Compressor struct {
+	level int
+	dict  []byte // see NewWithDict()
+
+	once sync.Once
+	enc  *zstd.Encoder
+	dec  *zstd.Decoder
+	err  error
+} //                                                                  Compressor
+
+var _ udpt.StreamCompression = (*Compressor)(nil)
+
+// New creates a Compressor that compresses with Zstandard 'level',
+// from 1 (fastest) to 22 (smallest). Levels are mapped to the nearest
+// level the encoder implements. Zero (or less) uses the default, 3.
+func New(level int) *Compressor {
+	return &Compressor{level: level}
+} //                                                                         New
+
+// init creates the encoder and decoder when they are first used.
+func (zc *Compressor) init() error {
+	zc.once.Do(func() {
+		level := zstd.SpeedDefault
+		if zc.level > 0 {
+			level = zstd.EncoderLevelFromZstd(zc.level)
+		}
+		encOpts := []zstd.EOption{zstd.WithEncoderLevel(level)}
+		var decOpts []zstd.DOption
+		if len(zc.dict) > 0 {
+			encOpts = append(encOpts, zstd.WithEncoderDict(zc.dict))
+			decOpts = append(decOpts, zstd.WithDecoderDicts(zc.dict))
+		}
+		zc.enc, zc.err = zstd.NewWriter(nil, encOpts...)
+		if zc.err != nil {
+			return
+		}
+		zc.dec, zc.err = zstd.NewReader(nil, decOpts...)
+	})
+	return zc.err
+} //                                                                        init
+
+// Compress compresses 'data' using Zstandard and returns the compressed
+// bytes. If there was an error, returns nil and the error instance.
+func (zc *Compressor) Compress(data []byte) ([]byte, error) {
+	err := zc.init()
+	if err != nil {
+		return nil, fmt.Errorf("zstd: %w", err)
+	}
+	return zc.enc.EncodeAll(data, nil), nil
+} //                                                                    Compress
+
+// Uncompress uncompresses bytes using Zstandard and returns the
+// uncompressed bytes. If there was an error, returns nil and the
+// error instance.
+func (zc *Compressor) Uncompress(comp []byte) ([]byte, error) {
+	err := zc.init()
+	if err != nil {
+		return nil, fmt.Errorf("zstd: %w", err)
+	}
+	ret, err := zc.dec.DecodeAll(comp, nil)
+	if err != nil {
+		return nil, fmt.Errorf("zstd: %w", err)
+	}
+	return ret, nil
+} //                                                                  Uncompress
+
+// NewUncompressReader returns a reader of the bytes uncompressed from
+// the Zstandard stream read from 'r', which lets a Receiver uncompress
+// data items as they arrive. Implements udpt.StreamCompression.
+func (zc *Compressor) NewUncompressReader(r io.Reader) (io.ReadCloser, error) {
+	opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if len(zc.dict) > 0 {
+		opts = append(opts, zstd.WithDecoderDicts(zc.dict))
+	}
+	dec, err := zstd.NewReader(r, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("zstd: %w", err)
+	}
+	return dec.IOReadCloser(), nil
+} //                                                         NewUncompressReader
+
+// end
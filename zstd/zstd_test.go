@@ -0,0 +1,48 @@
+// -----------------------------------------------------------------------------
+// github.com/balacode/udpt                                 /zstd/[zstd_test.go]
+// (c) balarabe@protonmail.com                                      License: MIT
+// -----------------------------------------------------------------------------
+
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// (zc *Compressor) Compress(data []byte) ([]byte, error)
+// (zc *Compressor) Uncompress(comp []byte) ([]byte, error)
+//
+// go test -run Test_Compressor_
+//
+func Test_Compressor_(t *testing.T) {
+	data := []byte(strings.Repeat("The quick brown fox. ", 1000))
+	for _, level := range []int{0, 1, 3, 9, 22} {
+		zc := New(level)
+		comp, err := zc.Compress(data)
+		if err != nil || len(comp) >= len(data)/10 {
+			t.Error("0xE90FBE", level, err, len(comp))
+		}
+		got, err := zc.Uncompress(comp)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Error("0xECB334", level, err)
+		}
+		// the stream must uncompress to the same bytes
+		rd, err := zc.NewUncompressReader(bytes.NewReader(comp))
+		if err != nil {
+			t.Fatal("0xE68381", err)
+		}
+		got, err = io.ReadAll(rd)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Error("0xEA4C88", level, err)
+		}
+		_ = rd.Close()
+	}
+	if _, err := New(3).Uncompress([]byte("not zstd")); err == nil {
+		t.Error("0xE10EC3")
+	}
+}
+
+// end